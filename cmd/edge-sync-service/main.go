@@ -39,11 +39,17 @@ func main() {
 		authenticationHandler = &security.DummyAuthenticate{}
 	case "preset":
 		authenticationHandler = &security.PresetAuthenticate{}
+	case "token":
+		authenticationHandler = &security.TokenAuthenticate{}
 	default:
-		fmt.Printf("Unknown Authentication handler identifier %s. Valid values are dummy.\n",
+		fmt.Printf("Unknown Authentication handler identifier %s. Valid values are dummy, preset, and token.\n",
 			common.Configuration.AuthenticationHandler)
 		os.Exit(99)
 	}
 
+	if common.Configuration.AuthFailureThreshold > 0 {
+		authenticationHandler = &security.LockingAuthenticate{Authenticator: authenticationHandler}
+	}
+
 	base.StandaloneSyncService(authenticationHandler)
 }
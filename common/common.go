@@ -8,9 +8,12 @@ import (
 	"hash"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // SyncServiceError is a common error type used in the sync service
@@ -33,6 +36,55 @@ func IsInvalidRequest(err error) bool {
 	return ok
 }
 
+// ValidationError is the error for invalid objects' meta data, it lists all the problems found in the meta data
+// swagger:ignore
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid meta data: " + strings.Join(e.Problems, "; ")
+}
+
+// IsValidationError returns true if the error passed in is the common.ValidationError error
+func IsValidationError(err error) bool {
+	_, ok := err.(*ValidationError)
+	return ok
+}
+
+// ReadOnlyError is the error for write requests rejected because the storage is in read-only mode
+// swagger:ignore
+type ReadOnlyError struct {
+	Message string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return e.Message
+}
+
+// IsReadOnlyError returns true if the error passed in is the common.ReadOnlyError error
+func IsReadOnlyError(err error) bool {
+	_, ok := err.(*ReadOnlyError)
+	return ok
+}
+
+// ObjectTooLargeError is the error for object data rejected because it exceeds the maximum object size
+// swagger:ignore
+type ObjectTooLargeError struct {
+	Message string
+	MaxSize int64
+}
+
+func (e *ObjectTooLargeError) Error() string {
+	return e.Message
+}
+
+// IsObjectTooLargeError returns true if the error passed in is the common.ObjectTooLargeError error
+func IsObjectTooLargeError(err error) bool {
+	_, ok := err.(*ObjectTooLargeError)
+	return ok
+}
+
 // SetupError is the error for setup issues
 // swagger:ignore
 type SetupError struct {
@@ -123,6 +175,108 @@ type Destination struct {
 	// CodeVersion is the sync service code version used by the destination
 	//   required: true
 	CodeVersion string `json:"codeVersion" bson:"code-version"`
+
+	// LastConnected is the time the destination last retrieved its objects or notifications.
+	// It is only set in the destinations returned when listing offline destinations.
+	LastConnected time.Time `json:"lastConnected" bson:"-"`
+}
+
+// DestinationID identifies a destination within an organization
+// swagger:ignore
+type DestinationID struct {
+	// DestType is the destination type
+	DestType string `json:"destinationType" bson:"destination-type"`
+
+	// DestID is the destination ID
+	DestID string `json:"destinationID" bson:"destination-id"`
+}
+
+// ObjectKey identifies an object within an organization
+// swagger:ignore
+type ObjectKey struct {
+	// ObjectType is the object type
+	ObjectType string `json:"objectType" bson:"object-type"`
+
+	// ObjectID is the object ID
+	ObjectID string `json:"objectID" bson:"object-id"`
+}
+
+// ObjectFilter specifies the objects to retrieve by an object search. Empty fields match any value.
+// swagger:ignore
+type ObjectFilter struct {
+	// OrgID is the organization of the objects
+	OrgID string `json:"orgID,omitempty"`
+
+	// ObjectType is the object type
+	ObjectType string `json:"objectType,omitempty"`
+
+	// ObjectID is the object ID
+	ObjectID string `json:"objectID,omitempty"`
+
+	// DestinationType is the type of a destination of the objects
+	DestinationType string `json:"destinationType,omitempty"`
+
+	// DestinationID is the ID of a destination of the objects, used only with DestinationType
+	DestinationID string `json:"destinationID,omitempty"`
+}
+
+// ObjectEvent is an event of the creation, update, or deletion of an object
+// swagger:ignore
+type ObjectEvent struct {
+	// Type is the type of the event (see the object events below)
+	Type string `json:"type"`
+
+	OrgID      string `json:"orgID"`
+	ObjectType string `json:"objectType"`
+	ObjectID   string `json:"objectID"`
+
+	// MetaData is the meta data of the object after the event, it is nil if the object was deleted
+	MetaData *MetaData `json:"metaData,omitempty"`
+
+	// Status is the status of the object after the event, it is empty if the object was deleted
+	Status string `json:"status,omitempty"`
+}
+
+// ObjectTypeStorageStats describes the storage used by the objects of a type
+// swagger:model
+type ObjectTypeStorageStats struct {
+	// ObjectType is the type of the objects
+	ObjectType string `json:"objectType"`
+
+	// ObjectCount is the number of objects of the type
+	ObjectCount int `json:"objectCount"`
+
+	// ObjectSize is the total size of the data of the objects, as declared in their meta data
+	ObjectSize int64 `json:"objectSize"`
+
+	// StoredDataSize is the total number of bytes used to store the data of the objects
+	StoredDataSize int64 `json:"storedDataSize"`
+}
+
+// IncompleteObject is an object that wasn't consumed yet by at least one of its destinations
+// swagger:model
+type IncompleteObject struct {
+	// MetaData is the meta data of the object
+	MetaData MetaData `json:"metaData"`
+
+	// PendingDestinations is the number of destinations that didn't consume the object
+	PendingDestinations int `json:"pendingDestinations"`
+
+	// StatusCounts is the number of destinations that didn't consume the object in each delivery status
+	StatusCounts map[string]int `json:"statusCounts"`
+}
+
+// DecommissionedDestination describes the records that were removed when a destination was decommissioned
+// swagger:model
+type DecommissionedDestination struct {
+	// ObjectsUpdated is the number of objects the destination was removed from
+	ObjectsUpdated int `json:"objectsUpdated"`
+
+	// NotificationsDeleted is the number of the destination's notifications that were deleted
+	NotificationsDeleted int `json:"notificationsDeleted"`
+
+	// DestinationDeleted is true if the destination's record was deleted
+	DestinationDeleted bool `json:"destinationDeleted"`
 }
 
 // PolicyProperty is a property in a policy
@@ -298,6 +452,12 @@ type MetaData struct {
 	// When a DestinationPolicy is provided DestinationsList, DestType, and DestID must be omitted.
 	DestinationPolicy *Policy `json:"destinationPolicy" bson:"destination-policy"`
 
+	// Broadcast is a flag indicating that the object is sent to all the destinations of DestType, including
+	// destinations that register after the object was stored.
+	// When Broadcast is set DestType must be provided, and DestID, DestinationsList, and DestinationPolicy must be omitted.
+	// Optional field, default is false.
+	Broadcast bool `json:"broadcast,omitempty" bson:"broadcast,omitempty"`
+
 	// Expiration is a timestamp/date indicating when the object expires.
 	// When the object expires it is automatically deleted.
 	// The timestamp should be provided in RFC3339 format.
@@ -328,6 +488,12 @@ type MetaData struct {
 	// Optional field, if omitted (and Inactive is true) the object is never automatically activated.
 	ActivationTime string `json:"activationTime" bson:"activation-time"`
 
+	// DeliveryDeadline is a timestamp/date by which the object should be delivered to all its destinations.
+	// The sync service doesn't enforce the deadline, objects that are close to missing it can be retrieved for alerting.
+	// The timestamp should be provided in RFC3339 format.
+	// Optional field, if omitted the object has no delivery deadline.
+	DeliveryDeadline string `json:"deliveryDeadline,omitempty" bson:"delivery-deadline,omitempty"`
+
 	// NoData is a flag indicating that there is no data for this object.
 	// Objects with no data can be used, for example, to send notifications.
 	// Optional field, default is false (object includes data).
@@ -358,6 +524,10 @@ type MetaData struct {
 	// This field is used only when working with the CSS. Objects are always deleted after delivery on the ESS.
 	AutoDelete bool `json:"autodelete" bson:"autodelete"`
 
+	// Pinned is a flag indicating that the object is kept permanently: it isn't deleted by AutoDelete or when it expires.
+	// Optional field, default is false. Objects can also be pinned and unpinned after they are stored.
+	Pinned bool `json:"pinned,omitempty" bson:"pinned,omitempty"`
+
 	// OriginID is the ID of origin of the object. Set by the internal code.
 	// Read only field, should not be set by users.
 	OriginID string `json:"originID" bson:"origin-id"`
@@ -406,6 +576,133 @@ type MetaData struct {
 	// OwnerID is an internal field indicating who creates the object
 	// This field should not be set by users
 	OwnerID string `json:"ownerID" bson:"owner-id"`
+
+	// IdempotencyKey is a client supplied key identifying an update of the object.
+	// An update with the same key as an update of the object in the last IdempotencyKeyWindow seconds is
+	// treated as a retry: it is acknowledged without storing the object again or redelivering it.
+	// Optional field, if omitted every update is stored
+	IdempotencyKey string `json:"idempotencyKey,omitempty" bson:"idempotency-key,omitempty"`
+
+	// Attachment is a small opaque binary blob, such as a signature, that is stored and delivered with the meta data.
+	// The attachment can't exceed MaxAttachmentSize bytes.
+	// Optional field, if omitted the object has no attachment.
+	Attachment []byte `json:"attachment,omitempty" bson:"attachment,omitempty"`
+
+	// DataComplete is an internal field indicating that all the data of the object is stored.
+	// It is kept by the storage with the object, and is only set in the meta data returned by RetrieveObjectAndStatus.
+	DataComplete bool `json:"-" bson:"-"`
+}
+
+// MaxAttachmentSize is the maximal size in bytes of the attachment of an object
+const MaxAttachmentSize = 4096
+
+// Validate checks that the meta data can be safely persisted.
+// Returns a ValidationError listing all the problems found, or nil if the meta data is valid.
+func (metaData *MetaData) Validate() SyncServiceError {
+	// The ID separator is escaped in the IDs of stored records, only the destination type and ID can't contain
+	// the separator of the destinations lists
+	problems := validateIDComponents([]idComponent{
+		{"object ID", metaData.ObjectID, false}, {"object type", metaData.ObjectType, false},
+		{"organization ID", metaData.DestOrgID, false}, {"destination type", metaData.DestType, true},
+		{"destination ID", metaData.DestID, true},
+	})
+	if metaData.ObjectID == "" {
+		problems = append(problems, "object ID is empty")
+	}
+	if metaData.ObjectType == "" {
+		problems = append(problems, "object type is empty")
+	}
+	if metaData.Broadcast {
+		if metaData.DestType == "" {
+			problems = append(problems, "destination type of a broadcast object is empty")
+		}
+		if metaData.DestID != "" || len(metaData.DestinationsList) != 0 || metaData.DestinationPolicy != nil {
+			problems = append(problems, "broadcast object has a destination ID, a destinations list, or a destination policy")
+		}
+	}
+	if metaData.ExpectedConsumers < 0 {
+		problems = append(problems, fmt.Sprintf("expected consumers (%d) is negative", metaData.ExpectedConsumers))
+	}
+	if metaData.ActivationTime != "" {
+		if _, err := time.Parse(time.RFC3339, metaData.ActivationTime); err != nil {
+			problems = append(problems, fmt.Sprintf("activation time (%s) is not in RFC3339 format", metaData.ActivationTime))
+		}
+	}
+	if metaData.Expiration != "" {
+		if _, err := time.Parse(time.RFC3339, metaData.Expiration); err != nil {
+			problems = append(problems, fmt.Sprintf("expiration (%s) is not in RFC3339 format", metaData.Expiration))
+		}
+	}
+	if metaData.DeliveryDeadline != "" {
+		if _, err := time.Parse(time.RFC3339, metaData.DeliveryDeadline); err != nil {
+			problems = append(problems, fmt.Sprintf("delivery deadline (%s) is not in RFC3339 format", metaData.DeliveryDeadline))
+		}
+	}
+	if len(metaData.Attachment) > MaxAttachmentSize {
+		problems = append(problems, fmt.Sprintf("attachment size (%d) exceeds the maximum of %d bytes", len(metaData.Attachment), MaxAttachmentSize))
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Normalize trims the white space around the organization, type, and ID of the destination
+func (destination *Destination) Normalize() {
+	destination.DestOrgID = strings.TrimSpace(destination.DestOrgID)
+	destination.DestType = strings.TrimSpace(destination.DestType)
+	destination.DestID = strings.TrimSpace(destination.DestID)
+}
+
+// Validate verifies that the destination can be stored.
+// Destinations whose organization, type, or ID is empty, contains control characters, or is surrounded by white
+// space are rejected, as their records can't be matched by the destination's notifications. Destinations whose
+// type or ID contains ':' are rejected too, as they can't be listed in the "type:id" destinations lists.
+func (destination *Destination) Validate() SyncServiceError {
+	components := []idComponent{
+		{"organization ID", destination.DestOrgID, false}, {"destination type", destination.DestType, true},
+		{"destination ID", destination.DestID, true},
+	}
+	problems := validateIDComponents(components)
+	for _, component := range components {
+		if strings.TrimSpace(component.value) == "" {
+			problems = append(problems, component.name+" is empty")
+		} else if strings.TrimSpace(component.value) != component.value {
+			problems = append(problems, fmt.Sprintf("%s (%q) is surrounded by white space", component.name, component.value))
+		} else if strings.IndexFunc(component.value, unicode.IsControl) != -1 {
+			problems = append(problems, fmt.Sprintf("%s (%q) contains control characters", component.name, component.value))
+		}
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// idComponent is a field that is a component of the IDs of stored records
+type idComponent struct {
+	name               string
+	value              string
+	inDestinationsList bool // The component is also used in the destinations lists of objects
+}
+
+// destinationsListSeparator separates the type and the ID of a destination in the destinations lists of objects
+const destinationsListSeparator = ":"
+
+// validateIDComponents returns the problems of fields that are components of the IDs of stored records
+func validateIDComponents(components []idComponent) []string {
+	problems := make([]string, 0)
+	for _, component := range components {
+		if !utf8.ValidString(component.value) {
+			problems = append(problems, fmt.Sprintf("%s (%q) is not valid UTF-8", component.name, component.value))
+		} else if component.inDestinationsList && strings.Contains(component.value, destinationsListSeparator) {
+			problems = append(problems, fmt.Sprintf("%s (%s) contains the destinations list separator '%s'",
+				component.name, component.value, destinationsListSeparator))
+		}
+	}
+	return problems
 }
 
 // ChunkInfo describes chunks for multi-inflight data transfer.
@@ -426,6 +723,12 @@ type Notification struct {
 	InstanceID int64  `json:"instanceID" bson:"instance-id"`
 	DataID     int64  `json:"dataID" bson:"data-id"`
 	ResendTime int64  `json:"resendTime" bson:"resend-time"`
+
+	// ResendAttempts is the number of times the notification has been resent without being acknowledged
+	ResendAttempts int `json:"resendAttempts" bson:"resend-attempts"`
+
+	// LastUpdate is the time (in seconds since the epoch) the notification was last stored
+	LastUpdate int64 `json:"lastUpdate" bson:"last-update"`
 }
 
 // StoreDestinationStatus is the information about destinations and their status for an object
@@ -434,6 +737,10 @@ type StoreDestinationStatus struct {
 	Destination Destination `bson:"destination"`
 	Status      string      `bson:"status"`
 	Message     string      `bson:"message"`
+	// AttemptCount is the number of attempts to deliver the object to the destination
+	AttemptCount int `bson:"attempt-count"`
+	// LastAttempt is the time of the last delivery attempt in RFC3339 format
+	LastAttempt string `bson:"last-attempt"`
 }
 
 // DestinationsStatus describes the delivery status of an object for a destination
@@ -464,6 +771,14 @@ type DestinationsStatus struct {
 	// Message is the message for the destination
 	//    required: false
 	Message string `json:"message"`
+
+	// AttemptCount is the number of attempts to deliver the object to the destination
+	//    required: false
+	AttemptCount int `json:"attemptCount"`
+
+	// LastAttempt is the time of the last attempt to deliver the object to the destination, in RFC3339 format
+	//    required: false
+	LastAttempt string `json:"lastAttempt,omitempty"`
 }
 
 // ObjectStatus describes the delivery status of an object for a destination
@@ -493,6 +808,20 @@ type ObjectStatus struct {
 	Status string `json:"status"`
 }
 
+// ObjectStatusWithMetaData describes the delivery status of an object for a destination
+// together with the object's meta data
+// swagger:model
+type ObjectStatusWithMetaData struct {
+	// MetaData is the meta data of the object
+	//   required: true
+	MetaData MetaData `json:"metaData"`
+
+	// Status is the object status for this destination
+	//   required: true
+	//   enum: delivering,delivered,consumed,error
+	Status string `json:"status"`
+}
+
 // ObjectDestinationPolicy contains information about an object that has a Destination Policy.
 // swagger:model
 type ObjectDestinationPolicy struct {
@@ -531,6 +860,19 @@ type Organization struct {
 
 	// Address is the broker address to be used when connecting to this organization
 	Address string `json:"address" bson:"address"`
+
+	// Features enables or disables features for this organization, by feature name.
+	// Optional field, a feature that isn't listed has its default behavior
+	Features map[string]bool `json:"features,omitempty" bson:"features,omitempty"`
+}
+
+// FeatureEnabled returns whether the feature is enabled for the organization,
+// or the default value if the organization doesn't set the feature
+func (org *Organization) FeatureEnabled(feature string, defaultValue bool) bool {
+	if enabled, ok := org.Features[feature]; ok {
+		return enabled
+	}
+	return defaultValue
 }
 
 // StoredOrganization contains organization and its update timestamp
@@ -561,6 +903,27 @@ type NotificationInfo struct {
 	MetaData          *MetaData
 }
 
+// AuditRecord is a record in the audit log of the mutations of an object
+// swagger:ignore
+type AuditRecord struct {
+	OrgID      string `json:"orgID" bson:"org-id"`
+	ObjectType string `json:"objectType" bson:"object-type"`
+	ObjectID   string `json:"objectID" bson:"object-id"`
+
+	// Action is the mutation of the object (see the audit actions below)
+	Action string `json:"action" bson:"action"`
+
+	// Status is the status of the object after the mutation, it is empty if the object was deleted
+	Status string `json:"status" bson:"status"`
+
+	// Identity is the identity of the user that requested the mutation, or SyncServiceIdentity
+	Identity  string    `json:"identity" bson:"identity"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+
+	// DataSize is the number of bytes of the object's data served by a read (AuditRead only)
+	DataSize int64 `json:"dataSize,omitempty" bson:"data-size,omitempty"`
+}
+
 // ACLentry contains ACL information about each user
 type ACLentry struct {
 	Username    string
@@ -568,6 +931,89 @@ type ACLentry struct {
 	ACLRole     string
 }
 
+// ACLGroup is a named group of users that can be referenced in ACLs by an entry with the username ACLGroupPrefix + Name
+// swagger:ignore
+type ACLGroup struct {
+	OrgID   string   `json:"orgID" bson:"org-id"`
+	Name    string   `json:"name" bson:"name"`
+	Members []string `json:"members" bson:"members"`
+}
+
+// RetentionPolicy is the retention policy of the objects of a type in an organization. The storage maintenance deletes
+// the objects of the type that weren't updated for MaxAge seconds, and prunes their kept previous versions to MaxVersions.
+// swagger:ignore
+type RetentionPolicy struct {
+	OrgID      string `json:"orgID" bson:"org-id"`
+	ObjectType string `json:"objectType" bson:"object-type"`
+
+	// MaxAge is the number of seconds since the last update of an object after which the object is deleted, 0 means no limit.
+	// Pinned objects and objects received from the other side are not deleted.
+	MaxAge int64 `json:"maxAge" bson:"max-age"`
+
+	// MaxVersions is the number of previous versions kept for the objects of the type.
+	// When not set, the number of versions is taken from the configuration.
+	MaxVersions *int `json:"maxVersions,omitempty" bson:"max-versions,omitempty"`
+}
+
+// WebhookRetryPolicy is the delivery retry policy of the webhooks of an object type in an organization.
+// A notification that fails to be posted to a webhook is retried after Backoff milliseconds, the delay is doubled
+// for each further retry, until Attempts posts failed. When a type doesn't have a policy, the configuration's
+// WebhookRetryAttempts and WebhookRetryBackoff are used.
+// swagger:ignore
+type WebhookRetryPolicy struct {
+	OrgID      string `json:"orgID" bson:"org-id"`
+	ObjectType string `json:"objectType" bson:"object-type"`
+
+	// Attempts is the number of times a notification is posted to a webhook before it is given up, at least 1
+	Attempts int `json:"attempts" bson:"attempts"`
+
+	// Backoff is the time in milliseconds before the first retry
+	Backoff int `json:"backoff" bson:"backoff"`
+}
+
+// WebhookFailure records the last notification that a webhook failed to receive after all the attempts of its
+// retry policy failed. A webhook has at most one failure record, a later failure replaces it.
+// swagger:ignore
+type WebhookFailure struct {
+	OrgID      string `json:"orgID" bson:"org-id"`
+	ObjectType string `json:"objectType" bson:"object-type"`
+	URL        string `json:"url" bson:"url"`
+
+	// ObjectID and InstanceID identify the update of the object whose notification failed
+	ObjectID   string `json:"objectID" bson:"object-id"`
+	InstanceID int64  `json:"instanceID" bson:"instance-id"`
+
+	// Attempts is the number of times the notification was posted
+	Attempts int `json:"attempts" bson:"attempts"`
+
+	// Error is the error of the last attempt
+	Error string `json:"error" bson:"error"`
+
+	// Time is the time of the last attempt in RFC3339 format
+	Time string `json:"time" bson:"time"`
+}
+
+// APIToken is a long-lived API token used to authenticate with the CSS. Only the hash of the token is stored,
+// the token itself is returned to its owner when it is created.
+// swagger:ignore
+type APIToken struct {
+	// Hash is the hex encoded SHA-256 hash of the token
+	Hash string `json:"hash" bson:"hash"`
+
+	// OrgID is the organization of the identity authenticated by the token
+	OrgID string `json:"orgID" bson:"org-id"`
+
+	// Identity is the identity authenticated by the token, e.g., a user ID or destType/destID
+	Identity string `json:"identity" bson:"identity"`
+
+	// Role is the role of the identity, one of admin, user, syncadmin, service, edgenode, or nodeuser
+	Role string `json:"role" bson:"role"`
+
+	// Expiration is the time, in RFC3339 format, after which the token is no longer valid.
+	// An empty expiration means that the token doesn't expire.
+	Expiration string `json:"expiration,omitempty" bson:"expiration,omitempty"`
+}
+
 // Object status
 const (
 	NotReadyToSend     = "notReady"           // The object is not ready to be sent to the other side
@@ -623,6 +1069,28 @@ const (
 	// Deleted (defined above)
 )
 
+// Object mutations recorded in the audit log
+const (
+	AuditStore        = "store"
+	AuditUpdateStatus = "updateStatus"
+	AuditMarkDeleted  = "markDeleted"
+	AuditDelete       = "delete"
+
+	// AuditRead is a read of the object's data, recorded only when Configuration.LogDataAccess is set
+	AuditRead = "read"
+)
+
+// Object events
+const (
+	ObjectEventCreated = "create"
+	ObjectEventUpdated = "update"
+	ObjectEventDeleted = "delete"
+)
+
+// SyncServiceIdentity is the identity recorded in the audit log for mutations that were not requested by a user,
+// for example mutations done by the sync service itself
+const SyncServiceIdentity = "sync-service"
+
 // Feedback codes
 const (
 	InternalErrorCode = 1
@@ -676,6 +1144,20 @@ var ServingAPIs bool
 const (
 	DestinationsACLType = "destinations"
 	ObjectsACLType      = "objects"
+
+	// DestinationObjectTypesACLType is the type of the ACLs of the object types that can be sent to the destinations
+	// of a destination type. The key of the ACL is the destination type and its entries are object types.
+	// Objects of all types can be sent to destination types that don't have such an ACL.
+	DestinationObjectTypesACLType = "destinationObjectTypes"
+)
+
+// Special ACL usernames
+const (
+	// ACLWildcard is the username of an ACL entry that matches every user
+	ACLWildcard = "*"
+
+	// ACLGroupPrefix is the prefix of the username of an ACL entry that matches the members of a group, e.g. "@group:ops"
+	ACLGroupPrefix = "@group:"
 )
 
 // Resend flag options
@@ -685,6 +1167,9 @@ const (
 	ResendUndelivered
 )
 
+// ForceAll is the destination type and ID that resends an object to all its destinations
+const ForceAll = "*"
+
 // Storage providers
 const (
 	Bolt     = "bolt"
@@ -790,22 +1275,108 @@ func GetNotificationID(notification Notification) string {
 		notification.DestID)
 }
 
+// GetNotificationResendInterval returns the interval in seconds until the next resend of a notification
+// that has already been resent the given number of times.
+// The interval starts at ResendInterval*6 and doubles with each attempt, up to MaxNotificationResendInterval.
+func GetNotificationResendInterval(attempts int) int64 {
+	interval := int64(Configuration.ResendInterval * 6)
+	maxInterval := int64(Configuration.MaxNotificationResendInterval)
+	if maxInterval < interval {
+		return interval
+	}
+	for i := 1; i < attempts && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
+// NormalizeACLUsername returns the form of the username that is stored in ACLs and used in ACL comparisons,
+// as specified by the ACLTrimUsernames and ACLCaseInsensitiveUsernames configuration options
+func NormalizeACLUsername(username string) string {
+	if Configuration.ACLTrimUsernames {
+		username = strings.TrimSpace(username)
+	}
+	if Configuration.ACLCaseInsensitiveUsernames {
+		username = strings.ToLower(username)
+	}
+	return username
+}
+
 // CreateNotificationID creates notification ID
 func CreateNotificationID(orgID string, objectType string, objectID string, destType string, destID string) string {
+	return CreateCompositeID(orgID, objectType, objectID, destType, destID)
+}
+
+// idEscape escapes the separator and itself in the components of composite IDs
+const idEscape = '%'
+
+// CompositeIDSeparator returns the separator of the components of composite IDs
+func CompositeIDSeparator() string {
+	if Configuration.ObjectIDSeparator == "" {
+		return ":"
+	}
+	return Configuration.ObjectIDSeparator
+}
+
+// CreateCompositeID creates an ID from the given components, for example the organization, type, and ID of an object.
+// The components are separated by the ObjectIDSeparator. Occurrences of the separator and of '%' in a component are
+// escaped as %XX, so that IDs of different components never collide and can be split by ParseCompositeID.
+func CreateCompositeID(components ...string) string {
+	separator := CompositeIDSeparator()[0]
+	length := len(components)
+	for _, component := range components {
+		length += len(component)
+	}
+
 	var strBuilder strings.Builder
-	strBuilder.Grow(len(orgID) + len(objectType) + len(objectID) + len(destType) + len(destID) + 5)
-	strBuilder.WriteString(orgID)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(objectType)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(objectID)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(destType)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(destID)
+	strBuilder.Grow(length)
+	for i, component := range components {
+		if i > 0 {
+			strBuilder.WriteByte(separator)
+		}
+		for j := 0; j < len(component); j++ {
+			if c := component[j]; c == separator || c == idEscape {
+				fmt.Fprintf(&strBuilder, "%%%02X", c)
+			} else {
+				strBuilder.WriteByte(c)
+			}
+		}
+	}
 	return strBuilder.String()
 }
 
+// ParseCompositeID returns the components of an ID created by CreateCompositeID
+func ParseCompositeID(id string) ([]string, SyncServiceError) {
+	components := strings.Split(id, CompositeIDSeparator())
+	for i, component := range components {
+		if strings.IndexByte(component, idEscape) == -1 {
+			continue
+		}
+		var strBuilder strings.Builder
+		strBuilder.Grow(len(component))
+		for j := 0; j < len(component); j++ {
+			if component[j] != idEscape {
+				strBuilder.WriteByte(component[j])
+				continue
+			}
+			if j+2 >= len(component) {
+				return nil, &InvalidRequest{Message: fmt.Sprintf("Invalid escape sequence in ID %s", id)}
+			}
+			c, err := strconv.ParseUint(component[j+1:j+3], 16, 8)
+			if err != nil {
+				return nil, &InvalidRequest{Message: fmt.Sprintf("Invalid escape sequence in ID %s", id)}
+			}
+			strBuilder.WriteByte(byte(c))
+			j += 2
+		}
+		components[i] = strBuilder.String()
+	}
+	return components, nil
+}
+
 // CreateFeedback extracts feedback parameters from an error
 func CreateFeedback(err SyncServiceError) (code int, retryInterval int32, reason string) {
 	retryInterval = 0
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -13,3 +14,227 @@ func TestIsValidName(t *testing.T) {
 		}
 	}
 }
+
+func TestMetaDataValidate(t *testing.T) {
+	tests := []struct {
+		metaData MetaData
+		problems int
+	}{
+		{MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", DestType: "device", DestID: "dev1",
+			ActivationTime: "2019-01-02T15:04:05Z", Expiration: "2019-01-02T15:04:05+05:30"}, 0},
+		{MetaData{ObjectID: "1:2", ObjectType: "type1", DestOrgID: "myorg"}, 0},
+		{MetaData{ObjectID: "1", ObjectType: "type:1", DestOrgID: "my:org", DestType: "dev:ice"}, 1},
+		{MetaData{ObjectID: "1\xff", ObjectType: "type1", DestOrgID: "myorg"}, 1},
+		{MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", DestType: "device", Broadcast: true}, 0},
+		{MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", Broadcast: true}, 1},
+		{MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", DestType: "device", DestID: "dev1", Broadcast: true}, 1},
+		{MetaData{ObjectType: "type1", ExpectedConsumers: -2}, 2},
+		{MetaData{ObjectID: "1", ObjectType: "type1", ActivationTime: "tomorrow", Expiration: "2019-01-02 15:04:05"}, 2},
+		{MetaData{ObjectID: "1", ObjectType: "type1", Attachment: make([]byte, MaxAttachmentSize)}, 0},
+		{MetaData{ObjectID: "1", ObjectType: "type1", Attachment: make([]byte, MaxAttachmentSize+1)}, 1},
+	}
+
+	for _, test := range tests {
+		err := test.metaData.Validate()
+		if test.problems == 0 {
+			if err != nil {
+				t.Errorf("Valid meta data %+v was determined to be invalid. Error: %s", test.metaData, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Invalid meta data %+v was determined to be valid.", test.metaData)
+		} else if !IsValidationError(err) {
+			t.Errorf("Validate returned an error of the wrong type: %s", err)
+		} else if problems := err.(*ValidationError).Problems; len(problems) != test.problems {
+			t.Errorf("Validate returned %d problems instead of %d: %s", len(problems), test.problems, err)
+		}
+	}
+}
+
+func TestDestinationValidate(t *testing.T) {
+	tests := []struct {
+		destination Destination
+		problems    int
+	}{
+		{Destination{DestOrgID: "myorg", DestType: "device", DestID: "dev1"}, 0},
+		{Destination{DestOrgID: "my:org", DestType: "device", DestID: "dev1"}, 0},
+		{Destination{DestOrgID: "my:org", DestType: "dev:ice", DestID: "dev:1"}, 2},
+		{Destination{DestOrgID: "myorg", DestID: "dev\xff"}, 2},
+		{Destination{DestOrgID: " ", DestType: "device", DestID: "dev1"}, 1},
+		{Destination{DestOrgID: "myorg", DestType: " device", DestID: "dev\n1"}, 2},
+	}
+
+	for _, test := range tests {
+		err := test.destination.Validate()
+		if test.problems == 0 {
+			if err != nil {
+				t.Errorf("Valid destination %+v was determined to be invalid. Error: %s", test.destination, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Invalid destination %+v was determined to be valid.", test.destination)
+		} else if !IsValidationError(err) {
+			t.Errorf("Validate returned an error of the wrong type: %s", err)
+		} else if problems := err.(*ValidationError).Problems; len(problems) != test.problems {
+			t.Errorf("Validate returned %d problems instead of %d: %s", len(problems), test.problems, err)
+		}
+	}
+}
+
+func TestCompositeID(t *testing.T) {
+	defer func() { Configuration.ObjectIDSeparator = ":" }()
+
+	tests := []struct {
+		separator  string
+		components []string
+		id         string
+	}{
+		{":", []string{"myorg", "type1", "1"}, "myorg:type1:1"},
+		{":", []string{"myorg", "type:1", "1"}, "myorg:type%3A1:1"},
+		{":", []string{"myorg", "type", "1:1"}, "myorg:type:1%3A1"},
+		{":", []string{"myorg", "type1", "100%"}, "myorg:type1:100%25"},
+		{":", []string{"myorg", ""}, "myorg:"},
+		{"/", []string{"myorg", "type:1", "a/b"}, "myorg/type:1/a%2Fb"},
+	}
+
+	for _, test := range tests {
+		Configuration.ObjectIDSeparator = test.separator
+		id := CreateCompositeID(test.components...)
+		if id != test.id {
+			t.Errorf("CreateCompositeID(%v) returned %s instead of %s", test.components, id, test.id)
+		}
+		components, err := ParseCompositeID(id)
+		if err != nil {
+			t.Errorf("ParseCompositeID(%s) failed. Error: %s", id, err)
+		} else if strings.Join(components, "|") != strings.Join(test.components, "|") {
+			t.Errorf("ParseCompositeID(%s) returned %v instead of %v", id, components, test.components)
+		}
+	}
+
+	// IDs of components that contain the separator don't collide
+	Configuration.ObjectIDSeparator = ":"
+	if CreateCompositeID("myorg", "a:b", "c") == CreateCompositeID("myorg", "a", "b:c") {
+		t.Errorf("IDs of different components collided")
+	}
+
+	for _, id := range []string{"myorg:type1:1%", "myorg:type1:1%3", "myorg:type1:1%zz"} {
+		if _, err := ParseCompositeID(id); err == nil {
+			t.Errorf("ParseCompositeID(%s) didn't fail on an invalid escape sequence", id)
+		}
+	}
+}
+
+func TestParseMongoIndexes(t *testing.T) {
+	indexes, err := ParseMongoIndexes("syncObjects:metadata.destination-org-id, metadata.object-type; syncObjects:-last-update:sparse,unique;")
+	if err != nil {
+		t.Errorf("Failed to parse valid indexes. Error: %s", err)
+	} else if len(indexes) != 2 {
+		t.Errorf("Parsed %d indexes instead of 2", len(indexes))
+	} else {
+		if indexes[0].Collection != "syncObjects" || len(indexes[0].Keys) != 2 || indexes[0].Keys[1] != "metadata.object-type" ||
+			indexes[0].Unique || indexes[0].Sparse || indexes[0].Background {
+			t.Errorf("The first index was parsed incorrectly: %+v", indexes[0])
+		}
+		if len(indexes[1].Keys) != 1 || indexes[1].Keys[0] != "-last-update" || !indexes[1].Unique || !indexes[1].Sparse ||
+			indexes[1].Background {
+			t.Errorf("The second index was parsed incorrectly: %+v", indexes[1])
+		}
+	}
+
+	invalidSpecs := []string{"syncObjects", ":key", "syncObjects:", "syncObjects:key1,,key2", "syncObjects:key:clustered",
+		"syncObjects:key:sparse:unique"}
+	for _, spec := range invalidSpecs {
+		if _, err := ParseMongoIndexes(spec); err == nil {
+			t.Errorf("Invalid index specification %s was parsed successfully", spec)
+		}
+	}
+}
+
+func TestMaxObjectSizeForType(t *testing.T) {
+	savedMaxObjectSize := Configuration.MaxObjectSize
+	savedMaxObjectSizeByType := Configuration.MaxObjectSizeByType
+	defer func() {
+		Configuration.MaxObjectSize = savedMaxObjectSize
+		Configuration.MaxObjectSizeByType = savedMaxObjectSizeByType
+	}()
+
+	Configuration.MaxObjectSize = 100
+	Configuration.MaxObjectSizeByType = "model:1000; config:0;"
+	tests := []struct {
+		objectType string
+		size       int64
+	}{{"model", 1000}, {"config", 0}, {"other", 100}}
+	for _, test := range tests {
+		if size := MaxObjectSizeForType(test.objectType); size != test.size {
+			t.Errorf("The maximum object size of type %s is %d instead of %d", test.objectType, size, test.size)
+		}
+	}
+
+	invalidSpecs := []string{"model", ":100", "model:", "model:-1", "model:big"}
+	for _, spec := range invalidSpecs {
+		if _, err := ParseMaxObjectSizes(spec); err == nil {
+			t.Errorf("Invalid maximum object size specification %s was parsed successfully", spec)
+		}
+	}
+}
+
+func TestIsPublicObjectType(t *testing.T) {
+	savedPublicObjectTypes := Configuration.PublicObjectTypes
+	defer func() {
+		Configuration.PublicObjectTypes = savedPublicObjectTypes
+	}()
+
+	Configuration.PublicObjectTypes = ""
+	if IsPublicObjectType("myorg", "firmware") {
+		t.Errorf("Object type firmware is public with an empty allowlist")
+	}
+
+	Configuration.PublicObjectTypes = "myorg/firmware; myorg/config;"
+	tests := []struct {
+		orgID      string
+		objectType string
+		public     bool
+	}{{"myorg", "firmware", true}, {"myorg", "config", true}, {"myorg", "model", false}, {"otherorg", "firmware", false}}
+	for _, test := range tests {
+		if public := IsPublicObjectType(test.orgID, test.objectType); public != test.public {
+			t.Errorf("Object type %s/%s is public %t instead of %t", test.orgID, test.objectType, public, test.public)
+		}
+	}
+
+	invalidSpecs := []string{"firmware", "/firmware", "myorg/", "myorg/type/extra", "*/firmware"}
+	for _, spec := range invalidSpecs {
+		if _, err := ParsePublicObjectTypes(spec); err == nil {
+			t.Errorf("Invalid public object type specification %s was parsed successfully", spec)
+		}
+	}
+}
+
+func TestGetNotificationResendInterval(t *testing.T) {
+	savedResendInterval := Configuration.ResendInterval
+	savedMaxInterval := Configuration.MaxNotificationResendInterval
+	defer func() {
+		Configuration.ResendInterval = savedResendInterval
+		Configuration.MaxNotificationResendInterval = savedMaxInterval
+	}()
+
+	Configuration.ResendInterval = 5
+	Configuration.MaxNotificationResendInterval = 200
+	tests := []struct {
+		attempts int
+		interval int64
+	}{
+		{0, 30}, {1, 30}, {2, 60}, {3, 120}, {4, 200}, {20, 200},
+	}
+	for _, test := range tests {
+		if interval := GetNotificationResendInterval(test.attempts); interval != test.interval {
+			t.Errorf("Resend interval for %d attempts is %d instead of %d", test.attempts, interval, test.interval)
+		}
+	}
+
+	Configuration.MaxNotificationResendInterval = 10
+	if interval := GetNotificationResendInterval(5); interval != 30 {
+		t.Errorf("Resend interval with a maximum below ResendInterval*6 is %d instead of 30", interval)
+	}
+}
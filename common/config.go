@@ -107,9 +107,21 @@ type Config struct {
 	// LeadershipTimeout is the timeout for leadership updates in seconds
 	LeadershipTimeout int32 `env:"LEADERSHIP_TIMEOUT"`
 
+	// Region is the region in which this CSS runs, used for leader election affinity
+	// The default is empty (not set)
+	Region string `env:"REGION"`
+
+	// PreferredLeaderRegion is the region whose CSS nodes are preferred as the leader.
+	// A node in the preferred region takes over the leadership from a leader outside of it, even while the leader is alive:
+	// the leader is asked to hand off the leadership and resigns on its next heartbeat.
+	// The default is empty (not set) meaning that there is no preferred region.
+	PreferredLeaderRegion string `env:"PREFERRED_LEADER_REGION"`
+
 	// AuthenticationHandler indicates which Authentication handler should be used.
 	// The current possible values are:
 	//     dummy - for the dummyAuthenticate Authentication handler
+	//     preset - for the presetAuthenticate Authentication handler
+	//     token - for the tokenAuthenticate Authentication handler, that uses API tokens stored in the storage
 	AuthenticationHandler string `env:"AUTHENTICATION_HANDLER"`
 
 	// CommunicationProtocol is a comma separated list of protocols to be used for communication between CSS and ESS
@@ -232,6 +244,10 @@ type Config struct {
 	// Other notifications are resent with frequency equal to ResendInterval*6
 	ResendInterval int16 `env:"RESEND_INTERVAL"`
 
+	// MaxNotificationResendInterval specifies the maximal interval in seconds between resends of an unacknowledged notification
+	// The resend interval starts at ResendInterval*6 and doubles with each unacknowledged resend, up to this value
+	MaxNotificationResendInterval int `env:"MAX_NOTIFICATION_RESEND_INTERVAL"`
+
 	// ESSPingInterval specifies the frequency in hours of ping messages that ESS sends to CSS
 	ESSPingInterval int16 `env:"ESS_PING_INTERVAL"`
 
@@ -256,6 +272,12 @@ type Config struct {
 	// MongoDbName specifies the name of the database to use
 	MongoDbName string `env:"MONGO_DB_NAME"`
 
+	// MongoDataDbName specifies the name of the database in which the data of objects is stored in GridFS,
+	// so that the I/O of large data doesn't contend with the queries of the meta data in MongoDbName.
+	// The database is in the same MongoDB deployment as MongoDbName.
+	// An empty value means that the data is stored in MongoDbName
+	MongoDataDbName string `env:"MONGO_DATA_DB_NAME"`
+
 	// MongoUsername specifies the username of the mongo database
 	MongoUsername string `env:"MONGO_USERNAME"`
 
@@ -271,6 +293,19 @@ type Config struct {
 	// PersistenceRootPath configuration property if it doesn't start with a slash (/).
 	MongoCACertificate string `env:"MONGO_CA_CERTIFICATE"`
 
+	// MongoClientCertificate specifies the client certificate to present to the MongoDB server, for mutual TLS
+	// and x509 authentication. When it is set, the MONGODB-X509 mechanism is used instead of the username and password.
+	// This value can either be the certificate itself or the path of a file containing the certificate.
+	// If it is a path of a file, then it is relative to the PersistenceRootPath configuration property
+	// if it doesn't start with a slash (/).
+	MongoClientCertificate string `env:"MONGO_CLIENT_CERTIFICATE"`
+
+	// MongoClientKey specifies the key of the client certificate (see MongoClientCertificate).
+	// This value can either be the key itself or the path of a file containing the key.
+	// If it is a path of a file, then it is relative to the PersistenceRootPath configuration property
+	// if it doesn't start with a slash (/).
+	MongoClientKey string `env:"MONGO_CLIENT_KEY"`
+
 	// MongoAllowInvalidCertificates specifies that the mongo driver will not attempt to validate the server certificates.
 	// Please only set this for development purposes! It makes using TLS pointless and is never the right answer.
 	MongoAllowInvalidCertificates bool `env:"MONGO_ALLOW_INVALID_CERTIFICATES"`
@@ -278,13 +313,93 @@ type Config struct {
 	// MongoSessionCacheSize specifies the number of MongoDB session copies to use
 	MongoSessionCacheSize int `env:"MONGO_SESSION_CACHE_SIZE"`
 
+	// MongoSessionCacheMaxSize specifies the maximal number of MongoDB session copies to use.
+	// When all the cached sessions are busy, the session cache grows up to this size, and the added
+	// sessions are closed after being idle for MongoSessionCacheIdleTime seconds.
+	// A value less than MongoSessionCacheSize means the session cache doesn't grow.
+	MongoSessionCacheMaxSize int `env:"MONGO_SESSION_CACHE_MAX_SIZE"`
+
+	// MongoSessionCacheIdleTime specifies the time in seconds after which an idle session that was
+	// added to the session cache under load is closed
+	MongoSessionCacheIdleTime int `env:"MONGO_SESSION_CACHE_IDLE_TIME"`
+
+	// MongoReadTimeout specifies the timeout in seconds of interactive MongoDB reads, such as retrieving
+	// objects, destinations and notifications. The database aborts reads that exceed it.
+	// The default value is 60
+	MongoReadTimeout int `env:"MONGO_READ_TIMEOUT"`
+
+	// MongoWriteTimeout specifies the timeout in seconds of MongoDB writes of individual records
+	// The default value is 60
+	MongoWriteTimeout int `env:"MONGO_WRITE_TIMEOUT"`
+
+	// MongoBulkTimeout specifies the timeout in seconds of MongoDB operations on many records, such as
+	// aggregations, exports of organizations, and deletes and updates of all the records of an organization
+	// The default value is 600
+	MongoBulkTimeout int `env:"MONGO_BULK_TIMEOUT"`
+
+	// MongoGridFSPrefix specifies the prefix of the GridFS collections in which the data of objects is stored.
+	// Sync service instances that share a MongoDB database can isolate the data of their objects by using different prefixes.
+	MongoGridFSPrefix string `env:"MONGO_GRIDFS_PREFIX"`
+
+	// MongoMaxOpenDataFiles specifies the maximal number of GridFS data files that are open for reading at the same time.
+	// Once it is reached, reads of data wait up to MongoOpenDataFileTimeout seconds for a file to be closed.
+	// 0 means that the number of open data files is not limited
+	MongoMaxOpenDataFiles int `env:"MONGO_MAX_OPEN_DATA_FILES"`
+
+	// MongoOpenDataFileTimeout specifies the time in seconds a read of data waits for a data file to be closed
+	// when MongoMaxOpenDataFiles files are open, before it fails
+	// The default value is 30
+	MongoOpenDataFileTimeout int `env:"MONGO_OPEN_DATA_FILE_TIMEOUT"`
+
+	// MongoCollectionCompressor specifies the WiredTiger block compressor of the objects and notifications collections.
+	// The collections are created with this compressor on startup if they don't exist yet, existing collections are not modified.
+	// Valid values are: none, snappy, zlib, and zstd. An empty value means the collections are created with the cluster's default.
+	MongoCollectionCompressor string `env:"MONGO_COLLECTION_COMPRESSOR"`
+
+	// MongoExtraIndexes specifies additional indexes to create in the MongoDB collections on startup,
+	// after the built-in indexes. The indexes are separated by semicolons, each index is specified as
+	// collection:key1,key2[:option1,option2], where a key prefixed with '-' is in descending order,
+	// and the supported options are unique, sparse, and background.
+	// For example: syncObjects:metadata.destination-org-id,metadata.object-type;syncObjects:-last-update:sparse
+	MongoExtraIndexes string `env:"MONGO_EXTRA_INDEXES"`
+
+	// MongoReadOnly specifies that the MongoDB storage starts in read-only mode, in which all the writes
+	// (of objects, destinations, notifications, webhooks, ACLs and organizations) are rejected while reads continue to work
+	MongoReadOnly bool `env:"MONGO_READ_ONLY"`
+
+	// RequireIndexes specifies that the startup of the MongoDB storage fails if any of its indexes
+	// can't be created. When false, the failures are logged and the service starts without the indexes.
+	RequireIndexes bool `env:"REQUIRE_INDEXES"`
+
+	// MongoBackgroundIndexBuilds specifies that the built-in and additional indexes of the MongoDB storage are built
+	// in the background, so that creating an index on a large collection doesn't block writes to it.
+	// The startup of the storage doesn't wait for the builds, and their failures are logged but ignored by RequireIndexes.
+	MongoBackgroundIndexBuilds bool `env:"MONGO_BACKGROUND_INDEX_BUILDS"`
+
 	// DatabaseConnectTimeout specifies that the timeout in seconds of database connection attempts on startup
 	// The default value is 300
 	DatabaseConnectTimeout int `env:"DATABASE_CONNECT_TIMEOUT"`
 
+	// StartWithoutDatabase specifies that the MongoDB storage starts disconnected if it fails to connect to the
+	// database within DatabaseConnectTimeout, and keeps trying to connect in the background, instead of failing the startup
+	StartWithoutDatabase bool `env:"START_WITHOUT_DATABASE"`
+
+	// DatabaseLatencyProbeInterval specifies the frequency in seconds of the database latency probes (CSS only).
+	// 0 means that the database latency is not probed.
+	DatabaseLatencyProbeInterval int `env:"DATABASE_LATENCY_PROBE_INTERVAL"`
+
+	// DatabaseLatencyThreshold specifies the database latency in milliseconds above which the health status of
+	// the database is reported as degraded (yellow). 0 means that the database latency doesn't affect the health status.
+	DatabaseLatencyThreshold int `env:"DATABASE_LATENCY_THRESHOLD"`
+
 	// StorageMaintenanceInterval specifies the frequency in seconds of storage checks (for expired objects, etc.)
 	StorageMaintenanceInterval int16 `env:"STORAGE_MAINTENANCE_INTERVAL"`
 
+	// AuditLogMaxAge specifies the age in hours after which records of the audit log of object mutations
+	// are purged by the storage maintenance.
+	// 0 means that the audit records are kept until their organization is deleted.
+	AuditLogMaxAge int `env:"AUDIT_LOG_MAX_AGE"`
+
 	// ObjectActivationInterval specifies the frequency in seconds of checking if there are inactive objects
 	// that are ready to be activated
 	ObjectActivationInterval int16 `env:"OBJECT_ACTIVATION_INTERVAL"`
@@ -294,6 +409,15 @@ type Config struct {
 	// For the ESS the options are 'inmemory' (the default), and 'bolt'
 	StorageProvider string `env:"STORAGE_PROVIDER"`
 
+	// LogDataAccess specifies that reads of objects' data on behalf of users and nodes are recorded in the audit log
+	// with the identity of the reader and the number of bytes served. The records add a write to every data read.
+	LogDataAccess bool `env:"LOG_DATA_ACCESS"`
+
+	// ObjectIDSeparator specifies the character that separates the components of the IDs of stored records, for example
+	// the organization, type, and ID of an object. Occurrences of the separator in a component are escaped.
+	// Changing the separator of an existing database makes its records inaccessible.
+	ObjectIDSeparator string `env:"OBJECT_ID_SEPARATOR"`
+
 	// ESSConsumedObjectsKept specifies the number of objects sent by the ESS and consumed by the CSS
 	// that are kept by the ESS for reporting
 	// The default value is 1000
@@ -302,6 +426,123 @@ type Config struct {
 	// MessagingGroupCacheExpiration specifies the expiration time in minutes of organization to messaging group mapping cache
 	MessagingGroupCacheExpiration int16 `env:"MESSAGING_GROUP_CACHE_EXPIRATION"`
 
+	// ACLTrimUsernames specifies that leading and trailing white space is removed from the usernames in ACLs
+	ACLTrimUsernames bool `env:"ACL_TRIM_USERNAMES"`
+
+	// ACLCaseInsensitiveUsernames specifies that the usernames in ACLs are stored and compared in lowercase
+	ACLCaseInsensitiveUsernames bool `env:"ACL_CASE_INSENSITIVE_USERNAMES"`
+
+	// PublicObjectTypes is an allowlist of object types whose objects (meta data and data) can be read without
+	// credentials. The object types are separated by semicolons, each object type is specified as orgID/objectType.
+	// For example: myorg/firmware;myorg/public-config
+	// Writes, and reads of all other object types, still require authentication.
+	PublicObjectTypes string `env:"PUBLIC_OBJECT_TYPES"`
+
+	// AuthFailureThreshold specifies the number of consecutive failed authentications of an identity, or from an IP
+	// address, after which authentication attempts of the identity or from the address are rejected for AuthLockoutDuration.
+	// 0 means that failed authentications are not limited.
+	// The address is the remote address of the request, so behind a proxy or a load balancer the failures of all the
+	// clients are counted together and can lock out all of them. Anyone who knows an identity (the app key) can also
+	// lock it out by repeatedly failing to authenticate as it.
+	AuthFailureThreshold int `env:"AUTH_FAILURE_THRESHOLD"`
+
+	// AuthLockoutDuration specifies the time in seconds during which the authentication attempts of an identity,
+	// or from an IP address, are rejected after AuthFailureThreshold consecutive failures
+	AuthLockoutDuration int `env:"AUTH_LOCKOUT_DURATION"`
+
+	// AuthFailureTrackingLimit specifies the maximum number of identities and IP addresses whose failed authentications
+	// are tracked. When the limit is reached, the identities and addresses that failed the longest time ago are forgotten.
+	AuthFailureTrackingLimit int `env:"AUTH_FAILURE_TRACKING_LIMIT"`
+
+	// MaxObjectSize specifies the maximum size in bytes of an object's data, larger data is rejected when it is stored.
+	// 0 means that the size of the objects' data is not limited.
+	MaxObjectSize int64 `env:"MAX_OBJECT_SIZE"`
+
+	// MaxObjectSizeByType overrides MaxObjectSize for specific object types. The limits are separated by semicolons,
+	// each limit is specified as objectType:size, where a size of 0 means that the objects of the type are not limited.
+	// For example: model:1073741824;config:65536
+	MaxObjectSizeByType string `env:"MAX_OBJECT_SIZE_BY_TYPE"`
+
+	// ObjectVersionsKept specifies the number of previous versions of an object that are kept when the object is updated,
+	// for rollback. 0 means that previous versions of objects are not kept.
+	ObjectVersionsKept int `env:"OBJECT_VERSIONS_KEPT"`
+
+	// ObjectVersionsKeptByType overrides ObjectVersionsKept for specific object types. The counts are separated by semicolons,
+	// each count is specified as objectType:count. For example: model:5;config:0
+	ObjectVersionsKeptByType string `env:"OBJECT_VERSIONS_KEPT_BY_TYPE"`
+
+	// MaxDeliveriesPerDestination specifies the maximum number of objects that are marked as being delivered to a destination
+	// when the destination's objects are retrieved (e.g. when it registers or asks to resend its objects). The rest of the
+	// objects are left pending, and are delivered when the destination's objects are retrieved again.
+	// 0 means that the number of objects delivered at once to a destination is not limited.
+	MaxDeliveriesPerDestination int `env:"MAX_DELIVERIES_PER_DESTINATION"`
+
+	// SourceDataURIRoot specifies a directory under which the CSS accepts objects whose data is referenced by a source data URI.
+	// The data of such objects isn't stored in the database, it is read from the URI whenever it is needed.
+	// The default is empty (not set) meaning that source data URIs are rejected by the CSS.
+	SourceDataURIRoot string `env:"SOURCE_DATA_URI_ROOT"`
+
+	// HTTPDataURITimeout specifies the timeout in seconds of connecting to and receiving the response headers
+	// from the server of an http(s) data URI.
+	HTTPDataURITimeout int `env:"HTTP_DATA_URI_TIMEOUT"`
+
+	// HTTPDataURIMaxRedirects specifies the maximal number of redirects followed when reading an http(s) data URI.
+	// 0 means that redirects are not followed.
+	HTTPDataURIMaxRedirects int `env:"HTTP_DATA_URI_MAX_REDIRECTS"`
+
+	// DataURIDeduplication specifies that data stored in file data URIs is deduplicated by its content.
+	// The data is stored in a file named by the hash of its content, in the .blobs subdirectory of the data URI's
+	// directory, and the data URI is a hard link to that file. Identical data stored at different data URIs shares
+	// one file, which is removed when the data of the last data URI that references it is deleted.
+	DataURIDeduplication bool `env:"DATA_URI_DEDUPLICATION"`
+
+	// DataURIFsync specifies that data written to file data URIs is flushed to the disk before the write completes.
+	// The file is synced before it is renamed to its final name and its directory is synced after the rename,
+	// so that the data survives a power loss. Syncing reduces the write throughput.
+	DataURIFsync bool `env:"DATA_URI_FSYNC"`
+
+	// DataURISharding specifies that the data files of objects stored by the bolt storage are spread over nested
+	// sub-directories named by the hash of the file name, instead of one directory. Existing files are moved to
+	// the sub-directories when the storage starts. DataURISharding is ignored when ObjectsDataPath is set.
+	DataURISharding bool `env:"DATA_URI_SHARDING"`
+
+	// DataURIReadAheadSize specifies the number of bytes read ahead when the chunks of a file data URI are read sequentially.
+	// The file is kept open between the reads of its chunks and the following chunks are returned from memory.
+	// 0 means that the file is opened and read for each chunk.
+	DataURIReadAheadSize int `env:"DATA_URI_READ_AHEAD_SIZE"`
+
+	// DataURITempDirectory specifies a directory in which the data of file data URIs is written before it is
+	// moved to the file of the data URI. If the directory is on a different file system than the file of the
+	// data URI, the data is copied instead of being moved.
+	// The default is empty (not set) meaning that the data is written next to the file of the data URI.
+	DataURITempDirectory string `env:"DATA_URI_TEMP_DIRECTORY"`
+
+	// IdempotencyKeyWindow specifies the time in seconds during which the idempotency key of an object update is remembered.
+	// An update of the object with the same idempotency key within the window is treated as a retry and is not redelivered.
+	// 0 means that idempotency keys are ignored.
+	IdempotencyKeyWindow int `env:"IDEMPOTENCY_KEY_WINDOW"`
+
+	// CompletedNotificationsMaxAge specifies the age in hours after which notifications in a completed state
+	// (consumed or deleted) are purged by the storage maintenance.
+	// 0 means that completed notifications are not purged.
+	CompletedNotificationsMaxAge int `env:"COMPLETED_NOTIFICATIONS_MAX_AGE"`
+
+	// SlowStorageOperationThreshold specifies the time in milliseconds after which a storage operation is considered slow.
+	// Slow operations are logged as warnings, together with their collection and query fingerprint.
+	// 0 means that slow storage operations are not logged.
+	SlowStorageOperationThreshold int `env:"SLOW_STORAGE_OPERATION_THRESHOLD"`
+
+	// WebhookTimeout specifies the time in seconds after which posting a notification to a webhook is failed
+	WebhookTimeout int `env:"WEBHOOK_TIMEOUT"`
+
+	// WebhookRetryAttempts specifies the number of times a notification is posted to a webhook before it is given up,
+	// for object types that don't have a webhook retry policy
+	WebhookRetryAttempts int `env:"WEBHOOK_RETRY_ATTEMPTS"`
+
+	// WebhookRetryBackoff specifies the time in milliseconds before a failed notification is posted again to a webhook,
+	// for object types that don't have a webhook retry policy. The time is doubled for each further retry.
+	WebhookRetryBackoff int `env:"WEBHOOK_RETRY_BACKOFF"`
+
 	// ShutdownQuiesceTime specifies the maximum time in seconds that the Sync Service will wait for internal tasks to end while shuting down
 	// The default values is 60 seconds
 	ShutdownQuiesceTime int `env:"SHUTDOWN_QUIESCE_TIME"`
@@ -328,6 +569,158 @@ func (e *configError) Error() string {
 	return e.message
 }
 
+// MongoIndex describes an additional index to create in a MongoDB collection
+type MongoIndex struct {
+	Collection string
+	Keys       []string
+	Unique     bool
+	Sparse     bool
+	Background bool
+}
+
+// ParseMongoIndexes parses the specification of additional MongoDB indexes (see MongoExtraIndexes)
+func ParseMongoIndexes(spec string) ([]MongoIndex, error) {
+	indexes := make([]MongoIndex, 0)
+	for _, indexSpec := range strings.Split(spec, ";") {
+		indexSpec = strings.TrimSpace(indexSpec)
+		if indexSpec == "" {
+			continue
+		}
+		parts := strings.Split(indexSpec, ":")
+		if len(parts) < 2 || len(parts) > 3 || strings.TrimSpace(parts[0]) == "" {
+			return nil, &configError{fmt.Sprintf("Invalid index specification (%s), please specify collection:key1,key2[:option1,option2]", indexSpec)}
+		}
+		index := MongoIndex{Collection: strings.TrimSpace(parts[0]), Keys: make([]string, 0)}
+		for _, key := range strings.Split(parts[1], ",") {
+			key = strings.TrimSpace(key)
+			if key == "" || key == "-" {
+				return nil, &configError{fmt.Sprintf("Invalid index specification (%s), empty key", indexSpec)}
+			}
+			index.Keys = append(index.Keys, key)
+		}
+		if len(parts) == 3 {
+			for _, option := range strings.Split(parts[2], ",") {
+				switch strings.ToLower(strings.TrimSpace(option)) {
+				case "unique":
+					index.Unique = true
+				case "sparse":
+					index.Sparse = true
+				case "background":
+					index.Background = true
+				default:
+					return nil, &configError{fmt.Sprintf("Invalid index option (%s), please specify any of: 'unique', 'sparse', 'background'", option)}
+				}
+			}
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// ParseMaxObjectSizes parses the per object type maximum object sizes (see MaxObjectSizeByType)
+func ParseMaxObjectSizes(spec string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	for _, sizeSpec := range strings.Split(spec, ";") {
+		sizeSpec = strings.TrimSpace(sizeSpec)
+		if sizeSpec == "" {
+			continue
+		}
+		index := strings.LastIndex(sizeSpec, ":")
+		if index <= 0 {
+			return nil, &configError{fmt.Sprintf("Invalid maximum object size specification (%s), please specify objectType:size", sizeSpec)}
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeSpec[index+1:]), 10, 64)
+		if err != nil || size < 0 {
+			return nil, &configError{fmt.Sprintf("Invalid maximum object size specification (%s), the size must be a non-negative number", sizeSpec)}
+		}
+		sizes[strings.TrimSpace(sizeSpec[:index])] = size
+	}
+	return sizes, nil
+}
+
+// MaxObjectSizeForType returns the maximum size of the data of objects of the given type, 0 means no limit
+func MaxObjectSizeForType(objectType string) int64 {
+	if Configuration.MaxObjectSizeByType != "" {
+		if sizes, err := ParseMaxObjectSizes(Configuration.MaxObjectSizeByType); err == nil {
+			if size, ok := sizes[objectType]; ok {
+				return size
+			}
+		}
+	}
+	return Configuration.MaxObjectSize
+}
+
+// ParsePublicObjectTypes parses the allowlist of object types that can be read without credentials (see PublicObjectTypes)
+func ParsePublicObjectTypes(spec string) (map[string]bool, error) {
+	objectTypes := make(map[string]bool)
+	for _, typeSpec := range strings.Split(spec, ";") {
+		typeSpec = strings.TrimSpace(typeSpec)
+		if typeSpec == "" {
+			continue
+		}
+		// Wildcards are not supported, every public object type must be listed explicitly
+		parts := strings.Split(typeSpec, "/")
+		if len(parts) != 2 || !IsValidName(parts[0]) || !IsValidName(parts[1]) || strings.Contains(typeSpec, "*") {
+			return nil, &configError{fmt.Sprintf("Invalid public object type specification (%s), please specify orgID/objectType", typeSpec)}
+		}
+		objectTypes[typeSpec] = true
+	}
+	return objectTypes, nil
+}
+
+// IsPublicObjectType returns true if objects of the given type in the given organization can be read without credentials
+func IsPublicObjectType(orgID string, objectType string) bool {
+	if Configuration.PublicObjectTypes == "" {
+		return false
+	}
+	objectTypes, err := ParsePublicObjectTypes(Configuration.PublicObjectTypes)
+	if err != nil {
+		return false
+	}
+	return objectTypes[orgID+"/"+objectType]
+}
+
+// ParseObjectVersionsKept parses the per object type number of kept object versions (see ObjectVersionsKeptByType)
+func ParseObjectVersionsKept(spec string) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, countSpec := range strings.Split(spec, ";") {
+		countSpec = strings.TrimSpace(countSpec)
+		if countSpec == "" {
+			continue
+		}
+		index := strings.LastIndex(countSpec, ":")
+		if index <= 0 {
+			return nil, &configError{fmt.Sprintf("Invalid object versions specification (%s), please specify objectType:count", countSpec)}
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(countSpec[index+1:]))
+		if err != nil || count < 0 {
+			return nil, &configError{fmt.Sprintf("Invalid object versions specification (%s), the count must be a non-negative number", countSpec)}
+		}
+		counts[strings.TrimSpace(countSpec[:index])] = count
+	}
+	return counts, nil
+}
+
+// ObjectVersionsKeptForType returns the number of previous versions kept for objects of the given type, 0 means none
+func ObjectVersionsKeptForType(objectType string) int {
+	if Configuration.ObjectVersionsKeptByType != "" {
+		if counts, err := ParseObjectVersionsKept(Configuration.ObjectVersionsKeptByType); err == nil {
+			if count, ok := counts[objectType]; ok {
+				return count
+			}
+		}
+	}
+	return Configuration.ObjectVersionsKept
+}
+
+// LeaderPriority returns the priority of this node in the leader election, higher is preferred
+func LeaderPriority() int32 {
+	if Configuration.PreferredLeaderRegion != "" && Configuration.Region == Configuration.PreferredLeaderRegion {
+		return 1
+	}
+	return 0
+}
+
 // Load loads the configuration from the specified properties file
 func Load(configFileName string) error {
 	props, err := properties.ReadPropertiesFile(configFileName, true)
@@ -618,6 +1011,9 @@ func ValidateConfig() error {
 	if Configuration.MaxInflightChunks < 1 {
 		Configuration.MaxInflightChunks = 1
 	}
+	if Configuration.AuditLogMaxAge < 0 {
+		return &configError{"Invalid AuditLogMaxAge, it must be a non-negative number"}
+	}
 	if Configuration.MaxInflightChunks > 64 && Configuration.NodeType == CSS {
 		Configuration.MaxInflightChunks = 64
 	}
@@ -636,6 +1032,132 @@ func ValidateConfig() error {
 			return &configError{"Invalid StorageProvider, for ESS please specify any off: 'inmemory', 'bolt', or leave as empty string"}
 		}
 	}
+	if Configuration.StorageProvider == Mongo && Configuration.MongoExtraIndexes != "" {
+		if _, err := ParseMongoIndexes(Configuration.MongoExtraIndexes); err != nil {
+			return err
+		}
+	}
+	if (Configuration.MongoClientCertificate == "") != (Configuration.MongoClientKey == "") {
+		return &configError{"Invalid Mongo client certificate, both MongoClientCertificate and MongoClientKey must be provided"}
+	}
+	if Configuration.MongoClientCertificate != "" && !Configuration.MongoUseSSL {
+		return &configError{"Invalid MongoClientCertificate, it can only be set when MongoUseSSL is true"}
+	}
+	if Configuration.MaxObjectSize < 0 {
+		return &configError{"Invalid MaxObjectSize, it must be a non-negative number"}
+	}
+	if Configuration.MaxObjectSizeByType != "" {
+		if _, err := ParseMaxObjectSizes(Configuration.MaxObjectSizeByType); err != nil {
+			return err
+		}
+	}
+	if Configuration.PublicObjectTypes != "" {
+		if _, err := ParsePublicObjectTypes(Configuration.PublicObjectTypes); err != nil {
+			return err
+		}
+	}
+	if Configuration.AuthFailureThreshold < 0 {
+		return &configError{"Invalid AuthFailureThreshold, it must be a non-negative number"}
+	}
+	if Configuration.AuthFailureThreshold > 0 {
+		if Configuration.AuthLockoutDuration <= 0 {
+			return &configError{"Invalid AuthLockoutDuration, it must be a positive number"}
+		}
+		if Configuration.AuthFailureTrackingLimit <= 0 {
+			return &configError{"Invalid AuthFailureTrackingLimit, it must be a positive number"}
+		}
+	}
+	if Configuration.DatabaseLatencyProbeInterval < 0 {
+		return &configError{"Invalid DatabaseLatencyProbeInterval, it must be a non-negative number"}
+	}
+	if Configuration.DatabaseLatencyThreshold < 0 {
+		return &configError{"Invalid DatabaseLatencyThreshold, it must be a non-negative number"}
+	}
+	if Configuration.ObjectVersionsKept < 0 {
+		return &configError{"Invalid ObjectVersionsKept, it must be a non-negative number"}
+	}
+	if Configuration.ObjectVersionsKeptByType != "" {
+		if _, err := ParseObjectVersionsKept(Configuration.ObjectVersionsKeptByType); err != nil {
+			return err
+		}
+	}
+	if Configuration.MaxDeliveriesPerDestination < 0 {
+		return &configError{"Invalid MaxDeliveriesPerDestination, it must be a non-negative number"}
+	}
+	if Configuration.HTTPDataURITimeout <= 0 {
+		return &configError{"Invalid HTTPDataURITimeout, it must be a positive number"}
+	}
+	if Configuration.HTTPDataURIMaxRedirects < 0 {
+		return &configError{"Invalid HTTPDataURIMaxRedirects, it must be a non-negative number"}
+	}
+	if Configuration.DataURIReadAheadSize < 0 {
+		return &configError{"Invalid DataURIReadAheadSize, it must be a non-negative number"}
+	}
+	if Configuration.IdempotencyKeyWindow < 0 {
+		return &configError{"Invalid IdempotencyKeyWindow, it must be a non-negative number"}
+	}
+	if Configuration.CompletedNotificationsMaxAge < 0 {
+		return &configError{"Invalid CompletedNotificationsMaxAge, it must be a non-negative number"}
+	}
+	if Configuration.MongoSessionCacheMaxSize < 0 {
+		return &configError{"Invalid MongoSessionCacheMaxSize, it must be a non-negative number"}
+	}
+	if Configuration.MongoSessionCacheIdleTime < 0 {
+		return &configError{"Invalid MongoSessionCacheIdleTime, it must be a non-negative number"}
+	}
+	if Configuration.MongoReadTimeout <= 0 {
+		return &configError{"Invalid MongoReadTimeout, it must be a positive number"}
+	}
+	if Configuration.MongoWriteTimeout <= 0 {
+		return &configError{"Invalid MongoWriteTimeout, it must be a positive number"}
+	}
+	if Configuration.MongoBulkTimeout <= 0 {
+		return &configError{"Invalid MongoBulkTimeout, it must be a positive number"}
+	}
+	if Configuration.MongoGridFSPrefix == "" || strings.ContainsAny(Configuration.MongoGridFSPrefix, "$\x00") {
+		return &configError{"Invalid MongoGridFSPrefix, it must be a valid non-empty collection name prefix"}
+	}
+	if Configuration.MongoMaxOpenDataFiles < 0 {
+		return &configError{"Invalid MongoMaxOpenDataFiles, it must be a non-negative number"}
+	}
+	if Configuration.MongoOpenDataFileTimeout < 0 {
+		return &configError{"Invalid MongoOpenDataFileTimeout, it must be a non-negative number"}
+	}
+	switch Configuration.MongoCollectionCompressor {
+	case "", "none", "snappy", "zlib", "zstd":
+	default:
+		return &configError{"Invalid MongoCollectionCompressor, it must be one of: none, snappy, zlib, zstd, or empty"}
+	}
+	if len(Configuration.ObjectIDSeparator) != 1 || Configuration.ObjectIDSeparator[0] < '!' ||
+		Configuration.ObjectIDSeparator[0] > '~' || Configuration.ObjectIDSeparator[0] == idEscape {
+		return &configError{"Invalid ObjectIDSeparator, it must be a single printable ASCII character other than '%'"}
+	}
+	if Configuration.SlowStorageOperationThreshold < 0 {
+		return &configError{"Invalid SlowStorageOperationThreshold, it must be a non-negative number"}
+	}
+	if Configuration.WebhookTimeout <= 0 {
+		return &configError{"Invalid WebhookTimeout, it must be a positive number"}
+	}
+	if Configuration.WebhookRetryAttempts <= 0 {
+		return &configError{"Invalid WebhookRetryAttempts, it must be a positive number"}
+	}
+	if Configuration.WebhookRetryBackoff < 0 {
+		return &configError{"Invalid WebhookRetryBackoff, it must be a non-negative number"}
+	}
+	if len(Configuration.SourceDataURIRoot) > 0 {
+		if path, err := filepath.Abs(Configuration.SourceDataURIRoot); err == nil {
+			Configuration.SourceDataURIRoot = path + "/"
+		} else {
+			return &configError{fmt.Sprintf("Invalid SourceDataURIRoot (%s): failed to convert to absolute path, err= %s", Configuration.SourceDataURIRoot, err)}
+		}
+	}
+	if len(Configuration.DataURITempDirectory) > 0 {
+		if path, err := filepath.Abs(Configuration.DataURITempDirectory); err == nil {
+			Configuration.DataURITempDirectory = path
+		} else {
+			return &configError{fmt.Sprintf("Invalid DataURITempDirectory (%s): failed to convert to absolute path, err= %s", Configuration.DataURITempDirectory, err)}
+		}
+	}
 	if len(Configuration.ObjectsDataPath) > 0 {
 		if Configuration.StorageProvider == Bolt {
 			if path, err := filepath.Abs(Configuration.ObjectsDataPath); err == nil {
@@ -682,27 +1204,73 @@ func SetDefaultConfig(config *Config) {
 	config.LogTraceDestination = "file"
 	config.LogTraceMaintenanceInterval = 60
 	config.ResendInterval = 5
+	config.MaxNotificationResendInterval = 600
 	config.ESSPingInterval = 1
 	config.RemoveESSRegistrationTime = 30
 	config.MaxDataChunkSize = 120 * 1024
 	config.MaxInflightChunks = 1
 	config.MongoAddressCsv = "localhost:27017"
 	config.MongoDbName = "d_edge"
+	config.MongoDataDbName = ""
 	config.MongoAuthDbName = "admin"
 	config.MongoUsername = ""
 	config.MongoPassword = ""
 	config.MongoUseSSL = false
 	config.MongoCACertificate = ""
 	config.MongoAllowInvalidCertificates = false
+	config.MongoClientCertificate = ""
+	config.MongoClientKey = ""
 	config.MongoSessionCacheSize = 1
+	config.MongoSessionCacheMaxSize = 0
+	config.MongoSessionCacheIdleTime = 60
+	config.MongoReadTimeout = 60
+	config.MongoWriteTimeout = 60
+	config.MongoBulkTimeout = 600
+	config.MongoGridFSPrefix = "fs"
+	config.MongoMaxOpenDataFiles = 0
+	config.MongoOpenDataFileTimeout = 30
+	config.MongoCollectionCompressor = ""
+	config.MongoReadOnly = false
+	config.RequireIndexes = false
+	config.MongoBackgroundIndexBuilds = false
 	config.DatabaseConnectTimeout = 300
+	config.StartWithoutDatabase = false
+	config.DatabaseLatencyProbeInterval = 30
+	config.DatabaseLatencyThreshold = 1000
 	config.StorageMaintenanceInterval = 30
+	config.AuditLogMaxAge = 0
 	config.ObjectActivationInterval = 30
+	config.LogDataAccess = false
+	config.ObjectIDSeparator = ":"
 	config.CommunicationProtocol = MQTTProtocol
 	config.HTTPPollingInterval = 10
 	config.HTTPCSSUseSSL = false
 	config.HTTPCSSCACertificate = ""
 	config.MessagingGroupCacheExpiration = 60
+	config.ACLTrimUsernames = false
+	config.ACLCaseInsensitiveUsernames = false
+	config.PublicObjectTypes = ""
+	config.AuthFailureThreshold = 0
+	config.AuthLockoutDuration = 300
+	config.AuthFailureTrackingLimit = 10000
+	config.MaxObjectSize = 0
+	config.MaxObjectSizeByType = ""
+	config.ObjectVersionsKept = 0
+	config.ObjectVersionsKeptByType = ""
+	config.MaxDeliveriesPerDestination = 0
+	config.HTTPDataURITimeout = 60
+	config.HTTPDataURIMaxRedirects = 5
+	config.DataURIDeduplication = false
+	config.DataURIFsync = false
+	config.DataURISharding = false
+	config.DataURIReadAheadSize = 0
+	config.DataURITempDirectory = ""
+	config.IdempotencyKeyWindow = 300
+	config.CompletedNotificationsMaxAge = 0
+	config.SlowStorageOperationThreshold = 0
+	config.WebhookTimeout = 10
+	config.WebhookRetryAttempts = 3
+	config.WebhookRetryBackoff = 1000
 	config.ShutdownQuiesceTime = 60
 	config.ESSConsumedObjectsKept = 1000
 }
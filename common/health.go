@@ -31,7 +31,15 @@ type DBHealthStatusInfo struct {
 	DBReadFailures               uint32 `json:"dbReadFailures"`
 	DBWriteFailures              uint32 `json:"dbWriteFailures"`
 	lastReadWriteErrorTime       time.Time
-	TimeSinceLastReadWriteError  uint64 `json:"timeSinceLastReadWriteError,omitempty"`
+	TimeSinceLastReadWriteError  uint64            `json:"timeSinceLastReadWriteError,omitempty"`
+	UpdateRetries                map[string]uint64 `json:"updateRetries,omitempty"`
+	UpdateRetriesExhausted       map[string]uint64 `json:"updateRetriesExhausted,omitempty"`
+	DBLatency                    uint64            `json:"dbLatency,omitempty"`
+	dbLatencyAverage             float64
+	LastDBProbeError             string `json:"lastDBProbeError,omitempty"`
+	SessionCacheSize             int    `json:"sessionCacheSize,omitempty"`
+	SessionCacheHits             uint64 `json:"sessionCacheHits,omitempty"`
+	SessionCacheMisses           uint64 `json:"sessionCacheMisses,omitempty"`
 }
 
 // MQTTHealthStatusInfo describes the health status of the MQTT connection of the sync-service node
@@ -178,6 +186,72 @@ func (hs *HealthStatusInfo) DBWriteFailed() {
 	DBHealth.lastReadWriteErrorTime = time.Now()
 }
 
+// DBUpdateRetried increments the update retries counter of the operation
+func (hs *HealthStatusInfo) DBUpdateRetried(operation string) {
+	hs.lock()
+	defer hs.unLock()
+	DBHealth.UpdateRetries = incrementCounter(DBHealth.UpdateRetries, operation)
+}
+
+// DBUpdateRetriesExhausted increments the exhausted update retries counter of the operation
+func (hs *HealthStatusInfo) DBUpdateRetriesExhausted(operation string) {
+	hs.lock()
+	defer hs.unLock()
+	DBHealth.UpdateRetriesExhausted = incrementCounter(DBHealth.UpdateRetriesExhausted, operation)
+}
+
+// incrementCounter returns a copy of the counters with the counter of the operation incremented.
+// The map is copied since the health report is marshalled without holding the health status lock.
+func incrementCounter(counters map[string]uint64, operation string) map[string]uint64 {
+	result := make(map[string]uint64, len(counters)+1)
+	for key, value := range counters {
+		result[key] = value
+	}
+	result[operation]++
+	return result
+}
+
+// dbLatencyWeight is the weight of a new latency probe in the rolling database latency
+const dbLatencyWeight = 0.2
+
+// DBLatencyProbed updates the rolling database latency (in milliseconds) with the result of a latency probe.
+// If the probe failed, its error is kept in LastDBProbeError until the next successful probe.
+func (hs *HealthStatusInfo) DBLatencyProbed(latency time.Duration, err error) {
+	hs.lock()
+	defer hs.unLock()
+	if err != nil {
+		DBHealth.LastDBProbeError = err.Error()
+		return
+	}
+	DBHealth.LastDBProbeError = ""
+
+	milliseconds := float64(latency) / float64(time.Millisecond)
+	if DBHealth.dbLatencyAverage == 0 {
+		DBHealth.dbLatencyAverage = milliseconds
+	} else {
+		DBHealth.dbLatencyAverage = dbLatencyWeight*milliseconds + (1-dbLatencyWeight)*DBHealth.dbLatencyAverage
+	}
+	DBHealth.DBLatency = uint64(DBHealth.dbLatencyAverage + 0.5)
+}
+
+// SessionCacheUsed increments the database session cache hits or misses counter
+func (hs *HealthStatusInfo) SessionCacheUsed(hit bool) {
+	hs.lock()
+	defer hs.unLock()
+	if hit {
+		DBHealth.SessionCacheHits++
+	} else {
+		DBHealth.SessionCacheMisses++
+	}
+}
+
+// SessionCacheResized updates the current size of the database session cache
+func (hs *HealthStatusInfo) SessionCacheResized(size int) {
+	hs.lock()
+	defer hs.unLock()
+	DBHealth.SessionCacheSize = size
+}
+
 // ClientRequestReceived increments the client requests counter
 func (hs *HealthStatusInfo) ClientRequestReceived() {
 	hs.lock()
@@ -209,6 +283,11 @@ func (hs *HealthStatusInfo) UpdateHealthInfo(details bool, registeredESS uint32,
 		}
 	}
 
+	if DBHealth.DBStatus == Green && (DBHealth.LastDBProbeError != "" ||
+		(Configuration.DatabaseLatencyThreshold > 0 && DBHealth.DBLatency >= uint64(Configuration.DatabaseLatencyThreshold))) {
+		DBHealth.DBStatus = Yellow
+	}
+
 	MQTTHealth.MQTTConnectionStatus = Green
 	if Configuration.CommunicationProtocol != HTTPProtocol {
 		timeSinceLastSubError := uint64(0)
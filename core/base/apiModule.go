@@ -9,7 +9,7 @@ import (
 	"io"
 	"math"
 	"net/url"
-	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -31,7 +31,8 @@ func init() {
 }
 
 // UpdateObject invoked when an app sends an updated object
-func UpdateObject(orgID string, objectType string, objectID string, metaData common.MetaData, data []byte) common.SyncServiceError {
+// identity is the identity of the user that sent the object, it is recorded in the audit log
+func UpdateObject(identity string, orgID string, objectType string, objectID string, metaData common.MetaData, data []byte) common.SyncServiceError {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In UpdateObject. Update %s %s %s\n", orgID, objectType, objectID)
 	}
@@ -184,7 +185,7 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 	}
 
 	if metaData.SourceDataURI != "" {
-		if common.Configuration.NodeType == common.CSS {
+		if common.Configuration.NodeType == common.CSS && common.Configuration.SourceDataURIRoot == "" {
 			return &common.InvalidRequest{Message: "Data URI is disabled on CSS"}
 		}
 		if data != nil {
@@ -195,10 +196,14 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 		if err != nil || !strings.EqualFold(uri.Scheme, "file") || uri.Host != "" {
 			return &common.InvalidRequest{Message: "Invalid source data URI"}
 		}
-		if fi, err := os.Stat(uri.Path); err == nil {
-			metaData.ObjectSize = fi.Size()
+		if common.Configuration.NodeType == common.CSS &&
+			!strings.HasPrefix(filepath.Clean(uri.Path), common.Configuration.SourceDataURIRoot) {
+			return &common.InvalidRequest{Message: "Source data URI is outside of the SourceDataURIRoot directory"}
+		}
+		if size, exists, _, err := dataURI.Stat(metaData.SourceDataURI); err == nil && exists {
+			metaData.ObjectSize = size
 		} else {
-			log.Error(" Invalid source data URI: %s, failed to get file information for the file, err= %v\n", metaData.SourceDataURI, err)
+			log.Error(" Invalid source data URI: %s, failed to get file information for the file, exists= %t, err= %v\n", metaData.SourceDataURI, exists, err)
 			return &common.InvalidRequest{Message: "Invalid source data URI"}
 		}
 	}
@@ -233,7 +238,7 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 	if data != nil || metaData.Link != "" || metaData.NoData || metaData.SourceDataURI != "" {
 		status = common.ReadyToSend
 	} else if metaData.MetaOnly {
-		reader, err := store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		reader, err := store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "")
 		if err != nil {
 			return err
 		}
@@ -247,6 +252,21 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 	apiObjectLocks.Lock(lockIndex)
 	defer apiObjectLocks.Unlock(lockIndex)
 
+	if metaData.IdempotencyKey != "" {
+		recorded, err := store.IsIdempotencyKeyRecorded(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.IdempotencyKey)
+		if err != nil {
+			return err
+		}
+		if recorded {
+			// A retry of an update that was already stored, don't store and deliver the object again
+			if trace.IsLogging(logger.DEBUG) {
+				trace.Debug("In UpdateObject. Ignoring a retry of %s %s %s with idempotency key %s\n", metaData.DestOrgID,
+					metaData.ObjectType, metaData.ObjectID, metaData.IdempotencyKey)
+			}
+			return nil
+		}
+	}
+
 	common.ObjectLocks.Lock(lockIndex)
 
 	if metaData.NoData {
@@ -271,12 +291,20 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 	}
 	metaData.ChunkSize = common.Configuration.MaxDataChunkSize
 
-	deletedDestinations, err := store.StoreObject(metaData, data, status)
+	deletedDestinations, err := store.StoreObject(metaData, data, status, identity)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return err
 	}
 
+	if metaData.IdempotencyKey != "" {
+		if err := store.RecordIdempotencyKey(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.IdempotencyKey); err != nil &&
+			log.IsLogging(logger.ERROR) {
+			log.Error("Failed to record the idempotency key of %s %s %s. Error: %s\n", metaData.DestOrgID,
+				metaData.ObjectType, metaData.ObjectID, err.Error())
+		}
+	}
+
 	store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "", "")
 
 	if status == common.NotReadyToSend || metaData.Inactive {
@@ -332,6 +360,36 @@ func GetObjectStatus(orgID string, objectType string, objectID string) (string,
 	return store.RetrieveObjectStatus(orgID, objectType, objectID)
 }
 
+// GetObjectStatusCounts returns the number of objects of the organization in each status
+// If objectType is empty, the objects of all types are counted
+func GetObjectStatusCounts(orgID string, objectType string) (map[string]int, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In GetObjectStatusCounts. Count objects of %s %s\n", orgID, objectType)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	return store.RetrieveObjectStatusCounts(orgID, objectType)
+}
+
+// GetStorageStatsByType returns the number of objects of the organization, the total declared size of their data,
+// and the total number of bytes used to store their data, per object type
+func GetStorageStatsByType(orgID string) (map[string]common.ObjectTypeStorageStats, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In GetStorageStatsByType. Get the storage stats of %s\n", orgID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	return store.RetrieveStorageStatsByType(orgID)
+}
+
 // ListUpdatedObjects provides a list of edge updated objects
 // Call the storage module to get the list of edge updated objects and send it to the app
 func ListUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError) {
@@ -416,6 +474,23 @@ func ListObjectsWithFilters(orgID string, destinationPolicy *bool, dpServiceOrgI
 	return objects, err
 }
 
+// ListObjectsAcrossOrgs provides a page of the objects of all the organizations that match the filter,
+// and the total number of matching objects
+func ListObjectsAcrossOrgs(filter common.ObjectFilter, offset int, limit int) ([]common.MetaData, int, common.SyncServiceError) {
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	common.HealthStatus.ClientRequestReceived()
+
+	objects, total, err := store.RetrieveObjectsAcrossOrgs(filter, offset, limit)
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ListObjectsAcrossOrgs. Returned %d of %d objects\n", len(objects), total)
+	}
+
+	return objects, total, err
+}
+
 // ListAllObjects provides a list of all objects with the specified type
 func ListAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
 	apiLock.RLock()
@@ -450,7 +525,8 @@ func GetObject(orgID string, objectType string, objectID string) (*common.MetaDa
 
 // GetObjectData delivers object data to the app
 // Call the storage module to get the object's data and send it to the app
-func GetObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
+// The read is recorded in the audit log on behalf of the identity if Configuration.LogDataAccess is set
+func GetObjectData(identity string, orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In GetObjectData. Get data %s %s\n", objectType, objectID)
 	}
@@ -474,7 +550,7 @@ func GetObjectData(orgID string, objectType string, objectID string) (io.Reader,
 	if metaData.SourceDataURI != "" && status == common.ReadyToSend {
 		return dataURI.GetData(metaData.SourceDataURI)
 	}
-	return store.RetrieveObjectData(orgID, objectType, objectID)
+	return store.RetrieveObjectData(orgID, objectType, objectID, identity)
 }
 
 // GetRemovedDestinationPolicyServicesFromESS get the removedDestinationPolicyServices list
@@ -587,7 +663,7 @@ func PutObjectData(orgID string, objectType string, objectID string, dataReader
 // ObjectConsumed is used when an app indicates that it consumed the object
 // Send "consumed" notification to the object's origin
 // Call the storage module to mark the object as consumed
-func ObjectConsumed(orgID string, objectType string, objectID string) common.SyncServiceError {
+func ObjectConsumed(identity string, orgID string, objectType string, objectID string) common.SyncServiceError {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In ObjectConsumed. Consumed %s %s\n", objectType, objectID)
 	}
@@ -631,7 +707,7 @@ func ObjectConsumed(orgID string, objectType string, objectID string) common.Syn
 		}
 		common.ObjectLocks.Unlock(lockIndex)
 	} else if c == 0 {
-		if err := store.UpdateObjectStatus(orgID, objectType, objectID, common.ObjConsumed); err != nil {
+		if err := store.UpdateObjectStatus(orgID, objectType, objectID, common.ObjConsumed, identity); err != nil {
 			common.ObjectLocks.Unlock(lockIndex)
 			return err
 		}
@@ -673,7 +749,7 @@ func ObjectPolicyReceived(orgID string, objectType string, objectID string) comm
 
 // ObjectReceived is called when an app indicates that it received the object
 // Call the storage module to mark the object as received
-func ObjectReceived(orgID string, objectType string, objectID string) common.SyncServiceError {
+func ObjectReceived(identity string, orgID string, objectType string, objectID string) common.SyncServiceError {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In ObjectReceived. Received %s %s\n", objectType, objectID)
 	}
@@ -717,7 +793,7 @@ func ObjectReceived(orgID string, objectType string, objectID string) common.Syn
 			log.Error("Error in objectReceived: failed to decrement receivers count. Error: %s\n", err)
 		}
 	} else if c == 0 {
-		err = store.UpdateObjectStatus(orgID, objectType, objectID, common.ObjReceived)
+		err = store.UpdateObjectStatus(orgID, objectType, objectID, common.ObjReceived, identity)
 	}
 
 	common.ObjectLocks.Unlock(lockIndex)
@@ -879,7 +955,7 @@ func ObjectDeleted(userID string, orgID string, objectType string, objectID stri
 
 // DeleteObject deletes an object from storage
 // Call the storage module to delete the object and return the response
-func DeleteObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+func DeleteObject(identity string, orgID string, objectType string, objectID string) common.SyncServiceError {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In DeleteObject. Delete %s %s\n", objectType, objectID)
 	}
@@ -909,7 +985,7 @@ func DeleteObject(orgID string, objectType string, objectID string) common.SyncS
 			return &common.InvalidRequest{Message: "Can't delete object on the receiving side for ESS"}
 		}
 		// CSS removes them without notifying the other side
-		err = storage.DeleteStoredObject(store, *metaData)
+		err = storage.DeleteStoredObject(store, *metaData, identity)
 		common.ObjectLocks.Unlock(lockIndex)
 		return err
 	}
@@ -919,7 +995,7 @@ func DeleteObject(orgID string, objectType string, objectID string) common.SyncS
 		return err
 	}
 
-	if err := store.MarkObjectDeleted(orgID, objectType, objectID); err != nil {
+	if err := store.MarkObjectDeleted(orgID, objectType, objectID, identity); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return err
 	}
@@ -980,6 +1056,74 @@ func ActivateObject(orgID string, objectType string, objectID string) common.Syn
 	return nil
 }
 
+// ResendObjectToDestination resends the object to the destination even if the destination already received or consumed it,
+// for example when the destination lost the object's data. The delivery status of the destination is reset to delivering
+// and its update notification is recreated, the other destinations of the object are not affected.
+// When destType and destID are common.ForceAll, the object is resent to all its destinations.
+func ResendObjectToDestination(orgID string, objectType string, objectID string, destType string, destID string) common.SyncServiceError {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ResendObjectToDestination. Resend %s %s to %s %s\n", objectType, objectID, destType, destID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return &common.InvalidRequest{Message: "ESS doesn't support resending objects to destinations"}
+	}
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.Lock(lockIndex)
+	defer apiObjectLocks.Unlock(lockIndex)
+
+	common.ObjectLocks.Lock(lockIndex)
+
+	metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+	if err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return err
+	}
+	if metaData == nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &common.InvalidRequest{Message: "Object not found"}
+	}
+	if status != common.ReadyToSend || metaData.Inactive {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &common.InvalidRequest{Message: "Can't resend an object that isn't ready to be sent"}
+	}
+
+	dests, err := store.GetObjectDestinationsList(orgID, objectType, objectID)
+	if err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return err
+	}
+	forceAll := destType == common.ForceAll && destID == common.ForceAll
+	resendDests := make([]common.StoreDestinationStatus, 0)
+	for _, dest := range dests {
+		if forceAll || (dest.Destination.DestType == destType && dest.Destination.DestID == destID) {
+			resendDests = append(resendDests, dest)
+		}
+	}
+	if len(resendDests) == 0 {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &common.InvalidRequest{Message: "The object isn't sent to the destination"}
+	}
+
+	for _, dest := range resendDests {
+		if _, err := store.UpdateObjectDeliveryStatus(common.Delivering, "", orgID, objectType, objectID,
+			dest.Destination.DestType, dest.Destination.DestID); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return err
+		}
+	}
+
+	notificationsInfo, err := communications.PrepareNotificationsForDestinations(*metaData, resendDests, common.Update)
+	common.ObjectLocks.Unlock(lockIndex)
+	if err != nil {
+		return err
+	}
+	return communications.SendNotifications(notificationsInfo)
+}
+
 // ListDestinations lists all destinations
 func ListDestinations(orgID string) ([]common.Destination, common.SyncServiceError) {
 	if trace.IsLogging(logger.DEBUG) {
@@ -994,6 +1138,41 @@ func ListDestinations(orgID string) ([]common.Destination, common.SyncServiceErr
 	return store.RetrieveDestinations(orgID, "")
 }
 
+// ListOfflineDestinations lists the destinations of an organization that haven't connected for the provided duration
+func ListOfflineDestinations(orgID string, idleFor time.Duration) ([]common.Destination, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ListOfflineDestinations.\n")
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	return store.RetrieveOfflineDestinations(orgID, idleFor)
+}
+
+// DecommissionDestination removes a retired destination from all the objects, and deletes its notifications and record
+func DecommissionDestination(orgID string, destType string, destID string) (*common.DecommissionedDestination, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In DecommissionDestination. Destination: %s:%s\n", destType, destID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType == common.ESS {
+		return nil, &common.InvalidRequest{Message: "ESS can't decommission destinations"}
+	}
+	if destType == "" || destID == "" {
+		return nil, &common.InvalidRequest{Message: "Destination type and ID must be provided"}
+	}
+
+	apiLock.Lock()
+	defer apiLock.Unlock()
+
+	return store.DecommissionDestination(orgID, destType, destID)
+}
+
 // ResendObjects asks the other side to resend all the relevant objects
 func ResendObjects() common.SyncServiceError {
 	if trace.IsLogging(logger.DEBUG) {
@@ -1065,6 +1244,12 @@ func updateOrganization(orgID string, org common.Organization) common.SyncServic
 		return &common.InvalidRequest{Message: fmt.Sprintf("Org ID (%s) contains invalid characters", org.OrgID)}
 	}
 
+	for feature := range org.Features {
+		if !common.IsValidName(feature) || strings.ContainsAny(feature, ".$") {
+			return &common.InvalidRequest{Message: fmt.Sprintf("Feature name (%s) contains invalid characters", feature)}
+		}
+	}
+
 	apiLock.Lock()
 	defer apiLock.Unlock()
 
@@ -1076,6 +1261,23 @@ func updateOrganization(orgID string, org common.Organization) common.SyncServic
 	return communications.Comm.UpdateOrganization(org, timestamp)
 }
 
+// OrganizationFeatureEnabled returns whether the feature is enabled for the organization,
+// or the default value if the organization doesn't set the feature or isn't stored
+func OrganizationFeatureEnabled(orgID string, feature string, defaultValue bool) (bool, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS || common.SingleOrgCSS {
+		return defaultValue, nil
+	}
+
+	storedOrg, err := store.RetrieveOrganizationInfo(orgID)
+	if err != nil {
+		return defaultValue, err
+	}
+	if storedOrg == nil {
+		return defaultValue, nil
+	}
+	return storedOrg.Org.FeatureEnabled(feature, defaultValue), nil
+}
+
 func getOrganizations() ([]common.Organization, common.SyncServiceError) {
 	common.HealthStatus.ClientRequestReceived()
 
@@ -1128,7 +1330,7 @@ func GetObjectDestinationsStatus(orgID string, objectType string, objectID strin
 	result := make([]common.DestinationsStatus, 0)
 	for _, d := range dests {
 		result = append(result, common.DestinationsStatus{DestType: d.Destination.DestType, DestID: d.Destination.DestID,
-			Status: d.Status, Message: d.Message})
+			Status: d.Status, Message: d.Message, AttemptCount: d.AttemptCount, LastAttempt: d.LastAttempt})
 	}
 	return result, nil
 }
@@ -1146,6 +1348,24 @@ func GetObjectsForDestination(orgID string, destType string, destID string) ([]c
 	return store.GetObjectsForDestination(orgID, destType, destID)
 }
 
+// GetObjectsForDestinationWithMetaData gets the meta data and status of objects that are in use on a given node.
+// If status is not empty, only objects with the given status are returned.
+func GetObjectsForDestinationWithMetaData(orgID string, destType string, destID string, status string) ([]common.ObjectStatusWithMetaData, common.SyncServiceError) {
+	common.HealthStatus.ClientRequestReceived()
+
+	if status != "" && status != common.Delivering && status != common.Delivered && status != common.Consumed && status != common.Error {
+		return nil, &common.InvalidRequest{Message: "Invalid object status: " + status}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	if common.Configuration.NodeType != common.CSS {
+		return nil, nil
+	}
+	return store.RetrieveObjectsForDestination(orgID, destType, destID, status)
+}
+
 // UpdateObjectDestinations updates object's destinations
 func UpdateObjectDestinations(orgID string, objectType string, objectID string, destinationsList []string) common.SyncServiceError {
 	common.HealthStatus.ClientRequestReceived()
@@ -1252,6 +1472,16 @@ func RemoveUsersFromACL(aclType string, orgID string, key string, users []common
 	return store.RemoveUsersFromACL(aclType, orgID, key, users)
 }
 
+// SetACL replaces the users of an ACL with the provided users in a single update.
+// Note: Setting an empty list of users deletes the ACL.
+func SetACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	common.HealthStatus.ClientRequestReceived()
+
+	apiLock.Lock()
+	defer apiLock.Unlock()
+	return store.SetACL(aclType, orgID, key, users)
+}
+
 // RetrieveACL retrieves the list of users in the specified ACL
 func RetrieveACL(aclType string, orgID string, key string, aclUserType string) ([]common.ACLentry, common.SyncServiceError) {
 	common.HealthStatus.ClientRequestReceived()
@@ -278,7 +278,7 @@ func testObjectAPI(store storage.Storage, t *testing.T) {
 	defer store.Stop()
 
 	for _, row := range invalidObjects {
-		err := UpdateObject(row.orgID, row.objectType, row.objectID, row.metaData, nil)
+		err := UpdateObject("", row.orgID, row.objectType, row.objectID, row.metaData, nil)
 		if err == nil && row.message != "" {
 			t.Errorf(row.message)
 		}
@@ -363,7 +363,7 @@ func testObjectAPI(store storage.Storage, t *testing.T) {
 
 	for _, row := range validObjects {
 		// Update object
-		err := UpdateObject(row.orgID, row.objectType, row.objectID, row.metaData, row.data)
+		err := UpdateObject("", row.orgID, row.objectType, row.objectID, row.metaData, row.data)
 		if err != nil {
 			t.Errorf("updateObject failed to update (objectID = %s). Error: %s", row.objectID, err.Error())
 		}
@@ -394,7 +394,7 @@ func testObjectAPI(store storage.Storage, t *testing.T) {
 		}
 
 		// Get data
-		dataReader, err := store.RetrieveObjectData(row.orgID, row.objectType, row.objectID)
+		dataReader, err := store.RetrieveObjectData(row.orgID, row.objectType, row.objectID, "")
 		if err != nil {
 			t.Errorf("An error occurred in data fetch (objectID = %s). Error: %s", row.objectID, err.Error())
 		}
@@ -503,7 +503,7 @@ func testObjectAPI(store storage.Storage, t *testing.T) {
 
 		// Get data
 		if !metaData.MetaOnly {
-			storedDataReader, err := GetObjectData(row.orgID, row.objectType, row.objectID)
+			storedDataReader, err := GetObjectData("", row.orgID, row.objectType, row.objectID)
 			if err != nil {
 				if storage.IsNotFound(err) {
 					if row.data != nil && !row.metaData.NoData {
@@ -598,7 +598,7 @@ func testObjectAPI(store storage.Storage, t *testing.T) {
 		}
 
 		// Mark consumed (should fail)
-		if err := ObjectConsumed(row.orgID, row.objectType, row.objectID); err == nil {
+		if err := ObjectConsumed("", row.orgID, row.objectType, row.objectID); err == nil {
 			t.Errorf("objectConsumed marked the sender's object as consumed  (objectID = %s)", row.objectID)
 		}
 
@@ -692,7 +692,7 @@ func testESSObjectDeletedAPI(store storage.Storage, t *testing.T) {
 
 	for _, row := range validObjects {
 		// Update object
-		err := UpdateObject(row.orgID, row.objectType, row.objectID, row.metaData, row.data)
+		err := UpdateObject("", row.orgID, row.objectType, row.objectID, row.metaData, row.data)
 		if err != nil {
 			t.Errorf("updateObject failed to update (objectID = %s). Error: %s", row.objectID, err.Error())
 		}
@@ -801,7 +801,7 @@ func testObjectDestinationsAPI(store storage.Storage, t *testing.T) {
 
 	for _, test := range tests {
 		// Update object
-		err := UpdateObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, test.metaData, nil)
+		err := UpdateObject("", test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, test.metaData, nil)
 		if err != nil {
 			t.Errorf("UpdateObject failed to update (objectID = %s). Error: %s", test.metaData.ObjectID, err.Error())
 		}
@@ -1011,13 +1011,13 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 
 	for _, test := range tests {
 		// Delete the object first
-		err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID)
+		err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, "")
 		if err != nil {
 			t.Errorf("Failed to delete object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			fmt.Printf("Error: %#v\n", err)
 		}
 		// Insert
-		if err := UpdateObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
+		if err := UpdateObject("", test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
 			test.metaData, test.data); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
@@ -1076,7 +1076,7 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 
 				policyTimestamp := storedMetaData.DestinationPolicy.Timestamp
 
-				if err := UpdateObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
+				if err := UpdateObject("", test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
 					test.metaData, test.data); err != nil {
 					t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 				}
@@ -1138,7 +1138,7 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 
 	for _, test := range tests {
 		if test.recieved {
-			if err := UpdateObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
+			if err := UpdateObject("", test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
 				test.metaData, test.data); err != nil {
 				t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			}
@@ -1165,3 +1165,86 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 			len(policyInfo), 1)
 	}
 }
+
+func TestResendObjectToDestinationAPI(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	setupDB(common.Mongo)
+	testResendObjectToDestinationAPI(store, t)
+
+	setupDB(common.Bolt)
+	testResendObjectToDestinationAPI(store, t)
+}
+
+func testResendObjectToDestinationAPI(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	orgID := "resendorg"
+	destinations := []common.Destination{
+		{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol},
+		{DestOrgID: orgID, DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol},
+	}
+	for _, destination := range destinations {
+		if err := store.StoreDestination(destination); err != nil {
+			t.Errorf("Failed to store destination. Error: %s", err.Error())
+		}
+	}
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start MQTT communication. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestType: "device", NoData: true}
+	if err := UpdateObject("", orgID, metaData.ObjectType, metaData.ObjectID, metaData, nil); err != nil {
+		t.Errorf("UpdateObject failed. Error: %s", err.Error())
+	}
+	for _, destination := range destinations {
+		if _, err := store.UpdateObjectDeliveryStatus(common.Consumed, "", orgID, metaData.ObjectType, metaData.ObjectID,
+			destination.DestType, destination.DestID); err != nil {
+			t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s", err.Error())
+		}
+	}
+
+	statuses := func() map[string]string {
+		dests, err := GetObjectDestinationsStatus(orgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil {
+			t.Errorf("GetObjectDestinationsStatus failed. Error: %s", err.Error())
+		}
+		result := make(map[string]string)
+		for _, dest := range dests {
+			result[dest.DestID] = dest.Status
+		}
+		return result
+	}
+
+	if err := ResendObjectToDestination(orgID, metaData.ObjectType, metaData.ObjectID, "device", "dev3"); err == nil {
+		t.Errorf("ResendObjectToDestination didn't fail for a destination the object isn't sent to")
+	}
+
+	if err := ResendObjectToDestination(orgID, metaData.ObjectType, metaData.ObjectID, "device", "dev1"); err != nil {
+		t.Errorf("ResendObjectToDestination failed. Error: %s", err.Error())
+	}
+	if result := statuses(); result["dev1"] != common.Delivering || result["dev2"] != common.Consumed {
+		t.Errorf("ResendObjectToDestination set wrong destination statuses: %v", result)
+	}
+	if notification, err := store.RetrieveNotificationRecord(orgID, metaData.ObjectType, metaData.ObjectID, "device", "dev1"); err != nil {
+		t.Errorf("Failed to retrieve the notification. Error: %s", err.Error())
+	} else if notification == nil || notification.Status != common.Update {
+		t.Errorf("ResendObjectToDestination didn't recreate the update notification: %+v", notification)
+	}
+
+	if err := ResendObjectToDestination(orgID, metaData.ObjectType, metaData.ObjectID, common.ForceAll, common.ForceAll); err != nil {
+		t.Errorf("ResendObjectToDestination failed. Error: %s", err.Error())
+	}
+	if result := statuses(); result["dev1"] != common.Delivering || result["dev2"] != common.Delivering {
+		t.Errorf("ResendObjectToDestination didn't resend the object to all its destinations: %v", result)
+	}
+
+	store.DeleteOrganization(orgID)
+}
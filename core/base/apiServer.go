@@ -27,6 +27,7 @@ const resendURL = "/api/v1/resend"
 const securityURL = "/api/v1/security/"
 const shutdownURL = "/api/v1/shutdown"
 const healthURL = "/api/v1/health"
+const searchObjectsURL = "/api/v1/search/objects"
 
 const (
 	contentType     = "Content-Type"
@@ -69,6 +70,16 @@ type organization struct {
 	Address string `json:"address"`
 }
 
+// objectsPage includes a page of the objects that match a search and the total number of matching objects
+// swagger:model
+type objectsPage struct {
+	// Total is the number of objects that match the search
+	Total int `json:"total"`
+
+	// Objects is the page of matching objects
+	Objects []common.MetaData `json:"objects"`
+}
+
 // bulkACLUpdate is the payload used when performing a bulk update on an ACL (either adding uses to an
 // ACL or removing users from an ACL.
 // swagger:model
@@ -84,6 +95,7 @@ func setupAPIServer() {
 	if common.Configuration.NodeType == common.CSS {
 		http.Handle(destinationsURL+"/", http.StripPrefix(destinationsURL+"/", http.HandlerFunc(handleDestinations)))
 		http.Handle(securityURL, http.StripPrefix(securityURL, http.HandlerFunc(handleSecurity)))
+		http.HandleFunc(searchObjectsURL, handleSearchObjects)
 	} else {
 		http.HandleFunc(destinationsURL, handleDestinations)
 	}
@@ -142,7 +154,7 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	if userOrg != orgID && code != security.AuthSyncAdmin {
+	if !security.AuthorizeOrgAccess(code, userOrg, orgID) {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
 		return
@@ -611,11 +623,15 @@ func handleObjectRequest(orgID string, objectType string, objectID string, write
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("In handleObjects. Get %s %s\n", objectType, objectID)
 		}
-		canAccessAllObjects, code, userID := canUserAccessObject(request, orgID, objectType, objectID, false)
+		canAccessAllObjects, code, userID, _ := canUserAccessObject(request, orgID, objectType, objectID, false)
 		if code == security.AuthFailed {
-			writer.WriteHeader(http.StatusForbidden)
-			writer.Write(unauthorizedBytes)
-			return
+			if !security.CanAnonymousReadObject(request, orgID, objectType) {
+				writer.WriteHeader(http.StatusForbidden)
+				writer.Write(unauthorizedBytes)
+				return
+			}
+			// objects of public object types can be read without credentials
+			canAccessAllObjects = true
 		}
 		if metaData, err := GetObject(orgID, objectType, objectID); err != nil {
 			communications.SendErrorResponse(writer, err, "", 0)
@@ -737,7 +753,8 @@ func handleObjectRequest(orgID string, objectType string, objectID string, write
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("In handleObjects. Delete %s %s\n", objectType, objectID)
 		}
-		if _, code, _ := canUserAccessObject(request, orgID, objectType, objectID, false); code == security.AuthFailed {
+		_, code, userID, userOrgID := canUserAccessObject(request, orgID, objectType, objectID, false)
+		if code == security.AuthFailed {
 			writer.WriteHeader(http.StatusForbidden)
 			writer.Write(unauthorizedBytes)
 			return
@@ -763,7 +780,7 @@ func handleObjectRequest(orgID string, objectType string, objectID string, write
 			}
 		}
 
-		if err := DeleteObject(orgID, objectType, objectID); err != nil {
+		if err := DeleteObject(userOrgID+"/"+userID, orgID, objectType, objectID); err != nil {
 			communications.SendErrorResponse(writer, err, "Failed to delete the object. Error: ", 0)
 		} else {
 			writer.WriteHeader(http.StatusNoContent)
@@ -1014,10 +1031,149 @@ func handleListObjectsWithFilters(orgID string, writer http.ResponseWriter, requ
 	}
 }
 
+// swagger:operation GET /api/v1/search/objects handleSearchObjects
+//
+// Search objects across all organizations.
+//
+// Get a page of the objects of all the organizations that satisfy the given filters.
+// Only sync administrators can search objects across organizations.
+// This is a CSS only API.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: query
+//   description: Fetch the objects of the given organization
+//   required: false
+//   type: string
+// - name: objectType
+//   in: query
+//   description: Fetch the objects with given object type
+//   required: false
+//   type: string
+// - name: objectID
+//   in: query
+//   description: Fetch the objects with given object id
+//   required: false
+//   type: string
+// - name: destinationType
+//   in: query
+//   description: Fetch the objects with given destination type
+//   required: false
+//   type: string
+// - name: destinationID
+//   in: query
+//   description: Fetch the objects with given destination id, used only together with destinationType
+//   required: false
+//   type: string
+// - name: offset
+//   in: query
+//   description: The number of matching objects to skip
+//   required: false
+//   type: integer
+// - name: limit
+//   in: query
+//   description: The maximal number of objects to return, 0 or not specified for all the objects
+//   required: false
+//   type: integer
+//
+// responses:
+//   '200':
+//     description: Objects response
+//     schema:
+//       "$ref": "#/definitions/objectsPage"
+//   '400':
+//     description: Invalid offset or limit
+//     schema:
+//       type: string
+//   '403':
+//     description: The user is not a sync administrator
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to retrieve the objects
+//     schema:
+//       type: string
+func handleSearchObjects(writer http.ResponseWriter, request *http.Request) {
+	setResponseHeaders(writer)
+
+	if !common.Running {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, _, _ := security.Authenticate(request)
+	if code != security.AuthSyncAdmin {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	query := request.URL.Query()
+	filter := common.ObjectFilter{OrgID: query.Get("orgID"), ObjectType: query.Get("objectType"), ObjectID: query.Get("objectID"),
+		DestinationType: query.Get("destinationType")}
+	if filter.DestinationType != "" {
+		filter.DestinationID = query.Get("destinationID")
+	}
+	if pathParamValid := validatePathParam(writer, filter.OrgID, filter.ObjectType, filter.ObjectID, filter.DestinationType, filter.DestinationID); !pathParamValid {
+		// header and message are set in function validatePathParam
+		return
+	}
+
+	offset := 0
+	limit := 0
+	var err error
+	if offsetString := query.Get("offset"); offsetString != "" {
+		if offset, err = strconv.Atoi(offsetString); err != nil || offset < 0 {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if limitString := query.Get("limit"); limitString != "" {
+		if limit, err = strconv.Atoi(limitString); err != nil || limit < 0 {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleSearchObjects, search objects with %+v, offset %d, limit %d\n", filter, offset, limit)
+	}
+
+	objects, total, err := ListObjectsAcrossOrgs(filter, offset, limit)
+	if err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to search the objects. Error: ", 0)
+		return
+	}
+	if data, err := json.MarshalIndent(objectsPage{Total: total, Objects: objects}, "", "  "); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to marshal the list of objects. Error: ", 0)
+	} else {
+		writer.Header().Add(contentType, applicationJSON)
+		writer.WriteHeader(http.StatusOK)
+		if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
+		}
+	}
+}
+
 func handleObjectOperation(operation string, orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
 	var canAccessAllObjects bool
 	var code int
 	var userID string
+	var userOrgID string
 
 	if pathParamValid := validatePathParam(writer, orgID, objectType, objectID, "", ""); !pathParamValid {
 		// header and message are set in function validatePathParam
@@ -1025,17 +1181,22 @@ func handleObjectOperation(operation string, orgID string, objectType string, ob
 	}
 
 	if operation != "deleted" {
-		canAccessAllObjects, code, userID = canUserAccessObject(request, orgID, objectType, objectID, false)
+		canAccessAllObjects, code, userID, userOrgID = canUserAccessObject(request, orgID, objectType, objectID, false)
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("In handleObjectOperation, given user %s with authcode %d canAccessAllObjects: %t\n", userID, code, canAccessAllObjects)
 		}
 		if code == security.AuthFailed {
-			writer.WriteHeader(http.StatusForbidden)
-			writer.Write(unauthorizedBytes)
-			return
+			// only the data of objects of public object types can be read without credentials
+			if operation != "data" || !security.CanAnonymousReadObject(request, orgID, objectType) {
+				writer.WriteHeader(http.StatusForbidden)
+				writer.Write(unauthorizedBytes)
+				return
+			}
+			canAccessAllObjects = true
 		}
 
-		if operation == "consumed" || operation == "policyreceived" || operation == "received" || operation == "activate" {
+		if operation == "consumed" || operation == "policyreceived" || operation == "received" || operation == "activate" ||
+			operation == "resend" {
 			// all "mark" status API will forbidden user that only have access to "public" object
 			if !canAccessAllObjects {
 				writer.WriteHeader(http.StatusForbidden)
@@ -1048,15 +1209,17 @@ func handleObjectOperation(operation string, orgID string, objectType string, ob
 
 	switch operation {
 	case "consumed":
-		handleObjectConsumed(orgID, objectType, objectID, writer, request)
+		handleObjectConsumed(orgID, objectType, objectID, userOrgID+"/"+userID, writer, request)
 	case "deleted":
 		handleObjectDeleted(orgID, objectType, objectID, writer, request)
 	case "policyreceived":
 		handlePolicyReceived(orgID, objectType, objectID, writer, request)
 	case "received":
-		handleObjectReceived(orgID, objectType, objectID, writer, request)
+		handleObjectReceived(orgID, objectType, objectID, userOrgID+"/"+userID, writer, request)
 	case "activate":
 		handleActivateObject(orgID, objectType, objectID, writer, request)
+	case "resend":
+		handleResendObject(orgID, objectType, objectID, writer, request)
 	case "status":
 		handleObjectStatus(orgID, objectType, objectID, canAccessAllObjects, writer, request)
 	case "destinations":
@@ -1064,7 +1227,7 @@ func handleObjectOperation(operation string, orgID string, objectType string, ob
 	case "data":
 		switch request.Method {
 		case http.MethodGet:
-			handleObjectGetData(orgID, objectType, objectID, canAccessAllObjects, writer)
+			handleObjectGetData(orgID, objectType, objectID, canAccessAllObjects, userOrgID+"/"+userID, writer, request)
 
 		case http.MethodPut:
 			handleObjectPutData(orgID, objectType, objectID, writer, request)
@@ -1157,12 +1320,12 @@ func handleObjectOperation(operation string, orgID string, objectType string, ob
 //     description: Failed to mark the object consumed
 //     schema:
 //       type: string
-func handleObjectConsumed(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+func handleObjectConsumed(orgID string, objectType string, objectID string, identity string, writer http.ResponseWriter, request *http.Request) {
 	if request.Method == http.MethodPut {
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("In handleObjects. Consumed %s %s\n", objectType, objectID)
 		}
-		if err := ObjectConsumed(orgID, objectType, objectID); err != nil {
+		if err := ObjectConsumed(identity, orgID, objectType, objectID); err != nil {
 			communications.SendErrorResponse(writer, err, "Failed to mark the object as consumed. Error: ", 0)
 		} else {
 			writer.WriteHeader(http.StatusNoContent)
@@ -1215,7 +1378,7 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, writ
 //     schema:
 //       type: string
 func handleObjectDeleted(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
-	canAccessAllObjects, code, serviceID := canUserAccessObject(request, orgID, objectType, objectID, true)
+	canAccessAllObjects, code, serviceID, _ := canUserAccessObject(request, orgID, objectType, objectID, true)
 	if code == security.AuthFailed {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
@@ -1384,12 +1547,12 @@ func handlePolicyReceived(orgID string, objectType string, objectID string, writ
 //     description: Failed to mark the object received
 //     schema:
 //       type: string
-func handleObjectReceived(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+func handleObjectReceived(orgID string, objectType string, objectID string, identity string, writer http.ResponseWriter, request *http.Request) {
 	if request.Method == http.MethodPut {
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("In handleObjects. Received %s %s\n", objectType, objectID)
 		}
-		if err := ObjectReceived(orgID, objectType, objectID); err != nil {
+		if err := ObjectReceived(identity, orgID, objectType, objectID); err != nil {
 			communications.SendErrorResponse(writer, err, "Failed to mark the object as received. Error: ", 0)
 		} else {
 			writer.WriteHeader(http.StatusNoContent)
@@ -1496,6 +1659,94 @@ func handleActivateObject(orgID string, objectType string, objectID string, writ
 	}
 }
 
+// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/resend handleResendObject
+//
+// Resend an object to a destination.
+//
+// Resend the object of the specified object type and object ID to a destination, even if the destination already
+// received or consumed the object. The other destinations of the object are not affected.
+// When the destination is not specified, the object is resent to all its destinations.
+// This is a CSS only API.
+//
+// ---
+//
+// tags:
+// - CSS
+//
+// produces:
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the object to resend
+//   required: true
+//   type: string
+// - name: objectType
+//   in: path
+//   description: The object type of the object to resend
+//   required: true
+//   type: string
+// - name: objectID
+//   in: path
+//   description: The object ID of the object to resend
+//   required: true
+//   type: string
+// - name: destinationType
+//   in: query
+//   description: The destination type of the destination to resend the object to
+//   required: false
+//   type: string
+// - name: destinationID
+//   in: query
+//   description: The destination ID of the destination to resend the object to
+//   required: false
+//   type: string
+//
+// responses:
+//   '204':
+//     description: The object will be resent
+//     schema:
+//       type: string
+//   '400':
+//     description: The object isn't ready to be sent or isn't sent to the destination
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to resend the object
+//     schema:
+//       type: string
+func handleResendObject(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPut {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	destType := request.URL.Query().Get("destinationType")
+	destID := request.URL.Query().Get("destinationID")
+	if (destType == "") != (destID == "") {
+		communications.SendErrorResponse(writer, nil, "Both the destination type and the destination ID must be specified", http.StatusBadRequest)
+		return
+	}
+	if pathParamValid := validatePathParam(writer, orgID, objectType, objectID, destType, destID); !pathParamValid {
+		// header and message are set in function validatePathParam
+		return
+	}
+	if destType == "" {
+		destType = common.ForceAll
+		destID = common.ForceAll
+	}
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleObjects. Resend %s %s to %s %s\n", objectType, objectID, destType, destID)
+	}
+	if err := ResendObjectToDestination(orgID, objectType, objectID, destType, destID); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to resend the object. Error: ", 0)
+	} else {
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
 // swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/status handleObjectStatus
 //
 // Get the status of an object.
@@ -1883,7 +2134,7 @@ func handleObjectDestinations(orgID string, objectType string, objectID string,
 //     description: Failed to retrieve the object's data
 //     schema:
 //       type: string
-func handleObjectGetData(orgID string, objectType string, objectID string, canAccessAllObjects bool, writer http.ResponseWriter) {
+func handleObjectGetData(orgID string, objectType string, objectID string, canAccessAllObjects bool, identity string, writer http.ResponseWriter, request *http.Request) {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In handleObjects. Get data %s %s, canAccessAllObjects %t\n", objectType, objectID, canAccessAllObjects)
 	}
@@ -1899,7 +2150,7 @@ func handleObjectGetData(orgID string, objectType string, objectID string, canAc
 		}
 	}
 
-	if dataReader, err := GetObjectData(orgID, objectType, objectID); err != nil {
+	if dataReader, err := GetObjectData(identity, orgID, objectType, objectID); err != nil {
 		communications.SendErrorResponse(writer, err, "", 0)
 	} else {
 		if dataReader == nil {
@@ -2168,7 +2419,7 @@ func handleListUpdatedObjects(orgID string, objectType string, received bool, wr
 		return
 	}
 
-	canAccessAllObjects, code, userID := canUserAccessObject(request, orgID, objectType, "", true) //objectID == "", so checkLastDestinationPolicyServices will not be used
+	canAccessAllObjects, code, userID, _ := canUserAccessObject(request, orgID, objectType, "", true) //objectID == "", so checkLastDestinationPolicyServices will not be used
 	if code == security.AuthFailed {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
@@ -2339,7 +2590,7 @@ func handleListAllObjects(orgID string, objectType string, writer http.ResponseW
 		return
 	}
 
-	canAccessAllObjects, code, userID := canUserAccessObject(request, orgID, objectType, "", false)
+	canAccessAllObjects, code, userID, _ := canUserAccessObject(request, orgID, objectType, "", false)
 	if code == security.AuthFailed {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
@@ -2716,7 +2967,7 @@ func handleWebhook(orgID string, objectType string, writer http.ResponseWriter,
 		return
 	}
 
-	_, code, userID := canUserAccessObject(request, orgID, objectType, "", false)
+	_, code, userID, _ := canUserAccessObject(request, orgID, objectType, "", false)
 	if code == security.AuthFailed || code == security.AuthService {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
@@ -2868,7 +3119,7 @@ func handleUpdateObject(orgID string, objectType string, objectID string, writer
 			payload.Meta.OwnerID = userOrgID + "/" + userID
 		}
 
-		if err := UpdateObject(orgID, objectType, objectID, payload.Meta, payload.Data); err == nil {
+		if err := UpdateObject(userOrgID+"/"+userID, orgID, objectType, objectID, payload.Meta, payload.Data); err == nil {
 			writer.WriteHeader(http.StatusNoContent)
 		} else {
 			communications.SendErrorResponse(writer, err, "", 0)
@@ -2939,7 +3190,7 @@ func handleGetOrganizations(writer http.ResponseWriter, request *http.Request) {
 		} else {
 			orgsList := make([]organization, 0)
 			for _, org := range orgs {
-				if code == security.AuthSyncAdmin || userOrg == org.OrgID {
+				if security.AuthorizeOrgAccess(code, userOrg, org.OrgID) {
 					orgsList = append(orgsList, organization{OrgID: org.OrgID, Address: org.Address})
 				}
 			}
@@ -2983,7 +3234,7 @@ func handleOrganizations(writer http.ResponseWriter, request *http.Request) {
 	}
 
 	code, userOrg, _ := security.Authenticate(request)
-	if !((code == security.AuthAdmin && orgID == userOrg) || code == security.AuthSyncAdmin) {
+	if (code != security.AuthAdmin && code != security.AuthSyncAdmin) || !security.AuthorizeOrgAccess(code, userOrg, orgID) {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
 		return
@@ -3114,13 +3365,13 @@ func handleSecurity(writer http.ResponseWriter, request *http.Request) {
 		trace.Debug("In handleSecurity(), aclType: %s, orgID: %s, len(parts) %d\n", aclType, orgID, len(parts))
 	}
 
-	if code != security.AuthSyncAdmin && userOrg != orgID {
+	if !security.AuthorizeOrgAccess(code, userOrg, orgID) {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
 		return
 	}
 
-	if aclType != common.DestinationsACLType && aclType != common.ObjectsACLType {
+	if aclType != common.DestinationsACLType && aclType != common.ObjectsACLType && aclType != common.DestinationObjectTypesACLType {
 		writer.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -3156,8 +3407,8 @@ func handleSecurity(writer http.ResponseWriter, request *http.Request) {
 		aclUserType := ""
 		aclUserType = request.URL.Query().Get("acl_usertype")
 
-		if aclUserType != "" && aclUserType != security.ACLUser && aclUserType != security.ACLNode {
-			communications.SendErrorResponse(writer, nil, fmt.Sprintf("Invalid acl user type %s in URL. If specified, the value should be \"user\" or \"node\"", aclUserType), http.StatusBadRequest)
+		if aclUserType != "" && aclUserType != security.ACLUser && aclUserType != security.ACLNode && aclUserType != security.ACLObjectType {
+			communications.SendErrorResponse(writer, nil, fmt.Sprintf("Invalid acl user type %s in URL. If specified, the value should be \"user\", \"node\", or \"objectType\"", aclUserType), http.StatusBadRequest)
 			return
 		}
 
@@ -3192,7 +3443,7 @@ func handleSecurity(writer http.ResponseWriter, request *http.Request) {
 //   description: The type of the ACL to remove the specified username from.
 //   required: true
 //   type: string
-//   enum: [destinations, objects]
+//   enum: [destinations, objects, destinationObjectTypes]
 // - name: orgID
 //   in: path
 //   description: The orgID in which the ACL for the destination type or object type exists.
@@ -3264,7 +3515,7 @@ func handleACLGet(aclType string, orgID string, key string, aclUserType string,
 	//   description: The type of the ACL whose username list should be retrieved.
 	//   required: true
 	//   type: string
-	//   enum: [destinations, objects]
+	//   enum: [destinations, objects, destinationObjectTypes]
 	// - name: orgID
 	//   in: path
 	//   description: The orgID in which the ACL for the destination type or object type exists.
@@ -3382,7 +3633,7 @@ func handleACLUpdate(request *http.Request, aclType string, orgID string, parts
 		//   description: The type of the ACL to which the specified user(s) will be added/removed.
 		//   required: true
 		//   type: string
-		//   enum: [destinations, objects]
+		//   enum: [destinations, objects, destinationObjectTypes]
 		// - name: orgID
 		//   in: path
 		//   description: The orgID in which the ACL for the destination type or object type exists.
@@ -3422,7 +3673,7 @@ func handleACLUpdate(request *http.Request, aclType string, orgID string, parts
 				if trace.IsLogging(logger.DEBUG) {
 					trace.Debug("In handleSecurity. Bulk remove usernames %s\n", parts[0])
 				}
-				if err = security.CheckRemoveACLInputFormat(payload.Users); err != nil {
+				if err = security.CheckRemoveACLInputFormat(aclType, payload.Users); err != nil {
 					communications.SendErrorResponse(writer, err, "Invalid ACL entry for update. Error: ", http.StatusBadRequest)
 					return
 				} else {
@@ -3478,7 +3729,7 @@ func handleACLUpdate(request *http.Request, aclType string, orgID string, parts
 		//   description: The type of the ACL to which the specified username(s) will be added/removed.
 		//   required: true
 		//   type: string
-		//   enum: [destinations, objects]
+		//   enum: [destinations, objects, destinationObjectTypes]
 		// - name: orgID
 		//   in: path
 		//   description: The orgID in which the ACL for the destination type or object type exists.
@@ -3516,7 +3767,7 @@ func handleACLUpdate(request *http.Request, aclType string, orgID string, parts
 				if trace.IsLogging(logger.DEBUG) {
 					trace.Debug("In handleSecurity. Bulk remove usernames for all %s types\n", aclType)
 				}
-				if err = security.CheckRemoveACLInputFormat(payload.Users); err != nil {
+				if err = security.CheckRemoveACLInputFormat(aclType, payload.Users); err != nil {
 					communications.SendErrorResponse(writer, err, "Invalid ACL entry for update. Error: ", http.StatusBadRequest)
 					return
 				} else {
@@ -3550,10 +3801,10 @@ func handleACLUpdate(request *http.Request, aclType string, orgID string, parts
 	}
 }
 
-func canUserAccessObject(request *http.Request, orgID, objectType, objectID string, checkLastDestinationPolicyServices bool) (bool, int, string) {
-	accessToALlObject, code, userID := security.CanUserAccessAllObjects(request, orgID, objectType)
+func canUserAccessObject(request *http.Request, orgID, objectType, objectID string, checkLastDestinationPolicyServices bool) (bool, int, string, string) {
+	accessToALlObject, code, userID, userOrgID := security.CanUserAccessAllObjects(request, orgID, objectType)
 	if code != security.AuthService || common.Configuration.NodeType == common.CSS || objectID == "" {
-		return accessToALlObject, code, userID
+		return accessToALlObject, code, userID, userOrgID
 	}
 
 	if trace.IsLogging(logger.DEBUG) {
@@ -3568,15 +3819,15 @@ func canUserAccessObject(request *http.Request, orgID, objectType, objectID stri
 	metadata, removedDestinationPolicyServices, err := store.RetrieveObjectAndRemovedDestinationPolicyServices(orgID, objectType, objectID)
 	if err == nil && metadata != nil {
 		if canServiceAccessObject(userID, metadata.DestinationPolicy, removedDestinationPolicyServices, checkLastDestinationPolicyServices) {
-			return true, code, userID
+			return true, code, userID, userOrgID
 		}
 
 		// else service do not have access to the object, first returned value should be false
 		if metadata.Public {
-			return false, code, userID
+			return false, code, userID, userOrgID
 		}
 	}
-	return false, security.AuthFailed, ""
+	return false, security.AuthFailed, "", ""
 }
 
 func canServiceAccessObject(serviceID string, policy *common.Policy, oldPolicyServices []common.ServiceID, checkLastDestinationPolicyServices bool) bool {
@@ -3643,11 +3894,11 @@ func GetAccessibleObjects(code int, orgID string, userOrgID string, userID strin
 
 	accessibleObjects := make([]common.MetaData, 0)
 
-	if code == security.AuthSyncAdmin || (code == security.AuthAdmin && orgID == userOrgID) {
+	if (code == security.AuthSyncAdmin || code == security.AuthAdmin) && security.AuthorizeOrgAccess(code, userOrgID, orgID) {
 		// AuthSyncAdmin: show all objects
 		// AuthAdmin in this org: show all objects
 		accessibleObjects = append(accessibleObjects, objects...)
-	} else if orgID != userOrgID {
+	} else if !security.AuthorizeOrgAccess(code, userOrgID, orgID) {
 		// different org: only show public objects
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("In GetAccessibleObjects, userOrg %s is not same as orgID %s in API path, will return public objects\n", userID, orgID)
@@ -3699,11 +3950,11 @@ func GetAccessibleObjectsDestinationPolicy(code int, orgID string, userOrgID str
 
 	accessibleObjects := make([]common.ObjectDestinationPolicy, 0)
 
-	if code == security.AuthSyncAdmin || (code == security.AuthAdmin && orgID == userOrgID) {
+	if (code == security.AuthSyncAdmin || code == security.AuthAdmin) && security.AuthorizeOrgAccess(code, userOrgID, orgID) {
 		// AuthSyncAdmin: show all objects
 		// AuthAdmin in this org: show all objects
 		accessibleObjects = append(accessibleObjects, objects...)
-	} else if orgID != userOrgID {
+	} else if !security.AuthorizeOrgAccess(code, userOrgID, orgID) {
 		// different org: only show public objects
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("UserOrg %s is not same as orgID %s in API path, will return public objects\n", userID, orgID)
@@ -1099,7 +1099,7 @@ func loadTestPolicyData(nodeType string, orgID string) (int64, int, error) {
 		since = time.Now().UTC().UnixNano()
 		time.Sleep(10 * time.Millisecond)
 
-		if _, err := store.StoreObject(metaData, nil, common.CompletelyReceived); err != nil {
+		if _, err := store.StoreObject(metaData, nil, common.CompletelyReceived, ""); err != nil {
 			return 0, 0, err
 		}
 	}
@@ -1364,7 +1364,7 @@ func loadTestMetaData(nodeType string, orgID string) (int64, int, error) {
 		since = time.Now().UTC().UnixNano()
 		time.Sleep(10 * time.Millisecond)
 
-		if _, err := store.StoreObject(metaData, nil, common.CompletelyReceived); err != nil {
+		if _, err := store.StoreObject(metaData, nil, common.CompletelyReceived, ""); err != nil {
 			return 0, 0, err
 		}
 	}
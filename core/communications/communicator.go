@@ -112,11 +112,11 @@ var Comm Communicator
 func SendErrorResponse(writer http.ResponseWriter, err error, message string, statusCode int) {
 	if statusCode == 0 {
 		switch err.(type) {
-		case *common.InvalidRequest:
+		case *common.InvalidRequest, *common.ValidationError:
 			statusCode = http.StatusBadRequest
 		case *storage.Error:
 			statusCode = http.StatusInternalServerError
-		case *storage.NotConnected:
+		case *storage.NotConnected, *storage.TooManyOpenFiles, *common.ReadOnlyError:
 			statusCode = http.StatusServiceUnavailable
 		case *ignoredByHandler:
 			statusCode = http.StatusConflict
@@ -142,6 +142,11 @@ func SendErrorResponse(writer http.ResponseWriter, err error, message string, st
 	}
 }
 
+// nodeIdentity returns the identity of a sync service node, recorded in the audit log for the mutations it initiated
+func nodeIdentity(destType string, destID string) string {
+	return destType + "/" + destID
+}
+
 func destinationExists(orgID string, destType string, destID string) bool {
 	exists, err := Store.DestinationExists(orgID, destType, destID)
 	if err != nil {
@@ -618,7 +618,8 @@ func (communication *HTTP) GetData(metaData common.MetaData, offset int64) commo
 			return &Error{"Failed to store object's data."}
 		}
 	}
-	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.CompletelyReceived); err != nil {
+	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.CompletelyReceived,
+		nodeIdentity(metaData.OriginType, metaData.OriginID)); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return &Error{fmt.Sprintf("Error in GetData: %s\n", err)}
 	}
@@ -825,7 +826,7 @@ func (communication *HTTP) handleObjects(writer http.ResponseWriter, request *ht
 		var err error
 		switch action {
 		case common.Data:
-			err = communication.handlePutData(orgID, objectType, objectID, request)
+			err = communication.handlePutData(orgID, objectType, objectID, destType, destID, request)
 		case common.Update:
 			metaData, extractErr := communication.extractMetaData(request)
 			if extractErr != nil {
@@ -903,7 +904,7 @@ func (communication *HTTP) handleObjects(writer http.ResponseWriter, request *ht
 	}
 }
 
-func (communication *HTTP) handlePutData(orgID string, objectType string, objectID string,
+func (communication *HTTP) handlePutData(orgID string, objectType string, objectID string, destType string, destID string,
 	request *http.Request) common.SyncServiceError {
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
@@ -915,7 +916,7 @@ func (communication *HTTP) handlePutData(orgID string, objectType string, object
 		common.ObjectLocks.Unlock(lockIndex)
 		return &common.InvalidRequest{Message: "Failed to find object to set data"}
 	}
-	if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.CompletelyReceived); err != nil {
+	if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.CompletelyReceived, nodeIdentity(destType, destID)); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return err
 	}
@@ -945,7 +946,7 @@ func (communication *HTTP) handleGetData(orgID string, objectType string, object
 	common.ObjectLocks.Lock(lockIndex)
 	defer common.ObjectLocks.Unlock(lockIndex)
 
-	if dataReader, err := Store.RetrieveObjectData(orgID, objectType, objectID); err != nil {
+	if dataReader, err := Store.RetrieveObjectData(orgID, objectType, objectID, nodeIdentity(destType, destID)); err != nil {
 		SendErrorResponse(writer, err, "", 0)
 	} else {
 		if dataReader == nil {
@@ -978,7 +979,8 @@ func (communication *HTTP) pushData(metaData *common.MetaData) common.SyncServic
 	if metaData.SourceDataURI != "" {
 		dataReader, err = dataURI.GetData(metaData.SourceDataURI)
 	} else {
-		dataReader, err = Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		dataReader, err = Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			nodeIdentity(metaData.DestType, metaData.DestID))
 	}
 	if err != nil {
 		return err
@@ -309,7 +309,7 @@ func TestEssHTTPComm(t *testing.T) {
 	statusAfterPoll := []string{common.CompletelyReceived, common.ObjDeleted, common.ConsumedByDest, common.ObjDeleted}
 
 	metaData := ctx.pollPayload[2].MetaData
-	Store.StoreObject(metaData, []byte("1234567890abcdefghijkl"), common.ReadyToSend)
+	Store.StoreObject(metaData, []byte("1234567890abcdefghijkl"), common.ReadyToSend, "")
 	notification := common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
 		DestOrgID: metaData.DestOrgID, DestID: metaData.DestID, DestType: metaData.DestType,
 		Status: common.Updated, InstanceID: 1}
@@ -322,7 +322,7 @@ func TestEssHTTPComm(t *testing.T) {
 	}
 
 	metaData = ctx.pollPayload[3].MetaData
-	Store.StoreObject(metaData, nil, common.ObjDeleted)
+	Store.StoreObject(metaData, nil, common.ObjDeleted, "")
 	notification = common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
 		DestOrgID: metaData.DestOrgID, DestID: metaData.DestID, DestType: metaData.DestType,
 		Status: common.ObjDeleted, InstanceID: 1}
@@ -413,12 +413,12 @@ func testLoadObjects(testObjects []httpTestObjectInfo, t *testing.T) {
 		metaData := testObject.metaData
 
 		// Delete the object first
-		if err := storage.DeleteStoredObject(Store, metaData); err != nil {
+		if err := storage.DeleteStoredObject(Store, metaData, ""); err != nil {
 			t.Errorf("Failed to delete object (objectID = %s). Error: %s\n",
 				metaData.ObjectID, err.Error())
 		}
 		// Insert
-		if _, err := Store.StoreObject(metaData, testObject.data, testObject.status); err != nil {
+		if _, err := Store.StoreObject(metaData, testObject.data, testObject.status, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", metaData.ObjectID, err.Error())
 		}
 
@@ -1,13 +1,11 @@
 package communications
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"net/http"
 
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/leader"
+	"github.com/open-horizon/edge-sync-service/core/storage"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -61,19 +59,30 @@ func PrepareNotificationsForDestinations(metaData common.MetaData, destinations
 }
 
 func prepareNotifications(topic string, metaData common.MetaData, destinations []common.Destination) ([]common.NotificationInfo, common.SyncServiceError) {
-	result := make([]common.NotificationInfo, 0)
+	if topic == common.Update && common.Configuration.NodeType == common.CSS {
+		// Objects are only sent to the destinations whose type is permitted to receive the object's type
+		var err common.SyncServiceError
+		destinations, err = storage.FilterDestinationsForObjectType(Store, metaData.DestOrgID, metaData.ObjectType, destinations)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// Create an initial notification record for each destination
-	for _, destination := range destinations {
-		notification := common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
+	result := make([]common.NotificationInfo, 0, len(destinations))
+
+	// Create an initial notification record for each destination.
+	// The records are stored together, since objects sent to all the destinations of a type can have thousands of them.
+	notifications := make([]common.Notification, len(destinations))
+	for i, destination := range destinations {
+		notifications[i] = common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
 			DestOrgID: metaData.DestOrgID, DestID: destination.DestID, DestType: destination.DestType,
 			Status: topic, InstanceID: metaData.InstanceID, DataID: metaData.DataID}
+	}
+	if err := Store.UpdateNotificationRecords(notifications); err != nil {
+		return nil, err
+	}
 
-		// Store the notification records in storage as part of the object
-		if err := Store.UpdateNotificationRecord(notification); err != nil {
-			return nil, err
-		}
-
+	for _, destination := range destinations {
 		// Set the DestID in case the object was for destinations of a type or a destinations list
 		metaData.DestType = destination.DestType
 		metaData.DestID = destination.DestID
@@ -296,38 +305,3 @@ func ResendObjects() common.SyncServiceError {
 	common.ResendAcked = false
 	return Comm.ResendObjects()
 }
-
-func callWebhooks(metaData *common.MetaData) {
-	if webhooks, err := Store.RetrieveWebhooks(metaData.DestOrgID, metaData.ObjectType); err == nil {
-		body, err := json.MarshalIndent(metaData, "", "  ")
-		if err != nil {
-			if log.IsLogging(logger.ERROR) {
-				log.Error("Error in callWebhooks, failed to marshal meta data: %s\n", err)
-			}
-			return
-		}
-		for _, url := range webhooks {
-			request, err := http.NewRequest("POST", url, bytes.NewReader(body))
-			request.ContentLength = int64(len(body))
-			request.Header.Add("Content-Type", "Application/JSON")
-			response, err := http.DefaultClient.Do(request)
-			if err != nil {
-				if log.IsLogging(logger.ERROR) {
-					log.Error("Error in callWebhooks, failed to post meta data to %s: %s\n", url, err)
-				}
-				continue
-			}
-			if response.StatusCode != http.StatusOK &&
-				response.StatusCode != http.StatusNoContent &&
-				log.IsLogging(logger.ERROR) {
-				log.Error("Error in callWebhooks: received status: %d for %s\n", response.StatusCode, url)
-			}
-			err = response.Body.Close()
-			if err != nil {
-				if log.IsLogging(logger.ERROR) {
-					log.Error("Error in callWebhooks, failed to close response body")
-				}
-			}
-		}
-	}
-}
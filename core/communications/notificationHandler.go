@@ -35,6 +35,8 @@ type notificationChunksInfo struct {
 	chunksReceived     []byte          // This byte array holds a bit per chunk indicating its arrival
 	chunkSize          int
 	resendTime         int64
+	backpressureOffset int64 // The offset of the missing chunk last requested because of backpressure
+	backpressureTime   int64 // The time the missing chunk was last requested because of backpressure
 }
 
 var registerAsNew bool
@@ -74,9 +76,9 @@ func handleRegistration(dest common.Destination, persistentStorage bool) common.
 		return &ignoredByHandler{}
 	}
 
-	// Add to the destinations list
-	if err := Store.StoreDestination(dest); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration: failed to store destination. Error: %s\n", err)}
+	// Add to the destinations list, recording that the destination was just seen
+	if err := Store.RegisterDestination(dest); err != nil {
+		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration: failed to register destination. Error: %s\n", err)}
 	}
 
 	// Ack
@@ -110,9 +112,9 @@ func handleRegisterNew(dest common.Destination, persistentStorage bool) common.S
 		trace.Trace("Handling registration of a new ESS: %s %s\n", dest.DestType, dest.DestID)
 	}
 
-	// Add to the destinations list
-	if err := Store.StoreDestination(dest); err != nil {
-		return &notificationHandlerError{fmt.Sprintf("Error in handleRegisterNew: failed to store destination. Error: %s\n", err)}
+	// Add to the destinations list, recording that the destination was just seen
+	if err := Store.RegisterDestination(dest); err != nil {
+		return &notificationHandlerError{fmt.Sprintf("Error in handleRegisterNew: failed to register destination. Error: %s\n", err)}
 	}
 
 	if log.IsLogging(logger.INFO) {
@@ -365,7 +367,7 @@ func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncSe
 	}
 
 	// Store the object
-	if _, err := Store.StoreObject(metaData, nil, status); err != nil {
+	if _, err := Store.StoreObject(metaData, nil, status, nodeIdentity(metaData.OriginType, metaData.OriginID)); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return &notificationHandlerError{fmt.Sprintf("Error in handleUpdate: failed to store object. Error: %s\n", err)}
 	}
@@ -523,7 +525,7 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, dest
 	if common.Configuration.NodeType == common.ESS {
 		// On ESS we keep consumed objects up to ESSConsumedObjectsKept, and then we remove the oldest
 		// one. We keep consumed objects (meta data only) for reporting.
-		if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.ConsumedByDest); err != nil {
+		if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.ConsumedByDest, nodeIdentity(destType, destID)); err != nil {
 			common.ObjectLocks.Unlock(lockIndex)
 			return err
 		}
@@ -543,7 +545,7 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, dest
 					common.ObjectLocks.ConditionalLock(index, lockIndex)
 					stored, status, err := Store.RetrieveObjectAndStatus(objectToDelete.DestOrgID, objectToDelete.ObjectType, objectToDelete.ObjectID)
 					if err == nil && status == common.ConsumedByDest && stored.InstanceID == objectToDelete.InstanceID {
-						if err = storage.DeleteStoredObject(Store, objectToDelete); err != nil && log.IsLogging(logger.ERROR) {
+						if err = storage.DeleteStoredObject(Store, objectToDelete, common.SyncServiceIdentity); err != nil && log.IsLogging(logger.ERROR) {
 							log.Error("Error in handleObjectConsumed: failed to delete stored object. Error: %s\n", err)
 						}
 					}
@@ -623,7 +625,7 @@ func handleAckConsumed(orgID string, objectType string, objectID string, destTyp
 	// Delete the object
 	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 	if err == nil && metaData != nil {
-		err = storage.DeleteStoredObject(Store, *metaData)
+		err = storage.DeleteStoredObject(Store, *metaData, nodeIdentity(destType, destID))
 		if err != nil && log.IsLogging(logger.ERROR) {
 			log.Error("Error in handleAckConsumed: failed to delete stored object. Error: %s\n", err)
 		}
@@ -740,11 +742,12 @@ func handleDelete(metaData common.MetaData) common.SyncServiceError {
 	common.ObjectLocks.Lock(lockIndex)
 
 	sendDeleted := false
-	if err := Store.MarkObjectDeleted(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+	identity := nodeIdentity(metaData.OriginType, metaData.OriginID)
+	if err := Store.MarkObjectDeleted(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, identity); err != nil {
 		if common.Configuration.NodeType == common.ESS && storage.IsNotFound(err) {
 			// Failed to update, object doesn't exist, on ESS recreate it (without data)
 			metaData.Deleted = true
-			if _, err := Store.StoreObject(metaData, nil, common.ObjDeleted); err != nil {
+			if _, err := Store.StoreObject(metaData, nil, common.ObjDeleted, identity); err != nil {
 				common.ObjectLocks.Unlock(lockIndex)
 				return &notificationHandlerError{fmt.Sprintf("Error in handleDelete: failed to recreate deleted object. Error: %s\n", err)}
 			}
@@ -833,7 +836,7 @@ func handleAckDelete(orgID string, objectType string, objectID string, destType
 		// Delete the object
 		metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 		if err == nil && metaData != nil {
-			return storage.DeleteStoredObject(Store, *metaData)
+			return storage.DeleteStoredObject(Store, *metaData, nodeIdentity(destType, destID))
 		}
 		return &notificationHandlerError{fmt.Sprintf("Error in handleAckDelete: failed to find object. Error: %s\n", err)}
 	}
@@ -916,7 +919,7 @@ func handleAckObjectDeleted(orgID string, objectType string, objectID string, de
 	// Delete the object
 	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
 	if err == nil && metaData != nil {
-		return storage.DeleteStoredObject(Store, *metaData)
+		return storage.DeleteStoredObject(Store, *metaData, nodeIdentity(destType, destID))
 	}
 
 	return &notificationHandlerError{fmt.Sprintf("Error in handleAckObjectDeleted: failed to find object. Error: %s\n", err)}
@@ -1071,6 +1074,19 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 					common.ObjectLocks.Unlock(lockIndex)
 					return metaData, nil
 				}
+				if storage.IsBackpressure(err) {
+					// Pause requesting new chunks and request the missing in-order chunk instead,
+					// the postponed chunk is requested again when its resend time expires
+					common.ObjectLocks.Unlock(lockIndex)
+					nextOffset := err.(*storage.Backpressure).NextOffset
+					if !shouldRequestMissingChunk(*metaData, metaData.OriginType, metaData.OriginID, nextOffset) {
+						return metaData, nil
+					}
+					if err := Comm.GetData(*metaData, nextOffset); err != nil {
+						return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: failed to request data. Error: %s\n", err)}
+					}
+					return metaData, nil
+				}
 				common.ObjectLocks.Unlock(lockIndex)
 				return metaData, err
 			}
@@ -1086,7 +1102,8 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 	if isLastChunk {
 		removeNotificationChunksInfo(*metaData, metaData.OriginType, metaData.OriginID)
 
-		if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.CompletelyReceived); err != nil {
+		if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.CompletelyReceived,
+			nodeIdentity(metaData.OriginType, metaData.OriginID)); err != nil {
 			common.ObjectLocks.Unlock(lockIndex)
 			return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: %s\n", err)}
 		}
@@ -1149,7 +1166,7 @@ func handleGetData(metaData common.MetaData, offset int64) common.SyncServiceErr
 			offset)
 	} else {
 		objectData, eof, length, err = Store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
-			common.Configuration.MaxDataChunkSize, offset)
+			common.Configuration.MaxDataChunkSize, offset, nodeIdentity(metaData.DestType, metaData.DestID))
 	}
 	if err != nil {
 		common.ObjectLocks.RUnlock(lockIndex)
@@ -1572,6 +1589,28 @@ func updateNotificationChunkInfo(createNotification bool, metaData common.MetaDa
 	return nil
 }
 
+// shouldRequestMissingChunk returns true if the missing chunk at the offset wasn't already requested because of
+// backpressure during the current resend window, so that every postponed chunk doesn't request it again
+func shouldRequestMissingChunk(metaData common.MetaData, destType string, destID string, offset int64) bool {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID)
+	notificationLock.Lock()
+	defer notificationLock.Unlock()
+
+	chunksInfo, ok := notificationChunks[id]
+	if !ok {
+		return true
+	}
+	currentTime := time.Now().Unix()
+	if chunksInfo.backpressureOffset == offset &&
+		chunksInfo.backpressureTime+int64(common.Configuration.ResendInterval*6) > currentTime {
+		return false
+	}
+	chunksInfo.backpressureOffset = offset
+	chunksInfo.backpressureTime = currentTime
+	notificationChunks[id] = chunksInfo
+	return true
+}
+
 func removeNotificationChunksInfo(metaData common.MetaData, destType string, destID string) {
 	deleteNotificationChunksInfo(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID)
 }
@@ -1719,7 +1758,7 @@ func deleteObjectInfo(orgID string, objectType string, objectID string, destType
 			}
 		}
 		if objectToDelete != nil {
-			storage.DeleteStoredObject(Store, *objectToDelete)
+			storage.DeleteStoredObject(Store, *objectToDelete, common.SyncServiceIdentity)
 		}
 		deleteNotificationChunksInfo(orgID, objectType, objectID, destType, destID)
 	}
@@ -231,7 +231,7 @@ func TestNotificationHandler(t *testing.T) {
 				t.Errorf("Wrong status: %s instead of completely received (objectID = %s)", storedStatus, row.metaData.ObjectID)
 			}
 			// Check data
-			storedDataReader, err := Store.RetrieveObjectData(row.metaData.DestOrgID, row.metaData.ObjectType, row.metaData.ObjectID)
+			storedDataReader, err := Store.RetrieveObjectData(row.metaData.DestOrgID, row.metaData.ObjectType, row.metaData.ObjectID, "")
 			if err != nil {
 				t.Errorf("Failed to fetch object's data (objectID = %s). Error: %s", row.metaData.ObjectID, err.Error())
 			} else {
@@ -300,7 +300,7 @@ func TestNotificationHandler(t *testing.T) {
 		}
 
 		// There should be no data
-		dataReader, _ := Store.RetrieveObjectData(row.metaData.DestOrgID, row.metaData.ObjectType, row.metaData.ObjectID)
+		dataReader, _ := Store.RetrieveObjectData(row.metaData.DestOrgID, row.metaData.ObjectType, row.metaData.ObjectID, "")
 		if dataReader != nil {
 			t.Errorf("Deleted object has data (objectID = %s)", row.metaData.ObjectID)
 		}
@@ -372,7 +372,7 @@ func TestNotificationHandler(t *testing.T) {
 
 	for _, row := range tests {
 		// The sending side
-		if _, err := Store.StoreObject(row.metaData, row.chunk1, common.ReadyToSend); err != nil {
+		if _, err := Store.StoreObject(row.metaData, row.chunk1, common.ReadyToSend, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s", row.metaData.ObjectID, err.Error())
 		} else {
 			notificationsInfo, err := PrepareObjectNotifications(row.metaData)
@@ -574,7 +574,7 @@ func TestNotificationHandler(t *testing.T) {
 					}
 				}
 
-				if _, err := Store.StoreObject(row.metaData, row.chunk1, common.ReadyToSend); err != nil {
+				if _, err := Store.StoreObject(row.metaData, row.chunk1, common.ReadyToSend, ""); err != nil {
 					t.Errorf("Failed to store object (objectID = %s). Error: %s", row.metaData.ObjectID, err.Error())
 				}
 			}
@@ -586,7 +586,7 @@ func TestNotificationHandler(t *testing.T) {
 	}
 	for _, row := range tests {
 
-		if err := storage.DeleteStoredObject(Store, row.metaData); err != nil {
+		if err := storage.DeleteStoredObject(Store, row.metaData, ""); err != nil {
 			t.Errorf("Failed to delete object. Error: %s", err.Error())
 		}
 	}
@@ -640,7 +640,7 @@ func testPingAndRegisterNew(storageType string, t *testing.T) {
 	}
 
 	for _, test := range tests {
-		if _, err := Store.StoreObject(test.metaData, test.data, test.status); err != nil {
+		if _, err := Store.StoreObject(test.metaData, test.data, test.status, ""); err != nil {
 			t.Errorf("StoreObject failed. Error: %s", err.Error())
 		}
 		if err := Store.DeleteNotificationRecords(test.metaData.DestOrgID, test.metaData.ObjectType,
@@ -820,7 +820,7 @@ func testRegisterAsNew(storageType string, t *testing.T) {
 	}
 
 	for _, test := range tests {
-		if _, err := Store.StoreObject(test.metaData, test.data, test.status); err != nil {
+		if _, err := Store.StoreObject(test.metaData, test.data, test.status, ""); err != nil {
 			t.Errorf("StoreObject failed. Error: %s", err.Error())
 		}
 
@@ -946,6 +946,34 @@ func TestRegisterDestinationValidity(t *testing.T) {
 	}
 }
 
+func TestShouldRequestMissingChunk(t *testing.T) {
+	metaData := common.MetaData{DestOrgID: "myorg", ObjectType: "type1", ObjectID: "backpressure", ChunkSize: 10}
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "device", "dev1")
+	notificationLock.Lock()
+	notificationChunks[id] = notificationChunksInfo{chunkSize: metaData.ChunkSize, chunkResendTimes: make(map[int64]int64)}
+	notificationLock.Unlock()
+	defer deleteNotificationChunksInfo(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "device", "dev1")
+
+	if !shouldRequestMissingChunk(metaData, "device", "dev1", 20) {
+		t.Errorf("The missing chunk wasn't requested for the first postponed chunk")
+	}
+	if shouldRequestMissingChunk(metaData, "device", "dev1", 20) {
+		t.Errorf("The missing chunk was requested again in the same resend window")
+	}
+	if !shouldRequestMissingChunk(metaData, "device", "dev1", 30) {
+		t.Errorf("The next missing chunk wasn't requested")
+	}
+
+	notificationLock.Lock()
+	chunksInfo := notificationChunks[id]
+	chunksInfo.backpressureTime -= int64(common.Configuration.ResendInterval*6) + 1
+	notificationChunks[id] = chunksInfo
+	notificationLock.Unlock()
+	if !shouldRequestMissingChunk(metaData, "device", "dev1", 30) {
+		t.Errorf("The missing chunk wasn't requested again after the resend window")
+	}
+}
+
 func setUpStorage(storageType string) (storage.Storage, error) {
 	var store storage.Storage
 	if storageType == common.InMemory {
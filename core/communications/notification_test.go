@@ -159,7 +159,7 @@ func TestNotifications(t *testing.T) {
 			}
 		}
 
-		if _, err := Store.StoreObject(row.metaData, []byte("data"), common.ReadyToSend); err != nil {
+		if _, err := Store.StoreObject(row.metaData, []byte("data"), common.ReadyToSend, ""); err != nil {
 			t.Errorf("Failed to store object. Error: %s", err.Error())
 		}
 		notificationsInfo, err = PrepareObjectNotifications(row.metaData)
@@ -245,7 +245,7 @@ func TestActivateObjects(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		if _, err := Store.StoreObject(test.metaData, nil, common.ReadyToSend); err != nil {
+		if _, err := Store.StoreObject(test.metaData, nil, common.ReadyToSend, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 	}
@@ -0,0 +1,104 @@
+package communications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// callWebhooks posts the meta data of the object to the webhooks of its type. Each webhook is called in the background
+// according to the webhook retry policy of the type, so that an unavailable webhook doesn't delay the notifications.
+func callWebhooks(metaData *common.MetaData) {
+	webhooks, err := Store.RetrieveWebhooks(metaData.DestOrgID, metaData.ObjectType)
+	if err != nil {
+		return
+	}
+	body, err := json.MarshalIndent(metaData, "", "  ")
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in callWebhooks, failed to marshal meta data: %s\n", err)
+		}
+		return
+	}
+	policy := webhookRetryPolicy(metaData.DestOrgID, metaData.ObjectType)
+	for _, url := range webhooks {
+		go deliverWebhook(url, body, policy, *metaData)
+	}
+}
+
+// webhookRetryPolicy returns the webhook retry policy of the object type, or the policy set by the configuration
+// if the type doesn't have a policy
+func webhookRetryPolicy(orgID string, objectType string) common.WebhookRetryPolicy {
+	policy, err := Store.RetrieveWebhookRetryPolicy(orgID, objectType)
+	if err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in callWebhooks, failed to retrieve the webhook retry policy of %s:%s: %s\n", orgID, objectType, err)
+	}
+	if policy != nil {
+		return *policy
+	}
+	return common.WebhookRetryPolicy{OrgID: orgID, ObjectType: objectType,
+		Attempts: common.Configuration.WebhookRetryAttempts, Backoff: common.Configuration.WebhookRetryBackoff}
+}
+
+// deliverWebhook posts the body to the webhook, retrying according to the policy.
+// If all the attempts fail, the failure is recorded in the storage.
+func deliverWebhook(url string, body []byte, policy common.WebhookRetryPolicy, metaData common.MetaData) {
+	backoff := time.Duration(policy.Backoff) * time.Millisecond
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if err = postWebhook(url, body); err == nil {
+			return
+		}
+		if attempt >= policy.Attempts {
+			break
+		}
+		if log.IsLogging(logger.WARNING) {
+			log.Warning("Failed to post meta data to %s (attempt %d of %d), retrying in %s: %s\n", url, attempt,
+				policy.Attempts, backoff, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if log.IsLogging(logger.ERROR) {
+		log.Error("Error in callWebhooks, failed to post meta data to %s after %d attempts: %s\n", url, attempt, err)
+	}
+	failure := common.WebhookFailure{OrgID: metaData.DestOrgID, ObjectType: metaData.ObjectType, URL: url,
+		ObjectID: metaData.ObjectID, InstanceID: metaData.InstanceID, Attempts: attempt, Error: err.Error(),
+		Time: time.Now().UTC().Format(time.RFC3339)}
+	if err := Store.StoreWebhookFailure(failure); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in callWebhooks, failed to record the failure of %s: %s\n", url, err)
+	}
+}
+
+// postWebhook posts the body to the webhook once, the post fails after WebhookTimeout seconds
+func postWebhook(url string, body []byte) error {
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.ContentLength = int64(len(body))
+	request.Header.Add("Content-Type", "Application/JSON")
+
+	client := &http.Client{Timeout: time.Duration(common.Configuration.WebhookTimeout) * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("received status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package communications
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestDeliverWebhook(t *testing.T) {
+	Store = &storage.TestStorage{}
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	var requests int32
+	failing := int32(2)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= atomic.LoadInt32(&failing) {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "hooked", DestOrgID: "webhookorg", InstanceID: 5}
+	body := []byte("{}")
+
+	// The configuration's policy is used when the type doesn't have a policy
+	policy := webhookRetryPolicy(metaData.DestOrgID, metaData.ObjectType)
+	if policy.Attempts != common.Configuration.WebhookRetryAttempts || policy.Backoff != common.Configuration.WebhookRetryBackoff {
+		t.Errorf("The default webhook retry policy is %d attempts and %d backoff\n", policy.Attempts, policy.Backoff)
+	}
+	stored := common.WebhookRetryPolicy{OrgID: metaData.DestOrgID, ObjectType: metaData.ObjectType, Attempts: 3, Backoff: 1}
+	if err := Store.StoreWebhookRetryPolicy(stored); err != nil {
+		t.Errorf("Failed to store the webhook retry policy. Error: %s\n", err.Error())
+	}
+	policy = webhookRetryPolicy(metaData.DestOrgID, metaData.ObjectType)
+	if policy != stored {
+		t.Errorf("The webhook retry policy is %d attempts and %d backoff instead of 3 and 1\n", policy.Attempts, policy.Backoff)
+	}
+
+	// The webhook succeeds on the last attempt
+	deliverWebhook(server.URL, body, policy, metaData)
+	if count := atomic.LoadInt32(&requests); count != 3 {
+		t.Errorf("The webhook was called %d times instead of 3\n", count)
+	}
+	if failures, err := Store.RetrieveWebhookFailures(metaData.DestOrgID); err != nil || len(failures) != 0 {
+		t.Errorf("A failure was recorded for a delivered webhook: %v, %v\n", failures, err)
+	}
+
+	// The webhook fails on all the attempts
+	atomic.StoreInt32(&requests, 0)
+	policy.Attempts = 2
+	deliverWebhook(server.URL, body, policy, metaData)
+	if count := atomic.LoadInt32(&requests); count != 2 {
+		t.Errorf("The webhook was called %d times instead of 2\n", count)
+	}
+	failureRecords, err := Store.RetrieveWebhookFailures(metaData.DestOrgID)
+	if err != nil {
+		t.Errorf("Failed to retrieve the webhook failures. Error: %s\n", err.Error())
+	} else if len(failureRecords) != 1 {
+		t.Errorf("Retrieved %d webhook failures instead of 1\n", len(failureRecords))
+	} else {
+		failure := failureRecords[0]
+		if failure.URL != server.URL || failure.ObjectID != "1" || failure.InstanceID != 5 || failure.Attempts != 2 ||
+			failure.Error == "" || failure.Time == "" {
+			t.Errorf("Invalid webhook failure record: %#v\n", failure)
+		}
+	}
+
+	if err := Store.DeleteWebhookFailures(metaData.DestOrgID, metaData.ObjectType); err != nil {
+		t.Errorf("Failed to delete the webhook failures. Error: %s\n", err.Error())
+	}
+	if failures, err := Store.RetrieveWebhookFailures(metaData.DestOrgID); err != nil || len(failures) != 0 {
+		t.Errorf("Webhook failures weren't deleted: %v, %v\n", failures, err)
+	}
+}
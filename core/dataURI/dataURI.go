@@ -1,11 +1,11 @@
 package dataURI
 
 import (
-	"fmt"
 	"io"
 	"net/url"
-	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-utilities/logger"
@@ -21,41 +21,108 @@ func (e *Error) Error() string {
 	return e.message
 }
 
-// AppendData appends a chunk of data to the file stored at the given URI
-func AppendData(uri string, dataReader io.Reader, dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
-	if trace.IsLogging(logger.TRACE) {
-		trace.Trace("Storing data chunk at %s", uri)
-	}
+// PartialWriteError is the error returned by AppendData when only a part of the chunk was written.
+// The data up to Offset+Written is stored, so the write can be resumed from that offset.
+type PartialWriteError struct {
+	Offset  int64
+	Written int64
+	message string
+}
 
-	dataURI, err := url.Parse(uri)
-	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
-		return &Error{"Invalid data URI"}
-	}
+func (e *PartialWriteError) Error() string {
+	return e.message
+}
+
+// IsPartialWriteError returns true if the error is a PartialWriteError
+func IsPartialWriteError(err error) bool {
+	_, ok := err.(*PartialWriteError)
+	return ok
+}
+
+// Backend is the interface of the implementations of a data URI scheme.
+// Each backend is registered for one or more schemes with RegisterBackend.
+// The URI passed to the backend's functions is already parsed and its scheme is the registered scheme.
+type Backend interface {
+	// AppendData appends a chunk of data to the data stored at the given URI
+	AppendData(dataURI *url.URL, dataReader io.Reader, dataLength uint32, offset int64, total int64,
+		isFirstChunk bool, isLastChunk bool) common.SyncServiceError
+
+	// StoreData writes the data to the given URI and returns the number of bytes written
+	StoreData(dataURI *url.URL, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError)
+
+	// GetData retrieves the data stored at the given URI.
+	// After reading, the reader has to be closed if it implements io.Closer.
+	GetData(dataURI *url.URL) (io.Reader, common.SyncServiceError)
+
+	// GetDataChunk retrieves a chunk of the data stored at the given URI.
+	// Returns the chunk, whether the end of the data was reached, and the number of bytes read.
+	GetDataChunk(dataURI *url.URL, size int, offset int64) ([]byte, bool, int, common.SyncServiceError)
+
+	// GetDataSize returns the size of the data stored at the given URI
+	GetDataSize(dataURI *url.URL) (int64, common.SyncServiceError)
+
+	// Stat returns the size of the data stored at the given URI, whether it exists, and its modification time.
+	// The size is -1 if it is unknown, the modification time is zero if it is unknown.
+	Stat(dataURI *url.URL) (int64, bool, time.Time, common.SyncServiceError)
+
+	// DeleteStoredData deletes the data stored at the given URI
+	DeleteStoredData(dataURI *url.URL) common.SyncServiceError
+}
+
+// Copier is implemented by backends that can copy data between two URIs of the backend more efficiently
+// than by reading and writing the data
+type Copier interface {
+	CopyData(srcURI *url.URL, dstURI *url.URL) common.SyncServiceError
+}
+
+// Mover is implemented by backends that can move data between two URIs of the backend more efficiently
+// than by copying the data and deleting the source
+type Mover interface {
+	MoveData(srcURI *url.URL, dstURI *url.URL) common.SyncServiceError
+}
 
-	filePath := dataURI.Path + ".tmp"
-	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0600)
+var backends = map[string]Backend{
+	"file":  &fileBackend{},
+	"http":  &httpBackend{},
+	"https": &httpBackend{},
+}
+var backendsLock sync.RWMutex
+
+// RegisterBackend registers the backend of a data URI scheme, replacing the backend previously registered
+// for the scheme, if any. Schemes are case insensitive.
+func RegisterBackend(scheme string, backend Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	backends[strings.ToLower(scheme)] = backend
+}
+
+// getBackend parses the URI and returns the backend registered for its scheme
+func getBackend(uri string) (*url.URL, Backend, common.SyncServiceError) {
+	dataURI, err := url.Parse(uri)
 	if err != nil {
-		return common.CreateError(err, fmt.Sprintf("Failed to open file %s to append data. Error: ", dataURI.Path))
-	}
-	defer file.Close()
-	if _, err = file.Seek(offset, io.SeekStart); err != nil {
-		return &common.IOError{Message: fmt.Sprintf("Failed to seek to the offset %d of a file. Error: %s", offset, err.Error())}
+		return nil, nil, &Error{"Invalid data URI"}
 	}
 
-	written, err := io.Copy(file, dataReader)
-	if err != nil && err != io.EOF {
-		return &common.IOError{Message: "Failed to write to file. Error: " + err.Error()}
+	backendsLock.RLock()
+	backend, ok := backends[strings.ToLower(dataURI.Scheme)]
+	backendsLock.RUnlock()
+	if !ok {
+		return nil, nil, &Error{"Invalid data URI"}
 	}
-	if written != int64(dataLength) {
-		return &common.IOError{Message: "Failed to write all the data to file."}
+	return dataURI, backend, nil
+}
+
+// AppendData appends a chunk of data to the file stored at the given URI
+func AppendData(uri string, dataReader io.Reader, dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing data chunk at %s", uri)
 	}
 
-	if isLastChunk {
-		if err := os.Rename(filePath, dataURI.Path); err != nil {
-			return &common.IOError{Message: "Failed to rename data file. Error: " + err.Error()}
-		}
+	dataURI, backend, err := getBackend(uri)
+	if err != nil {
+		return err
 	}
-	return nil
+	return backend.AppendData(dataURI, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
 }
 
 // StoreData writes the data to the file stored at the given URI
@@ -63,110 +130,134 @@ func StoreData(uri string, dataReader io.Reader, dataLength uint32) (int64, comm
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Storing data at %s", uri)
 	}
-	dataURI, err := url.Parse(uri)
-	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
-		return 0, &Error{"Invalid data URI"}
-	}
 
-	filePath := dataURI.Path + ".tmp"
-	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0600)
+	dataURI, backend, err := getBackend(uri)
 	if err != nil {
-		return 0, common.CreateError(err, fmt.Sprintf("Failed to open file %s to write data. Error: ", dataURI.Path))
-	}
-	defer file.Close()
-
-	if _, err = file.Seek(0, io.SeekStart); err != nil {
-		return 0, &common.IOError{Message: "Failed to seek to the start of a file. Error: " + err.Error()}
-	}
-
-	written, err := io.Copy(file, dataReader)
-	if err != nil && err != io.EOF {
-		return 0, &common.IOError{Message: "Failed to write to file. Error: " + err.Error()}
+		return 0, err
 	}
-	if written != int64(dataLength) && dataLength != 0 {
-		return 0, &common.IOError{Message: "Failed to write all the data to file."}
-	}
-	if err := os.Rename(filePath, dataURI.Path); err != nil {
-		return 0, &common.IOError{Message: "Failed to rename data file. Error: " + err.Error()}
-	}
-	return written, nil
+	return backend.StoreData(dataURI, dataReader, dataLength)
 }
 
 // GetData retrieves the data stored at the given URI.
+// For an http(s) URI, the data is read from the body of the response to a GET request.
 // After reading, the reader has to be closed.
 func GetData(uri string) (io.Reader, common.SyncServiceError) {
-	dataURI, err := url.Parse(uri)
-	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
-		return nil, &Error{"Invalid data URI"}
+	dataURI, backend, err := getBackend(uri)
+	if err != nil {
+		return nil, err
 	}
 
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Retrieving data from %s", uri)
 	}
 
-	file, err := os.Open(dataURI.Path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, &common.NotFound{}
-		}
-		return nil, common.CreateError(err, fmt.Sprintf("Failed to open file %s to read data. Error: ", dataURI.Path))
-	}
-	return file, nil
+	return backend.GetData(dataURI)
 }
 
 // GetDataChunk retrieves the data stored at the given URI.
-// After reading, the reader has to be closed.
+// For an http(s) URI, the chunk is requested with a Range header.
+// The returned flag is true when the chunk ends at the end of the data, including an empty chunk
+// of empty data or at an offset at or beyond the end of the data. A chunk of size 0 before the end
+// of the data is not at the end.
 func GetDataChunk(uri string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
-	dataURI, err := url.Parse(uri)
-	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
-		return nil, false, 0, &Error{"Invalid data URI"}
+	dataURI, backend, err := getBackend(uri)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	if size < 0 || offset < 0 {
+		return nil, true, 0, &Error{"Invalid data chunk size or offset"}
 	}
 
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Retrieving data from %s", uri)
 	}
 
-	file, err := os.Open(dataURI.Path)
+	return backend.GetDataChunk(dataURI, size, offset)
+}
+
+// GetDataSize returns the size of the data stored at the given URI
+func GetDataSize(uri string) (int64, common.SyncServiceError) {
+	dataURI, backend, err := getBackend(uri)
+	if err != nil {
+		return 0, err
+	}
+	return backend.GetDataSize(dataURI)
+}
+
+// Stat returns the size of the data stored at the given URI, whether it exists, and its modification time,
+// without reading the data. Data that doesn't exist isn't an error.
+func Stat(uri string) (int64, bool, time.Time, common.SyncServiceError) {
+	dataURI, backend, err := getBackend(uri)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, true, 0, &common.NotFound{}
-		}
-		return nil, true, 0, common.CreateError(err, fmt.Sprintf("Failed to open file %s to read data. Error: ", dataURI.Path))
-	}
-	defer file.Close()
-
-	eof := false
-	result := make([]byte, size)
-	n, err := file.ReadAt(result, offset)
-	if n == size {
-		if err != nil { // This, most probably, can never happen when n == size, but the doc doesn't say it
-			return nil, true, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
-		}
-		var fi os.FileInfo
-		fi, err = file.Stat()
-		if err == nil && fi.Size() == offset+int64(size) {
-			eof = true
-		}
-	} else {
-		// err != nil is always true when n<size
-		if err == io.EOF {
-			eof = true
-		} else {
-			return nil, true, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
-		}
-	}
-
-	return result, eof, n, nil
+		return 0, false, time.Time{}, err
+	}
+	return backend.Stat(dataURI)
 }
 
 // DeleteStoredData deletes the data file stored at the given URI
 func DeleteStoredData(uri string) common.SyncServiceError {
-	dataURI, err := url.Parse(uri)
-	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
-		return &Error{"Invalid data URI"}
+	dataURI, backend, err := getBackend(uri)
+	if err != nil {
+		return err
+	}
+	return backend.DeleteStoredData(dataURI)
+}
+
+// Copy copies the data stored at the source URI to the destination URI, replacing the data stored at the destination URI.
+// The URIs may be of different backends, in which case the data is streamed from the source to the destination.
+func Copy(srcURI string, dstURI string) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Copying data from %s to %s", srcURI, dstURI)
+	}
+
+	src, srcBackend, err := getBackend(srcURI)
+	if err != nil {
+		return err
+	}
+	dst, dstBackend, err := getBackend(dstURI)
+	if err != nil {
+		return err
+	}
+	if copier, ok := srcBackend.(Copier); ok && srcBackend == dstBackend {
+		return copier.CopyData(src, dst)
+	}
+	return streamData(src, srcBackend, dst, dstBackend)
+}
+
+// Move moves the data stored at the source URI to the destination URI, replacing the data stored at the destination URI.
+// The URIs may be of different backends, in which case the data is streamed from the source to the destination
+// and then deleted from the source.
+func Move(srcURI string, dstURI string) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Moving data from %s to %s", srcURI, dstURI)
+	}
+
+	src, srcBackend, err := getBackend(srcURI)
+	if err != nil {
+		return err
+	}
+	dst, dstBackend, err := getBackend(dstURI)
+	if err != nil {
+		return err
+	}
+	if mover, ok := srcBackend.(Mover); ok && srcBackend == dstBackend {
+		return mover.MoveData(src, dst)
+	}
+	if err := streamData(src, srcBackend, dst, dstBackend); err != nil {
+		return err
+	}
+	return srcBackend.DeleteStoredData(src)
+}
+
+// streamData reads the data from the source backend and writes it to the destination backend
+func streamData(src *url.URL, srcBackend Backend, dst *url.URL, dstBackend Backend) common.SyncServiceError {
+	dataReader, err := srcBackend.GetData(src)
+	if err != nil {
+		return err
 	}
-	if err = os.Remove(dataURI.Path); err != nil && !os.IsNotExist(err) {
-		return &common.IOError{Message: "Failed to delete data. Error: " + err.Error()}
+	if closer, ok := dataReader.(io.Closer); ok {
+		defer closer.Close()
 	}
-	return nil
+	_, err = dstBackend.StoreData(dst, dataReader, 0)
+	return err
 }
@@ -2,8 +2,18 @@ package dataURI
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
 )
 
 func TestDataURI(t *testing.T) {
@@ -84,12 +94,20 @@ func TestDataURI(t *testing.T) {
 				}
 			}
 		}
+		if size, err := GetDataSize(row.uri); err != nil {
+			t.Errorf("Failed to get the size of stored data. Error: %s", err.Error())
+		} else if size != int64(len(row.data)) {
+			t.Errorf("Incorrect size of stored data: %d instead of %d", size, len(row.data))
+		}
 		if err = DeleteStoredData(row.uri); err != nil {
 			t.Errorf("Failed to delete stored data. Error: %s", err.Error())
 		} else {
 			if dataReader, err := GetData(row.uri); err == nil && dataReader != nil {
 				t.Errorf("Read from deleted data uri")
 			}
+			if _, err := GetDataSize(row.uri); err == nil {
+				t.Errorf("Got the size of deleted data uri")
+			}
 		}
 	}
 
@@ -179,3 +197,671 @@ func TestDataURI(t *testing.T) {
 		}
 	}
 }
+
+func TestHTTPDataURI(t *testing.T) {
+	common.Configuration.HTTPDataURITimeout = 10
+	common.Configuration.HTTPDataURIMaxRedirects = 1
+
+	data := "Hello world!"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/data", func(writer http.ResponseWriter, request *http.Request) {
+		http.ServeContent(writer, request, "data", time.Time{}, strings.NewReader(data))
+	})
+	mux.HandleFunc("/norange", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(data))
+	})
+	mux.HandleFunc("/redirect1", func(writer http.ResponseWriter, request *http.Request) {
+		http.Redirect(writer, request, "/data", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect2", func(writer http.ResponseWriter, request *http.Request) {
+		http.Redirect(writer, request, "/redirect1", http.StatusFound)
+	})
+	mux.HandleFunc("/forbidden", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, path := range []string{"/data", "/norange", "/redirect1"} {
+		dataReader, err := GetData(server.URL + path)
+		if err != nil {
+			t.Errorf("Failed to read from %s. Error: %s", path, err.Error())
+			continue
+		}
+		storedData, readErr := ioutil.ReadAll(dataReader)
+		if readErr != nil {
+			t.Errorf("Failed to read from %s. Error: %s", path, readErr.Error())
+		} else if string(storedData) != data {
+			t.Errorf("Read incorrect data from %s: %s instead of %s", path, string(storedData), data)
+		}
+		if closer, ok := dataReader.(interface{ Close() error }); !ok {
+			t.Errorf("The reader of %s can't be closed", path)
+		} else {
+			closer.Close()
+		}
+
+		for i := 0; ; i += 5 {
+			chunk, eof, n, err := GetDataChunk(server.URL+path, 5, int64(i))
+			if err != nil {
+				t.Errorf("Failed to read chunk from %s. Error: %s", path, err.Error())
+				break
+			}
+			if eof != (i+5 >= len(data)) {
+				t.Errorf("GetDataChunk of %s at offset %d returned eof=%t", path, i, eof)
+			}
+			if string(chunk[:n]) != data[i:i+n] {
+				t.Errorf("Read incorrect data from %s: %s instead of %s", path, string(chunk[:n]), data[i:i+n])
+			}
+			if eof || i > len(data) {
+				break
+			}
+		}
+	}
+
+	if _, err := GetData(server.URL + "/redirect2"); err == nil {
+		t.Errorf("Followed more redirects than the limit")
+	}
+	if _, err := GetData(server.URL + "/missing"); !common.IsNotFound(err) {
+		t.Errorf("Reading a missing URI didn't return NotFound. Error: %v", err)
+	}
+	if _, err := GetData(server.URL + "/forbidden"); err == nil {
+		t.Errorf("Read from a forbidden URI")
+	} else if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Reading a forbidden URI returned an incorrect error: %s", err.Error())
+	}
+
+	if _, err := StoreData(server.URL+"/data", bytes.NewReader([]byte(data)), uint32(len(data))); err == nil {
+		t.Errorf("Stored data in an http data URI")
+	}
+	if err := AppendData(server.URL+"/data", bytes.NewReader([]byte(data)), uint32(len(data)), 0, 0, true, true); err == nil {
+		t.Errorf("Appended data to an http data URI")
+	}
+}
+
+type memoryBackend struct {
+	data map[string][]byte
+}
+
+func (backend *memoryBackend) AppendData(dataURI *url.URL, dataReader io.Reader, dataLength uint32, offset int64, total int64,
+	isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	return &Error{"Not supported"}
+}
+
+func (backend *memoryBackend) StoreData(dataURI *url.URL, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError) {
+	data, err := ioutil.ReadAll(dataReader)
+	if err != nil {
+		return 0, &common.IOError{Message: err.Error()}
+	}
+	backend.data[dataURI.Host+dataURI.Path] = data
+	return int64(len(data)), nil
+}
+
+func (backend *memoryBackend) GetData(dataURI *url.URL) (io.Reader, common.SyncServiceError) {
+	data, ok := backend.data[dataURI.Host+dataURI.Path]
+	if !ok {
+		return nil, &common.NotFound{}
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (backend *memoryBackend) GetDataChunk(dataURI *url.URL, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	return nil, true, 0, &Error{"Not supported"}
+}
+
+func (backend *memoryBackend) GetDataSize(dataURI *url.URL) (int64, common.SyncServiceError) {
+	return int64(len(backend.data[dataURI.Host+dataURI.Path])), nil
+}
+
+func (backend *memoryBackend) Stat(dataURI *url.URL) (int64, bool, time.Time, common.SyncServiceError) {
+	data, ok := backend.data[dataURI.Host+dataURI.Path]
+	return int64(len(data)), ok, time.Time{}, nil
+}
+
+func (backend *memoryBackend) DeleteStoredData(dataURI *url.URL) common.SyncServiceError {
+	delete(backend.data, dataURI.Host+dataURI.Path)
+	return nil
+}
+
+func TestRegisterBackend(t *testing.T) {
+	uri := "mem://bucket/object1"
+	if _, err := StoreData(uri, bytes.NewReader([]byte("hello")), 5); err == nil {
+		t.Errorf("Stored data in a data URI with an unregistered scheme")
+	}
+
+	RegisterBackend("MEM", &memoryBackend{data: make(map[string][]byte)})
+
+	if written, err := StoreData(uri, bytes.NewReader([]byte("hello")), 5); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	} else if written != 5 {
+		t.Errorf("Incorrect length of written data: %d instead of 5", written)
+	}
+	if dataReader, err := GetData(uri); err != nil {
+		t.Errorf("Failed to read from data uri. Error: %s", err.Error())
+	} else if data, _ := ioutil.ReadAll(dataReader); string(data) != "hello" {
+		t.Errorf("Read incorrect data: %s instead of hello", string(data))
+	}
+	if size, err := GetDataSize(uri); err != nil || size != 5 {
+		t.Errorf("Incorrect size of stored data: %d instead of 5", size)
+	}
+	if err := DeleteStoredData(uri); err != nil {
+		t.Errorf("Failed to delete stored data. Error: %s", err.Error())
+	}
+	if _, err := GetData(uri); !common.IsNotFound(err) {
+		t.Errorf("Read from deleted data uri")
+	}
+}
+
+func TestDataURIDeduplication(t *testing.T) {
+	common.Configuration.DataURIDeduplication = true
+	defer func() { common.Configuration.DataURIDeduplication = false }()
+
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	blobDir := filepath.Join(dir, blobsDirectory)
+
+	countBlobs := func() int {
+		blobs, _ := ioutil.ReadDir(blobDir)
+		return len(blobs)
+	}
+
+	uri1 := "file://" + dir + "/object1"
+	uri2 := "file://" + dir + "/object2"
+	uri3 := "file://" + dir + "/object3"
+	if _, err := StoreData(uri1, bytes.NewReader([]byte("hello")), 5); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	if _, err := StoreData(uri2, bytes.NewReader([]byte("hello")), 5); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	if err := AppendData(uri3, bytes.NewReader([]byte("hello")), 5, 0, 5, true, true); err != nil {
+		t.Errorf("Failed to append to data uri. Error: %s", err.Error())
+	}
+	if n := countBlobs(); n != 1 {
+		t.Errorf("Identical data is stored in %d blobs instead of 1", n)
+	}
+
+	fileInfo1, _ := os.Stat(dir + "/object1")
+	fileInfo2, _ := os.Stat(dir + "/object2")
+	if fileInfo1 == nil || fileInfo2 == nil || !os.SameFile(fileInfo1, fileInfo2) {
+		t.Errorf("Identical data is not shared")
+	}
+
+	// Storing the same data again doesn't change the references
+	if _, err := StoreData(uri1, bytes.NewReader([]byte("hello")), 5); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	// Replacing the data of a data URI releases its reference to the previous blob
+	if _, err := StoreData(uri3, bytes.NewReader([]byte("world")), 5); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	if n := countBlobs(); n != 2 {
+		t.Errorf("Different data is stored in %d blobs instead of 2", n)
+	}
+
+	if err := DeleteStoredData(uri1); err != nil {
+		t.Errorf("Failed to delete stored data. Error: %s", err.Error())
+	}
+	if n := countBlobs(); n != 2 {
+		t.Errorf("Deleted a referenced blob, %d blobs left instead of 2", n)
+	}
+	if dataReader, err := GetData(uri2); err != nil {
+		t.Errorf("Failed to read from data uri. Error: %s", err.Error())
+	} else {
+		data, _ := ioutil.ReadAll(dataReader)
+		dataReader.(*os.File).Close()
+		if string(data) != "hello" {
+			t.Errorf("Read incorrect data: %s instead of hello", string(data))
+		}
+	}
+
+	if err := DeleteStoredData(uri2); err != nil {
+		t.Errorf("Failed to delete stored data. Error: %s", err.Error())
+	}
+	if err := DeleteStoredData(uri3); err != nil {
+		t.Errorf("Failed to delete stored data. Error: %s", err.Error())
+	}
+	if n := countBlobs(); n != 0 {
+		t.Errorf("%d unreferenced blobs were not deleted", n)
+	}
+}
+
+func TestDataURIFsync(t *testing.T) {
+	common.Configuration.DataURIFsync = true
+	defer func() { common.Configuration.DataURIFsync = false }()
+
+	dir, err := ioutil.TempDir("", "fsync")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	uri1 := "file://" + dir + "/object1"
+	uri2 := "file://" + dir + "/object2"
+	if _, err := StoreData(uri1, bytes.NewReader([]byte("hello")), 5); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	if err := AppendData(uri2, bytes.NewReader([]byte("hello")), 5, 0, 5, true, true); err != nil {
+		t.Errorf("Failed to append to data uri. Error: %s", err.Error())
+	}
+	for _, uri := range []string{uri1, uri2} {
+		if size, err := GetDataSize(uri); err != nil {
+			t.Errorf("Failed to get the size of stored data. Error: %s", err.Error())
+		} else if size != 5 {
+			t.Errorf("Incorrect size of stored data: %d instead of 5", size)
+		}
+	}
+}
+
+func TestDataURISharding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sharding")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// A file stored before the directory is sharded is moved to its shard
+	if err := ioutil.WriteFile(dir+"/object1", []byte("hello"), 0600); err != nil {
+		t.Fatalf("Failed to write a file. Error: %s", err.Error())
+	}
+	if err := AddShardedDirectory(dir); err != nil {
+		t.Fatalf("Failed to shard the directory. Error: %s", err.Error())
+	}
+	if _, err := os.Stat(dir + "/object1"); !os.IsNotExist(err) {
+		t.Errorf("The file was not moved to its shard")
+	}
+	if _, err := os.Stat(filepath.Join(dir, shardOf("object1"), "object1")); err != nil {
+		t.Errorf("The file was not moved to its shard. Error: %s", err.Error())
+	}
+
+	uri1 := "file://" + dir + "/object1"
+	uri2 := "file://" + dir + "/object2"
+	if err := AppendData(uri2, bytes.NewReader([]byte("hello")), 5, 0, 11, true, false); err != nil {
+		t.Errorf("Failed to append to data uri. Error: %s", err.Error())
+	}
+	if err := AppendData(uri2, bytes.NewReader([]byte(" world")), 6, 5, 11, false, true); err != nil {
+		t.Errorf("Failed to append to data uri. Error: %s", err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(dir, shardOf("object2"), "object2")); err != nil {
+		t.Errorf("The file was not stored in its shard. Error: %s", err.Error())
+	}
+
+	for _, uri := range []string{uri1, uri2} {
+		if dataReader, err := GetData(uri); err != nil {
+			t.Errorf("Failed to read from data uri. Error: %s", err.Error())
+		} else {
+			dataReader.(*os.File).Close()
+		}
+		if _, _, n, err := GetDataChunk(uri, 5, 0); err != nil || n != 5 {
+			t.Errorf("Failed to read a chunk from data uri. Error: %v", err)
+		}
+		if err := DeleteStoredData(uri); err != nil {
+			t.Errorf("Failed to delete stored data. Error: %s", err.Error())
+		}
+		if _, err := GetDataSize(uri); !common.IsNotFound(err) {
+			t.Errorf("Got the size of deleted data uri")
+		}
+	}
+}
+
+func TestDataURIReadAhead(t *testing.T) {
+	common.Configuration.DataURIReadAheadSize = 8
+	defer func() { common.Configuration.DataURIReadAheadSize = 0 }()
+
+	dir, err := ioutil.TempDir("", "readahead")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	uri := "file://" + dir + "/object1"
+	data := "Hello world, hello again!"
+	if _, err := StoreData(uri, strings.NewReader(data), uint32(len(data))); err != nil {
+		t.Fatalf("Failed to store in data uri. Error: %s", err.Error())
+	}
+
+	// Sequential reads, a read backwards, and a read of a chunk larger than the read-ahead
+	offsets := []int64{0, 3, 6, 9, 2, 5, 20}
+	sizes := []int{3, 3, 3, 3, 3, 10, 10}
+	for i, offset := range offsets {
+		chunk, eof, n, err := GetDataChunk(uri, sizes[i], offset)
+		if err != nil {
+			t.Errorf("Failed to read chunk from data uri. Error: %s", err.Error())
+			continue
+		}
+		end := offset + int64(sizes[i])
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		if string(chunk[:n]) != data[offset:end] {
+			t.Errorf("Read incorrect data at offset %d: %s instead of %s", offset, string(chunk[:n]), data[offset:end])
+		}
+		if eof != (end == int64(len(data))) {
+			t.Errorf("GetDataChunk at offset %d returned eof=%t", offset, eof)
+		}
+	}
+
+	// The reader is invalidated when the data is replaced
+	if _, _, _, err := GetDataChunk(uri, 3, 0); err != nil {
+		t.Errorf("Failed to read chunk from data uri. Error: %s", err.Error())
+	}
+	if _, err := StoreData(uri, strings.NewReader("Goodbye"), 7); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	if chunk, eof, n, err := GetDataChunk(uri, 7, 0); err != nil {
+		t.Errorf("Failed to read chunk from data uri. Error: %s", err.Error())
+	} else if string(chunk[:n]) != "Goodbye" || !eof {
+		t.Errorf("Read stale data after the data was replaced: %s", string(chunk[:n]))
+	}
+
+	if _, _, _, err := GetDataChunk(uri, 3, 0); err != nil {
+		t.Errorf("Failed to read chunk from data uri. Error: %s", err.Error())
+	}
+	CloseReadAhead(uri)
+	readAheadLock.Lock()
+	if len(readAheadReaders) != 0 {
+		t.Errorf("The read-ahead reader was not closed")
+	}
+	readAheadLock.Unlock()
+}
+
+func TestGetDataChunkBoundaries(t *testing.T) {
+	common.Configuration.HTTPDataURITimeout = 10
+
+	dir, err := ioutil.TempDir("", "boundaries")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	data := "Hello"
+	if err := ioutil.WriteFile(dir+"/empty", []byte{}, 0600); err != nil {
+		t.Fatalf("Failed to write a file. Error: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(dir+"/data", []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write a file. Error: %s", err.Error())
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		size   int
+		offset int64
+		n      int
+		eof    bool
+	}{
+		{"empty", 5, 0, 0, true},
+		{"empty", 0, 0, 0, true},
+		{"data", 5, 0, 5, true},
+		{"data", 10, 0, 5, true},
+		{"data", 3, 0, 3, false},
+		{"data", 2, 3, 2, true},
+		{"data", 3, 5, 0, true},
+		{"data", 3, 7, 0, true},
+		{"data", 0, 2, 0, false},
+		{"data", 0, 5, 0, true},
+	}
+
+	for _, readAhead := range []int{0, 4} {
+		common.Configuration.DataURIReadAheadSize = readAhead
+		for _, prefix := range []string{"file://" + dir + "/", server.URL + "/"} {
+			if readAhead > 0 && !strings.HasPrefix(prefix, "file") {
+				continue
+			}
+			for _, test := range tests {
+				uri := prefix + test.name
+				chunk, eof, n, err := GetDataChunk(uri, test.size, test.offset)
+				if err != nil {
+					t.Errorf("Failed to read %d bytes at offset %d of %s. Error: %s", test.size, test.offset, uri, err.Error())
+					continue
+				}
+				if n != test.n || eof != test.eof {
+					t.Errorf("Read of %d bytes at offset %d of %s returned n=%d, eof=%t instead of n=%d, eof=%t",
+						test.size, test.offset, uri, n, eof, test.n, test.eof)
+				}
+				if n > 0 && string(chunk[:n]) != data[test.offset:test.offset+int64(n)] {
+					t.Errorf("Read incorrect data from %s: %s", uri, string(chunk[:n]))
+				}
+			}
+		}
+	}
+	common.Configuration.DataURIReadAheadSize = 0
+
+	if _, _, _, err := GetDataChunk("file://"+dir+"/data", -1, 0); err == nil {
+		t.Errorf("Read a chunk of negative size")
+	}
+	if _, _, _, err := GetDataChunk("file://"+dir+"/data", 1, -1); err == nil {
+		t.Errorf("Read a chunk at a negative offset")
+	}
+}
+
+func TestDataURITempDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// Prefer a temporary directory on another file system, to test moving files across file systems
+	tempRoot := ""
+	if _, err := os.Stat("/dev/shm"); err == nil {
+		tempRoot = "/dev/shm"
+	}
+	tempDir, err := ioutil.TempDir(tempRoot, "temp")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(tempDir)
+
+	common.Configuration.DataURITempDirectory = tempDir
+	defer func() { common.Configuration.DataURITempDirectory = "" }()
+
+	uri := "file://" + dir + "/object1"
+	if err := AppendData(uri, bytes.NewReader([]byte("Hello")), 5, 0, 11, true, false); err != nil {
+		t.Errorf("Failed to append to data uri. Error: %s", err.Error())
+	}
+	if _, err := os.Stat(dir + "/object1.tmp"); !os.IsNotExist(err) {
+		t.Errorf("The temporary file was written next to the data file")
+	}
+	if chunk, _, n, err := GetDataChunk(uri+".tmp", 5, 0); err != nil {
+		t.Errorf("Failed to read the temporary data. Error: %s", err.Error())
+	} else if string(chunk[:n]) != "Hello" {
+		t.Errorf("Read incorrect temporary data: %s instead of Hello", string(chunk[:n]))
+	}
+	if err := AppendData(uri, bytes.NewReader([]byte(" world")), 6, 5, 11, false, true); err != nil {
+		t.Errorf("Failed to append to data uri. Error: %s", err.Error())
+	}
+	if data, err := ioutil.ReadFile(dir + "/object1"); err != nil {
+		t.Errorf("Failed to read the data file. Error: %s", err.Error())
+	} else if string(data) != "Hello world" {
+		t.Errorf("Read incorrect data: %s instead of Hello world", string(data))
+	}
+
+	if _, err := StoreData(uri, bytes.NewReader([]byte("Goodbye")), 7); err != nil {
+		t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+	}
+	if data, err := ioutil.ReadFile(dir + "/object1"); err != nil {
+		t.Errorf("Failed to read the data file. Error: %s", err.Error())
+	} else if string(data) != "Goodbye" {
+		t.Errorf("Read incorrect data: %s instead of Goodbye", string(data))
+	}
+
+	if files, _ := ioutil.ReadDir(tempDir); len(files) != 0 {
+		t.Errorf("%d temporary files were left in the temporary directory", len(files))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files are in the data directory instead of 1", len(files))
+	}
+}
+
+func TestDataURIStat(t *testing.T) {
+	common.Configuration.HTTPDataURITimeout = 10
+
+	dir, err := ioutil.TempDir("", "stat")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(dir+"/data", []byte("Hello"), 0600); err != nil {
+		t.Fatalf("Failed to write a file. Error: %s", err.Error())
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(dir+"/data", modTime, modTime); err != nil {
+		t.Fatalf("Failed to set the modification time of a file. Error: %s", err.Error())
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	for _, prefix := range []string{"file://" + dir + "/", server.URL + "/"} {
+		size, exists, fileModTime, err := Stat(prefix + "data")
+		if err != nil {
+			t.Errorf("Failed to stat %sdata. Error: %s", prefix, err.Error())
+		} else if !exists || size != 5 || !fileModTime.Equal(modTime) {
+			t.Errorf("Stat of %sdata returned size=%d, exists=%t, modTime=%s", prefix, size, exists, fileModTime)
+		}
+
+		if _, exists, _, err := Stat(prefix + "missing"); err != nil {
+			t.Errorf("Failed to stat %smissing. Error: %s", prefix, err.Error())
+		} else if exists {
+			t.Errorf("Stat of %smissing returned that it exists", prefix)
+		}
+	}
+
+	if size, err := GetDataSize(server.URL + "/data"); err != nil || size != 5 {
+		t.Errorf("GetDataSize of an http data URI returned %d. Error: %v", size, err)
+	}
+}
+
+type failingReader struct {
+	data []byte
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	if len(reader.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, reader.data)
+	reader.data = reader.data[n:]
+	return n, nil
+}
+
+func TestAppendDataPartialWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "partial")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	uri := "file://" + dir + "/object1"
+	if err := AppendData(uri, strings.NewReader("Hello"), 5, 0, 11, true, false); err != nil {
+		t.Errorf("Failed to append to data uri. Error: %s", err.Error())
+	}
+
+	// The connection fails after two bytes of the chunk
+	err = AppendData(uri, &failingReader{[]byte(" w")}, 6, 5, 11, false, true)
+	if partialErr, ok := err.(*PartialWriteError); !ok {
+		t.Errorf("AppendData didn't return a PartialWriteError. Error: %v", err)
+	} else if partialErr.Offset != 5 || partialErr.Written != 2 {
+		t.Errorf("AppendData returned offset=%d, written=%d instead of 5, 2", partialErr.Offset, partialErr.Written)
+	}
+
+	// A short chunk
+	err = AppendData(uri, strings.NewReader("or"), 4, 7, 11, false, true)
+	if partialErr, ok := err.(*PartialWriteError); !ok {
+		t.Errorf("AppendData didn't return a PartialWriteError. Error: %v", err)
+	} else if partialErr.Offset != 7 || partialErr.Written != 2 {
+		t.Errorf("AppendData returned offset=%d, written=%d instead of 7, 2", partialErr.Offset, partialErr.Written)
+	}
+
+	// Resume from the reported offset
+	if err := AppendData(uri, strings.NewReader("ld"), 2, 9, 11, false, true); err != nil {
+		t.Errorf("Failed to append to data uri. Error: %s", err.Error())
+	}
+	if data, err := ioutil.ReadFile(dir + "/object1"); err != nil {
+		t.Errorf("Failed to read the data file. Error: %s", err.Error())
+	} else if string(data) != "Hello world" {
+		t.Errorf("Read incorrect data: %s instead of Hello world", string(data))
+	}
+}
+
+func TestDataURICopyAndMove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copy")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	readData := func(uri string) string {
+		dataReader, err := GetData(uri)
+		if err != nil {
+			return ""
+		}
+		defer dataReader.(io.Closer).Close()
+		data, _ := ioutil.ReadAll(dataReader)
+		return string(data)
+	}
+
+	for _, dedup := range []bool{false, true} {
+		common.Configuration.DataURIDeduplication = dedup
+
+		uri1 := "file://" + dir + "/object1"
+		uri2 := "file://" + dir + "/object2"
+		uri3 := "file://" + dir + "/object3"
+		if _, err := StoreData(uri1, strings.NewReader("hello"), 5); err != nil {
+			t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+		}
+		if _, err := StoreData(uri3, strings.NewReader("world"), 5); err != nil {
+			t.Errorf("Failed to store in data uri. Error: %s", err.Error())
+		}
+
+		if err := Copy(uri1, uri2); err != nil {
+			t.Errorf("Failed to copy data. Error: %s", err.Error())
+		}
+		if readData(uri1) != "hello" || readData(uri2) != "hello" {
+			t.Errorf("Incorrect data after copy: %s, %s", readData(uri1), readData(uri2))
+		}
+
+		// Moving replaces the data of the destination
+		if err := Move(uri2, uri3); err != nil {
+			t.Errorf("Failed to move data. Error: %s", err.Error())
+		}
+		if _, exists, _, _ := Stat(uri2); exists {
+			t.Errorf("The source of the move still exists")
+		}
+		if readData(uri3) != "hello" {
+			t.Errorf("Incorrect data after move: %s", readData(uri3))
+		}
+
+		if err := Move(uri2, uri3); !common.IsNotFound(err) {
+			t.Errorf("Moving missing data didn't return NotFound. Error: %v", err)
+		}
+
+		// Copy between backends
+		memory := &memoryBackend{data: make(map[string][]byte)}
+		RegisterBackend("mem", memory)
+		if err := Copy(uri1, "mem://bucket/object1"); err != nil {
+			t.Errorf("Failed to copy data between backends. Error: %s", err.Error())
+		} else if string(memory.data["bucket/object1"]) != "hello" {
+			t.Errorf("Incorrect data after copy between backends: %s", string(memory.data["bucket/object1"]))
+		}
+		if err := Move("mem://bucket/object1", uri2); err != nil {
+			t.Errorf("Failed to move data between backends. Error: %s", err.Error())
+		} else if readData(uri2) != "hello" || len(memory.data) != 0 {
+			t.Errorf("Incorrect data after move between backends: %s", readData(uri2))
+		}
+
+		for _, uri := range []string{uri1, uri2, uri3} {
+			if err := DeleteStoredData(uri); err != nil {
+				t.Errorf("Failed to delete stored data. Error: %s", err.Error())
+			}
+		}
+		if blobs, _ := ioutil.ReadDir(filepath.Join(dir, blobsDirectory)); len(blobs) != 0 {
+			t.Errorf("%d unreferenced blobs were not deleted", len(blobs))
+		}
+	}
+	common.Configuration.DataURIDeduplication = false
+}
@@ -0,0 +1,253 @@
+package dataURI
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// fileBackend is the backend of file data URIs, the data is stored in the file at the path of the URI
+type fileBackend struct{}
+
+// AppendData appends a chunk of data to the file stored at the given URI
+func (backend *fileBackend) AppendData(dataURI *url.URL, dataReader io.Reader, dataLength uint32, offset int64, total int64,
+	isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	if err := createShardDirectory(dataURI.Path); err != nil {
+		return err
+	}
+	if err := createTempDirectory(); err != nil {
+		return err
+	}
+	path := shardedPath(dataURI.Path)
+	tmpPath := tempPath(path)
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return common.CreateError(err, fmt.Sprintf("Failed to open file %s to append data. Error: ", dataURI.Path))
+	}
+	defer file.Close()
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return &common.IOError{Message: fmt.Sprintf("Failed to seek to the offset %d of a file. Error: %s", offset, err.Error())}
+	}
+
+	written, err := io.Copy(file, dataReader)
+	if err != nil && err != io.EOF {
+		return &PartialWriteError{offset, written, "Failed to write to file. Error: " + err.Error()}
+	}
+	if written < int64(dataLength) {
+		return &PartialWriteError{offset, written, "Failed to write all the data to file."}
+	}
+	if written != int64(dataLength) {
+		return &common.IOError{Message: "Failed to write all the data to file."}
+	}
+
+	if isLastChunk {
+		if err := syncFile(file); err != nil {
+			return err
+		}
+		return commitFile(tmpPath, path)
+	}
+	return nil
+}
+
+// StoreData writes the data to the file stored at the given URI
+func (backend *fileBackend) StoreData(dataURI *url.URL, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError) {
+	if err := createShardDirectory(dataURI.Path); err != nil {
+		return 0, err
+	}
+	if err := createTempDirectory(); err != nil {
+		return 0, err
+	}
+	path := shardedPath(dataURI.Path)
+	tmpPath := tempPath(path)
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, common.CreateError(err, fmt.Sprintf("Failed to open file %s to write data. Error: ", dataURI.Path))
+	}
+	defer file.Close()
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return 0, &common.IOError{Message: "Failed to seek to the start of a file. Error: " + err.Error()}
+	}
+
+	written, err := io.Copy(file, dataReader)
+	if err != nil && err != io.EOF {
+		return 0, &common.IOError{Message: "Failed to write to file. Error: " + err.Error()}
+	}
+	if written != int64(dataLength) && dataLength != 0 {
+		return 0, &common.IOError{Message: "Failed to write all the data to file."}
+	}
+	if err := syncFile(file); err != nil {
+		return 0, err
+	}
+	if err := commitFile(tmpPath, path); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// GetData retrieves the data stored at the given URI
+func (backend *fileBackend) GetData(dataURI *url.URL) (io.Reader, common.SyncServiceError) {
+	file, err := os.Open(filePath(dataURI.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &common.NotFound{}
+		}
+		return nil, common.CreateError(err, fmt.Sprintf("Failed to open file %s to read data. Error: ", dataURI.Path))
+	}
+	return file, nil
+}
+
+// GetDataChunk retrieves a chunk of the data stored at the given URI
+func (backend *fileBackend) GetDataChunk(dataURI *url.URL, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	if common.Configuration.DataURIReadAheadSize > 0 {
+		return readChunkAhead(filePath(dataURI.Path), size, offset)
+	}
+
+	file, err := os.Open(filePath(dataURI.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, true, 0, &common.NotFound{}
+		}
+		return nil, true, 0, common.CreateError(err, fmt.Sprintf("Failed to open file %s to read data. Error: ", dataURI.Path))
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, true, 0, &common.IOError{Message: "Failed to stat data file. Error: " + err.Error()}
+	}
+
+	result := make([]byte, size)
+	if offset >= fi.Size() {
+		return result, true, 0, nil
+	}
+
+	// ReadAt returns io.EOF when it reads less than the size of the chunk,
+	// and may return either nil or io.EOF when the chunk ends exactly at the end of the file
+	n, err := file.ReadAt(result, offset)
+	if err != nil && err != io.EOF {
+		return nil, true, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+	}
+	eof := err == io.EOF || offset+int64(n) >= fi.Size()
+
+	return result, eof, n, nil
+}
+
+// GetDataSize returns the size of the data stored at the given URI
+func (backend *fileBackend) GetDataSize(dataURI *url.URL) (int64, common.SyncServiceError) {
+	fi, err := os.Stat(filePath(dataURI.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, &common.NotFound{}
+		}
+		return 0, common.CreateError(err, fmt.Sprintf("Failed to stat file %s. Error: ", dataURI.Path))
+	}
+	return fi.Size(), nil
+}
+
+// Stat returns the size of the file stored at the given URI, whether it exists, and its modification time
+func (backend *fileBackend) Stat(dataURI *url.URL) (int64, bool, time.Time, common.SyncServiceError) {
+	fi, err := os.Stat(filePath(dataURI.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, time.Time{}, nil
+		}
+		return 0, false, time.Time{}, common.CreateError(err, fmt.Sprintf("Failed to stat file %s. Error: ", dataURI.Path))
+	}
+	return fi.Size(), true, fi.ModTime(), nil
+}
+
+// DeleteStoredData deletes the data file stored at the given URI
+func (backend *fileBackend) DeleteStoredData(dataURI *url.URL) common.SyncServiceError {
+	return removeFile(filePath(dataURI.Path))
+}
+
+// syncFile flushes the written data of the file to the disk, if DataURIFsync is set
+func syncFile(file *os.File) common.SyncServiceError {
+	if !common.Configuration.DataURIFsync {
+		return nil
+	}
+	if err := file.Sync(); err != nil {
+		return &common.IOError{Message: "Failed to sync data file. Error: " + err.Error()}
+	}
+	return nil
+}
+
+// syncDirectory flushes the entries of the directory, such as a renamed file, to the disk, if DataURIFsync is set
+func syncDirectory(path string) common.SyncServiceError {
+	if !common.Configuration.DataURIFsync {
+		return nil
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return &common.IOError{Message: "Failed to open data directory to sync it. Error: " + err.Error()}
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return &common.IOError{Message: "Failed to sync data directory. Error: " + err.Error()}
+	}
+	return nil
+}
+
+// CopyData copies the file stored at the source URI to the destination URI
+func (backend *fileBackend) CopyData(srcURI *url.URL, dstURI *url.URL) common.SyncServiceError {
+	if err := createShardDirectory(dstURI.Path); err != nil {
+		return err
+	}
+	if err := createTempDirectory(); err != nil {
+		return err
+	}
+	path := shardedPath(dstURI.Path)
+	tmpPath := tempPath(path)
+	if err := copyFile(filePath(srcURI.Path), tmpPath); err != nil {
+		os.Remove(tmpPath)
+		if os.IsNotExist(err) {
+			return &common.NotFound{}
+		}
+		return &common.IOError{Message: fmt.Sprintf("Failed to copy file %s to %s. Error: %s", srcURI.Path, dstURI.Path, err)}
+	}
+	return commitFile(tmpPath, path)
+}
+
+// MoveData renames the file stored at the source URI to the destination URI
+func (backend *fileBackend) MoveData(srcURI *url.URL, dstURI *url.URL) common.SyncServiceError {
+	if err := createShardDirectory(dstURI.Path); err != nil {
+		return err
+	}
+	srcPath := filePath(srcURI.Path)
+	dstPath := filePath(dstURI.Path)
+	closeReadAhead(srcPath)
+	closeReadAhead(dstPath)
+
+	fileInfo, err := os.Stat(srcPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &common.NotFound{}
+		}
+		return &common.IOError{Message: fmt.Sprintf("Failed to stat file %s. Error: %s", srcURI.Path, err)}
+	}
+	if linkCount(fileInfo) > 1 && dataDirectory(srcPath) != dataDirectory(dstPath) {
+		// The file references a blob of its directory, the destination must reference a blob of its own directory
+		if err := backend.CopyData(srcURI, dstURI); err != nil {
+			return err
+		}
+		return backend.DeleteStoredData(srcURI)
+	}
+
+	dedupLock.Lock()
+	defer dedupLock.Unlock()
+
+	// The destination may reference a blob that must be released
+	if err := releaseFile(dstPath); err != nil {
+		return &common.IOError{Message: "Failed to replace data file. Error: " + err.Error()}
+	}
+	if err := moveFile(srcPath, dstPath); err != nil {
+		return &common.IOError{Message: fmt.Sprintf("Failed to move file %s to %s. Error: %s", srcURI.Path, dstURI.Path, err)}
+	}
+	return syncDirectory(filepath.Dir(dstPath))
+}
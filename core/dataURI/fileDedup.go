@@ -0,0 +1,159 @@
+package dataURI
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// When data deduplication is enabled, the data of a file data URI is stored in a blob, a file named by
+// the hash of the data in the .blobs subdirectory of the data URI's directory (also when the directory is sharded), and the file of the data URI
+// is a hard link to the blob. The blob is referenced by the data URIs linked to it, so its link count is
+// the number of references plus one. When the file of the last data URI is removed, the blob is removed too.
+const blobsDirectory = ".blobs"
+
+var dedupLock sync.Mutex
+
+// commitFile moves the data written to the temporary file to the file of the data URI.
+// When data deduplication is enabled, the data is moved to the blob of its content, unless there is
+// such a blob already, and the file of the data URI is linked to the blob.
+func commitFile(tmpPath string, path string) common.SyncServiceError {
+	closeReadAhead(path)
+
+	if !common.Configuration.DataURIDeduplication {
+		if err := moveFile(tmpPath, path); err != nil {
+			return &common.IOError{Message: "Failed to rename data file. Error: " + err.Error()}
+		}
+		return syncDirectory(filepath.Dir(path))
+	}
+
+	hash, err := hashFile(tmpPath)
+	if err != nil {
+		return &common.IOError{Message: "Failed to hash data file. Error: " + err.Error()}
+	}
+	blobDir := filepath.Join(dataDirectory(path), blobsDirectory)
+	if err := os.MkdirAll(blobDir, 0750); err != nil {
+		return &common.IOError{Message: "Failed to create the blobs directory. Error: " + err.Error()}
+	}
+	blobPath := filepath.Join(blobDir, hash)
+
+	dedupLock.Lock()
+	defer dedupLock.Unlock()
+
+	blobInfo, err := os.Stat(blobPath)
+	if err == nil {
+		os.Remove(tmpPath)
+	} else if os.IsNotExist(err) {
+		if err := moveFile(tmpPath, blobPath); err != nil {
+			return &common.IOError{Message: "Failed to rename data file. Error: " + err.Error()}
+		}
+		if blobInfo, err = os.Stat(blobPath); err != nil {
+			return &common.IOError{Message: "Failed to stat data file. Error: " + err.Error()}
+		}
+	} else {
+		return &common.IOError{Message: "Failed to stat data file. Error: " + err.Error()}
+	}
+
+	if err := syncDirectory(blobDir); err != nil {
+		return err
+	}
+
+	if fileInfo, err := os.Stat(path); err == nil && os.SameFile(fileInfo, blobInfo) {
+		return nil
+	}
+	if err := releaseFile(path); err != nil {
+		return &common.IOError{Message: "Failed to replace data file. Error: " + err.Error()}
+	}
+	if err := os.Link(blobPath, path); err != nil {
+		return &common.IOError{Message: "Failed to link data file. Error: " + err.Error()}
+	}
+	return syncDirectory(filepath.Dir(path))
+}
+
+// removeFile removes the file of a data URI, and the blob it is linked to if no other data URI references it
+func removeFile(path string) common.SyncServiceError {
+	closeReadAhead(path)
+
+	dedupLock.Lock()
+	defer dedupLock.Unlock()
+
+	if err := releaseFile(path); err != nil {
+		return &common.IOError{Message: "Failed to delete data. Error: " + err.Error()}
+	}
+	return nil
+}
+
+// releaseFile removes the file of a data URI. If the file is linked to a blob and it is the last reference
+// to the blob, the blob is removed too. Must be called with the dedupLock held.
+func releaseFile(path string) error {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if linkCount(fileInfo) == 2 {
+		if blobPath := findBlob(path, fileInfo); blobPath != "" {
+			if err := os.Remove(blobPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// findBlob returns the path of the blob the file of a data URI is linked to, or an empty string if it isn't linked to a blob
+func findBlob(path string, fileInfo os.FileInfo) string {
+	blobDir := filepath.Join(dataDirectory(path), blobsDirectory)
+	if hash, err := hashFile(path); err == nil {
+		blobPath := filepath.Join(blobDir, hash)
+		if blobInfo, err := os.Stat(blobPath); err == nil && os.SameFile(fileInfo, blobInfo) {
+			return blobPath
+		}
+	}
+
+	// The data was modified after it was stored, look for the blob by its identity
+	blobs, err := ioutil.ReadDir(blobDir)
+	if err != nil {
+		return ""
+	}
+	for _, blobInfo := range blobs {
+		if os.SameFile(fileInfo, blobInfo) {
+			return filepath.Join(blobDir, blobInfo.Name())
+		}
+	}
+	return ""
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func linkCount(fileInfo os.FileInfo) uint64 {
+	if stat, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink)
+	}
+	return 1
+}
@@ -0,0 +1,163 @@
+package dataURI
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// When DataURIReadAheadSize is set, GetDataChunk of file data URIs keeps the file open between calls, and when
+// the chunks are read sequentially, reads DataURIReadAheadSize bytes ahead of the requested chunk, so that the
+// following chunks are returned from memory. A reader is closed when the end of the data is reached, when it
+// isn't used for readAheadIdleTimeout, when the data is written or deleted, or by CloseReadAhead.
+type readAheadReader struct {
+	file         *os.File
+	size         int64
+	buffer       []byte
+	bufferOffset int64
+	nextOffset   int64
+	lock         sync.Mutex
+
+	// Protected by readAheadLock
+	inUse   int
+	closed  bool
+	lastUse time.Time
+}
+
+var readAheadReaders = make(map[string]*readAheadReader)
+var readAheadLock sync.Mutex
+
+const readAheadIdleTimeout = 60 * time.Second
+
+// CloseReadAhead closes the read-ahead reader of the data URI, if there is one.
+// Should be called when the chunks of the data URI won't be read anymore before the end of the data is reached.
+func CloseReadAhead(uri string) {
+	dataURI, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(dataURI.Scheme, "file") {
+		return
+	}
+	closeReadAhead(filePath(dataURI.Path))
+}
+
+// readChunkAhead reads a chunk of the file using its read-ahead reader
+func readChunkAhead(path string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	reader, err := acquireReadAheadReader(path)
+	if err != nil {
+		return nil, true, 0, err
+	}
+
+	reader.lock.Lock()
+	result := make([]byte, size)
+	n, readErr := reader.readAt(result, offset)
+	eof := offset+int64(n) >= reader.size
+	reader.lock.Unlock()
+
+	releaseReadAheadReader(path, reader, eof || readErr != nil)
+	if readErr != nil {
+		return nil, true, 0, &common.IOError{Message: "Failed to read data. Error: " + readErr.Error()}
+	}
+	return result, eof, n, nil
+}
+
+// readAt reads the chunk at the offset from the buffer, refilling the buffer if the chunk isn't in it.
+// The buffer is filled ahead of the chunk only when the chunk follows the previously read chunk.
+// Must be called with the reader's lock held.
+func (reader *readAheadReader) readAt(result []byte, offset int64) (int, error) {
+	end := offset + int64(len(result))
+	if end > reader.size {
+		end = reader.size
+	}
+	if offset < reader.bufferOffset || end > reader.bufferOffset+int64(len(reader.buffer)) {
+		length := len(result)
+		if offset == reader.nextOffset && length < common.Configuration.DataURIReadAheadSize {
+			length = common.Configuration.DataURIReadAheadSize
+		}
+		if cap(reader.buffer) < length {
+			reader.buffer = make([]byte, length)
+		}
+		n, err := reader.file.ReadAt(reader.buffer[:length], offset)
+		if err != nil && err != io.EOF {
+			reader.buffer = reader.buffer[:0]
+			return 0, err
+		}
+		reader.buffer = reader.buffer[:n]
+		reader.bufferOffset = offset
+	}
+
+	n := 0
+	if offset < reader.bufferOffset+int64(len(reader.buffer)) {
+		n = copy(result, reader.buffer[offset-reader.bufferOffset:])
+	}
+	reader.nextOffset = offset + int64(n)
+	return n, nil
+}
+
+func acquireReadAheadReader(path string) (*readAheadReader, common.SyncServiceError) {
+	readAheadLock.Lock()
+	defer readAheadLock.Unlock()
+
+	now := time.Now()
+	for readerPath, reader := range readAheadReaders {
+		if reader.inUse == 0 && now.Sub(reader.lastUse) >= readAheadIdleTimeout {
+			delete(readAheadReaders, readerPath)
+			reader.file.Close()
+		}
+	}
+
+	reader, ok := readAheadReaders[path]
+	if !ok {
+		file, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, &common.NotFound{}
+			}
+			return nil, common.CreateError(err, fmt.Sprintf("Failed to open file %s to read data. Error: ", path))
+		}
+		fileInfo, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, &common.IOError{Message: "Failed to stat data file. Error: " + err.Error()}
+		}
+		reader = &readAheadReader{file: file, size: fileInfo.Size()}
+		readAheadReaders[path] = reader
+	}
+	reader.inUse++
+	return reader, nil
+}
+
+func releaseReadAheadReader(path string, reader *readAheadReader, done bool) {
+	readAheadLock.Lock()
+	defer readAheadLock.Unlock()
+
+	reader.inUse--
+	reader.lastUse = time.Now()
+	if done && readAheadReaders[path] == reader {
+		delete(readAheadReaders, path)
+		reader.closed = true
+	}
+	if reader.closed && reader.inUse == 0 {
+		reader.file.Close()
+	}
+}
+
+// closeReadAhead closes the read-ahead reader of the file, the reader is closed once it isn't in use
+func closeReadAhead(path string) {
+	readAheadLock.Lock()
+	defer readAheadLock.Unlock()
+
+	reader, ok := readAheadReaders[path]
+	if !ok {
+		return
+	}
+	delete(readAheadReaders, path)
+	reader.closed = true
+	if reader.inUse == 0 {
+		reader.file.Close()
+	}
+}
@@ -0,0 +1,128 @@
+package dataURI
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// The files of data URIs in a sharded directory are stored in nested sub-directories named by the first bytes
+// of the hash of the file name, so that no directory holds too many files. For example, the data of
+// file:///var/sync/local/org-type-id is stored in /var/sync/local/3f/a2/org-type-id.
+// The data URIs themselves are not changed, the sharding is internal to the file backend.
+var shardedDirectories = make(map[string]bool)
+var shardedDirectoriesLock sync.RWMutex
+
+const shardLevels = 2
+
+// AddShardedDirectory marks the directory as sharded, the files of data URIs in the directory are stored
+// in hashed sub-directories. Only directories whose files are accessed exclusively through this package
+// may be sharded. The existing files in the directory are moved to the sharded layout.
+func AddShardedDirectory(dir string) common.SyncServiceError {
+	dir = filepath.Clean(dir)
+	shardedDirectoriesLock.Lock()
+	shardedDirectories[dir] = true
+	shardedDirectoriesLock.Unlock()
+
+	moved, err := MigrateToShardedLayout(dir)
+	if err != nil {
+		return err
+	}
+	if moved > 0 && log.IsLogging(logger.INFO) {
+		log.Info("Moved %d data files in %s to the sharded layout\n", moved, dir)
+	}
+	return nil
+}
+
+func isShardedDirectory(dir string) bool {
+	shardedDirectoriesLock.RLock()
+	defer shardedDirectoriesLock.RUnlock()
+	return shardedDirectories[filepath.Clean(dir)]
+}
+
+// shardedPath returns the path in which the file of a data URI is stored. For a file in a sharded directory,
+// the path includes the shard sub-directories, otherwise it is the path of the data URI.
+func shardedPath(path string) string {
+	dir, name := filepath.Split(path)
+	if !isShardedDirectory(dir) {
+		return path
+	}
+	return filepath.Join(dir, shardOf(name), name)
+}
+
+// shardOf returns the relative shard directory of a file. A temporary file is in the shard of the file it replaces.
+func shardOf(name string) string {
+	hash := sha256.Sum256([]byte(strings.TrimSuffix(name, ".tmp")))
+	encoded := hex.EncodeToString(hash[:shardLevels])
+	shard := make([]string, shardLevels)
+	for i := range shard {
+		shard[i] = encoded[2*i : 2*i+2]
+	}
+	return filepath.Join(shard...)
+}
+
+// dataDirectory returns the directory of the data URI of a stored file, the sharded directory for a file in a shard
+func dataDirectory(path string) string {
+	dir := filepath.Dir(path)
+	root := dir
+	for i := 0; i < shardLevels; i++ {
+		root = filepath.Dir(root)
+	}
+	if isShardedDirectory(root) && filepath.Join(root, shardOf(filepath.Base(path))) == dir {
+		return root
+	}
+	return dir
+}
+
+// MigrateToShardedLayout moves the files in the directory to their shard sub-directories.
+// Returns the number of moved files.
+func MigrateToShardedLayout(dir string) (int, common.SyncServiceError) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, &common.IOError{Message: "Failed to read data directory. Error: " + err.Error()}
+	}
+
+	moved := 0
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		shardDir := filepath.Join(dir, shardOf(file.Name()))
+		if err := os.MkdirAll(shardDir, 0750); err != nil {
+			return moved, &common.IOError{Message: "Failed to create data shard directory. Error: " + err.Error()}
+		}
+		if err := os.Rename(filepath.Join(dir, file.Name()), filepath.Join(shardDir, file.Name())); err != nil {
+			return moved, &common.IOError{Message: "Failed to move data file to its shard. Error: " + err.Error()}
+		}
+		moved++
+	}
+	if moved > 0 {
+		if err := syncDirectory(dir); err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// createShardDirectory creates the shard sub-directories of the file of a data URI, if it is in a sharded directory
+func createShardDirectory(path string) common.SyncServiceError {
+	dir, _ := filepath.Split(path)
+	if !isShardedDirectory(dir) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(shardedPath(path)), 0750); err != nil {
+		return &common.IOError{Message: "Failed to create data shard directory. Error: " + err.Error()}
+	}
+	return nil
+}
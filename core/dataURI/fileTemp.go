@@ -0,0 +1,90 @@
+package dataURI
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// Data is written to a temporary file that replaces the file of the data URI once all the data is written.
+// By default the temporary file is the file of the data URI with a .tmp suffix. When DataURITempDirectory is set,
+// the temporary files are written in that directory, and if it is on a different file system than the file of
+// the data URI, the temporary file is copied next to the file of the data URI instead of being renamed.
+
+// filePath returns the path of the file in which the data of a data URI is stored.
+// The data URI of a temporary file is the data URI of the file it replaces with a .tmp suffix.
+func filePath(path string) string {
+	if strings.HasSuffix(path, ".tmp") {
+		return tempPath(shardedPath(strings.TrimSuffix(path, ".tmp")))
+	}
+	return shardedPath(path)
+}
+
+// tempPath returns the path of the temporary file of the file
+func tempPath(path string) string {
+	if common.Configuration.DataURITempDirectory == "" {
+		return path + ".tmp"
+	}
+	// The hash of the directory distinguishes between files with the same name in different directories
+	hash := sha256.Sum256([]byte(filepath.Dir(path)))
+	return filepath.Join(common.Configuration.DataURITempDirectory, hex.EncodeToString(hash[:8])+"-"+filepath.Base(path)+".tmp")
+}
+
+// createTempDirectory creates the directory of the temporary files, if it is set
+func createTempDirectory() common.SyncServiceError {
+	if common.Configuration.DataURITempDirectory == "" {
+		return nil
+	}
+	if err := os.MkdirAll(common.Configuration.DataURITempDirectory, 0750); err != nil {
+		return &common.IOError{Message: "Failed to create the temporary data directory. Error: " + err.Error()}
+	}
+	return nil
+}
+
+// moveFile renames the file. If the new path is on a different file system, the file is copied to a temporary
+// file next to the new path, which is renamed to the new path, and then the file is removed.
+func moveFile(oldPath string, newPath string) error {
+	err := os.Rename(oldPath, newPath)
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	copyPath := newPath + ".tmp"
+	if err := copyFile(oldPath, copyPath); err != nil {
+		os.Remove(copyPath)
+		return err
+	}
+	if err := os.Rename(copyPath, newPath); err != nil {
+		os.Remove(copyPath)
+		return err
+	}
+	return os.Remove(oldPath)
+}
+
+func copyFile(oldPath string, newPath string) error {
+	source, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(newPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	if _, err := io.Copy(target, source); err != nil {
+		return err
+	}
+	if common.Configuration.DataURIFsync {
+		return target.Sync()
+	}
+	return nil
+}
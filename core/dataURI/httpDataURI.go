@@ -0,0 +1,212 @@
+package dataURI
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// HTTPError is the error returned when the server of an http(s) data URI responds with a non-2xx status
+type HTTPError struct {
+	StatusCode int
+	message    string
+}
+
+func (e *HTTPError) Error() string {
+	return e.message
+}
+
+var httpClient *http.Client
+var httpClientLock sync.Mutex
+
+// httpBackend is the read-only backend of http(s) data URIs, the data is read with GET requests
+type httpBackend struct{}
+
+// AppendData fails, data can't be written to an http(s) data URI
+func (backend *httpBackend) AppendData(dataURI *url.URL, dataReader io.Reader, dataLength uint32, offset int64, total int64,
+	isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	return &Error{"Data can't be written to an http(s) data URI"}
+}
+
+// StoreData fails, data can't be written to an http(s) data URI
+func (backend *httpBackend) StoreData(dataURI *url.URL, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError) {
+	return 0, &Error{"Data can't be written to an http(s) data URI"}
+}
+
+// GetData retrieves the data of an http(s) data URI. The returned reader is the body of the response.
+func (backend *httpBackend) GetData(dataURI *url.URL) (io.Reader, common.SyncServiceError) {
+	response, err := getHTTPResponse(dataURI.String(), "")
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// GetDataChunk retrieves a chunk of the data of an http(s) data URI using a Range request.
+// If the server ignores the Range header, the data before the offset is skipped.
+func (backend *httpBackend) GetDataChunk(dataURI *url.URL, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	// A Range can't be empty, so a chunk of size 0 is requested as one byte that is not returned
+	rangeEnd := offset + int64(size) - 1
+	if size == 0 {
+		rangeEnd = offset
+	}
+	response, err := getHTTPResponse(dataURI.String(), fmt.Sprintf("bytes=%d-%d", offset, rangeEnd))
+	if err != nil {
+		return nil, true, 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return make([]byte, size), true, 0, nil
+	}
+
+	total := response.ContentLength
+	if response.StatusCode == http.StatusPartialContent {
+		total = contentRangeTotal(response.Header.Get("Content-Range"))
+	} else if offset > 0 {
+		if _, err := io.CopyN(ioutil.Discard, response.Body, offset); err != nil {
+			if err == io.EOF {
+				return make([]byte, size), true, 0, nil
+			}
+			return nil, true, 0, &common.IOError{Message: "Failed to read data. Error: " + err.Error()}
+		}
+	}
+
+	result := make([]byte, size)
+	n, readErr := io.ReadFull(response.Body, result)
+	if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+		return nil, true, 0, &common.IOError{Message: "Failed to read data. Error: " + readErr.Error()}
+	}
+
+	eof := n < size || (total >= 0 && total <= offset+int64(n))
+	return result, eof, n, nil
+}
+
+// GetDataSize returns the size of the data of an http(s) data URI, as reported by a HEAD request
+func (backend *httpBackend) GetDataSize(dataURI *url.URL) (int64, common.SyncServiceError) {
+	size, exists, _, err := backend.Stat(dataURI)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, &common.NotFound{}
+	}
+	if size < 0 {
+		return 0, &Error{"The size of the data of the http(s) data URI isn't available"}
+	}
+	return size, nil
+}
+
+// Stat returns the size of the data of an http(s) data URI, whether it exists, and its modification time,
+// as reported by a HEAD request
+func (backend *httpBackend) Stat(dataURI *url.URL) (int64, bool, time.Time, common.SyncServiceError) {
+	uri := dataURI.String()
+	request, err := http.NewRequest(http.MethodHead, uri, nil)
+	if err != nil {
+		return 0, false, time.Time{}, &Error{"Invalid data URI"}
+	}
+	response, err := getHTTPClient().Do(request)
+	if err != nil {
+		return 0, false, time.Time{}, &common.IOError{Message: fmt.Sprintf("Failed to get the data information of %s. Error: %s", uri, err)}
+	}
+	response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return 0, false, time.Time{}, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return 0, false, time.Time{}, &HTTPError{response.StatusCode,
+			fmt.Sprintf("Failed to get the data information of %s. Received HTTP status %s", uri, response.Status)}
+	}
+
+	var modTime time.Time
+	if lastModified := response.Header.Get("Last-Modified"); lastModified != "" {
+		modTime, _ = http.ParseTime(lastModified)
+	}
+	return response.ContentLength, true, modTime, nil
+}
+
+// DeleteStoredData fails, data can't be deleted from an http(s) data URI
+func (backend *httpBackend) DeleteStoredData(dataURI *url.URL) common.SyncServiceError {
+	return &Error{"Data can't be deleted from an http(s) data URI"}
+}
+
+// getHTTPClient returns the client used to read http(s) data URIs, creating it on first use
+func getHTTPClient() *http.Client {
+	httpClientLock.Lock()
+	defer httpClientLock.Unlock()
+
+	if httpClient == nil {
+		timeout := time.Duration(common.Configuration.HTTPDataURITimeout) * time.Second
+		transport := &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   timeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			IdleConnTimeout:       90 * time.Second,
+		}
+		httpClient = &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+	}
+	return httpClient
+}
+
+func checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) > common.Configuration.HTTPDataURIMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", common.Configuration.HTTPDataURIMaxRedirects)
+	}
+	return nil
+}
+
+// getHTTPResponse sends a GET request for the data URI, with the specified Range header if it isn't empty,
+// and returns the response if its status is 2xx or 416 (Range Not Satisfiable)
+func getHTTPResponse(uri string, dataRange string) (*http.Response, common.SyncServiceError) {
+	request, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, &Error{"Invalid data URI"}
+	}
+	if dataRange != "" {
+		request.Header.Set("Range", dataRange)
+	}
+
+	response, err := getHTTPClient().Do(request)
+	if err != nil {
+		return nil, &common.IOError{Message: fmt.Sprintf("Failed to read data from %s. Error: %s", uri, err)}
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 ||
+		(dataRange != "" && response.StatusCode == http.StatusRequestedRangeNotSatisfiable) {
+		return response, nil
+	}
+
+	response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, &common.NotFound{}
+	}
+	return nil, &HTTPError{response.StatusCode,
+		fmt.Sprintf("Failed to read data from %s. Received HTTP status %s", uri, response.Status)}
+}
+
+// contentRangeTotal returns the total size of a Content-Range header of the form "bytes first-last/total",
+// or -1 if the total is unknown
+func contentRangeTotal(contentRange string) int64 {
+	index := strings.LastIndex(contentRange, "/")
+	if index == -1 {
+		return -1
+	}
+	total, err := strconv.ParseInt(contentRange[index+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
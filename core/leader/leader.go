@@ -19,6 +19,7 @@ var leaderStopChannel chan int
 var store storage.Storage
 var isLeader bool
 var lastTimestamp time.Time
+var lostLeadershipTime time.Time
 
 var changeLeadership func(bool) common.SyncServiceError
 var unsubscribe func() common.SyncServiceError
@@ -102,6 +103,12 @@ func startLeadershipPeriodicUpdate() {
 					ok, err := store.LeaderPeriodicUpdate(leaderID.String())
 					if err != nil || !ok {
 						isLeader = false
+						lostLeadershipTime = time.Now()
+						if err == nil {
+							// Either another node took over, or a node with a higher priority asked for a handoff.
+							// Resigning lets the latter take over without waiting for the heartbeat timeout.
+							store.ResignLeadership(leaderID.String())
+						}
 						if changeLeadership != nil {
 							changeLeadership(false)
 						}
@@ -120,7 +127,13 @@ func startLeadershipPeriodicUpdate() {
 						lastTimestamp = time.Now()
 					}
 				} else {
-					_, heartbeatTimeout, lastHeartbeatTS, version, err := store.RetrieveLeader()
+					// The version is read before the liveness check, a leader that changes in between fails the
+					// version check of the takeover or the handoff request
+					_, _, _, version, err := store.RetrieveLeader()
+					alive := false
+					if err == nil {
+						alive, _, err = store.IsLeaderAlive()
+					}
 					if err != nil {
 						if storage.IsNotFound(err) {
 							initializeLeadership()
@@ -128,29 +141,32 @@ func startLeadershipPeriodicUpdate() {
 							log.Error("%s\n", err)
 						}
 					} else {
-						timeOnServer, err := store.RetrieveTimeOnServer()
-						if err != nil {
-							if log.IsLogging(logger.ERROR) {
-								log.Error("%s\n", err)
-							}
-						} else {
-							timeSinceHeartBeat := int32(timeOnServer.Sub(lastHeartbeatTS) / time.Second)
-
-							if timeSinceHeartBeat > heartbeatTimeout {
-								// Leader seems to have "died", taking over
-								updated, err := store.UpdateLeader(leaderID.String(), version)
+						if alive {
+							if common.LeaderPriority() > 0 {
+								// Ask a leader with a lower priority to hand off the leadership
+								requested, err := store.RequestLeaderHandoff(leaderID.String(), version)
 								if err != nil && log.IsLogging(logger.ERROR) {
 									log.Error("%s\n", err)
 								}
-								if updated {
-									if changeLeadership != nil {
-										changeLeadership(true)
-									}
-									isLeader = true
-									lastTimestamp = time.Now()
-									if trace.IsLogging(logger.TRACE) {
-										trace.Trace("Have taken over as the leader")
-									}
+								if requested && trace.IsLogging(logger.TRACE) {
+									trace.Trace("Have requested a handoff of the leadership")
+								}
+							}
+						} else if time.Since(lostLeadershipTime) > time.Second*time.Duration(common.Configuration.LeadershipTimeout) {
+							// Leader seems to have "died", taking over.
+							// A node that has just lost the leadership waits, to let the node that asked for a handoff take over.
+							updated, err := store.UpdateLeader(leaderID.String(), version)
+							if err != nil && log.IsLogging(logger.ERROR) {
+								log.Error("%s\n", err)
+							}
+							if updated {
+								if changeLeadership != nil {
+									changeLeadership(true)
+								}
+								isLeader = true
+								lastTimestamp = time.Now()
+								if trace.IsLogging(logger.TRACE) {
+									trace.Trace("Have taken over as the leader")
 								}
 							}
 						}
@@ -44,6 +44,16 @@ const (
 	AuthNodeUser
 )
 
+// roleAuthCodes maps the names of roles, as used in API tokens and org mappings, to auth codes
+var roleAuthCodes = map[string]int{
+	"admin":     AuthAdmin,
+	"user":      AuthUser,
+	"syncadmin": AuthSyncAdmin,
+	"service":   AuthService,
+	"edgenode":  AuthEdgeNode,
+	"nodeuser":  AuthNodeUser,
+}
+
 // ACL user type
 const (
 	// Indicate this entry of ACL is for exchange user
@@ -51,6 +61,9 @@ const (
 
 	// Indicate this entry of ACL is for exchange node
 	ACLNode = "node"
+
+	// Indicate this entry of ACL is for an object type, used in destination object types ACLs
+	ACLObjectType = "objectType"
 )
 
 // ACL role, only AuthAdmin and AuthSyncAdmin can modify ACL list. This is currently only be used for "objects" ACL. ACL role only applies to "objects". Use "n/a"
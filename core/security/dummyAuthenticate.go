@@ -2,8 +2,10 @@ package security
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/open-horizon/edge-sync-service/common"
@@ -35,16 +37,110 @@ import (
 //                 admin for the specified org.
 //
 //     Edge nodes  are of the form orgID/destType/destID
+//
+// The formats of the app keys can be replaced by the field keyFormats of the file dummy-auth.json,
+// a list of regular expressions that are tried in order. The named groups of each regular expression
+// are mapped to the identity of the app, depending on the kind of the app key:
+//                    {
+//                      "keyFormats": [
+//                        { "kind": "edgeNode", "pattern": "^(?P<destType>[^.]+)\\.(?P<destID>[^.]+)\\.(?P<org>[^.]+)$" },
+//                        { "kind": "user", "pattern": "^(?P<org>[^#]+)#(?P<user>.+)$" }
+//                      ]
+//                    }
+//                 The kinds and their groups are edgeNode (org, destType, destID), orgAdmin (org, user),
+//                 service (org, serviceOrg, version, serviceName), nodeUser (org, user), and
+//                 user (org, user), which is classified as a regular user, sync admin, or org admin
+//                 as described above.
 type DummyAuthenticate struct {
 	regularUsers []string
 	syncAdmins   []string
+	keyFormats   []keyFormat
 }
 
 const dummyAuthFilename = "/sync/dummy-auth.json"
 
 type authInfo struct {
-	RegularUsers []string `json:"regularUsers"`
-	SyncAdmins   []string `json:"syncAdmins"`
+	RegularUsers []string    `json:"regularUsers"`
+	SyncAdmins   []string    `json:"syncAdmins"`
+	KeyFormats   []keyFormat `json:"keyFormats"`
+}
+
+// keyFormat is a format of app keys, whose named groups are mapped to the identity of the app
+type keyFormat struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+	regexp  *regexp.Regexp
+}
+
+// The kinds of app keys and the groups that their formats must have
+var keyFormatGroups = map[string][]string{
+	"edgeNode": {"org", "destType", "destID"},
+	"orgAdmin": {"org", "user"},
+	"service":  {"org", "serviceOrg", "version", "serviceName"},
+	"nodeUser": {"org", "user"},
+	"user":     {"org", "user"},
+}
+
+// defaultKeyFormats are the formats of the app keys when dummy-auth.json doesn't specify them
+var defaultKeyFormats = []keyFormat{
+	{Kind: "edgeNode", Pattern: `^(?P<org>[^/]*)/(?P<destType>[^/]*)/(?P<destID>[^/]*)$`},
+	// CSS appKey is (org/userID), used by CSS hznAuthenticator to create object
+	{Kind: "orgAdmin", Pattern: `^(?P<org>[^/]*)/(?P<user>[^/]*)$`},
+	// to mimic anax service authenticator
+	{Kind: "service", Pattern: `^(?P<org>[^$]*)\$(?P<serviceOrg>[^$]*)\$(?P<version>[^$]*)\$(?P<serviceName>[^$]*)$`},
+	{Kind: "nodeUser", Pattern: `^(?P<user>[^%]*)%(?P<org>[^%]*)$`},
+	{Kind: "user", Pattern: `^(?P<user>[^@]*(?:@[^@]*)?)@(?P<org>[^@]*)$`},
+}
+
+var compiledDefaultKeyFormats, _ = compileKeyFormats(defaultKeyFormats)
+
+// compileKeyFormats compiles the regular expressions of the key formats and verifies that they have the groups of their kinds
+func compileKeyFormats(formats []keyFormat) ([]keyFormat, error) {
+	compiled := make([]keyFormat, 0, len(formats))
+	for _, format := range formats {
+		groups, ok := keyFormatGroups[format.Kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown kind of app key %s", format.Kind)
+		}
+		re, err := regexp.Compile(format.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of %s app keys. Error: %s", format.Kind, err)
+		}
+		names := make(map[string]bool)
+		for _, name := range re.SubexpNames() {
+			names[name] = true
+		}
+		for _, group := range groups {
+			if !names[group] {
+				return nil, fmt.Errorf("the pattern of %s app keys doesn't have the group %s", format.Kind, group)
+			}
+		}
+		format.regexp = re
+		compiled = append(compiled, format)
+	}
+	return compiled, nil
+}
+
+// matchKeyFormat returns the kind of the first format that matches the app key and the values of its groups
+func (auth *DummyAuthenticate) matchKeyFormat(appKey string) (string, map[string]string) {
+	formats := auth.keyFormats
+	if formats == nil {
+		formats = compiledDefaultKeyFormats
+	}
+	for _, format := range formats {
+		match := format.regexp.FindStringSubmatch(appKey)
+		if match == nil {
+			continue
+		}
+		groups := make(map[string]string)
+		for i, name := range format.regexp.SubexpNames() {
+			if name != "" {
+				groups[name] = match[i]
+			}
+		}
+		return format.Kind, groups
+	}
+	return "", nil
 }
 
 // Start initializes the DummyAuthenticate struct
@@ -60,6 +156,7 @@ func (auth *DummyAuthenticate) Start() {
 		}
 		auth.regularUsers = make([]string, 0)
 		auth.syncAdmins = make([]string, 0)
+		auth.keyFormats = compiledDefaultKeyFormats
 		return
 	}
 	decoder := json.NewDecoder(authFile)
@@ -73,6 +170,17 @@ func (auth *DummyAuthenticate) Start() {
 		auth.syncAdmins = make([]string, 0)
 	}
 
+	auth.keyFormats = compiledDefaultKeyFormats
+	if len(info.KeyFormats) > 0 {
+		if formats, err := compileKeyFormats(info.KeyFormats); err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Invalid keyFormats in dummy-auth.json, the default app key formats are used. Error: %s\n", err)
+			}
+		} else {
+			auth.keyFormats = formats
+		}
+	}
+
 	return
 }
 
@@ -87,6 +195,7 @@ func (auth *DummyAuthenticate) Start() {
 //      if a userID is a regular user or a sync admin. If the userID does not
 //      appear there, it is assumed to be an admin for the specified org.
 //      Edge node app keys are of the form orgID/destType/destID
+//      The formats of the app keys can be replaced in dummy-auth.json.
 func (auth *DummyAuthenticate) Authenticate(request *http.Request) (int, string, string) {
 	appKey, _, ok := request.BasicAuth()
 	if !ok {
@@ -96,42 +205,25 @@ func (auth *DummyAuthenticate) Authenticate(request *http.Request) (int, string,
 		trace.Debug("In dummyAuthenticate.Authenticate: appKey is %s", appKey)
 	}
 
-	parts := strings.Split(appKey, "/")
-	if len(parts) == 3 {
-		return AuthEdgeNode, parts[0], parts[1] + "/" + parts[2]
-	}
-
-	// CSS appKey is (org/userID), used by CSS hznAuthenticator to create object
-	if len(parts) == 2 {
-		return AuthAdmin, parts[0], parts[1]
-	}
-
-	// to mimic anax service authenticator
-	parts = strings.Split(appKey, "$")
-	if len(parts) == 4 {
-		return AuthService, parts[0], parts[1] + "/" + parts[2] + "/" + parts[3]
-	}
-
-	parts = strings.Split(appKey, "%")
-	if len(parts) == 2 {
-		return AuthNodeUser, parts[1], parts[0]
-	}
-
-	parts = strings.Split(appKey, "@")
-	if len(parts) != 2 && len(parts) != 3 {
+	kind, groups := auth.matchKeyFormat(appKey)
+	switch kind {
+	case "edgeNode":
+		return AuthEdgeNode, groups["org"], groups["destType"] + "/" + groups["destID"]
+	case "orgAdmin":
+		return AuthAdmin, groups["org"], groups["user"]
+	case "service":
+		return AuthService, groups["org"], groups["serviceOrg"] + "/" + groups["version"] + "/" + groups["serviceName"]
+	case "nodeUser":
+		return AuthNodeUser, groups["org"], groups["user"]
+	case "user":
+	default:
 		return AuthFailed, "", ""
 	}
 
-	var user string
-	if len(parts) == 2 {
-		user = parts[0]
-	} else {
-		user = parts[0] + "@" + parts[1]
-	}
-
+	user := groups["user"]
 	for _, regUser := range auth.regularUsers {
 		if regUser == user {
-			return AuthUser, parts[len(parts)-1], user
+			return AuthUser, groups["org"], user
 		}
 	}
 
@@ -141,7 +233,7 @@ func (auth *DummyAuthenticate) Authenticate(request *http.Request) (int, string,
 		}
 	}
 
-	return AuthAdmin, parts[len(parts)-1], user
+	return AuthAdmin, groups["org"], user
 }
 
 // KeyandSecretForURL returns an app key and an app secret pair to be
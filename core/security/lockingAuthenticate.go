@@ -0,0 +1,165 @@
+package security
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// LockingAuthenticate is an implementation of the Authenticate interface that wraps another implementation
+// and protects it from brute-force attacks. It tracks the consecutive failed authentications of each identity
+// (the app key of basic authentication) and of each IP address. Once an identity or an address fails
+// AuthFailureThreshold consecutive times, its authentication attempts are rejected for AuthLockoutDuration
+// seconds without consulting the wrapped implementation. Failures are only counted as consecutive if each
+// occurs within AuthLockoutDuration seconds of the previous one, so that the failures of an address decay
+// even though successful authentications from the address don't reset them.
+//
+// The number of tracked identities and addresses is limited by AuthFailureTrackingLimit, so that the tracking
+// can't be used to exhaust the memory.
+type LockingAuthenticate struct {
+	Authenticator Authentication
+
+	failures map[string]*authFailures
+	lock     sync.Mutex
+}
+
+type authFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Start initializes the LockingAuthenticate struct and the wrapped implementation
+func (auth *LockingAuthenticate) Start() {
+	auth.lock.Lock()
+	auth.failures = make(map[string]*authFailures)
+	auth.lock.Unlock()
+
+	auth.Authenticator.Start()
+}
+
+// Authenticate  authenticates a particular HTTP request and indicates
+// whether it is an edge node, org admin, or plain user. Also returned is the
+// user's org and identitity. An edge node's identity is destType/destID. A
+// service's identity is serviceOrg/version/serviceName.
+func (auth *LockingAuthenticate) Authenticate(request *http.Request) (int, string, string) {
+	keys := authFailureKeys(request)
+	now := time.Now()
+	if auth.isLocked(keys, now) {
+		return AuthFailed, "", ""
+	}
+
+	code, orgID, userID := auth.Authenticator.Authenticate(request)
+	if code == AuthFailed {
+		auth.recordFailure(keys, now)
+	} else {
+		auth.recordSuccess(keys)
+	}
+	return code, orgID, userID
+}
+
+// KeyandSecretForURL returns an app key and an app secret pair to be
+// used by the ESS when communicating with the specified URL.
+func (auth *LockingAuthenticate) KeyandSecretForURL(url string) (string, string) {
+	return auth.Authenticator.KeyandSecretForURL(url)
+}
+
+// authFailureKeys returns the keys under which the failures of the request are tracked,
+// the key of the request's IP address and, for basic authentication, the key of the identity
+func authFailureKeys(request *http.Request) []string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	keys := []string{"ip:" + host}
+	if appKey, _, ok := request.BasicAuth(); ok {
+		keys = append(keys, "id:"+appKey)
+	}
+	return keys
+}
+
+func (auth *LockingAuthenticate) isLocked(keys []string, now time.Time) bool {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
+	for _, key := range keys {
+		if failures, ok := auth.failures[key]; ok && now.Before(failures.lockedUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+func (auth *LockingAuthenticate) recordFailure(keys []string, now time.Time) {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
+	expiration := now.Add(-time.Duration(common.Configuration.AuthLockoutDuration) * time.Second)
+	for _, key := range keys {
+		failures, ok := auth.failures[key]
+		if !ok {
+			auth.makeRoom(now)
+			failures = &authFailures{}
+			auth.failures[key] = failures
+		} else if failures.lastFailure.Before(expiration) {
+			failures.count = 0
+		}
+		failures.count++
+		failures.lastFailure = now
+		if failures.count >= common.Configuration.AuthFailureThreshold {
+			failures.count = 0
+			failures.lockedUntil = now.Add(time.Duration(common.Configuration.AuthLockoutDuration) * time.Second)
+			if log.IsLogging(logger.WARNING) {
+				log.Warning("Authentication of %s is locked after %d consecutive failures\n", key, common.Configuration.AuthFailureThreshold)
+			}
+		}
+	}
+}
+
+// recordSuccess resets the consecutive failures of the identity. The failures of the IP address are kept,
+// so that an attacker with valid credentials can't reset the failures of the address; they expire in
+// recordFailure instead.
+func (auth *LockingAuthenticate) recordSuccess(keys []string) {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, "id:") {
+			delete(auth.failures, key)
+		}
+	}
+}
+
+// makeRoom makes room for a new tracked key when the tracking limit is reached. The keys that are no longer
+// locked and failed more than the lockout duration ago are removed, and if there are still too many keys,
+// the key that failed the longest time ago is removed. Must be called with the lock held.
+func (auth *LockingAuthenticate) makeRoom(now time.Time) {
+	if len(auth.failures) < common.Configuration.AuthFailureTrackingLimit {
+		return
+	}
+
+	expiration := now.Add(-time.Duration(common.Configuration.AuthLockoutDuration) * time.Second)
+	for key, failures := range auth.failures {
+		if !now.Before(failures.lockedUntil) && failures.lastFailure.Before(expiration) {
+			delete(auth.failures, key)
+		}
+	}
+
+	for len(auth.failures) >= common.Configuration.AuthFailureTrackingLimit {
+		oldestKey := ""
+		var oldest time.Time
+		for key, failures := range auth.failures {
+			if oldestKey == "" || failures.lastFailure.Before(oldest) {
+				oldestKey = key
+				oldest = failures.lastFailure
+			}
+		}
+		delete(auth.failures, oldestKey)
+	}
+}
@@ -0,0 +1,159 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// OrgMapping maps identity claims of authenticated users, such as the groups of a JWT or LDAP user,
+// to an org and a role. It can be used by any implementation of the Authenticate interface.
+//
+// The mapping is read from a JSON file, by default {PersistenceRootPath}/sync/org-mapping.json, of the form:
+//
+//    {
+//      "defaultOrg": "myorg",
+//      "defaultRole": "user",
+//      "mappings": [
+//        { "claim": "groups", "value": "sync-admins", "org": "myorg", "role": "syncadmin" },
+//        { "claim": "groups", "value": "field-ops", "org": "fieldorg", "role": "admin" }
+//      ]
+//    }
+//
+// The mappings are evaluated in order, the first mapping whose claim has the value determines the org
+// and the role. When no mapping matches, the default org and the default role are used. The values of
+// the roles are admin, user, syncadmin, service, edgenode, and nodeuser.
+//
+// The file is checked for modifications at most every orgMappingCheckInterval and reloaded when it was
+// modified. If the modified file is invalid, the previous mapping is kept.
+type OrgMapping struct {
+	path      string
+	info      orgMappingInfo
+	modTime   time.Time
+	lastCheck time.Time
+	lock      sync.RWMutex
+}
+
+// OrgMappingRule maps the value of a claim to an org and a role
+type OrgMappingRule struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
+	Org   string `json:"org"`
+	Role  string `json:"role"`
+}
+
+type orgMappingInfo struct {
+	DefaultOrg  string           `json:"defaultOrg"`
+	DefaultRole string           `json:"defaultRole"`
+	Mappings    []OrgMappingRule `json:"mappings"`
+}
+
+const orgMappingFilename = "/sync/org-mapping.json"
+
+const orgMappingCheckInterval = 10 * time.Second
+
+// NewOrgMapping creates an OrgMapping that is loaded from the specified file.
+// An empty path means the default file, {PersistenceRootPath}/sync/org-mapping.json.
+func NewOrgMapping(path string) *OrgMapping {
+	if path == "" {
+		path = common.Configuration.PersistenceRootPath + orgMappingFilename
+	}
+	mapping := &OrgMapping{path: path}
+	mapping.reload(time.Now())
+	return mapping
+}
+
+// Map returns the org and the auth code of the identity with the given claims. Each claim may have several
+// values, e.g. the groups of a user. The returned flag is false if no mapping matches and there is no default org.
+func (mapping *OrgMapping) Map(claims map[string][]string) (string, int, bool) {
+	mapping.reloadIfModified()
+
+	mapping.lock.RLock()
+	defer mapping.lock.RUnlock()
+
+	for _, rule := range mapping.info.Mappings {
+		for _, value := range claims[rule.Claim] {
+			if value == rule.Value {
+				return rule.Org, roleAuthCodes[strings.ToLower(rule.Role)], true
+			}
+		}
+	}
+
+	if mapping.info.DefaultOrg == "" {
+		return "", AuthFailed, false
+	}
+	return mapping.info.DefaultOrg, roleAuthCodes[strings.ToLower(mapping.info.DefaultRole)], true
+}
+
+// reloadIfModified reloads the mapping if the file was modified since it was loaded
+func (mapping *OrgMapping) reloadIfModified() {
+	now := time.Now()
+	mapping.lock.RLock()
+	check := now.Sub(mapping.lastCheck) >= orgMappingCheckInterval
+	mapping.lock.RUnlock()
+	if check {
+		mapping.reload(now)
+	}
+}
+
+func (mapping *OrgMapping) reload(now time.Time) {
+	mapping.lock.Lock()
+	defer mapping.lock.Unlock()
+
+	mapping.lastCheck = now
+	fileInfo, err := os.Stat(mapping.path)
+	if err != nil {
+		if !mapping.modTime.IsZero() && log.IsLogging(logger.WARNING) {
+			log.Warning("Failed to read the org mapping file %s, the previous mapping is used. Error: %s\n", mapping.path, err)
+		}
+		return
+	}
+	if fileInfo.ModTime().Equal(mapping.modTime) {
+		return
+	}
+
+	info, err := loadOrgMapping(mapping.path)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Invalid org mapping file %s, the previous mapping is used. Error: %s\n", mapping.path, err)
+		}
+		return
+	}
+	mapping.info = *info
+	mapping.modTime = fileInfo.ModTime()
+}
+
+// loadOrgMapping reads and validates an org mapping file
+func loadOrgMapping(path string) (*orgMappingInfo, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info orgMappingInfo
+	if err := json.Unmarshal(contents, &info); err != nil {
+		return nil, err
+	}
+
+	if info.DefaultOrg != "" {
+		if _, ok := roleAuthCodes[strings.ToLower(info.DefaultRole)]; !ok {
+			return nil, fmt.Errorf("invalid default role %s", info.DefaultRole)
+		}
+	}
+	for _, rule := range info.Mappings {
+		if rule.Claim == "" || rule.Org == "" {
+			return nil, fmt.Errorf("the mapping of the value %s must have a claim and an org", rule.Value)
+		}
+		if _, ok := roleAuthCodes[strings.ToLower(rule.Role)]; !ok {
+			return nil, fmt.Errorf("invalid role %s in the mapping of %s=%s", rule.Role, rule.Claim, rule.Value)
+		}
+	}
+	return &info, nil
+}
@@ -110,6 +110,10 @@ func SetAuthentication(auth Authentication) {
 func Authenticate(request *http.Request) (int, string, string) {
 	appKey, appSecret, ok := request.BasicAuth()
 	if !ok {
+		if bearerToken(request) != "" {
+			// Bearer tokens aren't cached, so that revoked tokens are rejected immediately
+			return authenticator.Authenticate(request)
+		}
 		return AuthFailed, "", ""
 	}
 
@@ -155,6 +159,35 @@ func Authenticate(request *http.Request) (int, string, string) {
 	return code, orgID, userID
 }
 
+// AuthorizeOrgAccess checks whether an identity authenticated with the specified
+// auth code and org may act on resources of the target org. Sync Service admins
+// may act on any org, failed authentications on none, and every other identity
+// is limited to its own org.
+func AuthorizeOrgAccess(code int, authedOrg, targetOrg string) bool {
+	switch code {
+	case AuthSyncAdmin:
+		return true
+	case AuthFailed:
+		return false
+	default:
+		return authedOrg == targetOrg
+	}
+}
+
+// CanAnonymousReadObject checks if a request that failed authentication, or had no credentials,
+// may still read objects of the specified object type. Only reads of the object types listed in
+// the PublicObjectTypes configuration are allowed.
+func CanAnonymousReadObject(request *http.Request, orgID, objectType string) bool {
+	if request.Method != http.MethodGet {
+		return false
+	}
+	allowed := common.IsPublicObjectType(orgID, objectType)
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In security.CanAnonymousReadObject: anonymous read of %s/%s allowed: %t", orgID, objectType, allowed)
+	}
+	return allowed
+}
+
 // CanUserCreateObject checks if the user identified by the credentials in the supplied request,
 // can create an object of the object type, and send it to the destinations in the meta data.
 func CanUserCreateObject(request *http.Request, orgID string, metaData *common.MetaData) (bool, string, string) {
@@ -166,7 +199,7 @@ func CanUserCreateObject(request *http.Request, orgID string, metaData *common.M
 		return true, userOrgID, userID
 	}
 
-	if code == AuthFailed || code == AuthEdgeNode || userOrgID != orgID {
+	if code == AuthEdgeNode || !AuthorizeOrgAccess(code, userOrgID, orgID) {
 		return false, userOrgID, userID
 	}
 
@@ -218,47 +251,47 @@ func CanUserCreateObject(request *http.Request, orgID string, metaData *common.M
 // return values:
 // 1) true indicates the given user can access all objects of given objectType in given orgID;
 // false indicates can access "public" objects of given objectType in given orgID only
-// 2) authCode 3) userID
-func CanUserAccessAllObjects(request *http.Request, orgID, objectType string) (bool, int, string) {
+// 2) authCode 3) userID 4) userOrgID
+func CanUserAccessAllObjects(request *http.Request, orgID, objectType string) (bool, int, string, string) {
 	code, userOrgID, userID := Authenticate(request)
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In security.CanUserAccessAllObjects: authcode is %d, userOrgID is %s, userID is %s", code, userOrgID, userID)
 	}
 	// CSS + ESS
 	if code == AuthSyncAdmin {
-		return true, code, userID
+		return true, code, userID, userOrgID
 	}
 
 	if code == AuthFailed || code == AuthEdgeNode {
-		return false, AuthFailed, ""
+		return false, AuthFailed, "", ""
 	}
 
 	// ESS
 	if common.Configuration.NodeType == common.ESS {
-		if userOrgID != orgID {
+		if !AuthorizeOrgAccess(code, userOrgID, orgID) {
 			// user should not have access to edge node from different edge node
-			return false, AuthFailed, ""
+			return false, AuthFailed, "", ""
 		} else {
-			return true, code, userID
+			return true, code, userID, userOrgID
 		}
 
 	}
 
 	// CSS
 	if code == AuthAdmin {
-		if userOrgID != orgID {
+		if !AuthorizeOrgAccess(code, userOrgID, orgID) {
 			code = AuthUser
 			// continue on code == authUser section
 		} else {
-			return true, code, userID
+			return true, code, userID, userOrgID
 		}
 
 	}
 
 	if code == AuthUser || code == AuthNodeUser {
-		if userOrgID != orgID {
+		if !AuthorizeOrgAccess(code, userOrgID, orgID) {
 			// only display public object
-			return false, code, userID
+			return false, code, userID, userOrgID
 		}
 
 		aclUserType := GetACLUserType(code)
@@ -268,13 +301,13 @@ func CanUserAccessAllObjects(request *http.Request, orgID, objectType string) (b
 			if trace.IsLogging(logger.DEBUG) {
 				trace.Debug("In security.CanUserAccessObject: checkObjectAccessByUser returns true for authcode %d for user %s", code, userID)
 			}
-			return true, code, userID
+			return true, code, userID, userOrgID
 		}
 		// If user is not in the ACL, only display public object
-		return false, code, userID
+		return false, code, userID, userOrgID
 	}
 
-	return false, AuthFailed, ""
+	return false, AuthFailed, "", ""
 }
 
 // KeyandSecretForURL returns an app key and an app secret pair to be
@@ -382,7 +415,7 @@ func CheckObjectCanBeModifiedByUser(userID, orgID, objectType string, aclUserTyp
 			trace.Debug("ACL entry for objectType(%s): %s:%s:%s", objectType, user.ACLUserType, user.Username, user.ACLRole)
 		}
 
-		if user.Username == "*" || user.Username == userID {
+		if aclEntryMatchesUser(user, userID) {
 			if user.ACLRole == ACLWriter {
 				return true
 			} else if user.ACLRole == ACLReader {
@@ -406,7 +439,7 @@ func CheckObjectCanBeModifiedByUser(userID, orgID, objectType string, aclUserTyp
 			trace.Debug("ACL entry: %s:%s:%s", user.ACLUserType, user.Username, user.ACLRole)
 		}
 
-		if user.Username == "*" || user.Username == userID {
+		if aclEntryMatchesUser(user, userID) {
 			if user.ACLRole == ACLWriter {
 				return true
 			} else if user.ACLRole == ACLReader {
@@ -418,6 +451,12 @@ func CheckObjectCanBeModifiedByUser(userID, orgID, objectType string, aclUserTyp
 	return false
 }
 
+// aclEntryMatchesUser returns true if the ACL entry is the wildcard entry or the entry of the user,
+// comparing the normalized usernames
+func aclEntryMatchesUser(user common.ACLentry, userID string) bool {
+	return user.Username == "*" || common.NormalizeACLUsername(user.Username) == common.NormalizeACLUsername(userID)
+}
+
 func checkObjectAccessByUser(userID, orgID, objectType string, aclUserType string) bool {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In security.checkObjectAccessByUser: userID is %s, orgID is %s, objectType is %s, aclUserType is %s", userID, orgID, objectType, aclUserType)
@@ -435,7 +474,7 @@ func checkObjectAccessByUser(userID, orgID, objectType string, aclUserType strin
 			trace.Debug("ACL entry for objectType(%s): %s:%s:%s", objectType, user.ACLUserType, user.Username, user.ACLRole)
 		}
 
-		if user.Username == "*" || user.Username == userID {
+		if aclEntryMatchesUser(user, userID) {
 			return true
 		}
 
@@ -454,7 +493,7 @@ func checkObjectAccessByUser(userID, orgID, objectType string, aclUserType strin
 			trace.Debug("ACL entry: %s:%s:%s", user.ACLUserType, user.Username, user.ACLRole)
 		}
 
-		if user.Username == "*" || user.Username == userID {
+		if aclEntryMatchesUser(user, userID) {
 			return true
 		}
 
@@ -493,7 +532,7 @@ func checkDestinationAccessByUser(userID, orgID, destType string, aclUserType st
 	}
 
 	for _, user := range users {
-		if user.Username == "*" || user.Username == userID {
+		if aclEntryMatchesUser(user, userID) {
 			return true
 		}
 
@@ -507,7 +546,7 @@ func checkDestinationAccessByUser(userID, orgID, destType string, aclUserType st
 		return false
 	}
 	for _, user := range users {
-		if user.Username == "*" || user.Username == userID {
+		if aclEntryMatchesUser(user, userID) {
 			return true
 		}
 
@@ -528,7 +567,7 @@ func checkUserHaveAccessToALLDestinations(userID, orgID, aclUserType string) boo
 		return false
 	}
 	for _, user := range users {
-		if user.Username == "*" || user.Username == userID {
+		if aclEntryMatchesUser(user, userID) {
 			return true
 		}
 
@@ -548,20 +587,15 @@ func CheckAddACLInputFormat(aclType string, aclInputList []common.ACLentry) (*[]
 
 	var message string
 	var updatedACLList []common.ACLentry
-	if aclType == "destinations" {
+	if aclType != "objects" {
 		updatedACLList = make([]common.ACLentry, 0)
 	}
 	for _, aclInput := range aclInputList {
 
-		aclUserType := aclInput.ACLUserType
 		name := aclInput.Username
 
-		if aclUserType != ACLUser && aclUserType != ACLNode {
-			message = fmt.Sprintf("aclUserType \"%s\" is invalid for ACL entry %s, it should be \"%s\", or \"%s\"", aclUserType, aclInput, ACLUser, ACLNode)
-			if log.IsLogging(logger.ERROR) {
-				log.Error(message)
-			}
-			return nil, errors.New(message)
+		if err := checkACLUserType(aclType, aclInput); err != nil {
+			return nil, err
 		}
 
 		//trimName := strings.TrimSpace(name)
@@ -583,7 +617,7 @@ func CheckAddACLInputFormat(aclType string, aclInputList []common.ACLentry) (*[]
 				return nil, errors.New(message)
 			}
 		} else {
-			// aclType == "destinations", there is not role for destinations acl entry, set role to "N/A"
+			// aclType == "destinations" or "destinationObjectTypes", there is not role for these acl entries, set role to "N/A"
 			aclInput.ACLRole = ACLNA
 			updatedACLList = append(updatedACLList, aclInput)
 			if trace.IsLogging(logger.DEBUG) {
@@ -596,12 +630,32 @@ func CheckAddACLInputFormat(aclType string, aclInputList []common.ACLentry) (*[]
 	if aclType == "objects" {
 		return nil, nil
 	}
-	// aclType == "destinations", return the updated aclInputList
+	// aclType == "destinations" or "destinationObjectTypes", return the updated aclInputList
 	return &updatedACLList, nil
 }
 
+// checkACLUserType checks that the ACL user type of the entry is valid for ACLs of the given type.
+// The entries of destination object types ACLs are object types, the entries of other ACLs are users or nodes.
+func checkACLUserType(aclType string, aclInput common.ACLentry) error {
+	var message string
+	if aclType == common.DestinationObjectTypesACLType {
+		if aclInput.ACLUserType != ACLObjectType {
+			message = fmt.Sprintf("aclUserType \"%s\" is invalid for ACL entry %s, it should be \"%s\"", aclInput.ACLUserType, aclInput, ACLObjectType)
+		}
+	} else if aclInput.ACLUserType != ACLUser && aclInput.ACLUserType != ACLNode {
+		message = fmt.Sprintf("aclUserType \"%s\" is invalid for ACL entry %s, it should be \"%s\", or \"%s\"", aclInput.ACLUserType, aclInput, ACLUser, ACLNode)
+	}
+	if message == "" {
+		return nil
+	}
+	if log.IsLogging(logger.ERROR) {
+		log.Error(message)
+	}
+	return errors.New(message)
+}
+
 // CheckRemoveACLInputFormat checks ACL entry format.
-func CheckRemoveACLInputFormat(aclInputList []common.ACLentry) error {
+func CheckRemoveACLInputFormat(aclType string, aclInputList []common.ACLentry) error {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In security.CheckRemoveACLInputFormat")
 	}
@@ -612,15 +666,10 @@ func CheckRemoveACLInputFormat(aclInputList []common.ACLentry) error {
 
 	var message string
 	for _, aclInput := range aclInputList {
-		aclUserType := aclInput.ACLUserType
 		name := aclInput.Username
 
-		if aclUserType != ACLUser && aclUserType != ACLNode {
-			message = fmt.Sprintf("aclUserType \"%s\" is invalid for ACL entry %s, it should be \"%s\", or \"%s\"", aclUserType, aclInput, ACLUser, ACLNode)
-			if log.IsLogging(logger.ERROR) {
-				log.Error(message)
-			}
-			return errors.New(message)
+		if err := checkACLUserType(aclType, aclInput); err != nil {
+			return err
 		}
 
 		if strings.TrimSpace(name) == "" {
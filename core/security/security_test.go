@@ -1,10 +1,17 @@
 package security
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
 )
 
 func TestGetDestinationTypes(t *testing.T) {
@@ -33,3 +40,326 @@ func TestGetDestinationTypes(t *testing.T) {
 		}
 	}
 }
+
+func TestAuthorizeOrgAccess(t *testing.T) {
+	testData := []struct {
+		code      int
+		authedOrg string
+		targetOrg string
+		expected  bool
+	}{
+		{AuthSyncAdmin, "org1", "org2", true},
+		{AuthSyncAdmin, "", "org1", true},
+		{AuthAdmin, "org1", "org1", true},
+		{AuthAdmin, "org1", "org2", false},
+		{AuthUser, "org1", "org1", true},
+		{AuthUser, "org1", "org2", false},
+		{AuthNodeUser, "org1", "org2", false},
+		{AuthEdgeNode, "org1", "org1", true},
+		{AuthService, "org1", "org2", false},
+		{AuthFailed, "org1", "org1", false},
+		{AuthFailed, "", "", false},
+	}
+
+	for _, test := range testData {
+		if result := AuthorizeOrgAccess(test.code, test.authedOrg, test.targetOrg); result != test.expected {
+			t.Errorf("AuthorizeOrgAccess(%d, %s, %s) returned %t instead of %t", test.code, test.authedOrg, test.targetOrg, result, test.expected)
+		}
+	}
+}
+
+func TestDummyAuthenticateKeyFormats(t *testing.T) {
+	auth := &DummyAuthenticate{regularUsers: []string{"user1"}, syncAdmins: []string{"admin"}}
+
+	tests := []struct {
+		appKey   string
+		code     int
+		orgID    string
+		identity string
+	}{
+		{"myorg/device/dev1", AuthEdgeNode, "myorg", "device/dev1"},
+		{"myorg/user2", AuthAdmin, "myorg", "user2"},
+		{"myorg$plover$0.0.1$service1", AuthService, "myorg", "plover/0.0.1/service1"},
+		{"node1%myorg", AuthNodeUser, "myorg", "node1"},
+		{"user1@myorg", AuthUser, "myorg", "user1"},
+		{"user1@example.com@myorg", AuthAdmin, "myorg", "user1@example.com"},
+		{"admin@myorg", AuthSyncAdmin, "", "admin"},
+		{"user2@myorg", AuthAdmin, "myorg", "user2"},
+		{"a@b@c@d", AuthFailed, "", ""},
+		{"user2", AuthFailed, "", ""},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.SetBasicAuth(test.appKey, "")
+		code, orgID, identity := auth.Authenticate(request)
+		if code != test.code || orgID != test.orgID || identity != test.identity {
+			t.Errorf("Authenticate returned %d, %s, %s for the app key %s instead of %d, %s, %s", code, orgID, identity,
+				test.appKey, test.code, test.orgID, test.identity)
+		}
+	}
+
+	// Custom formats replace the default formats
+	formats, err := compileKeyFormats([]keyFormat{
+		{Kind: "edgeNode", Pattern: `^(?P<destType>[^.]+)\.(?P<destID>[^.]+)\.(?P<org>[^.]+)$`},
+		{Kind: "user", Pattern: `^(?P<org>[^#]+)#(?P<user>.+)$`},
+	})
+	if err != nil {
+		t.Errorf("Failed to compile the key formats. Error: %s", err)
+		return
+	}
+	auth.keyFormats = formats
+	tests = []struct {
+		appKey   string
+		code     int
+		orgID    string
+		identity string
+	}{
+		{"device.dev1.myorg", AuthEdgeNode, "myorg", "device/dev1"},
+		{"myorg#user1", AuthUser, "myorg", "user1"},
+		{"myorg/device/dev1", AuthFailed, "", ""},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.SetBasicAuth(test.appKey, "")
+		code, orgID, identity := auth.Authenticate(request)
+		if code != test.code || orgID != test.orgID || identity != test.identity {
+			t.Errorf("Authenticate returned %d, %s, %s for the app key %s instead of %d, %s, %s", code, orgID, identity,
+				test.appKey, test.code, test.orgID, test.identity)
+		}
+	}
+
+	invalidFormats := [][]keyFormat{
+		{{Kind: "unknown", Pattern: `^(?P<org>.*)$`}},
+		{{Kind: "user", Pattern: `^(?P<org>.*$`}},
+		{{Kind: "edgeNode", Pattern: `^(?P<org>[^/]*)/(?P<destID>.*)$`}},
+	}
+	for _, formats := range invalidFormats {
+		if _, err := compileKeyFormats(formats); err == nil {
+			t.Errorf("compileKeyFormats didn't reject the invalid format %s: %s", formats[0].Kind, formats[0].Pattern)
+		}
+	}
+}
+
+func TestTokenAuthenticate(t *testing.T) {
+	savedStore := Store
+	defer func() {
+		Store = savedStore
+	}()
+	Store = &storage.TestStorage{}
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize the storage. Error: %s", err)
+		return
+	}
+	defer Store.Stop()
+
+	auth := &TokenAuthenticate{}
+	token, err := CreateAPIToken("myorg", "user1", "admin", time.Time{})
+	if err != nil {
+		t.Errorf("Failed to create an API token. Error: %s", err)
+		return
+	}
+	expiredToken, err := CreateAPIToken("myorg", "user2", "user", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Errorf("Failed to create an API token. Error: %s", err)
+		return
+	}
+	if _, err := CreateAPIToken("myorg", "user3", "superuser", time.Time{}); err == nil {
+		t.Errorf("Created an API token with an invalid role")
+	}
+
+	tests := []struct {
+		header   string
+		code     int
+		orgID    string
+		identity string
+	}{
+		{"Bearer " + token, AuthAdmin, "myorg", "user1"},
+		{"bearer " + token, AuthAdmin, "myorg", "user1"},
+		{"Bearer " + expiredToken, AuthFailed, "", ""},
+		{"Bearer unknown", AuthFailed, "", ""},
+		{"Bearer ", AuthFailed, "", ""},
+		{"", AuthFailed, "", ""},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		if test.header != "" {
+			request.Header.Set("Authorization", test.header)
+		}
+		code, orgID, identity := auth.Authenticate(request)
+		if code != test.code || orgID != test.orgID || identity != test.identity {
+			t.Errorf("Authenticate returned %d, %s, %s for the header %s instead of %d, %s, %s", code, orgID, identity,
+				test.header, test.code, test.orgID, test.identity)
+		}
+	}
+
+	// Revoked tokens are rejected immediately
+	if err := Store.RevokeAPIToken(HashAPIToken(token)); err != nil {
+		t.Errorf("Failed to revoke an API token. Error: %s", err)
+	}
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	if code, _, _ := auth.Authenticate(request); code != AuthFailed {
+		t.Errorf("Authenticate returned %d for a revoked token instead of %d", code, AuthFailed)
+	}
+}
+
+func TestOrgMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orgmapping")
+	if err != nil {
+		t.Errorf("Failed to create a temporary directory. Error: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "org-mapping.json")
+
+	mapping := NewOrgMapping(path)
+	if _, _, ok := mapping.Map(map[string][]string{"groups": {"admins"}}); ok {
+		t.Errorf("Map succeeded without a mapping file")
+	}
+
+	contents := `{"defaultOrg": "myorg", "defaultRole": "user", "mappings": [
+		{"claim": "groups", "value": "admins", "org": "myorg", "role": "admin"},
+		{"claim": "department", "value": "ops", "org": "opsorg", "role": "syncadmin"}]}`
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Errorf("Failed to write the mapping file. Error: %s", err)
+		return
+	}
+	mapping.lastCheck = time.Time{}
+
+	tests := []struct {
+		claims map[string][]string
+		orgID  string
+		code   int
+	}{
+		{map[string][]string{"groups": {"users", "admins"}}, "myorg", AuthAdmin},
+		{map[string][]string{"department": {"ops"}, "groups": {"admins"}}, "myorg", AuthAdmin},
+		{map[string][]string{"department": {"ops"}}, "opsorg", AuthSyncAdmin},
+		{map[string][]string{"groups": {"others"}}, "myorg", AuthUser},
+		{nil, "myorg", AuthUser},
+	}
+	for _, test := range tests {
+		orgID, code, ok := mapping.Map(test.claims)
+		if !ok || orgID != test.orgID || code != test.code {
+			t.Errorf("Map returned %s, %d, %t for the claims %v instead of %s, %d", orgID, code, ok, test.claims, test.orgID, test.code)
+		}
+	}
+
+	// An invalid file is ignored, the previous mapping is kept
+	if err := ioutil.WriteFile(path, []byte(`{"mappings": [{"claim": "groups", "value": "admins", "org": "myorg", "role": "root"}]}`), 0644); err != nil {
+		t.Errorf("Failed to write the mapping file. Error: %s", err)
+		return
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	mapping.lastCheck = time.Time{}
+	if orgID, code, _ := mapping.Map(map[string][]string{"groups": {"admins"}}); orgID != "myorg" || code != AuthAdmin {
+		t.Errorf("Map returned %s, %d after an invalid mapping file was written instead of myorg, %d", orgID, code, AuthAdmin)
+	}
+
+	// A modified file is reloaded
+	if err := ioutil.WriteFile(path, []byte(`{"mappings": [{"claim": "groups", "value": "admins", "org": "neworg", "role": "user"}]}`), 0644); err != nil {
+		t.Errorf("Failed to write the mapping file. Error: %s", err)
+		return
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute))
+	mapping.lastCheck = time.Time{}
+	if orgID, code, _ := mapping.Map(map[string][]string{"groups": {"admins"}}); orgID != "neworg" || code != AuthUser {
+		t.Errorf("Map returned %s, %d after the mapping file was modified instead of neworg, %d", orgID, code, AuthUser)
+	}
+	if _, _, ok := mapping.Map(map[string][]string{"groups": {"others"}}); ok {
+		t.Errorf("Map succeeded without a matching mapping or a default org")
+	}
+}
+
+type countingAuthenticate struct {
+	calls int
+}
+
+func (auth *countingAuthenticate) Start() {
+}
+
+func (auth *countingAuthenticate) Authenticate(request *http.Request) (int, string, string) {
+	auth.calls++
+	if appKey, appSecret, ok := request.BasicAuth(); ok && appSecret == "secret" {
+		return AuthUser, "myorg", appKey
+	}
+	return AuthFailed, "", ""
+}
+
+func (auth *countingAuthenticate) KeyandSecretForURL(url string) (string, string) {
+	return "", ""
+}
+
+func TestLockingAuthenticate(t *testing.T) {
+	savedThreshold := common.Configuration.AuthFailureThreshold
+	savedDuration := common.Configuration.AuthLockoutDuration
+	savedLimit := common.Configuration.AuthFailureTrackingLimit
+	defer func() {
+		common.Configuration.AuthFailureThreshold = savedThreshold
+		common.Configuration.AuthLockoutDuration = savedDuration
+		common.Configuration.AuthFailureTrackingLimit = savedLimit
+	}()
+	common.Configuration.AuthFailureThreshold = 3
+	common.Configuration.AuthLockoutDuration = 60
+	common.Configuration.AuthFailureTrackingLimit = 10
+
+	wrapped := &countingAuthenticate{}
+	auth := &LockingAuthenticate{Authenticator: wrapped}
+	auth.Start()
+
+	newRequest := func(remoteAddr string, appKey string, appSecret string) *http.Request {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = remoteAddr
+		request.SetBasicAuth(appKey, appSecret)
+		return request
+	}
+
+	// A successful authentication resets the failures of the identity
+	for i := 0; i < 2; i++ {
+		auth.Authenticate(newRequest(fmt.Sprintf("10.0.0.%d:1234", i), "user1", "wrong"))
+	}
+	if code, _, _ := auth.Authenticate(newRequest("10.0.1.1:1234", "user1", "secret")); code != AuthUser {
+		t.Errorf("Authenticate returned %d instead of %d", code, AuthUser)
+	}
+
+	// The identity is locked after 3 consecutive failures, from any address
+	for i := 0; i < 3; i++ {
+		auth.Authenticate(newRequest(fmt.Sprintf("10.0.2.%d:1234", i), "user1", "wrong"))
+	}
+	calls := wrapped.calls
+	if code, _, _ := auth.Authenticate(newRequest("10.0.3.1:1234", "user1", "secret")); code != AuthFailed {
+		t.Errorf("Authenticate of a locked identity returned %d instead of %d", code, AuthFailed)
+	}
+	if wrapped.calls != calls {
+		t.Errorf("The wrapped authenticator was called for a locked identity")
+	}
+
+	// The address is locked after 3 consecutive failures, for any identity
+	for i := 0; i < 3; i++ {
+		auth.Authenticate(newRequest("10.0.4.1:1234", fmt.Sprintf("sprayed%d", i), "wrong"))
+	}
+	if code, _, _ := auth.Authenticate(newRequest("10.0.4.1:5678", "user2", "secret")); code != AuthFailed {
+		t.Errorf("Authenticate from a locked address returned %d instead of %d", code, AuthFailed)
+	}
+	if code, _, _ := auth.Authenticate(newRequest("10.0.5.1:1234", "user2", "secret")); code != AuthUser {
+		t.Errorf("Authenticate from another address returned %d instead of %d", code, AuthUser)
+	}
+
+	// The failures of an address expire after the lockout duration, even without a successful authentication
+	for i := 0; i < 2; i++ {
+		auth.Authenticate(newRequest("10.0.6.1:1234", fmt.Sprintf("expired%d", i), "wrong"))
+	}
+	auth.failures["ip:10.0.6.1"].lastFailure = time.Now().Add(-61 * time.Second)
+	auth.Authenticate(newRequest("10.0.6.1:1234", "expired2", "wrong"))
+	if code, _, _ := auth.Authenticate(newRequest("10.0.6.1:1234", "user2", "secret")); code != AuthUser {
+		t.Errorf("Authenticate from an address with expired failures returned %d instead of %d", code, AuthUser)
+	}
+
+	// The number of tracked identities and addresses is limited
+	for i := 0; i < 50; i++ {
+		auth.Authenticate(newRequest(fmt.Sprintf("10.1.0.%d:1234", i), fmt.Sprintf("user%d", i+10), "wrong"))
+	}
+	if len(auth.failures) > common.Configuration.AuthFailureTrackingLimit {
+		t.Errorf("%d identities and addresses are tracked, more than the limit of %d", len(auth.failures),
+			common.Configuration.AuthFailureTrackingLimit)
+	}
+}
@@ -0,0 +1,114 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// TokenAuthenticate is an implementation of the Authenticate interface that uses long-lived API tokens
+// stored in the Sync Service's storage.
+//
+// Requests are authenticated by a header of the form:
+//
+//    Authorization: Bearer <token>
+//
+// The token is hashed and the hash is looked up in the storage, which holds the org, the identity,
+// the role, and the expiration of the token. Tokens are created with CreateAPIToken and revoked with
+// the storage's RevokeAPIToken. The tokens are looked up on every request, so that a revoked token
+// is rejected immediately.
+type TokenAuthenticate struct {
+}
+
+const apiTokenLength = 32
+
+// Start initializes the TokenAuthenticate struct
+func (auth *TokenAuthenticate) Start() {
+}
+
+// Authenticate  authenticates a particular HTTP request and indicates
+// whether it is an edge node, org admin, or plain user. Also returned is the
+// user's org and identitity. An edge node's identity is destType/destID. A
+// service's identity is serviceOrg/version/serviceName.
+func (auth *TokenAuthenticate) Authenticate(request *http.Request) (int, string, string) {
+	token := bearerToken(request)
+	if token == "" || Store == nil {
+		return AuthFailed, "", ""
+	}
+
+	apiToken, err := Store.RetrieveAPIToken(HashAPIToken(token))
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to retrieve an API token. Error: %s\n", err)
+		}
+		return AuthFailed, "", ""
+	}
+	if apiToken == nil {
+		return AuthFailed, "", ""
+	}
+
+	if apiToken.Expiration != "" {
+		expiration, err := time.Parse(time.RFC3339, apiToken.Expiration)
+		if err != nil || !time.Now().Before(expiration) {
+			return AuthFailed, "", ""
+		}
+	}
+
+	code, ok := roleAuthCodes[strings.ToLower(apiToken.Role)]
+	if !ok {
+		return AuthFailed, "", ""
+	}
+	return code, apiToken.OrgID, apiToken.Identity
+}
+
+// KeyandSecretForURL returns an app key and an app secret pair to be
+// used by the ESS when communicating with the specified URL.
+func (auth *TokenAuthenticate) KeyandSecretForURL(url string) (string, string) {
+	return "", ""
+}
+
+// CreateAPIToken creates a new API token for the identity in the organization, with the specified role.
+// A zero expiration means that the token doesn't expire. The token is returned, only its hash is stored.
+func CreateAPIToken(orgID string, identity string, role string, expiration time.Time) (string, common.SyncServiceError) {
+	if _, ok := roleAuthCodes[strings.ToLower(role)]; !ok {
+		return "", &common.InvalidRequest{Message: fmt.Sprintf("Invalid API token role %s", role)}
+	}
+
+	bytes := make([]byte, apiTokenLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", &common.SecurityError{Message: fmt.Sprintf("Failed to generate an API token. Error: %s", err)}
+	}
+	token := hex.EncodeToString(bytes)
+
+	apiToken := common.APIToken{Hash: HashAPIToken(token), OrgID: orgID, Identity: identity, Role: strings.ToLower(role)}
+	if !expiration.IsZero() {
+		apiToken.Expiration = expiration.UTC().Format(time.RFC3339)
+	}
+	if err := Store.StoreAPIToken(apiToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// HashAPIToken returns the hash of an API token, as stored in the storage
+func HashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// bearerToken returns the token of the Bearer Authorization header of the request, or an empty string
+func bearerToken(request *http.Request) string {
+	header := request.Header.Get("Authorization")
+	if len(header) <= len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[len("Bearer "):])
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +27,7 @@ type BoltStorage struct {
 	timebase      int64
 	lockChannel   chan int
 	localDataPath string
+	uploads       map[string]*uploadProgress
 }
 
 type boltObject struct {
@@ -37,11 +40,20 @@ type boltObject struct {
 	ConsumedTimestamp                time.Time                       `json:"consumed-timestamp"`
 	Destinations                     []common.StoreDestinationStatus `json:"destinations"`
 	RemovedDestinationPolicyServices []common.ServiceID              `json:"removed-destination-policy-services"`
+	PreviousStatus                   string                          `json:"previous-status,omitempty"`
+	LastUpdate                       time.Time                       `json:"last-update"`
+	DataComplete                     bool                            `json:"data-complete"`
 }
 
 type boltDestination struct {
-	Destination  common.Destination `json:"destination"`
-	LastPingTime time.Time          `json:"last-ping-time"`
+	Destination   common.Destination `json:"destination"`
+	LastPingTime  time.Time          `json:"last-ping-time"`
+	LastConnected time.Time          `json:"last-connected"`
+}
+
+type boltObjectVersion struct {
+	Meta     common.MetaData `json:"meta"`
+	DataPath string          `json:"data-path"`
 }
 
 type boltMessagingGroup struct {
@@ -66,12 +78,21 @@ var (
 	messagingGroupsBucket []byte
 	organizationsBucket   []byte
 	aclBucket             []byte
+	aclGroupsBucket       []byte
+	apiTokensBucket       []byte
+	auditBucket           []byte
+	objectVersionsBucket  []byte
+	idempotencyKeysBucket []byte
+	retentionBucket       []byte
+	webhookPoliciesBucket []byte
+	webhookFailuresBucket []byte
 )
 
 // Init initializes the Bolt store
 func (store *BoltStorage) Init() common.SyncServiceError {
 	store.lockChannel = make(chan int, 1)
 	store.lockChannel <- 1
+	store.uploads = make(map[string]*uploadProgress)
 
 	path := common.Configuration.PersistenceRootPath + "/sync/db/"
 
@@ -97,6 +118,14 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 	messagingGroupsBucket = []byte(messagingGroups)
 	organizationsBucket = []byte(organizations)
 	aclBucket = []byte(acls)
+	aclGroupsBucket = []byte(aclGroups)
+	apiTokensBucket = []byte(apiTokens)
+	auditBucket = []byte(audit)
+	objectVersionsBucket = []byte(objectVersions)
+	idempotencyKeysBucket = []byte(idempotencyKeys)
+	retentionBucket = []byte(retentionPolicies)
+	webhookPoliciesBucket = []byte(webhookPolicies)
+	webhookFailuresBucket = []byte(webhookFailures)
 
 	err = store.db.Update(func(tx *bolt.Tx) error {
 		_, err = tx.CreateBucketIfNotExists(objectsBucket)
@@ -127,6 +156,38 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 		if err != nil {
 			return err
 		}
+		_, err = tx.CreateBucketIfNotExists(aclGroupsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(apiTokensBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(auditBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(objectVersionsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(idempotencyKeysBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(retentionBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(webhookPoliciesBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(webhookFailuresBucket)
+		if err != nil {
+			return err
+		}
 		b, err := tx.CreateBucketIfNotExists(timebaseBucket)
 		if err != nil {
 			return err
@@ -161,6 +222,11 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 	}
 	err = os.MkdirAll(path, 0750)
 	store.localDataPath = "file://" + path
+	if err == nil && common.Configuration.DataURISharding && len(common.Configuration.ObjectsDataPath) == 0 {
+		if err = dataURI.AddShardedDirectory(path); err == nil {
+			err = dataURI.AddShardedDirectory(path + "versions/")
+		}
+	}
 	if err == nil {
 		common.HealthStatus.ReconnectedToDatabase()
 	}
@@ -178,7 +244,7 @@ func (store *BoltStorage) PerformMaintenance() {
 		currentTime := time.Now().UTC().Format(time.RFC3339)
 
 		function := func(object boltObject) bool {
-			if object.Meta.Expiration != "" && object.Meta.Expiration <= currentTime &&
+			if object.Meta.Expiration != "" && object.Meta.Expiration <= currentTime && !object.Meta.Pinned &&
 				(object.Status == common.ReadyToSend || object.Status == common.NotReadyToSend) {
 				return true
 			}
@@ -193,6 +259,25 @@ func (store *BoltStorage) PerformMaintenance() {
 		} else if trace.IsLogging(logger.TRACE) {
 			trace.Trace("Removing expired objects")
 		}
+
+		store.applyRetentionPolicies()
+		store.pruneObjectVersions()
+
+		if maxAge := completedNotificationsMaxAge(); maxAge > 0 {
+			if _, err := store.PurgeCompletedNotifications("", maxAge); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Error in PerformMaintenance: failed to purge completed notifications. Error: %s\n", err)
+			}
+		}
+	}
+
+	if maxAge := auditLogMaxAge(); maxAge > 0 {
+		if err := store.PurgeAuditLog(maxAge); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in PerformMaintenance: failed to purge the audit log. Error: %s\n", err)
+		}
+	}
+
+	if err := store.pruneIdempotencyKeys(); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in PerformMaintenance: failed to remove expired idempotency keys. Error: %s\n", err)
 	}
 }
 
@@ -232,7 +317,24 @@ func (store *BoltStorage) Cleanup(isTest bool) common.SyncServiceError {
 
 // StoreObject stores an object
 // If the object already exists, return the changes in its destinations list (for CSS) - return the list of deleted destinations
-func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, status string, identity string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	deletedDests, err := store.storeObject(metaData, data, status)
+	if err != nil {
+		return nil, err
+	}
+	store.addAuditRecord(newAuditRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.AuditStore, status, identity))
+	return deletedDests, nil
+}
+
+func (store *BoltStorage) storeObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	if err := metaData.Validate(); err != nil {
+		return nil, err
+	}
+	normalizeObjectTimes(&metaData)
+	if err := store.storeObjectVersion(metaData); err != nil {
+		return nil, err
+	}
+
 	var dests []common.StoreDestinationStatus
 	var deletedDests []common.StoreDestinationStatus
 
@@ -303,8 +405,9 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 	}
 	newObject := boltObject{Meta: metaData, Status: status, PolicyReceived: false,
 		RemainingConsumers: metaData.ExpectedConsumers, RemainingReceivers: metaData.ExpectedConsumers,
-		DataPath: dataPath, Destinations: dests}
+		DataPath: dataPath, Destinations: dests, LastUpdate: time.Now(), DataComplete: storedDataComplete(metaData, data, false)}
 
+	previousDataPath := ""
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
 		if (object.Meta.DestinationPolicy == nil && metaData.DestinationPolicy != nil) ||
 			(object.Meta.DestinationPolicy != nil && metaData.DestinationPolicy == nil) {
@@ -314,9 +417,15 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 		if metaData.DestinationPolicy != nil {
 			newObject.Destinations = object.Destinations
 		}
+		previousDataPath = object.DataPath
 		return newObject, nil
 	}
 	err := store.updateObjectHelper(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, function)
+	if err == nil && previousDataPath != "" && previousDataPath != dataPath &&
+		previousDataPath != createDataPathFromMeta(store.localDataPath, metaData) {
+		// The previous data was written by ReplaceObject
+		dataURI.DeleteStoredData(previousDataPath)
+	}
 	if err == notFound {
 		// Not found, insert
 		encoded, err := json.Marshal(newObject)
@@ -339,11 +448,17 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 func (store *BoltStorage) StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
 
 	dataPath := createDataPath(store.localDataPath, orgID, objectType, objectID)
-	written, err := dataURI.StoreData(dataPath, dataReader, 0)
+	limiter := newObjectSizeLimiter(objectType, dataReader, 0)
+	written, err := dataURI.StoreData(dataPath, limiter, 0)
 	if err != nil {
+		if limiter.exceeded != nil {
+			dataURI.DeleteStoredData(dataPath + ".tmp")
+			return false, limiter.exceeded
+		}
 		return false, err
 	}
 
+	previousDataPath := ""
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
 		if object.Status == common.NotReadyToSend {
 			object.Status = common.ReadyToSend
@@ -354,8 +469,10 @@ func (store *BoltStorage) StoreObjectData(orgID string, objectType string, objec
 			object.Meta.DataID = newID
 		}
 
+		previousDataPath = object.DataPath
 		object.DataPath = dataPath
 		object.Meta.ObjectSize = written
+		object.DataComplete = true
 
 		return object, nil
 	}
@@ -365,10 +482,78 @@ func (store *BoltStorage) StoreObjectData(orgID string, objectType string, objec
 		}
 		return false, err
 	}
+	if previousDataPath != "" && previousDataPath != dataPath {
+		// The previous data was written by ReplaceObject
+		dataURI.DeleteStoredData(previousDataPath)
+	}
 
 	return true, nil
 }
 
+// ReplaceObject replaces the meta data and the data of an existing object.
+// The data is written to a new file, and the object is switched to the new meta data and file only after the data
+// was written, so that readers see either the previous meta data and data or the new ones.
+// The file of the previous data is removed after the switch. The status and the destinations of the object are kept.
+func (store *BoltStorage) ReplaceObject(metaData common.MetaData, dataReader io.Reader, identity string) common.SyncServiceError {
+	if err := checkReplacementMetaData(metaData); err != nil {
+		return err
+	}
+	normalizeObjectTimes(&metaData)
+	if err := store.storeObjectVersion(metaData); err != nil {
+		return err
+	}
+
+	newID := store.getInstanceID()
+	dataPath := createDataPathFromMeta(store.localDataPath, metaData) + "-" + strconv.FormatInt(newID, 10)
+	limiter := newObjectSizeLimiter(metaData.ObjectType, dataReader, 0)
+	written, err := dataURI.StoreData(dataPath, limiter, 0)
+	if err != nil {
+		if limiter.exceeded != nil {
+			dataURI.DeleteStoredData(dataPath + ".tmp")
+			return limiter.exceeded
+		}
+		return err
+	}
+
+	previousDataPath := ""
+	status := ""
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		if (metaData.DestinationPolicy != nil) != (object.Meta.DestinationPolicy != nil) {
+			return object, &common.InvalidRequest{Message: "Can't update the existence of Destination Policy"}
+		}
+		if object.Status == common.NotReadyToSend || object.Status == common.ReadyToSend {
+			metaData.InstanceID = newID
+			metaData.DataID = newID
+		} else {
+			metaData.InstanceID = object.Meta.InstanceID
+			metaData.DataID = object.Meta.DataID
+		}
+		if metaData.DestinationPolicy != nil {
+			metaData.DestinationPolicy.Timestamp = time.Now().UTC().UnixNano()
+		}
+		metaData.ObjectSize = written
+
+		previousDataPath = object.DataPath
+		status = object.Status
+		object.Meta = metaData
+		object.DataPath = dataPath
+		object.DataComplete = true
+		return object, nil
+	}
+	if err := store.updateObjectHelper(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, function); err != nil {
+		dataURI.DeleteStoredData(dataPath)
+		return err
+	}
+
+	if previousDataPath != "" && previousDataPath != dataPath {
+		if err := dataURI.DeleteStoredData(previousDataPath); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to remove the replaced data of the object %s. Error: %s\n", getObjectCollectionID(metaData), err)
+		}
+	}
+	store.addAuditRecord(newAuditRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.AuditStore, status, identity))
+	return nil
+}
+
 func (store *BoltStorage) StoreObjectTempData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
 	tmpDataPath := createDataPathForTempData(store.localDataPath, orgID, objectType, objectID)
 	_, err := dataURI.StoreData(tmpDataPath, dataReader, 0)
@@ -413,11 +598,68 @@ func (store *BoltStorage) RetrieveObject(orgID string, objectType string, object
 	return meta, nil
 }
 
+// RetrieveObjectsByIDs returns the meta data of the objects with the provided keys, in the order of the keys.
+// Objects that don't exist are omitted from the result.
+func (store *BoltStorage) RetrieveObjectsByIDs(orgID string, keys []common.ObjectKey) ([]common.MetaData, common.SyncServiceError) {
+	metaDatas := make([]common.MetaData, 0, len(keys))
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(objectsBucket)
+		for _, key := range keys {
+			encoded := bucket.Get([]byte(createObjectCollectionID(orgID, key.ObjectType, key.ObjectID)))
+			if encoded == nil {
+				continue
+			}
+			var object boltObject
+			if err := json.Unmarshal(encoded, &object); err != nil {
+				return err
+			}
+			metaDatas = append(metaDatas, object.Meta)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectMetadataBatch returns the meta data of the objects with the provided keys, in the order of the keys,
+// with only the requested fields set
+func (store *BoltStorage) RetrieveObjectMetadataBatch(orgID string, keys []common.ObjectKey, fields []string) ([]common.MetaData,
+	common.SyncServiceError) {
+	return retrieveObjectMetadataBatch(store, orgID, keys, fields)
+}
+
+// RetrieveObjectInstanceID returns the instance ID of the stored object, or 0 if the object doesn't exist
+func (store *BoltStorage) RetrieveObjectInstanceID(orgID string, objectType string, objectID string) (int64, common.SyncServiceError) {
+	var instanceID int64
+	function := func(object boltObject) common.SyncServiceError {
+		instanceID = object.Meta.InstanceID
+		return nil
+	}
+	if err := store.viewObjectHelper(orgID, objectType, objectID, function); err != nil {
+		if common.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return instanceID, nil
+}
+
 // RetrieveObjectData returns the object data with the specified parameters
-func (store *BoltStorage) RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
+func (store *BoltStorage) RetrieveObjectData(orgID string, objectType string, objectID string, identity string) (io.Reader, common.SyncServiceError) {
 	var dataReader io.Reader
+	var dataSize int64
 	function := func(object boltObject) common.SyncServiceError {
 		var err error
+		dataSize = object.Meta.ObjectSize
+		if object.Meta.NoData {
+			return nil
+		}
+		if object.Meta.SourceDataURI != "" {
+			dataReader, err = dataURI.GetData(object.Meta.SourceDataURI)
+			return err
+		}
 		if object.DataPath != "" {
 			dataReader, err = dataURI.GetData(object.DataPath)
 			return err
@@ -430,15 +672,111 @@ func (store *BoltStorage) RetrieveObjectData(orgID string, objectType string, ob
 		}
 		return nil, err
 	}
+	if dataReader != nil && dataAccessLogged(identity) {
+		store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, dataSize))
+	}
 	return dataReader, nil
 }
 
+// RetrieveObjectVersions returns the meta data of the kept previous versions of the object, ordered by instance ID
+func (store *BoltStorage) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
+	function := func(version boltObjectVersion) {
+		if version.Meta.DestOrgID == orgID && version.Meta.ObjectType == objectType && version.Meta.ObjectID == objectID {
+			result = append(result, version.Meta)
+		}
+	}
+	if err := store.retrieveObjectVersionsHelper(function); err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].InstanceID < result[j].InstanceID })
+	return result, nil
+}
+
+// RetrieveObjectVersion returns the meta data and the data of a kept previous version of the object
+func (store *BoltStorage) RetrieveObjectVersion(orgID string, objectType string, objectID string, instanceID int64) (*common.MetaData, io.Reader, common.SyncServiceError) {
+	id := createObjectVersionCollectionID(orgID, objectType, objectID, instanceID)
+	var version *boltObjectVersion
+	err := store.db.View(func(tx *bolt.Tx) error {
+		encoded := tx.Bucket(objectVersionsBucket).Get([]byte(id))
+		if encoded == nil {
+			return nil
+		}
+		version = &boltObjectVersion{}
+		return json.Unmarshal(encoded, version)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if version == nil {
+		return nil, nil, nil
+	}
+	if version.DataPath == "" {
+		return &version.Meta, nil, nil
+	}
+
+	dataReader, err := dataURI.GetData(version.DataPath)
+	if err != nil {
+		if common.IsNotFound(err) {
+			return &version.Meta, nil, nil
+		}
+		return nil, nil, err
+	}
+	return &version.Meta, dataReader, nil
+}
+
+// IsIdempotencyKeyRecorded returns true if the idempotency key was recorded for an update of the object
+// within the last IdempotencyKeyWindow seconds
+func (store *BoltStorage) IsIdempotencyKeyRecorded(orgID string, objectType string, objectID string, key string) (bool, common.SyncServiceError) {
+	if common.Configuration.IdempotencyKeyWindow <= 0 {
+		return false, nil
+	}
+	id := createIdempotencyKeyID(orgID, objectType, objectID, key)
+	recorded := false
+	err := store.db.View(func(tx *bolt.Tx) error {
+		encoded := tx.Bucket(idempotencyKeysBucket).Get([]byte(id))
+		if encoded == nil {
+			return nil
+		}
+		var timestamp time.Time
+		if err := json.Unmarshal(encoded, &timestamp); err != nil {
+			return err
+		}
+		recorded = !idempotencyKeyExpired(timestamp)
+		return nil
+	})
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Failed to fetch the idempotency key. Error: %s.", err)}
+	}
+	return recorded, nil
+}
+
+// RecordIdempotencyKey records the idempotency key of a successful update of the object.
+// Expired keys are removed by PerformMaintenance.
+func (store *BoltStorage) RecordIdempotencyKey(orgID string, objectType string, objectID string, key string) common.SyncServiceError {
+	if common.Configuration.IdempotencyKeyWindow <= 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(time.Now())
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to encode the idempotency key. Error: %s.", err)}
+	}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(idempotencyKeysBucket).Put([]byte(createIdempotencyKeyID(orgID, objectType, objectID, key)), encoded)
+	})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to record the idempotency key. Error: %s.", err)}
+	}
+	return nil
+}
+
 // RetrieveObjectAndStatus returns the object meta data and status with the specified parameters
 func (store *BoltStorage) RetrieveObjectAndStatus(orgID string, objectType string, objectID string) (*common.MetaData, string, common.SyncServiceError) {
 	var meta *common.MetaData
 	var status string
 	function := func(object boltObject) common.SyncServiceError {
 		meta = &object.Meta
+		meta.DataComplete = object.DataComplete
 		status = object.Status
 		return nil
 	}
@@ -451,6 +789,30 @@ func (store *BoltStorage) RetrieveObjectAndStatus(orgID string, objectType strin
 	return meta, status, nil
 }
 
+// RetrieveObjectIfModifiedSince returns the object meta data and status if the object was modified after the given time
+func (store *BoltStorage) RetrieveObjectIfModifiedSince(orgID string, objectType string, objectID string, since time.Time) (*common.MetaData, string, bool, common.SyncServiceError) {
+	var meta *common.MetaData
+	var status string
+	modified := true
+	function := func(object boltObject) common.SyncServiceError {
+		// Objects stored before the last update time was recorded are always considered modified
+		if !object.LastUpdate.IsZero() && !object.LastUpdate.After(since) {
+			modified = false
+			return nil
+		}
+		meta = &object.Meta
+		status = object.Status
+		return nil
+	}
+	if err := store.viewObjectHelper(orgID, objectType, objectID, function); err != nil {
+		if common.IsNotFound(err) {
+			return nil, "", true, nil
+		}
+		return nil, "", false, err
+	}
+	return meta, status, modified, nil
+}
+
 // RetrieveObjectStatus finds the object and returns its status
 func (store *BoltStorage) RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError) {
 	var status string
@@ -475,20 +837,28 @@ func (store *BoltStorage) RetrieveUpdatedObjects(orgID string, objectType string
 		if orgID == object.Meta.DestOrgID && objectType == object.Meta.ObjectType &&
 			(object.Status == common.CompletelyReceived || object.Status == common.ObjDeleted ||
 				(object.Status == common.ObjReceived && received)) {
+			if len(common.Configuration.ObjectsDataPath) > 0 {
+				// Data written before the file names were escaped is kept in its original file
+				object.Meta.DestinationDataURI = object.DataPath
+				if object.DataPath == "" {
+					object.Meta.DestinationDataURI = createDataPathFromMeta(store.localDataPath, object.Meta)
+				}
+			}
 			result = append(result, object.Meta)
 		}
 	}
 	if err := store.retrieveObjectsHelper(function); err != nil {
 		return nil, err
 	}
-	if len(common.Configuration.ObjectsDataPath) > 0 {
-		for i := 0; i < len(result); i++ {
-			result[i].DestinationDataURI = createDataPathFromMeta(store.localDataPath, result[i])
-		}
-	}
 	return result, nil
 }
 
+// WatchObjects returns a channel of the creation, update, and deletion events of the objects of the organization.
+// It isn't supported by this storage.
+func (store *BoltStorage) WatchObjects(orgID string) (<-chan common.ObjectEvent, func(), common.SyncServiceError) {
+	return nil, nil, &Error{"Watching objects is only supported by the MongoDB storage"}
+}
+
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
 func (store *BoltStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -678,83 +1048,77 @@ func (store *BoltStorage) RetrieveAllObjects(orgID string, objectType string) ([
 	return result, nil
 }
 
-// RetrieveObjects returns the list of all the objects that need to be sent to the destination
-// For CSS: adds the new destination to the destinations lists of the relevant objects.
-func (store *BoltStorage) RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError) {
-	result := make([]common.MetaData, 0)
-
-	if common.Configuration.NodeType == common.ESS {
-		function := func(object boltObject) {
-			if (orgID == object.Meta.DestOrgID || orgID == "") && !object.Meta.Inactive &&
-				object.Status == common.ReadyToSend &&
-				(object.Meta.DestType == "" || object.Meta.DestType == destType || destType == "") &&
-				(object.Meta.DestID == "" || object.Meta.DestID == destID || destID == "") {
-				result = append(result, object.Meta)
-			}
-		}
-		if err := store.retrieveObjectsHelper(function); err != nil {
-			return nil, err
+// RetrieveObjectStatusCounts returns the number of objects of the organization in each status.
+// If objectType is empty, the objects of all types are counted.
+func (store *BoltStorage) RetrieveObjectStatusCounts(orgID string, objectType string) (map[string]int, common.SyncServiceError) {
+	counts := make(map[string]int)
+	function := func(object boltObject) {
+		if orgID == object.Meta.DestOrgID && (objectType == "" || object.Meta.ObjectType == objectType) {
+			counts[object.Status]++
 		}
-		return result, nil
 	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
 
-	function := func(object boltObject) (*boltObject, common.SyncServiceError) {
-		if object.Meta.DestinationPolicy == nil && orgID == object.Meta.DestOrgID &&
-			(object.Meta.DestType == "" || object.Meta.DestType == destType) &&
-			(object.Meta.DestID == "" || object.Meta.DestID == destID) {
-			status := common.Pending
-			if object.Status == common.ReadyToSend && !object.Meta.Inactive {
-				status = common.Delivering
-			}
-			needToUpdate := false
-
-			// Add destination if it doesn't exist in the destinations list
-			if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil && dest != nil {
-				existingDestIndex := -1
-				for i, d := range object.Destinations {
-					if d.Destination == *dest {
-						existingDestIndex = i
-						break
-					}
-				}
-				if existingDestIndex != -1 {
-					d := object.Destinations[existingDestIndex]
-					if status == common.Delivering &&
-						(resend == common.ResendAll || (resend == common.ResendDelivered && d.Status != common.Consumed) ||
-							(resend == common.ResendUndelivered && d.Status != common.Consumed && d.Status != common.Delivered)) {
-						result = append(result, object.Meta)
-						object.Destinations[existingDestIndex].Status = common.Delivering
-						needToUpdate = true
-					}
-				} else {
-					if status == common.Delivering {
-						result = append(result, object.Meta)
-					}
-					needToUpdate = true
-					object.Destinations = append(object.Destinations, common.StoreDestinationStatus{Destination: *dest, Status: status})
-				}
-				if needToUpdate {
-					return &object, nil
-				}
-				return nil, nil
+// RetrieveStorageStatsByType returns the number of objects of the organization, the total declared size of their data,
+// and the total number of bytes used to store their data, per object type
+func (store *BoltStorage) RetrieveStorageStatsByType(orgID string) (map[string]common.ObjectTypeStorageStats, common.SyncServiceError) {
+	stats := make(map[string]common.ObjectTypeStorageStats)
+	function := func(object boltObject) {
+		if orgID != object.Meta.DestOrgID {
+			return
+		}
+		typeStats := stats[object.Meta.ObjectType]
+		typeStats.ObjectType = object.Meta.ObjectType
+		typeStats.ObjectCount++
+		typeStats.ObjectSize += object.Meta.ObjectSize
+		if object.DataPath != "" {
+			if size, err := dataURI.GetDataSize(object.DataPath); err == nil {
+				typeStats.StoredDataSize += size
 			}
 		}
-		return nil, nil
+		stats[object.Meta.ObjectType] = typeStats
 	}
-	if err := store.updateObjectsHelper(function); err != nil {
+	if err := store.retrieveObjectsHelper(function); err != nil {
 		return nil, err
 	}
+	return stats, nil
+}
 
+// RetrieveIncompleteObjects returns the objects of the organization that at least one of their destinations didn't consume
+func (store *BoltStorage) RetrieveIncompleteObjects(orgID string, objectType string) ([]common.IncompleteObject, common.SyncServiceError) {
+	result := make([]common.IncompleteObject, 0)
+	function := func(object boltObject) {
+		if orgID != object.Meta.DestOrgID || (objectType != "" && object.Meta.ObjectType != objectType) {
+			return
+		}
+		if incomplete, ok := incompleteObject(object.Meta, object.Destinations); ok {
+			result = append(result, incomplete)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	sortIncompleteObjects(result)
 	return result, nil
 }
 
-// RetrieveConsumedObjects returns all the consumed objects originated from this node
-func (store *BoltStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError) {
-	result := make([]common.ConsumedObject, 0)
+// RetrieveObjectsWithMissingData returns the objects of the organization whose data should be in the storage but isn't
+func (store *BoltStorage) RetrieveObjectsWithMissingData(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
 	function := func(object boltObject) {
-		if object.Status == common.ConsumedByDest {
-			result = append(result, common.ConsumedObject{MetaData: object.Meta, Timestamp: object.ConsumedTimestamp})
+		if orgID != object.Meta.DestOrgID || !objectExpectsData(object.Meta, object.Status) {
+			return
+		}
+		if object.DataPath != "" {
+			if _, exists, _, err := dataURI.Stat(object.DataPath); err == nil && exists {
+				return
+			}
 		}
+		result = append(result, object.Meta)
 	}
 	if err := store.retrieveObjectsHelper(function); err != nil {
 		return nil, err
@@ -762,27 +1126,210 @@ func (store *BoltStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, co
 	return result, nil
 }
 
-// GetObjectsToActivate returns inactive objects that are ready to be activated
-func (store *BoltStorage) GetObjectsToActivate() ([]common.MetaData, common.SyncServiceError) {
-	currentTime := time.Now().UTC().Format(time.RFC3339)
+// RetrieveObjectsBySizeAndAge returns the objects of the organization whose data size is at least minSize bytes
+// and that weren't updated for at least the given duration. The objects are ordered by decreasing data size.
+func (store *BoltStorage) RetrieveObjectsBySizeAndAge(orgID string, minSize int64, olderThan time.Duration) ([]common.MetaData,
+	common.SyncServiceError) {
+	before, err := objectsBySizeAndAgeLimit(minSize, olderThan)
+	if err != nil {
+		return nil, err
+	}
 	result := make([]common.MetaData, 0)
 	function := func(object boltObject) {
-		if (object.Status == common.NotReadyToSend || object.Status == common.ReadyToSend) &&
-			object.Meta.Inactive && object.Meta.ActivationTime != "" && object.Meta.ActivationTime <= currentTime {
+		if orgID == object.Meta.DestOrgID && object.Meta.ObjectSize >= minSize && !object.LastUpdate.After(before) {
 			result = append(result, object.Meta)
 		}
 	}
-
 	if err := store.retrieveObjectsHelper(function); err != nil {
 		return nil, err
 	}
-
+	sortBySizeDescending(result)
 	return result, nil
 }
 
-// AppendObjectData appends a chunk of data to the object's data
+// RetrieveObjectsApproachingDeadline returns the undelivered objects of the organization whose delivery deadline
+// is within the given duration from now, including objects that already missed their deadline.
+// The objects are ordered by their delivery deadline.
+func (store *BoltStorage) RetrieveObjectsApproachingDeadline(orgID string, within time.Duration) ([]common.MetaData, common.SyncServiceError) {
+	limit, err := deliveryDeadlineLimit(within)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if orgID == object.Meta.DestOrgID && isObjectApproachingDeadline(object.Meta, object.Status, object.Destinations, limit) {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	sortByDeliveryDeadline(result)
+	return result, nil
+}
+
+// RetrieveObjectsAcrossOrgs retrieves up to limit objects of all the organizations that match the filter,
+// ordered by organization, object type, and object ID, skipping the first offset objects
+func (store *BoltStorage) RetrieveObjectsAcrossOrgs(filter common.ObjectFilter, offset int, limit int) ([]common.MetaData, int, common.SyncServiceError) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, &common.InvalidRequest{Message: "Offset and limit must be non-negative numbers"}
+	}
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if objectMatchesFilter(object.Meta, filter) {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, 0, err
+	}
+	return pageObjects(result, offset, limit), len(result), nil
+}
+
+// RetrieveObjects returns the list of all the objects that need to be sent to the destination
+// For CSS: adds the new destination to the destinations lists of the relevant objects.
+func (store *BoltStorage) RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError) {
+	store.updateDestinationLastConnected(orgID, destType, destID)
+
+	result := make([]common.MetaData, 0)
+
+	if common.Configuration.NodeType == common.ESS {
+		function := func(object boltObject) {
+			if (orgID == object.Meta.DestOrgID || orgID == "") && !object.Meta.Inactive &&
+				object.Status == common.ReadyToSend &&
+				(object.Meta.DestType == "" || object.Meta.DestType == destType || destType == "") &&
+				(object.Meta.DestID == "" || object.Meta.DestID == destID || destID == "") {
+				result = append(result, object.Meta)
+			}
+		}
+		if err := store.retrieveObjectsHelper(function); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	objectTypePermitted, err := destinationObjectTypesFilter(store, orgID, destType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects are only sent to registered destinations
+	dest, err := store.RetrieveDestination(orgID, destType, destID)
+	if err != nil {
+		return nil, err
+	}
+	if dest == nil {
+		return result, nil
+	}
+
+	function := func(object boltObject) (*boltObject, common.SyncServiceError) {
+		if object.Meta.DestinationPolicy == nil && orgID == object.Meta.DestOrgID &&
+			(object.Meta.DestType == "" || object.Meta.DestType == destType) &&
+			(object.Meta.DestID == "" || object.Meta.DestID == destID) && objectTypePermitted(object.Meta.ObjectType) {
+			status := common.Pending
+			if object.Status == common.ReadyToSend && !object.Meta.Inactive {
+				status = common.Delivering
+				if deliveryLimitReached(len(result)) {
+					// Leave the object pending, it will be delivered when the destination's objects are retrieved again
+					status = common.Pending
+				}
+			}
+			needToUpdate := false
+
+			// Add destination if it doesn't exist in the destinations list
+			existingDestIndex := -1
+			for i, d := range object.Destinations {
+				if d.Destination == *dest {
+					existingDestIndex = i
+					break
+				}
+			}
+			if existingDestIndex != -1 {
+				d := object.Destinations[existingDestIndex]
+				if status == common.Delivering &&
+					(resend == common.ResendAll || (resend == common.ResendDelivered && d.Status != common.Consumed) ||
+						(resend == common.ResendUndelivered && d.Status != common.Consumed && d.Status != common.Delivered)) {
+					result = append(result, object.Meta)
+					setDeliveryStatus(&object.Destinations[existingDestIndex], common.Delivering)
+					needToUpdate = true
+				}
+			} else {
+				if status == common.Delivering {
+					result = append(result, object.Meta)
+				}
+				needToUpdate = true
+				d := common.StoreDestinationStatus{Destination: *dest}
+				setDeliveryStatus(&d, status)
+				object.Destinations = append(object.Destinations, d)
+			}
+			if needToUpdate {
+				return &object, nil
+			}
+			return nil, nil
+		}
+		return nil, nil
+	}
+	if err := store.updateObjectsHelper(function); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RetrieveObjectsForDestType returns the objects of the organization that are broadcast to all the destinations of the type
+func (store *BoltStorage) RetrieveObjectsForDestType(orgID string, destType string) ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if orgID == object.Meta.DestOrgID && object.Meta.Broadcast && object.Meta.DestType == destType {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RetrieveConsumedObjects returns all the consumed objects originated from this node
+func (store *BoltStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError) {
+	result := make([]common.ConsumedObject, 0)
+	function := func(object boltObject) {
+		if object.Status == common.ConsumedByDest {
+			result = append(result, common.ConsumedObject{MetaData: object.Meta, Timestamp: object.ConsumedTimestamp})
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetObjectsToActivate returns inactive objects that are ready to be activated
+func (store *BoltStorage) GetObjectsToActivate() ([]common.MetaData, common.SyncServiceError) {
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if (object.Status == common.NotReadyToSend || object.Status == common.ReadyToSend) &&
+			object.Meta.Inactive && object.Meta.ActivationTime != "" && object.Meta.ActivationTime <= currentTime {
+			result = append(result, object.Meta)
+		}
+	}
+
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AppendObjectData appends a chunk of data to the object's data
 func (store *BoltStorage) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32,
 	offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	if isFirstChunk {
+		if err := checkObjectSize(objectType, total); err != nil {
+			return err
+		}
+	}
 
 	dataPath := ""
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
@@ -794,23 +1341,86 @@ func (store *BoltStorage) AppendObjectData(orgID string, objectType string, obje
 			dataPath = createDataPathFromMeta(store.localDataPath, object.Meta)
 			object.DataPath = dataPath
 		}
+		if isFirstChunk {
+			object.DataComplete = false
+		}
 		return object, nil
 	}
 	if err := store.updateObjectHelper(orgID, objectType, objectID, function); err != nil {
 		return err
 	}
-	return dataURI.AppendData(dataPath, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+	limiter := newObjectSizeLimiter(objectType, dataReader, offset)
+	if err := dataURI.AppendData(dataPath, limiter, dataLength, offset, total, isFirstChunk, isLastChunk); err != nil {
+		if limiter.exceeded != nil {
+			dataURI.DeleteStoredData(dataPath + ".tmp")
+			store.endUpload(orgID, objectType, objectID)
+			return limiter.exceeded
+		}
+		return err
+	}
+	if isLastChunk {
+		store.endUpload(orgID, objectType, objectID)
+		function := func(object boltObject) (boltObject, common.SyncServiceError) {
+			object.DataComplete = true
+			return object, nil
+		}
+		return store.updateObjectHelper(orgID, objectType, objectID, function)
+	}
+	store.chunkUploaded(orgID, objectType, objectID, offset, int64(dataLength), isFirstChunk)
+	return nil
+}
+
+// AppendObjectDelta reconstructs the data of the object from its stored base data and a binary patch, and stores the result
+func (store *BoltStorage) AppendObjectDelta(orgID string, objectType string, objectID string, baseDataID int64, patch io.Reader,
+	size int64, hash string) common.SyncServiceError {
+	return appendObjectDelta(store, orgID, objectType, objectID, baseDataID, patch, size, hash)
 }
 
 // UpdateObjectStatus updates an object's status
-func (store *BoltStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError {
+func (store *BoltStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string, identity string) common.SyncServiceError {
+	var oldStatus string
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		oldStatus = object.Status
 		object.Status = status
 		if status == common.ConsumedByDest {
 			object.ConsumedTimestamp = time.Now()
 		}
 		return object, nil
 	}
+	if err := store.updateObjectHelper(orgID, objectType, objectID, function); err != nil {
+		return err
+	}
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditUpdateStatus, status, identity))
+	notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+		OldStatus: oldStatus, NewStatus: status})
+	return nil
+}
+
+// PatchObjectMetadata updates the specified fields of the object's meta data
+func (store *BoltStorage) PatchObjectMetadata(orgID string, objectType string, objectID string, patch map[string]interface{}) common.SyncServiceError {
+	fields, err := validateObjectMetadataPatch(patch)
+	if err != nil {
+		return err
+	}
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		applyObjectMetadataPatch(&object.Meta, fields)
+		return object, nil
+	}
+	return store.updateObjectHelper(orgID, objectType, objectID, function)
+}
+
+// TouchObject extends the expiration time of an object that is being delivered
+func (store *BoltStorage) TouchObject(orgID string, objectType string, objectID string, extendBy time.Duration) common.SyncServiceError {
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		expiration, err := touchObjectExpiration(object.Status, object.Meta, extendBy)
+		if err != nil {
+			return object, err
+		}
+		if expiration != "" {
+			object.Meta.Expiration = expiration
+		}
+		return object, nil
+	}
 	return store.updateObjectHelper(orgID, objectType, objectID, function)
 }
 
@@ -883,32 +1493,135 @@ func (store *BoltStorage) CloseDataReader(dataReader io.Reader) common.SyncServi
 	switch v := dataReader.(type) {
 	case *os.File:
 		return v.Close()
+	case io.Closer:
+		return v.Close()
 	}
 	return nil
 }
 
 // ReadObjectData returns the object data with the specified parameters
-func (store *BoltStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) (data []byte,
-	eof bool, length int, err common.SyncServiceError) {
+func (store *BoltStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64,
+	identity string) (data []byte, eof bool, length int, err common.SyncServiceError) {
+	var noData bool
 	function := func(object boltObject) common.SyncServiceError {
+		if object.Meta.NoData {
+			data, eof, noData = make([]byte, 0), true, true
+			return nil
+		}
+		if object.Meta.SourceDataURI != "" {
+			data, eof, length, err = dataURI.GetDataChunk(object.Meta.SourceDataURI, size, offset)
+			return err
+		}
 		if object.DataPath != "" {
 			data, eof, length, err = dataURI.GetDataChunk(object.DataPath, size, offset)
 			return err
 		}
 		eof = true
+		if objectExpectsData(object.Meta, object.Status) {
+			return &common.NotFound{}
+		}
 		return nil
 	}
 	err = store.viewObjectHelper(orgID, objectType, objectID, function)
+	if err == nil && !noData && dataAccessLogged(identity) {
+		// The record is added after the view transaction, which can't be nested with an update
+		store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, int64(length)))
+	}
 	return
 }
 
+// ReadPartialObjectData returns the object data with the specified parameters while the data may still be uploaded.
+// During an upload of the data by AppendObjectData, only the data up to the committed offset of the upload is returned,
+// and eof is false until the upload completes. Otherwise it is the same as ReadObjectData.
+func (store *BoltStorage) ReadPartialObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	committed, uploading := store.getUploadOffset(orgID, objectType, objectID)
+	if !uploading {
+		return store.ReadObjectData(orgID, objectType, objectID, size, offset, "")
+	}
+
+	s := committedReadSize(committed, size, offset)
+	if s == 0 {
+		return make([]byte, 0), false, 0, nil
+	}
+	var data []byte
+	var length int
+	function := func(object boltObject) common.SyncServiceError {
+		if object.DataPath == "" {
+			return &Error{"No path to read the uploaded data from"}
+		}
+		var err common.SyncServiceError
+		// The data is uploaded to a temporary file that is renamed when the upload completes
+		data, _, length, err = dataURI.GetDataChunk(object.DataPath+".tmp", int(s), offset)
+		return err
+	}
+	if err := store.viewObjectHelper(orgID, objectType, objectID, function); err != nil {
+		return nil, true, 0, err
+	}
+	return data, false, length, nil
+}
+
 // MarkObjectDeleted marks the object as deleted
-func (store *BoltStorage) MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError {
+func (store *BoltStorage) MarkObjectDeleted(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
+	var oldStatus string
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		oldStatus = object.Status
+		if object.Status != common.ObjDeleted {
+			object.PreviousStatus = object.Status
+		}
 		object.Status = common.ObjDeleted
 		object.Meta.Deleted = true
 		return object, nil
 	}
+	if err := store.updateObjectHelper(orgID, objectType, objectID, function); err != nil {
+		return err
+	}
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditMarkDeleted, common.ObjDeleted, identity))
+	notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+		OldStatus: oldStatus, NewStatus: common.ObjDeleted})
+	return nil
+}
+
+// RetrieveDeletedObjects returns the objects of the organization that were marked as deleted
+func (store *BoltStorage) RetrieveDeletedObjects(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
+	function := func(object boltObject) {
+		if orgID == object.Meta.DestOrgID && object.Status == common.ObjDeleted {
+			result = append(result, object.Meta)
+		}
+	}
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UndeleteObject restores an object marked as deleted to its status before the deletion
+// The object can be restored only if its data still exists
+func (store *BoltStorage) UndeleteObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		if err := checkObjectUndeletable(object.Status, object.PreviousStatus); err != nil {
+			return object, err
+		}
+		if objectDataRequired(object.Meta) {
+			if object.DataPath == "" {
+				return object, objectDataMissing
+			}
+			dataReader, err := dataURI.GetData(object.DataPath)
+			if err != nil {
+				if common.IsNotFound(err) {
+					return object, objectDataMissing
+				}
+				return object, err
+			}
+			if closer, ok := dataReader.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+		object.Status = object.PreviousStatus
+		object.PreviousStatus = ""
+		object.Meta.Deleted = false
+		return object, nil
+	}
 	return store.updateObjectHelper(orgID, objectType, objectID, function)
 }
 
@@ -930,8 +1643,26 @@ func (store *BoltStorage) ActivateObject(orgID string, objectType string, object
 	return store.updateObjectHelper(orgID, objectType, objectID, function)
 }
 
+// PinObject pins the object, so that it isn't deleted by AutoDelete or when it expires
+func (store *BoltStorage) PinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.setObjectPinned(orgID, objectType, objectID, true)
+}
+
+// UnpinObject unpins the object, so that AutoDelete and its expiration apply to it again
+func (store *BoltStorage) UnpinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.setObjectPinned(orgID, objectType, objectID, false)
+}
+
+func (store *BoltStorage) setObjectPinned(orgID string, objectType string, objectID string, pinned bool) common.SyncServiceError {
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		object.Meta.Pinned = pinned
+		return object, nil
+	}
+	return store.updateObjectHelper(orgID, objectType, objectID, function)
+}
+
 // DeleteStoredObject deletes the object
-func (store *BoltStorage) DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+func (store *BoltStorage) DeleteStoredObject(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
 	if err := store.DeleteStoredData(orgID, objectType, objectID); err != nil {
 		return nil
 	}
@@ -940,12 +1671,66 @@ func (store *BoltStorage) DeleteStoredObject(orgID string, objectType string, ob
 		err := tx.Bucket(objectsBucket).Delete([]byte(id))
 		return err
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditDelete, "", identity))
+	return nil
+}
+
+// DeleteObjectsOfType deletes all the objects of the type in the organization and their data
+func (store *BoltStorage) DeleteObjectsOfType(orgID string, objectType string) (int, common.SyncServiceError) {
+	deleted := 0
+	function := func(object boltObject) bool {
+		if object.Meta.DestOrgID == orgID && object.Meta.ObjectType == objectType {
+			deleted++
+			return true
+		}
+		return false
+	}
+	if err := store.deleteObjectsHelper(function); err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to delete objects. Error: %s.", err)}
+	}
+	return deleted, nil
+}
+
+// RetrieveAuditLog returns the audit log of the object's mutations, ordered by time
+func (store *BoltStorage) RetrieveAuditLog(orgID string, objectType string, objectID string) ([]common.AuditRecord, common.SyncServiceError) {
+	records := make([]common.AuditRecord, 0)
+	prefix := []byte(common.CreateCompositeID(orgID, objectType, objectID, ""))
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(auditBucket).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var record common.AuditRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// PurgeAuditLog deletes the audit records older than olderThan
+func (store *BoltStorage) PurgeAuditLog(olderThan time.Duration) common.SyncServiceError {
+	cutoff := time.Now().Add(-olderThan)
+	function := func(record common.AuditRecord) bool {
+		return record.Timestamp.Before(cutoff)
+	}
+	if err := store.deleteAuditRecordsHelper(function); err != nil {
+		return &Error{fmt.Sprintf("Failed to purge the audit log. Error: %s.", err)}
+	}
+	return nil
 }
 
 // DeleteStoredData deletes the object's data
 func (store *BoltStorage) DeleteStoredData(orgID string, objectType string, objectID string) common.SyncServiceError {
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		object.DataComplete = false
 		if object.DataPath == "" {
 			return object, nil
 		}
@@ -1065,16 +1850,18 @@ func (store *BoltStorage) UpdateObjectDeliveryStatus(status string, message stri
 	}
 
 	allDeleted := true
+	var oldStatus string
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
 		found := false
 		allConsumed := true
 		for i, d := range object.Destinations {
 			if !found && d.Destination.DestType == destType && d.Destination.DestID == destID {
+				oldStatus = d.Status
 				if message != "" || d.Status == common.Error {
 					object.Destinations[i].Message = message
 				}
 				if status != "" {
-					object.Destinations[i].Status = status
+					setDeliveryStatus(&object.Destinations[i], status)
 				}
 				found = true
 			} else {
@@ -1089,14 +1876,20 @@ func (store *BoltStorage) UpdateObjectDeliveryStatus(status string, message stri
 		if !found {
 			return object, &Error{"Failed to find destination."}
 		}
-		if object.Meta.AutoDelete && status == common.Consumed && allConsumed && object.Meta.Expiration == "" {
+		if object.Meta.AutoDelete && !object.Meta.Pinned && status == common.Consumed && allConsumed && object.Meta.Expiration == "" {
 			// Delete the object by setting its expiration time to one hour
 			object.Meta.Expiration = time.Now().Add(time.Hour * time.Duration(1)).UTC().Format(time.RFC3339)
 		}
 		return object, nil
 	}
-	err := store.updateObjectHelper(orgID, objectType, objectID, function)
-	return (allDeleted && status == common.Deleted), err
+	if err := store.updateObjectHelper(orgID, objectType, objectID, function); err != nil {
+		return false, err
+	}
+	if status != "" {
+		notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+			DestType: destType, DestID: destID, OldStatus: oldStatus, NewStatus: status})
+	}
+	return (allDeleted && status == common.Deleted), nil
 }
 
 // UpdateObjectDelivering marks the object as being delivered to all its destinations
@@ -1107,7 +1900,7 @@ func (store *BoltStorage) UpdateObjectDelivering(orgID string, objectType string
 
 	function := func(object boltObject) (boltObject, common.SyncServiceError) {
 		for i := range object.Destinations {
-			object.Destinations[i].Status = common.Delivering
+			setDeliveryStatus(&object.Destinations[i], common.Delivering)
 		}
 		return object, nil
 	}
@@ -1187,6 +1980,90 @@ func (store *BoltStorage) RetrieveWebhooks(orgID string, objectType string) ([]s
 	return hooks, nil
 }
 
+// StoreWebhookRetryPolicy stores the webhook retry policy of an object type, replacing the existing policy of the type
+func (store *BoltStorage) StoreWebhookRetryPolicy(policy common.WebhookRetryPolicy) common.SyncServiceError {
+	if err := validateWebhookRetryPolicy(policy); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookPoliciesBucket).Put([]byte(common.CreateCompositeID(policy.OrgID, policy.ObjectType)), encoded)
+	})
+}
+
+// RetrieveWebhookRetryPolicy retrieves the webhook retry policy of an object type, returns nil if the type doesn't have a policy
+func (store *BoltStorage) RetrieveWebhookRetryPolicy(orgID string, objectType string) (*common.WebhookRetryPolicy, common.SyncServiceError) {
+	var encoded []byte
+	store.db.View(func(tx *bolt.Tx) error {
+		encoded = tx.Bucket(webhookPoliciesBucket).Get([]byte(common.CreateCompositeID(orgID, objectType)))
+		return nil
+	})
+	if encoded == nil {
+		return nil, nil
+	}
+
+	var policy common.WebhookRetryPolicy
+	if err := json.Unmarshal(encoded, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// DeleteWebhookRetryPolicy deletes the webhook retry policy of an object type
+func (store *BoltStorage) DeleteWebhookRetryPolicy(orgID string, objectType string) common.SyncServiceError {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookPoliciesBucket).Delete([]byte(common.CreateCompositeID(orgID, objectType)))
+	})
+}
+
+// StoreWebhookFailure records the failure of a webhook, replacing the previous failure of the webhook
+func (store *BoltStorage) StoreWebhookFailure(failure common.WebhookFailure) common.SyncServiceError {
+	encoded, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookFailuresBucket).Put([]byte(webhookFailureID(failure.OrgID, failure.ObjectType, failure.URL)), encoded)
+	})
+}
+
+// RetrieveWebhookFailures retrieves the recorded webhook failures of an organization
+func (store *BoltStorage) RetrieveWebhookFailures(orgID string) ([]common.WebhookFailure, common.SyncServiceError) {
+	failures := make([]common.WebhookFailure, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(webhookFailuresBucket).Cursor()
+		prefix := []byte(common.CreateCompositeID(orgID) + common.CompositeIDSeparator())
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var failure common.WebhookFailure
+			if err := json.Unmarshal(value, &failure); err != nil {
+				return err
+			}
+			failures = append(failures, failure)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// DeleteWebhookFailures deletes the recorded webhook failures of an object type,
+// or of all the object types of the organization if objectType is empty
+func (store *BoltStorage) DeleteWebhookFailures(orgID string, objectType string) common.SyncServiceError {
+	prefix := []byte(common.CreateCompositeID(orgID) + common.CompositeIDSeparator())
+	if objectType != "" {
+		prefix = []byte(common.CreateCompositeID(orgID, objectType) + common.CompositeIDSeparator())
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return deleteKeysWithPrefix(tx.Bucket(webhookFailuresBucket), prefix)
+	})
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *BoltStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	if common.Configuration.NodeType == common.ESS {
@@ -1210,6 +2087,7 @@ func (store *BoltStorage) RetrieveDestinations(orgID string, destType string) ([
 
 // DestinationExists returns true if the destination exists, and false otherwise
 func (store *BoltStorage) DestinationExists(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	if common.Configuration.NodeType == common.ESS {
 		return true, nil
 	}
@@ -1227,13 +2105,50 @@ func (store *BoltStorage) DestinationExists(orgID string, destType string, destI
 	return exists, nil
 }
 
+// DestinationsExist returns a map indicating for each of the provided destinations whether it exists
+func (store *BoltStorage) DestinationsExist(orgID string, dests []common.DestinationID) (map[common.DestinationID]bool, common.SyncServiceError) {
+	exist := make(map[common.DestinationID]bool, len(dests))
+	for _, dest := range dests {
+		exist[dest] = common.Configuration.NodeType == common.ESS
+	}
+	if common.Configuration.NodeType == common.ESS || len(dests) == 0 {
+		return exist, nil
+	}
+
+	orgID, normalized := normalizeDestinationIDs(orgID, dests)
+	found := make(map[common.DestinationID]bool, len(normalized))
+	for _, dest := range normalized {
+		found[dest] = false
+	}
+	function := func(dest boltDestination) {
+		if orgID == dest.Destination.DestOrgID {
+			id := common.DestinationID{DestType: dest.Destination.DestType, DestID: dest.Destination.DestID}
+			if _, ok := found[id]; ok {
+				found[id] = true
+			}
+		}
+	}
+
+	if err := store.retrieveDestinationsHelper(function); err != nil {
+		return nil, err
+	}
+	for i, dest := range dests {
+		exist[dest] = found[normalized[i]]
+	}
+	return exist, nil
+}
+
 // StoreDestination stores a destination
 func (store *BoltStorage) StoreDestination(destination common.Destination) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
 		return nil
 	}
+	destination.Normalize()
+	if err := destination.Validate(); err != nil {
+		return err
+	}
 
-	dest := boltDestination{Destination: destination, LastPingTime: time.Now()}
+	dest := boltDestination{Destination: destination, LastPingTime: time.Now(), LastConnected: time.Now()}
 	encoded, err := json.Marshal(dest)
 	if err != nil {
 		return err
@@ -1247,8 +2162,49 @@ func (store *BoltStorage) StoreDestination(destination common.Destination) commo
 	return err
 }
 
+// RegisterDestination stores the destination when it registers or sends a heartbeat, and records the current time
+// as the destination's last ping and connection times
+func (store *BoltStorage) RegisterDestination(destination common.Destination) common.SyncServiceError {
+	// Storing a destination records it as just pinged and connected
+	return store.StoreDestination(destination)
+}
+
+// StoreDestinations stores the destinations in a single transaction, the returned errors correspond to the destinations
+func (store *BoltStorage) StoreDestinations(dests []common.Destination) ([]common.SyncServiceError, common.SyncServiceError) {
+	errs := make([]common.SyncServiceError, len(dests))
+	if common.Configuration.NodeType == common.ESS {
+		return errs, nil
+	}
+
+	now := time.Now()
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(destinationsBucket)
+		for i, destination := range dests {
+			destination.Normalize()
+			if err := destination.Validate(); err != nil {
+				errs[i] = err
+				continue
+			}
+			encoded, err := json.Marshal(boltDestination{Destination: destination, LastPingTime: now, LastConnected: now})
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			if err := bucket.Put([]byte(getDestinationCollectionID(destination)), encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to store the destinations. Error: %s.", err)}
+	}
+	return errs, nil
+}
+
 // DeleteDestination deletes a destination
 func (store *BoltStorage) DeleteDestination(orgID string, destType string, destID string) common.SyncServiceError {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	if common.Configuration.NodeType == common.ESS {
 		return nil
 	}
@@ -1261,8 +2217,78 @@ func (store *BoltStorage) DeleteDestination(orgID string, destType string, destI
 	return err
 }
 
+// DecommissionDestination removes the destination from the destinations lists of all the objects,
+// and deletes its notifications and the destination itself
+func (store *BoltStorage) DecommissionDestination(orgID string, destType string, destID string) (*common.DecommissionedDestination, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	if common.Configuration.NodeType == common.ESS {
+		return &common.DecommissionedDestination{}, nil
+	}
+
+	result := &common.DecommissionedDestination{}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(objectsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var object boltObject
+			if err := json.Unmarshal(value, &object); err != nil {
+				return err
+			}
+			if object.Meta.DestOrgID != orgID {
+				continue
+			}
+			dests := make([]common.StoreDestinationStatus, 0, len(object.Destinations))
+			for _, d := range object.Destinations {
+				if d.Destination.DestOrgID != orgID || d.Destination.DestType != destType || d.Destination.DestID != destID {
+					dests = append(dests, d)
+				}
+			}
+			if len(dests) == len(object.Destinations) {
+				continue
+			}
+			object.Destinations = dests
+			object.LastUpdate = time.Now()
+			encoded, err := json.Marshal(object)
+			if err != nil {
+				return err
+			}
+			if err = tx.Bucket(objectsBucket).Put(key, []byte(encoded)); err != nil {
+				return err
+			}
+			result.ObjectsUpdated++
+		}
+
+		cursor = tx.Bucket(notificationsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var notification common.Notification
+			if err := json.Unmarshal(value, &notification); err != nil {
+				return err
+			}
+			if notification.DestOrgID == orgID && notification.DestType == destType && notification.DestID == destID {
+				if err := tx.Bucket(notificationsBucket).Delete(key); err != nil {
+					return err
+				}
+				result.NotificationsDeleted++
+			}
+		}
+
+		id := []byte(createDestinationCollectionID(orgID, destType, destID))
+		if tx.Bucket(destinationsBucket).Get(id) != nil {
+			if err := tx.Bucket(destinationsBucket).Delete(id); err != nil {
+				return err
+			}
+			result.DestinationDeleted = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // UpdateDestinationLastPingTime updates the last ping time for the destination
 func (store *BoltStorage) UpdateDestinationLastPingTime(destination common.Destination) common.SyncServiceError {
+	destination.Normalize()
 	if common.Configuration.NodeType == common.ESS {
 		return nil
 	}
@@ -1275,6 +2301,43 @@ func (store *BoltStorage) UpdateDestinationLastPingTime(destination common.Desti
 	return store.updateDestinationHelper(id, function)
 }
 
+// updateDestinationLastConnected records that the destination has just connected
+func (store *BoltStorage) updateDestinationLastConnected(orgID string, destType string, destID string) {
+	if common.Configuration.NodeType == common.ESS || destType == "" || destID == "" {
+		return
+	}
+
+	function := func(dest boltDestination) boltDestination {
+		dest.LastConnected = time.Now()
+		return dest
+	}
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if err := store.updateDestinationHelper(id, function); err != nil && err != notFound && log.IsLogging(logger.ERROR) {
+		log.Error("Error in boltStorage.updateDestinationLastConnected: failed to update the destination. Error: %s\n", err)
+	}
+}
+
+// RetrieveOfflineDestinations returns the destinations of the organization that haven't connected for the provided duration
+func (store *BoltStorage) RetrieveOfflineDestinations(orgID string, idleFor time.Duration) ([]common.Destination, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	result := make([]common.Destination, 0)
+	cutoff := time.Now().Add(-idleFor)
+	function := func(dest boltDestination) {
+		if dest.Destination.DestOrgID == orgID && dest.LastConnected.Before(cutoff) {
+			destination := dest.Destination
+			destination.LastConnected = dest.LastConnected
+			result = append(result, destination)
+		}
+	}
+	if err := store.retrieveDestinationsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 func (store *BoltStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {
 	if common.Configuration.NodeType == common.ESS {
@@ -1320,6 +2383,7 @@ func (store *BoltStorage) GetNumberOfDestinations() (uint32, common.SyncServiceE
 
 // RetrieveDestination retrieves a destination
 func (store *BoltStorage) RetrieveDestination(orgID string, destType string, destID string) (*common.Destination, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	if common.Configuration.NodeType == common.ESS {
 		return &common.Destination{DestOrgID: orgID, DestType: destType, DestID: destID,
 			Communication: common.Configuration.CommunicationProtocol}, nil
@@ -1338,6 +2402,7 @@ func (store *BoltStorage) RetrieveDestination(orgID string, destType string, des
 
 // RetrieveDestinationProtocol retrieves communication protocol for the destination
 func (store *BoltStorage) RetrieveDestinationProtocol(orgID string, destType string, destID string) (string, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	if common.Configuration.NodeType == common.ESS {
 		return common.Configuration.CommunicationProtocol, nil
 	}
@@ -1355,6 +2420,7 @@ func (store *BoltStorage) RetrieveDestinationProtocol(orgID string, destType str
 
 // GetObjectsForDestination retrieves objects that are in use on a given node
 func (store *BoltStorage) GetObjectsForDestination(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	if common.Configuration.NodeType == common.ESS {
 		return nil, nil
 	}
@@ -1395,6 +2461,43 @@ func (store *BoltStorage) GetObjectsForDestination(orgID string, destType string
 	return objectStatuses, nil
 }
 
+// RetrieveObjectsForDestination retrieves the meta data and status of the objects that are in use on a given node.
+// If status is not empty, only objects with the given status are returned.
+func (store *BoltStorage) RetrieveObjectsForDestination(orgID string, destType string, destID string, status string) ([]common.ObjectStatusWithMetaData, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+	statuses := make(map[string]string)
+	notificationFunction := func(notification common.Notification) {
+		if notification.DestOrgID != orgID || notification.DestType != destType || notification.DestID != destID {
+			return
+		}
+		objectStatus := destinationObjectStatus(notification.Status)
+		if objectStatus == "" || (status != "" && objectStatus != status) {
+			return
+		}
+		statuses[createObjectCollectionID(orgID, notification.ObjectType, notification.ObjectID)] = objectStatus
+	}
+	if err := store.retrieveNotificationsHelper(notificationFunction); err != nil {
+		return nil, err
+	}
+
+	result := make([]common.ObjectStatusWithMetaData, 0, len(statuses))
+	if len(statuses) == 0 {
+		return result, nil
+	}
+	objectFunction := func(object boltObject) {
+		if objectStatus, ok := statuses[getObjectCollectionID(object.Meta)]; ok {
+			result = append(result, common.ObjectStatusWithMetaData{MetaData: object.Meta, Status: objectStatus})
+		}
+	}
+	if err := store.retrieveObjectsHelper(objectFunction); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and returns the list of metadata
 func (store *BoltStorage) RetrieveAllObjectsAndUpdateDestinationListForDestination(destOrgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
 	// 1. retrieve metadata
@@ -1471,21 +2574,56 @@ func (store *BoltStorage) UpdateRemovedDestinationPolicyServices(orgID string, o
 
 // UpdateNotificationRecord updates/adds a notification record to the object
 func (store *BoltStorage) UpdateNotificationRecord(notification common.Notification) common.SyncServiceError {
-	if notification.ResendTime == 0 {
-		notification.ResendTime = time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
-	}
-	function := func(*common.Notification) (*common.Notification, common.SyncServiceError) {
+	notification.LastUpdate = time.Now().Unix()
+	function := func(existing *common.Notification) (*common.Notification, common.SyncServiceError) {
+		scheduleNotificationResend(&notification, existing)
 		return &notification, nil
 	}
 	return store.updateNotificationHelper(notification, function)
 }
 
-// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+// UpdateNotificationRecords updates/adds the notification records, for example the notifications of an object
+// to all its destinations, in as few writes as the storage allows
+func (store *BoltStorage) UpdateNotificationRecords(notifications []common.Notification) common.SyncServiceError {
+	if len(notifications) == 0 {
+		return nil
+	}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(notificationsBucket)
+		for _, notification := range notifications {
+			id := []byte(getNotificationCollectionID(&notification))
+			var existing *common.Notification
+			if encoded := bucket.Get(id); encoded != nil {
+				existing = &common.Notification{}
+				if err := json.Unmarshal(encoded, existing); err != nil {
+					return err
+				}
+			}
+			scheduleNotificationResend(&notification, existing)
+			notification.LastUpdate = time.Now().Unix()
+			encoded, err := json.Marshal(notification)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(id, encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to update notification records. Error: %s.", err)}
+	}
+	return nil
+}
+
+// UpdateNotificationResendTime increments the resend attempts of the notification and sets its resend time
+// according to the number of attempts (see common.GetNotificationResendInterval)
 func (store *BoltStorage) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
-	resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
 	function := func(notification *common.Notification) (*common.Notification, common.SyncServiceError) {
 		if notification != nil {
-			notification.ResendTime = resendTime
+			notification.ResendAttempts++
+			notification.ResendTime = time.Now().Unix() + common.GetNotificationResendInterval(notification.ResendAttempts)
 			return notification, nil
 		}
 		return nil, notFound
@@ -1542,8 +2680,27 @@ func (store *BoltStorage) DeleteNotificationRecords(orgID string, objectType str
 	return store.deleteNotificationsHelper(function)
 }
 
+// PurgeCompletedNotifications deletes the notifications in a completed state that weren't updated for longer than olderThan
+func (store *BoltStorage) PurgeCompletedNotifications(orgID string, olderThan time.Duration) (int, common.SyncServiceError) {
+	cutoff := time.Now().Add(-olderThan).Unix()
+	purged := 0
+	function := func(notification common.Notification) bool {
+		if isPurgeableNotification(notification, orgID, cutoff) {
+			purged++
+			return true
+		}
+		return false
+	}
+	if err := store.deleteNotificationsHelper(function); err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to purge completed notifications. Error: %s.", err)}
+	}
+	return purged, nil
+}
+
 // RetrieveNotifications returns the list of all the notifications that need to be resent to the destination
 func (store *BoltStorage) RetrieveNotifications(orgID string, destType string, destID string, retrieveReceived bool) ([]common.Notification, common.SyncServiceError) {
+	store.updateDestinationLastConnected(orgID, destType, destID)
+
 	var function func(notification common.Notification)
 	result := make([]common.Notification, 0)
 
@@ -1611,6 +2768,11 @@ func (store *BoltStorage) UpdateLeader(leaderID string, version int64) (bool, co
 	return false, nil
 }
 
+// RequestLeaderHandoff asks the leader to hand off the leadership, if its priority is lower than this node's priority
+func (store *BoltStorage) RequestLeaderHandoff(leaderID string, version int64) (bool, common.SyncServiceError) {
+	return false, nil
+}
+
 // ResignLeadership causes this sync service to give up the Leadership
 func (store *BoltStorage) ResignLeadership(leaderID string) common.SyncServiceError {
 	return nil
@@ -1621,6 +2783,11 @@ func (store *BoltStorage) RetrieveTimeOnServer() (time.Time, error) {
 	return time.Now(), nil
 }
 
+// IsLeaderAlive returns true, there is no leader election with this store
+func (store *BoltStorage) IsLeaderAlive() (bool, string, common.SyncServiceError) {
+	return true, "", nil
+}
+
 // StoreOrgToMessagingGroup inserts organization to messaging groups table
 func (store *BoltStorage) StoreOrgToMessagingGroup(orgID string, messagingGroup string) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
@@ -1697,6 +2864,37 @@ func (store *BoltStorage) RetrieveUpdatedMessagingGroups(time time.Time) ([]comm
 	return result, nil
 }
 
+// RetrieveDestinationsInMessagingGroup returns all the destinations of the organizations in the messaging group
+func (store *BoltStorage) RetrieveDestinationsInMessagingGroup(groupName string) ([]common.Destination, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	orgs := make(map[string]bool)
+	groupFunction := func(mg boltMessagingGroup) {
+		if mg.GroupName == groupName {
+			orgs[mg.OrgID] = true
+		}
+	}
+	if err := store.retrieveMessagingGroupHelper(groupFunction); err != nil {
+		return nil, err
+	}
+
+	result := make([]common.Destination, 0)
+	if len(orgs) == 0 {
+		return result, nil
+	}
+	function := func(dest boltDestination) {
+		if orgs[dest.Destination.DestOrgID] {
+			result = append(result, dest.Destination)
+		}
+	}
+	if err := store.retrieveDestinationsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // DeleteOrganization cleans up the storage from all the records associated with the organization
 func (store *BoltStorage) DeleteOrganization(orgID string) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
@@ -1737,6 +2935,13 @@ func (store *BoltStorage) DeleteOrganization(orgID string) common.SyncServiceErr
 		return &Error{fmt.Sprintf("Failed to delete objects. Error: %s.", err)}
 	}
 
+	versionFunction := func(version boltObjectVersion) bool {
+		return version.Meta.DestOrgID == orgID
+	}
+	if err := store.deleteObjectVersionsHelper(versionFunction); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete object versions. Error: %s.", err)}
+	}
+
 	aclFunction := func(acl boltACL) bool {
 		if acl.OrgID == orgID {
 			return true
@@ -1747,9 +2952,97 @@ func (store *BoltStorage) DeleteOrganization(orgID string) common.SyncServiceErr
 		return &Error{fmt.Sprintf("Failed to delete ACLs. Error: %s.", err)}
 	}
 
+	auditFunction := func(record common.AuditRecord) bool {
+		return record.OrgID == orgID
+	}
+	if err := store.deleteAuditRecordsHelper(auditFunction); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete the audit log. Error: %s.", err)}
+	}
+
+	groups, err := store.RetrieveACLGroups(orgID)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete ACL groups. Error: %s.", err)}
+	}
+	for _, group := range groups {
+		if err := store.DeleteACLGroup(orgID, group.Name); err != nil {
+			return &Error{fmt.Sprintf("Failed to delete ACL groups. Error: %s.", err)}
+		}
+	}
+
+	policies, err := store.RetrieveRetentionPolicies(orgID)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete retention policies. Error: %s.", err)}
+	}
+	for _, policy := range policies {
+		if err := store.DeleteRetentionPolicy(orgID, policy.ObjectType); err != nil {
+			return &Error{fmt.Sprintf("Failed to delete retention policies. Error: %s.", err)}
+		}
+	}
+
+	if err := store.deleteWebhookRecordsHelper(orgID); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete webhook retry policies and failures. Error: %s.", err)}
+	}
+
+	tokens, err := store.RetrieveAPITokens(orgID)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete API tokens. Error: %s.", err)}
+	}
+	for _, token := range tokens {
+		if err := store.RevokeAPIToken(token.Hash); err != nil {
+			return &Error{fmt.Sprintf("Failed to delete API tokens. Error: %s.", err)}
+		}
+	}
+
 	return nil
 }
 
+// ExportOrganization writes all the records associated with the organization to the writer
+func (store *BoltStorage) ExportOrganization(orgID string, w io.Writer) common.SyncServiceError {
+	exported := make([]exportedObject, 0)
+	objectFunction := func(object boltObject) {
+		if object.Meta.DestOrgID == orgID {
+			exported = append(exported, exportedObject{MetaData: object.Meta, Status: object.Status})
+		}
+	}
+	if err := store.retrieveObjectsHelper(objectFunction); err != nil {
+		return &Error{fmt.Sprintf("Failed to fetch objects to export. Error: %s.", err)}
+	}
+
+	exportedNotifications := make([]common.Notification, 0)
+	notificationFunction := func(notification common.Notification) {
+		if notification.DestOrgID == orgID {
+			exportedNotifications = append(exportedNotifications, notification)
+		}
+	}
+	if err := store.retrieveNotificationsHelper(notificationFunction); err != nil {
+		return &Error{fmt.Sprintf("Failed to fetch notifications to export. Error: %s.", err)}
+	}
+
+	// Webhooks are keyed by the object type only
+	hooks := make(map[string][]string)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(webhooksBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var objectHooks []string
+			if err := json.Unmarshal(value, &objectHooks); err != nil {
+				return err
+			}
+			hooks[string(key)] = objectHooks
+		}
+		return nil
+	})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to fetch webhooks to export. Error: %s.", err)}
+	}
+
+	return exportOrganization(store, orgID, w, exported, exportedNotifications, hooks)
+}
+
+// ImportOrganization stores the records of an organization read from an export created by ExportOrganization
+func (store *BoltStorage) ImportOrganization(r io.Reader) common.SyncServiceError {
+	return importOrganization(store, r)
+}
+
 // IsConnected returns false if the storage cannont be reached, and true otherwise
 func (store *BoltStorage) IsConnected() bool {
 	return true
@@ -1821,14 +3114,33 @@ func (store *BoltStorage) RetrieveOrganizations() ([]common.StoredOrganization,
 		return nil, nil
 	}
 
+	orgs, _, err := store.RetrieveOrganizationsPage(0, 0)
+	return orgs, err
+}
+
+// RetrieveOrganizationsPage retrieves up to limit stored organizations' info, ordered by organization ID,
+// skipping the first offset organizations
+func (store *BoltStorage) RetrieveOrganizationsPage(offset int, limit int) ([]common.StoredOrganization, int, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, 0, nil
+	}
+	if offset < 0 || limit < 0 {
+		return nil, 0, &common.InvalidRequest{Message: "Offset and limit must be non-negative numbers"}
+	}
+
+	// The organizations bucket is ordered by the organization ID
 	result := make([]common.StoredOrganization, 0)
+	total := 0
 	function := func(org common.StoredOrganization) {
-		result = append(result, org)
+		if total >= offset && (limit == 0 || len(result) < limit) {
+			result = append(result, org)
+		}
+		total++
 	}
 	if err := store.retrieveOrganizationsHelper(function); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return result, nil
+	return result, total, nil
 }
 
 // RetrieveUpdatedOrganizations retrieves organizations that were updated after the specified time
@@ -1858,6 +3170,7 @@ func (store *BoltStorage) AddUsersToACL(aclType string, orgID string, key string
 	if key == "" {
 		key = "*"
 	}
+	users, _ = normalizeACLEntries(users)
 
 	function := func(acl boltACL) (*boltACL, bool) {
 		added := false
@@ -1865,7 +3178,7 @@ func (store *BoltStorage) AddUsersToACL(aclType string, orgID string, key string
 			notFound := true
 			// Don't add the user if it already is in the list
 			for _, existing := range acl.Users {
-				if user.ACLUserType == existing.ACLUserType && user.Username == existing.Username {
+				if sameACLUser(user, existing) {
 					notFound = false
 					break
 				}
@@ -1898,7 +3211,7 @@ func (store *BoltStorage) RemoveUsersFromACL(aclType string, orgID string, key s
 		deleted := false
 		for _, user := range users {
 			for i, entry := range acl.Users {
-				if user.ACLUserType == entry.ACLUserType && user.Username == entry.Username {
+				if sameACLUser(user, entry) {
 					if len(acl.Users) == 1 {
 						// Deleting the last user, delete the ACL
 						return nil, true
@@ -1920,6 +3233,28 @@ func (store *BoltStorage) RemoveUsersFromACL(aclType string, orgID string, key s
 	return store.updateACLHelper(aclType, orgID, key, function)
 }
 
+// SetACL replaces the users of an ACL with the provided users, an empty list of users deletes the ACL
+func (store *BoltStorage) SetACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	if key == "" {
+		key = "*"
+	}
+	users, _ = normalizeACLEntries(users)
+
+	function := func(acl boltACL) (*boltACL, bool) {
+		if len(users) == 0 {
+			return nil, true
+		}
+		acl.Users = users
+		return &acl, false
+	}
+
+	return store.updateACLHelper(aclType, orgID, key, function)
+}
+
 // RetrieveACL retrieves the list of usernames on an ACL
 func (store *BoltStorage) RetrieveACL(aclType string, orgID string, key string, aclUserType string) ([]common.ACLentry, common.SyncServiceError) {
 	if common.Configuration.NodeType == common.ESS {
@@ -1931,7 +3266,7 @@ func (store *BoltStorage) RetrieveACL(aclType string, orgID string, key string,
 		key = "*"
 	}
 	store.db.View(func(tx *bolt.Tx) error {
-		encoded = tx.Bucket(aclBucket).Get([]byte(orgID + ":" + aclType + ":" + key))
+		encoded = tx.Bucket(aclBucket).Get([]byte(createACLID(orgID, aclType, key)))
 		return nil
 	})
 
@@ -1969,16 +3304,18 @@ func (store *BoltStorage) RetrieveObjOrDestTypeForGivenACLUser(aclType string, o
 	if common.Configuration.NodeType == common.ESS {
 		return nil, nil
 	}
+	aclUsername = common.NormalizeACLUsername(aclUsername)
 	result := make([]string, 0)
 	function := func(acl boltACL) {
 		if acl.ACLType == aclType && acl.OrgID == orgID {
 			for _, user := range acl.Users {
+				username := common.NormalizeACLUsername(user.Username)
 				if aclRole == "" || aclRole == "*" {
-					if aclUserType == user.ACLUserType && aclUsername == user.Username {
+					if aclUserType == user.ACLUserType && aclUsername == username {
 						result = append(result, acl.Key)
 					}
 				} else {
-					if aclUserType == user.ACLUserType && aclUsername == user.Username && aclRole == user.ACLRole {
+					if aclUserType == user.ACLUserType && aclUsername == username && aclRole == user.ACLRole {
 						result = append(result, acl.Key)
 					}
 				}
@@ -1991,6 +3328,273 @@ func (store *BoltStorage) RetrieveObjOrDestTypeForGivenACLUser(aclType string, o
 	return result, nil
 }
 
+// NormalizeACLUsernames rewrites the stored ACLs with normalized usernames, merging the entries of the same user.
+// Returns the number of the modified ACLs.
+func (store *BoltStorage) NormalizeACLUsernames() (int, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return 0, nil
+	}
+
+	modified := 0
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(aclBucket)
+		updates := make(map[string][]byte)
+		cursor := bucket.Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var acl boltACL
+			if err := json.Unmarshal(value, &acl); err != nil {
+				return err
+			}
+			users, changed := normalizeACLEntries(acl.Users)
+			if !changed {
+				continue
+			}
+			acl.Users = users
+			encoded, err := json.Marshal(acl)
+			if err != nil {
+				return err
+			}
+			updates[string(key)] = encoded
+		}
+
+		// Don't modify the bucket while iterating over it
+		for key, encoded := range updates {
+			if err := bucket.Put([]byte(key), encoded); err != nil {
+				return err
+			}
+		}
+		modified = len(updates)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return modified, nil
+}
+
+// CheckACL returns true if the user is granted access by the ACL of the key or by the ACL of all the keys,
+// either directly, by a wildcard entry, or by the membership in a group
+func (store *BoltStorage) CheckACL(aclType string, orgID string, key string, username string) (bool, common.SyncServiceError) {
+	return checkACL(store, aclType, orgID, key, username)
+}
+
+// StoreACLGroup stores an ACL group, replacing its members if it already exists
+func (store *BoltStorage) StoreACLGroup(group common.ACLGroup) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+	if err := validateACLGroup(group); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(aclGroupsBucket).Put([]byte(createACLGroupID(group.OrgID, group.Name)), encoded)
+	})
+}
+
+// RetrieveACLGroup retrieves an ACL group, returns nil if the group doesn't exist
+func (store *BoltStorage) RetrieveACLGroup(orgID string, name string) (*common.ACLGroup, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	var encoded []byte
+	store.db.View(func(tx *bolt.Tx) error {
+		encoded = tx.Bucket(aclGroupsBucket).Get([]byte(createACLGroupID(orgID, name)))
+		return nil
+	})
+	if encoded == nil {
+		return nil, nil
+	}
+
+	var group common.ACLGroup
+	if err := json.Unmarshal(encoded, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// RetrieveACLGroups retrieves the ACL groups of an organization
+func (store *BoltStorage) RetrieveACLGroups(orgID string) ([]common.ACLGroup, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	groups := make([]common.ACLGroup, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(aclGroupsBucket).Cursor()
+		prefix := []byte(createOrgIDPrefix(orgID))
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var group common.ACLGroup
+			if err := json.Unmarshal(value, &group); err != nil {
+				return err
+			}
+			groups = append(groups, group)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// DeleteACLGroup deletes an ACL group
+func (store *BoltStorage) DeleteACLGroup(orgID string, name string) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(aclGroupsBucket).Delete([]byte(createACLGroupID(orgID, name)))
+	})
+}
+
+// StoreRetentionPolicy stores the retention policy of an object type, replacing the existing policy of the type
+func (store *BoltStorage) StoreRetentionPolicy(policy common.RetentionPolicy) common.SyncServiceError {
+	if err := validateRetentionPolicy(policy); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(retentionBucket).Put([]byte(common.CreateCompositeID(policy.OrgID, policy.ObjectType)), encoded)
+	})
+}
+
+// RetrieveRetentionPolicy retrieves the retention policy of an object type, returns nil if the type doesn't have a policy
+func (store *BoltStorage) RetrieveRetentionPolicy(orgID string, objectType string) (*common.RetentionPolicy, common.SyncServiceError) {
+	var encoded []byte
+	store.db.View(func(tx *bolt.Tx) error {
+		encoded = tx.Bucket(retentionBucket).Get([]byte(common.CreateCompositeID(orgID, objectType)))
+		return nil
+	})
+	if encoded == nil {
+		return nil, nil
+	}
+
+	var policy common.RetentionPolicy
+	if err := json.Unmarshal(encoded, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// RetrieveRetentionPolicies retrieves the retention policies of an organization,
+// or of all the organizations if orgID is empty
+func (store *BoltStorage) RetrieveRetentionPolicies(orgID string) ([]common.RetentionPolicy, common.SyncServiceError) {
+	policies := make([]common.RetentionPolicy, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(retentionBucket).Cursor()
+		prefix := []byte{}
+		if orgID != "" {
+			prefix = []byte(orgID + common.CompositeIDSeparator())
+		}
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var policy common.RetentionPolicy
+			if err := json.Unmarshal(value, &policy); err != nil {
+				return err
+			}
+			policies = append(policies, policy)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// DeleteRetentionPolicy deletes the retention policy of an object type
+func (store *BoltStorage) DeleteRetentionPolicy(orgID string, objectType string) common.SyncServiceError {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(retentionBucket).Delete([]byte(common.CreateCompositeID(orgID, objectType)))
+	})
+}
+
+// StoreAPIToken stores an API token, replacing it if a token with the same hash already exists
+func (store *BoltStorage) StoreAPIToken(token common.APIToken) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+	if err := validateAPIToken(token); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiTokensBucket).Put([]byte(token.Hash), encoded)
+	})
+}
+
+// RetrieveAPIToken retrieves the API token with the given hash, returns nil if the token doesn't exist
+func (store *BoltStorage) RetrieveAPIToken(hash string) (*common.APIToken, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	var encoded []byte
+	store.db.View(func(tx *bolt.Tx) error {
+		encoded = tx.Bucket(apiTokensBucket).Get([]byte(hash))
+		return nil
+	})
+	if encoded == nil {
+		return nil, nil
+	}
+
+	var token common.APIToken
+	if err := json.Unmarshal(encoded, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RetrieveAPITokens retrieves the API tokens of an organization
+func (store *BoltStorage) RetrieveAPITokens(orgID string) ([]common.APIToken, common.SyncServiceError) {
+	if common.Configuration.NodeType == common.ESS {
+		return nil, nil
+	}
+
+	tokens := make([]common.APIToken, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiTokensBucket).ForEach(func(key, value []byte) error {
+			var token common.APIToken
+			if err := json.Unmarshal(value, &token); err != nil {
+				return err
+			}
+			if token.OrgID == orgID {
+				tokens = append(tokens, token)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes the API token with the given hash, the token can't be used after it is revoked
+func (store *BoltStorage) RevokeAPIToken(hash string) common.SyncServiceError {
+	if common.Configuration.NodeType == common.ESS {
+		return nil
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiTokensBucket).Delete([]byte(hash))
+	})
+}
+
 func (store *BoltStorage) getInstanceID() int64 {
 	store.lock()
 	defer store.unLock()
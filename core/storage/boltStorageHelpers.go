@@ -1,10 +1,18 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/dataURI"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
 	bolt "go.etcd.io/bbolt"
 )
 
@@ -44,6 +52,7 @@ func (store *BoltStorage) updateObjectHelper(orgID string, objectType string, ob
 		if err != nil {
 			return err
 		}
+		object.LastUpdate = time.Now()
 		encoded, err = json.Marshal(object)
 		if err != nil {
 			return err
@@ -70,6 +79,7 @@ func (store *BoltStorage) updateObjectsHelper(update func(boltObject) (*boltObje
 			if updatedObject == nil {
 				continue
 			}
+			updatedObject.LastUpdate = time.Now()
 			encoded, err := json.Marshal(*updatedObject)
 			if err != nil {
 				return err
@@ -172,6 +182,158 @@ func (store *BoltStorage) viewObjectHelper(orgID string, objectType string, obje
 	return err
 }
 
+// storeObjectVersion keeps the current version of the object before it is updated, if versions are kept for its type
+func (store *BoltStorage) storeObjectVersion(metaData common.MetaData) common.SyncServiceError {
+	policy, err := store.RetrieveRetentionPolicy(metaData.DestOrgID, metaData.ObjectType)
+	if err != nil {
+		return err
+	}
+	if objectVersionsKept(policy, metaData.ObjectType) == 0 {
+		return nil
+	}
+
+	var existingObject boltObject
+	function := func(object boltObject) common.SyncServiceError {
+		existingObject = object
+		return nil
+	}
+	if err := store.viewObjectHelper(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, function); err != nil {
+		if common.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	meta := existingObject.Meta
+	if meta.Deleted || existingObject.Status == common.ObjDeleted {
+		return nil
+	}
+
+	version := boltObjectVersion{Meta: meta}
+	if existingObject.DataPath != "" {
+		dataReader, err := dataURI.GetData(existingObject.DataPath)
+		if err == nil {
+			versionsPath := store.localDataPath + "versions/"
+			if err := os.MkdirAll(strings.TrimPrefix(versionsPath, "file://"), 0750); err != nil {
+				store.CloseDataReader(dataReader)
+				return &common.IOError{Message: "Failed to create the object versions directory. Error: " + err.Error()}
+			}
+			version.DataPath = createDataPathFromMeta(versionsPath, meta) + "-" + strconv.FormatInt(meta.InstanceID, 10)
+			_, err = dataURI.StoreData(version.DataPath, dataReader, 0)
+			store.CloseDataReader(dataReader)
+			if err != nil {
+				return err
+			}
+		} else if !common.IsNotFound(err) {
+			return err
+		}
+	}
+
+	encoded, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	id := createObjectVersionCollectionID(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.InstanceID)
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(objectVersionsBucket).Put([]byte(id), encoded)
+	})
+}
+
+func (store *BoltStorage) retrieveObjectVersionsHelper(retrieve func(boltObjectVersion)) common.SyncServiceError {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(objectVersionsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var version boltObjectVersion
+			if err := json.Unmarshal(value, &version); err != nil {
+				return err
+			}
+			retrieve(version)
+		}
+		return nil
+	})
+	return err
+}
+
+func (store *BoltStorage) deleteObjectVersionsHelper(match func(boltObjectVersion) bool) common.SyncServiceError {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(objectVersionsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var version boltObjectVersion
+			if err := json.Unmarshal(value, &version); err != nil {
+				return err
+			}
+			if match(version) {
+				if version.DataPath != "" {
+					if err := dataURI.DeleteStoredData(version.DataPath); err != nil {
+						return err
+					}
+				}
+				if err := tx.Bucket(objectVersionsBucket).Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// applyRetentionPolicies removes the objects that weren't updated for longer than the maximal age set by
+// the retention policies of their types
+func (store *BoltStorage) applyRetentionPolicies() {
+	policies, err := store.RetrieveRetentionPolicies("")
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in BoltStorage.applyRetentionPolicies: failed to retrieve the retention policies. Error: %s\n", err)
+		}
+		return
+	}
+	if len(policies) == 0 {
+		return
+	}
+
+	policiesByType := retentionPoliciesByType(policies)
+	now := time.Now()
+	function := func(object boltObject) bool {
+		return retentionExpired(policiesByType, object.Meta, object.Status, object.LastUpdate, now)
+	}
+	if err := store.deleteObjectsAndNotificationsHelper(function); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in BoltStorage.applyRetentionPolicies: failed to remove objects. Error: %s\n", err)
+	}
+}
+
+// pruneObjectVersions removes the object versions that exceed the number of versions kept for their object type
+func (store *BoltStorage) pruneObjectVersions() {
+	versions := make([]common.MetaData, 0)
+	if err := store.retrieveObjectVersionsHelper(func(version boltObjectVersion) { versions = append(versions, version.Meta) }); err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in BoltStorage.pruneObjectVersions: failed to retrieve the object versions. Error: %s\n", err)
+		}
+		return
+	}
+
+	policies, err := store.RetrieveRetentionPolicies("")
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in BoltStorage.pruneObjectVersions: failed to retrieve the retention policies. Error: %s\n", err)
+		}
+		return
+	}
+
+	pruned := make(map[string]bool)
+	for _, version := range objectVersionsToPrune(versions, policies) {
+		pruned[createObjectVersionCollectionID(version.DestOrgID, version.ObjectType, version.ObjectID, version.InstanceID)] = true
+	}
+	if len(pruned) == 0 {
+		return
+	}
+	function := func(version boltObjectVersion) bool {
+		return pruned[createObjectVersionCollectionID(version.Meta.DestOrgID, version.Meta.ObjectType, version.Meta.ObjectID, version.Meta.InstanceID)]
+	}
+	if err := store.deleteObjectVersionsHelper(function); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in BoltStorage.pruneObjectVersions: failed to remove object versions. Error: %s\n", err)
+	}
+}
+
 func (store *BoltStorage) updateWebhookHelper(objectType string,
 	update func(hooks []string) []string) common.SyncServiceError {
 	err := store.db.Update(func(tx *bolt.Tx) error {
@@ -199,6 +361,33 @@ func (store *BoltStorage) updateWebhookHelper(objectType string,
 	return err
 }
 
+// deleteWebhookRecordsHelper deletes the webhook retry policies and failures of the organization
+func (store *BoltStorage) deleteWebhookRecordsHelper(orgID string) error {
+	prefix := []byte(common.CreateCompositeID(orgID) + common.CompositeIDSeparator())
+	return store.db.Update(func(tx *bolt.Tx) error {
+		if err := deleteKeysWithPrefix(tx.Bucket(webhookPoliciesBucket), prefix); err != nil {
+			return err
+		}
+		return deleteKeysWithPrefix(tx.Bucket(webhookFailuresBucket), prefix)
+	})
+}
+
+// deleteKeysWithPrefix deletes the entries of the bucket whose keys start with the prefix.
+// The keys are collected before they are deleted, since deleting while iterating with a cursor skips entries.
+func deleteKeysWithPrefix(bucket *bolt.Bucket, prefix []byte) error {
+	keys := make([][]byte, 0)
+	cursor := bucket.Cursor()
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+		keys = append(keys, append([]byte{}, key...))
+	}
+	for _, key := range keys {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (store *BoltStorage) retrieveNotificationsHelper(retrieve func(common.Notification)) common.SyncServiceError {
 	err := store.db.View(func(tx *bolt.Tx) error {
 		cursor := tx.Bucket(notificationsBucket).Cursor()
@@ -412,7 +601,7 @@ func (store *BoltStorage) retrieveOrganizationsHelper(retrieve func(common.Store
 
 func (store *BoltStorage) updateACLHelper(aclType string, orgID string, key string, update func(acl boltACL) (*boltACL, bool)) common.SyncServiceError {
 	err := store.db.Update(func(tx *bolt.Tx) error {
-		id := orgID + ":" + aclType + ":" + key
+		id := createACLID(orgID, aclType, key)
 
 		encoded := tx.Bucket(aclBucket).Get([]byte(id))
 		var acl boltACL
@@ -465,6 +654,27 @@ func (store *BoltStorage) deleteACLsHelper(match func(acl boltACL) bool) common.
 	return err
 }
 
+func (store *BoltStorage) deleteAuditRecordsHelper(match func(common.AuditRecord) bool) common.SyncServiceError {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(auditBucket).Cursor()
+
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var record common.AuditRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			if match(record) {
+				if err := tx.Bucket(auditBucket).Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	return err
+}
+
 func (store *BoltStorage) retrieveACLHelper(retrieve func(boltACL)) common.SyncServiceError {
 	err := store.db.View(func(tx *bolt.Tx) error {
 		cursor := tx.Bucket(aclBucket).Cursor()
@@ -496,6 +706,36 @@ func createObjectDestinationPolicy(object boltObject) common.ObjectDestinationPo
 	}
 }
 
+// chunkUploaded records the upload of a chunk of an object's data
+func (store *BoltStorage) chunkUploaded(orgID string, objectType string, objectID string, offset int64, length int64, isFirstChunk bool) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	store.lock()
+	defer store.unLock()
+	progress := store.uploads[id]
+	if isFirstChunk || progress == nil {
+		progress = newUploadProgress()
+		store.uploads[id] = progress
+	}
+	progress.chunkWritten(offset, length)
+}
+
+// endUpload stops tracking the upload of an object's data
+func (store *BoltStorage) endUpload(orgID string, objectType string, objectID string) {
+	store.lock()
+	defer store.unLock()
+	delete(store.uploads, createObjectCollectionID(orgID, objectType, objectID))
+}
+
+// getUploadOffset returns the committed offset of the upload of an object's data, and false if there is no upload in progress
+func (store *BoltStorage) getUploadOffset(orgID string, objectType string, objectID string) (int64, bool) {
+	store.lock()
+	defer store.unLock()
+	if progress, ok := store.uploads[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		return progress.committed, true
+	}
+	return 0, false
+}
+
 func (store *BoltStorage) lock() {
 	<-store.lockChannel
 }
@@ -503,3 +743,49 @@ func (store *BoltStorage) lock() {
 func (store *BoltStorage) unLock() {
 	store.lockChannel <- 1
 }
+
+// addAuditRecord appends the record to the audit log
+// The records of an object are keyed by the object's ID followed by a sequence number, which keeps them in order
+// A failure to write the record is logged, the mutation it describes has already been done
+func (store *BoltStorage) addAuditRecord(record common.AuditRecord) {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(auditBucket)
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		key := common.CreateCompositeID(record.OrgID, record.ObjectType, record.ObjectID, fmt.Sprintf("%020d", sequence))
+		return bucket.Put([]byte(key), encoded)
+	})
+	if err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to add an audit record for %s of %s:%s:%s. Error: %s", record.Action, record.OrgID,
+			record.ObjectType, record.ObjectID, err)
+	}
+}
+
+// pruneIdempotencyKeys removes the idempotency keys that were recorded more than IdempotencyKeyWindow seconds ago
+func (store *BoltStorage) pruneIdempotencyKeys() common.SyncServiceError {
+	if common.Configuration.IdempotencyKeyWindow <= 0 {
+		return nil
+	}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(idempotencyKeysBucket).Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var timestamp time.Time
+			if err := json.Unmarshal(v, &timestamp); err != nil || idempotencyKeyExpired(timestamp) {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to remove the expired idempotency keys. Error: %s.", err)}
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package storage
 
 import (
+	"encoding/json"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/open-horizon/edge-sync-service/common"
+	bolt "go.etcd.io/bbolt"
 )
 
 func TestBoltStorageStorageObjects(t *testing.T) {
@@ -23,14 +26,215 @@ func TestBoltStorageStorageObjectActivation(t *testing.T) {
 	testStorageObjectActivation(common.Bolt, t)
 }
 
+func TestBoltStorageUndeleteObject(t *testing.T) {
+	testStorageUndeleteObject(common.Bolt, t)
+}
+
+func TestBoltStoragePatchObjectMetadata(t *testing.T) {
+	testStoragePatchObjectMetadata(common.Bolt, t)
+}
+
+func TestBoltStorageTouchObject(t *testing.T) {
+	testStorageTouchObject(common.Bolt, t)
+}
+
+func TestBoltStorageAuditLog(t *testing.T) {
+	testStorageAuditLog(common.Bolt, t)
+}
+
+func TestBoltStorageAuditLogRetention(t *testing.T) {
+	testStorageAuditLogRetention(common.Bolt, t)
+}
+
+func TestBoltStorageObjectVersions(t *testing.T) {
+	testStorageObjectVersions(common.Bolt, t)
+}
+
+func TestBoltStorageRetentionPolicies(t *testing.T) {
+	testStorageRetentionPolicies(common.Bolt, t)
+}
+
+func TestBoltStorageWebhookRetryPolicies(t *testing.T) {
+	testStorageWebhookRetryPolicies(common.Bolt, t)
+}
+
+func TestBoltStorageMaxDeliveriesPerDestination(t *testing.T) {
+	testStorageMaxDeliveriesPerDestination(common.Bolt, t)
+}
+
+func TestBoltStorageSourceDataURI(t *testing.T) {
+	testStorageSourceDataURI(common.Bolt, t)
+}
+
+func TestBoltStorageIdempotencyKeys(t *testing.T) {
+	testStorageIdempotencyKeys(common.Bolt, t)
+}
+
+func TestBoltStoragePruneIdempotencyKeys(t *testing.T) {
+	savedWindow := common.Configuration.IdempotencyKeyWindow
+	defer func() { common.Configuration.IdempotencyKeyWindow = savedWindow }()
+	common.Configuration.IdempotencyKeyWindow = 300
+
+	store := &BoltStorage{}
+	store.Cleanup(true)
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "pruneidempotencyorg"
+	if err := store.RecordIdempotencyKey(orgID, "type1", "1", "key1"); err != nil {
+		t.Errorf("Failed to record idempotency key. Error: %s\n", err.Error())
+	}
+	expired, _ := json.Marshal(time.Now().Add(-time.Hour))
+	expiredID := createIdempotencyKeyID(orgID, "type1", "1", "key2")
+	if err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(idempotencyKeysBucket).Put([]byte(expiredID), expired)
+	}); err != nil {
+		t.Errorf("Failed to store expired idempotency key. Error: %s\n", err.Error())
+	}
+
+	store.PerformMaintenance()
+
+	store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(idempotencyKeysBucket)
+		if bucket.Get([]byte(expiredID)) != nil {
+			t.Errorf("Expired idempotency key wasn't removed\n")
+		}
+		if bucket.Get([]byte(createIdempotencyKeyID(orgID, "type1", "1", "key1"))) == nil {
+			t.Errorf("Idempotency key was removed before it expired\n")
+		}
+		return nil
+	})
+}
+
+func TestBoltStorageObjectStatusCounts(t *testing.T) {
+	testStorageObjectStatusCounts(common.Bolt, t)
+}
+
+func TestBoltStorageStorageStatsByType(t *testing.T) {
+	testStorageStorageStatsByType(common.Bolt, t)
+}
+
+func TestBoltStorageObjectIDSeparator(t *testing.T) {
+	testStorageObjectIDSeparator(common.Bolt, t)
+}
+
+func TestBoltStorageBroadcastObjects(t *testing.T) {
+	testStorageBroadcastObjects(common.Bolt, t)
+}
+
+func TestBoltStoragePinnedObjects(t *testing.T) {
+	testStoragePinnedObjects(common.Bolt, t)
+}
+
+func TestBoltStorageStoreDestinations(t *testing.T) {
+	testStorageStoreDestinations(common.Bolt, t)
+}
+
+func TestBoltStorageObjectsWithMissingData(t *testing.T) {
+	testStorageObjectsWithMissingData(common.Bolt, t)
+}
+
+func TestBoltStorageDeliveryAttempts(t *testing.T) {
+	testStorageDeliveryAttempts(common.Bolt, t)
+}
+
+func TestBoltStorageObjectsBySizeAndAge(t *testing.T) {
+	testStorageObjectsBySizeAndAge(common.Bolt, t)
+}
+
+func TestBoltStorageAPITokens(t *testing.T) {
+	testStorageAPITokens(common.Bolt, t)
+}
+
+func TestBoltStorageDestinationObjectTypesACL(t *testing.T) {
+	testStorageDestinationObjectTypesACL(common.Bolt, t)
+}
+
+func TestBoltStorageObjectsAcrossOrgs(t *testing.T) {
+	testStorageObjectsAcrossOrgs(common.Bolt, t)
+}
+
+func TestBoltStorageObjectsApproachingDeadline(t *testing.T) {
+	testStorageObjectsApproachingDeadline(common.Bolt, t)
+}
+
+func TestBoltStoragePartialObjectData(t *testing.T) {
+	testStoragePartialObjectData(common.Bolt, t)
+}
+
+func TestBoltStorageReplaceObject(t *testing.T) {
+	testStorageReplaceObject(common.Bolt, t)
+}
+
+func TestBoltStorageSetACL(t *testing.T) {
+	testStorageSetACL(common.Bolt, t)
+}
+
+func TestBoltStorageObjectsByIDs(t *testing.T) {
+	testStorageObjectsByIDs(common.Bolt, t)
+}
+
+func TestBoltStorageObjectMetadataBatch(t *testing.T) {
+	testStorageObjectMetadataBatch(common.Bolt, t)
+}
+
+func TestBoltStorageObjectAttachment(t *testing.T) {
+	testStorageObjectAttachment(common.Bolt, t)
+}
+
+func TestBoltStorageObjectDelta(t *testing.T) {
+	testStorageObjectDelta(common.Bolt, t)
+}
+
+func TestBoltStorageDataAccessLog(t *testing.T) {
+	testStorageDataAccessLog(common.Bolt, t)
+}
+
+func TestBoltStorageDeleteObjectsOfType(t *testing.T) {
+	testStorageDeleteObjectsOfType(common.Bolt, t)
+}
+
+func TestBoltStorageObjectStatusChange(t *testing.T) {
+	testStorageObjectStatusChange(common.Bolt, t)
+}
+
+func TestBoltStoragePurgeCompletedNotifications(t *testing.T) {
+	testStoragePurgeCompletedNotifications(common.Bolt, t)
+}
+
+func TestBoltStorageRetrieveObjectIfModifiedSince(t *testing.T) {
+	testStorageRetrieveObjectIfModifiedSince(common.Bolt, t)
+}
+
+func TestBoltStorageExportImportOrganization(t *testing.T) {
+	testStorageExportImportOrganization(common.Bolt, t)
+}
+
 func TestBoltStorageObjectData(t *testing.T) {
 	testStorageObjectData(common.Bolt, t)
 }
 
+func TestBoltStorageMaxObjectSize(t *testing.T) {
+	testStorageMaxObjectSize(common.Bolt, t)
+}
+
 func TestBoltStorageNotifications(t *testing.T) {
 	testStorageNotifications(common.Bolt, t)
 }
 
+func TestBoltStorageNotificationResendBackoff(t *testing.T) {
+	testStorageNotificationResendBackoff(common.Bolt, t)
+}
+
+func TestBoltStorageDataComplete(t *testing.T) {
+	testStorageDataComplete(common.Bolt, t)
+}
+
 func TestBoltStorageDestinations(t *testing.T) {
 	store := &BoltStorage{}
 	store.Cleanup(true)
@@ -257,6 +461,18 @@ func TestBoltStorageOrgDeleteACLs(t *testing.T) {
 	testStorageOrgDeleteACLs(common.Bolt, t)
 }
 
+func TestBoltStorageCheckACL(t *testing.T) {
+	testStorageCheckACL(common.Bolt, t)
+}
+
+func TestBoltStorageACLUsernameNormalization(t *testing.T) {
+	testStorageACLUsernameNormalization(common.Bolt, t)
+}
+
+func TestBoltStorageRetrieveObjectsForDestination(t *testing.T) {
+	testStorageRetrieveObjectsForDestination(common.Bolt, t)
+}
+
 func TestBoltStorageMessagingGroups(t *testing.T) {
 	testStorageMessagingGroups(common.Bolt, t)
 }
@@ -265,6 +481,14 @@ func TestBoltStorageObjectDestinations(t *testing.T) {
 	testStorageObjectDestinations(common.Bolt, t)
 }
 
+func TestBoltStorageIncompleteObjects(t *testing.T) {
+	testStorageIncompleteObjects(common.Bolt, t)
+}
+
+func TestBoltStorageNoDataObjects(t *testing.T) {
+	testStorageNoDataObjects(common.Bolt, t)
+}
+
 func TestBoltStorageOrganizations(t *testing.T) {
 	testStorageOrganizations(common.Bolt, t)
 }
@@ -272,3 +496,15 @@ func TestBoltStorageOrganizations(t *testing.T) {
 func TestBoltStorageInactiveDestinations(t *testing.T) {
 	testStorageInactiveDestinations(common.Bolt, t)
 }
+
+func TestBoltStorageOfflineDestinations(t *testing.T) {
+	testStorageOfflineDestinations(common.Bolt, t)
+}
+
+func TestBoltStorageRegisterDestination(t *testing.T) {
+	testStorageRegisterDestination(common.Bolt, t)
+}
+
+func TestBoltStorageDecommissionDestination(t *testing.T) {
+	testStorageDecommissionDestination(common.Bolt, t)
+}
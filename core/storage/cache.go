@@ -39,7 +39,7 @@ func (store *Cache) cacheDestinations() common.SyncServiceError {
 		if store.destinations[dest.DestOrgID] == nil {
 			store.destinations[dest.DestOrgID] = make(map[string]common.Destination, 0)
 		}
-		id := dest.DestType + ":" + dest.DestID
+		id := createDestinationKey(dest.DestType, dest.DestID)
 		store.destinations[dest.DestOrgID][id] = dest
 	}
 	return nil
@@ -61,8 +61,8 @@ func (store *Cache) Cleanup(isTest bool) common.SyncServiceError {
 }
 
 // StoreObject stores an object
-func (store *Cache) StoreObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
-	return store.Store.StoreObject(metaData, data, status)
+func (store *Cache) StoreObject(metaData common.MetaData, data []byte, status string, identity string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	return store.Store.StoreObject(metaData, data, status, identity)
 }
 
 // StoreObjectData stores an object's data
@@ -72,6 +72,13 @@ func (store *Cache) StoreObjectData(orgID string, objectType string, objectID st
 	return store.Store.StoreObjectData(orgID, objectType, objectID, dataReader)
 }
 
+// ReplaceObject replaces the meta data and the data of an existing object.
+// Readers see either the previous meta data and data or the new ones.
+// The status and the destinations of the object are kept.
+func (store *Cache) ReplaceObject(metaData common.MetaData, dataReader io.Reader, identity string) common.SyncServiceError {
+	return store.Store.ReplaceObject(metaData, dataReader, identity)
+}
+
 func (store *Cache) StoreObjectTempData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
 	return store.Store.StoreObjectTempData(orgID, objectType, objectID, dataReader)
 }
@@ -90,9 +97,25 @@ func (store *Cache) AppendObjectData(orgID string, objectType string, objectID s
 	return store.Store.AppendObjectData(orgID, objectType, objectID, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
 }
 
+// AppendObjectDelta reconstructs the data of the object from its stored base data and a binary patch, and stores the result
+func (store *Cache) AppendObjectDelta(orgID string, objectType string, objectID string, baseDataID int64, patch io.Reader,
+	size int64, hash string) common.SyncServiceError {
+	return store.Store.AppendObjectDelta(orgID, objectType, objectID, baseDataID, patch, size, hash)
+}
+
 // UpdateObjectStatus updates an object's status
-func (store *Cache) UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError {
-	return store.Store.UpdateObjectStatus(orgID, objectType, objectID, status)
+func (store *Cache) UpdateObjectStatus(orgID string, objectType string, objectID string, status string, identity string) common.SyncServiceError {
+	return store.Store.UpdateObjectStatus(orgID, objectType, objectID, status, identity)
+}
+
+// PatchObjectMetadata updates the specified fields of the object's meta data
+func (store *Cache) PatchObjectMetadata(orgID string, objectType string, objectID string, patch map[string]interface{}) common.SyncServiceError {
+	return store.Store.PatchObjectMetadata(orgID, objectType, objectID, patch)
+}
+
+// TouchObject extends the expiration time of an object that is being delivered
+func (store *Cache) TouchObject(orgID string, objectType string, objectID string, extendBy time.Duration) common.SyncServiceError {
+	return store.Store.TouchObject(orgID, objectType, objectID, extendBy)
 }
 
 // UpdateObjectSourceDataURI pdates object's source data URI
@@ -134,6 +157,12 @@ func (store *Cache) RetrieveUpdatedObjects(orgID string, objectType string, rece
 	return store.Store.RetrieveUpdatedObjects(orgID, objectType, received)
 }
 
+// WatchObjects returns a channel of the creation, update, and deletion events of the objects of the organization,
+// and a function to stop watching
+func (store *Cache) WatchObjects(orgID string) (<-chan common.ObjectEvent, func(), common.SyncServiceError) {
+	return store.Store.WatchObjects(orgID)
+}
+
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
 func (store *Cache) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -160,11 +189,58 @@ func (store *Cache) RetrieveAllObjects(orgID string, objectType string) ([]commo
 	return store.Store.RetrieveAllObjects(orgID, objectType)
 }
 
+// RetrieveObjectStatusCounts returns the number of objects of the organization in each status.
+// If objectType is empty, the objects of all types are counted.
+func (store *Cache) RetrieveObjectStatusCounts(orgID string, objectType string) (map[string]int, common.SyncServiceError) {
+	return store.Store.RetrieveObjectStatusCounts(orgID, objectType)
+}
+
+// RetrieveStorageStatsByType returns the number of objects of the organization, the total declared size of their data,
+// and the total number of bytes used to store their data, per object type
+func (store *Cache) RetrieveStorageStatsByType(orgID string) (map[string]common.ObjectTypeStorageStats, common.SyncServiceError) {
+	return store.Store.RetrieveStorageStatsByType(orgID)
+}
+
+// RetrieveObjectsWithMissingData returns the objects of the organization whose data should be in the storage but isn't
+func (store *Cache) RetrieveObjectsWithMissingData(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsWithMissingData(orgID)
+}
+
+// RetrieveIncompleteObjects returns the objects of the organization that at least one of their destinations didn't consume
+func (store *Cache) RetrieveIncompleteObjects(orgID string, objectType string) ([]common.IncompleteObject, common.SyncServiceError) {
+	return store.Store.RetrieveIncompleteObjects(orgID, objectType)
+}
+
+// RetrieveObjectsBySizeAndAge returns the objects of the organization whose data size is at least minSize bytes
+// and that weren't updated for at least the given duration. The objects are ordered by decreasing data size.
+func (store *Cache) RetrieveObjectsBySizeAndAge(orgID string, minSize int64, olderThan time.Duration) ([]common.MetaData,
+	common.SyncServiceError) {
+	return store.Store.RetrieveObjectsBySizeAndAge(orgID, minSize, olderThan)
+}
+
+// RetrieveObjectsApproachingDeadline returns the undelivered objects of the organization whose delivery deadline
+// is within the given duration from now, including objects that already missed their deadline.
+// The objects are ordered by their delivery deadline.
+func (store *Cache) RetrieveObjectsApproachingDeadline(orgID string, within time.Duration) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsApproachingDeadline(orgID, within)
+}
+
+// RetrieveObjectsAcrossOrgs retrieves up to limit objects of all the organizations that match the filter,
+// ordered by organization, object type, and object ID, skipping the first offset objects
+func (store *Cache) RetrieveObjectsAcrossOrgs(filter common.ObjectFilter, offset int, limit int) ([]common.MetaData, int, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsAcrossOrgs(filter, offset, limit)
+}
+
 // RetrieveObjects returns the list of all the objects that need to be sent to the destination
 func (store *Cache) RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError) {
 	return store.Store.RetrieveObjects(orgID, destType, destID, resend)
 }
 
+// RetrieveObjectsForDestType returns the objects of the organization that are broadcast to all the destinations of the type
+func (store *Cache) RetrieveObjectsForDestType(orgID string, destType string) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsForDestType(orgID, destType)
+}
+
 // RetrieveConsumedObjects returns all the consumed objects originated from this node
 func (store *Cache) RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError) {
 	return store.Store.RetrieveConsumedObjects()
@@ -175,19 +251,48 @@ func (store *Cache) RetrieveObject(orgID string, objectType string, objectID str
 	return store.Store.RetrieveObject(orgID, objectType, objectID)
 }
 
+// RetrieveObjectsByIDs returns the meta data of the objects with the provided keys, in the order of the keys.
+// Objects that don't exist are omitted from the result.
+func (store *Cache) RetrieveObjectsByIDs(orgID string, keys []common.ObjectKey) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsByIDs(orgID, keys)
+}
+
+// RetrieveObjectMetadataBatch returns the meta data of the objects with the provided keys, in the order of the keys,
+// with only the requested fields set
+func (store *Cache) RetrieveObjectMetadataBatch(orgID string, keys []common.ObjectKey, fields []string) ([]common.MetaData,
+	common.SyncServiceError) {
+	return store.Store.RetrieveObjectMetadataBatch(orgID, keys, fields)
+}
+
+// RetrieveObjectInstanceID returns the instance ID of the stored object, or 0 if the object doesn't exist
+func (store *Cache) RetrieveObjectInstanceID(orgID string, objectType string, objectID string) (int64, common.SyncServiceError) {
+	return store.Store.RetrieveObjectInstanceID(orgID, objectType, objectID)
+}
+
 // RetrieveObjectAndStatus returns the object meta data and status with the specified parameters
 func (store *Cache) RetrieveObjectAndStatus(orgID string, objectType string, objectID string) (*common.MetaData, string, common.SyncServiceError) {
 	return store.Store.RetrieveObjectAndStatus(orgID, objectType, objectID)
 }
 
+// RetrieveObjectIfModifiedSince returns the object meta data and status if the object was modified after the given time
+func (store *Cache) RetrieveObjectIfModifiedSince(orgID string, objectType string, objectID string, since time.Time) (*common.MetaData, string, bool, common.SyncServiceError) {
+	return store.Store.RetrieveObjectIfModifiedSince(orgID, objectType, objectID, since)
+}
+
 // RetrieveObjectData returns the object data with the specified parameters
-func (store *Cache) RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
-	return store.Store.RetrieveObjectData(orgID, objectType, objectID)
+func (store *Cache) RetrieveObjectData(orgID string, objectType string, objectID string, identity string) (io.Reader, common.SyncServiceError) {
+	return store.Store.RetrieveObjectData(orgID, objectType, objectID, identity)
 }
 
 // ReadObjectData returns the object data with the specified parameters
-func (store *Cache) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
-	return store.Store.ReadObjectData(orgID, objectType, objectID, size, offset)
+func (store *Cache) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64,
+	identity string) ([]byte, bool, int, common.SyncServiceError) {
+	return store.Store.ReadObjectData(orgID, objectType, objectID, size, offset, identity)
+}
+
+// ReadPartialObjectData returns the object data with the specified parameters while the data may still be uploaded
+func (store *Cache) ReadPartialObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	return store.Store.ReadPartialObjectData(orgID, objectType, objectID, size, offset)
 }
 
 // CloseDataReader closes the data reader if necessary
@@ -195,9 +300,26 @@ func (store *Cache) CloseDataReader(dataReader io.Reader) common.SyncServiceErro
 	return store.Store.CloseDataReader(dataReader)
 }
 
+// SetReadOnly sets the read-only mode of the underlying store, if it supports a read-only mode
+func (store *Cache) SetReadOnly(readOnly bool) {
+	if s, ok := store.Store.(interface{ SetReadOnly(bool) }); ok {
+		s.SetReadOnly(readOnly)
+	}
+}
+
 // MarkObjectDeleted marks the object as deleted
-func (store *Cache) MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError {
-	return store.Store.MarkObjectDeleted(orgID, objectType, objectID)
+func (store *Cache) MarkObjectDeleted(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
+	return store.Store.MarkObjectDeleted(orgID, objectType, objectID, identity)
+}
+
+// RetrieveDeletedObjects returns the objects of the organization that were marked as deleted
+func (store *Cache) RetrieveDeletedObjects(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveDeletedObjects(orgID)
+}
+
+// UndeleteObject restores an object marked as deleted to its status before the deletion
+func (store *Cache) UndeleteObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.Store.UndeleteObject(orgID, objectType, objectID)
 }
 
 // MarkDestinationPolicyReceived marks an object's destination policy as having been received
@@ -210,14 +332,60 @@ func (store *Cache) ActivateObject(orgID string, objectType string, objectID str
 	return store.Store.ActivateObject(orgID, objectType, objectID)
 }
 
+// PinObject pins the object, so that it isn't deleted by AutoDelete or when it expires
+func (store *Cache) PinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.Store.PinObject(orgID, objectType, objectID)
+}
+
+// UnpinObject unpins the object, so that AutoDelete and its expiration apply to it again
+func (store *Cache) UnpinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.Store.UnpinObject(orgID, objectType, objectID)
+}
+
 // GetObjectsToActivate returns inactive objects that are ready to be activated
 func (store *Cache) GetObjectsToActivate() ([]common.MetaData, common.SyncServiceError) {
 	return store.Store.GetObjectsToActivate()
 }
 
 // DeleteStoredObject deletes the object
-func (store *Cache) DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError {
-	return store.Store.DeleteStoredObject(orgID, objectType, objectID)
+func (store *Cache) DeleteStoredObject(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
+	return store.Store.DeleteStoredObject(orgID, objectType, objectID, identity)
+}
+
+// DeleteObjectsOfType deletes all the objects of the type in the organization and their data
+func (store *Cache) DeleteObjectsOfType(orgID string, objectType string) (int, common.SyncServiceError) {
+	return store.Store.DeleteObjectsOfType(orgID, objectType)
+}
+
+// RetrieveAuditLog returns the audit log of the object's mutations
+func (store *Cache) RetrieveAuditLog(orgID string, objectType string, objectID string) ([]common.AuditRecord, common.SyncServiceError) {
+	return store.Store.RetrieveAuditLog(orgID, objectType, objectID)
+}
+
+// PurgeAuditLog deletes the audit records older than olderThan
+func (store *Cache) PurgeAuditLog(olderThan time.Duration) common.SyncServiceError {
+	return store.Store.PurgeAuditLog(olderThan)
+}
+
+// RetrieveObjectVersions returns the meta data of the kept previous versions of the object, ordered by instance ID
+func (store *Cache) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectVersions(orgID, objectType, objectID)
+}
+
+// RetrieveObjectVersion returns the meta data and the data of a kept previous version of the object
+func (store *Cache) RetrieveObjectVersion(orgID string, objectType string, objectID string, instanceID int64) (*common.MetaData, io.Reader, common.SyncServiceError) {
+	return store.Store.RetrieveObjectVersion(orgID, objectType, objectID, instanceID)
+}
+
+// IsIdempotencyKeyRecorded returns true if the idempotency key was recorded for an update of the object
+// within the last IdempotencyKeyWindow seconds
+func (store *Cache) IsIdempotencyKeyRecorded(orgID string, objectType string, objectID string, key string) (bool, common.SyncServiceError) {
+	return store.Store.IsIdempotencyKeyRecorded(orgID, objectType, objectID, key)
+}
+
+// RecordIdempotencyKey records the idempotency key of a successful update of the object
+func (store *Cache) RecordIdempotencyKey(orgID string, objectType string, objectID string, key string) common.SyncServiceError {
+	return store.Store.RecordIdempotencyKey(orgID, objectType, objectID, key)
 }
 
 // DeleteStoredData deletes the object's data
@@ -282,6 +450,37 @@ func (store *Cache) RetrieveWebhooks(orgID string, objectType string) ([]string,
 	return store.Store.RetrieveWebhooks(orgID, objectType)
 }
 
+// StoreWebhookRetryPolicy stores the webhook retry policy of an object type, replacing the existing policy of the type
+func (store *Cache) StoreWebhookRetryPolicy(policy common.WebhookRetryPolicy) common.SyncServiceError {
+	return store.Store.StoreWebhookRetryPolicy(policy)
+}
+
+// RetrieveWebhookRetryPolicy retrieves the webhook retry policy of an object type, returns nil if the type doesn't have a policy
+func (store *Cache) RetrieveWebhookRetryPolicy(orgID string, objectType string) (*common.WebhookRetryPolicy, common.SyncServiceError) {
+	return store.Store.RetrieveWebhookRetryPolicy(orgID, objectType)
+}
+
+// DeleteWebhookRetryPolicy deletes the webhook retry policy of an object type
+func (store *Cache) DeleteWebhookRetryPolicy(orgID string, objectType string) common.SyncServiceError {
+	return store.Store.DeleteWebhookRetryPolicy(orgID, objectType)
+}
+
+// StoreWebhookFailure records the failure of a webhook, replacing the previous failure of the webhook
+func (store *Cache) StoreWebhookFailure(failure common.WebhookFailure) common.SyncServiceError {
+	return store.Store.StoreWebhookFailure(failure)
+}
+
+// RetrieveWebhookFailures retrieves the recorded webhook failures of an organization
+func (store *Cache) RetrieveWebhookFailures(orgID string) ([]common.WebhookFailure, common.SyncServiceError) {
+	return store.Store.RetrieveWebhookFailures(orgID)
+}
+
+// DeleteWebhookFailures deletes the recorded webhook failures of an object type,
+// or of all the object types of the organization if objectType is empty
+func (store *Cache) DeleteWebhookFailures(orgID string, objectType string) common.SyncServiceError {
+	return store.Store.DeleteWebhookFailures(orgID, objectType)
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *Cache) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	store.lock.RLock()
@@ -308,17 +507,36 @@ func (store *Cache) RetrieveDestinations(orgID string, destType string) ([]commo
 
 // DestinationExists returns true if the destination exists, and false otherwise
 func (store *Cache) DestinationExists(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	store.lock.RLock()
 	defer store.lock.RUnlock()
 
-	if _, ok := store.destinations[orgID][destType+":"+destID]; ok {
+	if _, ok := store.destinations[orgID][createDestinationKey(destType, destID)]; ok {
 		return true, nil
 	}
 	return false, nil
 }
 
+// DestinationsExist returns a map indicating for each of the provided destinations whether it exists
+func (store *Cache) DestinationsExist(orgID string, dests []common.DestinationID) (map[common.DestinationID]bool, common.SyncServiceError) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	exist := make(map[common.DestinationID]bool, len(dests))
+	orgID, normalized := normalizeDestinationIDs(orgID, dests)
+	for i, dest := range dests {
+		_, exist[dest] = store.destinations[orgID][createDestinationKey(normalized[i].DestType, normalized[i].DestID)]
+	}
+	return exist, nil
+}
+
 // StoreDestination stores the destination
 func (store *Cache) StoreDestination(dest common.Destination) common.SyncServiceError {
+	// The destination is cached as it is stored, with its organization, type, and ID trimmed
+	dest.Normalize()
+	if err := dest.Validate(); err != nil {
+		return err
+	}
 	if err := store.Store.StoreDestination(dest); err != nil {
 		return err
 	}
@@ -326,15 +544,62 @@ func (store *Cache) StoreDestination(dest common.Destination) common.SyncService
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
+	store.cacheDestination(dest)
+	return nil
+}
+
+// StoreDestinations stores the destinations together, the returned errors correspond to the destinations
+func (store *Cache) StoreDestinations(dests []common.Destination) ([]common.SyncServiceError, common.SyncServiceError) {
+	normalized := make([]common.Destination, len(dests))
+	for i, dest := range dests {
+		dest.Normalize()
+		normalized[i] = dest
+	}
+	errs, err := store.Store.StoreDestinations(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for i, dest := range normalized {
+		if errs[i] == nil {
+			store.cacheDestination(dest)
+		}
+	}
+	return errs, nil
+}
+
+// cacheDestination adds the destination to the cached destinations, the lock must be held by the caller
+func (store *Cache) cacheDestination(dest common.Destination) {
 	if store.destinations[dest.DestOrgID] == nil {
 		store.destinations[dest.DestOrgID] = make(map[string]common.Destination, 0)
 	}
-	store.destinations[dest.DestOrgID][dest.DestType+":"+dest.DestID] = dest
+	store.destinations[dest.DestOrgID][createDestinationKey(dest.DestType, dest.DestID)] = dest
+}
+
+// RegisterDestination stores the destination when it registers or sends a heartbeat, and records the current time
+// as the destination's last ping and connection times
+func (store *Cache) RegisterDestination(dest common.Destination) common.SyncServiceError {
+	dest.Normalize()
+	if err := dest.Validate(); err != nil {
+		return err
+	}
+	if err := store.Store.RegisterDestination(dest); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.cacheDestination(dest)
 	return nil
 }
 
 // DeleteDestination deletes the destination
 func (store *Cache) DeleteDestination(orgID string, destType string, destID string) common.SyncServiceError {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	if err := store.Store.DeleteDestination(orgID, destType, destID); err != nil {
 		return err
 	}
@@ -342,15 +607,37 @@ func (store *Cache) DeleteDestination(orgID string, destType string, destID stri
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
-	delete(store.destinations[orgID], destType+":"+destID)
+	delete(store.destinations[orgID], createDestinationKey(destType, destID))
 	return nil
 }
 
+// DecommissionDestination removes the destination from the destinations lists of all the objects,
+// and deletes its notifications and the destination itself
+func (store *Cache) DecommissionDestination(orgID string, destType string, destID string) (*common.DecommissionedDestination, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	result, err := store.Store.DecommissionDestination(orgID, destType, destID)
+	if err != nil {
+		return nil, err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.destinations[orgID], createDestinationKey(destType, destID))
+	return result, nil
+}
+
 // UpdateDestinationLastPingTime updates the last ping time for the destination
 func (store *Cache) UpdateDestinationLastPingTime(destination common.Destination) common.SyncServiceError {
+	destination.Normalize()
 	return store.Store.UpdateDestinationLastPingTime(destination) // ???
 }
 
+// RetrieveOfflineDestinations returns the destinations of the organization that haven't connected for the provided duration
+func (store *Cache) RetrieveOfflineDestinations(orgID string, idleFor time.Duration) ([]common.Destination, common.SyncServiceError) {
+	return store.Store.RetrieveOfflineDestinations(orgID, idleFor)
+}
+
 // RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 func (store *Cache) RemoveInactiveDestinations(lastTimestamp time.Time) {
 	store.Store.RemoveInactiveDestinations(lastTimestamp)
@@ -364,10 +651,11 @@ func (store *Cache) GetNumberOfDestinations() (uint32, common.SyncServiceError)
 
 // RetrieveDestination retrieves a destination
 func (store *Cache) RetrieveDestination(orgID string, destType string, destID string) (*common.Destination, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	store.lock.RLock()
 	defer store.lock.RUnlock()
 
-	if d, ok := store.destinations[orgID][destType+":"+destID]; ok {
+	if d, ok := store.destinations[orgID][createDestinationKey(destType, destID)]; ok {
 		return &d, nil
 	}
 	return nil, &Error{fmt.Sprintf("Destination %s not found.", orgID+":"+destType+":"+destID)}
@@ -375,10 +663,11 @@ func (store *Cache) RetrieveDestination(orgID string, destType string, destID st
 
 // RetrieveDestinationProtocol retrieves the communication protocol for the destination
 func (store *Cache) RetrieveDestinationProtocol(orgID string, destType string, destID string) (string, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	store.lock.RLock()
 	defer store.lock.RUnlock()
 
-	if d, ok := store.destinations[orgID][destType+":"+destID]; ok {
+	if d, ok := store.destinations[orgID][createDestinationKey(destType, destID)]; ok {
 		return d.Communication, nil
 	}
 	return "", &Error{fmt.Sprintf("Destination %s not found.", orgID+":"+destType+":"+destID)}
@@ -389,6 +678,11 @@ func (store *Cache) GetObjectsForDestination(orgID string, destType string, dest
 	return store.Store.GetObjectsForDestination(orgID, destType, destID)
 }
 
+// RetrieveObjectsForDestination retrieves the meta data and status of the objects that are in use on a given node
+func (store *Cache) RetrieveObjectsForDestination(orgID string, destType string, destID string, status string) ([]common.ObjectStatusWithMetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsForDestination(orgID, destType, destID, status)
+}
+
 // RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and returns the list of metadata
 func (store *Cache) RetrieveAllObjectsAndUpdateDestinationListForDestination(orgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
 	return store.Store.RetrieveAllObjectsAndUpdateDestinationListForDestination(orgID, destType, destID)
@@ -409,7 +703,14 @@ func (store *Cache) UpdateNotificationRecord(notification common.Notification) c
 	return store.Store.UpdateNotificationRecord(notification)
 }
 
-// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+// UpdateNotificationRecords updates/adds the notification records, for example the notifications of an object
+// to all its destinations, in as few writes as the storage allows
+func (store *Cache) UpdateNotificationRecords(notifications []common.Notification) common.SyncServiceError {
+	return store.Store.UpdateNotificationRecords(notifications)
+}
+
+// UpdateNotificationResendTime increments the resend attempts of the notification and sets its resend time
+// according to the number of attempts (see common.GetNotificationResendInterval)
 func (store *Cache) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
 	return store.Store.UpdateNotificationResendTime(notification)
 }
@@ -426,6 +727,11 @@ func (store *Cache) DeleteNotificationRecords(orgID string, objectType string, o
 	return store.Store.DeleteNotificationRecords(orgID, objectType, objectID, destType, destID)
 }
 
+// PurgeCompletedNotifications deletes the notifications in a completed state that weren't updated for longer than olderThan
+func (store *Cache) PurgeCompletedNotifications(orgID string, olderThan time.Duration) (int, common.SyncServiceError) {
+	return store.Store.PurgeCompletedNotifications(orgID, olderThan)
+}
+
 // RetrieveNotifications returns the list of all the notifications that need to be resent to the destination
 func (store *Cache) RetrieveNotifications(orgID string, destType string, destID string, retrieveReceived bool) ([]common.Notification, common.SyncServiceError) {
 	return store.Store.RetrieveNotifications(orgID, destType, destID, retrieveReceived)
@@ -456,6 +762,11 @@ func (store *Cache) UpdateLeader(leaderID string, version int64) (bool, common.S
 	return store.Store.UpdateLeader(leaderID, version)
 }
 
+// RequestLeaderHandoff asks the leader to hand off the leadership, if its priority is lower than this node's priority
+func (store *Cache) RequestLeaderHandoff(leaderID string, version int64) (bool, common.SyncServiceError) {
+	return store.Store.RequestLeaderHandoff(leaderID, version)
+}
+
 // ResignLeadership causes this sync service to give up the Leadership
 func (store *Cache) ResignLeadership(leaderID string) common.SyncServiceError {
 	return store.Store.ResignLeadership(leaderID)
@@ -466,6 +777,11 @@ func (store *Cache) RetrieveTimeOnServer() (time.Time, error) {
 	return store.Store.RetrieveTimeOnServer()
 }
 
+// IsLeaderAlive returns true if the leader's last heartbeat is within its heartbeat timeout, together with the leader's ID
+func (store *Cache) IsLeaderAlive() (bool, string, common.SyncServiceError) {
+	return store.Store.IsLeaderAlive()
+}
+
 // StoreOrgToMessagingGroup inserts organization to messaging groups table
 func (store *Cache) StoreOrgToMessagingGroup(orgID string, messagingGroup string) common.SyncServiceError {
 	return store.Store.StoreOrgToMessagingGroup(orgID, messagingGroup)
@@ -486,6 +802,11 @@ func (store *Cache) RetrieveUpdatedMessagingGroups(time time.Time) ([]common.Mes
 	return store.Store.RetrieveUpdatedMessagingGroups(time)
 }
 
+// RetrieveDestinationsInMessagingGroup returns all the destinations of the organizations in the messaging group
+func (store *Cache) RetrieveDestinationsInMessagingGroup(groupName string) ([]common.Destination, common.SyncServiceError) {
+	return store.Store.RetrieveDestinationsInMessagingGroup(groupName)
+}
+
 // DeleteOrganization cleans up the storage from all the records associated with the organization
 func (store *Cache) DeleteOrganization(orgID string) common.SyncServiceError {
 	delete(store.destinations, orgID)
@@ -493,6 +814,17 @@ func (store *Cache) DeleteOrganization(orgID string) common.SyncServiceError {
 	return store.Store.DeleteOrganization(orgID)
 }
 
+// ExportOrganization writes all the records associated with the organization to the writer
+func (store *Cache) ExportOrganization(orgID string, w io.Writer) common.SyncServiceError {
+	return store.Store.ExportOrganization(orgID, w)
+}
+
+// ImportOrganization stores the records of an organization read from an export created by ExportOrganization
+func (store *Cache) ImportOrganization(r io.Reader) common.SyncServiceError {
+	// Import through the cache to keep the cached destinations up to date
+	return importOrganization(store, r)
+}
+
 // IsConnected returns false if the storage cannont be reached, and true otherwise
 func (store *Cache) IsConnected() bool {
 	return store.Store.IsConnected()
@@ -519,6 +851,12 @@ func (store *Cache) RetrieveOrganizations() ([]common.StoredOrganization, common
 	return store.Store.RetrieveOrganizations()
 }
 
+// RetrieveOrganizationsPage retrieves up to limit stored organizations' info, ordered by organization ID,
+// skipping the first offset organizations
+func (store *Cache) RetrieveOrganizationsPage(offset int, limit int) ([]common.StoredOrganization, int, common.SyncServiceError) {
+	return store.Store.RetrieveOrganizationsPage(offset, limit)
+}
+
 // RetrieveUpdatedOrganizations retrieves organizations that were updated after the specified time
 func (store *Cache) RetrieveUpdatedOrganizations(time time.Time) ([]common.StoredOrganization, common.SyncServiceError) {
 	return store.Store.RetrieveUpdatedOrganizations(time)
@@ -534,6 +872,11 @@ func (store *Cache) RemoveUsersFromACL(aclType string, orgID string, key string,
 	return store.Store.RemoveUsersFromACL(aclType, orgID, key, users)
 }
 
+// SetACL replaces the users of an ACL with the provided users, an empty list of users deletes the ACL
+func (store *Cache) SetACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	return store.Store.SetACL(aclType, orgID, key, users)
+}
+
 // RetrieveACL retrieves the list of usernames on an ACL
 func (store *Cache) RetrieveACL(aclType string, orgID string, key string, aclUserType string) ([]common.ACLentry, common.SyncServiceError) {
 	return store.Store.RetrieveACL(aclType, orgID, key, aclUserType)
@@ -546,7 +889,80 @@ func (store *Cache) RetrieveACLsInOrg(aclType string, orgID string) ([]string, c
 
 // RetrieveObjOrDestTypeForGivenACLUser retrieves object types that given acl user has access to
 func (store *Cache) RetrieveObjOrDestTypeForGivenACLUser(aclType string, orgID string, aclUserType string, aclUsername string, aclRole string) ([]string, common.SyncServiceError) {
-	return nil, nil
+	return store.Store.RetrieveObjOrDestTypeForGivenACLUser(aclType, orgID, aclUserType, aclUsername, aclRole)
+}
+
+// NormalizeACLUsernames rewrites the stored ACLs with normalized usernames, merging the entries of the same user.
+// Returns the number of the modified ACLs.
+func (store *Cache) NormalizeACLUsernames() (int, common.SyncServiceError) {
+	return store.Store.NormalizeACLUsernames()
+}
+
+// CheckACL returns true if the user is granted access by the ACL of the key or by the ACL of all the keys,
+// either directly, by a wildcard entry, or by the membership in a group
+func (store *Cache) CheckACL(aclType string, orgID string, key string, username string) (bool, common.SyncServiceError) {
+	return store.Store.CheckACL(aclType, orgID, key, username)
+}
+
+// StoreACLGroup stores an ACL group, replacing its members if it already exists
+func (store *Cache) StoreACLGroup(group common.ACLGroup) common.SyncServiceError {
+	return store.Store.StoreACLGroup(group)
+}
+
+// RetrieveACLGroup retrieves an ACL group, returns nil if the group doesn't exist
+func (store *Cache) RetrieveACLGroup(orgID string, name string) (*common.ACLGroup, common.SyncServiceError) {
+	return store.Store.RetrieveACLGroup(orgID, name)
+}
+
+// RetrieveACLGroups retrieves the ACL groups of an organization
+func (store *Cache) RetrieveACLGroups(orgID string) ([]common.ACLGroup, common.SyncServiceError) {
+	return store.Store.RetrieveACLGroups(orgID)
+}
+
+// DeleteACLGroup deletes an ACL group
+func (store *Cache) DeleteACLGroup(orgID string, name string) common.SyncServiceError {
+	return store.Store.DeleteACLGroup(orgID, name)
+}
+
+// StoreRetentionPolicy stores the retention policy of an object type, replacing the existing policy of the type
+func (store *Cache) StoreRetentionPolicy(policy common.RetentionPolicy) common.SyncServiceError {
+	return store.Store.StoreRetentionPolicy(policy)
+}
+
+// RetrieveRetentionPolicy retrieves the retention policy of an object type, returns nil if the type doesn't have a policy
+func (store *Cache) RetrieveRetentionPolicy(orgID string, objectType string) (*common.RetentionPolicy, common.SyncServiceError) {
+	return store.Store.RetrieveRetentionPolicy(orgID, objectType)
+}
+
+// RetrieveRetentionPolicies retrieves the retention policies of an organization,
+// or of all the organizations if orgID is empty
+func (store *Cache) RetrieveRetentionPolicies(orgID string) ([]common.RetentionPolicy, common.SyncServiceError) {
+	return store.Store.RetrieveRetentionPolicies(orgID)
+}
+
+// DeleteRetentionPolicy deletes the retention policy of an object type
+func (store *Cache) DeleteRetentionPolicy(orgID string, objectType string) common.SyncServiceError {
+	return store.Store.DeleteRetentionPolicy(orgID, objectType)
+}
+
+// StoreAPIToken stores an API token, replacing it if a token with the same hash already exists
+func (store *Cache) StoreAPIToken(token common.APIToken) common.SyncServiceError {
+	return store.Store.StoreAPIToken(token)
+}
+
+// RetrieveAPIToken retrieves the API token with the given hash, returns nil if the token doesn't exist
+func (store *Cache) RetrieveAPIToken(hash string) (*common.APIToken, common.SyncServiceError) {
+	return store.Store.RetrieveAPIToken(hash)
+}
+
+// RetrieveAPITokens retrieves the API tokens of an organization
+func (store *Cache) RetrieveAPITokens(orgID string) ([]common.APIToken, common.SyncServiceError) {
+	return store.Store.RetrieveAPITokens(orgID)
+}
+
+// RevokeAPIToken deletes the API token with the given hash, the token can't be used after it is revoked
+func (store *Cache) RevokeAPIToken(hash string) common.SyncServiceError {
+	return store.Store.RevokeAPIToken(hash)
 }
 
 // IsPersistent returns true if the storage is persistent, and false otherwise
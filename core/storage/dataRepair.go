@@ -0,0 +1,22 @@
+package storage
+
+import "io"
+
+// DataRepairProvider is the interface invoked by the storage when the data of an object can't be read from the
+// database, e.g., because a GridFS chunk is corrupt. An implementation of this interface can be provided by the code
+// starting up the Sync Service to supply the object's data from an external source, such as a peer CSS or a backup store.
+// The supplied data is written to the database and the read is retried.
+type DataRepairProvider interface {
+	// RetrieveObjectData returns a reader of the object's data.
+	// A nil reader indicates that the provider doesn't have the object's data.
+	// If the reader implements io.Closer, it is closed after the data was read.
+	RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, error)
+}
+
+var dataRepairProvider DataRepairProvider
+
+// SetDataRepairProvider is called by the code starting the Sync Service to set the DataRepairProvider implementation
+// to be used to repair the data of objects. By default there is no provider, and data read errors are returned.
+func SetDataRepairProvider(provider DataRepairProvider) {
+	dataRepairProvider = provider
+}
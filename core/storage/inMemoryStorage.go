@@ -23,6 +23,7 @@ type InMemoryStorage struct {
 	objects       map[string]inMemoryObject
 	notifications map[string]common.Notification
 	webhooks      map[string][]string
+	audit         map[string][]common.AuditRecord
 	timebase      int64
 }
 
@@ -35,6 +36,9 @@ type inMemoryObject struct {
 	remainingReceivers               int
 	consumedTimestamp                time.Time
 	removedDestinationPolicyServices []common.ServiceID
+	previousStatus                   string
+	lastUpdate                       time.Time
+	dataComplete                     bool
 }
 
 // Init initializes the InMemory store
@@ -44,6 +48,7 @@ func (store *InMemoryStorage) Init() common.SyncServiceError {
 	store.objects = make(map[string]inMemoryObject)
 	store.notifications = make(map[string]common.Notification)
 	store.webhooks = make(map[string][]string)
+	store.audit = make(map[string][]common.AuditRecord)
 
 	currentTime := time.Now().UnixNano()
 	store.timebase = currentTime
@@ -77,6 +82,9 @@ func (store *InMemoryStorage) Stop() {
 
 // PerformMaintenance performs store's maintenance
 func (store *InMemoryStorage) PerformMaintenance() {
+	if maxAge := auditLogMaxAge(); maxAge > 0 {
+		store.PurgeAuditLog(maxAge)
+	}
 }
 
 // Cleanup erase the on disk Bolt database only for ESS and test
@@ -85,7 +93,24 @@ func (store *InMemoryStorage) Cleanup(isTest bool) common.SyncServiceError {
 }
 
 // StoreObject stores an object
-func (store *InMemoryStorage) StoreObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+func (store *InMemoryStorage) StoreObject(metaData common.MetaData, data []byte, status string, identity string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	deletedDests, err := store.storeObject(metaData, data, status)
+	if err != nil {
+		return nil, err
+	}
+
+	store.lock()
+	defer store.unLock()
+	store.addAuditRecord(newAuditRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.AuditStore, status, identity))
+	return deletedDests, nil
+}
+
+func (store *InMemoryStorage) storeObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	if err := metaData.Validate(); err != nil {
+		return nil, err
+	}
+	normalizeObjectTimes(&metaData)
+
 	store.lock()
 	defer store.unLock()
 
@@ -114,7 +139,9 @@ func (store *InMemoryStorage) StoreObject(metaData common.MetaData, data []byte,
 			object.remainingReceivers = metaData.ExpectedConsumers
 			if metaData.NoData {
 				object.data = nil
+				object.dataComplete = false
 			}
+			object.lastUpdate = time.Now()
 			store.objects[id] = object
 			return nil, nil
 		}
@@ -124,7 +151,8 @@ func (store *InMemoryStorage) StoreObject(metaData common.MetaData, data []byte,
 		data = nil
 	}
 	store.objects[id] = inMemoryObject{meta: metaData, data: data, status: status,
-		remainingConsumers: metaData.ExpectedConsumers, remainingReceivers: metaData.ExpectedConsumers}
+		remainingConsumers: metaData.ExpectedConsumers, remainingReceivers: metaData.ExpectedConsumers, lastUpdate: time.Now(),
+		dataComplete: storedDataComplete(metaData, data, false)}
 
 	return nil, nil
 }
@@ -135,7 +163,11 @@ func (store *InMemoryStorage) StoreObject(metaData common.MetaData, data []byte,
 func (store *InMemoryStorage) StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
 	var data []byte
 	var err error
-	if data, err = ioutil.ReadAll(dataReader); err != nil {
+	limiter := newObjectSizeLimiter(objectType, dataReader, 0)
+	if data, err = ioutil.ReadAll(limiter); err != nil {
+		if limiter.exceeded != nil {
+			return false, limiter.exceeded
+		}
 		return false, err
 	}
 
@@ -154,6 +186,8 @@ func (store *InMemoryStorage) StoreObjectData(orgID string, objectType string, o
 		}
 		object.data = data
 		object.meta.ObjectSize = int64(len(object.data))
+		object.dataComplete = true
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return true, nil
 	}
@@ -161,6 +195,51 @@ func (store *InMemoryStorage) StoreObjectData(orgID string, objectType string, o
 	return false, nil
 }
 
+// ReplaceObject replaces the meta data and the data of an existing object.
+// Readers see either the previous meta data and data or the new ones.
+// The status and the destinations of the object are kept.
+func (store *InMemoryStorage) ReplaceObject(metaData common.MetaData, dataReader io.Reader, identity string) common.SyncServiceError {
+	if err := checkReplacementMetaData(metaData); err != nil {
+		return err
+	}
+	normalizeObjectTimes(&metaData)
+
+	limiter := newObjectSizeLimiter(metaData.ObjectType, dataReader, 0)
+	data, err := ioutil.ReadAll(limiter)
+	if err != nil {
+		if limiter.exceeded != nil {
+			return limiter.exceeded
+		}
+		return err
+	}
+
+	store.lock()
+	defer store.unLock()
+
+	id := getObjectCollectionID(metaData)
+	object, ok := store.objects[id]
+	if !ok {
+		return notFound
+	}
+	if object.status == common.NotReadyToSend || object.status == common.ReadyToSend {
+		newID := store.getInstanceID()
+		metaData.InstanceID = newID
+		metaData.DataID = newID
+	} else {
+		metaData.InstanceID = object.meta.InstanceID
+		metaData.DataID = object.meta.DataID
+	}
+	metaData.ObjectSize = int64(len(data))
+
+	object.meta = metaData
+	object.data = data
+	object.dataComplete = true
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	store.addAuditRecord(newAuditRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.AuditStore, object.status, identity))
+	return nil
+}
+
 func (store *InMemoryStorage) StoreObjectTempData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
 	var data []byte
 	var err error
@@ -174,6 +253,7 @@ func (store *InMemoryStorage) StoreObjectTempData(orgID string, objectType strin
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.tmpData = data
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return true, nil
 	}
@@ -189,6 +269,7 @@ func (store *InMemoryStorage) RemoveObjectTempData(orgID string, objectType stri
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.tmpData = nil
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return nil
 	}
@@ -214,6 +295,12 @@ func (store *InMemoryStorage) RetrieveTempObjectData(orgID string, objectType st
 // AppendObjectData appends a chunk of data to the object's data
 func (store *InMemoryStorage) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32,
 	offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	if isFirstChunk {
+		if err := checkObjectSize(objectType, total); err != nil {
+			return err
+		}
+	}
+
 	store.lock()
 	defer store.unLock()
 
@@ -222,12 +309,22 @@ func (store *InMemoryStorage) AppendObjectData(orgID string, objectType string,
 	if ok {
 		var data []byte
 		if dataLength == 0 {
-			dt, err := ioutil.ReadAll(dataReader)
+			limiter := newObjectSizeLimiter(objectType, dataReader, offset)
+			dt, err := ioutil.ReadAll(limiter)
+			if limiter.exceeded != nil {
+				object.data = nil
+				store.objects[id] = object
+				return limiter.exceeded
+			}
 			if err != nil {
 				return &Error{"Failed to read object data. Error: " + err.Error()}
 			}
 			data = dt
 			dataLength = uint32(len(data))
+		} else if err := checkObjectSize(objectType, offset+int64(dataLength)); err != nil {
+			object.data = nil
+			store.objects[id] = object
+			return err
 		}
 		if total < offset+int64(dataLength) {
 			total = offset + int64(dataLength)
@@ -248,6 +345,8 @@ func (store *InMemoryStorage) AppendObjectData(orgID string, objectType string,
 				return &Error{fmt.Sprintf("Read %d bytes for the object data, instead of %d", count, dataLength)}
 			}
 		}
+		object.dataComplete = isLastChunk
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return nil
 	}
@@ -255,22 +354,76 @@ func (store *InMemoryStorage) AppendObjectData(orgID string, objectType string,
 	return notFound
 }
 
+// AppendObjectDelta reconstructs the data of the object from its stored base data and a binary patch, and stores the result
+func (store *InMemoryStorage) AppendObjectDelta(orgID string, objectType string, objectID string, baseDataID int64, patch io.Reader,
+	size int64, hash string) common.SyncServiceError {
+	return appendObjectDelta(store, orgID, objectType, objectID, baseDataID, patch, size, hash)
+}
+
 // UpdateObjectStatus updates an object's status
-func (store *InMemoryStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError {
+func (store *InMemoryStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string, identity string) common.SyncServiceError {
+	store.lock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := store.objects[id]
+	if !ok {
+		store.unLock()
+		return &NotFound{"Object not found"}
+	}
+	oldStatus := object.status
+	object.status = status
+	if status == common.ConsumedByDest {
+		object.consumedTimestamp = time.Now()
+	}
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditUpdateStatus, status, identity))
+	store.unLock()
+
+	notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+		OldStatus: oldStatus, NewStatus: status})
+	return nil
+}
+
+// PatchObjectMetadata updates the specified fields of the object's meta data
+func (store *InMemoryStorage) PatchObjectMetadata(orgID string, objectType string, objectID string, patch map[string]interface{}) common.SyncServiceError {
+	fields, err := validateObjectMetadataPatch(patch)
+	if err != nil {
+		return err
+	}
+
+	store.lock()
+	defer store.unLock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		applyObjectMetadataPatch(&object.meta, fields)
+		object.lastUpdate = time.Now()
+		store.objects[id] = object
+		return nil
+	}
+
+	return notFound
+}
+
+// TouchObject extends the expiration time of an object that is being delivered
+func (store *InMemoryStorage) TouchObject(orgID string, objectType string, objectID string, extendBy time.Duration) common.SyncServiceError {
 	store.lock()
 	defer store.unLock()
 
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
-		object.status = status
-		if status == common.ConsumedByDest {
-			object.consumedTimestamp = time.Now()
+		expiration, err := touchObjectExpiration(object.status, object.meta, extendBy)
+		if err != nil || expiration == "" {
+			return err
 		}
+		object.meta.Expiration = expiration
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return nil
 	}
 
-	return &NotFound{"Object not found"}
+	return notFound
 }
 
 // UpdateObjectSourceDataURI updates object's source data URI
@@ -281,6 +434,7 @@ func (store *InMemoryStorage) UpdateObjectSourceDataURI(orgID string, objectType
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.meta.SourceDataURI = sourceDataURI
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return nil
 	}
@@ -323,6 +477,7 @@ func (store *InMemoryStorage) ResetObjectRemainingConsumers(orgID string, object
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.remainingConsumers = object.meta.ExpectedConsumers
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return nil
 	}
@@ -339,6 +494,7 @@ func (store *InMemoryStorage) DecrementAndReturnRemainingConsumers(orgID string,
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.remainingConsumers--
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return object.remainingConsumers, nil
 	}
@@ -355,6 +511,7 @@ func (store *InMemoryStorage) DecrementAndReturnRemainingReceivers(orgID string,
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.remainingReceivers--
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return object.remainingReceivers, nil
 	}
@@ -379,6 +536,12 @@ func (store *InMemoryStorage) RetrieveUpdatedObjects(orgID string, objectType st
 	return result, nil
 }
 
+// WatchObjects returns a channel of the creation, update, and deletion events of the objects of the organization.
+// It isn't supported by this storage.
+func (store *InMemoryStorage) WatchObjects(orgID string) (<-chan common.ObjectEvent, func(), common.SyncServiceError) {
+	return nil, nil, &Error{"Watching objects is only supported by the MongoDB storage"}
+}
+
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
 func (store *InMemoryStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -417,6 +580,119 @@ func (store *InMemoryStorage) RetrieveAllObjects(orgID string, objectType string
 	return result, nil
 }
 
+// RetrieveObjectStatusCounts returns the number of objects of the organization in each status.
+// If objectType is empty, the objects of all types are counted.
+func (store *InMemoryStorage) RetrieveObjectStatusCounts(orgID string, objectType string) (map[string]int, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	counts := make(map[string]int)
+	for _, object := range store.objects {
+		if objectType == "" || object.meta.ObjectType == objectType {
+			counts[object.status]++
+		}
+	}
+	return counts, nil
+}
+
+// RetrieveStorageStatsByType returns the number of objects of the organization, the total declared size of their data,
+// and the total number of bytes used to store their data, per object type
+func (store *InMemoryStorage) RetrieveStorageStatsByType(orgID string) (map[string]common.ObjectTypeStorageStats, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	stats := make(map[string]common.ObjectTypeStorageStats)
+	for _, object := range store.objects {
+		typeStats := stats[object.meta.ObjectType]
+		typeStats.ObjectType = object.meta.ObjectType
+		typeStats.ObjectCount++
+		typeStats.ObjectSize += object.meta.ObjectSize
+		typeStats.StoredDataSize += int64(len(object.data))
+		stats[object.meta.ObjectType] = typeStats
+	}
+	return stats, nil
+}
+
+// RetrieveIncompleteObjects returns the objects of the organization that at least one of their destinations didn't consume.
+// The in-memory storage doesn't keep the destinations of objects.
+func (store *InMemoryStorage) RetrieveIncompleteObjects(orgID string, objectType string) ([]common.IncompleteObject, common.SyncServiceError) {
+	return make([]common.IncompleteObject, 0), nil
+}
+
+// RetrieveObjectsWithMissingData returns the objects of the organization whose data should be in the storage but isn't
+func (store *InMemoryStorage) RetrieveObjectsWithMissingData(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID && objectExpectsData(object.meta, object.status) && object.data == nil {
+			result = append(result, object.meta)
+		}
+	}
+	return result, nil
+}
+
+// RetrieveObjectsBySizeAndAge returns the objects of the organization whose data size is at least minSize bytes
+// and that weren't updated for at least the given duration. The objects are ordered by decreasing data size.
+func (store *InMemoryStorage) RetrieveObjectsBySizeAndAge(orgID string, minSize int64, olderThan time.Duration) ([]common.MetaData,
+	common.SyncServiceError) {
+	before, err := objectsBySizeAndAgeLimit(minSize, olderThan)
+	if err != nil {
+		return nil, err
+	}
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID && object.meta.ObjectSize >= minSize && !object.lastUpdate.After(before) {
+			result = append(result, object.meta)
+		}
+	}
+	sortBySizeDescending(result)
+	return result, nil
+}
+
+// RetrieveObjectsApproachingDeadline returns the undelivered objects of the organization whose delivery deadline
+// is within the given duration from now, including objects that already missed their deadline.
+// The objects are ordered by their delivery deadline.
+func (store *InMemoryStorage) RetrieveObjectsApproachingDeadline(orgID string, within time.Duration) ([]common.MetaData, common.SyncServiceError) {
+	limit, err := deliveryDeadlineLimit(within)
+	if err != nil {
+		return nil, err
+	}
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if isObjectApproachingDeadline(object.meta, object.status, nil, limit) {
+			result = append(result, object.meta)
+		}
+	}
+	sortByDeliveryDeadline(result)
+	return result, nil
+}
+
+// RetrieveObjectsAcrossOrgs retrieves up to limit objects of all the organizations that match the filter,
+// ordered by organization, object type, and object ID, skipping the first offset objects
+func (store *InMemoryStorage) RetrieveObjectsAcrossOrgs(filter common.ObjectFilter, offset int, limit int) ([]common.MetaData, int, common.SyncServiceError) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, &common.InvalidRequest{Message: "Offset and limit must be non-negative numbers"}
+	}
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if objectMatchesFilter(object.meta, filter) {
+			result = append(result, object.meta)
+		}
+	}
+	return pageObjects(result, offset, limit), len(result), nil
+}
+
 // RetrieveObjects returns the list of all the objects that need to be sent to the destination
 func (store *InMemoryStorage) RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError) {
 	store.lock()
@@ -433,6 +709,20 @@ func (store *InMemoryStorage) RetrieveObjects(orgID string, destType string, des
 	return result, nil
 }
 
+// RetrieveObjectsForDestType returns the objects of the organization that are broadcast to all the destinations of the type
+func (store *InMemoryStorage) RetrieveObjectsForDestType(orgID string, destType string) ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if object.meta.Broadcast && object.meta.DestType == destType {
+			result = append(result, object.meta)
+		}
+	}
+	return result, nil
+}
+
 // RetrieveConsumedObjects returns all the consumed objects originated from this node
 func (store *InMemoryStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError) {
 	store.lock()
@@ -460,6 +750,39 @@ func (store *InMemoryStorage) RetrieveObject(orgID string, objectType string, ob
 	return nil, nil
 }
 
+// RetrieveObjectsByIDs returns the meta data of the objects with the provided keys, in the order of the keys.
+// Objects that don't exist are omitted from the result.
+func (store *InMemoryStorage) RetrieveObjectsByIDs(orgID string, keys []common.ObjectKey) ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	metaDatas := make([]common.MetaData, 0, len(keys))
+	for _, key := range keys {
+		if object, ok := store.objects[createObjectCollectionID(orgID, key.ObjectType, key.ObjectID)]; ok {
+			metaDatas = append(metaDatas, object.meta)
+		}
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectMetadataBatch returns the meta data of the objects with the provided keys, in the order of the keys,
+// with only the requested fields set
+func (store *InMemoryStorage) RetrieveObjectMetadataBatch(orgID string, keys []common.ObjectKey, fields []string) ([]common.MetaData,
+	common.SyncServiceError) {
+	return retrieveObjectMetadataBatch(store, orgID, keys, fields)
+}
+
+// RetrieveObjectInstanceID returns the instance ID of the stored object, or 0 if the object doesn't exist
+func (store *InMemoryStorage) RetrieveObjectInstanceID(orgID string, objectType string, objectID string) (int64, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	if object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		return object.meta.InstanceID, nil
+	}
+	return 0, nil
+}
+
 // RetrieveObjectAndStatus returns the object meta data and status with the specified parameters
 func (store *InMemoryStorage) RetrieveObjectAndStatus(orgID string, objectType string, objectID string) (*common.MetaData, string, common.SyncServiceError) {
 	store.lock()
@@ -467,20 +790,39 @@ func (store *InMemoryStorage) RetrieveObjectAndStatus(orgID string, objectType s
 
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
+		object.meta.DataComplete = object.dataComplete
 		return &object.meta, object.status, nil
 	}
 
 	return nil, "", nil
 }
 
+// RetrieveObjectIfModifiedSince returns the object meta data and status if the object was modified after the given time
+func (store *InMemoryStorage) RetrieveObjectIfModifiedSince(orgID string, objectType string, objectID string, since time.Time) (*common.MetaData, string, bool, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		if !object.lastUpdate.After(since) {
+			return nil, "", false, nil
+		}
+		return &object.meta, object.status, true, nil
+	}
+	return nil, "", true, nil
+}
+
 // RetrieveObjectData returns the object data with the specified parameters
-func (store *InMemoryStorage) RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
+func (store *InMemoryStorage) RetrieveObjectData(orgID string, objectType string, objectID string, identity string) (io.Reader, common.SyncServiceError) {
 	store.lock()
 	defer store.unLock()
 
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		if object.data != nil && len(object.data) > 0 {
+			if dataAccessLogged(identity) {
+				store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, int64(len(object.data))))
+			}
 			return bytes.NewReader(object.data), nil
 		}
 		return nil, nil
@@ -494,12 +836,15 @@ func (store *InMemoryStorage) CloseDataReader(dataReader io.Reader) common.SyncS
 	switch v := dataReader.(type) {
 	case *os.File:
 		return v.Close()
+	case io.Closer:
+		return v.Close()
 	}
 	return nil
 }
 
 // ReadObjectData returns the object data with the specified parameters
-func (store *InMemoryStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+func (store *InMemoryStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64,
+	identity string) ([]byte, bool, int, common.SyncServiceError) {
 	store.lock()
 	defer store.unLock()
 
@@ -517,26 +862,84 @@ func (store *InMemoryStorage) ReadObjectData(orgID string, objectType string, ob
 		}
 		b := make([]byte, s)
 		copy(b, object.data[offset:])
+		if dataAccessLogged(identity) {
+			store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, s))
+		}
 		return b, eof, int(s), nil
 	}
 
 	return nil, true, 0, &common.NotFound{}
 }
 
+// ReadPartialObjectData returns the object data with the specified parameters while the data may still be uploaded.
+// The in-memory store writes the uploaded data directly to the object, so it is the same as ReadObjectData.
+func (store *InMemoryStorage) ReadPartialObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	return store.ReadObjectData(orgID, objectType, objectID, size, offset, "")
+}
+
 // MarkObjectDeleted marks the object as deleted
-func (store *InMemoryStorage) MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError {
+func (store *InMemoryStorage) MarkObjectDeleted(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
 	store.lock()
-	defer store.unLock()
 
 	id := createObjectCollectionID(orgID, objectType, objectID)
-	if object, ok := store.objects[id]; ok {
-		object.meta.Deleted = true
-		object.status = common.ObjDeleted
-		store.objects[id] = object
-		return nil
+	object, ok := store.objects[id]
+	if !ok {
+		store.unLock()
+		return notFound
+	}
+	oldStatus := object.status
+	if object.status != common.ObjDeleted {
+		object.previousStatus = object.status
 	}
+	object.meta.Deleted = true
+	object.status = common.ObjDeleted
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditMarkDeleted, common.ObjDeleted, identity))
+	store.unLock()
+
+	notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+		OldStatus: oldStatus, NewStatus: common.ObjDeleted})
+	return nil
+}
 
-	return notFound
+// RetrieveDeletedObjects returns the objects of the organization that were marked as deleted
+func (store *InMemoryStorage) RetrieveDeletedObjects(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make([]common.MetaData, 0)
+	for _, obj := range store.objects {
+		if obj.meta.DestOrgID == orgID && obj.status == common.ObjDeleted {
+			result = append(result, obj.meta)
+		}
+	}
+	return result, nil
+}
+
+// UndeleteObject restores an object marked as deleted to its status before the deletion
+// The object can be restored only if its data still exists
+func (store *InMemoryStorage) UndeleteObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := store.objects[id]
+	if !ok {
+		return notFound
+	}
+	if err := checkObjectUndeletable(object.status, object.previousStatus); err != nil {
+		return err
+	}
+	if objectDataRequired(object.meta) && object.data == nil {
+		return objectDataMissing
+	}
+	object.status = object.previousStatus
+	object.previousStatus = ""
+	object.meta.Deleted = false
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	return nil
 }
 
 // MarkDestinationPolicyReceived marks an object's destination policy as having been received
@@ -552,6 +955,32 @@ func (store *InMemoryStorage) ActivateObject(orgID string, objectType string, ob
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.meta.Inactive = false
+		object.lastUpdate = time.Now()
+		store.objects[id] = object
+		return nil
+	}
+
+	return notFound
+}
+
+// PinObject pins the object, so that it isn't deleted by AutoDelete or when it expires
+func (store *InMemoryStorage) PinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.setObjectPinned(orgID, objectType, objectID, true)
+}
+
+// UnpinObject unpins the object, so that AutoDelete and its expiration apply to it again
+func (store *InMemoryStorage) UnpinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.setObjectPinned(orgID, objectType, objectID, false)
+}
+
+func (store *InMemoryStorage) setObjectPinned(orgID string, objectType string, objectID string, pinned bool) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		object.meta.Pinned = pinned
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return nil
 	}
@@ -576,15 +1005,91 @@ func (store *InMemoryStorage) GetObjectsToActivate() ([]common.MetaData, common.
 }
 
 // DeleteStoredObject deletes the object
-func (store *InMemoryStorage) DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+func (store *InMemoryStorage) DeleteStoredObject(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
 	store.lock()
 	defer store.unLock()
 
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	delete(store.objects, id)
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditDelete, "", identity))
 	return nil
 }
 
+// DeleteObjectsOfType deletes all the objects of the type in the organization and their data
+func (store *InMemoryStorage) DeleteObjectsOfType(orgID string, objectType string) (int, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	deleted := 0
+	for id, object := range store.objects {
+		if object.meta.DestOrgID == orgID && object.meta.ObjectType == objectType {
+			delete(store.objects, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// RetrieveAuditLog returns the audit log of the object's mutations, ordered by time
+func (store *InMemoryStorage) RetrieveAuditLog(orgID string, objectType string, objectID string) ([]common.AuditRecord, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	records := store.audit[createObjectCollectionID(orgID, objectType, objectID)]
+	result := make([]common.AuditRecord, len(records))
+	copy(result, records)
+	return result, nil
+}
+
+// PurgeAuditLog deletes the audit records older than olderThan
+func (store *InMemoryStorage) PurgeAuditLog(olderThan time.Duration) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	cutoff := time.Now().Add(-olderThan)
+	for id, records := range store.audit {
+		kept := make([]common.AuditRecord, 0, len(records))
+		for _, record := range records {
+			if !record.Timestamp.Before(cutoff) {
+				kept = append(kept, record)
+			}
+		}
+		if len(kept) == 0 {
+			delete(store.audit, id)
+		} else {
+			store.audit[id] = kept
+		}
+	}
+	return nil
+}
+
+// RetrieveObjectVersions returns the meta data of the kept previous versions of the object, ordered by instance ID
+func (store *InMemoryStorage) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.MetaData, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveObjectVersion returns the meta data and the data of a kept previous version of the object
+func (store *InMemoryStorage) RetrieveObjectVersion(orgID string, objectType string, objectID string, instanceID int64) (*common.MetaData, io.Reader, common.SyncServiceError) {
+	return nil, nil, nil
+}
+
+// IsIdempotencyKeyRecorded returns true if the idempotency key was recorded for an update of the object
+// within the last IdempotencyKeyWindow seconds
+func (store *InMemoryStorage) IsIdempotencyKeyRecorded(orgID string, objectType string, objectID string, key string) (bool, common.SyncServiceError) {
+	return false, nil
+}
+
+// RecordIdempotencyKey records the idempotency key of a successful update of the object
+func (store *InMemoryStorage) RecordIdempotencyKey(orgID string, objectType string, objectID string, key string) common.SyncServiceError {
+	return nil
+}
+
+// addAuditRecord appends the record to the audit log, the caller must hold the store's lock
+func (store *InMemoryStorage) addAuditRecord(record common.AuditRecord) {
+	id := createObjectCollectionID(record.OrgID, record.ObjectType, record.ObjectID)
+	store.audit[id] = append(store.audit[id], record)
+}
+
 // DeleteStoredData deletes the object's data
 func (store *InMemoryStorage) DeleteStoredData(orgID string, objectType string, objectID string) common.SyncServiceError {
 	store.lock()
@@ -593,6 +1098,8 @@ func (store *InMemoryStorage) DeleteStoredData(orgID string, objectType string,
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.data = nil
+		object.dataComplete = false
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return nil
 	}
@@ -715,6 +1222,37 @@ func (store *InMemoryStorage) RetrieveWebhooks(orgID string, objectType string)
 	return nil, &NotFound{"No webhooks"}
 }
 
+// StoreWebhookRetryPolicy stores the webhook retry policy of an object type, replacing the existing policy of the type
+func (store *InMemoryStorage) StoreWebhookRetryPolicy(policy common.WebhookRetryPolicy) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveWebhookRetryPolicy retrieves the webhook retry policy of an object type, returns nil if the type doesn't have a policy
+func (store *InMemoryStorage) RetrieveWebhookRetryPolicy(orgID string, objectType string) (*common.WebhookRetryPolicy, common.SyncServiceError) {
+	return nil, nil
+}
+
+// DeleteWebhookRetryPolicy deletes the webhook retry policy of an object type
+func (store *InMemoryStorage) DeleteWebhookRetryPolicy(orgID string, objectType string) common.SyncServiceError {
+	return nil
+}
+
+// StoreWebhookFailure records the failure of a webhook, replacing the previous failure of the webhook
+func (store *InMemoryStorage) StoreWebhookFailure(failure common.WebhookFailure) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveWebhookFailures retrieves the recorded webhook failures of an organization
+func (store *InMemoryStorage) RetrieveWebhookFailures(orgID string) ([]common.WebhookFailure, common.SyncServiceError) {
+	return nil, nil
+}
+
+// DeleteWebhookFailures deletes the recorded webhook failures of an object type,
+// or of all the object types of the organization if objectType is empty
+func (store *InMemoryStorage) DeleteWebhookFailures(orgID string, objectType string) common.SyncServiceError {
+	return nil
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *InMemoryStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	return nil, nil
@@ -725,16 +1263,41 @@ func (store *InMemoryStorage) DestinationExists(orgID string, destType string, d
 	return true, nil
 }
 
+// DestinationsExist returns a map indicating for each of the provided destinations whether it exists
+func (store *InMemoryStorage) DestinationsExist(orgID string, dests []common.DestinationID) (map[common.DestinationID]bool, common.SyncServiceError) {
+	exist := make(map[common.DestinationID]bool, len(dests))
+	for _, dest := range dests {
+		exist[dest] = true
+	}
+	return exist, nil
+}
+
 // StoreDestination stores a destination
 func (store *InMemoryStorage) StoreDestination(destination common.Destination) common.SyncServiceError {
 	return nil
 }
 
+// StoreDestinations stores the destinations, the returned errors correspond to the destinations
+func (store *InMemoryStorage) StoreDestinations(dests []common.Destination) ([]common.SyncServiceError, common.SyncServiceError) {
+	return make([]common.SyncServiceError, len(dests)), nil
+}
+
+// RegisterDestination stores the destination when it registers or sends a heartbeat
+func (store *InMemoryStorage) RegisterDestination(destination common.Destination) common.SyncServiceError {
+	return nil
+}
+
 // DeleteDestination deletes a destination
 func (store *InMemoryStorage) DeleteDestination(orgID string, destType string, destID string) common.SyncServiceError {
 	return nil
 }
 
+// DecommissionDestination removes the destination from the destinations lists of all the objects,
+// and deletes its notifications and the destination itself
+func (store *InMemoryStorage) DecommissionDestination(orgID string, destType string, destID string) (*common.DecommissionedDestination, common.SyncServiceError) {
+	return &common.DecommissionedDestination{}, nil
+}
+
 // UpdateDestinationLastPingTime updates the last ping time for the destination
 func (store *InMemoryStorage) UpdateDestinationLastPingTime(destination common.Destination) common.SyncServiceError {
 	return nil
@@ -743,6 +1306,11 @@ func (store *InMemoryStorage) UpdateDestinationLastPingTime(destination common.D
 // RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 func (store *InMemoryStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {}
 
+// RetrieveOfflineDestinations returns the destinations of the organization that haven't connected for the provided duration
+func (store *InMemoryStorage) RetrieveOfflineDestinations(orgID string, idleFor time.Duration) ([]common.Destination, common.SyncServiceError) {
+	return nil, nil
+}
+
 // GetNumberOfDestinations returns the number of currently registered ESS nodes (for CSS)
 func (store *InMemoryStorage) GetNumberOfDestinations() (uint32, common.SyncServiceError) {
 	return 0, nil
@@ -764,6 +1332,11 @@ func (store *InMemoryStorage) GetObjectsForDestination(orgID string, destType st
 	return nil, nil
 }
 
+// RetrieveObjectsForDestination retrieves the meta data and status of the objects that are in use on a given node
+func (store *InMemoryStorage) RetrieveObjectsForDestination(orgID string, destType string, destID string, status string) ([]common.ObjectStatusWithMetaData, common.SyncServiceError) {
+	return nil, nil
+}
+
 // RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and returns the list of metadata
 func (store *InMemoryStorage) RetrieveAllObjectsAndUpdateDestinationListForDestination(orgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
 	return nil, nil
@@ -791,6 +1364,7 @@ func (store *InMemoryStorage) UpdateRemovedDestinationPolicyServices(orgID strin
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if object, ok := store.objects[id]; ok {
 		object.removedDestinationPolicyServices = destinationPolicyServices
+		object.lastUpdate = time.Now()
 		store.objects[id] = object
 		return nil
 	}
@@ -803,21 +1377,44 @@ func (store *InMemoryStorage) UpdateNotificationRecord(notification common.Notif
 	store.lock()
 	defer store.unLock()
 
-	notification.ResendTime = time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	store.storeNotification(notification)
+	return nil
+}
+
+// UpdateNotificationRecords updates/adds the notification records, for example the notifications of an object
+// to all its destinations, in as few writes as the storage allows
+func (store *InMemoryStorage) UpdateNotificationRecords(notifications []common.Notification) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	for _, notification := range notifications {
+		store.storeNotification(notification)
+	}
+	return nil
+}
+
+// storeNotification stores the notification, keeping the resend schedule of an identical stored notification.
+// Must be called with the store's lock held.
+func (store *InMemoryStorage) storeNotification(notification common.Notification) {
 	id := getNotificationCollectionID(&notification)
+	if existing, ok := store.notifications[id]; ok {
+		scheduleNotificationResend(&notification, &existing)
+	} else {
+		scheduleNotificationResend(&notification, nil)
+	}
 	store.notifications[id] = notification
-	return nil
 }
 
-// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+// UpdateNotificationResendTime increments the resend attempts of the notification and sets its resend time
+// according to the number of attempts (see common.GetNotificationResendInterval)
 func (store *InMemoryStorage) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
 	store.lock()
 	defer store.unLock()
 
 	id := getNotificationCollectionID(&notification)
 	if notification, ok := store.notifications[id]; ok {
-		resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
-		notification.ResendTime = resendTime
+		notification.ResendAttempts++
+		notification.ResendTime = time.Now().Unix() + common.GetNotificationResendInterval(notification.ResendAttempts)
 		store.notifications[id] = notification
 		return nil
 	}
@@ -865,6 +1462,11 @@ func (store *InMemoryStorage) DeleteNotificationRecords(orgID string, objectType
 	return nil
 }
 
+// PurgeCompletedNotifications deletes the notifications in a completed state that weren't updated for longer than olderThan
+func (store *InMemoryStorage) PurgeCompletedNotifications(orgID string, olderThan time.Duration) (int, common.SyncServiceError) {
+	return 0, nil
+}
+
 // RetrieveNotifications returns the list of all the notifications that need to be resent to the destination
 func (store *InMemoryStorage) RetrieveNotifications(orgID string, destType string, destID string, retrieveReceived bool) ([]common.Notification,
 	common.SyncServiceError) {
@@ -916,6 +1518,11 @@ func (store *InMemoryStorage) UpdateLeader(leaderID string, version int64) (bool
 	return false, nil
 }
 
+// RequestLeaderHandoff asks the leader to hand off the leadership, if its priority is lower than this node's priority
+func (store *InMemoryStorage) RequestLeaderHandoff(leaderID string, version int64) (bool, common.SyncServiceError) {
+	return false, nil
+}
+
 // ResignLeadership causes this sync service to give up the Leadership
 func (store *InMemoryStorage) ResignLeadership(leaderID string) common.SyncServiceError {
 	return nil
@@ -926,6 +1533,11 @@ func (store *InMemoryStorage) RetrieveTimeOnServer() (time.Time, error) {
 	return time.Now(), nil
 }
 
+// IsLeaderAlive returns true, there is no leader election with this store
+func (store *InMemoryStorage) IsLeaderAlive() (bool, string, common.SyncServiceError) {
+	return true, "", nil
+}
+
 // StoreOrgToMessagingGroup inserts organization to messaging groups table
 func (store *InMemoryStorage) StoreOrgToMessagingGroup(orgID string, messagingGroup string) common.SyncServiceError {
 	return nil
@@ -946,11 +1558,45 @@ func (store *InMemoryStorage) RetrieveUpdatedMessagingGroups(time time.Time) ([]
 	return nil, nil
 }
 
+// RetrieveDestinationsInMessagingGroup returns all the destinations of the organizations in the messaging group
+func (store *InMemoryStorage) RetrieveDestinationsInMessagingGroup(groupName string) ([]common.Destination, common.SyncServiceError) {
+	return nil, nil
+}
+
 // DeleteOrganization cleans up the storage from all the records associated with the organization
 func (store *InMemoryStorage) DeleteOrganization(orgID string) common.SyncServiceError {
 	return nil
 }
 
+// ExportOrganization writes all the records associated with the organization to the writer
+func (store *InMemoryStorage) ExportOrganization(orgID string, w io.Writer) common.SyncServiceError {
+	store.lock()
+	exported := make([]exportedObject, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID {
+			exported = append(exported, exportedObject{MetaData: object.meta, Status: object.status})
+		}
+	}
+	exportedNotifications := make([]common.Notification, 0)
+	for _, notification := range store.notifications {
+		if notification.DestOrgID == orgID {
+			exportedNotifications = append(exportedNotifications, notification)
+		}
+	}
+	hooks := make(map[string][]string, len(store.webhooks))
+	for objectType, objectHooks := range store.webhooks {
+		hooks[objectType] = append([]string(nil), objectHooks...)
+	}
+	store.unLock()
+
+	return exportOrganization(store, orgID, w, exported, exportedNotifications, hooks)
+}
+
+// ImportOrganization stores the records of an organization read from an export created by ExportOrganization
+func (store *InMemoryStorage) ImportOrganization(r io.Reader) common.SyncServiceError {
+	return importOrganization(store, r)
+}
+
 // IsConnected returns false if the storage cannont be reached, and true otherwise
 func (store *InMemoryStorage) IsConnected() bool {
 	return true
@@ -977,6 +1623,12 @@ func (store *InMemoryStorage) RetrieveOrganizations() ([]common.StoredOrganizati
 	return nil, nil
 }
 
+// RetrieveOrganizationsPage retrieves up to limit stored organizations' info, ordered by organization ID,
+// skipping the first offset organizations
+func (store *InMemoryStorage) RetrieveOrganizationsPage(offset int, limit int) ([]common.StoredOrganization, int, common.SyncServiceError) {
+	return nil, 0, nil
+}
+
 // RetrieveUpdatedOrganizations retrieves organizations that were updated after the specified time
 func (store *InMemoryStorage) RetrieveUpdatedOrganizations(time time.Time) ([]common.StoredOrganization, common.SyncServiceError) {
 	return nil, nil
@@ -992,6 +1644,11 @@ func (store *InMemoryStorage) RemoveUsersFromACL(aclType string, orgID string, k
 	return nil
 }
 
+// SetACL replaces the users of an ACL with the provided users, an empty list of users deletes the ACL
+func (store *InMemoryStorage) SetACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	return nil
+}
+
 // RetrieveACL retrieves the list of usernames on an ACL
 func (store *InMemoryStorage) RetrieveACL(aclType string, orgID string, key string, aclUserType string) ([]common.ACLentry, common.SyncServiceError) {
 	return nil, nil
@@ -1007,6 +1664,79 @@ func (store *InMemoryStorage) RetrieveObjOrDestTypeForGivenACLUser(aclType strin
 	return nil, nil
 }
 
+// NormalizeACLUsernames rewrites the stored ACLs with normalized usernames, merging the entries of the same user.
+// Returns the number of the modified ACLs.
+func (store *InMemoryStorage) NormalizeACLUsernames() (int, common.SyncServiceError) {
+	return 0, nil
+}
+
+// CheckACL returns true if the user is granted access by the ACL of the key or by the ACL of all the keys,
+// either directly, by a wildcard entry, or by the membership in a group
+func (store *InMemoryStorage) CheckACL(aclType string, orgID string, key string, username string) (bool, common.SyncServiceError) {
+	return checkACL(store, aclType, orgID, key, username)
+}
+
+// StoreACLGroup stores an ACL group, replacing its members if it already exists
+func (store *InMemoryStorage) StoreACLGroup(group common.ACLGroup) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveACLGroup retrieves an ACL group, returns nil if the group doesn't exist
+func (store *InMemoryStorage) RetrieveACLGroup(orgID string, name string) (*common.ACLGroup, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveACLGroups retrieves the ACL groups of an organization
+func (store *InMemoryStorage) RetrieveACLGroups(orgID string) ([]common.ACLGroup, common.SyncServiceError) {
+	return nil, nil
+}
+
+// DeleteACLGroup deletes an ACL group
+func (store *InMemoryStorage) DeleteACLGroup(orgID string, name string) common.SyncServiceError {
+	return nil
+}
+
+// StoreRetentionPolicy stores the retention policy of an object type, replacing the existing policy of the type
+func (store *InMemoryStorage) StoreRetentionPolicy(policy common.RetentionPolicy) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveRetentionPolicy retrieves the retention policy of an object type, returns nil if the type doesn't have a policy
+func (store *InMemoryStorage) RetrieveRetentionPolicy(orgID string, objectType string) (*common.RetentionPolicy, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveRetentionPolicies retrieves the retention policies of an organization,
+// or of all the organizations if orgID is empty
+func (store *InMemoryStorage) RetrieveRetentionPolicies(orgID string) ([]common.RetentionPolicy, common.SyncServiceError) {
+	return nil, nil
+}
+
+// DeleteRetentionPolicy deletes the retention policy of an object type
+func (store *InMemoryStorage) DeleteRetentionPolicy(orgID string, objectType string) common.SyncServiceError {
+	return nil
+}
+
+// StoreAPIToken stores an API token, replacing it if a token with the same hash already exists
+func (store *InMemoryStorage) StoreAPIToken(token common.APIToken) common.SyncServiceError {
+	return nil
+}
+
+// RetrieveAPIToken retrieves the API token with the given hash, returns nil if the token doesn't exist
+func (store *InMemoryStorage) RetrieveAPIToken(hash string) (*common.APIToken, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveAPITokens retrieves the API tokens of an organization
+func (store *InMemoryStorage) RetrieveAPITokens(orgID string) ([]common.APIToken, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RevokeAPIToken deletes the API token with the given hash, the token can't be used after it is revoked
+func (store *InMemoryStorage) RevokeAPIToken(hash string) common.SyncServiceError {
+	return nil
+}
+
 func (store *InMemoryStorage) getInstanceID() int64 {
 	// Always called from inside the lock - no need to lock here
 	store.timebase++
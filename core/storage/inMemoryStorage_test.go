@@ -14,15 +14,52 @@ func TestInMemoryStorageObjectActivation(t *testing.T) {
 	testStorageObjectActivation(common.InMemory, t)
 }
 
+func TestInMemoryStorageUndeleteObject(t *testing.T) {
+	testStorageUndeleteObject(common.InMemory, t)
+}
+
+func TestInMemoryStoragePatchObjectMetadata(t *testing.T) {
+	testStoragePatchObjectMetadata(common.InMemory, t)
+}
+
+func TestInMemoryStorageTouchObject(t *testing.T) {
+	testStorageTouchObject(common.InMemory, t)
+}
+
+func TestInMemoryStorageAuditLog(t *testing.T) {
+	testStorageAuditLog(common.InMemory, t)
+}
+
+func TestInMemoryStorageRetrieveObjectIfModifiedSince(t *testing.T) {
+	testStorageRetrieveObjectIfModifiedSince(common.InMemory, t)
+}
+
+func TestInMemoryStorageExportImportOrganization(t *testing.T) {
+	testStorageExportImportOrganization(common.InMemory, t)
+}
+
 func TestInMemoryStorageObjectData(t *testing.T) {
 	common.Configuration.NodeType = common.ESS
 	testStorageObjectData(common.InMemory, t)
 }
 
+func TestInMemoryStorageMaxObjectSize(t *testing.T) {
+	common.Configuration.NodeType = common.ESS
+	testStorageMaxObjectSize(common.InMemory, t)
+}
+
 func TestInMemoryStorageNotifications(t *testing.T) {
 	testStorageNotifications(common.InMemory, t)
 }
 
+func TestInMemoryStorageNotificationResendBackoff(t *testing.T) {
+	testStorageNotificationResendBackoff(common.InMemory, t)
+}
+
+func TestInMemoryStorageDataComplete(t *testing.T) {
+	testStorageDataComplete(common.InMemory, t)
+}
+
 func TestInMemoryStorageDestinations(t *testing.T) {
 	store := &InMemoryStorage{}
 	if err := store.Init(); err != nil {
@@ -8,22 +8,30 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/dataURI"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
 )
 
 type fileHandle struct {
-	file    *mgo.GridFile
-	session *mgo.Session
-	offset  int64
-	chunks  map[int64][]byte
+	file      *mgo.GridFile
+	session   *mgo.Session
+	offset    int64
+	chunks    map[int64][]byte
+	uploading bool
+	committed int64
+	// readers is the number of open readers sharing the handle, the handle is kept until the last one is closed
+	readers int
 }
 
 // MongoStorage is a MongoDB based store
@@ -31,12 +39,19 @@ type MongoStorage struct {
 	session      *mgo.Session
 	dialInfo     *mgo.DialInfo
 	openFiles    map[string]*fileHandle
+	readerFiles  map[*mgo.GridFile]string
+	pendingReads int
 	connected    bool
 	lockChannel  chan int
 	mapLock      chan int
-	sessionCache []*mgo.Session
+	sessionCache []cachedSession
 	cacheSize    int
+	cacheMaxSize int
 	cacheIndex   int
+	gridFSPrefix string
+	readOnly     bool
+	stopChannel  chan bool
+	backgroundGo sync.WaitGroup
 }
 
 type object struct {
@@ -47,13 +62,17 @@ type object struct {
 	RemainingConsumers int                             `bson:"remaining-consumers"`
 	RemainingReceivers int                             `bson:"remaining-receivers"`
 	Destinations       []common.StoreDestinationStatus `bson:"destinations"`
+	PreviousStatus     string                          `bson:"previous-status,omitempty"`
 	LastUpdate         bson.MongoTimestamp             `bson:"last-update"`
+	DataFile           string                          `bson:"data-file,omitempty"`
+	DataComplete       bool                            `bson:"data-complete"`
 }
 
 type destinationObject struct {
-	ID           string              `bson:"_id"`
-	Destination  common.Destination  `bson:"destination"`
-	LastPingTime bson.MongoTimestamp `bson:"last-ping-time"`
+	ID            string              `bson:"_id"`
+	Destination   common.Destination  `bson:"destination"`
+	LastPingTime  bson.MongoTimestamp `bson:"last-ping-time"`
+	LastConnected time.Time           `bson:"last-connected"`
 }
 
 type notificationObject struct {
@@ -61,12 +80,62 @@ type notificationObject struct {
 	Notification common.Notification `bson:"notification"`
 }
 
+type aclGroupObject struct {
+	ID    string          `bson:"_id"`
+	Group common.ACLGroup `bson:"group"`
+}
+
+type retentionPolicyObject struct {
+	ID     string                 `bson:"_id"`
+	Policy common.RetentionPolicy `bson:"policy"`
+}
+
+type webhookPolicyObject struct {
+	ID     string                    `bson:"_id"`
+	Policy common.WebhookRetryPolicy `bson:"policy"`
+}
+
+type webhookFailureObject struct {
+	ID      string                `bson:"_id"`
+	Failure common.WebhookFailure `bson:"failure"`
+}
+
+type apiTokenObject struct {
+	ID    string          `bson:"_id"`
+	Token common.APIToken `bson:"token"`
+}
+
+type auditObject struct {
+	ID     bson.ObjectId      `bson:"_id"`
+	Record common.AuditRecord `bson:"record"`
+}
+
+type objectVersionObject struct {
+	ID       string          `bson:"_id"`
+	MetaData common.MetaData `bson:"metadata"`
+	HasData  bool            `bson:"has-data"`
+}
+
+type idempotencyKeyObject struct {
+	ID       string    `bson:"_id"`
+	OrgID    string    `bson:"org-id"`
+	Recorded time.Time `bson:"recorded"`
+}
+
+type gridFSChunk struct {
+	N    int    `bson:"n"`
+	Data []byte `bson:"data"`
+}
+
 type leaderDocument struct {
-	ID               int32               `bson:"_id"`
-	UUID             string              `bson:"uuid"`
-	LastHeartbeatTS  bson.MongoTimestamp `bson:"last-heartbeat-ts"`
-	HeartbeatTimeout int32               `bson:"heartbeat-timeout"`
-	Version          int64               `bson:"version"`
+	ID                 int32               `bson:"_id"`
+	UUID               string              `bson:"uuid"`
+	LastHeartbeatTS    bson.MongoTimestamp `bson:"last-heartbeat-ts"`
+	HeartbeatTimeout   int32               `bson:"heartbeat-timeout"`
+	Version            int64               `bson:"version"`
+	Region             string              `bson:"region"`
+	Priority           int32               `bson:"priority"`
+	HandoffRequestedBy string              `bson:"handoff-requested-by"`
 }
 
 type isMasterResult struct {
@@ -75,6 +144,15 @@ type isMasterResult struct {
 	OK        bool      `bson:"ok"`
 }
 
+// objectChangeEvent is a change event of the objects collection's change stream
+type objectChangeEvent struct {
+	OperationType string  `bson:"operationType"`
+	FullDocument  *object `bson:"fullDocument"`
+	DocumentKey   struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+}
+
 type messagingGroupObject struct {
 	ID         string              `bson:"_id"`
 	GroupName  string              `bson:"group-name"`
@@ -118,8 +196,8 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 		Username:     common.Configuration.MongoUsername,
 		Password:     common.Configuration.MongoPassword,
 		Timeout:      time.Duration(20 * time.Second),
-		ReadTimeout:  time.Duration(60 * time.Second),
-		WriteTimeout: time.Duration(60 * time.Second),
+		ReadTimeout:  readOperation.timeout(),
+		WriteTimeout: readOperation.timeout(),
 	}
 
 	if common.Configuration.MongoUseSSL {
@@ -147,6 +225,44 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 			tlsConfig.RootCAs = caCertPool
 		}
 
+		if common.Configuration.MongoClientCertificate != "" && common.Configuration.MongoClientKey != "" {
+			var cert, key string
+			if strings.HasPrefix(common.Configuration.MongoClientCertificate, "/") {
+				cert = common.Configuration.MongoClientCertificate
+			} else {
+				cert = common.Configuration.PersistenceRootPath + common.Configuration.MongoClientCertificate
+			}
+			if strings.HasPrefix(common.Configuration.MongoClientKey, "/") {
+				key = common.Configuration.MongoClientKey
+			} else {
+				key = common.Configuration.PersistenceRootPath + common.Configuration.MongoClientKey
+			}
+
+			clientCert, err := tls.LoadX509KeyPair(cert, key)
+			if err != nil {
+				if _, ok := err.(*os.PathError); ok {
+					// The MongoClientCertificate and MongoClientKey are likely pem file contents
+					clientCert, err = tls.X509KeyPair([]byte(common.Configuration.MongoClientCertificate), []byte(common.Configuration.MongoClientKey))
+				}
+				if err != nil {
+					message := fmt.Sprintf("Failed to load mongo SSL client certificate. Error: %s.", err)
+					return &Error{message}
+				}
+			}
+			tlsConfig.Certificates = []tls.Certificate{clientCert}
+
+			// With x509 authentication the user is the subject of the client certificate
+			leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+			if err != nil {
+				message := fmt.Sprintf("Failed to parse mongo SSL client certificate. Error: %s.", err)
+				return &Error{message}
+			}
+			store.dialInfo.Mechanism = "MONGODB-X509"
+			store.dialInfo.Source = "$external"
+			store.dialInfo.Username = leaf.Subject.String()
+			store.dialInfo.Password = ""
+		}
+
 		// Please avoid using this if possible! Makes using TLS pointless
 		if common.Configuration.MongoAllowInvalidCertificates {
 			tlsConfig.InsecureSkipVerify = true
@@ -180,93 +296,168 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 			trace.Error("Retrying to connect to mongo")
 		}
 	}
+
+	store.openFiles = make(map[string]*fileHandle)
+	store.readerFiles = make(map[*mgo.GridFile]string)
+	store.readOnly = common.Configuration.MongoReadOnly
+	store.gridFSPrefix = common.Configuration.MongoGridFSPrefix
+	if store.gridFSPrefix == "" {
+		store.gridFSPrefix = "fs"
+	}
+
 	if session == nil {
-		message := fmt.Sprintf("Failed to dial mgo. Error: %s.", err)
-		return &Error{message}
+		if !common.Configuration.StartWithoutDatabase {
+			message := fmt.Sprintf("Failed to dial mgo. Error: %s.", err)
+			return &Error{message}
+		}
+		// Start disconnected and keep trying to connect in the background
+		common.HealthStatus.DisconnectedFromDatabase()
+		if log.IsLogging(logger.WARNING) {
+			log.Warning("Starting without a database connection, retrying to connect in the background. Error: %s", err)
+		}
+		store.stopChannel = make(chan bool)
+		store.backgroundGo.Add(1)
+		go store.connectInBackground(store.stopChannel)
+		return nil
 	}
 
-	store.connected = true
-	common.HealthStatus.ReconnectedToDatabase()
-	if trace.IsLogging(logger.INFO) {
-		trace.Info("Connected to the database")
+	if err := store.setUpSession(session); err != nil {
+		return err
 	}
-	if log.IsLogging(logger.INFO) {
-		log.Info("Connected to the database")
+
+	store.stopChannel = make(chan bool)
+	if common.Configuration.DatabaseLatencyProbeInterval > 0 {
+		store.backgroundGo.Add(1)
+		go store.probeLatencyPeriodically(store.stopChannel)
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Successfully initialized mongo driver")
 	}
 
+	return nil
+}
+
+// setUpSession creates the indexes of the database and the session cache, and marks the store as connected
+func (store *MongoStorage) setUpSession(session *mgo.Session) common.SyncServiceError {
 	session.SetSafe(&mgo.Safe{})
 	//session.SetMode(mgo.Monotonic, true)
 
 	db := session.DB(common.Configuration.MongoDbName)
-	db.C(destinations).EnsureIndexKey("destination.destination-org-id")
-	notificationsCollection := db.C(notifications)
-	notificationsCollection.EnsureIndexKey("notification.destination-org-id", "notification.destination-id", "notification.destination-type")
-	notificationsCollection.EnsureIndexKey("notification.resend-time", "notification.status")
-	objectsCollection := db.C(objects)
-	objectsCollection.EnsureIndexKey("metadata.destination-org-id")
-	err = objectsCollection.EnsureIndex(
-		mgo.Index{
-			Key: []string{
-				"metadata.destination-org-id",
-				"metadata.destination-policy.services.org-id",
-				"metadata.destination-policy.services.service-name",
-			},
-			Name:       "syncObjects-destination-policy.services.service-id",
-			Unique:     false,
-			DropDups:   false,
-			Background: false,
-			Sparse:     true,
-		})
-	if err != nil {
-		log.Error("Failed to create an index on %s. Error: %s", objects, err)
+	if common.Configuration.MongoCollectionCompressor != "" {
+		store.createCompressedCollections(db, common.Configuration.MongoCollectionCompressor)
 	}
-	err = objectsCollection.EnsureIndex(
-		mgo.Index{
-			Key: []string{
-				"metadata.destination-org-id",
-				"metadata.destination-policy.timestamp",
-			},
-			Unique:     false,
-			DropDups:   false,
-			Background: false,
-			Sparse:     true,
-		})
-	if err != nil {
-		log.Error("Failed to create an index on %s. Error: %s", objects, err)
+	indexes, failedIndexes := extraIndexes()
+	indexes = append(builtInIndexes(), indexes...)
+	if !common.Configuration.MongoBackgroundIndexBuilds {
+		failedIndexes += ensureIndexes(db, indexes)
+	}
+
+	if failedIndexes > 0 && common.Configuration.RequireIndexes {
+		session.Close()
+		message := fmt.Sprintf("Failed to create %d of the database indexes.", failedIndexes)
+		return &Error{message}
+	}
+	if common.Configuration.MongoBackgroundIndexBuilds {
+		go buildIndexesInBackground(session.Copy(), indexes)
 	}
-	db.C(acls).EnsureIndexKey("org-id", "acl-type")
 
+	store.lock()
 	store.session = session
 	store.cacheSize = common.Configuration.MongoSessionCacheSize
-	if store.cacheSize > 1 {
-		store.sessionCache = make([]*mgo.Session, store.cacheSize)
+	store.cacheMaxSize = common.Configuration.MongoSessionCacheMaxSize
+	if store.cacheMaxSize < store.cacheSize {
+		store.cacheMaxSize = store.cacheSize
+	}
+	if store.cacheMaxSize > 1 {
+		if store.cacheSize < 1 {
+			store.cacheSize = 1
+		}
+		store.sessionCache = make([]cachedSession, store.cacheSize, store.cacheMaxSize)
 		for i := 0; i < store.cacheSize; i++ {
-			store.sessionCache[i] = store.session.Copy()
+			store.sessionCache[i] = cachedSession{session: store.session.Copy(), lastUsed: time.Now()}
 		}
+		common.HealthStatus.SessionCacheResized(len(store.sessionCache))
 	}
 
-	store.openFiles = make(map[string]*fileHandle)
-
-	if trace.IsLogging(logger.TRACE) {
-		trace.Trace("Successfully initialized mongo driver")
+	store.connected = true
+	store.unLock()
+	common.HealthStatus.ReconnectedToDatabase()
+	if trace.IsLogging(logger.INFO) {
+		trace.Info("Connected to the database")
+	}
+	if log.IsLogging(logger.INFO) {
+		log.Info("Connected to the database")
 	}
 
 	return nil
 }
 
-// Stop stops the MongoStorage store
+// Stop stops the MongoStorage store.
+// The background go routines of the store are signaled to end and waited for, and open data readers are given
+// up to ShutdownQuiesceTime seconds to be closed before the database sessions are closed.
 func (store *MongoStorage) Stop() {
-	if store.cacheSize > 1 {
-		for i := 0; i < store.cacheSize; i++ {
-			store.sessionCache[i].Close()
-		}
+	<-store.mapLock
+	if store.stopChannel == nil {
+		store.mapLock <- 1
+		return
+	}
+	close(store.stopChannel)
+	store.stopChannel = nil
+	store.mapLock <- 1
+
+	store.backgroundGo.Wait()
+	store.waitForOpenFiles(time.Second * time.Duration(common.Configuration.ShutdownQuiesceTime))
+
+	store.lock()
+	for _, cached := range store.sessionCache {
+		cached.session.Close()
+	}
+	store.sessionCache = nil
+	store.unLock()
+	if store.session != nil {
+		store.session.Close()
+	}
+}
+
+// SetReadOnly sets the read-only mode of the store.
+// In read-only mode all the writes (of objects and their data, destinations, notifications, webhooks, ACLs and
+// organizations) are rejected with a common.ReadOnlyError, while reads continue to work.
+// The leader election and the storage maintenance are not affected by the read-only mode.
+func (store *MongoStorage) SetReadOnly(readOnly bool) {
+	store.lock()
+	store.readOnly = readOnly
+	store.unLock()
+	if log.IsLogging(logger.INFO) {
+		log.Info("Set the storage read-only mode to %t", readOnly)
 	}
-	store.session.Close()
 }
 
 // PerformMaintenance performs store's maintenance
 func (store *MongoStorage) PerformMaintenance() {
+	if !store.beginBackgroundOperation() {
+		return
+	}
+	defer store.backgroundGo.Done()
+
 	store.checkObjects()
+	store.applyRetentionPolicies()
+	if maxAge := auditLogMaxAge(); maxAge > 0 {
+		if err := store.PurgeAuditLog(maxAge); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in PerformMaintenance: failed to purge the audit log. Error: %s\n", err)
+		}
+	}
+
+	store.pruneObjectVersions()
+	if maxAge := completedNotificationsMaxAge(); maxAge > 0 {
+		if purged, err := store.PurgeCompletedNotifications("", maxAge); err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Error in PerformMaintenance: failed to purge completed notifications. Error: %s\n", err)
+			}
+		} else if purged > 0 && trace.IsLogging(logger.TRACE) {
+			trace.Trace("Purged %d completed notifications", purged)
+		}
+	}
 }
 
 // Cleanup erase the on disk Bolt database only for ESS and test
@@ -299,9 +490,23 @@ func (store *MongoStorage) GetObjectsToActivate() ([]common.MetaData, common.Syn
 
 // StoreObject stores an object
 // If the object already exists, return the changes in its destinations list (for CSS) - return the list of deleted destinations
-func (store *MongoStorage) StoreObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+func (store *MongoStorage) StoreObject(metaData common.MetaData, data []byte, status string, identity string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := metaData.Validate(); err != nil {
+		return nil, err
+	}
+	normalizeObjectTimes(&metaData)
+
 	id := getObjectCollectionID(metaData)
-	if !metaData.NoData && data != nil {
+	if err := store.storeObjectVersion(id, metaData.DestOrgID, metaData.ObjectType); err != nil {
+		return nil, err
+	}
+	if metaData.SourceDataURI != "" {
+		// The data is read from the source data URI, nothing is kept in GridFS
+		store.removeFile(id)
+	} else if !metaData.NoData && data != nil {
 		if err := store.storeDataInFile(id, data); err != nil {
 			return nil, err
 		}
@@ -359,10 +564,19 @@ func (store *MongoStorage) StoreObject(metaData common.MetaData, data []byte, st
 
 	newObject := object{ID: id, MetaData: metaData, Status: status, PolicyReceived: false,
 		RemainingConsumers: metaData.ExpectedConsumers,
-		RemainingReceivers: metaData.ExpectedConsumers, Destinations: dests}
+		RemainingReceivers: metaData.ExpectedConsumers, Destinations: dests,
+		DataComplete: storedDataComplete(metaData, data, existingObject != nil && existingObject.DataComplete)}
+	if existingObject != nil && metaData.MetaOnly {
+		// Keep using the data written by ReplaceObject
+		newObject.DataFile = existingObject.DataFile
+	}
 	if err := store.upsert(objects, bson.M{"_id": id, "metadata.destination-org-id": metaData.DestOrgID}, newObject); err != nil {
 		return nil, &Error{fmt.Sprintf("Failed to store an object. Error: %s.", err)}
 	}
+	if existingObject != nil && existingObject.DataFile != "" && newObject.DataFile == "" {
+		store.removeFile(existingObject.DataFile)
+	}
+	store.addAuditRecord(newAuditRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.AuditStore, status, identity))
 
 	return deletedDests, nil
 }
@@ -407,6 +621,9 @@ func (store *MongoStorage) GetObjectDestinationsList(orgID string, objectType st
 // Returns the meta data, object's status, an array of deleted destinations, and an array of added destinations
 func (store *MongoStorage) UpdateObjectDestinations(orgID string, objectType string, objectID string, destinationsList []string) (*common.MetaData, string,
 	[]common.StoreDestinationStatus, []common.StoreDestinationStatus, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return nil, "", nil, nil, err
+	}
 
 	result := object{}
 	id := createObjectCollectionID(orgID, objectType, objectID)
@@ -427,12 +644,15 @@ func (store *MongoStorage) UpdateObjectDestinations(orgID string, objectType str
 		}
 		if err := store.update(objects, bson.M{"_id": id, "last-update": result.LastUpdate}, query); err != nil {
 			if err == mgo.ErrNotFound {
+				updateRetried("UpdateObjectDestinations")
 				continue
 			}
 			return nil, "", nil, nil, &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
 		}
+		updateSucceeded("UpdateObjectDestinations", i)
 		return &result.MetaData, result.Status, deletedDests, addedDests, nil
 	}
+	updateRetriesExhausted("UpdateObjectDestinations")
 	return nil, "", nil, nil, &Error{"Failed to update object's destinations."}
 }
 
@@ -440,6 +660,9 @@ func (store *MongoStorage) UpdateObjectDestinations(orgID string, objectType str
 // Returns true if the status is Deleted and all the destinations are in status Deleted
 func (store *MongoStorage) UpdateObjectDeliveryStatus(status string, message string, orgID string, objectType string, objectID string,
 	destType string, destID string) (bool, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return false, err
+	}
 	if status == "" && message == "" {
 		return false, nil
 	}
@@ -456,13 +679,15 @@ func (store *MongoStorage) UpdateObjectDeliveryStatus(status string, message str
 		found := false
 		allConsumed := true
 		allDeleted = true
+		oldStatus := ""
 		for i, d := range result.Destinations {
 			if !found && d.Destination.DestType == destType && d.Destination.DestID == destID {
+				oldStatus = d.Status
 				if message != "" || d.Status == common.Error {
 					d.Message = message
 				}
 				if status != "" {
-					d.Status = status
+					setDeliveryStatus(&d, status)
 				}
 				found = true
 				result.Destinations[i] = d
@@ -483,7 +708,7 @@ func (store *MongoStorage) UpdateObjectDeliveryStatus(status string, message str
 			"$set":         bson.M{"destinations": result.Destinations},
 			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 		}
-		if result.MetaData.AutoDelete && status == common.Consumed && allConsumed && result.MetaData.Expiration == "" {
+		if result.MetaData.AutoDelete && !result.MetaData.Pinned && status == common.Consumed && allConsumed && result.MetaData.Expiration == "" {
 			// Delete the object by setting its expiration time to one hour
 			expirationTime := time.Now().Add(time.Hour * time.Duration(1)).UTC().Format(time.RFC3339)
 			query = bson.M{
@@ -493,17 +718,27 @@ func (store *MongoStorage) UpdateObjectDeliveryStatus(status string, message str
 		}
 		if err := store.update(objects, bson.M{"_id": id, "last-update": result.LastUpdate}, query); err != nil {
 			if err == mgo.ErrNotFound {
+				updateRetried("UpdateObjectDeliveryStatus")
 				continue
 			}
 			return false, &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
 		}
+		updateSucceeded("UpdateObjectDeliveryStatus", i)
+		if status != "" {
+			notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+				DestType: destType, DestID: destID, OldStatus: oldStatus, NewStatus: status})
+		}
 		return (allDeleted && status == common.Deleted), nil
 	}
+	updateRetriesExhausted("UpdateObjectDeliveryStatus")
 	return false, &Error{"Failed to update object's destinations."}
 }
 
 // UpdateObjectDelivering marks the object as being delivered to all its destinations
 func (store *MongoStorage) UpdateObjectDelivering(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	result := object{}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	for i := 0; i < maxUpdateTries; i++ {
@@ -512,9 +747,8 @@ func (store *MongoStorage) UpdateObjectDelivering(orgID string, objectType strin
 			&result); err != nil {
 			return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
 		}
-		for i, d := range result.Destinations {
-			d.Status = common.Delivering
-			result.Destinations[i] = d
+		for i := range result.Destinations {
+			setDeliveryStatus(&result.Destinations[i], common.Delivering)
 		}
 		if err := store.update(objects, bson.M{"_id": id, "last-update": result.LastUpdate},
 			bson.M{
@@ -522,12 +756,15 @@ func (store *MongoStorage) UpdateObjectDelivering(orgID string, objectType strin
 				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 			}); err != nil {
 			if err == mgo.ErrNotFound {
+				updateRetried("UpdateObjectDelivering")
 				continue
 			}
 			return &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
 		}
+		updateSucceeded("UpdateObjectDelivering", i)
 		return nil
 	}
+	updateRetriesExhausted("UpdateObjectDelivering")
 	return &Error{fmt.Sprintf("Failed to update object's destinations.")}
 }
 
@@ -560,6 +797,9 @@ func (store *MongoStorage) RetrieveObjectRemainingConsumers(orgID string, object
 // DecrementAndReturnRemainingConsumers decrements the number of remaining consumers of the object
 func (store *MongoStorage) DecrementAndReturnRemainingConsumers(orgID string, objectType string, objectID string) (int,
 	common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return 0, err
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if err := store.update(objects, bson.M{"_id": id},
 		bson.M{
@@ -578,6 +818,9 @@ func (store *MongoStorage) DecrementAndReturnRemainingConsumers(orgID string, ob
 // DecrementAndReturnRemainingReceivers decrements the number of remaining receivers of the object
 func (store *MongoStorage) DecrementAndReturnRemainingReceivers(orgID string, objectType string, objectID string) (int,
 	common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return 0, err
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if err := store.update(objects, bson.M{"_id": id},
 		bson.M{
@@ -595,6 +838,9 @@ func (store *MongoStorage) DecrementAndReturnRemainingReceivers(orgID string, ob
 
 // ResetObjectRemainingConsumers sets the remaining consumers count to the original ExpectedConsumers value
 func (store *MongoStorage) ResetObjectRemainingConsumers(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	result := object{}
 	if err := store.fetchOne(objects, bson.M{"_id": id}, bson.M{"metadata": bson.ElementDocument}, &result); err != nil {
@@ -644,6 +890,47 @@ func (store *MongoStorage) RetrieveUpdatedObjects(orgID string, objectType strin
 	return metaDatas, nil
 }
 
+// WatchObjects returns a channel of the creation, update, and deletion events of the objects of the organization,
+// and a function to stop watching. The channel is closed when the watch is stopped, or when the storage is stopped.
+// The events are read from a change stream on the objects collection, which requires MongoDB to run as a replica set.
+func (store *MongoStorage) WatchObjects(orgID string) (<-chan common.ObjectEvent, func(), common.SyncServiceError) {
+	if !store.connected {
+		return nil, nil, &NotConnected{"Disconnected from the database"}
+	}
+
+	session := store.session.Copy()
+	pipeline := []bson.M{bson.M{"$match": bson.M{
+		"operationType":   bson.M{"$in": []string{"insert", "update", "replace", "delete"}},
+		"documentKey._id": bson.M{"$regex": "^" + regexp.QuoteMeta(common.CreateCompositeID(orgID, ""))},
+	}}}
+	changeStream, err := session.DB(common.Configuration.MongoDbName).C(objects).Watch(pipeline,
+		mgo.ChangeStreamOptions{FullDocument: mgo.UpdateLookup, MaxAwaitTimeMS: time.Second})
+	if err != nil {
+		session.Close()
+		return nil, nil, &Error{fmt.Sprintf("Failed to watch the objects. Error: %s.", err)}
+	}
+
+	<-store.mapLock
+	stopChannel := store.stopChannel
+	if stopChannel == nil {
+		store.mapLock <- 1
+		changeStream.Close()
+		session.Close()
+		return nil, nil, &Error{"The storage is stopped"}
+	}
+	store.backgroundGo.Add(1)
+	store.mapLock <- 1
+
+	events := make(chan common.ObjectEvent, 100)
+	cancelChannel := make(chan bool)
+	var cancelOnce sync.Once
+	cancel := func() {
+		cancelOnce.Do(func() { close(cancelChannel) })
+	}
+	go store.watchObjectChanges(orgID, session, changeStream, events, cancelChannel, stopChannel)
+	return events, cancel, nil
+}
+
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
 func (store *MongoStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
@@ -789,11 +1076,264 @@ func (store *MongoStorage) RetrieveAllObjects(orgID string, objectType string) (
 	return store.retrievePolicies(query)
 }
 
+// RetrieveObjectStatusCounts returns the number of objects of the organization in each status.
+// If objectType is empty, the objects of all types are counted.
+func (store *MongoStorage) RetrieveObjectStatusCounts(orgID string, objectType string) (map[string]int, common.SyncServiceError) {
+	match := bson.M{"metadata.destination-org-id": orgID}
+	if objectType != "" {
+		match["metadata.object-type"] = objectType
+	}
+	pipeline := []bson.M{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}},
+	}
+	result := []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}{}
+	if err := store.aggregate(objects, pipeline, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to count the objects by status. Error: %s.", err)}
+	}
+	counts := make(map[string]int, len(result))
+	for _, r := range result {
+		counts[r.Status] = r.Count
+	}
+	return counts, nil
+}
+
+// RetrieveStorageStatsByType returns the number of objects of the organization, the total declared size of their data,
+// and the total number of bytes used to store their data, per object type
+func (store *MongoStorage) RetrieveStorageStatsByType(orgID string) (map[string]common.ObjectTypeStorageStats, common.SyncServiceError) {
+	if separateDataDb() {
+		return store.retrieveStorageStatsByTypeFromDataDb(orgID)
+	}
+	pipeline := []bson.M{
+		bson.M{"$match": bson.M{"metadata.destination-org-id": orgID}},
+		bson.M{"$project": bson.M{
+			"type":      "$metadata.object-type",
+			"size":      "$metadata.object-size",
+			"data-file": bson.M{"$ifNull": []interface{}{"$data-file", "$_id"}},
+		}},
+		bson.M{"$lookup": bson.M{"from": store.gridFSPrefix + ".files", "localField": "data-file", "foreignField": "filename",
+			"as": "files"}},
+		bson.M{"$group": bson.M{
+			"_id":    "$type",
+			"count":  bson.M{"$sum": 1},
+			"size":   bson.M{"$sum": "$size"},
+			"stored": bson.M{"$sum": bson.M{"$sum": "$files.length"}},
+		}},
+	}
+	result := []struct {
+		ObjectType string `bson:"_id"`
+		Count      int    `bson:"count"`
+		Size       int64  `bson:"size"`
+		Stored     int64  `bson:"stored"`
+	}{}
+	if err := store.aggregate(objects, pipeline, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to aggregate the storage stats of the objects. Error: %s.", err)}
+	}
+	stats := make(map[string]common.ObjectTypeStorageStats, len(result))
+	for _, r := range result {
+		stats[r.ObjectType] = common.ObjectTypeStorageStats{ObjectType: r.ObjectType, ObjectCount: r.Count,
+			ObjectSize: r.Size, StoredDataSize: r.Stored}
+	}
+	return stats, nil
+}
+
+// RetrieveIncompleteObjects returns the objects of the organization that at least one of their destinations didn't consume.
+// The objects are selected in the database by the status of their destinations.
+func (store *MongoStorage) RetrieveIncompleteObjects(orgID string, objectType string) ([]common.IncompleteObject, common.SyncServiceError) {
+	query := bson.M{
+		"metadata.destination-org-id": orgID,
+		"metadata.deleted":            bson.M{"$ne": true},
+		"destinations":                bson.M{"$elemMatch": bson.M{"status": bson.M{"$ne": common.Consumed}}},
+	}
+	if objectType != "" {
+		query["metadata.object-type"] = objectType
+	}
+	result := []object{}
+	selector := bson.M{"metadata": bson.ElementDocument, "destinations": bson.ElementArray}
+	if err := store.fetchAll(objects, query, selector, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the incomplete objects. Error: %s.", err)}
+	}
+
+	incompleteObjects := make([]common.IncompleteObject, 0, len(result))
+	for _, r := range result {
+		if incomplete, ok := incompleteObject(r.MetaData, r.Destinations); ok {
+			incompleteObjects = append(incompleteObjects, incomplete)
+		}
+	}
+	sortIncompleteObjects(incompleteObjects)
+	return incompleteObjects, nil
+}
+
+// RetrieveObjectsWithMissingData returns the objects of the organization whose data should be in the storage but isn't.
+// The GridFS file of each object that should have data is looked up in the database.
+func (store *MongoStorage) RetrieveObjectsWithMissingData(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	match := bson.M{"$match": bson.M{
+		"metadata.destination-org-id": orgID,
+		"status":                      bson.M{"$in": dataStatuses},
+		"metadata.no-data":            bson.M{"$ne": true},
+		"metadata.deleted":            bson.M{"$ne": true},
+		"metadata.source-data-uri":    bson.M{"$in": []interface{}{"", nil}},
+	}}
+	project := bson.M{"$project": bson.M{
+		"metadata":  1,
+		"data-file": bson.M{"$ifNull": []interface{}{"$data-file", "$_id"}},
+	}}
+	if separateDataDb() {
+		// The files can't be looked up in the pipeline, since they are in another database
+		return store.retrieveObjectsWithMissingDataFromDataDb([]bson.M{match, project})
+	}
+	pipeline := []bson.M{
+		match,
+		project,
+		bson.M{"$lookup": bson.M{"from": store.gridFSPrefix + ".files", "localField": "data-file", "foreignField": "filename",
+			"as": "files"}},
+		bson.M{"$match": bson.M{"files": bson.M{"$size": 0}}},
+		bson.M{"$project": bson.M{"metadata": 1}},
+	}
+	result := []object{}
+	if err := store.aggregate(objects, pipeline, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to look up the data of the objects. Error: %s.", err)}
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectsBySizeAndAge returns the objects of the organization whose data size is at least minSize bytes
+// and that weren't updated for at least the given duration. The objects are ordered by decreasing data size.
+func (store *MongoStorage) RetrieveObjectsBySizeAndAge(orgID string, minSize int64, olderThan time.Duration) ([]common.MetaData,
+	common.SyncServiceError) {
+	before, err := objectsBySizeAndAgeLimit(minSize, olderThan)
+	if err != nil {
+		return nil, err
+	}
+	query := bson.M{
+		"metadata.destination-org-id": orgID,
+		"metadata.object-size":        bson.M{"$gte": minSize},
+		"last-update":                 bson.M{"$lte": bson.MongoTimestamp(before.Unix() << 32)},
+	}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	result := []object{}
+	if err := store.fetchPage(objects, query, selector, []string{"-metadata.object-size"}, 0, 0, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the objects by size and age. Error: %s.", err)}
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectsApproachingDeadline returns the undelivered objects of the organization whose delivery deadline
+// is within the given duration from now, including objects that already missed their deadline.
+// The objects are ordered by their delivery deadline.
+func (store *MongoStorage) RetrieveObjectsApproachingDeadline(orgID string, within time.Duration) ([]common.MetaData, common.SyncServiceError) {
+	limit, err := deliveryDeadlineLimit(within)
+	if err != nil {
+		return nil, err
+	}
+	query := bson.M{
+		"metadata.destination-org-id": orgID,
+		"metadata.delivery-deadline":  bson.M{"$gt": "", "$lte": limit},
+		"status":                      bson.M{"$in": []string{common.NotReadyToSend, common.ReadyToSend}},
+		"$or": []bson.M{
+			bson.M{"destinations": bson.M{"$size": 0}},
+			bson.M{"destinations": nil},
+			bson.M{"destinations.status": bson.M{"$in": undeliveredDestinationStatuses}}},
+	}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	result := []object{}
+	if err := store.fetchPage(objects, query, selector, []string{"metadata.delivery-deadline"}, 0, 0, &result); err != nil {
+		return nil, err
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectsAcrossOrgs retrieves up to limit objects of all the organizations that match the filter,
+// ordered by organization, object type, and object ID, skipping the first offset objects
+func (store *MongoStorage) RetrieveObjectsAcrossOrgs(filter common.ObjectFilter, offset int, limit int) ([]common.MetaData, int, common.SyncServiceError) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, &common.InvalidRequest{Message: "Offset and limit must be non-negative numbers"}
+	}
+	query := bson.M{}
+	if filter.OrgID != "" {
+		query["metadata.destination-org-id"] = filter.OrgID
+	}
+	if filter.ObjectType != "" {
+		query["metadata.object-type"] = filter.ObjectType
+	}
+	if filter.ObjectID != "" {
+		query["metadata.object-id"] = filter.ObjectID
+	}
+	if filter.DestinationType != "" {
+		if filter.DestinationID == "" {
+			query["$or"] = []bson.M{
+				bson.M{"metadata.destination-type": filter.DestinationType},
+				bson.M{"metadata.destinations-list": bson.M{"$regex": "^" + regexp.QuoteMeta(filter.DestinationType+":")}},
+			}
+		} else {
+			query["$or"] = []bson.M{
+				bson.M{"metadata.destination-type": filter.DestinationType, "metadata.destination-id": filter.DestinationID},
+				bson.M{"metadata.destinations-list": filter.DestinationType + ":" + filter.DestinationID},
+			}
+		}
+	}
+
+	total, err := store.count(objects, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	result := []object{}
+	sortFields := []string{"metadata.destination-org-id", "metadata.object-type", "metadata.object-id"}
+	if err := store.fetchPage(objects, query, selector, sortFields, offset, limit, &result); err != nil {
+		return nil, 0, err
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, int(total), nil
+}
+
 // RetrieveObjects returns the list of all the objects that need to be sent to the destination.
 // Adds the new destination to the destinations lists of the relevant objects.
 func (store *MongoStorage) RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError) {
+	store.updateDestinationLastConnected(orgID, destType, destID)
+
+	objectTypePermitted, err := destinationObjectTypesFilter(store, orgID, destType)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destination object types ACLs. Error: %s.", err)}
+	}
+
+	// Objects are only sent to registered destinations
+	dest, err := store.RetrieveDestination(orgID, destType, destID)
+	if err != nil {
+		if IsNotFound(err) {
+			return make([]common.MetaData, 0), nil
+		}
+		return nil, err
+	}
+
+	// Only objects of the destination's type, or of all types, are fetched, so that the retrieval doesn't scan
+	// the objects sent to other destination types (such as objects broadcast to other types)
 	result := []object{}
 	query := bson.M{"metadata.destination-org-id": orgID,
+		"metadata.destination-type": bson.M{"$in": []interface{}{"", nil, destType}},
+		"metadata.destination-id":   bson.M{"$in": []interface{}{"", nil, destID}},
 		"$or": []bson.M{
 			bson.M{"status": common.ReadyToSend},
 			bson.M{"status": common.NotReadyToSend},
@@ -816,68 +1356,93 @@ OUTER:
 				continue
 			}
 			if (r.MetaData.DestType == "" || r.MetaData.DestType == destType) &&
-				(r.MetaData.DestID == "" || r.MetaData.DestID == destID) {
+				(r.MetaData.DestID == "" || r.MetaData.DestID == destID) && objectTypePermitted(r.MetaData.ObjectType) {
 				status := common.Pending
 				if r.Status == common.ReadyToSend && !r.MetaData.Inactive {
 					status = common.Delivering
+					if deliveryLimitReached(len(metaDatas)) {
+						// Leave the object pending, it will be delivered when the destination's objects are retrieved again
+						status = common.Pending
+					}
 				}
 				needToUpdate := false
 				// Add destination if it doesn't exist
-				if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil {
-					existingDestIndex := -1
-					for i, d := range r.Destinations {
-						if d.Destination == *dest {
-							existingDestIndex = i
-							break
-						}
+				existingDestIndex := -1
+				for i, d := range r.Destinations {
+					if d.Destination == *dest {
+						existingDestIndex = i
+						break
 					}
-					if existingDestIndex != -1 {
-						d := r.Destinations[existingDestIndex]
-						if status == common.Delivering &&
-							(resend == common.ResendAll || (resend == common.ResendDelivered && d.Status != common.Consumed) ||
-								(resend == common.ResendUndelivered && d.Status != common.Consumed && d.Status != common.Delivered)) {
-							metaDatas = append(metaDatas, r.MetaData)
-							r.Destinations[existingDestIndex].Status = common.Delivering
-							needToUpdate = true
-						}
-					} else {
-						if status == common.Delivering {
-							metaDatas = append(metaDatas, r.MetaData)
-						}
+				}
+				if existingDestIndex != -1 {
+					d := r.Destinations[existingDestIndex]
+					if status == common.Delivering &&
+						(resend == common.ResendAll || (resend == common.ResendDelivered && d.Status != common.Consumed) ||
+							(resend == common.ResendUndelivered && d.Status != common.Consumed && d.Status != common.Delivered)) {
+						metaDatas = append(metaDatas, r.MetaData)
+						setDeliveryStatus(&r.Destinations[existingDestIndex], common.Delivering)
 						needToUpdate = true
-						r.Destinations = append(r.Destinations, common.StoreDestinationStatus{Destination: *dest, Status: status})
 					}
-					if needToUpdate {
-						id := createObjectCollectionID(orgID, r.MetaData.ObjectType, r.MetaData.ObjectID)
-						if err := store.update(objects, bson.M{"_id": id, "last-update": r.LastUpdate},
-							bson.M{
-								"$set":         bson.M{"destinations": r.Destinations},
-								"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
-							}); err != nil {
-							if err == mgo.ErrNotFound {
-								continue OUTER
-							}
-							return nil, &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
+				} else {
+					if status == common.Delivering {
+						metaDatas = append(metaDatas, r.MetaData)
+					}
+					needToUpdate = true
+					d := common.StoreDestinationStatus{Destination: *dest}
+					setDeliveryStatus(&d, status)
+					r.Destinations = append(r.Destinations, d)
+				}
+				if needToUpdate {
+					id := createObjectCollectionID(orgID, r.MetaData.ObjectType, r.MetaData.ObjectID)
+					if err := store.update(objects, bson.M{"_id": id, "last-update": r.LastUpdate},
+						bson.M{
+							"$set":         bson.M{"destinations": r.Destinations},
+							"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+						}); err != nil {
+						if err == mgo.ErrNotFound {
+							updateRetried("RetrieveObjects")
+							continue OUTER
 						}
+						return nil, &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
 					}
 				}
 			}
 		}
+		updateSucceeded("RetrieveObjects", i)
 		return metaDatas, nil
 	}
+	updateRetriesExhausted("RetrieveObjects")
 	return nil, &Error{fmt.Sprintf("Failed to update object's destinations.")}
 }
 
-// RetrieveConsumedObjects returns all the consumed objects originated from this node
-// ESS only API
-func (store *MongoStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError) {
-	return nil, nil
-}
-
-// RetrieveObject returns the object meta data with the specified parameters
-func (store *MongoStorage) RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError) {
-	result := object{}
-	id := createObjectCollectionID(orgID, objectType, objectID)
+// RetrieveObjectsForDestType returns the objects of the organization that are broadcast to all the destinations of the type
+func (store *MongoStorage) RetrieveObjectsForDestType(orgID string, destType string) ([]common.MetaData, common.SyncServiceError) {
+	query := bson.M{
+		"metadata.destination-org-id": orgID,
+		"metadata.destination-type":   destType,
+		"metadata.broadcast":          true,
+	}
+	result := []object{}
+	if err := store.fetchAll(objects, query, bson.M{"metadata": bson.ElementDocument}, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the broadcast objects. Error: %s.", err)}
+	}
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
+// RetrieveConsumedObjects returns all the consumed objects originated from this node
+// ESS only API
+func (store *MongoStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveObject returns the object meta data with the specified parameters
+func (store *MongoStorage) RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError) {
+	result := object{}
+	id := createObjectCollectionID(orgID, objectType, objectID)
 	if err := store.fetchOne(objects, bson.M{"_id": id}, bson.M{"metadata": bson.ElementDocument}, &result); err != nil {
 		switch err {
 		case mgo.ErrNotFound:
@@ -889,6 +1454,90 @@ func (store *MongoStorage) RetrieveObject(orgID string, objectType string, objec
 	return &result.MetaData, nil
 }
 
+// RetrieveObjectsByIDs returns the meta data of the objects with the provided keys, in the order of the keys.
+// Objects that don't exist are omitted from the result.
+func (store *MongoStorage) RetrieveObjectsByIDs(orgID string, keys []common.ObjectKey) ([]common.MetaData, common.SyncServiceError) {
+	metaDatas := make([]common.MetaData, 0, len(keys))
+	if len(keys) == 0 {
+		return metaDatas, nil
+	}
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = createObjectCollectionID(orgID, key.ObjectType, key.ObjectID)
+	}
+
+	result := []object{}
+	query := bson.M{"_id": bson.M{"$in": ids}}
+	if err := store.fetchAll(objects, query, bson.M{"metadata": bson.ElementDocument}, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the objects. Error: %s.", err)}
+	}
+	found := make(map[common.ObjectKey]common.MetaData, len(result))
+	for _, r := range result {
+		found[common.ObjectKey{ObjectType: r.MetaData.ObjectType, ObjectID: r.MetaData.ObjectID}] = r.MetaData
+	}
+	for _, key := range keys {
+		if metaData, ok := found[key]; ok {
+			metaDatas = append(metaDatas, metaData)
+		}
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectMetadataBatch returns the meta data of the objects with the provided keys, in the order of the keys,
+// with only the requested fields set. Only the requested fields are fetched from the database.
+func (store *MongoStorage) RetrieveObjectMetadataBatch(orgID string, keys []common.ObjectKey, fields []string) ([]common.MetaData,
+	common.SyncServiceError) {
+	if err := validateMetaDataFields(fields); err != nil {
+		return nil, err
+	}
+	metaDatas := make([]common.MetaData, 0, len(keys))
+	if len(keys) == 0 {
+		return metaDatas, nil
+	}
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = createObjectCollectionID(orgID, key.ObjectType, key.ObjectID)
+	}
+
+	projection := bson.M{}
+	for _, field := range metaDataKeyFields {
+		projection["metadata."+field] = 1
+	}
+	for _, field := range fields {
+		projection["metadata."+field] = 1
+	}
+	result := []object{}
+	query := bson.M{"_id": bson.M{"$in": ids}}
+	if err := store.fetchAll(objects, query, projection, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the objects. Error: %s.", err)}
+	}
+	found := make(map[common.ObjectKey]common.MetaData, len(result))
+	for _, r := range result {
+		found[common.ObjectKey{ObjectType: r.MetaData.ObjectType, ObjectID: r.MetaData.ObjectID}] = r.MetaData
+	}
+	for _, key := range keys {
+		if metaData, ok := found[key]; ok {
+			metaDatas = append(metaDatas, metaData)
+		}
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectInstanceID returns the instance ID of the stored object, or 0 if the object doesn't exist
+func (store *MongoStorage) RetrieveObjectInstanceID(orgID string, objectType string, objectID string) (int64, common.SyncServiceError) {
+	result := object{}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.fetchOne(objects, bson.M{"_id": id}, bson.M{"metadata.instance-id": bson.ElementInt64}, &result); err != nil {
+		switch err {
+		case mgo.ErrNotFound:
+			return 0, nil
+		default:
+			return 0, &Error{fmt.Sprintf("Failed to fetch the object's instance ID. Error: %s.", err)}
+		}
+	}
+	return result.MetaData.InstanceID, nil
+}
+
 // RetrieveObjectAndStatus returns the object meta data and status with the specified parameters
 func (store *MongoStorage) RetrieveObjectAndStatus(orgID string, objectType string, objectID string) (*common.MetaData, string, common.SyncServiceError) {
 	result := object{}
@@ -901,14 +1550,62 @@ func (store *MongoStorage) RetrieveObjectAndStatus(orgID string, objectType stri
 			return nil, "", &Error{fmt.Sprintf("Failed to fetch the object. Error: %s.", err)}
 		}
 	}
+	result.MetaData.DataComplete = result.DataComplete
 	return &result.MetaData, result.Status, nil
 }
 
+// RetrieveObjectIfModifiedSince returns the object meta data and status if the object was modified after the given time
+func (store *MongoStorage) RetrieveObjectIfModifiedSince(orgID string, objectType string, objectID string, since time.Time) (*common.MetaData, string, bool, common.SyncServiceError) {
+	if since.Unix() <= 0 {
+		metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+		return metaData, status, true, err
+	}
+
+	// Mongo timestamps have a one second resolution, objects updated during the second of since are considered modified
+	result := object{}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	query := bson.M{"_id": id, "last-update": bson.M{"$gt": bson.MongoTimestamp(since.Unix() << 32)}}
+	if err := store.fetchOne(objects, query, nil, &result); err != nil {
+		if err != mgo.ErrNotFound {
+			return nil, "", false, &Error{fmt.Sprintf("Failed to fetch the object. Error: %s.", err)}
+		}
+		// Distinguish between an object that wasn't modified and an object that doesn't exist
+		if err := store.fetchOne(objects, bson.M{"_id": id}, bson.M{"_id": bson.ElementString}, &result); err != nil {
+			if err == mgo.ErrNotFound {
+				return nil, "", true, nil
+			}
+			return nil, "", false, &Error{fmt.Sprintf("Failed to fetch the object. Error: %s.", err)}
+		}
+		return nil, "", false, nil
+	}
+	return &result.MetaData, result.Status, true, nil
+}
+
 // RetrieveObjectData returns the object data with the specified parameters
-func (store *MongoStorage) RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
+func (store *MongoStorage) RetrieveObjectData(orgID string, objectType string, objectID string, identity string) (io.Reader, common.SyncServiceError) {
 	id := createObjectCollectionID(orgID, objectType, objectID)
-	fileHandle, err := store.openFile(id)
+	uri, fileName, noData, err := store.retrieveDataLocation(id)
+	if err != nil {
+		return nil, err
+	} else if noData {
+		return nil, nil
+	} else if uri != "" {
+		dataReader, err := dataURI.GetData(uri)
+		if err != nil && common.IsNotFound(err) {
+			return nil, nil
+		}
+		if err == nil && dataAccessLogged(identity) {
+			store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, 0))
+		}
+		return dataReader, err
+	}
+
+	if err := store.reserveFileReader(); err != nil {
+		return nil, err
+	}
+	fileHandle, err := store.openFile(fileName)
 	if err != nil {
+		store.cancelFileReader()
 		switch err {
 		case mgo.ErrNotFound:
 			return nil, nil
@@ -917,29 +1614,65 @@ func (store *MongoStorage) RetrieveObjectData(orgID string, objectType string, o
 		}
 	}
 	store.putFileHandle(id, fileHandle)
+	if dataAccessLogged(identity) {
+		store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, fileHandle.file.Size()))
+	}
 	return fileHandle.file, nil
 }
 
 // CloseDataReader closes the data reader if necessary
 func (store *MongoStorage) CloseDataReader(dataReader io.Reader) common.SyncServiceError {
 	switch v := dataReader.(type) {
+	case *os.File:
+		return v.Close()
 	case *mgo.GridFile:
 		err := v.Close()
-		if id, ok := v.Id().(string); ok {
-			if fileHandle := store.getFileHandle(id); fileHandle != nil {
-				store.deleteFileHandle(id)
-			}
-		}
+		store.releaseFileHandle(v)
 		return err
+	case io.Closer:
+		return v.Close()
 	default:
 		return nil
 	}
 }
 
 // ReadObjectData returns the object data with the specified parameters
-func (store *MongoStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+func (store *MongoStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64,
+	identity string) ([]byte, bool, int, common.SyncServiceError) {
 	id := createObjectCollectionID(orgID, objectType, objectID)
-	fileHandle, err := store.openFile(id)
+	uri, fileName, noData, err := store.retrieveDataLocation(id)
+	if err != nil {
+		return nil, true, 0, err
+	} else if noData {
+		return make([]byte, 0), true, 0, nil
+	}
+
+	var data []byte
+	var eof bool
+	var length int
+	if uri != "" {
+		data, eof, length, err = dataURI.GetDataChunk(uri, size, offset)
+	} else {
+		data, eof, length, err = store.readDataFile(fileName, size, offset)
+		if err != nil && !common.IsNotFound(err) && dataRepairProvider != nil {
+			if repairErr := store.repairDataFile(orgID, objectType, objectID, fileName); repairErr != nil {
+				if log.IsLogging(logger.ERROR) {
+					log.Error("Failed to repair the data of the object %s after a read failure (%s). Error: %s\n", id, err, repairErr)
+				}
+			} else {
+				data, eof, length, err = store.readDataFile(fileName, size, offset)
+			}
+		}
+	}
+	if err == nil && dataAccessLogged(identity) {
+		store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, int64(length)))
+	}
+	return data, eof, length, err
+}
+
+// readDataFile reads up to size bytes at the offset of the data file
+func (store *MongoStorage) readDataFile(fileName string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	fileHandle, err := store.openFile(fileName)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return nil, true, 0, &common.NotFound{}
@@ -979,10 +1712,84 @@ func (store *MongoStorage) ReadObjectData(orgID string, objectType string, objec
 	return b, eof, n, nil
 }
 
+// repairDataFile rewrites the data file of the object with the data supplied by the data repair provider
+func (store *MongoStorage) repairDataFile(orgID string, objectType string, objectID string, fileName string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	dataReader, err := dataRepairProvider.RetrieveObjectData(orgID, objectType, objectID)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to retrieve the data from the data repair provider. Error: %s.", err)}
+	}
+	if dataReader == nil {
+		return &Error{"The data repair provider doesn't have the object's data"}
+	}
+	if closer, ok := dataReader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if _, _, err := store.copyDataToFile(fileName, dataReader, true, true); err != nil {
+		return err
+	}
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("Repaired the data of the object %s:%s:%s from the data repair provider", orgID, objectType, objectID)
+	}
+	return nil
+}
+
+// ReadPartialObjectData returns the object data with the specified parameters while the data may still be uploaded.
+// During an upload of the data by AppendObjectData, only the data up to the committed offset of the upload that was
+// already flushed to GridFS chunks is returned, and eof is false until the upload completes.
+// Otherwise it is the same as ReadObjectData.
+func (store *MongoStorage) ReadPartialObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	fileID, committed, uploading := store.getUploadProgress(id)
+	if !uploading {
+		return store.ReadObjectData(orgID, objectType, objectID, size, offset, "")
+	}
+
+	s := committedReadSize(committed, size, offset)
+	if s == 0 {
+		return make([]byte, 0), false, 0, nil
+	}
+	end := offset + s
+	chunkSize := int64(common.Configuration.MaxDataChunkSize)
+	query := bson.M{"files_id": fileID, "n": bson.M{"$gte": offset / chunkSize, "$lte": (end - 1) / chunkSize}}
+	chunks := []gridFSChunk{}
+	if err := store.fetchPage(store.gridFSPrefix+".chunks", query, nil, []string{"n"}, 0, 0, &chunks); err != nil {
+		return nil, true, 0, &Error{fmt.Sprintf("Failed to read the uploaded data. Error: %s.", err)}
+	}
+
+	b := make([]byte, 0, s)
+	position := (offset / chunkSize) * chunkSize
+	for _, chunk := range chunks {
+		if int64(chunk.N)*chunkSize != position {
+			// The chunk at the position hasn't been flushed yet
+			break
+		}
+		chunkEnd := position + int64(len(chunk.Data))
+		start, stop := offset, end
+		if start < position {
+			start = position
+		}
+		if stop > chunkEnd {
+			stop = chunkEnd
+		}
+		if start < stop {
+			b = append(b, chunk.Data[start-position:stop-position]...)
+		}
+		position = chunkEnd
+	}
+	return b, false, len(b), nil
+}
+
 // StoreObjectData stores object's data
 // Return true if the object was found and updated
 // Return false and no error, if the object doesn't exist
 func (store *MongoStorage) StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return false, err
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	result := object{}
 	if err := store.fetchOne(objects, bson.M{"_id": id}, bson.M{"status": bson.ElementString}, &result); err != nil {
@@ -995,7 +1802,7 @@ func (store *MongoStorage) StoreObjectData(orgID string, objectType string, obje
 	}
 
 	if result.Status == common.NotReadyToSend {
-		store.UpdateObjectStatus(orgID, objectType, objectID, common.ReadyToSend)
+		store.UpdateObjectStatus(orgID, objectType, objectID, common.ReadyToSend, common.SyncServiceIdentity)
 	}
 	if result.Status == common.NotReadyToSend || result.Status == common.ReadyToSend {
 		newID := store.getInstanceID()
@@ -1008,20 +1815,105 @@ func (store *MongoStorage) StoreObjectData(orgID string, objectType string, obje
 		}
 	}
 
-	_, size, err := store.copyDataToFile(id, dataReader, true, true)
+	limiter := newObjectSizeLimiter(objectType, dataReader, 0)
+	fileHandle, size, err := store.copyDataToFile(id, limiter, true, true)
 	if err != nil {
+		if limiter.exceeded != nil {
+			store.abortFile(id, fileHandle)
+			return false, limiter.exceeded
+		}
 		return false, err
 	}
 
 	// Update object size
-	if err := store.update(objects, bson.M{"_id": id}, bson.M{"$set": bson.M{"metadata.object-size": size}}); err != nil {
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"metadata.object-size": size, "data-complete": true}}); err != nil {
 		return false, &Error{fmt.Sprintf("Failed to update object's size. Error: %s.", err)}
 	}
+	if err := store.releaseReplacedDataFile(id); err != nil {
+		return false, err
+	}
 
 	return true, nil
 }
 
+// ReplaceObject replaces the meta data and the data of an existing object.
+// The data is written to a new file, and the object is switched to the new meta data and file only after the data
+// was written, so that readers see either the previous meta data and data or the new ones.
+// The file of the previous data is removed after the switch. The status and the destinations of the object are kept.
+func (store *MongoStorage) ReplaceObject(metaData common.MetaData, dataReader io.Reader, identity string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := checkReplacementMetaData(metaData); err != nil {
+		return err
+	}
+	normalizeObjectTimes(&metaData)
+
+	id := getObjectCollectionID(metaData)
+	existingObject := object{}
+	selector := bson.M{"metadata": bson.ElementDocument, "status": bson.ElementString, "data-file": bson.ElementString}
+	if err := store.fetchOne(objects, bson.M{"_id": id}, selector, &existingObject); err != nil {
+		if err == mgo.ErrNotFound {
+			return notFound
+		}
+		return &Error{fmt.Sprintf("Failed to retrieve the object. Error: %s.", err)}
+	}
+	if (metaData.DestinationPolicy != nil) != (existingObject.MetaData.DestinationPolicy != nil) {
+		return &common.InvalidRequest{Message: "Can't update the existence of Destination Policy"}
+	}
+	if err := store.storeObjectVersion(id, metaData.DestOrgID, metaData.ObjectType); err != nil {
+		return err
+	}
+
+	if existingObject.Status == common.NotReadyToSend || existingObject.Status == common.ReadyToSend {
+		newID := store.getInstanceID()
+		metaData.InstanceID = newID
+		metaData.DataID = newID
+	} else {
+		metaData.InstanceID = existingObject.MetaData.InstanceID
+		metaData.DataID = existingObject.MetaData.DataID
+	}
+	if metaData.DestinationPolicy != nil {
+		metaData.DestinationPolicy.Timestamp = time.Now().UTC().UnixNano()
+	}
+
+	fileName := createReplacedDataFileName(id, metaData.InstanceID)
+	limiter := newObjectSizeLimiter(metaData.ObjectType, dataReader, 0)
+	fileHandle, size, err := store.copyDataToFile(fileName, limiter, true, true)
+	if err != nil {
+		if limiter.exceeded != nil {
+			store.abortFile(fileName, fileHandle)
+			return limiter.exceeded
+		}
+		return err
+	}
+	metaData.ObjectSize = size
+
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{
+			"$set":         bson.M{"metadata": metaData, "data-file": fileName, "data-complete": true},
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		}); err != nil {
+		store.removeFile(fileName)
+		if err == mgo.ErrNotFound {
+			return notFound
+		}
+		return &Error{fmt.Sprintf("Failed to replace the object. Error: %s.", err)}
+	}
+
+	if err := store.removeFile(dataFileName(id, existingObject.DataFile)); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to remove the replaced data of the object %s. Error: %s\n", id, err)
+	}
+	store.addAuditRecord(newAuditRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.AuditStore,
+		existingObject.Status, identity))
+	return nil
+}
+
 func (store *MongoStorage) StoreObjectTempData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return false, err
+	}
 	id := createTempObjectCollectionID(orgID, objectType, objectID)
 
 	_, _, err := store.copyDataToFile(id, dataReader, true, true)
@@ -1033,6 +1925,9 @@ func (store *MongoStorage) StoreObjectTempData(orgID string, objectType string,
 }
 
 func (store *MongoStorage) RemoveObjectTempData(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	id := createTempObjectCollectionID(orgID, objectType, objectID)
 	if err := store.removeFile(id); err != nil {
 		return err
@@ -1043,8 +1938,12 @@ func (store *MongoStorage) RemoveObjectTempData(orgID string, objectType string,
 
 func (store *MongoStorage) RetrieveTempObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
 	id := createTempObjectCollectionID(orgID, objectType, objectID)
+	if err := store.reserveFileReader(); err != nil {
+		return nil, err
+	}
 	fileHandle, err := store.openFile(id)
 	if err != nil {
+		store.cancelFileReader()
 		switch err {
 		case mgo.ErrNotFound:
 			return nil, nil
@@ -1059,9 +1958,20 @@ func (store *MongoStorage) RetrieveTempObjectData(orgID string, objectType strin
 // AppendObjectData appends a chunk of data to the object's data
 func (store *MongoStorage) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader,
 	dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if isFirstChunk {
+		if err := checkObjectSize(objectType, total); err != nil {
+			return err
+		}
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	var fileHandle *fileHandle
 	if isFirstChunk {
+		if err := store.setDataComplete(id, false); err != nil {
+			return err
+		}
 		store.removeFile(id)
 		fh, err := store.createFile(id)
 		if err != nil {
@@ -1070,7 +1980,7 @@ func (store *MongoStorage) AppendObjectData(orgID string, objectType string, obj
 		fileHandle = fh
 	} else {
 		fh := store.getFileHandle(id)
-		if fh == nil {
+		if fh == nil || !fh.uploading {
 			return &Error{fmt.Sprintf("Failed to append the data at offset %d, the file %s doesn't exist.", offset, id)}
 		}
 		fileHandle = fh
@@ -1079,13 +1989,18 @@ func (store *MongoStorage) AppendObjectData(orgID string, objectType string, obj
 	var n int
 	var err error
 	var data []byte
+	limiter := newObjectSizeLimiter(objectType, dataReader, offset)
 	if dataLength > 0 {
 		data = make([]byte, dataLength)
-		n, err = dataReader.Read(data)
+		n, err = limiter.Read(data)
 	} else {
-		data, err = ioutil.ReadAll(dataReader)
+		data, err = ioutil.ReadAll(limiter)
 		n = len(data)
 	}
+	if limiter.exceeded != nil {
+		store.abortFile(id, fileHandle)
+		return limiter.exceeded
+	}
 	if err != nil {
 		return &Error{fmt.Sprintf("Failed to read the data from the dataReader. Error: %s.", err)}
 	}
@@ -1123,9 +2038,11 @@ func (store *MongoStorage) AppendObjectData(orgID string, objectType string, obj
 		}
 		if len(fileHandle.chunks) > 100 {
 			if trace.IsLogging(logger.INFO) {
-				trace.Info(" Discard data chunk at offset %d since there are too many (%d) out-of-order chunks\n", offset, len(fileHandle.chunks))
+				trace.Info(" Postpone data chunk at offset %d since there are too many (%d) out-of-order chunks, expecting offset %d\n",
+					offset, len(fileHandle.chunks), fileHandle.offset)
 			}
-			return &Discarded{fmt.Sprintf(" Discard data chunk at offset %d since there are too many out-of-order chunks\n", offset)}
+			return &Backpressure{fmt.Sprintf(" Postpone data chunk at offset %d since there are too many out-of-order chunks, expecting offset %d\n",
+				offset, fileHandle.offset), fileHandle.offset}
 		}
 		fileHandle.chunks[offset] = data
 		if trace.IsLogging(logger.TRACE) {
@@ -1133,51 +2050,250 @@ func (store *MongoStorage) AppendObjectData(orgID string, objectType string, obj
 		}
 	}
 	if isLastChunk {
-		store.deleteFileHandle(id)
+		// The file is closed before its handle is deleted, so that partial reads of the data continue until
+		// the completed file can be read
 		err := fileHandle.file.Close()
+		store.deleteFileHandle(id)
 		if err != nil {
 			return &Error{fmt.Sprintf("Failed to close the file. Error: %s.", err)}
 		}
+		if err := store.releaseReplacedDataFile(id); err != nil {
+			return err
+		}
+		if err := store.setDataComplete(id, true); err != nil {
+			return err
+		}
 	} else {
-		store.putFileHandle(id, fileHandle)
+		store.putUploadFileHandle(id, fileHandle)
 	}
 
 	return nil
 }
 
+// AppendObjectDelta reconstructs the data of the object from its stored base data and a binary patch, and stores the result
+func (store *MongoStorage) AppendObjectDelta(orgID string, objectType string, objectID string, baseDataID int64, patch io.Reader,
+	size int64, hash string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	return appendObjectDelta(store, orgID, objectType, objectID, baseDataID, patch, size, hash)
+}
+
 // UpdateObjectStatus updates object's status
-func (store *MongoStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError {
+func (store *MongoStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string, identity string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
-	if err := store.update(objects, bson.M{"_id": id},
+	result := object{}
+	if err := store.findAndUpdate(objects, bson.M{"_id": id}, bson.M{"status": bson.ElementString},
 		bson.M{
 			"$set":         bson.M{"status": status},
 			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
-		}); err != nil {
+		}, &result); err != nil {
 		return &Error{fmt.Sprintf("Failed to update object's status. Error: %s.", err)}
 	}
-	return nil
-}
-
-// UpdateObjectSourceDataURI updates object's source data URI
-func (store *MongoStorage) UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError {
-	return nil
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditUpdateStatus, status, identity))
+	notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+		OldStatus: result.Status, NewStatus: status})
+	return nil
+}
+
+// PatchObjectMetadata updates the specified fields of the object's meta data
+// Only the fields in objectMetadataPatchFields can be updated, the destinations and the data of the object are not modified
+func (store *MongoStorage) PatchObjectMetadata(orgID string, objectType string, objectID string, patch map[string]interface{}) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	fields, err := validateObjectMetadataPatch(patch)
+	if err != nil {
+		return err
+	}
+	set := bson.M{}
+	for field, value := range fields {
+		set["metadata."+field] = value
+	}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{
+			"$set":         set,
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		}); err != nil {
+		if err == mgo.ErrNotFound {
+			return notFound
+		}
+		return &Error{fmt.Sprintf("Failed to patch object's meta data. Error: %s.", err)}
+	}
+	return nil
+}
+
+// TouchObject extends the expiration time of an object that is being delivered
+func (store *MongoStorage) TouchObject(orgID string, objectType string, objectID string, extendBy time.Duration) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	result := object{}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	for i := 0; i < maxUpdateTries; i++ {
+		if err := store.fetchOne(objects, bson.M{"_id": id},
+			bson.M{"metadata": bson.ElementDocument, "status": bson.ElementString, "last-update": bson.ElementTimestamp},
+			&result); err != nil {
+			if err == mgo.ErrNotFound {
+				return notFound
+			}
+			return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
+		}
+		expiration, err := touchObjectExpiration(result.Status, result.MetaData, extendBy)
+		if err != nil || expiration == "" {
+			return err
+		}
+		if err := store.update(objects, bson.M{"_id": id, "last-update": result.LastUpdate},
+			bson.M{
+				"$set":         bson.M{"metadata.expiration": expiration},
+				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+			}); err != nil {
+			if err == mgo.ErrNotFound {
+				updateRetried("TouchObject")
+				continue
+			}
+			return &Error{fmt.Sprintf("Failed to extend the object's expiration. Error: %s.", err)}
+		}
+		updateSucceeded("TouchObject", i)
+		return nil
+	}
+	updateRetriesExhausted("TouchObject")
+	return &Error{"Failed to extend the object's expiration."}
+}
+
+// UpdateObjectSourceDataURI updates object's source data URI
+func (store *MongoStorage) UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{
+			"$set":         bson.M{"metadata.source-data-uri": sourceDataURI},
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		}); err != nil {
+		if err == mgo.ErrNotFound {
+			return notFound
+		}
+		return &Error{fmt.Sprintf("Failed to update object's source data URI. Error: %s.", err)}
+	}
+	return nil
+}
+
+// MarkObjectDeleted marks the object as deleted
+// The status of the object is kept in order to allow undeleting it
+func (store *MongoStorage) MarkObjectDeleted(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	result := object{}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	for i := 0; i < maxUpdateTries; i++ {
+		if err := store.fetchOne(objects, bson.M{"_id": id},
+			bson.M{"status": bson.ElementString, "previous-status": bson.ElementString, "last-update": bson.ElementTimestamp},
+			&result); err != nil {
+			return &Error{fmt.Sprintf("Failed to mark object as deleted. Error: %s.", err)}
+		}
+		previousStatus := result.Status
+		if previousStatus == common.ObjDeleted {
+			previousStatus = result.PreviousStatus
+		}
+		if err := store.update(objects, bson.M{"_id": id, "last-update": result.LastUpdate},
+			bson.M{
+				"$set":         bson.M{"status": common.ObjDeleted, "metadata.deleted": true, "previous-status": previousStatus},
+				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+			}); err != nil {
+			if err == mgo.ErrNotFound {
+				updateRetried("MarkObjectDeleted")
+				continue
+			}
+			return &Error{fmt.Sprintf("Failed to mark object as deleted. Error: %s.", err)}
+		}
+		updateSucceeded("MarkObjectDeleted", i)
+		store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditMarkDeleted, common.ObjDeleted, identity))
+		notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+			OldStatus: result.Status, NewStatus: common.ObjDeleted})
+		return nil
+	}
+	updateRetriesExhausted("MarkObjectDeleted")
+	return &Error{"Failed to mark object as deleted."}
+}
+
+// RetrieveDeletedObjects returns the objects of the organization that were marked as deleted
+func (store *MongoStorage) RetrieveDeletedObjects(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	result := []object{}
+	query := bson.M{"metadata.destination-org-id": orgID, "status": common.ObjDeleted}
+	if err := store.fetchAll(objects, query, bson.M{"metadata": bson.ElementDocument}, &result); err != nil {
+		switch err {
+		case mgo.ErrNotFound:
+			return nil, nil
+		default:
+			return nil, &Error{fmt.Sprintf("Failed to fetch the deleted objects. Error: %s.", err)}
+		}
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
 }
 
-// MarkObjectDeleted marks the object as deleted
-func (store *MongoStorage) MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError {
+// UndeleteObject restores an object marked as deleted to its status before the deletion
+// The object can be restored only if its data still exists
+func (store *MongoStorage) UndeleteObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	result := object{}
 	id := createObjectCollectionID(orgID, objectType, objectID)
-	if err := store.update(objects, bson.M{"_id": id},
+	if err := store.fetchOne(objects, bson.M{"_id": id},
+		bson.M{"metadata": bson.ElementDocument, "status": bson.ElementString, "previous-status": bson.ElementString,
+			"last-update": bson.ElementTimestamp, "data-file": bson.ElementString},
+		&result); err != nil {
+		switch err {
+		case mgo.ErrNotFound:
+			return notFound
+		default:
+			return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
+		}
+	}
+	if err := checkObjectUndeletable(result.Status, result.PreviousStatus); err != nil {
+		return err
+	}
+
+	if objectDataRequired(result.MetaData) {
+		fileHandle, err := store.openFile(dataFileName(id, result.DataFile))
+		if err != nil {
+			switch err {
+			case mgo.ErrNotFound:
+				return objectDataMissing
+			default:
+				return &Error{fmt.Sprintf("Failed to open file to read the data. Error: %s.", err)}
+			}
+		}
+		fileHandle.file.Close()
+	}
+
+	if err := store.update(objects, bson.M{"_id": id, "last-update": result.LastUpdate},
 		bson.M{
-			"$set":         bson.M{"status": common.ObjDeleted, "metadata.deleted": true},
+			"$set":         bson.M{"status": result.PreviousStatus, "metadata.deleted": false, "previous-status": ""},
 			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 		}); err != nil {
-		return &Error{fmt.Sprintf("Failed to mark object as deleted. Error: %s.", err)}
+		return &Error{fmt.Sprintf("Failed to undelete object. Error: %s.", err)}
 	}
 	return nil
 }
 
 // MarkDestinationPolicyReceived marks an object's destination policy as having been received
 func (store *MongoStorage) MarkDestinationPolicyReceived(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if err := store.update(objects, bson.M{"_id": id},
 		bson.M{
@@ -1191,6 +2307,9 @@ func (store *MongoStorage) MarkDestinationPolicyReceived(orgID string, objectTyp
 
 // ActivateObject marks object as active
 func (store *MongoStorage) ActivateObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if err := store.update(objects, bson.M{"_id": id},
 		bson.M{"$set": bson.M{"metadata.inactive": false},
@@ -1201,13 +2320,188 @@ func (store *MongoStorage) ActivateObject(orgID string, objectType string, objec
 	return nil
 }
 
+// PinObject pins the object, so that it isn't deleted by AutoDelete or when it expires
+func (store *MongoStorage) PinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	return store.setObjectPinned(orgID, objectType, objectID, true)
+}
+
+// UnpinObject unpins the object, so that AutoDelete and its expiration apply to it again
+func (store *MongoStorage) UnpinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	return store.setObjectPinned(orgID, objectType, objectID, false)
+}
+
+func (store *MongoStorage) setObjectPinned(orgID string, objectType string, objectID string, pinned bool) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"metadata.pinned": pinned},
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		}); err != nil {
+		if err == mgo.ErrNotFound {
+			return notFound
+		}
+		return &Error{fmt.Sprintf("Failed to update the object's pin. Error: %s.", err)}
+	}
+	return nil
+}
+
 // DeleteStoredObject deletes the object
-func (store *MongoStorage) DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError {
-	return store.deleteObject(orgID, objectType, objectID, -1)
+func (store *MongoStorage) DeleteStoredObject(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := store.deleteObject(orgID, objectType, objectID, -1); err != nil {
+		return err
+	}
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditDelete, "", identity))
+	return nil
+}
+
+// DeleteObjectsOfType deletes all the objects of the type in the organization and their data
+func (store *MongoStorage) DeleteObjectsOfType(orgID string, objectType string) (int, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	query := bson.M{"metadata.destination-org-id": orgID, "metadata.object-type": objectType}
+	type idstruct struct {
+		ID       string `bson:"_id"`
+		DataFile string `bson:"data-file,omitempty"`
+	}
+	results := []idstruct{}
+	selector := bson.M{"_id": bson.ElementString, "data-file": bson.ElementString}
+	if err := store.fetchAll(objects, query, selector, &results); err != nil && err != mgo.ErrNotFound {
+		return 0, &Error{fmt.Sprintf("Failed to fetch objects to delete. Error: %s.", err)}
+	}
+	for _, result := range results {
+		store.removeFile(result.ID)
+		if result.DataFile != "" {
+			store.removeFile(result.DataFile)
+		}
+	}
+
+	removed, err := store.removeAllAndCount(objects, query)
+	if err != nil && err != mgo.ErrNotFound {
+		return 0, &Error{fmt.Sprintf("Failed to delete objects. Error: %s.", err)}
+	}
+	return removed, nil
+}
+
+// RetrieveAuditLog returns the audit log of the object's mutations, ordered by time
+func (store *MongoStorage) RetrieveAuditLog(orgID string, objectType string, objectID string) ([]common.AuditRecord, common.SyncServiceError) {
+	result := []auditObject{}
+	query := bson.M{"record.org-id": orgID, "record.object-type": objectType, "record.object-id": objectID}
+	if err := store.fetchAll(audit, query, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the audit log. Error: %s.", err)}
+	}
+	records := make([]common.AuditRecord, len(result))
+	for i, r := range result {
+		records[i] = r.Record
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp.Before(records[j].Timestamp) })
+	return records, nil
+}
+
+// PurgeAuditLog deletes the audit records older than olderThan
+func (store *MongoStorage) PurgeAuditLog(olderThan time.Duration) common.SyncServiceError {
+	cutoff := time.Now().Add(-olderThan).UTC()
+	if err := store.removeAll(audit, bson.M{"record.timestamp": bson.M{"$lt": cutoff}}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to purge the audit log. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveObjectVersions returns the meta data of the kept previous versions of the object, ordered by instance ID
+func (store *MongoStorage) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.MetaData, common.SyncServiceError) {
+	result := []objectVersionObject{}
+	query := bson.M{"metadata.destination-org-id": orgID, "metadata.object-type": objectType, "metadata.object-id": objectID}
+	if err := store.fetchAll(objectVersions, query, bson.M{"metadata": bson.ElementDocument}, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the object's versions. Error: %s.", err)}
+	}
+	versions := make([]common.MetaData, len(result))
+	for i, r := range result {
+		versions[i] = r.MetaData
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].InstanceID < versions[j].InstanceID })
+	return versions, nil
+}
+
+// RetrieveObjectVersion returns the meta data and the data of a kept previous version of the object
+func (store *MongoStorage) RetrieveObjectVersion(orgID string, objectType string, objectID string, instanceID int64) (*common.MetaData, io.Reader, common.SyncServiceError) {
+	id := createObjectVersionCollectionID(orgID, objectType, objectID, instanceID)
+	result := objectVersionObject{}
+	if err := store.fetchOne(objectVersions, bson.M{"_id": id}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil, nil
+		}
+		return nil, nil, &Error{fmt.Sprintf("Failed to fetch the object's version. Error: %s.", err)}
+	}
+	if !result.HasData {
+		return &result.MetaData, nil, nil
+	}
+
+	if err := store.reserveFileReader(); err != nil {
+		return nil, nil, err
+	}
+	fileHandle, err := store.openFile(id)
+	if err != nil {
+		store.cancelFileReader()
+		if err == mgo.ErrNotFound {
+			return &result.MetaData, nil, nil
+		}
+		return nil, nil, &Error{fmt.Sprintf("Failed to open file to read the version's data. Error: %s.", err)}
+	}
+	store.putFileHandle(id, fileHandle)
+	return &result.MetaData, fileHandle.file, nil
+}
+
+// IsIdempotencyKeyRecorded returns true if the idempotency key was recorded for an update of the object
+// within the last IdempotencyKeyWindow seconds
+func (store *MongoStorage) IsIdempotencyKeyRecorded(orgID string, objectType string, objectID string, key string) (bool, common.SyncServiceError) {
+	if common.Configuration.IdempotencyKeyWindow <= 0 {
+		return false, nil
+	}
+	result := idempotencyKeyObject{}
+	id := createIdempotencyKeyID(orgID, objectType, objectID, key)
+	if err := store.fetchOne(idempotencyKeys, bson.M{"_id": id}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, &Error{fmt.Sprintf("Failed to fetch the idempotency key. Error: %s.", err)}
+	}
+	// The database removes expired keys only periodically
+	return !idempotencyKeyExpired(result.Recorded), nil
+}
+
+// RecordIdempotencyKey records the idempotency key of a successful update of the object
+func (store *MongoStorage) RecordIdempotencyKey(orgID string, objectType string, objectID string, key string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if common.Configuration.IdempotencyKeyWindow <= 0 {
+		return nil
+	}
+	id := createIdempotencyKeyID(orgID, objectType, objectID, key)
+	if err := store.upsert(idempotencyKeys, bson.M{"_id": id},
+		idempotencyKeyObject{ID: id, OrgID: orgID, Recorded: time.Now()}); err != nil {
+		return &Error{fmt.Sprintf("Failed to record the idempotency key. Error: %s.", err)}
+	}
+	return nil
 }
 
 // DeleteStoredData deletes the object's data
 func (store *MongoStorage) DeleteStoredData(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Deleting object's data %s\n", id)
@@ -1218,7 +2512,10 @@ func (store *MongoStorage) DeleteStoredData(orgID string, objectType string, obj
 		}
 		return err
 	}
-	return nil
+	if err := store.setDataComplete(id, false); err != nil {
+		return err
+	}
+	return store.releaseReplacedDataFile(id)
 }
 
 // CleanObjects removes the objects received from the other side.
@@ -1241,7 +2538,10 @@ func (store *MongoStorage) GetNumberOfStoredObjects() (uint32, common.SyncServic
 
 // AddWebhook stores a webhook for an object type
 func (store *MongoStorage) AddWebhook(orgID string, objectType string, url string) common.SyncServiceError {
-	id := orgID + ":" + objectType
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	id := createWebhookID(orgID, objectType)
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Adding a webhook for %s\n", id)
 	}
@@ -1254,10 +2554,12 @@ func (store *MongoStorage) AddWebhook(orgID string, objectType string, url strin
 				result.ID = id
 				if err = store.insert(webhooks, result); err != nil {
 					if mgo.IsDup(err) {
+						updateRetried("AddWebhook")
 						continue
 					}
 					return &Error{fmt.Sprintf("Failed to insert a webhook. Error: %s.", err)}
 				}
+				updateSucceeded("AddWebhook", i)
 				return nil
 			}
 			return &Error{fmt.Sprintf("Failed to add a webhook. Error: %s.", err)}
@@ -1276,18 +2578,24 @@ func (store *MongoStorage) AddWebhook(orgID string, objectType string, url strin
 				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 			}); err != nil {
 			if err == mgo.ErrNotFound {
+				updateRetried("AddWebhook")
 				continue
 			}
 			return &Error{fmt.Sprintf("Failed to add a webhook. Error: %s.", err)}
 		}
+		updateSucceeded("AddWebhook", i)
 		return nil
 	}
+	updateRetriesExhausted("AddWebhook")
 	return &Error{fmt.Sprintf("Failed to add a webhook.")}
 }
 
 // DeleteWebhook deletes a webhook for an object type
 func (store *MongoStorage) DeleteWebhook(orgID string, objectType string, url string) common.SyncServiceError {
-	id := orgID + ":" + objectType
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	id := createWebhookID(orgID, objectType)
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Deleting a webhook for %s\n", id)
 	}
@@ -1314,18 +2622,21 @@ func (store *MongoStorage) DeleteWebhook(orgID string, objectType string, url st
 				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 			}); err != nil {
 			if err == mgo.ErrNotFound {
+				updateRetried("DeleteWebhook")
 				continue
 			}
 			return &Error{fmt.Sprintf("Failed to delete a webhook. Error: %s.", err)}
 		}
+		updateSucceeded("DeleteWebhook", i)
 		return nil
 	}
+	updateRetriesExhausted("DeleteWebhook")
 	return &Error{fmt.Sprintf("Failed to delete a webhook.")}
 }
 
 // RetrieveWebhooks gets the webhooks for the object type
 func (store *MongoStorage) RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError) {
-	id := orgID + ":" + objectType
+	id := createWebhookID(orgID, objectType)
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Retrieving a webhook for %s\n", id)
 	}
@@ -1339,6 +2650,88 @@ func (store *MongoStorage) RetrieveWebhooks(orgID string, objectType string) ([]
 	return result.Hooks, nil
 }
 
+// StoreWebhookRetryPolicy stores the webhook retry policy of an object type, replacing the existing policy of the type
+func (store *MongoStorage) StoreWebhookRetryPolicy(policy common.WebhookRetryPolicy) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := validateWebhookRetryPolicy(policy); err != nil {
+		return err
+	}
+	id := common.CreateCompositeID(policy.OrgID, policy.ObjectType)
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing the webhook retry policy of %s:%s\n", policy.OrgID, policy.ObjectType)
+	}
+	if err := store.upsert(webhookPolicies, bson.M{"_id": id}, webhookPolicyObject{ID: id, Policy: policy}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a webhook retry policy. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveWebhookRetryPolicy retrieves the webhook retry policy of an object type, returns nil if the type doesn't have a policy
+func (store *MongoStorage) RetrieveWebhookRetryPolicy(orgID string, objectType string) (*common.WebhookRetryPolicy, common.SyncServiceError) {
+	result := webhookPolicyObject{}
+	if err := store.fetchOne(webhookPolicies, bson.M{"_id": common.CreateCompositeID(orgID, objectType)}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to fetch a webhook retry policy. Error: %s.", err)}
+	}
+	return &result.Policy, nil
+}
+
+// DeleteWebhookRetryPolicy deletes the webhook retry policy of an object type
+func (store *MongoStorage) DeleteWebhookRetryPolicy(orgID string, objectType string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := store.removeAll(webhookPolicies, bson.M{"_id": common.CreateCompositeID(orgID, objectType)}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete a webhook retry policy. Error: %s.", err)}
+	}
+	return nil
+}
+
+// StoreWebhookFailure records the failure of a webhook, replacing the previous failure of the webhook
+func (store *MongoStorage) StoreWebhookFailure(failure common.WebhookFailure) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	id := webhookFailureID(failure.OrgID, failure.ObjectType, failure.URL)
+	if err := store.upsert(webhookFailures, bson.M{"_id": id}, webhookFailureObject{ID: id, Failure: failure}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a webhook failure. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveWebhookFailures retrieves the recorded webhook failures of an organization
+func (store *MongoStorage) RetrieveWebhookFailures(orgID string) ([]common.WebhookFailure, common.SyncServiceError) {
+	result := []webhookFailureObject{}
+	if err := store.fetchAll(webhookFailures, bson.M{"failure.org-id": orgID}, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch webhook failures. Error: %s.", err)}
+	}
+	failures := make([]common.WebhookFailure, 0, len(result))
+	for _, r := range result {
+		failures = append(failures, r.Failure)
+	}
+	return failures, nil
+}
+
+// DeleteWebhookFailures deletes the recorded webhook failures of an object type,
+// or of all the object types of the organization if objectType is empty
+func (store *MongoStorage) DeleteWebhookFailures(orgID string, objectType string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	query := bson.M{"failure.org-id": orgID}
+	if objectType != "" {
+		query["failure.object-type"] = objectType
+	}
+	if err := store.removeAll(webhookFailures, query); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete webhook failures. Error: %s.", err)}
+	}
+	return nil
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *MongoStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	result := []destinationObject{}
@@ -1370,6 +2763,7 @@ func (store *MongoStorage) RetrieveDestinations(orgID string, destType string) (
 
 // DestinationExists returns true if the destination exists, and false otherwise
 func (store *MongoStorage) DestinationExists(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	result := destinationObject{}
 	id := createDestinationCollectionID(orgID, destType, destID)
 	if err := store.fetchOne(destinations, bson.M{"_id": id}, nil, &result); err != nil {
@@ -1381,10 +2775,45 @@ func (store *MongoStorage) DestinationExists(orgID string, destType string, dest
 	return true, nil
 }
 
+// DestinationsExist returns a map indicating for each of the provided destinations whether it exists
+func (store *MongoStorage) DestinationsExist(orgID string, dests []common.DestinationID) (map[common.DestinationID]bool, common.SyncServiceError) {
+	exist := make(map[common.DestinationID]bool, len(dests))
+	if len(dests) == 0 {
+		return exist, nil
+	}
+	orgID, normalized := normalizeDestinationIDs(orgID, dests)
+	ids := make([]string, len(normalized))
+	for i, dest := range normalized {
+		ids[i] = createDestinationCollectionID(orgID, dest.DestType, dest.DestID)
+	}
+
+	result := []destinationObject{}
+	query := bson.M{"_id": bson.M{"$in": ids}}
+	selector := bson.M{"destination.destination-type": bson.ElementString, "destination.destination-id": bson.ElementString}
+	if err := store.fetchAll(destinations, query, selector, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destinations. Error: %s.", err)}
+	}
+	found := make(map[common.DestinationID]bool, len(result))
+	for _, r := range result {
+		found[common.DestinationID{DestType: r.Destination.DestType, DestID: r.Destination.DestID}] = true
+	}
+	for i, dest := range dests {
+		exist[dest] = found[normalized[i]]
+	}
+	return exist, nil
+}
+
 // StoreDestination stores the destination
 func (store *MongoStorage) StoreDestination(destination common.Destination) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	destination.Normalize()
+	if err := destination.Validate(); err != nil {
+		return err
+	}
 	id := getDestinationCollectionID(destination)
-	newObject := destinationObject{ID: id, Destination: destination}
+	newObject := destinationObject{ID: id, Destination: destination, LastConnected: time.Now()}
 	err := store.upsert(destinations, bson.M{"_id": id, "destination.destination-org-id": destination.DestOrgID}, newObject)
 	if err != nil {
 		return &Error{fmt.Sprintf("Failed to store a destination. Error: %s.", err)}
@@ -1392,8 +2821,73 @@ func (store *MongoStorage) StoreDestination(destination common.Destination) comm
 	return nil
 }
 
+// StoreDestinations stores the destinations in a single bulk upsert, the returned errors correspond to the destinations
+func (store *MongoStorage) StoreDestinations(dests []common.Destination) ([]common.SyncServiceError, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return nil, err
+	}
+	errs := make([]common.SyncServiceError, len(dests))
+	pairs := make([]interface{}, 0, 2*len(dests))
+	// The index in dests of each upsert
+	upserted := make([]int, 0, len(dests))
+	now := time.Now()
+	for i, destination := range dests {
+		destination.Normalize()
+		if err := destination.Validate(); err != nil {
+			errs[i] = err
+			continue
+		}
+		id := getDestinationCollectionID(destination)
+		pairs = append(pairs, bson.M{"_id": id, "destination.destination-org-id": destination.DestOrgID},
+			destinationObject{ID: id, Destination: destination, LastConnected: now})
+		upserted = append(upserted, i)
+	}
+	if len(upserted) == 0 {
+		return errs, nil
+	}
+
+	if err := store.upsertAll(destinations, pairs); err != nil {
+		bulkErr, ok := err.(*mgo.BulkError)
+		if !ok {
+			return nil, &Error{fmt.Sprintf("Failed to store the destinations. Error: %s.", err)}
+		}
+		for _, bulkCase := range bulkErr.Cases() {
+			if bulkCase.Index >= 0 && bulkCase.Index < len(upserted) {
+				errs[upserted[bulkCase.Index]] = &Error{fmt.Sprintf("Failed to store a destination. Error: %s.", bulkCase.Err)}
+			}
+		}
+	}
+	return errs, nil
+}
+
+// RegisterDestination stores the destination when it registers or sends a heartbeat, and records the current time
+// as the destination's last ping and connection times
+func (store *MongoStorage) RegisterDestination(destination common.Destination) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	destination.Normalize()
+	if err := destination.Validate(); err != nil {
+		return err
+	}
+	id := getDestinationCollectionID(destination)
+	err := store.upsert(destinations, bson.M{"_id": id, "destination.destination-org-id": destination.DestOrgID},
+		bson.M{
+			"$set":         bson.M{"destination": destination, "last-connected": time.Now()},
+			"$currentDate": bson.M{"last-ping-time": bson.M{"$type": "timestamp"}},
+		})
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to register a destination. Error: %s.", err)}
+	}
+	return nil
+}
+
 // DeleteDestination deletes the destination
 func (store *MongoStorage) DeleteDestination(orgID string, destType string, destID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	id := createDestinationCollectionID(orgID, destType, destID)
 	if err := store.removeAll(destinations, bson.M{"_id": id}); err != nil {
 		return &Error{fmt.Sprintf("Failed to delete destination. Error: %s.", err)}
@@ -1401,8 +2895,50 @@ func (store *MongoStorage) DeleteDestination(orgID string, destType string, dest
 	return nil
 }
 
+// DecommissionDestination removes the destination from the destinations lists of all the objects,
+// and deletes its notifications and the destination itself
+func (store *MongoStorage) DecommissionDestination(orgID string, destType string, destID string) (*common.DecommissionedDestination, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return nil, err
+	}
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	destination := bson.M{"destination.destination-org-id": orgID, "destination.destination-type": destType,
+		"destination.destination-id": destID}
+	result := &common.DecommissionedDestination{}
+
+	var err error
+	result.ObjectsUpdated, err = store.updateAll(objects,
+		bson.M{"metadata.destination-org-id": orgID, "destinations": bson.M{"$elemMatch": destination}},
+		bson.M{
+			"$pull":        bson.M{"destinations": destination},
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to remove the destination from the objects' destinations. Error: %s.", err)}
+	}
+
+	result.NotificationsDeleted, err = store.removeAllAndCount(notifications,
+		bson.M{"notification.destination-org-id": orgID, "notification.destination-type": destType,
+			"notification.destination-id": destID})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to delete the destination's notifications. Error: %s.", err)}
+	}
+
+	removed, err := store.removeAllAndCount(destinations, bson.M{"_id": createDestinationCollectionID(orgID, destType, destID)})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to delete destination. Error: %s.", err)}
+	}
+	result.DestinationDeleted = removed > 0
+
+	return result, nil
+}
+
 // UpdateDestinationLastPingTime updates the last ping time for the destination
 func (store *MongoStorage) UpdateDestinationLastPingTime(destination common.Destination) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	destination.Normalize()
 	id := getDestinationCollectionID(destination)
 	err := store.update(destinations,
 		bson.M{"_id": id},
@@ -1418,6 +2954,38 @@ func (store *MongoStorage) UpdateDestinationLastPingTime(destination common.Dest
 	return nil
 }
 
+// updateDestinationLastConnected records that the destination has just connected
+func (store *MongoStorage) updateDestinationLastConnected(orgID string, destType string, destID string) {
+	if destType == "" || destID == "" {
+		return
+	}
+	id := createDestinationCollectionID(orgID, destType, destID)
+	err := store.update(destinations, bson.M{"_id": id}, bson.M{"$set": bson.M{"last-connected": time.Now()}})
+	if err != nil && err != mgo.ErrNotFound && log.IsLogging(logger.ERROR) {
+		log.Error("Error in mongoStorage.updateDestinationLastConnected: failed to update the destination. Error: %s\n", err)
+	}
+}
+
+// RetrieveOfflineDestinations returns the destinations of the organization that haven't connected for the provided duration
+func (store *MongoStorage) RetrieveOfflineDestinations(orgID string, idleFor time.Duration) ([]common.Destination, common.SyncServiceError) {
+	result := []destinationObject{}
+	query := bson.M{"destination.destination-org-id": orgID,
+		"$or": []bson.M{
+			bson.M{"last-connected": bson.M{"$lt": time.Now().Add(-idleFor)}},
+			bson.M{"last-connected": bson.M{"$exists": false}},
+		}}
+	if err := store.fetchAll(destinations, query, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destinations. Error: %s.", err)}
+	}
+
+	dests := make([]common.Destination, len(result))
+	for i, r := range result {
+		dests[i] = r.Destination
+		dests[i].LastConnected = r.LastConnected
+	}
+	return dests, nil
+}
+
 // RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 func (store *MongoStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {
 	timestamp, err := bson.NewMongoTimestamp(lastTimestamp, 1)
@@ -1455,6 +3023,7 @@ func (store *MongoStorage) GetNumberOfDestinations() (uint32, common.SyncService
 
 // RetrieveDestinationProtocol retrieves the communication protocol for the destination
 func (store *MongoStorage) RetrieveDestinationProtocol(orgID string, destType string, destID string) (string, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	result := destinationObject{}
 	id := createDestinationCollectionID(orgID, destType, destID)
 	if err := store.fetchOne(destinations, bson.M{"_id": id}, nil, &result); err != nil {
@@ -1465,6 +3034,7 @@ func (store *MongoStorage) RetrieveDestinationProtocol(orgID string, destType st
 
 // RetrieveDestination retrieves a destination
 func (store *MongoStorage) RetrieveDestination(orgID string, destType string, destID string) (*common.Destination, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	result := destinationObject{}
 	id := createDestinationCollectionID(orgID, destType, destID)
 	if err := store.fetchOne(destinations, bson.M{"_id": id}, nil, &result); err != nil {
@@ -1478,6 +3048,7 @@ func (store *MongoStorage) RetrieveDestination(orgID string, destType string, de
 
 // GetObjectsForDestination retrieves objects that are in use on a given node
 func (store *MongoStorage) GetObjectsForDestination(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
 	notificationRecords := []notificationObject{}
 	query := bson.M{"$or": []bson.M{
 		bson.M{"notification.status": common.Update},
@@ -1511,14 +3082,59 @@ func (store *MongoStorage) GetObjectsForDestination(orgID string, destType strin
 		case common.Error:
 			status = common.Error
 		}
-		objectStatus := common.ObjectStatus{OrgID: orgID, ObjectType: n.Notification.ObjectType, ObjectID: n.Notification.ObjectID, Status: status}
-		objectStatuses = append(objectStatuses, objectStatus)
+		objectStatus := common.ObjectStatus{OrgID: orgID, ObjectType: n.Notification.ObjectType, ObjectID: n.Notification.ObjectID, Status: status}
+		objectStatuses = append(objectStatuses, objectStatus)
+	}
+	return objectStatuses, nil
+}
+
+// RetrieveObjectsForDestination retrieves the meta data and status of the objects that are in use on a given node.
+// If status is not empty, only objects with the given status are returned.
+func (store *MongoStorage) RetrieveObjectsForDestination(orgID string, destType string, destID string, status string) ([]common.ObjectStatusWithMetaData, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	notificationRecords := []notificationObject{}
+	query := bson.M{"notification.status": bson.M{"$in": []string{common.Update, common.UpdatePending, common.Updated,
+		common.ReceivedByDestination, common.ConsumedByDestination, common.Error}},
+		"notification.destination-org-id": orgID,
+		"notification.destination-id":     destID,
+		"notification.destination-type":   destType}
+	if err := store.fetchAll(notifications, query, nil, &notificationRecords); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the notifications. Error: %s.", err)}
+	}
+
+	statuses := make(map[string]string, len(notificationRecords))
+	ids := make([]string, 0, len(notificationRecords))
+	for _, n := range notificationRecords {
+		objectStatus := destinationObjectStatus(n.Notification.Status)
+		if status != "" && objectStatus != status {
+			continue
+		}
+		id := createObjectCollectionID(orgID, n.Notification.ObjectType, n.Notification.ObjectID)
+		statuses[id] = objectStatus
+		ids = append(ids, id)
 	}
-	return objectStatuses, nil
+
+	result := make([]common.ObjectStatusWithMetaData, 0, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	objectRecords := []object{}
+	selector := bson.M{"metadata": bson.ElementDocument}
+	if err := store.fetchAll(objects, bson.M{"_id": bson.M{"$in": ids}}, selector, &objectRecords); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the objects. Error: %s.", err)}
+	}
+	for _, o := range objectRecords {
+		result = append(result, common.ObjectStatusWithMetaData{MetaData: o.MetaData, Status: statuses[o.ID]})
+	}
+	return result, nil
 }
 
 // RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and the destination status
 func (store *MongoStorage) RetrieveAllObjectsAndUpdateDestinationListForDestination(destOrgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return nil, err
+	}
 	result := []object{}
 
 	query := bson.M{}
@@ -1575,16 +3191,29 @@ func (store *MongoStorage) RetrieveObjectAndRemovedDestinationPolicyServices(org
 
 // UpdateRemovedDestinationPolicyServices update the removedDestinationPolicyServices, only for ESS
 func (store *MongoStorage) UpdateRemovedDestinationPolicyServices(orgID string, objectType string, objectID string, destinationPolicyServices []common.ServiceID) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // UpdateNotificationRecord updates/adds a notification record to the object
 func (store *MongoStorage) UpdateNotificationRecord(notification common.Notification) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	id := getNotificationCollectionID(&notification)
 	if notification.ResendTime == 0 {
-		resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
-		notification.ResendTime = resendTime
+		existing := notificationObject{}
+		if err := store.fetchOne(notifications, bson.M{"_id": id}, nil, &existing); err == nil {
+			scheduleNotificationResend(&notification, &existing.Notification)
+		} else if err == mgo.ErrNotFound {
+			scheduleNotificationResend(&notification, nil)
+		} else {
+			return &Error{fmt.Sprintf("Failed to fetch the notification. Error: %s.", err)}
+		}
 	}
+	notification.LastUpdate = time.Now().Unix()
 	n := notificationObject{ID: id, Notification: notification}
 	err := store.upsert(notifications,
 		bson.M{
@@ -1600,14 +3229,83 @@ func (store *MongoStorage) UpdateNotificationRecord(notification common.Notifica
 	return nil
 }
 
-// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+// UpdateNotificationRecords updates/adds the notification records, for example the notifications of an object
+// to all its destinations, in as few writes as the storage allows
+func (store *MongoStorage) UpdateNotificationRecords(records []common.Notification) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	ids := make([]string, len(records))
+	for i := range records {
+		ids[i] = getNotificationCollectionID(&records[i])
+	}
+	result := []notificationObject{}
+	if err := store.fetchAll(notifications, bson.M{"_id": bson.M{"$in": ids}}, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to fetch the notifications. Error: %s.", err)}
+	}
+	existing := make(map[string]*common.Notification, len(result))
+	for i := range result {
+		existing[result[i].ID] = &result[i].Notification
+	}
+
+	pairs := make([]interface{}, 0, 2*len(records))
+	for _, notification := range records {
+		id := getNotificationCollectionID(&notification)
+		scheduleNotificationResend(&notification, existing[id])
+		notification.LastUpdate = time.Now().Unix()
+		selector := bson.M{
+			"_id":                             id,
+			"notification.destination-org-id": notification.DestOrgID,
+			"notification.destination-id":     notification.DestID,
+			"notification.destination-type":   notification.DestType,
+		}
+		pairs = append(pairs, selector, notificationObject{ID: id, Notification: notification})
+	}
+	if err := store.upsertAll(notifications, pairs); err != nil {
+		return &Error{fmt.Sprintf("Failed to update notification records. Error: %s.", err)}
+	}
+	return nil
+}
+
+// UpdateNotificationResendTime increments the resend attempts of the notification and sets its resend time
+// according to the number of attempts (see common.GetNotificationResendInterval)
 func (store *MongoStorage) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	id := getNotificationCollectionID(&notification)
-	resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
-	if err := store.update(notifications, bson.M{"_id": id}, bson.M{"$set": bson.M{"notification.resend-time": resendTime}}); err != nil {
-		return &Error{fmt.Sprintf("Failed to update notification resend time. Error: %s.", err)}
+	result := notificationObject{}
+	for i := 0; i < maxUpdateTries; i++ {
+		if err := store.fetchOne(notifications, bson.M{"_id": id}, bson.M{"notification.resend-attempts": bson.ElementInt32},
+			&result); err != nil {
+			return &Error{fmt.Sprintf("Failed to update notification resend time. Error: %s.", err)}
+		}
+		attempts := result.Notification.ResendAttempts
+		resendTime := time.Now().Unix() + common.GetNotificationResendInterval(attempts+1)
+		// Notifications stored before resend attempts were tracked don't have the field
+		var storedAttempts interface{} = attempts
+		if attempts == 0 {
+			storedAttempts = bson.M{"$in": []interface{}{0, nil}}
+		}
+		if err := store.update(notifications, bson.M{"_id": id, "notification.resend-attempts": storedAttempts},
+			bson.M{
+				"$set": bson.M{"notification.resend-time": resendTime},
+				"$inc": bson.M{"notification.resend-attempts": 1},
+			}); err != nil {
+			if err == mgo.ErrNotFound {
+				updateRetried("UpdateNotificationResendTime")
+				continue
+			}
+			return &Error{fmt.Sprintf("Failed to update notification resend time. Error: %s.", err)}
+		}
+		updateSucceeded("UpdateNotificationResendTime", i)
+		return nil
 	}
-	return nil
+	updateRetriesExhausted("UpdateNotificationResendTime")
+	return &Error{"Failed to update notification resend time."}
 }
 
 // RetrieveNotificationRecord retrieves notification
@@ -1626,6 +3324,9 @@ func (store *MongoStorage) RetrieveNotificationRecord(orgID string, objectType s
 
 // DeleteNotificationRecords deletes notification records to an object
 func (store *MongoStorage) DeleteNotificationRecords(orgID string, objectType string, objectID string, destType string, destID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	var err error
 	if objectType != "" && objectID != "" {
 		if destType != "" && destID != "" {
@@ -1648,8 +3349,31 @@ func (store *MongoStorage) DeleteNotificationRecords(orgID string, objectType st
 	return nil
 }
 
+// PurgeCompletedNotifications deletes the notifications in a completed state that weren't updated for longer than olderThan
+func (store *MongoStorage) PurgeCompletedNotifications(orgID string, olderThan time.Duration) (int, common.SyncServiceError) {
+	cutoff := time.Now().Add(-olderThan).Unix()
+	query := bson.M{
+		"notification.status": bson.M{"$in": completedNotificationStatuses},
+		// Notifications stored before the last update time was recorded don't have it
+		"$or": []bson.M{
+			bson.M{"notification.last-update": bson.M{"$lt": cutoff}},
+			bson.M{"notification.last-update": bson.M{"$exists": false}},
+		},
+	}
+	if orgID != "" {
+		query["notification.destination-org-id"] = orgID
+	}
+	purged, err := store.removeAllAndCount(notifications, query)
+	if err != nil && err != mgo.ErrNotFound {
+		return 0, &Error{fmt.Sprintf("Failed to purge completed notifications. Error: %s.", err)}
+	}
+	return purged, nil
+}
+
 // RetrieveNotifications returns the list of all the notifications that need to be resent to the destination
 func (store *MongoStorage) RetrieveNotifications(orgID string, destType string, destID string, retrieveReceived bool) ([]common.Notification, common.SyncServiceError) {
+	store.updateDestinationLastConnected(orgID, destType, destID)
+
 	result := []notificationObject{}
 	var query bson.M
 	if destType == "" && destID == "" {
@@ -1739,7 +3463,8 @@ func (store *MongoStorage) RetrievePendingNotifications(orgID string, destType s
 
 // InsertInitialLeader inserts the initial leader document if the collection is empty
 func (store *MongoStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
-	doc := leaderDocument{ID: 1, UUID: leaderID, HeartbeatTimeout: common.Configuration.LeadershipTimeout, Version: 1}
+	doc := leaderDocument{ID: 1, UUID: leaderID, HeartbeatTimeout: common.Configuration.LeadershipTimeout, Version: 1,
+		Region: common.Configuration.Region, Priority: common.LeaderPriority()}
 	err := store.insert(leader, doc)
 
 	if err != nil {
@@ -1754,8 +3479,9 @@ func (store *MongoStorage) InsertInitialLeader(leaderID string) (bool, common.Sy
 
 // LeaderPeriodicUpdate does the periodic update of the leader document by the leader
 func (store *MongoStorage) LeaderPeriodicUpdate(leaderID string) (bool, common.SyncServiceError) {
+	// The update fails if another node requested a handoff of the leadership
 	err := store.update(leader,
-		bson.M{"_id": 1, "uuid": leaderID},
+		bson.M{"_id": 1, "uuid": leaderID, "handoff-requested-by": bson.M{"$in": []interface{}{"", nil}}},
 		bson.M{"$currentDate": bson.M{"last-heartbeat-ts": bson.M{"$type": "timestamp"}}},
 	)
 	if err != nil {
@@ -1788,9 +3514,12 @@ func (store *MongoStorage) UpdateLeader(leaderID string, version int64) (bool, c
 		bson.M{
 			"$currentDate": bson.M{"last-heartbeat-ts": bson.M{"$type": "timestamp"}},
 			"$set": bson.M{
-				"uuid":              leaderID,
-				"heartbeat-timeout": common.Configuration.LeadershipTimeout,
-				"version":           version + 1,
+				"uuid":                 leaderID,
+				"heartbeat-timeout":    common.Configuration.LeadershipTimeout,
+				"version":              version + 1,
+				"region":               common.Configuration.Region,
+				"priority":             common.LeaderPriority(),
+				"handoff-requested-by": "",
 			},
 		},
 	)
@@ -1804,6 +3533,35 @@ func (store *MongoStorage) UpdateLeader(leaderID string, version int64) (bool, c
 	return true, nil
 }
 
+// RequestLeaderHandoff asks the leader to hand off the leadership, if its priority is lower than this node's priority
+func (store *MongoStorage) RequestLeaderHandoff(leaderID string, version int64) (bool, common.SyncServiceError) {
+	priority := common.LeaderPriority()
+	if priority == 0 {
+		return false, nil
+	}
+	// The version check prevents requesting a handoff from a leader that has just changed
+	err := store.update(leader,
+		bson.M{
+			"_id":     1,
+			"version": version,
+			"uuid":    bson.M{"$ne": leaderID},
+			"$or": []bson.M{
+				bson.M{"priority": bson.M{"$lt": priority}},
+				bson.M{"priority": bson.M{"$exists": false}},
+			},
+			"handoff-requested-by": bson.M{"$in": []interface{}{"", nil}},
+		},
+		bson.M{"$set": bson.M{"handoff-requested-by": leaderID}},
+	)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			return false, &Error{fmt.Sprintf("Failed to update the document in the syncLeaderElection collection. Error: %s\n", err)}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
 // ResignLeadership causes this sync service to give up the Leadership
 func (store *MongoStorage) ResignLeadership(leaderID string) common.SyncServiceError {
 	timestamp, err := bson.NewMongoTimestamp(time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 1)
@@ -1835,8 +3593,24 @@ func (store *MongoStorage) RetrieveTimeOnServer() (time.Time, error) {
 	return result.LocalTime, err
 }
 
+// IsLeaderAlive returns true if the leader's last heartbeat is within its heartbeat timeout, together with the leader's ID
+func (store *MongoStorage) IsLeaderAlive() (bool, string, common.SyncServiceError) {
+	leaderID, heartbeatTimeout, lastHeartbeat, _, err := store.RetrieveLeader()
+	if err != nil {
+		return false, "", err
+	}
+	timeOnServer, serverErr := store.RetrieveTimeOnServer()
+	if serverErr != nil {
+		return false, leaderID, &Error{fmt.Sprintf("Failed to retrieve the time on the database server. Error: %s", serverErr)}
+	}
+	return !leaderHeartbeatExpired(lastHeartbeat, timeOnServer, heartbeatTimeout), leaderID, nil
+}
+
 // StoreOrgToMessagingGroup inserts organization to messaging groups table
 func (store *MongoStorage) StoreOrgToMessagingGroup(orgID string, messagingGroup string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	object := messagingGroupObject{ID: orgID, GroupName: messagingGroup}
 	err := store.upsert(messagingGroups, bson.M{"_id": orgID}, object)
 	if err != nil {
@@ -1847,6 +3621,9 @@ func (store *MongoStorage) StoreOrgToMessagingGroup(orgID string, messagingGroup
 
 // DeleteOrgToMessagingGroup deletes organization from messaging groups table
 func (store *MongoStorage) DeleteOrgToMessagingGroup(orgID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	if err := store.removeAll(messagingGroups, bson.M{"_id": orgID}); err != nil && err != mgo.ErrNotFound {
 		return err
 	}
@@ -1883,8 +3660,37 @@ func (store *MongoStorage) RetrieveUpdatedMessagingGroups(time time.Time) ([]com
 	return groups, nil
 }
 
+// RetrieveDestinationsInMessagingGroup returns all the destinations of the organizations in the messaging group
+func (store *MongoStorage) RetrieveDestinationsInMessagingGroup(groupName string) ([]common.Destination, common.SyncServiceError) {
+	groups := []messagingGroupObject{}
+	if err := store.fetchAll(messagingGroups, bson.M{"group-name": groupName}, bson.M{"_id": 1}, &groups); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the messaging group. Error: %s.", err)}
+	}
+	if len(groups) == 0 {
+		return make([]common.Destination, 0), nil
+	}
+
+	orgIDs := make([]string, len(groups))
+	for i, group := range groups {
+		orgIDs[i] = group.ID
+	}
+	result := []destinationObject{}
+	if err := store.fetchAll(destinations, bson.M{"destination.destination-org-id": bson.M{"$in": orgIDs}}, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destinations. Error: %s.", err)}
+	}
+
+	dests := make([]common.Destination, len(result))
+	for i, r := range result {
+		dests[i] = r.Destination
+	}
+	return dests, nil
+}
+
 // DeleteOrganization cleans up the storage from all the records associated with the organization
 func (store *MongoStorage) DeleteOrganization(orgID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	if err := store.DeleteOrgToMessagingGroup(orgID); err != nil {
 		return err
 	}
@@ -1901,24 +3707,127 @@ func (store *MongoStorage) DeleteOrganization(orgID string) common.SyncServiceEr
 		return &Error{fmt.Sprintf("Failed to delete ACLs. Error: %s.", err)}
 	}
 
+	if err := store.removeAll(audit, bson.M{"record.org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete the audit log. Error: %s.", err)}
+	}
+
+	if err := store.removeAll(aclGroups, bson.M{"group.org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete ACL groups. Error: %s.", err)}
+	}
+
+	if err := store.removeAll(apiTokens, bson.M{"token.org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete API tokens. Error: %s.", err)}
+	}
+
+	if err := store.removeAll(retentionPolicies, bson.M{"policy.org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete retention policies. Error: %s.", err)}
+	}
+
+	if err := store.removeAll(webhookPolicies, bson.M{"policy.org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete webhook retry policies. Error: %s.", err)}
+	}
+
+	if err := store.removeAll(webhookFailures, bson.M{"failure.org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete webhook failures. Error: %s.", err)}
+	}
+
 	type idstruct struct {
-		ID string `bson:"_id"`
+		ID       string `bson:"_id"`
+		DataFile string `bson:"data-file,omitempty"`
 	}
 	results := []idstruct{}
-	if err := store.fetchAll(objects, bson.M{"metadata.destination-org-id": orgID}, bson.M{"_id": bson.ElementString}, &results); err != nil && err != mgo.ErrNotFound {
+	selector := bson.M{"_id": bson.ElementString, "data-file": bson.ElementString}
+	if err := store.fetchAll(objects, bson.M{"metadata.destination-org-id": orgID}, selector, &results); err != nil && err != mgo.ErrNotFound {
 		return &Error{fmt.Sprintf("Failed to fetch objects to delete. Error: %s.", err)}
 	}
 	for _, result := range results {
 		store.removeFile(result.ID)
+		if result.DataFile != "" {
+			store.removeFile(result.DataFile)
+		}
 	}
 
 	if err := store.removeAll(objects, bson.M{"metadata.destination-org-id": orgID}); err != nil && err != mgo.ErrNotFound {
 		return &Error{fmt.Sprintf("Failed to delete objects. Error: %s.", err)}
 	}
 
+	versions := []objectVersionObject{}
+	if err := store.fetchAll(objectVersions, bson.M{"metadata.destination-org-id": orgID}, bson.M{"has-data": bson.ElementBool}, &versions); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to fetch object versions to delete. Error: %s.", err)}
+	}
+	for _, version := range versions {
+		if version.HasData {
+			store.removeFile(version.ID)
+		}
+	}
+	if err := store.removeAll(objectVersions, bson.M{"metadata.destination-org-id": orgID}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete object versions. Error: %s.", err)}
+	}
+
 	return nil
 }
 
+// ExportOrganization writes all the records associated with the organization to the writer
+func (store *MongoStorage) ExportOrganization(orgID string, w io.Writer) common.SyncServiceError {
+	objectResults := []object{}
+	selector := bson.M{"metadata": bson.ElementDocument, "status": bson.ElementString}
+	if err := store.bulkFetchAll(objects, bson.M{"metadata.destination-org-id": orgID}, selector, &objectResults); err != nil &&
+		err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to fetch objects to export. Error: %s.", err)}
+	}
+	exported := make([]exportedObject, 0, len(objectResults))
+	for _, result := range objectResults {
+		exported = append(exported, exportedObject{MetaData: result.MetaData, Status: result.Status})
+	}
+
+	notificationResults := []notificationObject{}
+	if err := store.bulkFetchAll(notifications, bson.M{"notification.destination-org-id": orgID}, nil, &notificationResults); err != nil &&
+		err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to fetch notifications to export. Error: %s.", err)}
+	}
+	exportedNotifications := make([]common.Notification, 0, len(notificationResults))
+	for _, result := range notificationResults {
+		exportedNotifications = append(exportedNotifications, result.Notification)
+	}
+
+	webhookResults := []webhookObject{}
+	if err := store.fetchAll(webhooks, bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(createOrgIDPrefix(orgID))}}, nil, &webhookResults); err != nil &&
+		err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to fetch webhooks to export. Error: %s.", err)}
+	}
+	hooks := make(map[string][]string)
+	for _, result := range webhookResults {
+		if parts, err := common.ParseCompositeID(result.ID); err == nil && len(parts) == 2 {
+			hooks[parts[1]] = result.Hooks
+		}
+	}
+
+	return exportOrganization(store, orgID, w, exported, exportedNotifications, hooks)
+}
+
+// ImportOrganization stores the records of an organization read from an export created by ExportOrganization
+func (store *MongoStorage) ImportOrganization(r io.Reader) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	return importOrganization(store, r)
+}
+
+// ProbeLatency measures the round-trip latency of a ping command to the database, and feeds the result of the probe
+// into the rolling database latency of the health status
+func (store *MongoStorage) ProbeLatency() (time.Duration, common.SyncServiceError) {
+	start := time.Now()
+	result := bson.M{}
+	err := store.run(bson.M{"ping": 1}, &result)
+	latency := time.Since(start)
+	if err != nil {
+		common.HealthStatus.DBLatencyProbed(latency, err)
+		return latency, err
+	}
+	common.HealthStatus.DBLatencyProbed(latency, nil)
+	return latency, nil
+}
+
 // IsConnected returns false if the storage cannont be reached, and true otherwise
 func (store *MongoStorage) IsConnected() bool {
 	return store.connected
@@ -1927,6 +3836,9 @@ func (store *MongoStorage) IsConnected() bool {
 // StoreOrganization stores organization information
 // Returns the stored record timestamp for multiple CSS updates
 func (store *MongoStorage) StoreOrganization(org common.Organization) (time.Time, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return time.Time{}, err
+	}
 	object := organizationObject{ID: org.OrgID, Organization: org}
 	err := store.upsert(organizations, bson.M{"_id": org.OrgID}, object)
 	if err != nil {
@@ -1954,6 +3866,9 @@ func (store *MongoStorage) RetrieveOrganizationInfo(orgID string) (*common.Store
 
 // DeleteOrganizationInfo deletes organization information
 func (store *MongoStorage) DeleteOrganizationInfo(orgID string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	if err := store.removeAll(organizations, bson.M{"_id": orgID}); err != nil && err != mgo.ErrNotFound {
 		return err
 	}
@@ -1962,15 +3877,29 @@ func (store *MongoStorage) DeleteOrganizationInfo(orgID string) common.SyncServi
 
 // RetrieveOrganizations retrieves stored organizations' info
 func (store *MongoStorage) RetrieveOrganizations() ([]common.StoredOrganization, common.SyncServiceError) {
+	orgs, _, err := store.RetrieveOrganizationsPage(0, 0)
+	return orgs, err
+}
+
+// RetrieveOrganizationsPage retrieves up to limit stored organizations' info, ordered by organization ID,
+// skipping the first offset organizations
+func (store *MongoStorage) RetrieveOrganizationsPage(offset int, limit int) ([]common.StoredOrganization, int, common.SyncServiceError) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, &common.InvalidRequest{Message: "Offset and limit must be non-negative numbers"}
+	}
+	total, err := store.count(organizations, nil)
+	if err != nil {
+		return nil, 0, err
+	}
 	result := []organizationObject{}
-	if err := store.fetchAll(organizations, nil, nil, &result); err != nil {
-		return nil, err
+	if err := store.fetchPage(organizations, nil, nil, []string{"_id"}, offset, limit, &result); err != nil {
+		return nil, 0, err
 	}
-	orgs := make([]common.StoredOrganization, 0)
+	orgs := make([]common.StoredOrganization, 0, len(result))
 	for _, org := range result {
 		orgs = append(orgs, common.StoredOrganization{Org: org.Organization, Timestamp: org.LastUpdate.Time()})
 	}
-	return orgs, nil
+	return orgs, int(total), nil
 }
 
 // RetrieveUpdatedOrganizations retrieves organizations that were updated after the specified time
@@ -1992,14 +3921,28 @@ func (store *MongoStorage) RetrieveUpdatedOrganizations(time time.Time) ([]commo
 
 // AddUsersToACL adds users to an ACL
 func (store *MongoStorage) AddUsersToACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	return store.addUsersToACLHelper(acls, aclType, orgID, key, users)
 }
 
 // RemoveUsersFromACL removes users from an ACL
 func (store *MongoStorage) RemoveUsersFromACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
 	return store.removeUsersFromACLHelper(acls, aclType, orgID, key, users)
 }
 
+// SetACL replaces the users of an ACL with the provided users, an empty list of users deletes the ACL
+func (store *MongoStorage) SetACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	return store.setACLHelper(acls, aclType, orgID, key, users)
+}
+
 // RetrieveACL retrieves the list of usernames on an ACL
 func (store *MongoStorage) RetrieveACL(aclType string, orgID string, key string, aclUserType string) ([]common.ACLentry, common.SyncServiceError) {
 	return store.retrieveACLHelper(acls, aclType, orgID, key, aclUserType)
@@ -2015,6 +3958,187 @@ func (store *MongoStorage) RetrieveObjOrDestTypeForGivenACLUser(aclType string,
 	return store.retrieveObjOrDestTypeForGivenACLUserHelper(acls, aclType, orgID, aclUserType, aclUsername, aclRole)
 }
 
+// NormalizeACLUsernames rewrites the stored ACLs with normalized usernames, merging the entries of the same user.
+// Returns the number of the modified ACLs.
+func (store *MongoStorage) NormalizeACLUsernames() (int, common.SyncServiceError) {
+	if err := store.checkWritable(); err != nil {
+		return 0, err
+	}
+	return store.normalizeACLUsernamesHelper(acls)
+}
+
+// CheckACL returns true if the user is granted access by the ACL of the key or by the ACL of all the keys,
+// either directly, by a wildcard entry, or by the membership in a group
+func (store *MongoStorage) CheckACL(aclType string, orgID string, key string, username string) (bool, common.SyncServiceError) {
+	return checkACL(store, aclType, orgID, key, username)
+}
+
+// StoreACLGroup stores an ACL group, replacing its members if it already exists
+func (store *MongoStorage) StoreACLGroup(group common.ACLGroup) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := validateACLGroup(group); err != nil {
+		return err
+	}
+	id := createACLGroupID(group.OrgID, group.Name)
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing the ACL group %s\n", id)
+	}
+	if err := store.upsert(aclGroups, bson.M{"_id": id}, aclGroupObject{ID: id, Group: group}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store an ACL group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveACLGroup retrieves an ACL group, returns nil if the group doesn't exist
+func (store *MongoStorage) RetrieveACLGroup(orgID string, name string) (*common.ACLGroup, common.SyncServiceError) {
+	result := aclGroupObject{}
+	if err := store.fetchOne(aclGroups, bson.M{"_id": createACLGroupID(orgID, name)}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to fetch an ACL group. Error: %s.", err)}
+	}
+	return &result.Group, nil
+}
+
+// RetrieveACLGroups retrieves the ACL groups of an organization
+func (store *MongoStorage) RetrieveACLGroups(orgID string) ([]common.ACLGroup, common.SyncServiceError) {
+	result := []aclGroupObject{}
+	if err := store.fetchAll(aclGroups, bson.M{"group.org-id": orgID}, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch ACL groups. Error: %s.", err)}
+	}
+	groups := make([]common.ACLGroup, 0, len(result))
+	for _, r := range result {
+		groups = append(groups, r.Group)
+	}
+	return groups, nil
+}
+
+// DeleteACLGroup deletes an ACL group
+func (store *MongoStorage) DeleteACLGroup(orgID string, name string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := store.removeAll(aclGroups, bson.M{"_id": createACLGroupID(orgID, name)}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete an ACL group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// StoreRetentionPolicy stores the retention policy of an object type, replacing the existing policy of the type
+func (store *MongoStorage) StoreRetentionPolicy(policy common.RetentionPolicy) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := validateRetentionPolicy(policy); err != nil {
+		return err
+	}
+	id := common.CreateCompositeID(policy.OrgID, policy.ObjectType)
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing the retention policy of %s:%s\n", policy.OrgID, policy.ObjectType)
+	}
+	if err := store.upsert(retentionPolicies, bson.M{"_id": id}, retentionPolicyObject{ID: id, Policy: policy}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a retention policy. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveRetentionPolicy retrieves the retention policy of an object type, returns nil if the type doesn't have a policy
+func (store *MongoStorage) RetrieveRetentionPolicy(orgID string, objectType string) (*common.RetentionPolicy, common.SyncServiceError) {
+	result := retentionPolicyObject{}
+	if err := store.fetchOne(retentionPolicies, bson.M{"_id": common.CreateCompositeID(orgID, objectType)}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to fetch a retention policy. Error: %s.", err)}
+	}
+	return &result.Policy, nil
+}
+
+// RetrieveRetentionPolicies retrieves the retention policies of an organization,
+// or of all the organizations if orgID is empty
+func (store *MongoStorage) RetrieveRetentionPolicies(orgID string) ([]common.RetentionPolicy, common.SyncServiceError) {
+	var query interface{}
+	if orgID != "" {
+		query = bson.M{"policy.org-id": orgID}
+	}
+	result := []retentionPolicyObject{}
+	if err := store.fetchAll(retentionPolicies, query, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch retention policies. Error: %s.", err)}
+	}
+	policies := make([]common.RetentionPolicy, 0, len(result))
+	for _, r := range result {
+		policies = append(policies, r.Policy)
+	}
+	return policies, nil
+}
+
+// DeleteRetentionPolicy deletes the retention policy of an object type
+func (store *MongoStorage) DeleteRetentionPolicy(orgID string, objectType string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := store.removeAll(retentionPolicies, bson.M{"_id": common.CreateCompositeID(orgID, objectType)}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete a retention policy. Error: %s.", err)}
+	}
+	return nil
+}
+
+// StoreAPIToken stores an API token, replacing it if a token with the same hash already exists
+func (store *MongoStorage) StoreAPIToken(token common.APIToken) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := validateAPIToken(token); err != nil {
+		return err
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing an API token of %s/%s\n", token.OrgID, token.Identity)
+	}
+	if err := store.upsert(apiTokens, bson.M{"_id": token.Hash}, apiTokenObject{ID: token.Hash, Token: token}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store an API token. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveAPIToken retrieves the API token with the given hash, returns nil if the token doesn't exist
+func (store *MongoStorage) RetrieveAPIToken(hash string) (*common.APIToken, common.SyncServiceError) {
+	result := apiTokenObject{}
+	if err := store.fetchOne(apiTokens, bson.M{"_id": hash}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to fetch an API token. Error: %s.", err)}
+	}
+	return &result.Token, nil
+}
+
+// RetrieveAPITokens retrieves the API tokens of an organization
+func (store *MongoStorage) RetrieveAPITokens(orgID string) ([]common.APIToken, common.SyncServiceError) {
+	result := []apiTokenObject{}
+	if err := store.fetchAll(apiTokens, bson.M{"token.org-id": orgID}, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch API tokens. Error: %s.", err)}
+	}
+	tokens := make([]common.APIToken, 0, len(result))
+	for _, r := range result {
+		tokens = append(tokens, r.Token)
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes the API token with the given hash, the token can't be used after it is revoked
+func (store *MongoStorage) RevokeAPIToken(hash string) common.SyncServiceError {
+	if err := store.checkWritable(); err != nil {
+		return err
+	}
+	if err := store.removeAll(apiTokens, bson.M{"_id": hash}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to revoke an API token. Error: %s.", err)}
+	}
+	return nil
+}
+
 // IsPersistent returns true if the storage is persistent, and false otherwise
 func (store *MongoStorage) IsPersistent() bool {
 	return true
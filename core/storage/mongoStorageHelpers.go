@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,15 +15,314 @@ import (
 	"github.com/open-horizon/edge-utilities/logger/trace"
 )
 
-func (store *MongoStorage) getSession() *mgo.Session {
+// cachedSession is a copy of the database session in the session cache
+type cachedSession struct {
+	session  *mgo.Session
+	inUse    int
+	lastUsed time.Time
+}
+
+// getSession returns a session to use for a database operation and its index in the session cache.
+// An idle cached session is preferred (a cache hit). If all the cached sessions are busy, the cache grows
+// by a new session copy up to MongoSessionCacheMaxSize sessions, after that the busy sessions are shared
+// in a round robin manner (both are cache misses).
+// The index is -1 if the session cache isn't used, otherwise the session must be released with releaseSession.
+func (store *MongoStorage) getSession() (*mgo.Session, int) {
+	if store.cacheMaxSize < 2 {
+		return store.session, -1
+	}
+	store.lock()
+	defer store.unLock()
+
+	if len(store.sessionCache) == 0 {
+		// The store was stopped
+		return store.session, -1
+	}
+
+	size := len(store.sessionCache)
+	for i := 0; i < size; i++ {
+		index := (store.cacheIndex + i) % size
+		if store.sessionCache[index].inUse == 0 {
+			store.cacheIndex = (index + 1) % size
+			store.sessionCache[index].inUse++
+			common.HealthStatus.SessionCacheUsed(true)
+			return store.sessionCache[index].session, index
+		}
+	}
+
+	common.HealthStatus.SessionCacheUsed(false)
+	if size < store.cacheMaxSize {
+		store.sessionCache = append(store.sessionCache, cachedSession{session: store.session.Copy(), inUse: 1})
+		common.HealthStatus.SessionCacheResized(len(store.sessionCache))
+		return store.sessionCache[size].session, size
+	}
+
+	index := store.cacheIndex
+	store.cacheIndex = (index + 1) % size
+	store.sessionCache[index].inUse++
+	return store.sessionCache[index].session, index
+}
+
+// operationClass is the class of a database operation, which determines its timeout
+type operationClass int
+
+const (
+	// readOperation is an interactive read, limited by MongoReadTimeout
+	readOperation operationClass = iota
+	// writeOperation is a write of individual records, limited by MongoWriteTimeout
+	writeOperation
+	// bulkReadOperation is a read of many records, such as an aggregation or an export, limited by MongoBulkTimeout
+	bulkReadOperation
+	// bulkWriteOperation is a write, update or delete of many records, limited by MongoBulkTimeout
+	bulkWriteOperation
+)
+
+func (class operationClass) isRead() bool {
+	return class == readOperation || class == bulkReadOperation
+}
+
+func (class operationClass) timeout() time.Duration {
+	switch class {
+	case readOperation:
+		return time.Duration(common.Configuration.MongoReadTimeout) * time.Second
+	case writeOperation:
+		return time.Duration(common.Configuration.MongoWriteTimeout) * time.Second
+	default:
+		return time.Duration(common.Configuration.MongoBulkTimeout) * time.Second
+	}
+}
+
+// sessionForOperation returns the session to use for an operation of the class.
+// The sessions are created with the timeout of interactive reads, for an operation with a different timeout
+// a copy of the session with that timeout is returned, and the caller must close it.
+func (store *MongoStorage) sessionForOperation(session *mgo.Session, class operationClass) (*mgo.Session, bool) {
+	timeout := class.timeout()
+	if timeout == store.dialInfo.ReadTimeout {
+		return session, false
+	}
+	session = session.Copy()
+	session.SetSocketTimeout(timeout)
+	return session, true
+}
+
+// getFileSession returns a session for a GridFS file, which remains in use until the file is closed.
+// The session is one of the MongoSessionCacheSize sessions that are never closed by shrinkSessionCache.
+func (store *MongoStorage) getFileSession() *mgo.Session {
 	if store.cacheSize < 2 {
 		return store.session
 	}
 	store.lock()
-	session := store.sessionCache[store.cacheIndex]
-	store.cacheIndex = (store.cacheIndex + 1) % store.cacheSize
-	store.unLock()
-	return session
+	defer store.unLock()
+	if len(store.sessionCache) < store.cacheSize {
+		// The store was stopped
+		return store.session
+	}
+	index := store.cacheIndex % store.cacheSize
+	store.cacheIndex = (index + 1) % len(store.sessionCache)
+	return store.sessionCache[index].session
+}
+
+// releaseSession releases a session returned by getSession
+func (store *MongoStorage) releaseSession(index int) {
+	if index < 0 {
+		return
+	}
+	store.lock()
+	defer store.unLock()
+
+	if index >= len(store.sessionCache) {
+		return
+	}
+	cached := &store.sessionCache[index]
+	if cached.inUse > 0 {
+		cached.inUse--
+	}
+	cached.lastUsed = time.Now()
+	store.shrinkSessionCache()
+}
+
+// shrinkSessionCache closes the session copies that were added to the session cache under load and have been
+// idle for more than MongoSessionCacheIdleTime seconds. The cache never shrinks below MongoSessionCacheSize sessions.
+// Only sessions at the end of the cache are closed, so that the indexes of the sessions in use remain valid.
+// The caller must hold the store lock.
+func (store *MongoStorage) shrinkSessionCache() {
+	size := len(store.sessionCache)
+	if size <= store.cacheSize {
+		return
+	}
+	idleTime := time.Second * time.Duration(common.Configuration.MongoSessionCacheIdleTime)
+	now := time.Now()
+	for size > store.cacheSize {
+		cached := store.sessionCache[size-1]
+		if cached.inUse > 0 || now.Sub(cached.lastUsed) < idleTime {
+			break
+		}
+		cached.session.Close()
+		size--
+		store.sessionCache[size] = cachedSession{}
+	}
+	if size == len(store.sessionCache) {
+		return
+	}
+	store.sessionCache = store.sessionCache[:size]
+	if store.cacheIndex >= size {
+		store.cacheIndex = 0
+	}
+	common.HealthStatus.SessionCacheResized(size)
+}
+
+// probeLatencyPeriodically probes the database latency until the store is stopped.
+// It isn't counted as a running go routine, since it only ends when the store is stopped.
+func (store *MongoStorage) probeLatencyPeriodically(stopChannel chan bool) {
+	defer store.backgroundGo.Done()
+
+	ticker := time.NewTicker(time.Second * time.Duration(common.Configuration.DatabaseLatencyProbeInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := store.ProbeLatency(); err != nil && log.IsLogging(logger.WARNING) {
+				log.Warning("Database latency probe failed. Error: %s", err.Error())
+			}
+		case <-stopChannel:
+			return
+		}
+	}
+}
+
+// watchObjectChanges sends the events read from the change stream of the objects collection until the watch is
+// canceled, the store is stopped, or the change stream fails. It then closes the events channel.
+func (store *MongoStorage) watchObjectChanges(orgID string, session *mgo.Session, changeStream *mgo.ChangeStream,
+	events chan<- common.ObjectEvent, cancelChannel chan bool, stopChannel chan bool) {
+	defer store.backgroundGo.Done()
+	defer session.Close()
+	defer changeStream.Close()
+	defer close(events)
+
+	for {
+		select {
+		case <-cancelChannel:
+			return
+		case <-stopChannel:
+			return
+		default:
+		}
+
+		change := objectChangeEvent{}
+		if !changeStream.Next(&change) {
+			if changeStream.Timeout() {
+				continue
+			}
+			if err := changeStream.Err(); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Stopped watching the objects of %s. Error: %s\n", orgID, err)
+			}
+			return
+		}
+
+		event := common.ObjectEvent{OrgID: orgID}
+		switch change.OperationType {
+		case "insert":
+			event.Type = common.ObjectEventCreated
+		case "update", "replace":
+			event.Type = common.ObjectEventUpdated
+		case "delete":
+			event.Type = common.ObjectEventDeleted
+		default:
+			continue
+		}
+		parts, err := common.ParseCompositeID(change.DocumentKey.ID)
+		if err != nil || len(parts) != 3 {
+			continue
+		}
+		event.ObjectType = parts[1]
+		event.ObjectID = parts[2]
+		if change.FullDocument != nil && event.Type != common.ObjectEventDeleted {
+			metaData := change.FullDocument.MetaData
+			event.MetaData = &metaData
+			event.Status = change.FullDocument.Status
+		}
+
+		select {
+		case events <- event:
+		case <-cancelChannel:
+			return
+		case <-stopChannel:
+			return
+		}
+	}
+}
+
+// connectInBackground periodically tries to connect to the database until it succeeds or the store is stopped.
+// It is used when the store was started without a database connection.
+func (store *MongoStorage) connectInBackground(stopChannel chan bool) {
+	defer store.backgroundGo.Done()
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			session, err := mgo.DialWithInfo(store.dialInfo)
+			if err != nil {
+				if trace.IsLogging(logger.DEBUG) {
+					trace.Debug("Failed to connect to the database in the background. Error: %s\n", err)
+				}
+				continue
+			}
+			if err := store.setUpSession(session); err != nil {
+				if log.IsLogging(logger.ERROR) {
+					log.Error("Failed to set up the database connection. Error: %s", err)
+				}
+				continue
+			}
+			if common.Configuration.DatabaseLatencyProbeInterval > 0 {
+				store.backgroundGo.Add(1)
+				go store.probeLatencyPeriodically(stopChannel)
+			}
+			return
+		case <-stopChannel:
+			return
+		}
+	}
+}
+
+// beginBackgroundOperation registers an operation that Stop has to wait for.
+// It returns false if the store is being stopped, in which case the operation must not be performed.
+func (store *MongoStorage) beginBackgroundOperation() bool {
+	<-store.mapLock
+	defer func() { store.mapLock <- 1 }()
+	if store.stopChannel == nil {
+		return false
+	}
+	store.backgroundGo.Add(1)
+	return true
+}
+
+// isStopped returns true if Stop was called on the store
+func (store *MongoStorage) isStopped() bool {
+	<-store.mapLock
+	defer func() { store.mapLock <- 1 }()
+	return store.stopChannel == nil
+}
+
+// waitForOpenFiles waits until all the open data files are closed, or the timeout expires
+func (store *MongoStorage) waitForOpenFiles(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		<-store.mapLock
+		openFiles := len(store.openFiles)
+		store.mapLock <- 1
+		if openFiles == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			if log.IsLogging(logger.WARNING) {
+				log.Warning("Stopping the storage with %d open data files", openFiles)
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 }
 
 func (store *MongoStorage) checkObjects() {
@@ -35,6 +335,7 @@ func (store *MongoStorage) checkObjects() {
 		"$and": []bson.M{
 			bson.M{"metadata.expiration": bson.M{"$ne": ""}},
 			bson.M{"metadata.expiration": bson.M{"$lte": currentTime}},
+			bson.M{"metadata.pinned": bson.M{"$ne": true}},
 			bson.M{"$or": []bson.M{
 				bson.M{"status": common.NotReadyToSend},
 				bson.M{"status": common.ReadyToSend}}}},
@@ -62,6 +363,194 @@ func (store *MongoStorage) checkObjects() {
 	}
 }
 
+// applyRetentionPolicies removes the objects that weren't updated for longer than the maximal age set by
+// the retention policies of their types
+func (store *MongoStorage) applyRetentionPolicies() {
+	if !store.connected {
+		return
+	}
+
+	policies, err := store.RetrieveRetentionPolicies("")
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in mongoStorage.applyRetentionPolicies: failed to fetch the retention policies. Error: %s\n", err)
+		}
+		return
+	}
+
+	now := time.Now()
+	for _, policy := range policies {
+		if policy.MaxAge <= 0 {
+			continue
+		}
+		before := now.Add(-time.Second * time.Duration(policy.MaxAge))
+		query := bson.M{
+			"metadata.destination-org-id": policy.OrgID,
+			"metadata.object-type":        policy.ObjectType,
+			"metadata.pinned":             bson.M{"$ne": true},
+			"status":                      bson.M{"$in": []string{common.NotReadyToSend, common.ReadyToSend}},
+			"last-update":                 bson.M{"$lt": bson.MongoTimestamp(before.Unix() << 32)},
+		}
+		selector := bson.M{"metadata": bson.ElementDocument, "last-update": bson.ElementTimestamp}
+		result := []object{}
+		if err := store.fetchAll(objects, query, selector, &result); err != nil {
+			if err != mgo.ErrNotFound && log.IsLogging(logger.ERROR) {
+				log.Error("Error in mongoStorage.applyRetentionPolicies: failed to fetch the objects to remove. Error: %s\n", err)
+			}
+			continue
+		}
+
+		for _, object := range result {
+			err := store.deleteObject(object.MetaData.DestOrgID, object.MetaData.ObjectType, object.MetaData.ObjectID, object.LastUpdate)
+			if err == nil {
+				store.DeleteNotificationRecords(object.MetaData.DestOrgID, object.MetaData.ObjectType, object.MetaData.ObjectID, "", "")
+			} else if log.IsLogging(logger.ERROR) {
+				log.Error("Error in mongoStorage.applyRetentionPolicies: failed to remove an object. Error: %s\n", err)
+			}
+		}
+		if len(result) > 0 && trace.IsLogging(logger.TRACE) {
+			trace.Trace("Removed %d objects of %s:%s by their retention policy", len(result), policy.OrgID, policy.ObjectType)
+		}
+	}
+}
+
+// retrieveDataLocation returns the source data URI of the object, the name of the GridFS file of its data,
+// and whether the object has no data (NoData).
+// The data of objects with a source data URI isn't stored in the database.
+func (store *MongoStorage) retrieveDataLocation(id string) (string, string, bool, common.SyncServiceError) {
+	result := object{}
+	selector := bson.M{"metadata.source-data-uri": bson.ElementString, "metadata.no-data": bson.ElementBool,
+		"data-file": bson.ElementString}
+	if err := store.fetchOne(objects, bson.M{"_id": id}, selector, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return "", id, false, nil
+		}
+		return "", "", false, &Error{fmt.Sprintf("Failed to fetch the object. Error: %s.", err)}
+	}
+	return result.MetaData.SourceDataURI, dataFileName(id, result.DataFile), result.MetaData.NoData, nil
+}
+
+// dataFileName returns the name of the GridFS file of the object's data.
+// The file is named as the object's ID, unless the data was replaced by ReplaceObject.
+func dataFileName(id string, dataFile string) string {
+	if dataFile != "" {
+		return dataFile
+	}
+	return id
+}
+
+// setDataComplete sets whether all the data of the object is stored
+func (store *MongoStorage) setDataComplete(id string, complete bool) common.SyncServiceError {
+	if err := store.update(objects, bson.M{"_id": id}, bson.M{"$set": bson.M{"data-complete": complete}}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to update the object's data completion. Error: %s.", err)}
+	}
+	return nil
+}
+
+// releaseReplacedDataFile switches the object back to the data file named as its ID, once its data was written to
+// that file, and removes the file of the data that was written by ReplaceObject
+func (store *MongoStorage) releaseReplacedDataFile(id string) common.SyncServiceError {
+	result := object{}
+	if err := store.fetchOne(objects, bson.M{"_id": id}, bson.M{"data-file": bson.ElementString}, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return &Error{fmt.Sprintf("Failed to fetch the object. Error: %s.", err)}
+	}
+	if result.DataFile == "" {
+		return nil
+	}
+	if err := store.update(objects, bson.M{"_id": id}, bson.M{"$unset": bson.M{"data-file": ""}}); err != nil {
+		return &Error{fmt.Sprintf("Failed to update the object's data file. Error: %s.", err)}
+	}
+	if err := store.removeFile(result.DataFile); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to remove the replaced data file %s. Error: %s\n", result.DataFile, err)
+	}
+	return nil
+}
+
+// storeObjectVersion keeps the current version of the object before it is updated, if versions are kept for its type
+func (store *MongoStorage) storeObjectVersion(id string, orgID string, objectType string) common.SyncServiceError {
+	policy, err := store.RetrieveRetentionPolicy(orgID, objectType)
+	if err != nil {
+		return err
+	}
+	if objectVersionsKept(policy, objectType) == 0 {
+		return nil
+	}
+
+	existingObject := object{}
+	selector := bson.M{"metadata": bson.ElementDocument, "status": bson.ElementString, "data-file": bson.ElementString}
+	if err := store.fetchOne(objects, bson.M{"_id": id}, selector, &existingObject); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return &Error{fmt.Sprintf("Failed to retrieve the object to keep its version. Error: %s.", err)}
+	}
+	metaData := existingObject.MetaData
+	if metaData.Deleted || existingObject.Status == common.ObjDeleted {
+		return nil
+	}
+
+	versionID := createObjectVersionCollectionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.InstanceID)
+	version := objectVersionObject{ID: versionID, MetaData: metaData}
+	if !metaData.NoData {
+		fileHandle, err := store.openFile(dataFileName(id, existingObject.DataFile))
+		if err == nil {
+			_, _, err = store.copyDataToFile(versionID, fileHandle.file, true, true)
+			fileHandle.file.Close()
+			if err != nil {
+				return &Error{fmt.Sprintf("Failed to keep the data of the object's version. Error: %s.", err)}
+			}
+			version.HasData = true
+		} else if err != mgo.ErrNotFound {
+			return &Error{fmt.Sprintf("Failed to open file to keep the data of the object's version. Error: %s.", err)}
+		}
+	}
+
+	if err := store.upsert(objectVersions, bson.M{"_id": versionID}, version); err != nil {
+		return &Error{fmt.Sprintf("Failed to store the object's version. Error: %s.", err)}
+	}
+	return nil
+}
+
+// pruneObjectVersions removes the object versions that exceed the number of versions kept for their object type
+func (store *MongoStorage) pruneObjectVersions() {
+	if !store.connected {
+		return
+	}
+
+	result := []objectVersionObject{}
+	if err := store.fetchAll(objectVersions, nil, nil, &result); err != nil {
+		if err != mgo.ErrNotFound && log.IsLogging(logger.ERROR) {
+			log.Error("Error in mongoStorage.pruneObjectVersions: failed to fetch the object versions. Error: %s\n", err)
+		}
+		return
+	}
+	versions := make([]common.MetaData, len(result))
+	for i, r := range result {
+		versions[i] = r.MetaData
+	}
+	policies, err := store.RetrieveRetentionPolicies("")
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in mongoStorage.pruneObjectVersions: failed to fetch the retention policies. Error: %s\n", err)
+		}
+		return
+	}
+
+	for _, version := range objectVersionsToPrune(versions, policies) {
+		id := createObjectVersionCollectionID(version.DestOrgID, version.ObjectType, version.ObjectID, version.InstanceID)
+		if err := store.removeAll(objectVersions, bson.M{"_id": id}); err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Error in mongoStorage.pruneObjectVersions: failed to remove an object version. Error: %s\n", err)
+			}
+			continue
+		}
+		store.removeFile(id)
+	}
+}
+
 func (store *MongoStorage) deleteObject(orgID string, objectType string, objectID string, timestamp bson.MongoTimestamp) common.SyncServiceError {
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	if trace.IsLogging(logger.TRACE) {
@@ -72,6 +561,10 @@ func (store *MongoStorage) deleteObject(orgID string, objectType string, objectI
 	if timestamp != -1 {
 		query = bson.M{"_id": id, "last-update": timestamp}
 	}
+	_, fileName, _, err := store.retrieveDataLocation(id)
+	if err != nil {
+		return err
+	}
 	if err := store.removeAll(objects, query); err != nil {
 		if err == mgo.ErrNotFound && timestamp != -1 {
 			return nil
@@ -84,6 +577,11 @@ func (store *MongoStorage) deleteObject(orgID string, objectType string, objectI
 			log.Error("Error in deleteStoredObject: failed to delete data file. Error: %s\n", err)
 		}
 	}
+	if fileName != id {
+		if err := store.removeFile(fileName); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in deleteStoredObject: failed to delete the replaced data file. Error: %s\n", err)
+		}
+	}
 	return nil
 }
 
@@ -118,6 +616,16 @@ func (store *MongoStorage) copyDataToFile(id string, dataReader io.Reader, isFir
 	return
 }
 
+// abortFile discards a partially written file
+func (store *MongoStorage) abortFile(id string, fileHandle *fileHandle) {
+	if fileHandle != nil {
+		fileHandle.file.Abort()
+		fileHandle.file.Close()
+	}
+	store.deleteFileHandle(id)
+	store.removeFile(id)
+}
+
 func (store *MongoStorage) storeDataInFile(id string, data []byte) common.SyncServiceError {
 	store.removeFile(id)
 	fileHanlde, err := store.createFile(id)
@@ -171,13 +679,77 @@ func (store *MongoStorage) retrievePolicies(query interface{}) ([]common.ObjectD
 	return objects, nil
 }
 
+// logSlowOperation logs a warning if a storage operation that started at the given time took longer than
+// the configured SlowStorageOperationThreshold
+func logSlowOperation(operation string, collectionName string, query interface{}, start time.Time) {
+	if common.Configuration.SlowStorageOperationThreshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed < time.Duration(common.Configuration.SlowStorageOperationThreshold)*time.Millisecond {
+		return
+	}
+	if log.IsLogging(logger.WARNING) {
+		log.Warning("Slow storage operation: operation=%s collection=%s duration=%dms query=%s",
+			operation, collectionName, elapsed.Nanoseconds()/int64(time.Millisecond), queryFingerprint(query))
+	}
+}
+
+// queryFingerprint returns the shape of a query: its field names and operators, with the values replaced by ?.
+// Queries that differ only in their values have the same fingerprint.
+func queryFingerprint(query interface{}) string {
+	switch q := query.(type) {
+	case nil:
+		return "{}"
+	case bson.M:
+		return mapFingerprint(q)
+	case map[string]interface{}:
+		return mapFingerprint(q)
+	case bson.D:
+		parts := make([]string, 0, len(q))
+		for _, elem := range q {
+			parts = append(parts, elem.Name+":"+queryFingerprint(elem.Value))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	case []bson.M:
+		parts := make([]string, 0, len(q))
+		for _, elem := range q {
+			parts = append(parts, mapFingerprint(elem))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case []interface{}:
+		parts := make([]string, 0, len(q))
+		for _, elem := range q {
+			parts = append(parts, queryFingerprint(elem))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	default:
+		return "?"
+	}
+}
+
+func mapFingerprint(query map[string]interface{}) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+":"+queryFingerprint(query[key]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
 func (store *MongoStorage) removeAll(collectionName string, query interface{}) common.SyncServiceError {
 	function := func(collection *mgo.Collection) error {
+		start := time.Now()
 		_, err := collection.RemoveAll(query)
+		logSlowOperation("removeAll", collectionName, query, start)
 		return err
 	}
 
-	retry, err := store.withCollectionHelper(collectionName, function, false)
+	retry, err := store.withCollectionHelper(collectionName, function, bulkWriteOperation)
 	if err != nil {
 		return err
 	}
@@ -188,28 +760,108 @@ func (store *MongoStorage) removeAll(collectionName string, query interface{}) c
 	return nil
 }
 
+func (store *MongoStorage) removeAllAndCount(collectionName string, query interface{}) (int, common.SyncServiceError) {
+	var removed int
+	function := func(collection *mgo.Collection) error {
+		start := time.Now()
+		info, err := collection.RemoveAll(query)
+		logSlowOperation("removeAll", collectionName, query, start)
+		if info != nil {
+			removed = info.Removed
+		}
+		return err
+	}
+
+	retry, err := store.withCollectionHelper(collectionName, function, bulkWriteOperation)
+	if err != nil {
+		return 0, err
+	}
+
+	if retry {
+		return store.removeAllAndCount(collectionName, query)
+	}
+	return removed, nil
+}
+
 func (store *MongoStorage) fetchAll(collectionName string, query interface{}, selector interface{}, result interface{}) common.SyncServiceError {
+	return store.fetchAllWithClass(collectionName, query, selector, result, readOperation)
+}
+
+// bulkFetchAll fetches all the documents like fetchAll, but with the timeout of bulk operations, for example for exports
+func (store *MongoStorage) bulkFetchAll(collectionName string, query interface{}, selector interface{}, result interface{}) common.SyncServiceError {
+	return store.fetchAllWithClass(collectionName, query, selector, result, bulkReadOperation)
+}
+
+func (store *MongoStorage) fetchAllWithClass(collectionName string, query interface{}, selector interface{}, result interface{},
+	class operationClass) common.SyncServiceError {
+	function := func(collection *mgo.Collection) error {
+		start := time.Now()
+		err := collection.Find(query).Select(selector).SetMaxTime(class.timeout()).All(result)
+		logSlowOperation("fetchAll", collectionName, query, start)
+		return err
+	}
+
+	retry, err := store.withCollectionHelper(collectionName, function, class)
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		return store.fetchAllWithClass(collectionName, query, selector, result, class)
+	}
+	return nil
+}
+
+// fetchPage fetches up to limit documents sorted by the sort fields, skipping the first skip documents.
+// A limit of 0 means no limit.
+func (store *MongoStorage) fetchPage(collectionName string, query interface{}, selector interface{}, sortFields []string,
+	skip int, limit int, result interface{}) common.SyncServiceError {
+	function := func(collection *mgo.Collection) error {
+		start := time.Now()
+		err := collection.Find(query).Select(selector).Sort(sortFields...).Skip(skip).Limit(limit).SetMaxTime(readOperation.timeout()).All(result)
+		logSlowOperation("fetchPage", collectionName, query, start)
+		return err
+	}
+
+	retry, err := store.withCollectionHelper(collectionName, function, readOperation)
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		return store.fetchPage(collectionName, query, selector, sortFields, skip, limit, result)
+	}
+	return nil
+}
+
+func (store *MongoStorage) aggregate(collectionName string, pipeline interface{}, result interface{}) common.SyncServiceError {
 	function := func(collection *mgo.Collection) error {
-		return collection.Find(query).Select(selector).All(result)
+		start := time.Now()
+		err := collection.Pipe(pipeline).SetMaxTime(bulkReadOperation.timeout()).All(result)
+		logSlowOperation("aggregate", collectionName, pipeline, start)
+		return err
 	}
 
-	retry, err := store.withCollectionHelper(collectionName, function, true)
+	retry, err := store.withCollectionHelper(collectionName, function, bulkReadOperation)
 	if err != nil {
 		return err
 	}
 
 	if retry {
-		return store.fetchAll(collectionName, query, selector, result)
+		return store.aggregate(collectionName, pipeline, result)
 	}
 	return nil
 }
 
 func (store *MongoStorage) fetchOne(collectionName string, query interface{}, selector interface{}, result interface{}) common.SyncServiceError {
 	function := func(collection *mgo.Collection) error {
-		return collection.Find(query).Select(selector).One(result)
+		start := time.Now()
+		err := collection.Find(query).Select(selector).SetMaxTime(readOperation.timeout()).One(result)
+		logSlowOperation("fetchOne", collectionName, query, start)
+		return err
 	}
 
-	retry, err := store.withCollectionHelper(collectionName, function, true)
+	retry, err := store.withCollectionHelper(collectionName, function, readOperation)
 	if err != nil {
 		return err
 	}
@@ -222,10 +874,13 @@ func (store *MongoStorage) fetchOne(collectionName string, query interface{}, se
 
 func (store *MongoStorage) update(collectionName string, selector interface{}, update interface{}) common.SyncServiceError {
 	function := func(collection *mgo.Collection) error {
-		return collection.Update(selector, update)
+		start := time.Now()
+		err := collection.Update(selector, update)
+		logSlowOperation("update", collectionName, selector, start)
+		return err
 	}
 
-	retry, err := store.withCollectionHelper(collectionName, function, false)
+	retry, err := store.withCollectionHelper(collectionName, function, writeOperation)
 	if err != nil {
 		return err
 	}
@@ -236,13 +891,59 @@ func (store *MongoStorage) update(collectionName string, selector interface{}, u
 	return nil
 }
 
+// findAndUpdate updates the document and returns the selected fields of the document before the update
+func (store *MongoStorage) findAndUpdate(collectionName string, query interface{}, selector interface{}, update interface{},
+	result interface{}) common.SyncServiceError {
+	function := func(collection *mgo.Collection) error {
+		start := time.Now()
+		_, err := collection.Find(query).Select(selector).Apply(mgo.Change{Update: update}, result)
+		logSlowOperation("findAndUpdate", collectionName, query, start)
+		return err
+	}
+
+	retry, err := store.withCollectionHelper(collectionName, function, writeOperation)
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		return store.findAndUpdate(collectionName, query, selector, update, result)
+	}
+	return nil
+}
+
+func (store *MongoStorage) updateAll(collectionName string, selector interface{}, update interface{}) (int, common.SyncServiceError) {
+	var updated int
+	function := func(collection *mgo.Collection) error {
+		start := time.Now()
+		info, err := collection.UpdateAll(selector, update)
+		logSlowOperation("updateAll", collectionName, selector, start)
+		if info != nil {
+			updated = info.Updated
+		}
+		return err
+	}
+
+	retry, err := store.withCollectionHelper(collectionName, function, bulkWriteOperation)
+	if err != nil {
+		return 0, err
+	}
+
+	if retry {
+		return store.updateAll(collectionName, selector, update)
+	}
+	return updated, nil
+}
+
 func (store *MongoStorage) upsert(collectionName string, selector interface{}, update interface{}) common.SyncServiceError {
 	function := func(collection *mgo.Collection) error {
+		start := time.Now()
 		_, err := collection.Upsert(selector, update)
+		logSlowOperation("upsert", collectionName, selector, start)
 		return err
 	}
 
-	retry, err := store.withCollectionHelper(collectionName, function, false)
+	retry, err := store.withCollectionHelper(collectionName, function, writeOperation)
 	if err != nil {
 		return err
 	}
@@ -253,12 +954,35 @@ func (store *MongoStorage) upsert(collectionName string, selector interface{}, u
 	return nil
 }
 
+// upsertAll upserts the documents in a single bulk operation, pairs holds the selector and the document of each upsert
+func (store *MongoStorage) upsertAll(collectionName string, pairs []interface{}) common.SyncServiceError {
+	function := func(collection *mgo.Collection) error {
+		start := time.Now()
+		bulk := collection.Bulk()
+		bulk.Unordered()
+		bulk.Upsert(pairs...)
+		_, err := bulk.Run()
+		logSlowOperation("upsertAll", collectionName, pairs[0], start)
+		return err
+	}
+
+	retry, err := store.withCollectionHelper(collectionName, function, bulkWriteOperation)
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		return store.upsertAll(collectionName, pairs)
+	}
+	return nil
+}
+
 func (store *MongoStorage) insert(collectionName string, doc interface{}) common.SyncServiceError {
 	function := func(collection *mgo.Collection) error {
 		return collection.Insert(doc)
 	}
 
-	retry, err := store.withCollectionHelper(collectionName, function, false)
+	retry, err := store.withCollectionHelper(collectionName, function, writeOperation)
 	if err != nil {
 		return err
 	}
@@ -273,12 +997,14 @@ func (store *MongoStorage) count(collectionName string, selector interface{}) (u
 	var count uint32
 	function := func(collection *mgo.Collection) error {
 		var err error
-		countInt, err := collection.Find(selector).Count()
+		start := time.Now()
+		countInt, err := collection.Find(selector).SetMaxTime(readOperation.timeout()).Count()
+		logSlowOperation("count", collectionName, selector, start)
 		count = uint32(countInt)
 		return err
 	}
 
-	retry, err := store.withCollectionHelper(collectionName, function, true)
+	retry, err := store.withCollectionHelper(collectionName, function, readOperation)
 	if err != nil {
 		return 0, err
 	}
@@ -289,12 +1015,136 @@ func (store *MongoStorage) count(collectionName string, selector interface{}) (u
 	return count, nil
 }
 
+// gridFS returns the GridFS in which the data of objects is stored
+func (store *MongoStorage) gridFS(db *mgo.Database) *mgo.GridFS {
+	return db.Session.DB(dataDbName()).GridFS(store.gridFSPrefix)
+}
+
+// dataDbName returns the name of the database in which the data of objects is stored
+func dataDbName() string {
+	if common.Configuration.MongoDataDbName != "" {
+		return common.Configuration.MongoDataDbName
+	}
+	return common.Configuration.MongoDbName
+}
+
+// separateDataDb returns true if the data of objects is stored in a different database than their meta data
+func separateDataDb() bool {
+	return dataDbName() != common.Configuration.MongoDbName
+}
+
+// databaseName returns the name of the database of the collection, the GridFS collections are in the data database
+func (store *MongoStorage) databaseName(collectionName string) string {
+	if strings.HasPrefix(collectionName, store.gridFSPrefix+".") {
+		return dataDbName()
+	}
+	return common.Configuration.MongoDbName
+}
+
+// Maximal number of file names looked up in the data database by a single query
+const dataFileLookupBatchSize = 1000
+
+// dataFileLengths returns the lengths of the stored GridFS files with the given names, by file name.
+// Files that aren't stored are not in the returned map.
+func (store *MongoStorage) dataFileLengths(names []string) (map[string]int64, common.SyncServiceError) {
+	lengths := make(map[string]int64, len(names))
+	for start := 0; start < len(names); start += dataFileLookupBatchSize {
+		end := start + dataFileLookupBatchSize
+		if end > len(names) {
+			end = len(names)
+		}
+		files := []struct {
+			Name   string `bson:"filename"`
+			Length int64  `bson:"length"`
+		}{}
+		if err := store.fetchAllWithClass(store.gridFSPrefix+".files", bson.M{"filename": bson.M{"$in": names[start:end]}},
+			bson.M{"filename": 1, "length": 1}, &files, bulkReadOperation); err != nil {
+			return nil, &Error{fmt.Sprintf("Failed to look up the data files. Error: %s.", err)}
+		}
+		for _, file := range files {
+			lengths[file.Name] += file.Length
+		}
+	}
+	return lengths, nil
+}
+
+// retrieveStorageStatsByTypeFromDataDb returns the storage stats of the objects of the organization, per object type,
+// when their data is stored in a separate database. The files of the objects are looked up in the data database.
+func (store *MongoStorage) retrieveStorageStatsByTypeFromDataDb(orgID string) (map[string]common.ObjectTypeStorageStats,
+	common.SyncServiceError) {
+	pipeline := []bson.M{
+		bson.M{"$match": bson.M{"metadata.destination-org-id": orgID}},
+		bson.M{"$project": bson.M{
+			"type":      "$metadata.object-type",
+			"size":      "$metadata.object-size",
+			"data-file": bson.M{"$ifNull": []interface{}{"$data-file", "$_id"}},
+		}},
+	}
+	result := []struct {
+		ObjectType string `bson:"type"`
+		Size       int64  `bson:"size"`
+		DataFile   string `bson:"data-file"`
+	}{}
+	if err := store.aggregate(objects, pipeline, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to aggregate the storage stats of the objects. Error: %s.", err)}
+	}
+
+	names := make([]string, len(result))
+	for i, r := range result {
+		names[i] = r.DataFile
+	}
+	lengths, err := store.dataFileLengths(names)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]common.ObjectTypeStorageStats)
+	for _, r := range result {
+		typeStats := stats[r.ObjectType]
+		typeStats.ObjectType = r.ObjectType
+		typeStats.ObjectCount++
+		typeStats.ObjectSize += r.Size
+		typeStats.StoredDataSize += lengths[r.DataFile]
+		stats[r.ObjectType] = typeStats
+	}
+	return stats, nil
+}
+
+// retrieveObjectsWithMissingDataFromDataDb returns the objects selected by the pipeline whose data file isn't stored
+// in the data database. The pipeline projects the meta data and the data file of the objects.
+func (store *MongoStorage) retrieveObjectsWithMissingDataFromDataDb(pipeline []bson.M) ([]common.MetaData, common.SyncServiceError) {
+	result := []struct {
+		MetaData common.MetaData `bson:"metadata"`
+		DataFile string          `bson:"data-file"`
+	}{}
+	if err := store.aggregate(objects, pipeline, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to look up the data of the objects. Error: %s.", err)}
+	}
+
+	names := make([]string, len(result))
+	for i, r := range result {
+		names[i] = r.DataFile
+	}
+	lengths, err := store.dataFileLengths(names)
+	if err != nil {
+		return nil, err
+	}
+
+	metaDatas := make([]common.MetaData, 0)
+	for _, r := range result {
+		if _, ok := lengths[r.DataFile]; !ok {
+			metaDatas = append(metaDatas, r.MetaData)
+		}
+	}
+	return metaDatas, nil
+}
+
 func (store *MongoStorage) removeFile(id string) common.SyncServiceError {
 	function := func(db *mgo.Database) error {
-		return db.GridFS("fs").Remove(id)
+		return store.gridFS(db).Remove(id)
 	}
 
-	retry, err := store.withDBHelper(function, false)
+	retry, err := store.withDBHelper(function, writeOperation)
 	if err != nil {
 		return err
 	}
@@ -308,7 +1158,7 @@ func (store *MongoStorage) removeFile(id string) common.SyncServiceError {
 
 func (store *MongoStorage) openFile(id string) (*fileHandle, common.SyncServiceError) {
 	function := func(db *mgo.Database) (*mgo.GridFile, error) {
-		return db.GridFS("fs").Open(id)
+		return store.gridFS(db).Open(id)
 	}
 
 	file, session, retry, err := store.withDBAndReturnHelper(function, true)
@@ -320,12 +1170,12 @@ func (store *MongoStorage) openFile(id string) (*fileHandle, common.SyncServiceE
 		return store.openFile(id)
 	}
 
-	return &fileHandle{file, session, 0, nil}, nil
+	return &fileHandle{file: file, session: session}, nil
 }
 
 func (store *MongoStorage) createFile(id string) (*fileHandle, common.SyncServiceError) {
 	function := func(db *mgo.Database) (*mgo.GridFile, error) {
-		return db.GridFS("fs").Create(id)
+		return store.gridFS(db).Create(id)
 	}
 
 	file, session, retry, err := store.withDBAndReturnHelper(function, false)
@@ -337,7 +1187,33 @@ func (store *MongoStorage) createFile(id string) (*fileHandle, common.SyncServic
 		return store.createFile(id)
 	}
 	file.SetChunkSize(common.Configuration.MaxDataChunkSize)
-	return &fileHandle{file, session, 0, nil}, nil
+	return &fileHandle{file: file, session: session}, nil
+}
+
+// MongoDB error code of creating a collection that already exists
+const namespaceExistsErrorCode = 48
+
+// createCompressedCollections explicitly creates the objects and notifications collections with the WiredTiger
+// block compressor, before they are implicitly created with the cluster's default by the creation of the indexes
+func (store *MongoStorage) createCompressedCollections(db *mgo.Database, compressor string) {
+	for _, collection := range []string{objects, notifications} {
+		cmd := bson.D{
+			{Name: "create", Value: collection},
+			{Name: "storageEngine", Value: bson.M{"wiredTiger": bson.M{"configString": "block_compressor=" + compressor}}},
+		}
+		err := db.Run(cmd, nil)
+		if queryErr, ok := err.(*mgo.QueryError); ok && queryErr.Code == namespaceExistsErrorCode {
+			if trace.IsLogging(logger.TRACE) {
+				trace.Trace("The collection %s already exists, its compressor is not modified\n", collection)
+			}
+		} else if err != nil {
+			if log.IsLogging(logger.WARNING) {
+				log.Warning("Failed to create the collection %s with the %s compressor. Error: %s", collection, compressor, err)
+			}
+		} else if log.IsLogging(logger.INFO) {
+			log.Info("Created the collection %s with the %s compressor", collection, compressor)
+		}
+	}
 }
 
 func (store *MongoStorage) run(cmd interface{}, result interface{}) common.SyncServiceError {
@@ -345,7 +1221,7 @@ func (store *MongoStorage) run(cmd interface{}, result interface{}) common.SyncS
 		return db.Run(cmd, result)
 	}
 
-	retry, err := store.withDBHelper(function, true)
+	retry, err := store.withDBHelper(function, readOperation)
 	if err != nil {
 		return err
 	}
@@ -356,12 +1232,18 @@ func (store *MongoStorage) run(cmd interface{}, result interface{}) common.SyncS
 	return nil
 }
 
-func (store *MongoStorage) withDBHelper(function func(*mgo.Database) error, isRead bool) (bool, common.SyncServiceError) {
+func (store *MongoStorage) withDBHelper(function func(*mgo.Database) error, class operationClass) (bool, common.SyncServiceError) {
 	if !store.connected {
 		return false, &NotConnected{"Disconnected from the database"}
 	}
 
-	session := store.getSession()
+	cachedSession, index := store.getSession()
+	defer store.releaseSession(index)
+	session, copied := store.sessionForOperation(cachedSession, class)
+	if copied {
+		defer session.Close()
+	}
+	isRead := class.isRead()
 	db := session.DB(common.Configuration.MongoDbName)
 
 	err := function(db)
@@ -405,7 +1287,7 @@ func (store *MongoStorage) withDBAndReturnHelper(function func(*mgo.Database) (*
 	if !store.connected {
 		return nil, nil, false, &NotConnected{"Disconnected from the database"}
 	}
-	session := store.getSession()
+	session := store.getFileSession()
 	db := session.DB(common.Configuration.MongoDbName)
 
 	file, err := function(db)
@@ -448,14 +1330,20 @@ func (store *MongoStorage) withDBAndReturnHelper(function func(*mgo.Database) (*
 	return nil, nil, false, &NotConnected{"Disconnected from the database"}
 }
 
-func (store *MongoStorage) withCollectionHelper(collectionName string, function func(*mgo.Collection) error, isRead bool) (bool,
+func (store *MongoStorage) withCollectionHelper(collectionName string, function func(*mgo.Collection) error, class operationClass) (bool,
 	common.SyncServiceError) {
 	if !store.connected {
 		return false, &NotConnected{"Disconnected from the database"}
 	}
 
-	session := store.getSession()
-	collection := session.DB(common.Configuration.MongoDbName).C(collectionName)
+	cachedSession, index := store.getSession()
+	defer store.releaseSession(index)
+	session, copied := store.sessionForOperation(cachedSession, class)
+	if copied {
+		defer session.Close()
+	}
+	isRead := class.isRead()
+	collection := session.DB(store.databaseName(collectionName)).C(collectionName)
 
 	err := function(collection)
 
@@ -474,7 +1362,7 @@ func (store *MongoStorage) withCollectionHelper(collectionName string, function
 	session.Refresh()
 	pingErr = session.Ping()
 	if pingErr == nil {
-		collection := session.DB(common.Configuration.MongoDbName).C(collectionName)
+		collection := session.DB(store.databaseName(collectionName)).C(collectionName)
 		err := function(collection)
 		if err == nil || err == mgo.ErrNotFound || err == mgo.ErrCursor || mgo.IsDup(err) {
 			return false, err
@@ -527,6 +1415,10 @@ func (store *MongoStorage) reconnect(timeout bool) bool {
 	var session *mgo.Session
 	var dialErr error
 	for i := 0; i < 3; {
+		if store.isStopped() {
+			// The store was stopped while reconnecting, nobody needs the connection anymore
+			return false
+		}
 		session, dialErr = mgo.DialWithInfo(store.dialInfo)
 		if dialErr == nil && session != nil {
 			break
@@ -537,18 +1429,18 @@ func (store *MongoStorage) reconnect(timeout bool) bool {
 	}
 
 	if dialErr != nil || session == nil {
-		go store.reconnect(false)
+		if !store.isStopped() {
+			go store.reconnect(false)
+		}
 		return false
 	}
 
 	session.SetSafe(&mgo.Safe{})
 	store.session = session
 	store.connected = true
-	if store.cacheSize > 1 {
-		for i := 0; i < store.cacheSize; i++ {
-			store.sessionCache[i].Close()
-			store.sessionCache[i] = store.session.Copy()
-		}
+	for i := range store.sessionCache {
+		store.sessionCache[i].session.Close()
+		store.sessionCache[i].session = store.session.Copy()
 	}
 
 	common.HealthStatus.ReconnectedToDatabase()
@@ -563,6 +1455,25 @@ func (store *MongoStorage) reconnect(timeout bool) bool {
 	return true
 }
 
+// addAuditRecord appends the record to the audit log
+// A failure to write the record is logged, the mutation it describes has already been done
+func (store *MongoStorage) addAuditRecord(record common.AuditRecord) {
+	if err := store.insert(audit, auditObject{ID: bson.NewObjectId(), Record: record}); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to add an audit record for %s of %s:%s:%s. Error: %s", record.Action, record.OrgID,
+			record.ObjectType, record.ObjectID, err)
+	}
+}
+
+// checkWritable returns a common.ReadOnlyError if the store is in read-only mode
+func (store *MongoStorage) checkWritable() common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	if store.readOnly {
+		return &common.ReadOnlyError{Message: "The storage is in read-only mode"}
+	}
+	return nil
+}
+
 func (store *MongoStorage) lock() {
 	<-store.lockChannel
 }
@@ -578,24 +1489,121 @@ func (store *MongoStorage) getFileHandle(id string) (fH *fileHandle) {
 	return
 }
 
-func (store *MongoStorage) putFileHandle(id string, fH *fileHandle) {
+// putUploadFileHandle keeps the handle of a file that is being uploaded, with the offset of its data written so far
+// as the committed offset for partial reads
+func (store *MongoStorage) putUploadFileHandle(id string, fH *fileHandle) {
 	<-store.mapLock
+	if existing := store.openFiles[id]; existing != nil && existing != fH {
+		fH.readers = existing.readers
+	}
+	fH.uploading = true
+	fH.committed = fH.offset
 	store.openFiles[id] = fH
 	store.mapLock <- 1
 }
 
+// getUploadProgress returns the GridFS ID and the committed offset of a file that is being uploaded,
+// and false if the file isn't being uploaded
+func (store *MongoStorage) getUploadProgress(id string) (interface{}, int64, bool) {
+	<-store.mapLock
+	defer func() { store.mapLock <- 1 }()
+	fH := store.openFiles[id]
+	if fH == nil || !fH.uploading {
+		return nil, 0, false
+	}
+	return fH.file.Id(), fH.committed, true
+}
+
+// putFileHandle registers a reader of the file. The readers of a file share its handle, which counts them,
+// so that a reader being closed doesn't delete the handle while other readers of the file are open.
+func (store *MongoStorage) putFileHandle(id string, fH *fileHandle) {
+	<-store.mapLock
+	if store.pendingReads > 0 {
+		store.pendingReads--
+	}
+	if existing := store.openFiles[id]; existing != nil {
+		existing.readers++
+	} else {
+		fH.readers = 1
+		store.openFiles[id] = fH
+	}
+	store.readerFiles[fH.file] = id
+	store.mapLock <- 1
+}
+
+// reserveFileReader waits until a data file can be opened for reading without exceeding MongoMaxOpenDataFiles readers,
+// for up to MongoOpenDataFileTimeout seconds. The reservation is taken by putFileHandle, or released by cancelFileReader
+// if the file isn't opened.
+func (store *MongoStorage) reserveFileReader() common.SyncServiceError {
+	if common.Configuration.MongoMaxOpenDataFiles <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(time.Duration(common.Configuration.MongoOpenDataFileTimeout) * time.Second)
+	for {
+		<-store.mapLock
+		if len(store.readerFiles)+store.pendingReads < common.Configuration.MongoMaxOpenDataFiles {
+			store.pendingReads++
+			store.mapLock <- 1
+			return nil
+		}
+		store.mapLock <- 1
+		if !time.Now().Before(deadline) {
+			return &TooManyOpenFiles{fmt.Sprintf("Failed to open the data file, %d data files are open.",
+				common.Configuration.MongoMaxOpenDataFiles)}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// cancelFileReader releases the reservation of a data file that wasn't opened
+func (store *MongoStorage) cancelFileReader() {
+	<-store.mapLock
+	if store.pendingReads > 0 {
+		store.pendingReads--
+	}
+	store.mapLock <- 1
+}
+
+// releaseFileHandle unregisters a closed reader, the handle of its file is deleted when its last reader is closed,
+// unless the file is being uploaded
+func (store *MongoStorage) releaseFileHandle(file *mgo.GridFile) {
+	<-store.mapLock
+	defer func() { store.mapLock <- 1 }()
+	id, ok := store.readerFiles[file]
+	if !ok {
+		return
+	}
+	delete(store.readerFiles, file)
+	if fH := store.openFiles[id]; fH != nil {
+		if fH.readers > 0 {
+			fH.readers--
+		}
+		if fH.readers == 0 && !fH.uploading {
+			delete(store.openFiles, id)
+		}
+	}
+}
+
+// deleteFileHandle deletes the handle of a file once its upload is done or aborted.
+// The handle is kept, no longer uploading, while the file has open readers.
 func (store *MongoStorage) deleteFileHandle(id string) {
 	<-store.mapLock
-	delete(store.openFiles, id)
+	if fH := store.openFiles[id]; fH != nil && fH.readers > 0 {
+		fH.uploading = false
+	} else {
+		delete(store.openFiles, id)
+	}
 	store.mapLock <- 1
 }
 
 func (store *MongoStorage) addUsersToACLHelper(collection string, aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	users, _ = normalizeACLEntries(users)
 	var id string
 	if key == "" {
-		id = orgID + ":" + aclType + ":*"
+		id = createACLID(orgID, aclType, "*")
 	} else {
-		id = orgID + ":" + aclType + ":" + key
+		id = createACLID(orgID, aclType, key)
 	}
 
 	if trace.IsLogging(logger.TRACE) {
@@ -612,10 +1620,12 @@ func (store *MongoStorage) addUsersToACLHelper(collection string, aclType string
 				result.ACLType = aclType
 				if err = store.insert(collection, result); err != nil {
 					if mgo.IsDup(err) {
+						updateRetried("AddUsersToACL")
 						continue
 					}
 					return &Error{fmt.Sprintf("Failed to insert a %s ACL. Error: %s.", aclType, err)}
 				}
+				updateSucceeded("AddUsersToACL", i)
 				return nil
 			}
 			return &Error{fmt.Sprintf("Failed to add a %s ACL. Error: %s.", aclType, err)}
@@ -627,14 +1637,9 @@ func (store *MongoStorage) addUsersToACLHelper(collection string, aclType string
 		// If the entry in database is not in the input list, add it to input list
 		for _, entry := range result.Users {
 			add := true
-			entryUserTypeInDB := entry.ACLUserType
-			entryUsernameInDB := entry.Username
-
 			for _, user := range users {
 				// username from input, only compare the {aclType} and {username} to determin if the entry already exists
-				userTypeFromRequest := user.ACLUserType
-				userNameFromRequest := user.Username
-				if entryUserTypeInDB == userTypeFromRequest && entryUsernameInDB == userNameFromRequest {
+				if sameACLUser(entry, user) {
 					add = false
 					break
 				}
@@ -651,22 +1656,25 @@ func (store *MongoStorage) addUsersToACLHelper(collection string, aclType string
 				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 			}); err != nil {
 			if err == mgo.ErrNotFound {
+				updateRetried("AddUsersToACL")
 				continue
 			}
 			return &Error{fmt.Sprintf("Failed to add a %s ACL. Error: %s.", aclType, err)}
 		}
 
+		updateSucceeded("AddUsersToACL", i)
 		return nil
 	}
+	updateRetriesExhausted("AddUsersToACL")
 	return &Error{fmt.Sprintf("Failed to add a %s ACL.", aclType)}
 }
 
 func (store *MongoStorage) removeUsersFromACLHelper(collection string, aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
 	var id string
 	if key == "" {
-		id = orgID + ":" + aclType + ":*"
+		id = createACLID(orgID, aclType, "*")
 	} else {
-		id = orgID + ":" + aclType + ":" + key
+		id = createACLID(orgID, aclType, key)
 	}
 
 	if trace.IsLogging(logger.TRACE) {
@@ -679,12 +1687,8 @@ func (store *MongoStorage) removeUsersFromACLHelper(collection string, aclType s
 		}
 		deleted := false
 		for _, user := range users {
-			userTypeFromRequest := user.ACLUserType
-			userNameFromRequest := user.Username
 			for i, entry := range result.Users {
-				entryUserTypeInDB := entry.ACLUserType
-				entryUsernameInDB := entry.Username
-				if entryUserTypeInDB == userTypeFromRequest && entryUsernameInDB == userNameFromRequest {
+				if sameACLUser(entry, user) {
 					if len(result.Users) == 1 {
 						// Deleting the last username, delete the ACL
 						if err := store.removeAll(collection, bson.M{"_id": id}); err != nil {
@@ -711,22 +1715,97 @@ func (store *MongoStorage) removeUsersFromACLHelper(collection string, aclType s
 					"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 				}); err != nil {
 				if err == mgo.ErrNotFound {
+					updateRetried("RemoveUsersFromACL")
 					continue
 				}
 				return &Error{fmt.Sprintf("Failed to delete a %s ACL. Error: %s.", aclType, err)}
 			}
 		}
+		updateSucceeded("RemoveUsersFromACL", i)
 		return nil
 	}
+	updateRetriesExhausted("RemoveUsersFromACL")
 	return &Error{fmt.Sprintf("Failed to delete a %s ACL.", aclType)}
 }
 
+func (store *MongoStorage) setACLHelper(collection string, aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	users, _ = normalizeACLEntries(users)
+	var id string
+	if key == "" {
+		id = createACLID(orgID, aclType, "*")
+	} else {
+		id = createACLID(orgID, aclType, key)
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Setting a %s ACL for %s\n", aclType, id)
+	}
+	if len(users) == 0 {
+		if err := store.removeAll(collection, bson.M{"_id": id}); err != nil && err != mgo.ErrNotFound {
+			return &Error{fmt.Sprintf("Failed to delete a %s ACL. Error: %s.", aclType, err)}
+		}
+		return nil
+	}
+
+	if err := store.upsert(collection, bson.M{"_id": id},
+		bson.M{
+			"$set":         bson.M{"users": users, "org-id": orgID, "acl-type": aclType},
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		}); err != nil {
+		return &Error{fmt.Sprintf("Failed to set a %s ACL. Error: %s.", aclType, err)}
+	}
+	return nil
+}
+
+func (store *MongoStorage) normalizeACLUsernamesHelper(collection string) (int, common.SyncServiceError) {
+	docs := []aclObject{}
+	if err := store.fetchAll(collection, nil, bson.M{"_id": bson.ElementString}, &docs); err != nil && err != mgo.ErrNotFound {
+		return 0, &Error{fmt.Sprintf("Failed to fetch ACLs. Error: %s.", err)}
+	}
+
+	modified := 0
+OUTER:
+	for _, doc := range docs {
+		for i := 0; i < maxUpdateTries; i++ {
+			result := aclObject{}
+			if err := store.fetchOne(collection, bson.M{"_id": doc.ID}, nil, &result); err != nil {
+				if err == mgo.ErrNotFound {
+					// The ACL was deleted meanwhile
+					continue OUTER
+				}
+				return modified, &Error{fmt.Sprintf("Failed to fetch an ACL. Error: %s.", err)}
+			}
+			users, changed := normalizeACLEntries(result.Users)
+			if !changed {
+				continue OUTER
+			}
+			if err := store.update(collection, bson.M{"_id": doc.ID, "last-update": result.LastUpdate},
+				bson.M{
+					"$set":         bson.M{"users": users},
+					"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+				}); err != nil {
+				if err == mgo.ErrNotFound {
+					updateRetried("NormalizeACLUsernames")
+					continue
+				}
+				return modified, &Error{fmt.Sprintf("Failed to normalize an ACL. Error: %s.", err)}
+			}
+			updateSucceeded("NormalizeACLUsernames", i)
+			modified++
+			continue OUTER
+		}
+		updateRetriesExhausted("NormalizeACLUsernames")
+		return modified, &Error{fmt.Sprintf("Failed to normalize the ACL %s.", doc.ID)}
+	}
+	return modified, nil
+}
+
 func (store *MongoStorage) retrieveACLHelper(collection string, aclType string, orgID string, key string, aclUserType string) ([]common.ACLentry, common.SyncServiceError) {
 	var id string
 	if key == "" {
-		id = orgID + ":" + aclType + ":*"
+		id = createACLID(orgID, aclType, "*")
 	} else {
-		id = orgID + ":" + aclType + ":" + key
+		id = createACLID(orgID, aclType, key)
 	}
 
 	if trace.IsLogging(logger.TRACE) {
@@ -768,8 +1847,8 @@ func (store *MongoStorage) retrieveACLsInOrgHelper(collection string, aclType st
 
 	result := make([]string, 0)
 	for _, doc := range docs {
-		if parts := strings.Split(doc.ID, ":"); len(parts) == 3 {
-			result = append(result, parts[2])
+		if key, ok := parseACLKey(doc.ID); ok {
+			result = append(result, key)
 		}
 
 	}
@@ -777,6 +1856,7 @@ func (store *MongoStorage) retrieveACLsInOrgHelper(collection string, aclType st
 }
 
 func (store *MongoStorage) retrieveObjOrDestTypeForGivenACLUserHelper(collection string, aclType string, orgID string, aclUserType string, aclUsername string, aclRole string) ([]string, common.SyncServiceError) {
+	aclUsername = common.NormalizeACLUsername(aclUsername)
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Retrieving %s types for ACL user %s:%s\n", aclType, aclUserType, aclUsername)
 	}
@@ -814,8 +1894,8 @@ func (store *MongoStorage) retrieveObjOrDestTypeForGivenACLUserHelper(collection
 
 	result := make([]string, 0)
 	for _, doc := range docs {
-		if parts := strings.Split(doc.ID, ":"); len(parts) == 3 {
-			result = append(result, parts[2])
+		if key, ok := parseACLKey(doc.ID); ok {
+			result = append(result, key)
 		}
 
 	}
@@ -830,3 +1910,161 @@ func (store *MongoStorage) getInstanceID() int64 {
 	}
 	return currentTime.UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
 }
+
+// updateRetried is called when an update failed because the document was modified concurrently, and is about to be retried
+func updateRetried(operation string) {
+	common.HealthStatus.DBUpdateRetried(operation)
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("%s: the document was modified concurrently, retrying the update\n", operation)
+	}
+}
+
+// updateSucceeded is called when an update succeeded, attempt is the zero based index of the successful attempt
+func updateSucceeded(operation string, attempt int) {
+	if attempt > 0 && log.IsLogging(logger.INFO) {
+		log.Info("%s succeeded on attempt %d of %d\n", operation, attempt+1, maxUpdateTries)
+	}
+}
+
+// updateRetriesExhausted is called when an update failed on all of its attempts
+func updateRetriesExhausted(operation string) {
+	common.HealthStatus.DBUpdateRetriesExhausted(operation)
+	if log.IsLogging(logger.ERROR) {
+		log.Error("%s failed, exhausted all %d update attempts\n", operation, maxUpdateTries)
+	}
+}
+
+// collectionIndex is an index to create in a collection
+type collectionIndex struct {
+	collection string
+	index      mgo.Index
+
+	// extra is set for the additional indexes specified in the configuration, whose creation is logged
+	extra bool
+}
+
+// builtInIndexes returns the indexes that the storage creates in its collections
+func builtInIndexes() []collectionIndex {
+	indexes := []collectionIndex{
+		{collection: destinations, index: mgo.Index{Key: []string{"destination.destination-org-id"}}},
+		{collection: messagingGroups, index: mgo.Index{Key: []string{"group-name"}}},
+		{collection: notifications, index: mgo.Index{Key: []string{"notification.destination-org-id", "notification.destination-id",
+			"notification.destination-type"}}},
+		{collection: notifications, index: mgo.Index{Key: []string{"notification.resend-time", "notification.status"}}},
+		{collection: notifications, index: mgo.Index{Key: []string{"notification.status", "notification.last-update"}}},
+		{collection: objects, index: mgo.Index{Key: []string{"metadata.destination-org-id"}}},
+		{collection: objects, index: mgo.Index{Key: []string{"metadata.destination-org-id", "metadata.delivery-deadline"}}},
+		{collection: objects, index: mgo.Index{Key: []string{"metadata.destination-org-id", "metadata.destination-type"}}},
+		{collection: objects, index: mgo.Index{Key: []string{"metadata.destination-org-id", "-metadata.object-size", "last-update"}}},
+		{collection: objects, index: mgo.Index{
+			Key: []string{
+				"metadata.destination-org-id",
+				"metadata.destination-policy.services.org-id",
+				"metadata.destination-policy.services.service-name",
+			},
+			Name:   "syncObjects-destination-policy.services.service-id",
+			Sparse: true,
+		}},
+		{collection: objects, index: mgo.Index{
+			Key: []string{
+				"metadata.destination-org-id",
+				"metadata.destination-policy.timestamp",
+			},
+			Sparse: true,
+		}},
+		{collection: acls, index: mgo.Index{Key: []string{"org-id", "acl-type"}}},
+		{collection: aclGroups, index: mgo.Index{Key: []string{"group.org-id"}}},
+		{collection: apiTokens, index: mgo.Index{Key: []string{"token.org-id"}}},
+		{collection: retentionPolicies, index: mgo.Index{Key: []string{"policy.org-id"}}},
+		{collection: webhookPolicies, index: mgo.Index{Key: []string{"policy.org-id"}}},
+		{collection: webhookFailures, index: mgo.Index{Key: []string{"failure.org-id", "failure.object-type"}}},
+		{collection: audit, index: mgo.Index{Key: []string{"record.org-id", "record.object-type", "record.object-id"}}},
+		{collection: audit, index: mgo.Index{Key: []string{"record.timestamp"}}},
+		{collection: objectVersions, index: mgo.Index{Key: []string{"metadata.destination-org-id", "metadata.object-type",
+			"metadata.object-id"}}},
+	}
+	if common.Configuration.IdempotencyKeyWindow > 0 {
+		// Expired idempotency keys are removed by the database
+		indexes = append(indexes, collectionIndex{collection: idempotencyKeys, index: mgo.Index{
+			Key:         []string{"recorded"},
+			ExpireAfter: time.Second * time.Duration(common.Configuration.IdempotencyKeyWindow),
+		}})
+	}
+	return indexes
+}
+
+// extraIndexes returns the additional indexes specified in the configuration
+// Also returns the number of indexes that are invalid and can't be created
+func extraIndexes() ([]collectionIndex, int) {
+	if common.Configuration.MongoExtraIndexes == "" {
+		return nil, 0
+	}
+	indexes, err := common.ParseMongoIndexes(common.Configuration.MongoExtraIndexes)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to parse the additional indexes. Error: %s", err)
+		}
+		return nil, 1
+	}
+	result := make([]collectionIndex, 0, len(indexes))
+	invalid := 0
+	for _, index := range indexes {
+		switch index.Collection {
+		case destinations, notifications, objects, messagingGroups, webhooks, organizations, acls, aclGroups, apiTokens, audit:
+		default:
+			invalid++
+			if log.IsLogging(logger.WARNING) {
+				log.Warning("Failed to create an index on %s. Error: unknown collection", index.Collection)
+			}
+			continue
+		}
+		result = append(result, collectionIndex{
+			collection: index.Collection,
+			index: mgo.Index{
+				Key:        index.Keys,
+				Unique:     index.Unique,
+				Background: index.Background,
+				Sparse:     index.Sparse,
+			},
+			extra: true,
+		})
+	}
+	return result, invalid
+}
+
+// ensureIndexes creates the indexes that don't exist yet.
+// If MongoBackgroundIndexBuilds is set, the indexes are built in the background, without blocking writes to the collections.
+// Returns the number of indexes that failed to be created
+func ensureIndexes(db *mgo.Database, indexes []collectionIndex) int {
+	failed := 0
+	for _, index := range indexes {
+		if common.Configuration.MongoBackgroundIndexBuilds {
+			index.index.Background = true
+		}
+		if err := db.C(index.collection).EnsureIndex(index.index); err != nil {
+			failed++
+			if log.IsLogging(logger.WARNING) {
+				log.Warning("Failed to create an index on %s. Error: %s", index.collection, err)
+			}
+			continue
+		}
+		if index.extra && log.IsLogging(logger.INFO) {
+			log.Info("Created an index on %s with the keys %s", index.collection, strings.Join(index.index.Key, ","))
+		}
+	}
+	return failed
+}
+
+// buildIndexesInBackground creates the indexes with background builds, and logs when the builds are complete.
+// It doesn't delay the startup of the storage and isn't waited for by Stop, since index builds on large collections
+// can take a long time.
+func buildIndexesInBackground(session *mgo.Session, indexes []collectionIndex) {
+	defer session.Close()
+
+	start := time.Now()
+	failed := ensureIndexes(session.DB(common.Configuration.MongoDbName), indexes)
+	if log.IsLogging(logger.INFO) {
+		log.Info("Completed the background builds of the database indexes in %s, %d of %d indexes failed",
+			time.Since(start), failed, len(indexes))
+	}
+}
@@ -1,8 +1,16 @@
 package storage
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
 	"github.com/open-horizon/edge-sync-service/common"
 )
 
@@ -22,6 +30,162 @@ func TestMongoStorageObjectActivation(t *testing.T) {
 	testStorageObjectActivation(common.Mongo, t)
 }
 
+func TestMongoStorageUndeleteObject(t *testing.T) {
+	testStorageUndeleteObject(common.Mongo, t)
+}
+
+func TestMongoStoragePatchObjectMetadata(t *testing.T) {
+	testStoragePatchObjectMetadata(common.Mongo, t)
+}
+
+func TestMongoStorageTouchObject(t *testing.T) {
+	testStorageTouchObject(common.Mongo, t)
+}
+
+func TestMongoStorageAuditLog(t *testing.T) {
+	testStorageAuditLog(common.Mongo, t)
+}
+
+func TestMongoStorageAuditLogRetention(t *testing.T) {
+	testStorageAuditLogRetention(common.Mongo, t)
+}
+
+func TestMongoStorageObjectVersions(t *testing.T) {
+	testStorageObjectVersions(common.Mongo, t)
+}
+
+func TestMongoStorageRetentionPolicies(t *testing.T) {
+	testStorageRetentionPolicies(common.Mongo, t)
+}
+
+func TestMongoStorageWebhookRetryPolicies(t *testing.T) {
+	testStorageWebhookRetryPolicies(common.Mongo, t)
+}
+
+func TestMongoStorageMaxDeliveriesPerDestination(t *testing.T) {
+	testStorageMaxDeliveriesPerDestination(common.Mongo, t)
+}
+
+func TestMongoStorageSourceDataURI(t *testing.T) {
+	testStorageSourceDataURI(common.Mongo, t)
+}
+
+func TestMongoStorageIdempotencyKeys(t *testing.T) {
+	testStorageIdempotencyKeys(common.Mongo, t)
+}
+
+func TestMongoStorageObjectStatusCounts(t *testing.T) {
+	testStorageObjectStatusCounts(common.Mongo, t)
+}
+
+func TestMongoStorageStorageStatsByType(t *testing.T) {
+	testStorageStorageStatsByType(common.Mongo, t)
+}
+
+func TestMongoStorageObjectIDSeparator(t *testing.T) {
+	testStorageObjectIDSeparator(common.Mongo, t)
+}
+
+func TestMongoStorageBroadcastObjects(t *testing.T) {
+	testStorageBroadcastObjects(common.Mongo, t)
+}
+
+func TestMongoStoragePinnedObjects(t *testing.T) {
+	testStoragePinnedObjects(common.Mongo, t)
+}
+
+func TestMongoStorageStoreDestinations(t *testing.T) {
+	testStorageStoreDestinations(common.Mongo, t)
+}
+
+func TestMongoStorageObjectsWithMissingData(t *testing.T) {
+	testStorageObjectsWithMissingData(common.Mongo, t)
+}
+
+func TestMongoStorageDeliveryAttempts(t *testing.T) {
+	testStorageDeliveryAttempts(common.Mongo, t)
+}
+
+func TestMongoStorageObjectsBySizeAndAge(t *testing.T) {
+	testStorageObjectsBySizeAndAge(common.Mongo, t)
+}
+
+func TestMongoStorageAPITokens(t *testing.T) {
+	testStorageAPITokens(common.Mongo, t)
+}
+
+func TestMongoStorageDestinationObjectTypesACL(t *testing.T) {
+	testStorageDestinationObjectTypesACL(common.Mongo, t)
+}
+
+func TestMongoStorageObjectsAcrossOrgs(t *testing.T) {
+	testStorageObjectsAcrossOrgs(common.Mongo, t)
+}
+
+func TestMongoStorageObjectsApproachingDeadline(t *testing.T) {
+	testStorageObjectsApproachingDeadline(common.Mongo, t)
+}
+
+func TestMongoStoragePartialObjectData(t *testing.T) {
+	testStoragePartialObjectData(common.Mongo, t)
+}
+
+func TestMongoStorageReplaceObject(t *testing.T) {
+	testStorageReplaceObject(common.Mongo, t)
+}
+
+func TestMongoStorageSetACL(t *testing.T) {
+	testStorageSetACL(common.Mongo, t)
+}
+
+func TestMongoStorageObjectsByIDs(t *testing.T) {
+	testStorageObjectsByIDs(common.Mongo, t)
+}
+
+func TestMongoStorageObjectMetadataBatch(t *testing.T) {
+	testStorageObjectMetadataBatch(common.Mongo, t)
+}
+
+func TestMongoStorageObjectAttachment(t *testing.T) {
+	testStorageObjectAttachment(common.Mongo, t)
+}
+
+func TestMongoStorageObjectDelta(t *testing.T) {
+	testStorageObjectDelta(common.Mongo, t)
+}
+
+func TestMongoStorageDataAccessLog(t *testing.T) {
+	testStorageDataAccessLog(common.Mongo, t)
+}
+
+func TestMongoStorageDeleteObjectsOfType(t *testing.T) {
+	testStorageDeleteObjectsOfType(common.Mongo, t)
+}
+
+func TestMongoStorageObjectStatusChange(t *testing.T) {
+	testStorageObjectStatusChange(common.Mongo, t)
+}
+
+func TestMongoStoragePurgeCompletedNotifications(t *testing.T) {
+	testStoragePurgeCompletedNotifications(common.Mongo, t)
+}
+
+func TestMongoStorageLeaderHandoff(t *testing.T) {
+	testStorageLeaderHandoff(common.Mongo, t)
+}
+
+func TestMongoStorageLeaderAlive(t *testing.T) {
+	testStorageLeaderAlive(common.Mongo, t)
+}
+
+func TestMongoStorageRetrieveObjectIfModifiedSince(t *testing.T) {
+	testStorageRetrieveObjectIfModifiedSince(common.Mongo, t)
+}
+
+func TestMongoStorageExportImportOrganization(t *testing.T) {
+	testStorageExportImportOrganization(common.Mongo, t)
+}
+
 func TestMongoStorageObjectExpiration(t *testing.T) {
 	testStorageObjectExpiration(common.Mongo, t)
 }
@@ -30,10 +194,804 @@ func TestMongoStorageObjectData(t *testing.T) {
 	testStorageObjectData(common.Mongo, t)
 }
 
+func TestMongoStorageMaxObjectSize(t *testing.T) {
+	testStorageMaxObjectSize(common.Mongo, t)
+}
+
 func TestMongoStorageOrgDeleteObjects(t *testing.T) {
 	testStorageOrgDeleteObjects(common.Mongo, t)
 }
 
+func TestMongoStorageReadOnly(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "readonly", DestOrgID: "myorg"}
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+
+	store.SetReadOnly(true)
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err == nil || !common.IsReadOnlyError(err) {
+		t.Errorf("StoreObject in read-only mode didn't return ReadOnlyError\n")
+	}
+	if _, err := store.StoreObjectData("myorg", "readonly", "1", bytes.NewReader([]byte("data"))); err == nil || !common.IsReadOnlyError(err) {
+		t.Errorf("StoreObjectData in read-only mode didn't return ReadOnlyError\n")
+	}
+	if err := store.DeleteStoredObject("myorg", "readonly", "1", ""); err == nil || !common.IsReadOnlyError(err) {
+		t.Errorf("DeleteStoredObject in read-only mode didn't return ReadOnlyError\n")
+	}
+	dest := common.Destination{DestOrgID: "myorg", DestID: "1", DestType: "device", Communication: common.MQTTProtocol}
+	users := []common.ACLentry{{Username: "user1", ACLUserType: "user", ACLRole: "writer"}}
+	writes := map[string]func() common.SyncServiceError{
+		"UpdateObjectStatus": func() common.SyncServiceError {
+			return store.UpdateObjectStatus("myorg", "readonly", "1", common.ReadyToSend, "")
+		},
+		"RetrieveAllObjectsAndUpdateDestinationListForDestination": func() common.SyncServiceError {
+			_, err := store.RetrieveAllObjectsAndUpdateDestinationListForDestination("myorg", "device", "1")
+			return err
+		},
+		"RecordIdempotencyKey": func() common.SyncServiceError {
+			return store.RecordIdempotencyKey("myorg", "readonly", "1", "key1")
+		},
+		"UpdateObjectSourceDataURI": func() common.SyncServiceError {
+			return store.UpdateObjectSourceDataURI("myorg", "readonly", "1", "file:///tmp/readonly")
+		},
+		"MarkObjectDeleted": func() common.SyncServiceError { return store.MarkObjectDeleted("myorg", "readonly", "1", "") },
+		"UndeleteObject":    func() common.SyncServiceError { return store.UndeleteObject("myorg", "readonly", "1") },
+		"ActivateObject":    func() common.SyncServiceError { return store.ActivateObject("myorg", "readonly", "1") },
+		"AddWebhook":        func() common.SyncServiceError { return store.AddWebhook("myorg", "readonly", "http://hook") },
+		"DeleteWebhook":     func() common.SyncServiceError { return store.DeleteWebhook("myorg", "readonly", "http://hook") },
+		"StoreDestination":  func() common.SyncServiceError { return store.StoreDestination(dest) },
+		"DeleteDestination": func() common.SyncServiceError { return store.DeleteDestination("myorg", "device", "1") },
+		"UpdateNotificationRecord": func() common.SyncServiceError {
+			return store.UpdateNotificationRecord(common.Notification{ObjectID: "1", ObjectType: "readonly", DestOrgID: "myorg",
+				DestID: "1", DestType: "device", Status: common.Update})
+		},
+		"StoreOrgToMessagingGroup": func() common.SyncServiceError { return store.StoreOrgToMessagingGroup("myorg", "group") },
+		"StoreOrganization": func() common.SyncServiceError {
+			_, err := store.StoreOrganization(common.Organization{OrgID: "myorg"})
+			return err
+		},
+		"DeleteOrganization": func() common.SyncServiceError { return store.DeleteOrganization("myorg") },
+		"AddUsersToACL": func() common.SyncServiceError {
+			return store.AddUsersToACL(common.ObjectsACLType, "myorg", "readonly", users)
+		},
+		"RemoveUsersFromACL": func() common.SyncServiceError {
+			return store.RemoveUsersFromACL(common.ObjectsACLType, "myorg", "readonly", users)
+		},
+		"StoreACLGroup": func() common.SyncServiceError {
+			return store.StoreACLGroup(common.ACLGroup{OrgID: "myorg", Name: "group", Members: []string{"user1"}})
+		},
+		"DeleteACLGroup": func() common.SyncServiceError {
+			return store.DeleteACLGroup("myorg", "group")
+		},
+		"NormalizeACLUsernames": func() common.SyncServiceError {
+			_, err := store.NormalizeACLUsernames()
+			return err
+		},
+		"DecommissionDestination": func() common.SyncServiceError {
+			_, err := store.DecommissionDestination("myorg", "device", "1")
+			return err
+		},
+		"SetACL": func() common.SyncServiceError {
+			return store.SetACL(common.ObjectsACLType, "myorg", "readonly", users)
+		},
+		"AppendObjectDelta": func() common.SyncServiceError {
+			return store.AppendObjectDelta("myorg", "readonly", "1", 0, bytes.NewReader(nil), 0, "")
+		},
+		"UpdateNotificationRecords": func() common.SyncServiceError {
+			return store.UpdateNotificationRecords([]common.Notification{{ObjectID: "1", ObjectType: "readonly", DestOrgID: "myorg",
+				DestID: "1", DestType: "device", Status: common.Update}})
+		},
+		"PinObject": func() common.SyncServiceError {
+			return store.PinObject("myorg", "readonly", "1")
+		},
+		"UnpinObject": func() common.SyncServiceError {
+			return store.UnpinObject("myorg", "readonly", "1")
+		},
+		"StoreDestinations": func() common.SyncServiceError {
+			_, err := store.StoreDestinations([]common.Destination{dest})
+			return err
+		},
+		"StoreAPIToken": func() common.SyncServiceError {
+			return store.StoreAPIToken(common.APIToken{Hash: "readonly", OrgID: "myorg", Identity: "user1"})
+		},
+		"RevokeAPIToken": func() common.SyncServiceError {
+			return store.RevokeAPIToken("readonly")
+		},
+		"StoreRetentionPolicy": func() common.SyncServiceError {
+			return store.StoreRetentionPolicy(common.RetentionPolicy{OrgID: "myorg", ObjectType: "readonly", MaxAge: 60})
+		},
+		"DeleteRetentionPolicy": func() common.SyncServiceError {
+			return store.DeleteRetentionPolicy("myorg", "readonly")
+		},
+		"StoreWebhookRetryPolicy": func() common.SyncServiceError {
+			return store.StoreWebhookRetryPolicy(common.WebhookRetryPolicy{OrgID: "myorg", ObjectType: "readonly"})
+		},
+		"DeleteWebhookRetryPolicy": func() common.SyncServiceError {
+			return store.DeleteWebhookRetryPolicy("myorg", "readonly")
+		},
+		"StoreWebhookFailure": func() common.SyncServiceError {
+			return store.StoreWebhookFailure(common.WebhookFailure{OrgID: "myorg", ObjectType: "readonly"})
+		},
+		"DeleteWebhookFailures": func() common.SyncServiceError {
+			return store.DeleteWebhookFailures("myorg", "readonly")
+		},
+		"RegisterDestination": func() common.SyncServiceError {
+			return store.RegisterDestination(common.Destination{DestOrgID: "myorg", DestType: "device", DestID: "readonly"})
+		},
+	}
+	for name, write := range writes {
+		if err := write(); err == nil || !common.IsReadOnlyError(err) {
+			t.Errorf("%s in read-only mode didn't return ReadOnlyError\n", name)
+		}
+	}
+	if meta, err := store.RetrieveObject("myorg", "readonly", "1"); err != nil || meta == nil {
+		t.Errorf("RetrieveObject in read-only mode failed\n")
+	}
+
+	store.SetReadOnly(false)
+	if err := store.DeleteStoredObject("myorg", "readonly", "1", ""); err != nil {
+		t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+	}
+}
+
+func TestMongoStorageStop(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	savedProbeInterval := common.Configuration.DatabaseLatencyProbeInterval
+	savedQuiesceTime := common.Configuration.ShutdownQuiesceTime
+	defer func() {
+		common.Configuration.DatabaseLatencyProbeInterval = savedProbeInterval
+		common.Configuration.ShutdownQuiesceTime = savedQuiesceTime
+	}()
+	common.Configuration.DatabaseLatencyProbeInterval = 1
+	common.Configuration.ShutdownQuiesceTime = 1
+
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "stop", DestOrgID: "myorg"}
+	if _, err := store.StoreObject(metaData, []byte("data"), common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	dataReader, err := store.RetrieveObjectData("myorg", "stop", "1", "")
+	if err != nil || dataReader == nil {
+		t.Errorf("Failed to retrieve object's data. Error: %v\n", err)
+	}
+
+	// Stop waits for the open data reader until the quiesce time expires
+	start := time.Now()
+	store.Stop()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Stop didn't wait for the open data reader (elapsed %s)\n", elapsed)
+	}
+	// A second Stop is a no-op, and maintenance after Stop is skipped
+	store.Stop()
+	store.PerformMaintenance()
+}
+
+func TestMongoStorageSessionCacheGrowth(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	savedCacheSize := common.Configuration.MongoSessionCacheSize
+	savedCacheMaxSize := common.Configuration.MongoSessionCacheMaxSize
+	savedIdleTime := common.Configuration.MongoSessionCacheIdleTime
+	defer func() {
+		common.Configuration.MongoSessionCacheSize = savedCacheSize
+		common.Configuration.MongoSessionCacheMaxSize = savedCacheMaxSize
+		common.Configuration.MongoSessionCacheIdleTime = savedIdleTime
+	}()
+	common.Configuration.MongoSessionCacheSize = 2
+	common.Configuration.MongoSessionCacheMaxSize = 4
+	common.Configuration.MongoSessionCacheIdleTime = 0
+
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	hits := common.DBHealth.SessionCacheHits
+	misses := common.DBHealth.SessionCacheMisses
+
+	// The first two sessions are cache hits, the next two grow the cache, and the fifth one shares a busy session
+	indexes := make([]int, 0)
+	for i := 0; i < 5; i++ {
+		_, index := store.getSession()
+		indexes = append(indexes, index)
+	}
+	if len(store.sessionCache) != 4 {
+		t.Errorf("The session cache didn't grow to its maximal size: %d sessions\n", len(store.sessionCache))
+	}
+	if common.DBHealth.SessionCacheHits-hits != 2 || common.DBHealth.SessionCacheMisses-misses != 3 {
+		t.Errorf("Wrong session cache counters: %d hits and %d misses\n", common.DBHealth.SessionCacheHits-hits,
+			common.DBHealth.SessionCacheMisses-misses)
+	}
+
+	// Once idle, the cache shrinks back to its initial size
+	for _, index := range indexes {
+		store.releaseSession(index)
+	}
+	if len(store.sessionCache) != 2 {
+		t.Errorf("The session cache didn't shrink to its initial size: %d sessions\n", len(store.sessionCache))
+	}
+	if common.DBHealth.SessionCacheSize != 2 {
+		t.Errorf("Wrong session cache size in the health status: %d\n", common.DBHealth.SessionCacheSize)
+	}
+
+	// The store still works after the cache shrank
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "sessions", DestOrgID: "myorg"}
+	if _, err := store.StoreObject(metaData, []byte("data"), common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	if err := store.DeleteStoredObject("myorg", "sessions", "1", ""); err != nil {
+		t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+	}
+}
+
+func TestMongoStorageGridFSPrefix(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	savedPrefix := common.Configuration.MongoGridFSPrefix
+	defer func() { common.Configuration.MongoGridFSPrefix = savedPrefix }()
+
+	common.Configuration.MongoGridFSPrefix = "fs"
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	common.Configuration.MongoGridFSPrefix = "isolated"
+	isolatedStore := &MongoStorage{}
+	if err := isolatedStore.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer isolatedStore.Stop()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "gridfs", DestOrgID: "myorg"}
+	if _, err := store.StoreObject(metaData, []byte("data"), common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	defer store.DeleteStoredObject("myorg", "gridfs", "1", "")
+
+	// The data is stored in the GridFS collections of the store's prefix only
+	if dataReader, err := store.RetrieveObjectData("myorg", "gridfs", "1", ""); err != nil || dataReader == nil {
+		t.Errorf("Failed to retrieve object's data. Error: %v\n", err)
+	} else {
+		store.CloseDataReader(dataReader)
+	}
+	if dataReader, err := isolatedStore.RetrieveObjectData("myorg", "gridfs", "1", ""); err != nil {
+		t.Errorf("Failed to retrieve object's data. Error: %s\n", err.Error())
+	} else if dataReader != nil {
+		isolatedStore.CloseDataReader(dataReader)
+		t.Errorf("Retrieved object's data stored with a different GridFS prefix\n")
+	}
+}
+
+func TestMongoStorageUpdateRetries(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	// A forced retry and retry exhaustion are counted per operation
+	retries := common.DBHealth.UpdateRetries["ForcedRetry"]
+	exhausted := common.DBHealth.UpdateRetriesExhausted["ForcedRetry"]
+	updateRetried("ForcedRetry")
+	updateRetried("ForcedRetry")
+	updateRetriesExhausted("ForcedRetry")
+	if common.DBHealth.UpdateRetries["ForcedRetry"] != retries+2 {
+		t.Errorf("Wrong number of update retries: %d instead of %d\n", common.DBHealth.UpdateRetries["ForcedRetry"], retries+2)
+	}
+	if common.DBHealth.UpdateRetriesExhausted["ForcedRetry"] != exhausted+1 {
+		t.Errorf("Wrong number of exhausted update retries: %d instead of %d\n",
+			common.DBHealth.UpdateRetriesExhausted["ForcedRetry"], exhausted+1)
+	}
+
+	// Objects with a destination policy are skipped by RetrieveObjects without being counted as retries
+	dest := common.Destination{DestOrgID: "myorg", DestID: "dev1", DestType: "device", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+	}
+	objects := []common.MetaData{
+		common.MetaData{ObjectID: "1", ObjectType: "retries", DestOrgID: "myorg", NoData: true},
+		common.MetaData{ObjectID: "2", ObjectType: "retries", DestOrgID: "myorg", NoData: true,
+			DestinationPolicy: &common.Policy{Properties: []common.PolicyProperty{{Name: "a", Value: float64(1)}}}},
+	}
+	for _, metaData := range objects {
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		}
+	}
+
+	retries = common.DBHealth.UpdateRetries["RetrieveObjects"]
+	exhausted = common.DBHealth.UpdateRetriesExhausted["RetrieveObjects"]
+	if metaDatas, err := store.RetrieveObjects("myorg", "device", "dev1", common.ResendAll); err != nil {
+		t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+	} else if len(metaDatas) != 1 {
+		t.Errorf("RetrieveObjects returned %d objects instead of 1\n", len(metaDatas))
+	}
+	if common.DBHealth.UpdateRetries["RetrieveObjects"] != retries {
+		t.Errorf("RetrieveObjects counted %d update retries\n", common.DBHealth.UpdateRetries["RetrieveObjects"]-retries)
+	}
+	if common.DBHealth.UpdateRetriesExhausted["RetrieveObjects"] != exhausted {
+		t.Errorf("RetrieveObjects exhausted its update retries\n")
+	}
+
+	for _, metaData := range objects {
+		if err := store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, ""); err != nil {
+			t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+		}
+	}
+	if err := store.DeleteDestination(dest.DestOrgID, dest.DestType, dest.DestID); err != nil {
+		t.Errorf("DeleteDestination failed. Error: %s\n", err.Error())
+	}
+}
+
+func TestMongoStorageRequireIndexes(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	savedExtraIndexes := common.Configuration.MongoExtraIndexes
+	savedRequireIndexes := common.Configuration.RequireIndexes
+	defer func() {
+		common.Configuration.MongoExtraIndexes = savedExtraIndexes
+		common.Configuration.RequireIndexes = savedRequireIndexes
+	}()
+	common.Configuration.MongoExtraIndexes = ""
+	common.Configuration.RequireIndexes = true
+
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	objects := []common.MetaData{
+		common.MetaData{ObjectID: "1", ObjectType: "requireindexes", DestOrgID: "myorg", NoData: true},
+		common.MetaData{ObjectID: "2", ObjectType: "requireindexes", DestOrgID: "myorg", NoData: true},
+	}
+	for _, metaData := range objects {
+		if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		}
+	}
+
+	// A unique index on the object type can't be created since two objects have the same type
+	common.Configuration.MongoExtraIndexes = "syncObjects:metadata.object-type:unique"
+	failingStore := &MongoStorage{}
+	if err := failingStore.Init(); err == nil {
+		t.Errorf("Init didn't fail on an index that can't be created\n")
+		failingStore.Stop()
+	}
+
+	common.Configuration.RequireIndexes = false
+	nonRequiringStore := &MongoStorage{}
+	if err := nonRequiringStore.Init(); err != nil {
+		t.Errorf("Init failed on an index that can't be created with RequireIndexes=false. Error: %s\n", err.Error())
+	} else {
+		nonRequiringStore.Stop()
+	}
+
+	for _, metaData := range objects {
+		if err := store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, ""); err != nil {
+			t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+		}
+	}
+}
+
+type testDataRepairProvider struct {
+	data      []byte
+	retrieved int
+}
+
+func (provider *testDataRepairProvider) RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, error) {
+	provider.retrieved++
+	return bytes.NewReader(provider.data), nil
+}
+
+func TestMongoStorageDataRepair(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	data := []byte("data to repair")
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "repair", DestOrgID: "myorg"}
+	if _, err := store.StoreObject(metaData, data, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	defer store.DeleteStoredObject("myorg", "repair", "1", "")
+
+	// Corrupt the object's data by removing its GridFS chunks
+	corruptData := func() bool {
+		fileHandle, err := store.openFile(createObjectCollectionID("myorg", "repair", "1"))
+		if err != nil {
+			t.Errorf("Failed to open the object's data file. Error: %s\n", err.Error())
+			return false
+		}
+		fileID := fileHandle.file.Id()
+		fileHandle.file.Close()
+		if err := store.removeAll(store.gridFSPrefix+".chunks", bson.M{"files_id": fileID}); err != nil {
+			t.Errorf("Failed to remove the object's data chunks. Error: %s\n", err.Error())
+			return false
+		}
+		return true
+	}
+
+	if !corruptData() {
+		return
+	}
+	if _, _, _, err := store.ReadObjectData("myorg", "repair", "1", len(data), 0, ""); err == nil {
+		t.Errorf("Read corrupted object's data without a data repair provider\n")
+	}
+
+	provider := &testDataRepairProvider{data: data}
+	SetDataRepairProvider(provider)
+	defer SetDataRepairProvider(nil)
+
+	readData, eof, length, err := store.ReadObjectData("myorg", "repair", "1", len(data), 0, "")
+	if err != nil {
+		t.Errorf("Failed to read the repaired object's data. Error: %s\n", err.Error())
+	} else if !eof || length != len(data) || !bytes.Equal(readData, data) {
+		t.Errorf("Read incorrect data: %s (eof=%t, length=%d)\n", readData, eof, length)
+	}
+	if provider.retrieved != 1 {
+		t.Errorf("The data repair provider was called %d times instead of once\n", provider.retrieved)
+	}
+
+	// The data was rewritten, subsequent reads don't require a repair
+	if _, _, _, err := store.ReadObjectData("myorg", "repair", "1", len(data), 0, ""); err != nil {
+		t.Errorf("Failed to read the repaired object's data. Error: %s\n", err.Error())
+	}
+	if provider.retrieved != 1 {
+		t.Errorf("The data repair provider was called for readable data\n")
+	}
+}
+
+func TestMongoStorageCollectionCompressor(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	savedCompressor := common.Configuration.MongoCollectionCompressor
+	defer func() { common.Configuration.MongoCollectionCompressor = savedCompressor }()
+	common.Configuration.MongoCollectionCompressor = "snappy"
+
+	// The initialization succeeds both when the collections are created and when they already exist
+	for i := 0; i < 2; i++ {
+		store := &MongoStorage{}
+		if err := store.Init(); err != nil {
+			t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+			return
+		}
+
+		names := []string{}
+		function := func(db *mgo.Database) error {
+			var err error
+			names, err = db.CollectionNames()
+			return err
+		}
+		if _, err := store.withDBHelper(function, readOperation); err != nil {
+			t.Errorf("Failed to retrieve the collection names. Error: %s\n", err.Error())
+		}
+		for _, collection := range []string{objects, notifications} {
+			found := false
+			for _, name := range names {
+				if name == collection {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("The collection %s wasn't created\n", collection)
+			}
+		}
+		store.Stop()
+	}
+}
+
+func TestMongoStorageBackgroundIndexBuilds(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	savedBackground := common.Configuration.MongoBackgroundIndexBuilds
+	savedExtraIndexes := common.Configuration.MongoExtraIndexes
+	defer func() {
+		common.Configuration.MongoBackgroundIndexBuilds = savedBackground
+		common.Configuration.MongoExtraIndexes = savedExtraIndexes
+	}()
+	common.Configuration.MongoBackgroundIndexBuilds = true
+	common.Configuration.MongoExtraIndexes = "syncObjects:metadata.destination-org-id,metadata.description"
+
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	// The indexes are created after the initialization completes
+	found := false
+	for i := 0; i < 50 && !found; i++ {
+		indexes := []mgo.Index{}
+		function := func(db *mgo.Database) error {
+			var err error
+			indexes, err = db.C(objects).Indexes()
+			return err
+		}
+		if _, err := store.withDBHelper(function, readOperation); err != nil {
+			t.Errorf("Failed to retrieve the indexes. Error: %s\n", err.Error())
+			return
+		}
+		for _, index := range indexes {
+			if strings.Join(index.Key, ",") == "metadata.destination-org-id,metadata.description" {
+				found = true
+			}
+		}
+		if !found {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	if !found {
+		t.Errorf("The additional index wasn't built in the background\n")
+	}
+
+	function := func(db *mgo.Database) error {
+		return db.C(objects).DropIndex("metadata.destination-org-id", "metadata.description")
+	}
+	store.withDBHelper(function, writeOperation)
+}
+
+func TestMongoStorageOperationTimeouts(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	savedRead := common.Configuration.MongoReadTimeout
+	savedWrite := common.Configuration.MongoWriteTimeout
+	savedBulk := common.Configuration.MongoBulkTimeout
+	defer func() {
+		common.Configuration.MongoReadTimeout = savedRead
+		common.Configuration.MongoWriteTimeout = savedWrite
+		common.Configuration.MongoBulkTimeout = savedBulk
+	}()
+	common.Configuration.MongoReadTimeout = 5
+	common.Configuration.MongoWriteTimeout = 10
+	common.Configuration.MongoBulkTimeout = 120
+
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	if store.dialInfo.ReadTimeout != 5*time.Second {
+		t.Errorf("The sessions were created with the timeout %s instead of the read timeout\n", store.dialInfo.ReadTimeout)
+	}
+	tests := []struct {
+		class   operationClass
+		timeout time.Duration
+		copied  bool
+	}{
+		{readOperation, 5 * time.Second, false},
+		{writeOperation, 10 * time.Second, true},
+		{bulkReadOperation, 120 * time.Second, true},
+		{bulkWriteOperation, 120 * time.Second, true},
+	}
+	for _, test := range tests {
+		if test.class.timeout() != test.timeout {
+			t.Errorf("The timeout of operation class %d is %s instead of %s\n", test.class, test.class.timeout(), test.timeout)
+		}
+		session, copied := store.sessionForOperation(store.session, test.class)
+		if copied != test.copied {
+			t.Errorf("sessionForOperation returned copied=%t for operation class %d\n", copied, test.class)
+		}
+		if copied {
+			session.Close()
+		}
+	}
+
+	// Operations of all the classes succeed with their timeouts
+	orgID := "timeoutsorg"
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID}
+	if _, err := store.StoreObject(metaData, []byte("data"), common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveObject(orgID, "type1", "1"); err != nil || stored == nil {
+		t.Errorf("Failed to retrieve object. Error: %v\n", err)
+	}
+	if err := store.ExportOrganization(orgID, ioutil.Discard); err != nil {
+		t.Errorf("Failed to export organization. Error: %s\n", err.Error())
+	}
+	if err := store.DeleteOrganization(orgID); err != nil {
+		t.Errorf("Failed to delete organization. Error: %s\n", err.Error())
+	}
+}
+
+func TestMongoStorageAppendBackpressure(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	chunkSize := int64(10)
+	total := chunkSize * 200
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "backpressure", DestOrgID: "myorg", ObjectSize: total}
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	defer store.DeleteStoredObject("myorg", "backpressure", "1", "")
+
+	chunk := bytes.Repeat([]byte("a"), int(chunkSize))
+	if err := store.AppendObjectData("myorg", "backpressure", "1", bytes.NewReader(chunk), uint32(chunkSize), 0, total,
+		true, false); err != nil {
+		t.Errorf("Failed to append the first chunk. Error: %s\n", err.Error())
+		return
+	}
+
+	// The chunk at offset 10 is missing, the following chunks are buffered until there are too many of them
+	var err error
+	offset := 2 * chunkSize
+	for ; offset < total; offset += chunkSize {
+		err = store.AppendObjectData("myorg", "backpressure", "1", bytes.NewReader(chunk), uint32(chunkSize), offset, total,
+			false, false)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Errorf("All the out-of-order chunks were appended\n")
+		return
+	}
+	backpressure, ok := err.(*Backpressure)
+	if !ok {
+		t.Errorf("Failed to append an out-of-order chunk. Error: %s\n", err.Error())
+		return
+	}
+	if backpressure.NextOffset != chunkSize {
+		t.Errorf("Next offset is %d instead of %d\n", backpressure.NextOffset, chunkSize)
+	}
+
+	// After the missing chunk is appended, the postponed chunk is accepted
+	if err := store.AppendObjectData("myorg", "backpressure", "1", bytes.NewReader(chunk), uint32(chunkSize), chunkSize, total,
+		false, false); err != nil {
+		t.Errorf("Failed to append the missing chunk. Error: %s\n", err.Error())
+	}
+	if err := store.AppendObjectData("myorg", "backpressure", "1", bytes.NewReader(chunk), uint32(chunkSize), offset, total,
+		false, false); err != nil {
+		t.Errorf("Failed to append the postponed chunk. Error: %s\n", err.Error())
+	}
+}
+
+func TestMongoStorageStartWithoutDatabase(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	savedAddress := common.Configuration.MongoAddressCsv
+	savedTimeout := common.Configuration.DatabaseConnectTimeout
+	savedStart := common.Configuration.StartWithoutDatabase
+	defer func() {
+		common.Configuration.MongoAddressCsv = savedAddress
+		common.Configuration.DatabaseConnectTimeout = savedTimeout
+		common.Configuration.StartWithoutDatabase = savedStart
+	}()
+	common.Configuration.MongoAddressCsv = "localhost:1"
+	common.Configuration.DatabaseConnectTimeout = 0
+
+	common.Configuration.StartWithoutDatabase = false
+	store := &MongoStorage{}
+	if err := store.Init(); err == nil {
+		store.Stop()
+		t.Errorf("Initialized storage driver without a database\n")
+	}
+
+	common.Configuration.StartWithoutDatabase = true
+	store = &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver without a database. Error: %s\n", err.Error())
+		return
+	}
+	if store.IsConnected() {
+		t.Errorf("Storage driver is connected without a database\n")
+	}
+	if _, err := store.RetrieveObject("myorg", "type1", "1"); err == nil {
+		t.Errorf("RetrieveObject succeeded without a database\n")
+	}
+
+	// Stopping the store ends the background connection attempts
+	stopped := make(chan bool)
+	go func() {
+		store.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Minute):
+		t.Errorf("Failed to stop the storage driver\n")
+	}
+}
+
+func TestMongoStorageWatchObjects(t *testing.T) {
+	common.Configuration.MongoDbName = "d_test_db"
+	store := &MongoStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	events, cancel, err := store.WatchObjects("watchorg")
+	if err != nil {
+		t.Errorf("Failed to watch the objects. Error: %s\n", err.Error())
+		return
+	}
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "watchorg", NoData: true}
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	// Objects of other organizations are filtered out
+	otherMetaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "otherorg", NoData: true}
+	if _, err := store.StoreObject(otherMetaData, nil, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	if err := store.UpdateObjectStatus("watchorg", "type1", "1", common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to update object's status. Error: %s\n", err.Error())
+	}
+	if err := store.DeleteStoredObject("watchorg", "type1", "1", ""); err != nil {
+		t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+	}
+	if err := store.DeleteStoredObject("otherorg", "type1", "1", ""); err != nil {
+		t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+	}
+
+	expected := []common.ObjectEvent{
+		{Type: common.ObjectEventCreated, OrgID: "watchorg", ObjectType: "type1", ObjectID: "1", Status: common.NotReadyToSend},
+		{Type: common.ObjectEventUpdated, OrgID: "watchorg", ObjectType: "type1", ObjectID: "1", Status: common.ReadyToSend},
+		{Type: common.ObjectEventDeleted, OrgID: "watchorg", ObjectType: "type1", ObjectID: "1"},
+	}
+	for i, expectedEvent := range expected {
+		select {
+		case event := <-events:
+			if event.Type != expectedEvent.Type || event.OrgID != expectedEvent.OrgID || event.ObjectType != expectedEvent.ObjectType ||
+				event.ObjectID != expectedEvent.ObjectID || event.Status != expectedEvent.Status {
+				t.Errorf("Wrong event %d: %+v instead of %+v\n", i, event, expectedEvent)
+			}
+			if (event.MetaData == nil) != (event.Type == common.ObjectEventDeleted) {
+				t.Errorf("Wrong meta data in event %d: %+v\n", i, event.MetaData)
+			}
+		case <-time.After(10 * time.Second):
+			t.Errorf("Didn't receive event %d\n", i)
+			return
+		}
+	}
+
+	// Canceling the watch closes the channel
+	cancel()
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Errorf("Received an event after canceling the watch\n")
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("The events channel wasn't closed after canceling the watch\n")
+	}
+}
+
 func TestMongoStorageDestinations(t *testing.T) {
 	common.Configuration.MongoDbName = "d_test_db"
 	store := &MongoStorage{}
@@ -80,6 +1038,13 @@ func TestMongoStorageDestinations(t *testing.T) {
 		}
 	}
 
+	destIDs := []common.DestinationID{{DestType: "device", DestID: "1"}, {DestType: "device2", DestID: "2"}, {DestType: "device", DestID: "2"}}
+	if exist, err := store.DestinationsExist("myorg123", destIDs); err != nil {
+		t.Errorf("DestinationsExist failed. Error: %s\n", err.Error())
+	} else if len(exist) != 3 || !exist[destIDs[0]] || !exist[destIDs[1]] || exist[destIDs[2]] {
+		t.Errorf("DestinationsExist returned wrong result: %v\n", exist)
+	}
+
 	if dests, err := store.RetrieveDestinations("myorg123", "device"); err != nil {
 		t.Errorf("RetrieveDestinations failed. Error: %s\n", err.Error())
 	} else if len(dests) != 1 {
@@ -140,6 +1105,14 @@ func TestMongoStorageNotifications(t *testing.T) {
 	testStorageNotifications(common.Mongo, t)
 }
 
+func TestMongoStorageNotificationResendBackoff(t *testing.T) {
+	testStorageNotificationResendBackoff(common.Mongo, t)
+}
+
+func TestMongoStorageDataComplete(t *testing.T) {
+	testStorageDataComplete(common.Mongo, t)
+}
+
 func TestMongoStorageOrgDeleteNotifications(t *testing.T) {
 	testStorageOrgDeleteNotifications(common.Mongo, t)
 }
@@ -148,6 +1121,18 @@ func TestMongoStorageOrgDeleteACLs(t *testing.T) {
 	testStorageOrgDeleteACLs(common.Mongo, t)
 }
 
+func TestMongoStorageCheckACL(t *testing.T) {
+	testStorageCheckACL(common.Mongo, t)
+}
+
+func TestMongoStorageACLUsernameNormalization(t *testing.T) {
+	testStorageACLUsernameNormalization(common.Mongo, t)
+}
+
+func TestMongoStorageRetrieveObjectsForDestination(t *testing.T) {
+	testStorageRetrieveObjectsForDestination(common.Mongo, t)
+}
+
 func TestMongoStorageMessagingGroups(t *testing.T) {
 	testStorageMessagingGroups(common.Mongo, t)
 }
@@ -156,6 +1141,14 @@ func TestMongoStorageObjectDestinations(t *testing.T) {
 	testStorageObjectDestinations(common.Mongo, t)
 }
 
+func TestMongoStorageIncompleteObjects(t *testing.T) {
+	testStorageIncompleteObjects(common.Mongo, t)
+}
+
+func TestMongoStorageNoDataObjects(t *testing.T) {
+	testStorageNoDataObjects(common.Mongo, t)
+}
+
 func TestMongoStorageWebhooks(t *testing.T) {
 	testStorageWebhooks(common.Mongo, t)
 }
@@ -167,3 +1160,118 @@ func TestMongoStorageOrganizations(t *testing.T) {
 func TestMongoStorageInactiveDestinations(t *testing.T) {
 	testStorageInactiveDestinations(common.Mongo, t)
 }
+
+func TestMongoStorageOfflineDestinations(t *testing.T) {
+	testStorageOfflineDestinations(common.Mongo, t)
+}
+
+func TestMongoStorageRegisterDestination(t *testing.T) {
+	testStorageRegisterDestination(common.Mongo, t)
+}
+
+func TestMongoStorageDecommissionDestination(t *testing.T) {
+	testStorageDecommissionDestination(common.Mongo, t)
+}
+
+func TestMongoQueryFingerprint(t *testing.T) {
+	tests := []struct {
+		query       interface{}
+		fingerprint string
+	}{
+		{nil, "{}"},
+		{bson.M{"_id": "org1:type1:1"}, "{_id:?}"},
+		{bson.M{"metadata.destination-org-id": "org1", "status": bson.M{"$in": []string{"a", "b"}}},
+			"{metadata.destination-org-id:?,status:{$in:?}}"},
+		{bson.M{"$or": []bson.M{bson.M{"a": 1}, bson.M{"b": 2}}}, "{$or:[{a:?},{b:?}]}"},
+		{bson.M{"$and": []interface{}{bson.M{"x": true}, "y"}}, "{$and:[{x:?},?]}"},
+		{bson.D{{Name: "b", Value: 1}, {Name: "a", Value: bson.M{"$gt": 2}}}, "{b:?,a:{$gt:?}}"},
+	}
+
+	for _, test := range tests {
+		if fingerprint := queryFingerprint(test.query); fingerprint != test.fingerprint {
+			t.Errorf("queryFingerprint(%v) returned %s instead of %s", test.query, fingerprint, test.fingerprint)
+		}
+	}
+
+	// Queries that differ only in their values have the same fingerprint
+	if queryFingerprint(bson.M{"_id": "a", "status": 1}) != queryFingerprint(bson.M{"status": 2, "_id": "b"}) {
+		t.Errorf("Queries with different values have different fingerprints")
+	}
+}
+
+func TestMongoStorageFileHandleReaders(t *testing.T) {
+	store := &MongoStorage{openFiles: make(map[string]*fileHandle), readerFiles: make(map[*mgo.GridFile]string)}
+	store.mapLock = make(chan int, 1)
+	store.mapLock <- 1
+
+	reader1 := &fileHandle{file: &mgo.GridFile{}}
+	reader2 := &fileHandle{file: &mgo.GridFile{}}
+	store.putFileHandle("id1", reader1)
+	store.putFileHandle("id1", reader2)
+
+	store.releaseFileHandle(reader1.file)
+	if fH := store.getFileHandle("id1"); fH == nil || fH.readers != 1 {
+		t.Errorf("The file handle was deleted while the file has an open reader")
+	}
+
+	// The upload of the file doesn't delete the handle of its readers
+	store.deleteFileHandle("id1")
+	if store.getFileHandle("id1") == nil {
+		t.Errorf("The file handle was deleted by the upload while the file has an open reader")
+	}
+
+	store.releaseFileHandle(reader2.file)
+	store.releaseFileHandle(reader2.file)
+	if store.getFileHandle("id1") != nil {
+		t.Errorf("The file handle wasn't deleted when the last reader was closed")
+	}
+
+	// An upload keeps its handle after the file's readers are closed
+	reader := &fileHandle{file: &mgo.GridFile{}}
+	upload := &fileHandle{file: &mgo.GridFile{}}
+	store.putFileHandle("id2", reader)
+	store.putUploadFileHandle("id2", upload)
+	store.releaseFileHandle(reader.file)
+	if fH := store.getFileHandle("id2"); fH != upload || !fH.uploading || fH.readers != 0 {
+		t.Errorf("The upload's file handle was deleted when the file's reader was closed")
+	}
+	store.deleteFileHandle("id2")
+	if store.getFileHandle("id2") != nil {
+		t.Errorf("The file handle wasn't deleted when the upload was done")
+	}
+}
+
+func TestMongoStorageMaxOpenDataFiles(t *testing.T) {
+	store := &MongoStorage{openFiles: make(map[string]*fileHandle), readerFiles: make(map[*mgo.GridFile]string)}
+	store.mapLock = make(chan int, 1)
+	store.mapLock <- 1
+
+	common.Configuration.MongoMaxOpenDataFiles = 2
+	common.Configuration.MongoOpenDataFileTimeout = 0
+	defer func() { common.Configuration.MongoMaxOpenDataFiles = 0 }()
+
+	readers := []*fileHandle{{file: &mgo.GridFile{}}, {file: &mgo.GridFile{}}}
+	for i, reader := range readers {
+		if err := store.reserveFileReader(); err != nil {
+			t.Errorf("Failed to reserve a data file reader. Error: %s", err.Error())
+		}
+		store.putFileHandle("id"+strconv.Itoa(i), reader)
+	}
+	if err := store.reserveFileReader(); err == nil || !IsTooManyOpenFiles(err) {
+		t.Errorf("Reserved a data file reader beyond MongoMaxOpenDataFiles. Error: %v", err)
+	}
+
+	// A reader is reserved once an open reader is closed
+	common.Configuration.MongoOpenDataFileTimeout = 5
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		store.releaseFileHandle(readers[0].file)
+	}()
+	if err := store.reserveFileReader(); err != nil {
+		t.Errorf("Failed to reserve a data file reader after a reader was closed. Error: %s", err.Error())
+	}
+	store.cancelFileReader()
+	if store.pendingReads != 0 {
+		t.Errorf("The reservation of the data file reader wasn't released")
+	}
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+const bsdiffMagic = "BSDIFF40"
+const bsdiffHeaderSize = 32
+
+// appendObjectDelta reconstructs the object's data from its stored data and a binary patch, and stores the result
+// as the new data of the object. The stored data must be the base data the patch was created from, identified
+// by its data ID, and the reconstructed data must match the provided size and SHA-256 hash (if not empty).
+// The object's lock is held from reading the base data until the result is stored, so that a concurrent update of
+// the object's data can't be overwritten by data reconstructed from an older base. The caller mustn't hold the lock.
+func appendObjectDelta(store Storage, orgID string, objectType string, objectID string, baseDataID int64,
+	patch io.Reader, size int64, hash string) common.SyncServiceError {
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	metaData, err := store.RetrieveObject(orgID, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	if metaData == nil {
+		return &NotFound{fmt.Sprintf("Object %s:%s:%s not found", orgID, objectType, objectID)}
+	}
+	if metaData.NoData || metaData.SourceDataURI != "" || metaData.DestinationDataURI != "" {
+		return &common.InvalidRequest{Message: "Can't apply a delta to an object without stored data"}
+	}
+	if metaData.DataID != baseDataID {
+		return &common.InvalidRequest{Message: fmt.Sprintf("The base data %d of the delta is no longer stored, the stored data is %d",
+			baseDataID, metaData.DataID)}
+	}
+	if err := checkObjectSize(objectType, size); err != nil {
+		return err
+	}
+
+	dataReader, err := store.RetrieveObjectData(orgID, objectType, objectID, "")
+	if err != nil {
+		return err
+	}
+	if dataReader == nil {
+		return &NotFound{fmt.Sprintf("The data of object %s:%s:%s not found", orgID, objectType, objectID)}
+	}
+	base, readErr := ioutil.ReadAll(dataReader)
+	store.CloseDataReader(dataReader)
+	if readErr != nil {
+		return &Error{fmt.Sprintf("Failed to read the base data of the delta. Error: %s.", readErr)}
+	}
+
+	data, patchErr := applyBinaryPatch(base, patch, size)
+	if patchErr != nil {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Failed to apply the delta. Error: %s", patchErr)}
+	}
+	if int64(len(data)) != size {
+		return &common.InvalidRequest{Message: fmt.Sprintf("The size of the data reconstructed from the delta is %d instead of %d",
+			len(data), size)}
+	}
+	if hash != "" {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), hash) {
+			return &common.InvalidRequest{Message: "The hash of the data reconstructed from the delta doesn't match"}
+		}
+	}
+
+	if found, err := store.StoreObjectData(orgID, objectType, objectID, bytes.NewReader(data)); err != nil {
+		return err
+	} else if !found {
+		return &NotFound{fmt.Sprintf("Object %s:%s:%s not found", orgID, objectType, objectID)}
+	}
+	return nil
+}
+
+// applyBinaryPatch applies a patch in the bsdiff (BSDIFF40) format to the old data and returns the new data.
+// The size of the new data in the patch header must be the expected size, so that a corrupt or hostile patch can't
+// make it allocate more than the expected size, which was checked against the maximum object size.
+func applyBinaryPatch(old []byte, patch io.Reader, expectedSize int64) ([]byte, error) {
+	patchData, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return nil, err
+	}
+	if len(patchData) < bsdiffHeaderSize || string(patchData[:8]) != bsdiffMagic {
+		return nil, fmt.Errorf("the patch isn't in the %s format", bsdiffMagic)
+	}
+	ctrlLength := bsdiffOfftin(patchData[8:16])
+	diffLength := bsdiffOfftin(patchData[16:24])
+	newSize := bsdiffOfftin(patchData[24:32])
+	if ctrlLength < 0 || diffLength < 0 || newSize < 0 ||
+		ctrlLength > int64(len(patchData)-bsdiffHeaderSize) ||
+		diffLength > int64(len(patchData)-bsdiffHeaderSize)-ctrlLength {
+		return nil, fmt.Errorf("corrupt patch header")
+	}
+	if newSize != expectedSize {
+		return nil, fmt.Errorf("the size of the new data in the patch is %d instead of %d", newSize, expectedSize)
+	}
+	ctrlStart := int64(bsdiffHeaderSize)
+	diffStart := ctrlStart + ctrlLength
+	extraStart := diffStart + diffLength
+	ctrlReader := bzip2.NewReader(bytes.NewReader(patchData[ctrlStart:diffStart]))
+	diffReader := bzip2.NewReader(bytes.NewReader(patchData[diffStart:extraStart]))
+	extraReader := bzip2.NewReader(bytes.NewReader(patchData[extraStart:]))
+
+	// The data is only allocated as it is read from the patch, so that a patch that declares a huge size
+	// fails when it runs out of blocks instead of allocating the declared size upfront
+	initialSize := newSize
+	if limit := int64(len(old) + len(patchData)); initialSize > limit {
+		initialSize = limit
+	}
+	data := bytes.NewBuffer(make([]byte, 0, initialSize))
+	var oldPosition, newPosition int64
+	ctrl := make([]byte, 24)
+	for newPosition < newSize {
+		if _, err := io.ReadFull(ctrlReader, ctrl); err != nil {
+			return nil, fmt.Errorf("failed to read the control block: %s", err)
+		}
+		diffSize := bsdiffOfftin(ctrl[0:8])
+		extraSize := bsdiffOfftin(ctrl[8:16])
+		seek := bsdiffOfftin(ctrl[16:24])
+
+		// Add the diff block to the old data
+		if diffSize < 0 || diffSize > newSize-newPosition {
+			return nil, fmt.Errorf("corrupt control block")
+		}
+		if _, err := io.CopyN(data, diffReader, diffSize); err != nil {
+			return nil, fmt.Errorf("failed to read the diff block: %s", err)
+		}
+		diff := data.Bytes()[newPosition:]
+		for i := int64(0); i < diffSize; i++ {
+			if oldPosition+i >= 0 && oldPosition+i < int64(len(old)) {
+				diff[i] += old[oldPosition+i]
+			}
+		}
+		newPosition += diffSize
+		oldPosition += diffSize
+
+		// Copy the extra block
+		if extraSize < 0 || extraSize > newSize-newPosition {
+			return nil, fmt.Errorf("corrupt control block")
+		}
+		if _, err := io.CopyN(data, extraReader, extraSize); err != nil {
+			return nil, fmt.Errorf("failed to read the extra block: %s", err)
+		}
+		newPosition += extraSize
+		oldPosition += seek
+	}
+	return data.Bytes(), nil
+}
+
+// bsdiffOfftin decodes an 8 byte sign-magnitude little endian integer of the bsdiff format
+func bsdiffOfftin(buf []byte) int64 {
+	value := int64(buf[7] & 0x7f)
+	for i := 6; i >= 0; i-- {
+		value = value*256 + int64(buf[i])
+	}
+	if buf[7]&0x80 != 0 {
+		value = -value
+	}
+	return value
+}
@@ -0,0 +1,427 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// An organization export is a stream of frames. Each frame starts with a one byte frame kind and a four bytes
+// (big endian) payload length, followed by the payload. The first frame is always the header that carries the
+// format version and the organization ID, the last frame is always an empty end frame.
+// Records are JSON encoded. The data of an object follows the object's record as a sequence of data frames
+// terminated by an empty data frame.
+const orgExportVersion = 1
+
+const (
+	exportHeaderFrame byte = iota + 1
+	exportOrganizationFrame
+	exportMessagingGroupFrame
+	exportDestinationFrame
+	exportACLFrame
+	exportWebhooksFrame
+	exportObjectFrame
+	exportObjectDataFrame
+	exportNotificationFrame
+	exportEndFrame
+	exportACLGroupFrame
+)
+
+const (
+	exportDataChunkSize   = 64 * 1024
+	maxExportRecordLength = 16 * 1024 * 1024
+)
+
+type exportHeader struct {
+	Version int    `json:"version"`
+	OrgID   string `json:"orgID"`
+}
+
+type exportedObject struct {
+	MetaData common.MetaData `json:"metaData"`
+	Status   string          `json:"status"`
+	HasData  bool            `json:"hasData"`
+}
+
+type exportedACL struct {
+	ACLType string            `json:"aclType"`
+	Key     string            `json:"key"`
+	Users   []common.ACLentry `json:"users"`
+}
+
+type exportedWebhooks struct {
+	ObjectType string   `json:"objectType"`
+	Hooks      []string `json:"hooks"`
+}
+
+type exportWriter struct {
+	writer io.Writer
+	buffer []byte
+}
+
+func (w *exportWriter) writeFrame(kind byte, payload []byte) common.SyncServiceError {
+	header := [5]byte{kind}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.writer.Write(header[:]); err != nil {
+		return &Error{fmt.Sprintf("Failed to write the organization export. Error: %s.", err)}
+	}
+	if len(payload) > 0 {
+		if _, err := w.writer.Write(payload); err != nil {
+			return &Error{fmt.Sprintf("Failed to write the organization export. Error: %s.", err)}
+		}
+	}
+	return nil
+}
+
+func (w *exportWriter) writeRecord(kind byte, record interface{}) common.SyncServiceError {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to encode an exported record. Error: %s.", err)}
+	}
+	return w.writeFrame(kind, payload)
+}
+
+// writeData streams the data through fixed size data frames
+func (w *exportWriter) writeData(dataReader io.Reader) common.SyncServiceError {
+	if w.buffer == nil {
+		w.buffer = make([]byte, exportDataChunkSize)
+	}
+	for {
+		n, err := dataReader.Read(w.buffer)
+		if n > 0 {
+			if err := w.writeFrame(exportObjectDataFrame, w.buffer[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return w.writeFrame(exportObjectDataFrame, nil)
+		}
+		if err != nil {
+			return &Error{fmt.Sprintf("Failed to read the data of an exported object. Error: %s.", err)}
+		}
+	}
+}
+
+// exportOrganization writes the state of the organization to the writer. The storage provides the records that
+// can't be enumerated through the Storage interface: the organization's objects, its notifications and its
+// webhooks keyed by object type. The data of the objects is streamed and never loaded into memory as a whole.
+func exportOrganization(store Storage, orgID string, writer io.Writer, objects []exportedObject,
+	notifications []common.Notification, hooks map[string][]string) common.SyncServiceError {
+	w := &exportWriter{writer: writer}
+	if err := w.writeRecord(exportHeaderFrame, exportHeader{Version: orgExportVersion, OrgID: orgID}); err != nil {
+		return err
+	}
+
+	org, err := store.RetrieveOrganizationInfo(orgID)
+	if err != nil {
+		return err
+	}
+	if org != nil {
+		if err := w.writeRecord(exportOrganizationFrame, org.Org); err != nil {
+			return err
+		}
+	}
+
+	messagingGroup, err := store.RetrieveMessagingGroup(orgID)
+	if err != nil {
+		return err
+	}
+	if messagingGroup != "" {
+		if err := w.writeRecord(exportMessagingGroupFrame, messagingGroup); err != nil {
+			return err
+		}
+	}
+
+	dests, err := store.RetrieveDestinations(orgID, "")
+	if err != nil {
+		return err
+	}
+	for _, dest := range dests {
+		if err := w.writeRecord(exportDestinationFrame, dest); err != nil {
+			return err
+		}
+	}
+
+	for _, aclType := range []string{common.DestinationsACLType, common.ObjectsACLType, common.DestinationObjectTypesACLType} {
+		keys, err := store.RetrieveACLsInOrg(aclType, orgID)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			users, err := store.RetrieveACL(aclType, orgID, key, "")
+			if err != nil {
+				return err
+			}
+			if err := w.writeRecord(exportACLFrame, exportedACL{ACLType: aclType, Key: key, Users: users}); err != nil {
+				return err
+			}
+		}
+	}
+
+	groups, err := store.RetrieveACLGroups(orgID)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err := w.writeRecord(exportACLGroupFrame, group); err != nil {
+			return err
+		}
+	}
+
+	for objectType, objectHooks := range hooks {
+		if len(objectHooks) == 0 {
+			continue
+		}
+		if err := w.writeRecord(exportWebhooksFrame, exportedWebhooks{ObjectType: objectType, Hooks: objectHooks}); err != nil {
+			return err
+		}
+	}
+
+	for _, object := range objects {
+		if err := exportObject(store, w, object); err != nil {
+			return err
+		}
+	}
+
+	for _, notification := range notifications {
+		if err := w.writeRecord(exportNotificationFrame, notification); err != nil {
+			return err
+		}
+	}
+
+	return w.writeFrame(exportEndFrame, nil)
+}
+
+func exportObject(store Storage, w *exportWriter, object exportedObject) common.SyncServiceError {
+	var dataReader io.Reader
+	if !object.MetaData.NoData {
+		var err error
+		dataReader, err = store.RetrieveObjectData(object.MetaData.DestOrgID, object.MetaData.ObjectType, object.MetaData.ObjectID, "")
+		if err != nil {
+			return err
+		}
+	}
+	if dataReader == nil {
+		return w.writeRecord(exportObjectFrame, object)
+	}
+	defer store.CloseDataReader(dataReader)
+
+	object.HasData = true
+	if err := w.writeRecord(exportObjectFrame, object); err != nil {
+		return err
+	}
+	return w.writeData(dataReader)
+}
+
+type exportReader struct {
+	reader io.Reader
+}
+
+func (r *exportReader) readFrameHeader() (byte, uint32, common.SyncServiceError) {
+	var header [5]byte
+	if _, err := io.ReadFull(r.reader, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, 0, &common.InvalidRequest{Message: "The organization export is truncated"}
+		}
+		return 0, 0, &Error{fmt.Sprintf("Failed to read the organization export. Error: %s.", err)}
+	}
+	return header[0], binary.BigEndian.Uint32(header[1:]), nil
+}
+
+func (r *exportReader) readPayload(length uint32) ([]byte, common.SyncServiceError) {
+	if length > maxExportRecordLength {
+		return nil, &common.InvalidRequest{Message: fmt.Sprintf("Record of %d bytes in the organization export is too large", length)}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, &common.InvalidRequest{Message: "The organization export is truncated"}
+		}
+		return nil, &Error{fmt.Sprintf("Failed to read the organization export. Error: %s.", err)}
+	}
+	return payload, nil
+}
+
+func (r *exportReader) readRecord(length uint32, record interface{}) common.SyncServiceError {
+	payload, err := r.readPayload(length)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(payload, record); err != nil {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Failed to decode a record of the organization export. Error: %s", err)}
+	}
+	return nil
+}
+
+// exportDataReader reads the data frames of an object, returning io.EOF at the terminating empty data frame
+type exportDataReader struct {
+	reader    *exportReader
+	remaining uint32
+	done      bool
+}
+
+func (d *exportDataReader) Read(p []byte) (int, error) {
+	for !d.done && d.remaining == 0 {
+		kind, length, err := d.reader.readFrameHeader()
+		if err != nil {
+			return 0, err
+		}
+		if kind != exportObjectDataFrame {
+			return 0, &common.InvalidRequest{Message: "Unexpected frame in the data of an object in the organization export"}
+		}
+		d.remaining = length
+		d.done = length == 0
+	}
+	if d.done {
+		return 0, io.EOF
+	}
+	if uint32(len(p)) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.reader.reader.Read(p)
+	d.remaining -= uint32(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// importOrganization stores the state of an organization read from an export created by exportOrganization.
+// The imported records are merged into the existing state of the organization.
+func importOrganization(store Storage, reader io.Reader) common.SyncServiceError {
+	r := &exportReader{reader: reader}
+	kind, length, err := r.readFrameHeader()
+	if err != nil {
+		return err
+	}
+	if kind != exportHeaderFrame {
+		return &common.InvalidRequest{Message: "The organization export doesn't start with a header"}
+	}
+	header := exportHeader{}
+	if err := r.readRecord(length, &header); err != nil {
+		return err
+	}
+	if header.Version != orgExportVersion {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Unsupported organization export version %d", header.Version)}
+	}
+
+	for {
+		kind, length, err := r.readFrameHeader()
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case exportEndFrame:
+			return nil
+
+		case exportOrganizationFrame:
+			org := common.Organization{}
+			if err := r.readRecord(length, &org); err != nil {
+				return err
+			}
+			if _, err := store.StoreOrganization(org); err != nil {
+				return err
+			}
+
+		case exportMessagingGroupFrame:
+			var messagingGroup string
+			if err := r.readRecord(length, &messagingGroup); err != nil {
+				return err
+			}
+			if err := store.StoreOrgToMessagingGroup(header.OrgID, messagingGroup); err != nil {
+				return err
+			}
+
+		case exportDestinationFrame:
+			dest := common.Destination{}
+			if err := r.readRecord(length, &dest); err != nil {
+				return err
+			}
+			if err := store.StoreDestination(dest); err != nil {
+				return err
+			}
+
+		case exportACLFrame:
+			acl := exportedACL{}
+			if err := r.readRecord(length, &acl); err != nil {
+				return err
+			}
+			if err := store.AddUsersToACL(acl.ACLType, header.OrgID, acl.Key, acl.Users); err != nil {
+				return err
+			}
+
+		case exportACLGroupFrame:
+			group := common.ACLGroup{}
+			if err := r.readRecord(length, &group); err != nil {
+				return err
+			}
+			if err := store.StoreACLGroup(group); err != nil {
+				return err
+			}
+
+		case exportWebhooksFrame:
+			hooks := exportedWebhooks{}
+			if err := r.readRecord(length, &hooks); err != nil {
+				return err
+			}
+			for _, url := range hooks.Hooks {
+				if err := store.AddWebhook(header.OrgID, hooks.ObjectType, url); err != nil {
+					return err
+				}
+			}
+
+		case exportObjectFrame:
+			object := exportedObject{}
+			if err := r.readRecord(length, &object); err != nil {
+				return err
+			}
+			if err := importObject(store, r, object); err != nil {
+				return err
+			}
+
+		case exportNotificationFrame:
+			notification := common.Notification{}
+			if err := r.readRecord(length, &notification); err != nil {
+				return err
+			}
+			if err := store.UpdateNotificationRecord(notification); err != nil {
+				return err
+			}
+
+		default:
+			return &common.InvalidRequest{Message: fmt.Sprintf("Unexpected frame kind %d in the organization export", kind)}
+		}
+	}
+}
+
+func importObject(store Storage, r *exportReader, object exportedObject) common.SyncServiceError {
+	metaData := object.MetaData
+	if _, err := store.StoreObject(metaData, nil, object.Status, common.SyncServiceIdentity); err != nil {
+		return err
+	}
+	if !object.HasData {
+		return nil
+	}
+
+	dataReader := &exportDataReader{reader: r}
+	if _, err := store.StoreObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, dataReader); err != nil {
+		return err
+	}
+	// Skip whatever the storage didn't consume to stay aligned on the frames
+	if _, err := io.Copy(ioutil.Discard, dataReader); err != nil {
+		return err
+	}
+
+	// Storing the data marks objects that aren't ready to be sent as ready, restore the exported status
+	if status, err := store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		return err
+	} else if status != object.Status {
+		return store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, object.Status, common.SyncServiceIdentity)
+	}
+	return nil
+}
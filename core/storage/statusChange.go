@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// ObjectStatusChange describes a change of the status of an object, or of the delivery status of an object to a destination
+type ObjectStatusChange struct {
+	OrgID      string
+	ObjectType string
+	ObjectID   string
+
+	// DestType and DestID are set if the delivery status of the object to the destination changed
+	DestType string
+	DestID   string
+
+	OldStatus string
+	NewStatus string
+}
+
+// ObjectStatusChangeHandler is called by the storage after the status of an object, or its delivery status to a
+// destination, has changed. It is called by UpdateObjectStatus, MarkObjectDeleted, and UpdateObjectDeliveryStatus,
+// without holding any of the storage's locks, so it may call the storage. Errors it returns are logged.
+type ObjectStatusChangeHandler func(change ObjectStatusChange) error
+
+var objectStatusChangeHandler ObjectStatusChangeHandler
+
+// SetObjectStatusChangeHandler is called by the code starting the Sync Service to set the handler to be notified of
+// status changes of objects. By default there is no handler.
+func SetObjectStatusChangeHandler(handler ObjectStatusChangeHandler) {
+	objectStatusChangeHandler = handler
+}
+
+// notifyObjectStatusChange calls the status change handler if there is one and the status has changed.
+// The caller must not hold any of the storage's locks.
+func notifyObjectStatusChange(change ObjectStatusChange) {
+	if objectStatusChangeHandler == nil || change.OldStatus == change.NewStatus {
+		return
+	}
+	if err := objectStatusChangeHandler(change); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("The object status change handler failed for %s:%s:%s (%s to %s). Error: %s\n", change.OrgID,
+			change.ObjectType, change.ObjectID, change.OldStatus, change.NewStatus, err)
+	}
+}
@@ -3,6 +3,9 @@ package storage
 import (
 	"fmt"
 	"io"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,14 +14,22 @@ import (
 )
 
 const (
-	destinations    = "syncDestinations"
-	leader          = "syncLeaderElection"
-	notifications   = "syncNotifications"
-	objects         = "syncObjects"
-	messagingGroups = "syncMessagingGroups"
-	webhooks        = "syncWebhooks"
-	organizations   = "syncOrganizations"
-	acls            = "syncACLs"
+	destinations      = "syncDestinations"
+	leader            = "syncLeaderElection"
+	notifications     = "syncNotifications"
+	objects           = "syncObjects"
+	messagingGroups   = "syncMessagingGroups"
+	webhooks          = "syncWebhooks"
+	organizations     = "syncOrganizations"
+	acls              = "syncACLs"
+	aclGroups         = "syncACLGroups"
+	apiTokens         = "syncAPITokens"
+	audit             = "syncAudit"
+	objectVersions    = "syncObjectVersions"
+	idempotencyKeys   = "syncIdempotencyKeys"
+	retentionPolicies = "syncRetentionPolicies"
+	webhookPolicies   = "syncWebhookPolicies"
+	webhookFailures   = "syncWebhookFailures"
 )
 
 // Storage is the interface for stores
@@ -35,15 +46,20 @@ type Storage interface {
 	// Cleanup erase the on disk Bolt databass only for ESS and test
 	Cleanup(isTest bool) common.SyncServiceError
 
-	// Store an object
+	// Store an object, identity is recorded in the audit log
 	// If the object already exists, return the changes in its destinations list (for CSS) - return the list of deleted destinations
-	StoreObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError)
+	StoreObject(metaData common.MetaData, data []byte, status string, identity string) ([]common.StoreDestinationStatus, common.SyncServiceError)
 
 	// Store object's data
 	// Return true if the object was found and updated
 	// Return false and no error, if the object doesn't exist
 	StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError)
 
+	// ReplaceObject replaces the meta data and the data of an existing object.
+	// Readers see either the previous meta data and data or the new ones, the previous data is removed after the replacement.
+	// The status and the destinations of the object are kept.
+	ReplaceObject(metaData common.MetaData, dataReader io.Reader, identity string) common.SyncServiceError
+
 	StoreObjectTempData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError)
 
 	RemoveObjectTempData(orgID string, objectType string, objectID string) common.SyncServiceError
@@ -53,8 +69,20 @@ type Storage interface {
 	// Append a chunk of data to the object's data
 	AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError
 
-	// Update object's status
-	UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError
+	// AppendObjectDelta reconstructs the data of the object from its stored data, which must be the base data with
+	// the provided data ID, and a binary patch in the bsdiff format, and stores the result as the object's data.
+	// The reconstructed data must match the provided size and hex encoded SHA-256 hash (if not empty).
+	// The object's lock (common.ObjectLocks) is taken for the whole operation, so the caller mustn't hold it.
+	AppendObjectDelta(orgID string, objectType string, objectID string, baseDataID int64, patch io.Reader, size int64, hash string) common.SyncServiceError
+
+	// Update object's status, identity is recorded in the audit log
+	UpdateObjectStatus(orgID string, objectType string, objectID string, status string, identity string) common.SyncServiceError
+
+	// Update the specified fields of the object's meta data, without modifying its destinations or data
+	PatchObjectMetadata(orgID string, objectType string, objectID string, patch map[string]interface{}) common.SyncServiceError
+
+	// TouchObject extends the expiration time of an object that is being delivered
+	TouchObject(orgID string, objectType string, objectID string, extendBy time.Duration) common.SyncServiceError
 
 	// Update object's source data URI
 	UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError
@@ -78,6 +106,10 @@ type Storage interface {
 	// If received is true, return objects marked as received
 	RetrieveUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError)
 
+	// WatchObjects returns a channel of the creation, update, and deletion events of the objects of the organization,
+	// and a function to stop watching. The channel is closed when the watch is stopped, or when the storage is stopped.
+	WatchObjects(orgID string) (<-chan common.ObjectEvent, func(), common.SyncServiceError)
+
 	// RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 	// If received is true, return objects marked as policy received
 	RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
@@ -94,29 +126,99 @@ type Storage interface {
 	// RetrieveAllObjects returns the list of all the objects of the specified type
 	RetrieveAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
 
-	// Return the list of all the objects that need to be sent to the destination
+	// RetrieveObjectStatusCounts returns the number of objects of the organization in each status.
+	// If objectType is empty, the objects of all types are counted.
+	RetrieveObjectStatusCounts(orgID string, objectType string) (map[string]int, common.SyncServiceError)
+
+	// RetrieveStorageStatsByType returns the number of objects of the organization, the total declared size of their data,
+	// and the total number of bytes used to store their data, per object type
+	RetrieveStorageStatsByType(orgID string) (map[string]common.ObjectTypeStorageStats, common.SyncServiceError)
+
+	// RetrieveObjectsWithMissingData returns the objects of the organization whose data should be in the storage
+	// but isn't, for example after a partial failure of an update of the object
+	RetrieveObjectsWithMissingData(orgID string) ([]common.MetaData, common.SyncServiceError)
+
+	// RetrieveIncompleteObjects returns the objects of the organization that at least one of their destinations
+	// didn't consume, with the number of these destinations in each delivery status. If objectType is not empty,
+	// only the objects of the type are returned. The objects are ordered by type and ID.
+	RetrieveIncompleteObjects(orgID string, objectType string) ([]common.IncompleteObject, common.SyncServiceError)
+
+	// RetrieveObjectsBySizeAndAge returns the objects of the organization whose data size is at least minSize bytes
+	// and that weren't updated for at least the given duration. The objects are ordered by decreasing data size.
+	RetrieveObjectsBySizeAndAge(orgID string, minSize int64, olderThan time.Duration) ([]common.MetaData, common.SyncServiceError)
+
+	// RetrieveObjectsApproachingDeadline returns the undelivered objects of the organization whose delivery deadline
+	// is within the given duration from now, including objects that already missed their deadline.
+	// The objects are ordered by their delivery deadline.
+	RetrieveObjectsApproachingDeadline(orgID string, within time.Duration) ([]common.MetaData, common.SyncServiceError)
+
+	// RetrieveObjectsAcrossOrgs retrieves up to limit objects of all the organizations that match the filter,
+	// ordered by organization, object type, and object ID, skipping the first offset objects. A limit of 0 means no limit.
+	// Returns the total number of matching objects as well.
+	RetrieveObjectsAcrossOrgs(filter common.ObjectFilter, offset int, limit int) ([]common.MetaData, int, common.SyncServiceError)
+
+	// Return the list of all the objects that need to be sent to the destination.
+	// At most MaxDeliveriesPerDestination objects are returned, the rest of the objects are left pending.
 	RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError)
 
+	// RetrieveObjectsForDestType returns the objects of the organization that are broadcast to all the destinations of the type
+	RetrieveObjectsForDestType(orgID string, destType string) ([]common.MetaData, common.SyncServiceError)
+
 	// RetrieveConsumedObjects returns all the consumed objects originated from this node
 	RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError)
 
 	// Return the object meta data with the specified parameters
 	RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError)
 
+	// RetrieveObjectsByIDs returns the meta data of the objects with the provided keys, in the order of the keys.
+	// Objects that don't exist are omitted from the result.
+	RetrieveObjectsByIDs(orgID string, keys []common.ObjectKey) ([]common.MetaData, common.SyncServiceError)
+
+	// RetrieveObjectMetadataBatch returns the meta data of the objects with the provided keys, in the order of the keys,
+	// with only the requested fields set. The fields are the bson names of the meta data fields, for example
+	// object-size or instance-id. The object type, object ID, and destination organization are always set.
+	// Objects that don't exist are omitted from the result.
+	RetrieveObjectMetadataBatch(orgID string, keys []common.ObjectKey, fields []string) ([]common.MetaData, common.SyncServiceError)
+
+	// RetrieveObjectInstanceID returns the instance ID of the stored object, or 0 if the object doesn't exist
+	RetrieveObjectInstanceID(orgID string, objectType string, objectID string) (int64, common.SyncServiceError)
+
 	// Return the object meta data and status with the specified parameters
 	RetrieveObjectAndStatus(orgID string, objectType string, objectID string) (*common.MetaData, string, common.SyncServiceError)
 
+	// RetrieveObjectIfModifiedSince returns the object meta data and status if the object was modified after the given time.
+	// The returned bool is false, and the meta data is nil, if the object wasn't modified.
+	// If the object doesn't exist, nil meta data is returned and the object is considered modified.
+	RetrieveObjectIfModifiedSince(orgID string, objectType string, objectID string, since time.Time) (*common.MetaData, string, bool, common.SyncServiceError)
+
 	// Return the object data with the specified parameters
-	RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError)
+	// The read is recorded in the audit log on behalf of the identity if Configuration.LogDataAccess is set,
+	// an empty identity denotes an internal read that is not recorded
+	// A nil reader is returned for objects without data (NoData), and for objects whose data isn't stored
+	RetrieveObjectData(orgID string, objectType string, objectID string, identity string) (io.Reader, common.SyncServiceError)
 
 	// Return the object data with the specified parameters
-	ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError)
+	// The read is recorded in the audit log in the same way as in RetrieveObjectData
+	// An object without data (NoData) is read as empty data with eof set, while a NotFound error is returned
+	// if the data of an object that is expected to have data isn't stored
+	ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64, identity string) ([]byte, bool, int, common.SyncServiceError)
+
+	// ReadPartialObjectData returns the object data with the specified parameters while the data may still be uploaded.
+	// During an upload of the data by AppendObjectData, only the data up to the committed offset of the upload is returned,
+	// and eof is false until the upload completes. Otherwise it is the same as ReadObjectData.
+	ReadPartialObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError)
 
 	// Close the data reader if necessary
 	CloseDataReader(dataReader io.Reader) common.SyncServiceError
 
-	// Marks the object as deleted
-	MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError
+	// Marks the object as deleted, identity is recorded in the audit log
+	MarkObjectDeleted(orgID string, objectType string, objectID string, identity string) common.SyncServiceError
+
+	// Return the objects of the organization that were marked as deleted
+	RetrieveDeletedObjects(orgID string) ([]common.MetaData, common.SyncServiceError)
+
+	// Restore an object marked as deleted to its status before the deletion
+	UndeleteObject(orgID string, objectType string, objectID string) common.SyncServiceError
 
 	// Mark an object's destination policy as having been received
 	MarkDestinationPolicyReceived(orgID string, objectType string, objectID string) common.SyncServiceError
@@ -124,11 +226,54 @@ type Storage interface {
 	// Mark object as active
 	ActivateObject(orgID string, objectType string, objectID string) common.SyncServiceError
 
+	// PinObject pins the object, so that it isn't deleted by AutoDelete or when it expires
+	PinObject(orgID string, objectType string, objectID string) common.SyncServiceError
+
+	// UnpinObject unpins the object, so that AutoDelete and its expiration apply to it again
+	UnpinObject(orgID string, objectType string, objectID string) common.SyncServiceError
+
 	// GetObjectsToActivate returns inactive objects that are ready to be activated
 	GetObjectsToActivate() ([]common.MetaData, common.SyncServiceError)
 
-	// Delete the object
-	DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError
+	// Delete the object, identity is recorded in the audit log
+	DeleteStoredObject(orgID string, objectType string, objectID string, identity string) common.SyncServiceError
+
+	// DeleteObjectsOfType deletes all the objects of the type in the organization and their data.
+	// Returns the number of deleted objects.
+	DeleteObjectsOfType(orgID string, objectType string) (int, common.SyncServiceError)
+
+	// Return the audit log of the object's mutations, ordered by time
+	RetrieveAuditLog(orgID string, objectType string, objectID string) ([]common.AuditRecord, common.SyncServiceError)
+
+	// PurgeAuditLog deletes the audit records older than olderThan
+	PurgeAuditLog(olderThan time.Duration) common.SyncServiceError
+
+	// RetrieveObjectVersions returns the meta data of the kept previous versions of the object, ordered by instance ID
+	RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.MetaData, common.SyncServiceError)
+
+	// RetrieveObjectVersion returns the meta data and the data of a kept previous version of the object.
+	// Returns nil if the version isn't kept. The data reader, if not nil, has to be closed with CloseDataReader.
+	RetrieveObjectVersion(orgID string, objectType string, objectID string, instanceID int64) (*common.MetaData, io.Reader, common.SyncServiceError)
+
+	// StoreRetentionPolicy stores the retention policy of an object type, replacing the existing policy of the type
+	StoreRetentionPolicy(policy common.RetentionPolicy) common.SyncServiceError
+
+	// RetrieveRetentionPolicy retrieves the retention policy of an object type, returns nil if the type doesn't have a policy
+	RetrieveRetentionPolicy(orgID string, objectType string) (*common.RetentionPolicy, common.SyncServiceError)
+
+	// RetrieveRetentionPolicies retrieves the retention policies of an organization,
+	// or of all the organizations if orgID is empty
+	RetrieveRetentionPolicies(orgID string) ([]common.RetentionPolicy, common.SyncServiceError)
+
+	// DeleteRetentionPolicy deletes the retention policy of an object type
+	DeleteRetentionPolicy(orgID string, objectType string) common.SyncServiceError
+
+	// IsIdempotencyKeyRecorded returns true if the idempotency key was recorded for an update of the object
+	// within the last IdempotencyKeyWindow seconds
+	IsIdempotencyKeyRecorded(orgID string, objectType string, objectID string, key string) (bool, common.SyncServiceError)
+
+	// RecordIdempotencyKey records the idempotency key of a successful update of the object
+	RecordIdempotencyKey(orgID string, objectType string, objectID string, key string) common.SyncServiceError
 
 	// Delete the object's data
 	DeleteStoredData(orgID string, objectType string, objectID string) common.SyncServiceError
@@ -170,27 +315,64 @@ type Storage interface {
 	// RetrieveWebhooks gets the webhooks for the object type
 	RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError)
 
+	// StoreWebhookRetryPolicy stores the webhook retry policy of an object type, replacing the existing policy of the type
+	StoreWebhookRetryPolicy(policy common.WebhookRetryPolicy) common.SyncServiceError
+
+	// RetrieveWebhookRetryPolicy retrieves the webhook retry policy of an object type, returns nil if the type doesn't have a policy
+	RetrieveWebhookRetryPolicy(orgID string, objectType string) (*common.WebhookRetryPolicy, common.SyncServiceError)
+
+	// DeleteWebhookRetryPolicy deletes the webhook retry policy of an object type
+	DeleteWebhookRetryPolicy(orgID string, objectType string) common.SyncServiceError
+
+	// StoreWebhookFailure records the failure of a webhook, replacing the previous failure of the webhook
+	StoreWebhookFailure(failure common.WebhookFailure) common.SyncServiceError
+
+	// RetrieveWebhookFailures retrieves the recorded webhook failures of an organization
+	RetrieveWebhookFailures(orgID string) ([]common.WebhookFailure, common.SyncServiceError)
+
+	// DeleteWebhookFailures deletes the recorded webhook failures of an object type,
+	// or of all the object types of the organization if objectType is empty
+	DeleteWebhookFailures(orgID string, objectType string) common.SyncServiceError
+
 	// Return all the destinations with the provided orgID and destType
 	RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError)
 
 	// Return true if the destination exists, and false otherwise
 	DestinationExists(orgID string, destType string, destID string) (bool, common.SyncServiceError)
 
+	// DestinationsExist returns a map indicating for each of the provided destinations whether it exists
+	DestinationsExist(orgID string, dests []common.DestinationID) (map[common.DestinationID]bool, common.SyncServiceError)
+
 	// Retrieve destination
 	RetrieveDestination(orgID string, destType string, destID string) (*common.Destination, common.SyncServiceError)
 
 	// Store the destination
 	StoreDestination(destination common.Destination) common.SyncServiceError
 
+	// StoreDestinations stores the destinations together. The returned errors correspond to the destinations,
+	// a nil error means that the destination was stored.
+	StoreDestinations(destinations []common.Destination) ([]common.SyncServiceError, common.SyncServiceError)
+
+	// RegisterDestination stores the destination when it registers or sends a heartbeat, and records the current time
+	// as the destination's last ping and connection times
+	RegisterDestination(destination common.Destination) common.SyncServiceError
+
 	// Delete the destination
 	DeleteDestination(orgID string, destType string, destID string) common.SyncServiceError
 
+	// DecommissionDestination removes the destination from the destinations lists of all the objects,
+	// and deletes its notifications and the destination itself
+	DecommissionDestination(orgID string, destType string, destID string) (*common.DecommissionedDestination, common.SyncServiceError)
+
 	// UpdateDestinationLastPingTime updates the last ping time for the destination
 	UpdateDestinationLastPingTime(destination common.Destination) common.SyncServiceError
 
 	// RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
 	RemoveInactiveDestinations(lastTimestamp time.Time)
 
+	// RetrieveOfflineDestinations returns the destinations of the organization that haven't connected for the provided duration
+	RetrieveOfflineDestinations(orgID string, idleFor time.Duration) ([]common.Destination, common.SyncServiceError)
+
 	// GetNumberOfDestinations returns the number of currently registered ESS nodes (for CSS)
 	GetNumberOfDestinations() (uint32, common.SyncServiceError)
 
@@ -200,6 +382,10 @@ type Storage interface {
 	// GetObjectsForDestination retrieves objects that are in use on a given node
 	GetObjectsForDestination(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError)
 
+	// RetrieveObjectsForDestination retrieves the meta data and status of the objects that are in use on a given node.
+	// If status is not empty, only objects with the given status are returned.
+	RetrieveObjectsForDestination(orgID string, destType string, destID string, status string) ([]common.ObjectStatusWithMetaData, common.SyncServiceError)
+
 	// RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and returns the list of metadata
 	RetrieveAllObjectsAndUpdateDestinationListForDestination(orgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError)
 
@@ -212,7 +398,12 @@ type Storage interface {
 	// Update/add a notification record to an object
 	UpdateNotificationRecord(notification common.Notification) common.SyncServiceError
 
-	// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+	// UpdateNotificationRecords updates/adds the notification records, for example the notifications of an object
+	// to all its destinations, in as few writes as the storage allows
+	UpdateNotificationRecords(notifications []common.Notification) common.SyncServiceError
+
+	// UpdateNotificationResendTime increments the resend attempts of the notification and sets its resend time
+	// according to the number of attempts (see common.GetNotificationResendInterval)
 	UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError
 
 	// RetrieveNotificationRecord retrieves notification
@@ -221,6 +412,10 @@ type Storage interface {
 	// Delete notification records to an object
 	DeleteNotificationRecords(orgID string, objectType string, objectID string, destType string, destID string) common.SyncServiceError
 
+	// PurgeCompletedNotifications deletes the notifications in a completed state that weren't updated for longer than olderThan.
+	// If orgID is empty, the notifications of all the organizations are purged. Returns the number of deleted notifications.
+	PurgeCompletedNotifications(orgID string, olderThan time.Duration) (int, common.SyncServiceError)
+
 	// Return the list of all the notifications that need to be resent to the destination
 	RetrieveNotifications(orgID string, destType string, destID string, retrieveReceived bool) ([]common.Notification, common.SyncServiceError)
 
@@ -239,12 +434,22 @@ type Storage interface {
 	// UpdateLeader updates the leader entry for a leadership takeover
 	UpdateLeader(leaderID string, version int64) (bool, common.SyncServiceError)
 
+	// RequestLeaderHandoff asks the leader to hand off the leadership, if its priority is lower than this node's priority
+	// (see common.LeaderPriority). The leader's next periodic update fails, and it resigns.
+	// Returns true if the handoff was requested.
+	RequestLeaderHandoff(leaderID string, version int64) (bool, common.SyncServiceError)
+
 	// ResignLeadership causes this sync service to give up the Leadership
 	ResignLeadership(leaderID string) common.SyncServiceError
 
 	// RetrieveTimeOnServer retrieves the current time on the database server
 	RetrieveTimeOnServer() (time.Time, error)
 
+	// IsLeaderAlive returns true if the leader's last heartbeat is within its heartbeat timeout, together with the leader's ID.
+	// The heartbeat is compared against the time on the database server, so the local clock's skew doesn't matter.
+	// Returns a NotFound error if there is no leader document.
+	IsLeaderAlive() (bool, string, common.SyncServiceError)
+
 	// StoreOrgToMessagingGroup inserts organization to messaging groups table
 	StoreOrgToMessagingGroup(orgID string, messagingGroup string) common.SyncServiceError
 
@@ -257,9 +462,18 @@ type Storage interface {
 	// RetrieveUpdatedMessagingGroups retrieves messaging groups that were updated after the specified time
 	RetrieveUpdatedMessagingGroups(time time.Time) ([]common.MessagingGroup, common.SyncServiceError)
 
+	// RetrieveDestinationsInMessagingGroup returns all the destinations of the organizations in the messaging group
+	RetrieveDestinationsInMessagingGroup(groupName string) ([]common.Destination, common.SyncServiceError)
+
 	// DeleteOrganization cleans up the storage from all the records associated with the organization
 	DeleteOrganization(orgID string) common.SyncServiceError
 
+	// ExportOrganization writes all the records associated with the organization to the writer
+	ExportOrganization(orgID string, w io.Writer) common.SyncServiceError
+
+	// ImportOrganization stores the records of an organization read from an export created by ExportOrganization
+	ImportOrganization(r io.Reader) common.SyncServiceError
+
 	// StoreOrganization stores organization information
 	// Returns the stored record timestamp for multiple CSS updates
 	StoreOrganization(org common.Organization) (time.Time, common.SyncServiceError)
@@ -273,6 +487,11 @@ type Storage interface {
 	// RetrieveOrganizations retrieves stored organizations' info
 	RetrieveOrganizations() ([]common.StoredOrganization, common.SyncServiceError)
 
+	// RetrieveOrganizationsPage retrieves up to limit stored organizations' info, ordered by organization ID,
+	// skipping the first offset organizations. A limit of 0 means no limit.
+	// Returns the total number of stored organizations as well.
+	RetrieveOrganizationsPage(offset int, limit int) ([]common.StoredOrganization, int, common.SyncServiceError)
+
 	// RetrieveUpdatedOrganizations retrieves organizations that were updated after the specified time
 	RetrieveUpdatedOrganizations(time time.Time) ([]common.StoredOrganization, common.SyncServiceError)
 
@@ -282,6 +501,9 @@ type Storage interface {
 	// RemoveUsersFromACL removes users from an ACL
 	RemoveUsersFromACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError
 
+	// SetACL replaces the users of an ACL with the provided users, an empty list of users deletes the ACL
+	SetACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError
+
 	// RetrieveACL retrieves the list of usernames on an ACL
 	RetrieveACL(aclType string, orgID string, key string, aclUserType string) ([]common.ACLentry, common.SyncServiceError)
 
@@ -291,6 +513,38 @@ type Storage interface {
 	// RetrieveObjOrDestTypeForGivenACLUser retrieves object types that given acl user has access to
 	RetrieveObjOrDestTypeForGivenACLUser(aclType string, orgID string, aclUserType string, aclUsername string, aclRole string) ([]string, common.SyncServiceError)
 
+	// NormalizeACLUsernames rewrites the stored ACLs with normalized usernames, merging the entries of the same user.
+	// Returns the number of the modified ACLs.
+	NormalizeACLUsernames() (int, common.SyncServiceError)
+
+	// CheckACL returns true if the user is granted access by the ACL of the key or by the ACL of all the keys,
+	// either directly, by a wildcard entry, or by the membership in a group
+	CheckACL(aclType string, orgID string, key string, username string) (bool, common.SyncServiceError)
+
+	// StoreACLGroup stores an ACL group, replacing its members if it already exists
+	StoreACLGroup(group common.ACLGroup) common.SyncServiceError
+
+	// RetrieveACLGroup retrieves an ACL group, returns nil if the group doesn't exist
+	RetrieveACLGroup(orgID string, name string) (*common.ACLGroup, common.SyncServiceError)
+
+	// RetrieveACLGroups retrieves the ACL groups of an organization
+	RetrieveACLGroups(orgID string) ([]common.ACLGroup, common.SyncServiceError)
+
+	// DeleteACLGroup deletes an ACL group
+	DeleteACLGroup(orgID string, name string) common.SyncServiceError
+
+	// StoreAPIToken stores an API token, replacing it if a token with the same hash already exists
+	StoreAPIToken(token common.APIToken) common.SyncServiceError
+
+	// RetrieveAPIToken retrieves the API token with the given hash, returns nil if the token doesn't exist
+	RetrieveAPIToken(hash string) (*common.APIToken, common.SyncServiceError)
+
+	// RetrieveAPITokens retrieves the API tokens of an organization
+	RetrieveAPITokens(orgID string) ([]common.APIToken, common.SyncServiceError)
+
+	// RevokeAPIToken deletes the API token with the given hash, the token can't be used after it is revoked
+	RevokeAPIToken(hash string) common.SyncServiceError
+
 	// IsConnected returns false if the storage cannont be reached, and true otherwise
 	IsConnected() bool
 
@@ -354,33 +608,166 @@ func IsDiscarded(err error) bool {
 	return ok
 }
 
+// Backpressure is the error returned if an out-of-order chunk wasn't appended to the stored object because too many
+// out-of-order chunks are already buffered. The chunk should be sent again after the missing in-order chunk, which
+// starts at NextOffset, was appended.
+type Backpressure struct {
+	message    string
+	NextOffset int64
+}
+
+func (e *Backpressure) Error() string {
+	return e.message
+}
+
+// IsBackpressure returns true if the error passed in is the storage.Backpressure error
+func IsBackpressure(err error) bool {
+	_, ok := err.(*Backpressure)
+	return ok
+}
+
+// TooManyOpenFiles is the error returned if the data of an object can't be read because the maximal number
+// of data files are open and none was closed in time
+type TooManyOpenFiles struct {
+	message string
+}
+
+func (e *TooManyOpenFiles) Error() string {
+	return e.message
+}
+
+// IsTooManyOpenFiles returns true if the error passed in is the storage.TooManyOpenFiles error
+func IsTooManyOpenFiles(err error) bool {
+	_, ok := err.(*TooManyOpenFiles)
+	return ok
+}
+
 // Objects
 func getObjectCollectionID(metaData common.MetaData) string {
 	return createObjectCollectionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 }
 
 func createObjectCollectionID(orgID string, objectType string, objectID string) string {
-	var strBuilder strings.Builder
-	strBuilder.Grow(len(orgID) + len(objectType) + len(objectID) + 3)
-	strBuilder.WriteString(orgID)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(objectType)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(objectID)
-	return strBuilder.String()
+	return common.CreateCompositeID(orgID, objectType, objectID)
 }
 
 func createTempObjectCollectionID(orgID string, objectType string, objectID string) string {
-	var strBuilder strings.Builder
-	strBuilder.Grow(len(orgID) + len(objectType) + len(objectID) + len("tmp") + 4)
-	strBuilder.WriteString(orgID)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(objectType)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(objectID)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString("tmp")
-	return strBuilder.String()
+	return common.CreateCompositeID(orgID, objectType, objectID, "tmp")
+}
+
+// deliveryLimitReached returns true if the number of objects marked as being delivered to a destination
+// in a single retrieval reached MaxDeliveriesPerDestination
+func deliveryLimitReached(delivering int) bool {
+	return common.Configuration.MaxDeliveriesPerDestination > 0 && delivering >= common.Configuration.MaxDeliveriesPerDestination
+}
+
+func createObjectVersionCollectionID(orgID string, objectType string, objectID string, instanceID int64) string {
+	return common.CreateCompositeID(orgID, objectType, objectID, strconv.FormatInt(instanceID, 10))
+}
+
+// checkReplacementMetaData verifies that the meta data can replace the meta data and the data of an object
+func checkReplacementMetaData(metaData common.MetaData) common.SyncServiceError {
+	if err := metaData.Validate(); err != nil {
+		return err
+	}
+	if metaData.NoData || metaData.MetaOnly || metaData.SourceDataURI != "" {
+		return &common.InvalidRequest{Message: "Can't replace the data of an object without data"}
+	}
+	return nil
+}
+
+// createReplacedDataFileName returns the name of the file of the data written by ReplaceObject
+func createReplacedDataFileName(id string, instanceID int64) string {
+	separator := common.CompositeIDSeparator()
+	return id + separator + "data" + separator + strconv.FormatInt(instanceID, 10)
+}
+
+// leaderHeartbeatExpired returns true if the time since the leader's last heartbeat exceeds its heartbeat timeout (in seconds)
+func leaderHeartbeatExpired(lastHeartbeat time.Time, now time.Time, heartbeatTimeout int32) bool {
+	return int32(now.Sub(lastHeartbeat)/time.Second) > heartbeatTimeout
+}
+
+// completedNotificationStatuses are the statuses of notifications whose exchange with the destination is complete
+var completedNotificationStatuses = []string{common.Consumed, common.AckConsumed, common.Deleted, common.AckDeleted}
+
+// isPurgeableNotification returns true if the notification is in a completed state and wasn't updated since the cutoff
+func isPurgeableNotification(notification common.Notification, orgID string, cutoff int64) bool {
+	if (orgID != "" && notification.DestOrgID != orgID) || notification.LastUpdate >= cutoff {
+		return false
+	}
+	for _, status := range completedNotificationStatuses {
+		if notification.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// completedNotificationsMaxAge returns the age after which completed notifications are purged by the maintenance,
+// 0 if they aren't purged
+func completedNotificationsMaxAge() time.Duration {
+	return time.Hour * time.Duration(common.Configuration.CompletedNotificationsMaxAge)
+}
+
+func createIdempotencyKeyID(orgID string, objectType string, objectID string, key string) string {
+	return common.CreateCompositeID(orgID, objectType, objectID, key)
+}
+
+// idempotencyKeyExpired returns true if an idempotency key recorded at the given time is outside of the IdempotencyKeyWindow
+func idempotencyKeyExpired(recorded time.Time) bool {
+	return time.Since(recorded) > time.Second*time.Duration(common.Configuration.IdempotencyKeyWindow)
+}
+
+// objectVersionsKept returns the number of previous versions kept for the objects of the type, as set by the
+// retention policy of the type if it sets it, otherwise by the configuration
+func objectVersionsKept(policy *common.RetentionPolicy, objectType string) int {
+	if policy != nil && policy.MaxVersions != nil {
+		return *policy.MaxVersions
+	}
+	return common.ObjectVersionsKeptForType(objectType)
+}
+
+// objectVersionsToPrune returns the versions that exceed the number of versions kept for their object type,
+// the most recent versions (with the highest instance IDs) of each object are kept
+func objectVersionsToPrune(versions []common.MetaData, policies []common.RetentionPolicy) []common.MetaData {
+	policiesByType := retentionPoliciesByType(policies)
+	versionsByObject := make(map[string][]common.MetaData)
+	for _, version := range versions {
+		id := createObjectCollectionID(version.DestOrgID, version.ObjectType, version.ObjectID)
+		versionsByObject[id] = append(versionsByObject[id], version)
+	}
+
+	result := make([]common.MetaData, 0)
+	for _, objectHistory := range versionsByObject {
+		kept := objectVersionsKept(policiesByType[common.CreateCompositeID(objectHistory[0].DestOrgID, objectHistory[0].ObjectType)],
+			objectHistory[0].ObjectType)
+		if len(objectHistory) <= kept {
+			continue
+		}
+		sort.Slice(objectHistory, func(i, j int) bool { return objectHistory[i].InstanceID > objectHistory[j].InstanceID })
+		result = append(result, objectHistory[kept:]...)
+	}
+	return result
+}
+
+// retentionPoliciesByType returns the retention policies keyed by their organization and object type
+func retentionPoliciesByType(policies []common.RetentionPolicy) map[string]*common.RetentionPolicy {
+	policiesByType := make(map[string]*common.RetentionPolicy, len(policies))
+	for i := range policies {
+		policiesByType[common.CreateCompositeID(policies[i].OrgID, policies[i].ObjectType)] = &policies[i]
+	}
+	return policiesByType
+}
+
+// retentionExpired returns true if the object has to be deleted by the retention policy of its type.
+// Only objects that originated at this node and aren't pinned are deleted.
+func retentionExpired(policiesByType map[string]*common.RetentionPolicy, metaData common.MetaData, status string,
+	lastUpdate time.Time, now time.Time) bool {
+	policy := policiesByType[common.CreateCompositeID(metaData.DestOrgID, metaData.ObjectType)]
+	if policy == nil || policy.MaxAge <= 0 || metaData.Pinned || (status != common.NotReadyToSend && status != common.ReadyToSend) {
+		return false
+	}
+	return now.Sub(lastUpdate) > time.Second*time.Duration(policy.MaxAge)
 }
 
 // Notifications
@@ -393,20 +780,78 @@ func createNotificationCollectionID(orgID string, objectType string, objectID st
 	return common.CreateNotificationID(orgID, objectType, objectID, destType, destID)
 }
 
+// scheduleNotificationResend sets the resend time of a notification that is stored without one.
+// When the notification is stored again with the status and the instance of the stored notification, the redundant
+// update doesn't reschedule it: its resend time and resend attempts are kept, so that the resend backoff isn't reset.
+func scheduleNotificationResend(notification *common.Notification, existing *common.Notification) {
+	if notification.ResendTime != 0 {
+		return
+	}
+	if existing != nil && existing.ResendTime != 0 && existing.Status == notification.Status &&
+		existing.InstanceID == notification.InstanceID && existing.DataID == notification.DataID {
+		notification.ResendTime = existing.ResendTime
+		notification.ResendAttempts = existing.ResendAttempts
+		return
+	}
+	notification.ResendTime = time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+}
+
 // Destinations
 func getDestinationCollectionID(destination common.Destination) string {
 	return createDestinationCollectionID(destination.DestOrgID, destination.DestType, destination.DestID)
 }
 
 func createDestinationCollectionID(orgID string, destType string, destID string) string {
-	var strBuilder strings.Builder
-	strBuilder.Grow(len(orgID) + len(destType) + len(destID) + 3)
-	strBuilder.WriteString(orgID)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(destType)
-	strBuilder.WriteByte(':')
-	strBuilder.WriteString(destID)
-	return strBuilder.String()
+	return common.CreateCompositeID(orgID, destType, destID)
+}
+
+func createWebhookID(orgID string, objectType string) string {
+	return common.CreateCompositeID(orgID, objectType)
+}
+
+// createOrgIDPrefix returns the prefix of the composite IDs of the organization's records
+func createOrgIDPrefix(orgID string) string {
+	return common.CreateCompositeID(orgID, "")
+}
+
+func createACLID(orgID string, aclType string, key string) string {
+	return common.CreateCompositeID(orgID, aclType, key)
+}
+
+// parseACLKey returns the key of an ACL from its ID, or false if the ID isn't an ACL ID
+func parseACLKey(id string) (string, bool) {
+	parts, err := common.ParseCompositeID(id)
+	if err != nil || len(parts) != 3 {
+		return "", false
+	}
+	return parts[2], true
+}
+
+func createACLGroupID(orgID string, name string) string {
+	return common.CreateCompositeID(orgID, name)
+}
+
+// normalizeDestinationID normalizes the organization, type, and ID of a destination that is looked up, in the same
+// way as the destinations are normalized when they are stored
+func normalizeDestinationID(orgID string, destType string, destID string) (string, string, string) {
+	destination := common.Destination{DestOrgID: orgID, DestType: destType, DestID: destID}
+	destination.Normalize()
+	return destination.DestOrgID, destination.DestType, destination.DestID
+}
+
+// normalizeDestinationIDs normalizes the organization and the destinations that are looked up, the normalized
+// destinations are returned in the order of the provided destinations
+func normalizeDestinationIDs(orgID string, dests []common.DestinationID) (string, []common.DestinationID) {
+	normalized := make([]common.DestinationID, len(dests))
+	for i, dest := range dests {
+		_, normalized[i].DestType, normalized[i].DestID = normalizeDestinationID(orgID, dest.DestType, dest.DestID)
+	}
+	return strings.TrimSpace(orgID), normalized
+}
+
+// createDestinationKey returns the key of a destination within its organization
+func createDestinationKey(destType string, destID string) string {
+	return common.CreateCompositeID(destType, destID)
 }
 
 func resendNotification(notification common.Notification, retrieveReceived bool) bool {
@@ -415,6 +860,376 @@ func resendNotification(notification common.Notification, retrieveReceived bool)
 		(retrieveReceived && (s == common.Data || s == common.ReceivedByDestination)))
 }
 
+// metaDataFieldIndexes maps the bson names of the meta data fields to their indexes in the MetaData struct
+var metaDataFieldIndexes = func() map[string]int {
+	indexes := make(map[string]int)
+	metaDataType := reflect.TypeOf(common.MetaData{})
+	for i := 0; i < metaDataType.NumField(); i++ {
+		name := strings.Split(metaDataType.Field(i).Tag.Get("bson"), ",")[0]
+		if name != "" && name != "-" {
+			indexes[name] = i
+		}
+	}
+	return indexes
+}()
+
+// Meta data fields that are always returned by RetrieveObjectMetadataBatch
+var metaDataKeyFields = []string{"object-type", "object-id", "destination-org-id"}
+
+// validateMetaDataFields checks that the requested fields are meta data fields
+func validateMetaDataFields(fields []string) common.SyncServiceError {
+	for _, field := range fields {
+		if _, ok := metaDataFieldIndexes[field]; !ok {
+			return &Error{fmt.Sprintf("Invalid meta data field %s.", field)}
+		}
+	}
+	return nil
+}
+
+// projectMetaData returns a copy of the meta data with only the requested fields and the key fields set
+func projectMetaData(metaData common.MetaData, fields []string) common.MetaData {
+	projected := common.MetaData{}
+	source := reflect.ValueOf(metaData)
+	target := reflect.ValueOf(&projected).Elem()
+	for _, list := range [][]string{metaDataKeyFields, fields} {
+		for _, field := range list {
+			if index, ok := metaDataFieldIndexes[field]; ok {
+				target.Field(index).Set(source.Field(index))
+			}
+		}
+	}
+	return projected
+}
+
+// retrieveObjectMetadataBatch implements RetrieveObjectMetadataBatch for the stores that keep the meta data in memory
+// or serialized as a whole, the meta data is retrieved and then projected
+func retrieveObjectMetadataBatch(store Storage, orgID string, keys []common.ObjectKey, fields []string) ([]common.MetaData,
+	common.SyncServiceError) {
+	if err := validateMetaDataFields(fields); err != nil {
+		return nil, err
+	}
+	metaDatas, err := store.RetrieveObjectsByIDs(orgID, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, metaData := range metaDatas {
+		metaDatas[i] = projectMetaData(metaData, fields)
+	}
+	return metaDatas, nil
+}
+
+// storedDataComplete returns true if all the data of an object stored by StoreObject is available: the data is stored
+// with the meta data or read from a source data URI, or the data of the existing object is kept by a meta data only update
+func storedDataComplete(metaData common.MetaData, data []byte, existingDataComplete bool) bool {
+	if metaData.SourceDataURI != "" || (!metaData.NoData && data != nil) {
+		return true
+	}
+	return metaData.MetaOnly && existingDataComplete
+}
+
+// normalizeObjectTimes converts the activation and expiration times of the object to UTC.
+// These times are compared as strings with the current time formatted as RFC3339 in UTC, therefore times
+// provided with a different offset have to be normalized.
+func normalizeObjectTimes(metaData *common.MetaData) {
+	if metaData.ActivationTime != "" {
+		if activationTime, err := time.Parse(time.RFC3339, metaData.ActivationTime); err == nil {
+			metaData.ActivationTime = activationTime.UTC().Format(time.RFC3339)
+		}
+	}
+	if metaData.Expiration != "" {
+		if expiration, err := time.Parse(time.RFC3339, metaData.Expiration); err == nil {
+			metaData.Expiration = expiration.UTC().Format(time.RFC3339)
+		}
+	}
+	if metaData.DeliveryDeadline != "" {
+		if deadline, err := time.Parse(time.RFC3339, metaData.DeliveryDeadline); err == nil {
+			metaData.DeliveryDeadline = deadline.UTC().Format(time.RFC3339)
+		}
+	}
+}
+
+// undeliveredDestinationStatuses are the delivery statuses of destinations that haven't received the object yet
+var undeliveredDestinationStatuses = []string{common.Pending, common.Delivering, common.Error}
+
+// setDeliveryStatus sets the delivery status of the object for the destination.
+// Setting the status to Delivering counts a delivery attempt.
+func setDeliveryStatus(destination *common.StoreDestinationStatus, status string) {
+	destination.Status = status
+	if status == common.Delivering {
+		destination.AttemptCount++
+		destination.LastAttempt = time.Now().UTC().Format(time.RFC3339)
+	}
+}
+
+// dataStatuses are the statuses of objects whose data is in the storage
+var dataStatuses = []string{common.ReadyToSend, common.CompletelyReceived, common.ObjReceived}
+
+// objectExpectsData returns true if the data of the object should be in the storage: the object has data that isn't read
+// from a source data URI, and the object is ready to be sent or was received completely
+func objectExpectsData(metaData common.MetaData, status string) bool {
+	if metaData.NoData || metaData.SourceDataURI != "" || metaData.Deleted {
+		return false
+	}
+	for _, dataStatus := range dataStatuses {
+		if status == dataStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// deliveryDeadlineLimit returns the latest delivery deadline of objects approaching their deadline within
+// the given duration, in the normalized format of the DeliveryDeadline field
+func deliveryDeadlineLimit(within time.Duration) (string, common.SyncServiceError) {
+	if within < 0 {
+		return "", &common.InvalidRequest{Message: "The duration until the delivery deadline must be non-negative"}
+	}
+	return time.Now().Add(within).UTC().Format(time.RFC3339), nil
+}
+
+// isObjectApproachingDeadline returns true if the object has a delivery deadline that is not later than the limit,
+// and it hasn't been delivered to all its destinations
+func isObjectApproachingDeadline(metaData common.MetaData, status string, destinations []common.StoreDestinationStatus,
+	limit string) bool {
+	if metaData.DeliveryDeadline == "" || metaData.DeliveryDeadline > limit {
+		return false
+	}
+	if status != common.NotReadyToSend && status != common.ReadyToSend {
+		return false
+	}
+	if len(destinations) == 0 {
+		return true
+	}
+	for _, destination := range destinations {
+		for _, undelivered := range undeliveredDestinationStatuses {
+			if destination.Status == undelivered {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// objectsBySizeAndAgeLimit validates the arguments of RetrieveObjectsBySizeAndAge and returns the time
+// before which the objects were last updated
+func objectsBySizeAndAgeLimit(minSize int64, olderThan time.Duration) (time.Time, common.SyncServiceError) {
+	if minSize < 0 {
+		return time.Time{}, &common.InvalidRequest{Message: "The minimal object size must be non-negative"}
+	}
+	if olderThan < 0 {
+		return time.Time{}, &common.InvalidRequest{Message: "The age of the objects must be non-negative"}
+	}
+	return time.Now().Add(-olderThan), nil
+}
+
+// incompleteObject returns the summary of the destinations of an object that didn't consume it,
+// returns false if all the destinations consumed the object or if the object is marked as deleted
+func incompleteObject(metaData common.MetaData, destinations []common.StoreDestinationStatus) (common.IncompleteObject, bool) {
+	result := common.IncompleteObject{MetaData: metaData, StatusCounts: make(map[string]int)}
+	if metaData.Deleted {
+		return result, false
+	}
+	for _, destination := range destinations {
+		if destination.Status != common.Consumed {
+			result.PendingDestinations++
+			result.StatusCounts[destination.Status]++
+		}
+	}
+	return result, result.PendingDestinations > 0
+}
+
+// sortIncompleteObjects sorts the incomplete objects by object type and ID
+func sortIncompleteObjects(objects []common.IncompleteObject) {
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].MetaData.ObjectType != objects[j].MetaData.ObjectType {
+			return objects[i].MetaData.ObjectType < objects[j].MetaData.ObjectType
+		}
+		return objects[i].MetaData.ObjectID < objects[j].MetaData.ObjectID
+	})
+}
+
+// sortBySizeDescending sorts the objects' meta data by decreasing data size
+func sortBySizeDescending(metaDatas []common.MetaData) {
+	sort.Slice(metaDatas, func(i, j int) bool { return metaDatas[i].ObjectSize > metaDatas[j].ObjectSize })
+}
+
+// sortByDeliveryDeadline sorts the objects' meta data by delivery deadline
+func sortByDeliveryDeadline(metaDatas []common.MetaData) {
+	sort.Slice(metaDatas, func(i, j int) bool { return metaDatas[i].DeliveryDeadline < metaDatas[j].DeliveryDeadline })
+}
+
+// checkObjectUndeletable verifies that an object with the given status and status before deletion can be undeleted
+func checkObjectUndeletable(status string, previousStatus string) common.SyncServiceError {
+	if status != common.ObjDeleted {
+		return &common.InvalidRequest{Message: "The object is not marked as deleted"}
+	}
+	if previousStatus == "" {
+		return &common.InvalidRequest{Message: "The status of the object before its deletion is unknown"}
+	}
+	return nil
+}
+
+// objectDataRequired returns true if the object had data that has to exist in order to undelete it
+func objectDataRequired(metaData common.MetaData) bool {
+	return !metaData.NoData && metaData.ObjectSize > 0
+}
+
+// auditLogMaxAge returns the age after which audit records are purged by the maintenance, 0 if they aren't purged
+func auditLogMaxAge() time.Duration {
+	return time.Hour * time.Duration(common.Configuration.AuditLogMaxAge)
+}
+
+// newAuditRecord creates a record of an object mutation for the audit log
+func newAuditRecord(orgID string, objectType string, objectID string, action string, status string, identity string) common.AuditRecord {
+	return common.AuditRecord{OrgID: orgID, ObjectType: objectType, ObjectID: objectID, Action: action, Status: status,
+		Identity: identity, Timestamp: time.Now().UTC()}
+}
+
+// dataAccessLogged returns true if a read of an object's data on behalf of the identity is recorded in the audit log
+func dataAccessLogged(identity string) bool {
+	return identity != "" && common.Configuration.LogDataAccess
+}
+
+// newDataAccessRecord creates a record of a read of an object's data for the audit log
+func newDataAccessRecord(orgID string, objectType string, objectID string, identity string, dataSize int64) common.AuditRecord {
+	record := newAuditRecord(orgID, objectType, objectID, common.AuditRead, "", identity)
+	record.DataSize = dataSize
+	return record
+}
+
+var objectDataMissing = &common.InvalidRequest{Message: "The data of the deleted object no longer exists"}
+
+// objectMetadataPatchFields are the meta data fields (by their bson names) that can be updated by PatchObjectMetadata
+var objectMetadataPatchFields = map[string]bool{"description": true, "version": true, "link": true, "expiration": true}
+
+// validateObjectMetadataPatch verifies that a meta data patch only updates fields that can be patched, with string values.
+// The keys of the patch may be prefixed with "metadata.". Returns the patch keyed by the fields' bson names,
+// with the expiration time normalized to UTC.
+func validateObjectMetadataPatch(patch map[string]interface{}) (map[string]string, common.SyncServiceError) {
+	if len(patch) == 0 {
+		return nil, &common.InvalidRequest{Message: "The meta data patch is empty"}
+	}
+	fields := make(map[string]string, len(patch))
+	problems := make([]string, 0)
+	for key, value := range patch {
+		field := strings.TrimPrefix(key, "metadata.")
+		if !objectMetadataPatchFields[field] {
+			problems = append(problems, fmt.Sprintf("%s can't be patched", key))
+			continue
+		}
+		str, ok := value.(string)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s must be a string", key))
+			continue
+		}
+		if field == "expiration" && str != "" {
+			expiration, err := time.Parse(time.RFC3339, str)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("expiration (%s) is not in RFC3339 format", str))
+				continue
+			}
+			str = expiration.UTC().Format(time.RFC3339)
+		}
+		fields[field] = str
+	}
+	if len(problems) != 0 {
+		return nil, &common.ValidationError{Problems: problems}
+	}
+	return fields, nil
+}
+
+// applyObjectMetadataPatch applies a patch returned by validateObjectMetadataPatch to the meta data
+func applyObjectMetadataPatch(metaData *common.MetaData, fields map[string]string) {
+	for field, value := range fields {
+		switch field {
+		case "description":
+			metaData.Description = value
+		case "version":
+			metaData.Version = value
+		case "link":
+			metaData.Link = value
+		case "expiration":
+			metaData.Expiration = value
+		}
+	}
+}
+
+// touchObjectExpiration returns the expiration time of an object extended by the given duration.
+// An expiration time that has already passed is extended from the current time.
+// An empty expiration time is returned for an object that doesn't expire.
+func touchObjectExpiration(status string, metaData common.MetaData, extendBy time.Duration) (string, common.SyncServiceError) {
+	if metaData.Deleted || status == common.ObjDeleted {
+		return "", &common.InvalidRequest{Message: "Can't extend the expiration of a deleted object"}
+	}
+	if status != common.ReadyToSend {
+		return "", &common.InvalidRequest{Message: "Can't extend the expiration of an object that isn't being delivered"}
+	}
+	if extendBy <= 0 {
+		return "", &common.InvalidRequest{Message: "The expiration can only be extended by a positive duration"}
+	}
+	if metaData.Expiration == "" {
+		return "", nil
+	}
+
+	expiration, err := time.Parse(time.RFC3339, metaData.Expiration)
+	if err != nil {
+		return "", &Error{fmt.Sprintf("Invalid expiration time (%s) of the object. Error: %s.", metaData.Expiration, err)}
+	}
+	if now := time.Now(); expiration.Before(now) {
+		expiration = now
+	}
+	return expiration.Add(extendBy).UTC().Format(time.RFC3339), nil
+}
+
+// uploadProgress tracks the committed offset of an in-progress upload of an object's data, i.e., the end of
+// the data written contiguously from the beginning. Chunks that were written beyond a gap are kept in pending
+// (offset to length) until the gap is filled.
+type uploadProgress struct {
+	committed int64
+	pending   map[int64]int64
+}
+
+func newUploadProgress() *uploadProgress {
+	return &uploadProgress{pending: make(map[int64]int64)}
+}
+
+// chunkWritten records that a chunk of the given length was written at the offset
+func (progress *uploadProgress) chunkWritten(offset int64, length int64) {
+	if offset > progress.committed {
+		if length > progress.pending[offset] {
+			progress.pending[offset] = length
+		}
+		return
+	}
+	if end := offset + length; end > progress.committed {
+		progress.committed = end
+	}
+	for advanced := true; advanced; {
+		advanced = false
+		for pendingOffset, pendingLength := range progress.pending {
+			if pendingOffset > progress.committed {
+				continue
+			}
+			if end := pendingOffset + pendingLength; end > progress.committed {
+				progress.committed = end
+			}
+			delete(progress.pending, pendingOffset)
+			advanced = true
+		}
+	}
+}
+
+// committedReadSize returns the number of bytes to read at the offset without reading beyond the committed offset
+func committedReadSize(committed int64, size int, offset int64) int64 {
+	if offset >= committed {
+		return 0
+	}
+	if s := int64(size); s < committed-offset {
+		return s
+	}
+	return committed - offset
+}
+
 func ensureArrayCapacity(data []byte, newCapacity int64) []byte {
 	if newCapacity <= int64(cap(data)) {
 		return data
@@ -428,26 +1243,36 @@ func createDataPath(prefix string, orgID string, objectType string, objectID str
 	var strBuilder strings.Builder
 	strBuilder.Grow(len(prefix) + len(orgID) + len(objectType) + len(objectID) + 3)
 	strBuilder.WriteString(prefix)
-	strBuilder.WriteString(orgID)
+	writeDataPathComponent(&strBuilder, orgID)
 	strBuilder.WriteByte('-')
-	strBuilder.WriteString(objectType)
+	writeDataPathComponent(&strBuilder, objectType)
 	strBuilder.WriteByte('-')
-	strBuilder.WriteString(objectID)
+	writeDataPathComponent(&strBuilder, objectID)
 	return strBuilder.String()
 }
 
 func createDataPathForTempData(prefix string, orgID string, objectType string, objectID string) string {
-	var strBuilder strings.Builder
-	strBuilder.Grow(len(prefix) + len(orgID) + len(objectType) + len(objectID) + len("tmp") + 4)
-	strBuilder.WriteString(prefix)
-	strBuilder.WriteString(orgID)
-	strBuilder.WriteByte('-')
-	strBuilder.WriteString(objectType)
-	strBuilder.WriteByte('-')
-	strBuilder.WriteString(objectID)
-	strBuilder.WriteByte('-')
-	strBuilder.WriteString("tmp")
-	return strBuilder.String()
+	return createDataPath(prefix, orgID, objectType, objectID) + "-tmp"
+}
+
+// writeDataPathComponent writes a component of a data file name, escaping '-', '%', and '_' as '_' followed by
+// the character's hex code.
+// The components are separated by '-' in the file name, so components that contain '-' must be escaped for the
+// file names of different objects not to collide. '%' is escaped, and isn't used as the escape character, since the
+// data path is parsed as a URI, which would decode escape sequences. The file names of objects whose organization,
+// type, and ID contain none of these characters are unchanged by the escaping.
+func writeDataPathComponent(strBuilder *strings.Builder, component string) {
+	const hexDigits = "0123456789ABCDEF"
+	for i := 0; i < len(component); i++ {
+		c := component[i]
+		if c == '-' || c == '%' || c == '_' {
+			strBuilder.WriteByte('_')
+			strBuilder.WriteByte(hexDigits[c>>4])
+			strBuilder.WriteByte(hexDigits[c&0x0F])
+		} else {
+			strBuilder.WriteByte(c)
+		}
+	}
 }
 
 func createDataPathFromMeta(prefix string, metaData common.MetaData) string {
@@ -559,8 +1384,8 @@ func createDestinations(orgID string, store Storage, existingDestinations []comm
 }
 
 // DeleteStoredObject calls the storage to delete the object and its data
-func DeleteStoredObject(store Storage, metaData common.MetaData) common.SyncServiceError {
-	if err := store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+func DeleteStoredObject(store Storage, metaData common.MetaData, identity string) common.SyncServiceError {
+	if err := store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, identity); err != nil {
 		return err
 	}
 
@@ -584,3 +1409,302 @@ func DeleteStoredData(store Storage, metaData common.MetaData) common.SyncServic
 
 	return store.DeleteStoredData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 }
+
+// objectSizeLimiter counts the bytes of an object's data as they are read, and fails the read
+// once the maximum object size of the object's type is exceeded
+type objectSizeLimiter struct {
+	reader   io.Reader
+	maxSize  int64
+	read     int64
+	exceeded *common.ObjectTooLargeError
+}
+
+// newObjectSizeLimiter creates a limiter for the data of an object of the given type, starting at the given offset
+func newObjectSizeLimiter(objectType string, reader io.Reader, offset int64) *objectSizeLimiter {
+	return &objectSizeLimiter{reader: reader, maxSize: common.MaxObjectSizeForType(objectType), read: offset}
+}
+
+func (limiter *objectSizeLimiter) Read(p []byte) (int, error) {
+	if limiter.exceeded != nil {
+		return 0, limiter.exceeded
+	}
+	n, err := limiter.reader.Read(p)
+	limiter.read += int64(n)
+	if limiter.maxSize > 0 && limiter.read > limiter.maxSize {
+		limiter.exceeded = newObjectTooLargeError(limiter.maxSize)
+		return 0, limiter.exceeded
+	}
+	return n, err
+}
+
+// checkObjectSize returns an error if the given size exceeds the maximum object size of the object's type
+func checkObjectSize(objectType string, size int64) common.SyncServiceError {
+	if maxSize := common.MaxObjectSizeForType(objectType); maxSize > 0 && size > maxSize {
+		return newObjectTooLargeError(maxSize)
+	}
+	return nil
+}
+
+func newObjectTooLargeError(maxSize int64) *common.ObjectTooLargeError {
+	return &common.ObjectTooLargeError{Message: fmt.Sprintf("The object's data exceeds the maximum object size of %d bytes", maxSize),
+		MaxSize: maxSize}
+}
+
+// destinationObjectStatus maps a notification status to the status of the object on the notification's destination.
+// An empty string is returned for notification statuses that don't indicate that the object is in use on the destination.
+func destinationObjectStatus(notificationStatus string) string {
+	switch notificationStatus {
+	case common.Update, common.UpdatePending, common.Updated:
+		return common.Delivering
+	case common.ReceivedByDestination:
+		return common.Delivered
+	case common.ConsumedByDestination:
+		return common.Consumed
+	case common.Error:
+		return common.Error
+	}
+	return ""
+}
+
+// objectMatchesFilter returns true if the object matches the filter of an object search.
+// An object matches a destination if it is sent to the destination by its destination type and ID or by its destinations list.
+func objectMatchesFilter(metaData common.MetaData, filter common.ObjectFilter) bool {
+	if (filter.OrgID != "" && filter.OrgID != metaData.DestOrgID) ||
+		(filter.ObjectType != "" && filter.ObjectType != metaData.ObjectType) ||
+		(filter.ObjectID != "" && filter.ObjectID != metaData.ObjectID) {
+		return false
+	}
+	if filter.DestinationType == "" {
+		return true
+	}
+	if metaData.DestType == filter.DestinationType && (filter.DestinationID == "" || metaData.DestID == filter.DestinationID) {
+		return true
+	}
+	for _, dest := range metaData.DestinationsList {
+		if (filter.DestinationID == "" && strings.HasPrefix(dest, filter.DestinationType+":")) ||
+			dest == filter.DestinationType+":"+filter.DestinationID {
+			return true
+		}
+	}
+	return false
+}
+
+// pageObjects sorts the objects by organization, object type, and object ID, and returns up to limit objects,
+// skipping the first offset objects. A limit of 0 means no limit.
+func pageObjects(objects []common.MetaData, offset int, limit int) []common.MetaData {
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].DestOrgID != objects[j].DestOrgID {
+			return objects[i].DestOrgID < objects[j].DestOrgID
+		}
+		if objects[i].ObjectType != objects[j].ObjectType {
+			return objects[i].ObjectType < objects[j].ObjectType
+		}
+		return objects[i].ObjectID < objects[j].ObjectID
+	})
+	if offset >= len(objects) {
+		return make([]common.MetaData, 0)
+	}
+	objects = objects[offset:]
+	if limit > 0 && limit < len(objects) {
+		objects = objects[:limit]
+	}
+	return objects
+}
+
+// checkACL evaluates the ACL of the key and then the ACL of all the keys of the organization.
+// An entry grants access if it is the user's entry, the wildcard entry, or the entry of a group the user is a member of.
+func checkACL(store Storage, aclType string, orgID string, key string, username string) (bool, common.SyncServiceError) {
+	keys := []string{""}
+	if key != "" && key != common.ACLWildcard {
+		keys = []string{key, ""}
+	}
+
+	username = common.NormalizeACLUsername(username)
+	checkedGroups := make(map[string]bool)
+	for _, k := range keys {
+		users, err := store.RetrieveACL(aclType, orgID, k, "")
+		if err != nil {
+			return false, err
+		}
+		for _, user := range users {
+			if user.Username == common.ACLWildcard || common.NormalizeACLUsername(user.Username) == username {
+				return true, nil
+			}
+			if !strings.HasPrefix(user.Username, common.ACLGroupPrefix) {
+				continue
+			}
+			name := strings.TrimPrefix(user.Username, common.ACLGroupPrefix)
+			if checkedGroups[name] {
+				continue
+			}
+			checkedGroups[name] = true
+			group, err := store.RetrieveACLGroup(orgID, name)
+			if err != nil {
+				return false, err
+			}
+			if group != nil && isACLGroupMember(*group, username) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// destinationObjectTypesFilter returns a function that returns true if objects of the object type can be sent to the
+// destinations of the destination type, according to the destination object types ACLs of the organization (the ACL of
+// the destination type and the ACL of all the destination types). Objects of all types can be sent if neither ACL exists.
+// The ACLs are read when the filter is created, so that the filter can be used while the storage is being updated.
+func destinationObjectTypesFilter(store Storage, orgID string, destType string) (func(objectType string) bool, common.SyncServiceError) {
+	keys := []string{""}
+	if destType != "" {
+		keys = []string{destType, ""}
+	}
+
+	restricted := false
+	permitted := make(map[string]bool)
+	for _, key := range keys {
+		entries, err := store.RetrieveACL(common.DestinationObjectTypesACLType, orgID, key, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			restricted = true
+			if entry.Username == common.ACLWildcard {
+				return func(string) bool { return true }, nil
+			}
+			if !strings.HasPrefix(entry.Username, common.ACLGroupPrefix) {
+				permitted[common.NormalizeACLUsername(entry.Username)] = true
+				continue
+			}
+			group, err := store.RetrieveACLGroup(orgID, strings.TrimPrefix(entry.Username, common.ACLGroupPrefix))
+			if err != nil {
+				return nil, err
+			}
+			if group != nil {
+				for _, member := range group.Members {
+					permitted[common.NormalizeACLUsername(member)] = true
+				}
+			}
+		}
+	}
+
+	if !restricted {
+		return func(string) bool { return true }, nil
+	}
+	return func(objectType string) bool {
+		return permitted[common.NormalizeACLUsername(objectType)]
+	}, nil
+}
+
+// FilterDestinationsForObjectType returns the destinations that objects of the object type can be sent to, according to
+// the destination object types ACLs of the organization
+func FilterDestinationsForObjectType(store Storage, orgID string, objectType string,
+	destinations []common.Destination) ([]common.Destination, common.SyncServiceError) {
+	filters := make(map[string]func(objectType string) bool)
+	result := make([]common.Destination, 0, len(destinations))
+	for _, destination := range destinations {
+		objectTypePermitted, ok := filters[destination.DestType]
+		if !ok {
+			var err common.SyncServiceError
+			objectTypePermitted, err = destinationObjectTypesFilter(store, orgID, destination.DestType)
+			if err != nil {
+				return nil, err
+			}
+			filters[destination.DestType] = objectTypePermitted
+		}
+		if objectTypePermitted(objectType) {
+			result = append(result, destination)
+		}
+	}
+	return result, nil
+}
+
+// isACLGroupMember returns true if the normalized username is a member of the group
+func isACLGroupMember(group common.ACLGroup, username string) bool {
+	for _, member := range group.Members {
+		if common.NormalizeACLUsername(member) == username {
+			return true
+		}
+	}
+	return false
+}
+
+func validateACLGroup(group common.ACLGroup) common.SyncServiceError {
+	if group.OrgID == "" || group.Name == "" {
+		return &common.InvalidRequest{Message: "ACL group must have an organization and a name"}
+	}
+	if strings.Contains(group.Name, ":") {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Invalid ACL group name %s", group.Name)}
+	}
+	return nil
+}
+
+func validateRetentionPolicy(policy common.RetentionPolicy) common.SyncServiceError {
+	if policy.OrgID == "" || policy.ObjectType == "" {
+		return &common.InvalidRequest{Message: "Retention policy must have an organization and an object type"}
+	}
+	if policy.MaxAge < 0 || (policy.MaxVersions != nil && *policy.MaxVersions < 0) {
+		return &common.InvalidRequest{Message: "Retention policy's maximal age and number of versions must be non-negative numbers"}
+	}
+	return nil
+}
+
+func validateWebhookRetryPolicy(policy common.WebhookRetryPolicy) common.SyncServiceError {
+	if policy.OrgID == "" || policy.ObjectType == "" {
+		return &common.InvalidRequest{Message: "Webhook retry policy must have an organization and an object type"}
+	}
+	if policy.Attempts < 1 || policy.Backoff < 0 {
+		return &common.InvalidRequest{Message: "Webhook retry policy must have at least one attempt and a non-negative backoff"}
+	}
+	return nil
+}
+
+// webhookFailureID returns the ID of the failure record of a webhook
+func webhookFailureID(orgID string, objectType string, url string) string {
+	return common.CreateCompositeID(orgID, objectType, url)
+}
+
+func validateAPIToken(token common.APIToken) common.SyncServiceError {
+	if token.Hash == "" || token.OrgID == "" || token.Identity == "" || token.Role == "" {
+		return &common.InvalidRequest{Message: "API token must have a hash, an organization, an identity, and a role"}
+	}
+	if token.Expiration != "" {
+		if _, err := time.Parse(time.RFC3339, token.Expiration); err != nil {
+			return &common.InvalidRequest{Message: fmt.Sprintf("Invalid API token expiration %s", token.Expiration)}
+		}
+	}
+	return nil
+}
+
+// sameACLUser returns true if both entries are of the same user, comparing their normalized usernames
+func sameACLUser(entry1 common.ACLentry, entry2 common.ACLentry) bool {
+	return entry1.ACLUserType == entry2.ACLUserType &&
+		common.NormalizeACLUsername(entry1.Username) == common.NormalizeACLUsername(entry2.Username)
+}
+
+// normalizeACLEntries returns the entries with normalized usernames, keeping only the first entry of each user.
+// The returned flag is true if any of the entries was modified or removed.
+func normalizeACLEntries(users []common.ACLentry) ([]common.ACLentry, bool) {
+	normalized := make([]common.ACLentry, 0, len(users))
+	changed := false
+	for _, user := range users {
+		username := common.NormalizeACLUsername(user.Username)
+		if username != user.Username {
+			user.Username = username
+			changed = true
+		}
+		duplicate := false
+		for _, existing := range normalized {
+			if existing.ACLUserType == user.ACLUserType && existing.Username == user.Username {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			changed = true
+			continue
+		}
+		normalized = append(normalized, user)
+	}
+	return normalized, changed
+}
@@ -2,8 +2,12 @@ package storage
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,11 +37,11 @@ func testStorageObjects(storageType string, t *testing.T) {
 
 	for _, test := range tests {
 		// Delete the object first
-		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID); err != nil {
+		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, ""); err != nil {
 			t.Errorf("Failed to delete object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 		// Insert
-		if deletedDests, err := store.StoreObject(test.metaData, nil, test.status); err != nil {
+		if deletedDests, err := store.StoreObject(test.metaData, nil, test.status, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		} else {
 			if len(deletedDests) != 0 {
@@ -133,7 +137,7 @@ func testStorageObjects(storageType string, t *testing.T) {
 		instanceID := storedMetaData.InstanceID
 		// Update, instance ID for the sending side should be incremented
 		time.Sleep(20 * time.Millisecond)
-		if _, err := store.StoreObject(test.metaData, nil, test.status); err != nil {
+		if _, err := store.StoreObject(test.metaData, nil, test.status, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 		storedMetaData, storedStatus, err = store.RetrieveObjectAndStatus(test.metaData.DestOrgID,
@@ -179,7 +183,7 @@ func testStorageObjects(storageType string, t *testing.T) {
 
 		// Deleted
 		if err := store.MarkObjectDeleted(test.metaData.DestOrgID,
-			test.metaData.ObjectType, test.metaData.ObjectID); err != nil {
+			test.metaData.ObjectType, test.metaData.ObjectID, ""); err != nil {
 			t.Errorf("Failed to mark object as deleted (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 		storedStatus, err = store.RetrieveObjectStatus(test.metaData.DestOrgID,
@@ -209,7 +213,7 @@ func testStorageObjects(storageType string, t *testing.T) {
 
 		// Status
 		if err := store.UpdateObjectStatus(test.metaData.DestOrgID,
-			test.metaData.ObjectType, test.metaData.ObjectID, "status"); err != nil {
+			test.metaData.ObjectType, test.metaData.ObjectID, "status", ""); err != nil {
 			t.Errorf("Failed to update status (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 		if status, err := store.RetrieveObjectStatus(test.metaData.DestOrgID,
@@ -303,11 +307,11 @@ func testStorageObjectsWithPolicy(storageType string, t *testing.T) {
 
 	for _, test := range tests {
 		// Delete the object first
-		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID); err != nil {
+		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, ""); err != nil {
 			t.Errorf("Failed to delete object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 		// Insert
-		if _, err := store.StoreObject(test.metaData, nil, common.NotReadyToSend); err != nil {
+		if _, err := store.StoreObject(test.metaData, nil, common.NotReadyToSend, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 		storedMetaData, err := store.RetrieveObject(test.metaData.DestOrgID,
@@ -345,7 +349,7 @@ func testStorageObjectsWithPolicy(storageType string, t *testing.T) {
 
 				policyTimestamp := storedMetaData.DestinationPolicy.Timestamp
 
-				if _, err := store.StoreObject(test.metaData, nil, common.NotReadyToSend); err != nil {
+				if _, err := store.StoreObject(test.metaData, nil, common.NotReadyToSend, ""); err != nil {
 					t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 				}
 				storedMetaData, err := store.RetrieveObject(test.metaData.DestOrgID,
@@ -398,7 +402,7 @@ func testStorageObjectsWithPolicy(storageType string, t *testing.T) {
 
 	for _, test := range tests {
 		if test.recieved {
-			if _, err := store.StoreObject(test.metaData, nil, common.NotReadyToSend); err != nil {
+			if _, err := store.StoreObject(test.metaData, nil, common.NotReadyToSend, ""); err != nil {
 				t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			}
 			objectsMarkedReceived--
@@ -520,12 +524,12 @@ func testGetObjectWithFilters(storageType string, t *testing.T) {
 
 	for _, test := range tests {
 		// delete
-		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID); err != nil {
+		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, ""); err != nil {
 			t.Errorf("Failed to delete object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 
 		// insert
-		if _, err := store.StoreObject(test.metaData, nil, common.ReadyToSend); err != nil {
+		if _, err := store.StoreObject(test.metaData, nil, common.ReadyToSend, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 
@@ -713,6 +717,8 @@ func testStorageObjectActivation(storageType string, t *testing.T) {
 
 	activationTime1 := time.Now().Add(time.Second * 2).UTC().Format(time.RFC3339)
 	activationTime2 := time.Now().Add(time.Second * 6).UTC().Format(time.RFC3339)
+	// Same as activationTime1, in a different time zone
+	activationTime3 := time.Now().Add(time.Second * 2).In(time.FixedZone("IST", 5*60*60+30*60)).Format(time.RFC3339)
 
 	tests := []struct {
 		metaData common.MetaData
@@ -728,11 +734,13 @@ func testStorageObjectActivation(storageType string, t *testing.T) {
 			Inactive: true, ActivationTime: activationTime1}, common.PartiallyReceived},
 		{common.MetaData{ObjectID: "5", ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1", DestType: "device",
 			Inactive: true, ActivationTime: activationTime2}, common.PartiallyReceived},
+		{common.MetaData{ObjectID: "6", ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1", DestType: "device",
+			Inactive: true, ActivationTime: activationTime3}, common.ReadyToSend},
 	}
 
 	for _, test := range tests {
 		// Insert
-		if _, err := store.StoreObject(test.metaData, nil, test.status); err != nil {
+		if _, err := store.StoreObject(test.metaData, nil, test.status, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 	}
@@ -751,13 +759,14 @@ func testStorageObjectActivation(storageType string, t *testing.T) {
 	if err != nil {
 		t.Errorf("GetObjectsToActivate failed. Error: %s\n", err.Error())
 	} else {
-		if len(objectsToActivate) != 1 {
-			t.Errorf("GetObjectsToActivate returned incorrect number of objects: %d instead of 1.\n", len(objectsToActivate))
+		if len(objectsToActivate) != 2 {
+			t.Errorf("GetObjectsToActivate returned incorrect number of objects: %d instead of 2.\n", len(objectsToActivate))
 			for index, object := range objectsToActivate {
 				t.Errorf("   GetObjectsToActivate object #%d:    %s:%s", index, object.ObjectType, object.ObjectID)
 			}
-		} else if objectsToActivate[0].ObjectID != "2" {
-			t.Errorf("GetObjectsToActivate returned incorrect objects: id=%s instead of 2.\n", objectsToActivate[0].ObjectID)
+		} else if (objectsToActivate[0].ObjectID != "2" && objectsToActivate[0].ObjectID != "6") ||
+			(objectsToActivate[1].ObjectID != "2" && objectsToActivate[1].ObjectID != "6") {
+			t.Errorf("GetObjectsToActivate returned incorrect objects.\n")
 		}
 	}
 
@@ -767,13 +776,183 @@ func testStorageObjectActivation(storageType string, t *testing.T) {
 	if err != nil {
 		t.Errorf("GetObjectsToActivate failed. Error: %s\n", err.Error())
 	} else {
-		if len(objectsToActivate) != 2 {
-			t.Errorf("GetObjectsToActivate returned incorrect number of objects: %d instead of 2.\n", len(objectsToActivate))
-		} else if (objectsToActivate[0].ObjectID != "2" && objectsToActivate[0].ObjectID != "3") ||
-			(objectsToActivate[1].ObjectID != "2" && objectsToActivate[1].ObjectID != "3") {
-			t.Errorf("GetObjectsToActivate returned incorrect objects.\n")
+		if len(objectsToActivate) != 3 {
+			t.Errorf("GetObjectsToActivate returned incorrect number of objects: %d instead of 3.\n", len(objectsToActivate))
+		} else {
+			for _, object := range objectsToActivate {
+				if object.ObjectID != "2" && object.ObjectID != "3" && object.ObjectID != "6" {
+					t.Errorf("GetObjectsToActivate returned incorrect object: id=%s.\n", object.ObjectID)
+				}
+			}
+		}
+	}
+}
+
+func testStorageUndeleteObject(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	tests := []struct {
+		metaData common.MetaData
+		status   string
+		data     []byte
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "undeleteorg", DestID: "dev1", DestType: "device",
+			ObjectSize: int64(len(data))}, common.ReadyToSend, data},
+		{common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: "undeleteorg", DestID: "dev1", DestType: "device",
+			NoData: true}, common.CompletelyReceived, nil},
+		{common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: "undeleteorg", DestID: "dev1", DestType: "device",
+			ObjectSize: int64(len(data))}, common.ReadyToSend, data},
+	}
+
+	for _, test := range tests {
+		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, ""); err != nil {
+			t.Errorf("Failed to delete object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+		}
+		if _, err := store.StoreObject(test.metaData, test.data, test.status, ""); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+		}
+		if err := store.MarkObjectDeleted(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, ""); err != nil {
+			t.Errorf("Failed to mark object as deleted (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+		}
+	}
+
+	deletedObjects, err := store.RetrieveDeletedObjects("undeleteorg")
+	if err != nil {
+		t.Errorf("RetrieveDeletedObjects failed. Error: %s\n", err.Error())
+	} else if len(deletedObjects) != len(tests) {
+		t.Errorf("RetrieveDeletedObjects returned %d objects instead of %d\n", len(deletedObjects), len(tests))
+	}
+
+	// The data of the third object is removed, it can't be undeleted
+	if err := store.DeleteStoredData("undeleteorg", "type1", "3"); err != nil {
+		t.Errorf("Failed to delete object's data. Error: %s\n", err.Error())
+	}
+	if err := store.UndeleteObject("undeleteorg", "type1", "3"); err == nil {
+		t.Errorf("UndeleteObject of an object without data didn't fail\n")
+	}
+
+	for _, test := range tests[:2] {
+		if err := store.UndeleteObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID); err != nil {
+			t.Errorf("UndeleteObject failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+			continue
+		}
+		metaData, status, err := store.RetrieveObjectAndStatus(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID)
+		if err != nil {
+			t.Errorf("Failed to retrieve object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+		} else if metaData == nil {
+			t.Errorf("Undeleted object (objectID = %s) not found\n", test.metaData.ObjectID)
+		} else {
+			if status != test.status {
+				t.Errorf("Undeleted object has status %s instead of %s (objectID = %s)\n", status, test.status, test.metaData.ObjectID)
+			}
+			if metaData.Deleted {
+				t.Errorf("Undeleted object is marked as deleted (objectID = %s)\n", test.metaData.ObjectID)
+			}
+		}
+
+		// The object is not deleted anymore
+		if err := store.UndeleteObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID); err == nil {
+			t.Errorf("UndeleteObject of an object that is not deleted didn't fail (objectID = %s)\n", test.metaData.ObjectID)
+		}
+	}
+
+	deletedObjects, err = store.RetrieveDeletedObjects("undeleteorg")
+	if err != nil {
+		t.Errorf("RetrieveDeletedObjects failed. Error: %s\n", err.Error())
+	} else if len(deletedObjects) != 1 || deletedObjects[0].ObjectID != "3" {
+		t.Errorf("RetrieveDeletedObjects returned incorrect objects after undelete\n")
+	}
+
+	if err := store.UndeleteObject("undeleteorg", "type1", "noSuchObject"); err == nil || !IsNotFound(err) {
+		t.Errorf("UndeleteObject of a non-existing object didn't return NotFound\n")
+	}
+}
+
+func testStoragePatchObjectMetadata(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "patchorg", DestID: "dev1", DestType: "device",
+		Description: "old description", Version: "1.0", ObjectSize: int64(len(data))}
+	if err := store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, ""); err != nil {
+		t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+	}
+	if _, err := store.StoreObject(metaData, data, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+
+	expiration := time.Now().Add(time.Hour).In(time.FixedZone("IST", 5*60*60+30*60)).Format(time.RFC3339)
+	patch := map[string]interface{}{"description": "new description", "metadata.link": "http://example.com", "expiration": expiration}
+	if err := store.PatchObjectMetadata("patchorg", "type1", "1", patch); err != nil {
+		t.Errorf("PatchObjectMetadata failed. Error: %s\n", err.Error())
+	}
+
+	storedMetaData, status, err := store.RetrieveObjectAndStatus("patchorg", "type1", "1")
+	if err != nil {
+		t.Errorf("Failed to retrieve object. Error: %s\n", err.Error())
+	} else if storedMetaData == nil {
+		t.Errorf("Patched object not found\n")
+	} else {
+		if storedMetaData.Description != "new description" || storedMetaData.Link != "http://example.com" {
+			t.Errorf("The meta data wasn't patched: %+v\n", storedMetaData)
+		}
+		if storedMetaData.Version != "1.0" {
+			t.Errorf("PatchObjectMetadata modified a field that wasn't in the patch: version %s instead of 1.0\n", storedMetaData.Version)
+		}
+		if exp, _ := time.Parse(time.RFC3339, expiration); storedMetaData.Expiration != exp.UTC().Format(time.RFC3339) {
+			t.Errorf("The patched expiration %s wasn't normalized to UTC\n", storedMetaData.Expiration)
+		}
+		if status != common.ReadyToSend {
+			t.Errorf("PatchObjectMetadata modified the status of the object: %s instead of %s\n", status, common.ReadyToSend)
+		}
+	}
+
+	if dataReader, err := store.RetrieveObjectData("patchorg", "type1", "1", ""); err != nil {
+		t.Errorf("Failed to retrieve object's data. Error: %s\n", err.Error())
+	} else if dataReader == nil {
+		t.Errorf("The data of the patched object is missing\n")
+	} else {
+		store.CloseDataReader(dataReader)
+	}
+
+	invalidPatches := []map[string]interface{}{
+		{},
+		{"destinationID": "dev2"},
+		{"description": 5},
+		{"expiration": "tomorrow"},
+		{"description": "valid", "metadata.deleted": true},
+	}
+	for _, patch := range invalidPatches {
+		if err := store.PatchObjectMetadata("patchorg", "type1", "1", patch); err == nil {
+			t.Errorf("PatchObjectMetadata with an invalid patch %v didn't fail\n", patch)
 		}
 	}
+	if storedMetaData, err := store.RetrieveObject("patchorg", "type1", "1"); err != nil {
+		t.Errorf("Failed to retrieve object. Error: %s\n", err.Error())
+	} else if storedMetaData == nil || storedMetaData.Description != "new description" || storedMetaData.DestID != "dev1" {
+		t.Errorf("An invalid patch modified the meta data\n")
+	}
+
+	if err := store.PatchObjectMetadata("patchorg", "type1", "noSuchObject", map[string]interface{}{"description": "x"}); err == nil ||
+		!IsNotFound(err) {
+		t.Errorf("PatchObjectMetadata of a non-existing object didn't return NotFound\n")
+	}
+
+	if err := store.DeleteStoredObject("patchorg", "type1", "1", ""); err != nil {
+		t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+	}
 }
 
 func testStorageObjectData(storageType string, t *testing.T) {
@@ -808,7 +987,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 	for i, test := range tests {
 		test.metaData.ObjectSize = int64(len(test.data) + len(test.newData))
 		// Insert
-		if _, err := store.StoreObject(test.metaData, test.data, test.status); err != nil {
+		if _, err := store.StoreObject(test.metaData, test.data, test.status, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 
@@ -827,7 +1006,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 
 		// Check stored data
 		dataReader, err := store.RetrieveObjectData(test.metaData.DestOrgID,
-			test.metaData.ObjectType, test.metaData.ObjectID)
+			test.metaData.ObjectType, test.metaData.ObjectID, "")
 		if err != nil {
 			t.Errorf("Failed to retrieve object's data' (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		} else if dataReader == nil {
@@ -860,7 +1039,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 		// Read data with offset
 		if test.data != nil {
 			data, eof, _, err := store.ReadObjectData(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
-				26, 0)
+				26, 0, "")
 			if err != nil {
 				t.Errorf("ReadObjectData failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			} else {
@@ -874,7 +1053,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 			}
 
 			data, eof, read, err := store.ReadObjectData(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
-				6, 26)
+				6, 26, "")
 			if err != nil {
 				t.Errorf("ReadObjectData failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			} else {
@@ -888,7 +1067,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 			}
 
 			data, eof, _, err = store.ReadObjectData(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
-				4, 2)
+				4, 2, "")
 			if err != nil {
 				t.Errorf("ReadObjectData failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			} else {
@@ -903,7 +1082,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 
 			// Offset > data size
 			data, _, read, err = store.ReadObjectData(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
-				4, 200)
+				4, 200, "")
 			if err != nil {
 				t.Errorf("ReadObjectData failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			} else {
@@ -914,7 +1093,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 
 			// Size > data size
 			data, _, read, err = store.ReadObjectData(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
-				400, 2)
+				400, 2, "")
 			if err != nil {
 				t.Errorf("ReadObjectData failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			} else {
@@ -932,7 +1111,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 			t.Errorf("StoreObjectData failed to find object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		} else {
 			data, _, _, err := store.ReadObjectData(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
-				len(test.newData), 0)
+				len(test.newData), 0, "")
 			if err != nil {
 				t.Errorf("ReadObjectData failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 			} else {
@@ -957,7 +1136,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 			} else {
 				expectedData := append(test.data, test.newData...)
 				data, _, _, err := store.ReadObjectData(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID,
-					len(expectedData), 0)
+					len(expectedData), 0, "")
 				if err != nil {
 					t.Errorf("ReadObjectData failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 				} else {
@@ -1120,6 +1299,127 @@ func testStorageNotifications(storageType string, t *testing.T) {
 	}
 }
 
+func testStorageNotificationResendBackoff(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	notification := common.Notification{ObjectID: "1", ObjectType: "backoff", DestOrgID: "backofforg", DestID: "1", DestType: "device",
+		Status: common.Update, InstanceID: 5}
+	defer store.DeleteNotificationRecords(notification.DestOrgID, notification.ObjectType, notification.ObjectID, "", "")
+
+	retrieve := func() *common.Notification {
+		n, err := store.RetrieveNotificationRecord(notification.DestOrgID, notification.ObjectType, notification.ObjectID,
+			notification.DestType, notification.DestID)
+		if err != nil || n == nil {
+			t.Errorf("Failed to retrieve the notification. Error: %v\n", err)
+			return &common.Notification{}
+		}
+		return n
+	}
+
+	if err := store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s\n", err.Error())
+	}
+	for i := 0; i < 3; i++ {
+		if err := store.UpdateNotificationResendTime(*retrieve()); err != nil {
+			t.Errorf("UpdateNotificationResendTime failed. Error: %s\n", err.Error())
+		}
+	}
+	scheduled := retrieve()
+	if scheduled.ResendAttempts != 3 {
+		t.Errorf("The notification has %d resend attempts instead of 3\n", scheduled.ResendAttempts)
+	}
+
+	// Storing the same notification again doesn't reset the backoff
+	if err := store.UpdateNotificationRecords([]common.Notification{notification}); err != nil {
+		t.Errorf("UpdateNotificationRecords failed. Error: %s\n", err.Error())
+	}
+	if err := store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s\n", err.Error())
+	}
+	if n := retrieve(); n.ResendAttempts != scheduled.ResendAttempts || n.ResendTime != scheduled.ResendTime {
+		t.Errorf("Storing an identical notification rescheduled it: %d attempts at %d instead of %d attempts at %d\n",
+			n.ResendAttempts, n.ResendTime, scheduled.ResendAttempts, scheduled.ResendTime)
+	}
+
+	// A status transition reschedules the notification
+	notification.Status = common.Updated
+	if err := store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s\n", err.Error())
+	}
+	if n := retrieve(); n.ResendAttempts != 0 {
+		t.Errorf("A status transition didn't reset the resend attempts, the notification has %d attempts\n", n.ResendAttempts)
+	}
+}
+
+func testStorageDataComplete(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "complete", DestOrgID: "completeorg", DestType: "device", DestID: "dev1"}
+	defer store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "")
+
+	dataComplete := func(step string, expected bool) {
+		storedMetaData, _, err := store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || storedMetaData == nil {
+			t.Errorf("Failed to retrieve the object after %s. Error: %v\n", step, err)
+		} else if storedMetaData.DataComplete != expected {
+			t.Errorf("The object's data complete flag is %t instead of %t after %s\n", storedMetaData.DataComplete, expected, step)
+		}
+	}
+
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	dataComplete("storing the meta data", false)
+
+	data := []byte("0123456789")
+	if err := store.AppendObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, bytes.NewReader(data[:5]), 5, 0,
+		int64(len(data)), true, false); err != nil {
+		t.Errorf("Failed to append the data. Error: %s\n", err.Error())
+	}
+	dataComplete("appending the first chunk", false)
+	if err := store.AppendObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, bytes.NewReader(data[5:]), 5, 5,
+		int64(len(data)), false, true); err != nil {
+		t.Errorf("Failed to append the data. Error: %s\n", err.Error())
+	}
+	dataComplete("appending the last chunk", true)
+
+	metaData.MetaOnly = true
+	if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	dataComplete("updating only the meta data", true)
+
+	metaData.MetaOnly = false
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	dataComplete("updating the meta data without the data", false)
+	if _, err := store.StoreObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, bytes.NewReader(data)); err != nil {
+		t.Errorf("Failed to store the data. Error: %s\n", err.Error())
+	}
+	dataComplete("storing the data", true)
+
+	if err := store.DeleteStoredData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		t.Errorf("Failed to delete the data. Error: %s\n", err.Error())
+	}
+	dataComplete("deleting the data", false)
+	if _, err := store.StoreObject(metaData, data, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	dataComplete("storing the object with its data", true)
+}
+
 func testStorageWebhooks(storageType string, t *testing.T) {
 	store, err := setUpStorage(storageType)
 	if err != nil {
@@ -1243,7 +1543,7 @@ func testStorageObjectExpiration(storageType string, t *testing.T) {
 
 	for _, test := range tests {
 		// Insert
-		if _, err := store.StoreObject(test.metaData, nil, test.status); err != nil {
+		if _, err := store.StoreObject(test.metaData, nil, test.status, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 	}
@@ -1333,7 +1633,7 @@ func testStorageOrgDeleteObjects(storageType string, t *testing.T) {
 
 	for _, test := range tests {
 		// Insert
-		if _, err := store.StoreObject(test.metaData, test.data, test.status); err != nil {
+		if _, err := store.StoreObject(test.metaData, test.data, test.status, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 	}
@@ -1635,6 +1935,193 @@ func testStorageMessagingGroups(storageType string, t *testing.T) {
 	} else if groupName != "mg1" {
 		t.Errorf("RetrieveMessagingGroup returned incorrect group name: %s instead of mg1\n", groupName)
 	}
+
+	// Destinations of the organizations in a messaging group
+	dests := []common.Destination{
+		common.Destination{DestOrgID: "org2", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol},
+		common.Destination{DestOrgID: "org2", DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol},
+		common.Destination{DestOrgID: "org3", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol},
+		common.Destination{DestOrgID: "org4", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol},
+	}
+	for _, dest := range dests {
+		if err := store.StoreDestination(dest); err != nil {
+			t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+		}
+		defer store.DeleteDestination(dest.DestOrgID, dest.DestType, dest.DestID)
+	}
+	if err := store.StoreOrgToMessagingGroup("org4", "mg1"); err != nil {
+		t.Errorf("StoreOrgToMessagingGroup failed. Error: %s\n", err.Error())
+	}
+	groupTests := []struct {
+		groupName string
+		expected  int
+	}{
+		{"mg1", 3},
+		{"mg3", 1},
+		{"lalala", 0},
+	}
+	for _, test := range groupTests {
+		groupDests, err := store.RetrieveDestinationsInMessagingGroup(test.groupName)
+		if err != nil {
+			t.Errorf("RetrieveDestinationsInMessagingGroup failed. Error: %s\n", err.Error())
+			continue
+		}
+		if len(groupDests) != test.expected {
+			t.Errorf("RetrieveDestinationsInMessagingGroup returned %d destinations instead of %d for %s\n",
+				len(groupDests), test.expected, test.groupName)
+		}
+		for _, dest := range groupDests {
+			if groupName, _ := store.RetrieveMessagingGroup(dest.DestOrgID); groupName != test.groupName {
+				t.Errorf("RetrieveDestinationsInMessagingGroup returned a destination of %s that is not in %s\n",
+					dest.DestOrgID, test.groupName)
+			}
+		}
+	}
+	store.DeleteOrgToMessagingGroup("org2")
+	store.DeleteOrgToMessagingGroup("org3")
+	store.DeleteOrgToMessagingGroup("org4")
+}
+
+func testStorageIncompleteObjects(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "incompleteorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	dest1 := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	dest2 := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol}
+	for _, dest := range []common.Destination{dest1, dest2} {
+		if err := store.StoreDestination(dest); err != nil {
+			t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+		}
+	}
+
+	destArray := []string{"device:dev1", "device:dev2"}
+	objects := []common.MetaData{
+		{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestinationsList: destArray, NoData: true},
+		{ObjectID: "2", ObjectType: "type1", DestOrgID: orgID, DestType: "device", DestID: "dev1", NoData: true},
+		{ObjectID: "3", ObjectType: "type2", DestOrgID: orgID, DestinationsList: destArray, NoData: true},
+		{ObjectID: "4", ObjectType: "type2", DestOrgID: orgID, DestType: "other", NoData: true},
+	}
+	for _, metaData := range objects {
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s. Error: %s\n", metaData.ObjectID, err.Error())
+		}
+		defer store.DeleteStoredObject(orgID, metaData.ObjectType, metaData.ObjectID, "")
+	}
+	deliveries := []struct {
+		objectType string
+		objectID   string
+		destID     string
+		status     string
+	}{
+		{"type1", "2", "dev1", common.Consumed},
+		{"type2", "3", "dev1", common.Consumed},
+		{"type2", "3", "dev2", common.Error},
+	}
+	for _, delivery := range deliveries {
+		if _, err := store.UpdateObjectDeliveryStatus(delivery.status, "", orgID, delivery.objectType, delivery.objectID,
+			"device", delivery.destID); err != nil {
+			t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s\n", err.Error())
+		}
+	}
+
+	tests := []struct {
+		objectType string
+		expected   []string
+		pending    []int
+	}{
+		{"", []string{"type1:1", "type2:3"}, []int{2, 1}},
+		{"type2", []string{"type2:3"}, []int{1}},
+		{"type3", []string{}, []int{}},
+	}
+	for _, test := range tests {
+		incompleteObjects, err := store.RetrieveIncompleteObjects(orgID, test.objectType)
+		if err != nil {
+			t.Errorf("RetrieveIncompleteObjects failed. Error: %s\n", err.Error())
+			continue
+		}
+		if len(incompleteObjects) != len(test.expected) {
+			t.Errorf("RetrieveIncompleteObjects returned %d objects instead of %d for type %s\n", len(incompleteObjects),
+				len(test.expected), test.objectType)
+			continue
+		}
+		for i, incomplete := range incompleteObjects {
+			id := incomplete.MetaData.ObjectType + ":" + incomplete.MetaData.ObjectID
+			if id != test.expected[i] || incomplete.PendingDestinations != test.pending[i] {
+				t.Errorf("RetrieveIncompleteObjects returned %s with %d pending destinations instead of %s with %d\n",
+					id, incomplete.PendingDestinations, test.expected[i], test.pending[i])
+			}
+		}
+	}
+
+	if incompleteObjects, err := store.RetrieveIncompleteObjects(orgID, "type2"); err == nil && len(incompleteObjects) == 1 {
+		counts := incompleteObjects[0].StatusCounts
+		if len(counts) != 1 || counts[common.Error] != 1 {
+			t.Errorf("RetrieveIncompleteObjects returned wrong status counts: %v\n", counts)
+		}
+	}
+}
+
+func testStorageNoDataObjects(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "nodataorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	noData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, NoData: true}
+	missingData := common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: orgID}
+	for _, metaData := range []common.MetaData{noData, missingData} {
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s. Error: %s\n", metaData.ObjectID, err.Error())
+		}
+	}
+
+	// An object without data is read as empty data
+	if data, eof, length, err := store.ReadObjectData(orgID, "type1", "1", 10, 0, ""); err != nil {
+		t.Errorf("Failed to read the data of an object without data. Error: %s\n", err.Error())
+	} else if !eof || length != 0 || len(data) != 0 {
+		t.Errorf("Read %d bytes (eof = %t) of an object without data\n", length, eof)
+	}
+	if dataReader, err := store.RetrieveObjectData(orgID, "type1", "1", ""); err != nil {
+		t.Errorf("Failed to retrieve the data of an object without data. Error: %s\n", err.Error())
+	} else if dataReader != nil {
+		t.Errorf("Retrieved data of an object without data\n")
+		store.CloseDataReader(dataReader)
+	}
+
+	// The missing data of an object that should have data is not found
+	if _, _, _, err := store.ReadObjectData(orgID, "type1", "2", 10, 0, ""); err == nil || !common.IsNotFound(err) {
+		t.Errorf("Reading the missing data of an object didn't return NotFound. Error: %v\n", err)
+	}
+
+	// The stored data isn't read after the object is updated to have no data
+	if _, err := store.StoreObject(missingData, []byte("data"), common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	missingData.NoData = true
+	if _, err := store.StoreObject(missingData, nil, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	if data, eof, length, err := store.ReadObjectData(orgID, "type1", "2", 10, 0, ""); err != nil {
+		t.Errorf("Failed to read the data of an object without data. Error: %s\n", err.Error())
+	} else if !eof || length != 0 || len(data) != 0 {
+		t.Errorf("Read %d bytes (eof = %t) of an object updated to have no data\n", length, eof)
+	}
 }
 
 func testStorageObjectDestinations(storageType string, t *testing.T) {
@@ -1683,13 +2170,13 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 
 	for _, test := range tests {
 		// Delete the object first
-		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID); err != nil {
+		if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID, ""); err != nil {
 			t.Errorf("Failed to delete object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		}
 	}
 	for _, test := range tests {
 		// Insert
-		if deletedDests, err := store.StoreObject(test.metaData, nil, test.status); err != nil {
+		if deletedDests, err := store.StoreObject(test.metaData, nil, test.status, ""); err != nil {
 			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
 		} else {
 			if len(deletedDests) != test.numberOfDeletedDests {
@@ -1846,7 +2333,8 @@ func testStorageOrganizations(storageType string, t *testing.T) {
 	tests := []common.Organization{
 		{OrgID: "org1", User: "key1", Password: "secret1", Address: "tcp://abc:1883"},
 		{OrgID: "org1", User: "key2", Password: "secret2", Address: "tcp://abc:2883"},
-		{OrgID: "org3", User: "key3", Password: "secret3", Address: "tcp://abc:2883"},
+		{OrgID: "org3", User: "key3", Password: "secret3", Address: "tcp://abc:2883",
+			Features: map[string]bool{"compression": true, "encryption-required": false}},
 	}
 
 	for _, test := range tests {
@@ -1868,6 +2356,14 @@ func testStorageOrganizations(storageType string, t *testing.T) {
 			if org.Org.Address != test.Address {
 				t.Errorf("RetrieveOrganizationInfo returned org with incorrect Address: %s instead of %s\n", org.Org.Address, test.Address)
 			}
+			if len(org.Org.Features) != len(test.Features) {
+				t.Errorf("RetrieveOrganizationInfo returned org with incorrect Features: %v instead of %v\n", org.Org.Features, test.Features)
+			}
+			for feature, enabled := range test.Features {
+				if org.Org.FeatureEnabled(feature, !enabled) != enabled {
+					t.Errorf("RetrieveOrganizationInfo returned org with incorrect feature %s: %v instead of %v\n", feature, !enabled, enabled)
+				}
+			}
 		}
 	}
 
@@ -1877,6 +2373,32 @@ func testStorageOrganizations(storageType string, t *testing.T) {
 		t.Errorf("RetrieveOrganizations returned incorrect number of orgs: %d instead of %d\n", len(orgs)-initialNumberOfOrgs, len(tests)-1)
 	}
 
+	allOrgs, total, err := store.RetrieveOrganizationsPage(0, 0)
+	if err != nil {
+		t.Errorf("RetrieveOrganizationsPage failed. Error: %s\n", err.Error())
+	} else if total != initialNumberOfOrgs+len(tests)-1 || len(allOrgs) != total {
+		t.Errorf("RetrieveOrganizationsPage returned %d orgs out of %d instead of %d\n", len(allOrgs), total, initialNumberOfOrgs+len(tests)-1)
+	} else {
+		for i := 1; i < len(allOrgs); i++ {
+			if allOrgs[i-1].Org.OrgID >= allOrgs[i].Org.OrgID {
+				t.Errorf("RetrieveOrganizationsPage returned orgs out of order: %s before %s\n", allOrgs[i-1].Org.OrgID, allOrgs[i].Org.OrgID)
+			}
+		}
+		if page, pageTotal, err := store.RetrieveOrganizationsPage(1, 1); err != nil {
+			t.Errorf("RetrieveOrganizationsPage failed. Error: %s\n", err.Error())
+		} else if pageTotal != total || len(page) != 1 || page[0].Org.OrgID != allOrgs[1].Org.OrgID {
+			t.Errorf("RetrieveOrganizationsPage returned an incorrect page: %v (total %d)\n", page, pageTotal)
+		}
+		if page, _, err := store.RetrieveOrganizationsPage(total, 10); err != nil {
+			t.Errorf("RetrieveOrganizationsPage failed. Error: %s\n", err.Error())
+		} else if len(page) != 0 {
+			t.Errorf("RetrieveOrganizationsPage returned %d orgs past the last org\n", len(page))
+		}
+	}
+	if _, _, err := store.RetrieveOrganizationsPage(-1, 10); err == nil {
+		t.Errorf("RetrieveOrganizationsPage didn't fail with a negative offset\n")
+	}
+
 	for _, test := range tests {
 		if err := store.DeleteOrganizationInfo(test.OrgID); err != nil {
 			t.Errorf("DeleteOrganizationInfo failed. Error: %s\n", err.Error())
@@ -1984,9 +2506,3013 @@ func setUpStorage(storageType string) (Storage, error) {
 	case common.Mongo:
 		common.Configuration.MongoDbName = "d_test_db"
 		store = &Cache{Store: &MongoStorage{}}
+	case testStorageType:
+		store = &Cache{Store: &TestStorage{}}
 	}
 	if err := store.Init(); err != nil {
 		return nil, &Error{fmt.Sprintf("Failed to initialize storage driver. Error: %s\n", err.Error())}
 	}
 	return store, nil
 }
+
+func testStorageAuditLog(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	// The audit log outlives the objects, use a unique object ID to ignore records of previous runs
+	objectID := fmt.Sprintf("audit%d", time.Now().UnixNano())
+	metaData := common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: "auditorg", DestID: "dev1", DestType: "device"}
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, "auditorg/user1"); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	if err := store.UpdateObjectStatus("auditorg", "type1", objectID, common.ReadyToSend, "auditorg/user2"); err != nil {
+		t.Errorf("Failed to update object's status. Error: %s\n", err.Error())
+	}
+	if err := store.MarkObjectDeleted("auditorg", "type1", objectID, "device/dev1"); err != nil {
+		t.Errorf("Failed to mark object as deleted. Error: %s\n", err.Error())
+	}
+	if err := store.DeleteStoredObject("auditorg", "type1", objectID, common.SyncServiceIdentity); err != nil {
+		t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+	}
+
+	expected := []common.AuditRecord{
+		{Action: common.AuditStore, Status: common.NotReadyToSend, Identity: "auditorg/user1"},
+		{Action: common.AuditUpdateStatus, Status: common.ReadyToSend, Identity: "auditorg/user2"},
+		{Action: common.AuditMarkDeleted, Status: common.ObjDeleted, Identity: "device/dev1"},
+		{Action: common.AuditDelete, Status: "", Identity: common.SyncServiceIdentity},
+	}
+	records, err := store.RetrieveAuditLog("auditorg", "type1", objectID)
+	if err != nil {
+		t.Errorf("Failed to retrieve the audit log. Error: %s\n", err.Error())
+		return
+	}
+	if len(records) != len(expected) {
+		t.Errorf("Retrieved %d audit records instead of %d: %+v\n", len(records), len(expected), records)
+		return
+	}
+	for i, record := range records {
+		if record.OrgID != "auditorg" || record.ObjectType != "type1" || record.ObjectID != objectID {
+			t.Errorf("Audit record %d is of the wrong object: %s:%s:%s\n", i, record.OrgID, record.ObjectType, record.ObjectID)
+		}
+		if record.Action != expected[i].Action || record.Status != expected[i].Status || record.Identity != expected[i].Identity {
+			t.Errorf("Wrong audit record %d: %+v instead of %+v\n", i, record, expected[i])
+		}
+		if record.Timestamp.IsZero() || (i > 0 && record.Timestamp.Before(records[i-1].Timestamp)) {
+			t.Errorf("Audit record %d has a wrong timestamp: %s\n", i, record.Timestamp)
+		}
+	}
+
+	if records, err := store.RetrieveAuditLog("auditorg", "type1", "noSuchObject"); err != nil {
+		t.Errorf("Failed to retrieve the audit log. Error: %s\n", err.Error())
+	} else if len(records) != 0 {
+		t.Errorf("Retrieved audit records of a non-existing object: %+v\n", records)
+	}
+}
+
+func testStorageAuditLogRetention(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	objectID := fmt.Sprintf("audit%d", time.Now().UnixNano())
+	metaData := common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: "auditorg2", DestID: "dev1", DestType: "device"}
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, "auditorg2/user1"); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	if err := store.UpdateObjectStatus("auditorg2", "type1", objectID, common.ReadyToSend, "auditorg2/user1"); err != nil {
+		t.Errorf("Failed to update object's status. Error: %s\n", err.Error())
+	}
+
+	checkRecords := func(step string, expected int) {
+		if records, err := store.RetrieveAuditLog("auditorg2", "type1", objectID); err != nil {
+			t.Errorf("Failed to retrieve the audit log %s. Error: %s\n", step, err.Error())
+		} else if len(records) != expected {
+			t.Errorf("Retrieved %d audit records instead of %d %s\n", len(records), expected, step)
+		}
+	}
+
+	if err := store.PurgeAuditLog(time.Hour); err != nil {
+		t.Errorf("Failed to purge the audit log. Error: %s\n", err.Error())
+	}
+	checkRecords("after purging the records older than an hour", 2)
+
+	if err := store.PurgeAuditLog(0); err != nil {
+		t.Errorf("Failed to purge the audit log. Error: %s\n", err.Error())
+	}
+	checkRecords("after purging all the records", 0)
+
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, "auditorg2/user1"); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	checkRecords("after storing the object again", 1)
+
+	if err := store.DeleteOrganization("auditorg2"); err != nil {
+		t.Errorf("Failed to delete organization. Error: %s\n", err.Error())
+	}
+	checkRecords("after deleting the organization", 0)
+}
+
+func testStorageExportImportOrganization(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "exportorg"
+	store.DeleteOrganization(orgID)
+
+	// Span several data frames
+	data := make([]byte, 150000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	dest := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	objectsToExport := []struct {
+		metaData common.MetaData
+		data     []byte
+		status   string
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestID: "dev1", DestType: "device"},
+			data, common.ReadyToSend},
+		{common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: orgID, NoData: true},
+			nil, common.NotReadyToSend},
+		{common.MetaData{ObjectID: "3", ObjectType: "type2", DestOrgID: orgID, DestID: "dev1", DestType: "device"},
+			[]byte("small"), common.CompletelyReceived},
+	}
+	notification := common.Notification{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestID: "dev1", DestType: "device",
+		Status: common.Update, InstanceID: 5}
+	users := []common.ACLentry{{Username: "user1", ACLUserType: "user", ACLRole: "admin"}}
+
+	if err := store.StoreDestination(dest); err != nil {
+		t.Errorf("Failed to store destination. Error: %s\n", err.Error())
+	}
+	if err := store.StoreOrgToMessagingGroup(orgID, "exportgroup"); err != nil {
+		t.Errorf("Failed to store messaging group. Error: %s\n", err.Error())
+	}
+	if err := store.AddUsersToACL(common.ObjectsACLType, orgID, "type1", users); err != nil {
+		t.Errorf("Failed to add users to ACL. Error: %s\n", err.Error())
+	}
+	if err := store.AddWebhook(orgID, "type1", "http://example.com/hook"); err != nil {
+		t.Errorf("Failed to add webhook. Error: %s\n", err.Error())
+	}
+	for _, test := range objectsToExport {
+		if _, err := store.StoreObject(test.metaData, test.data, test.status, ""); err != nil {
+			t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		}
+	}
+	if err := store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("Failed to store notification. Error: %s\n", err.Error())
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := store.ExportOrganization(orgID, buffer); err != nil {
+		t.Errorf("ExportOrganization failed. Error: %s\n", err.Error())
+		return
+	}
+	exported := buffer.Bytes()
+
+	if err := store.DeleteOrganization(orgID); err != nil {
+		t.Errorf("Failed to delete organization. Error: %s\n", err.Error())
+	}
+	store.DeleteWebhook(orgID, "type1", "http://example.com/hook")
+	for _, test := range objectsToExport {
+		store.DeleteStoredObject(orgID, test.metaData.ObjectType, test.metaData.ObjectID, "")
+	}
+
+	if err := store.ImportOrganization(bytes.NewReader(exported)); err != nil {
+		t.Errorf("ImportOrganization failed. Error: %s\n", err.Error())
+		return
+	}
+
+	for _, test := range objectsToExport {
+		storedMetaData, status, err := store.RetrieveObjectAndStatus(orgID, test.metaData.ObjectType, test.metaData.ObjectID)
+		if err != nil {
+			t.Errorf("Failed to retrieve imported object. Error: %s\n", err.Error())
+			continue
+		} else if storedMetaData == nil {
+			t.Errorf("Object %s wasn't imported\n", test.metaData.ObjectID)
+			continue
+		}
+		if status != test.status {
+			t.Errorf("Imported object %s has status %s instead of %s\n", test.metaData.ObjectID, status, test.status)
+		}
+		dataReader, err := store.RetrieveObjectData(orgID, test.metaData.ObjectType, test.metaData.ObjectID, "")
+		if err != nil {
+			t.Errorf("Failed to retrieve data of imported object. Error: %s\n", err.Error())
+			continue
+		}
+		if test.data == nil {
+			if dataReader != nil {
+				t.Errorf("Imported object %s without data has data\n", test.metaData.ObjectID)
+				store.CloseDataReader(dataReader)
+			}
+			continue
+		}
+		if dataReader == nil {
+			t.Errorf("The data of object %s wasn't imported\n", test.metaData.ObjectID)
+			continue
+		}
+		if importedData, err := ioutil.ReadAll(dataReader); err != nil {
+			t.Errorf("Failed to read data of imported object. Error: %s\n", err.Error())
+		} else if !bytes.Equal(importedData, test.data) {
+			t.Errorf("Imported data of object %s is different from the exported data\n", test.metaData.ObjectID)
+		}
+		store.CloseDataReader(dataReader)
+	}
+
+	if hooks, err := store.RetrieveWebhooks(orgID, "type1"); err != nil {
+		t.Errorf("Failed to retrieve imported webhooks. Error: %s\n", err.Error())
+	} else if len(hooks) != 1 || hooks[0] != "http://example.com/hook" {
+		t.Errorf("Wrong imported webhooks: %v\n", hooks)
+	}
+
+	if n, err := store.RetrieveNotificationRecord(orgID, "type1", "1", "device", "dev1"); err != nil {
+		t.Errorf("Failed to retrieve imported notification. Error: %s\n", err.Error())
+	} else if n == nil || n.Status != common.Update || n.InstanceID != 5 {
+		t.Errorf("Wrong imported notification: %+v\n", n)
+	}
+
+	// The in-memory storage doesn't keep destinations, messaging groups and ACLs
+	if storageType != common.InMemory {
+		if exists, err := store.DestinationExists(orgID, "device", "dev1"); err != nil || !exists {
+			t.Errorf("The destination wasn't imported\n")
+		}
+		if group, err := store.RetrieveMessagingGroup(orgID); err != nil || group != "exportgroup" {
+			t.Errorf("The messaging group wasn't imported: %s\n", group)
+		}
+		if aclUsers, err := store.RetrieveACL(common.ObjectsACLType, orgID, "type1", ""); err != nil {
+			t.Errorf("Failed to retrieve imported ACL. Error: %s\n", err.Error())
+		} else if len(aclUsers) != 1 || aclUsers[0].Username != "user1" {
+			t.Errorf("Wrong imported ACL: %+v\n", aclUsers)
+		}
+	}
+
+	if err := store.ImportOrganization(bytes.NewReader(exported[:len(exported)/2])); err == nil {
+		t.Errorf("ImportOrganization of a truncated export didn't fail\n")
+	}
+	if err := store.ImportOrganization(bytes.NewReader([]byte("not an export"))); err == nil {
+		t.Errorf("ImportOrganization of an invalid stream didn't fail\n")
+	}
+
+	store.DeleteWebhook(orgID, "type1", "http://example.com/hook")
+	for _, test := range objectsToExport {
+		store.DeleteStoredObject(orgID, test.metaData.ObjectType, test.metaData.ObjectID, "")
+	}
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageCheckACL(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "aclcheckorg"
+	store.DeleteOrganization(orgID)
+
+	if err := store.StoreACLGroup(common.ACLGroup{OrgID: orgID, Name: "ops", Members: []string{"user3", "user4"}}); err != nil {
+		t.Errorf("StoreACLGroup failed. Error: %s\n", err.Error())
+	}
+	if err := store.StoreACLGroup(common.ACLGroup{OrgID: orgID, Name: "bad:name"}); err == nil {
+		t.Errorf("StoreACLGroup with an invalid name didn't fail\n")
+	}
+
+	typeACL := []common.ACLentry{{Username: "user1", ACLUserType: "user", ACLRole: "aclWriter"},
+		{Username: common.ACLGroupPrefix + "ops", ACLUserType: "user", ACLRole: "aclWriter"},
+		{Username: common.ACLGroupPrefix + "noSuchGroup", ACLUserType: "user", ACLRole: "aclWriter"}}
+	if err := store.AddUsersToACL(common.ObjectsACLType, orgID, "type1", typeACL); err != nil {
+		t.Errorf("AddUsersToACL failed. Error: %s\n", err.Error())
+	}
+	allTypesACL := []common.ACLentry{{Username: "user2", ACLUserType: "user", ACLRole: "aclReader"}}
+	if err := store.AddUsersToACL(common.ObjectsACLType, orgID, "", allTypesACL); err != nil {
+		t.Errorf("AddUsersToACL failed. Error: %s\n", err.Error())
+	}
+
+	tests := []struct {
+		key      string
+		username string
+		expected bool
+	}{
+		{"type1", "user1", true},
+		{"type1", "user2", true}, // From the ACL of all the types
+		{"type1", "user3", true}, // Member of the ops group
+		{"type1", "user5", false},
+		{"type2", "user1", false},
+		{"type2", "user2", true},
+		{"type2", "user3", false},
+		{"", "user2", true},
+		{"", "user1", false},
+	}
+	for _, test := range tests {
+		if allowed, err := store.CheckACL(common.ObjectsACLType, orgID, test.key, test.username); err != nil {
+			t.Errorf("CheckACL failed. Error: %s\n", err.Error())
+		} else if allowed != test.expected {
+			t.Errorf("CheckACL of %s for key %s returned %t instead of %t\n", test.username, test.key, allowed, test.expected)
+		}
+	}
+
+	// Group membership is resolved at check time
+	if err := store.StoreACLGroup(common.ACLGroup{OrgID: orgID, Name: "ops", Members: []string{"user5"}}); err != nil {
+		t.Errorf("StoreACLGroup failed. Error: %s\n", err.Error())
+	}
+	if allowed, err := store.CheckACL(common.ObjectsACLType, orgID, "type1", "user5"); err != nil || !allowed {
+		t.Errorf("CheckACL didn't grant access to a new member of a group\n")
+	}
+	if allowed, err := store.CheckACL(common.ObjectsACLType, orgID, "type1", "user3"); err != nil || allowed {
+		t.Errorf("CheckACL granted access to a removed member of a group\n")
+	}
+
+	// A wildcard entry matches everyone
+	if err := store.AddUsersToACL(common.ObjectsACLType, orgID, "type2",
+		[]common.ACLentry{{Username: common.ACLWildcard, ACLUserType: "user", ACLRole: "aclReader"}}); err != nil {
+		t.Errorf("AddUsersToACL failed. Error: %s\n", err.Error())
+	}
+	if allowed, err := store.CheckACL(common.ObjectsACLType, orgID, "type2", "anyone"); err != nil || !allowed {
+		t.Errorf("CheckACL didn't grant access by a wildcard entry\n")
+	}
+
+	if groups, err := store.RetrieveACLGroups(orgID); err != nil {
+		t.Errorf("RetrieveACLGroups failed. Error: %s\n", err.Error())
+	} else if len(groups) != 1 || groups[0].Name != "ops" {
+		t.Errorf("RetrieveACLGroups returned wrong groups: %+v\n", groups)
+	}
+	if err := store.DeleteACLGroup(orgID, "ops"); err != nil {
+		t.Errorf("DeleteACLGroup failed. Error: %s\n", err.Error())
+	}
+	if group, err := store.RetrieveACLGroup(orgID, "ops"); err != nil || group != nil {
+		t.Errorf("The ACL group wasn't deleted\n")
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageACLUsernameNormalization(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	trim := common.Configuration.ACLTrimUsernames
+	caseInsensitive := common.Configuration.ACLCaseInsensitiveUsernames
+	defer func() {
+		common.Configuration.ACLTrimUsernames = trim
+		common.Configuration.ACLCaseInsensitiveUsernames = caseInsensitive
+	}()
+
+	orgID := "aclnormorg"
+	store.DeleteOrganization(orgID)
+
+	// Store usernames verbatim, as before the normalization was configured
+	common.Configuration.ACLTrimUsernames = false
+	common.Configuration.ACLCaseInsensitiveUsernames = false
+	legacyUsers := []common.ACLentry{{Username: "Bob@org", ACLUserType: "user", ACLRole: "aclWriter"},
+		{Username: " bob@org", ACLUserType: "user", ACLRole: "aclWriter"}}
+	if err := store.AddUsersToACL(common.ObjectsACLType, orgID, "type1", legacyUsers); err != nil {
+		t.Errorf("AddUsersToACL failed. Error: %s\n", err.Error())
+	}
+	if users, err := store.RetrieveACL(common.ObjectsACLType, orgID, "type1", ""); err != nil || len(users) != 2 {
+		t.Errorf("Usernames that differ in case and white space were merged without normalization: %+v\n", users)
+	}
+
+	common.Configuration.ACLTrimUsernames = true
+	common.Configuration.ACLCaseInsensitiveUsernames = true
+	if modified, err := store.NormalizeACLUsernames(); err != nil {
+		t.Errorf("NormalizeACLUsernames failed. Error: %s\n", err.Error())
+	} else if modified < 1 {
+		t.Errorf("NormalizeACLUsernames didn't modify the ACL\n")
+	}
+	if users, err := store.RetrieveACL(common.ObjectsACLType, orgID, "type1", ""); err != nil {
+		t.Errorf("RetrieveACL failed. Error: %s\n", err.Error())
+	} else if len(users) != 1 || users[0].Username != "bob@org" {
+		t.Errorf("The ACL wasn't normalized: %+v\n", users)
+	}
+	if modified, err := store.NormalizeACLUsernames(); err != nil {
+		t.Errorf("NormalizeACLUsernames failed. Error: %s\n", err.Error())
+	} else if modified != 0 {
+		t.Errorf("NormalizeACLUsernames modified %d normalized ACLs\n", modified)
+	}
+
+	if err := store.AddUsersToACL(common.ObjectsACLType, orgID, "type1",
+		[]common.ACLentry{{Username: " Alice@Org ", ACLUserType: "user", ACLRole: "aclReader"},
+			{Username: "ALICE@org", ACLUserType: "user", ACLRole: "aclReader"}}); err != nil {
+		t.Errorf("AddUsersToACL failed. Error: %s\n", err.Error())
+	}
+	if users, err := store.RetrieveACL(common.ObjectsACLType, orgID, "type1", ""); err != nil {
+		t.Errorf("RetrieveACL failed. Error: %s\n", err.Error())
+	} else if len(users) != 2 {
+		t.Errorf("Wrong number of ACL entries after adding normalized usernames: %+v\n", users)
+	}
+	if allowed, err := store.CheckACL(common.ObjectsACLType, orgID, "type1", "Alice@ORG"); err != nil || !allowed {
+		t.Errorf("CheckACL didn't match the normalized username\n")
+	}
+	if types, err := store.RetrieveObjOrDestTypeForGivenACLUser(common.ObjectsACLType, orgID, "user", "alice@ORG", ""); err != nil {
+		t.Errorf("RetrieveObjOrDestTypeForGivenACLUser failed. Error: %s\n", err.Error())
+	} else if len(types) != 1 || types[0] != "type1" {
+		t.Errorf("RetrieveObjOrDestTypeForGivenACLUser returned %v instead of [type1]\n", types)
+	}
+
+	if err := store.RemoveUsersFromACL(common.ObjectsACLType, orgID, "type1",
+		[]common.ACLentry{{Username: "alice@ORG", ACLUserType: "user"}}); err != nil {
+		t.Errorf("RemoveUsersFromACL failed. Error: %s\n", err.Error())
+	}
+	if users, err := store.RetrieveACL(common.ObjectsACLType, orgID, "type1", ""); err != nil {
+		t.Errorf("RetrieveACL failed. Error: %s\n", err.Error())
+	} else if len(users) != 1 || users[0].Username != "bob@org" {
+		t.Errorf("The user wasn't removed by a differently cased username: %+v\n", users)
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageRetrieveObjectsForDestination(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "destobjorg"
+	store.DeleteOrganization(orgID)
+
+	tests := []struct {
+		objectID           string
+		notificationStatus string
+		objectStatus       string
+	}{
+		{"1", common.Update, common.Delivering},
+		{"2", common.ReceivedByDestination, common.Delivered},
+		{"3", common.ConsumedByDestination, common.Consumed},
+		{"4", common.Error, common.Error},
+		{"5", common.Delete, ""},
+	}
+
+	for _, test := range tests {
+		metaData := common.MetaData{ObjectID: test.objectID, ObjectType: "type1", DestOrgID: orgID,
+			DestType: "device", DestID: "dev1", Description: "object " + test.objectID}
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+		}
+		n := common.Notification{ObjectID: test.objectID, ObjectType: "type1", DestOrgID: orgID, DestID: "dev1", DestType: "device",
+			Status: test.notificationStatus}
+		if err := store.UpdateNotificationRecord(n); err != nil {
+			t.Errorf("UpdateNotificationRecord failed. Error: %s\n", err.Error())
+		}
+	}
+	// A notification for an object that doesn't exist is skipped
+	if err := store.UpdateNotificationRecord(common.Notification{ObjectID: "6", ObjectType: "type1", DestOrgID: orgID,
+		DestID: "dev1", DestType: "device", Status: common.Update}); err != nil {
+		t.Errorf("UpdateNotificationRecord failed. Error: %s\n", err.Error())
+	}
+
+	objects, err := store.RetrieveObjectsForDestination(orgID, "device", "dev1", "")
+	if err != nil {
+		t.Errorf("RetrieveObjectsForDestination failed. Error: %s\n", err.Error())
+	} else if len(objects) != 4 {
+		t.Errorf("RetrieveObjectsForDestination returned %d objects instead of 4\n", len(objects))
+	} else {
+		for _, object := range objects {
+			found := false
+			for _, test := range tests {
+				if test.objectID == object.MetaData.ObjectID {
+					found = true
+					if test.objectStatus != object.Status {
+						t.Errorf("Wrong status for object %s: %s instead of %s\n", test.objectID, object.Status, test.objectStatus)
+					}
+					if object.MetaData.Description != "object "+test.objectID {
+						t.Errorf("Wrong meta data for object %s: %+v\n", test.objectID, object.MetaData)
+					}
+				}
+			}
+			if !found || object.Status == "" {
+				t.Errorf("Unexpected object returned: %+v\n", object)
+			}
+		}
+	}
+
+	objects, err = store.RetrieveObjectsForDestination(orgID, "device", "dev1", common.Delivered)
+	if err != nil {
+		t.Errorf("RetrieveObjectsForDestination failed. Error: %s\n", err.Error())
+	} else if len(objects) != 1 || objects[0].MetaData.ObjectID != "2" || objects[0].Status != common.Delivered {
+		t.Errorf("RetrieveObjectsForDestination with a status filter returned wrong objects: %+v\n", objects)
+	}
+
+	objects, err = store.RetrieveObjectsForDestination(orgID, "device", "dev2", "")
+	if err != nil {
+		t.Errorf("RetrieveObjectsForDestination failed. Error: %s\n", err.Error())
+	} else if len(objects) != 0 {
+		t.Errorf("RetrieveObjectsForDestination returned objects for an unknown destination: %+v\n", objects)
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageRetrieveObjectIfModifiedSince(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "modsinceorg"
+	store.DeleteOrganization(orgID)
+
+	before := time.Now().Add(-2 * time.Second)
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, NoData: true}
+	if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+		t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+		return
+	}
+
+	if meta, status, modified, err := store.RetrieveObjectIfModifiedSince(orgID, "type1", "1", before); err != nil {
+		t.Errorf("RetrieveObjectIfModifiedSince failed. Error: %s\n", err.Error())
+	} else if !modified || meta == nil || meta.ObjectID != "1" || status != common.ReadyToSend {
+		t.Errorf("RetrieveObjectIfModifiedSince didn't return a modified object: modified=%t, status=%s, meta=%+v\n", modified, status, meta)
+	}
+
+	after := time.Now().Add(2 * time.Second)
+	if meta, _, modified, err := store.RetrieveObjectIfModifiedSince(orgID, "type1", "1", after); err != nil {
+		t.Errorf("RetrieveObjectIfModifiedSince failed. Error: %s\n", err.Error())
+	} else if modified || meta != nil {
+		t.Errorf("RetrieveObjectIfModifiedSince returned an object that wasn't modified: %+v\n", meta)
+	}
+
+	if meta, _, modified, err := store.RetrieveObjectIfModifiedSince(orgID, "type1", "2", before); err != nil {
+		t.Errorf("RetrieveObjectIfModifiedSince failed. Error: %s\n", err.Error())
+	} else if !modified || meta != nil {
+		t.Errorf("RetrieveObjectIfModifiedSince returned wrong result for a nonexistent object: modified=%t, meta=%+v\n", modified, meta)
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageOfflineDestinations(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "offlineorg"
+	store.DeleteOrganization(orgID)
+
+	dest1 := common.Destination{DestOrgID: orgID, DestID: "1", DestType: "device", Communication: common.MQTTProtocol}
+	dest2 := common.Destination{DestOrgID: orgID, DestID: "2", DestType: "device", Communication: common.HTTPProtocol}
+	for _, dest := range []common.Destination{dest1, dest2} {
+		if err := store.StoreDestination(dest); err != nil {
+			t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+		}
+	}
+
+	if dests, err := store.RetrieveOfflineDestinations(orgID, time.Hour); err != nil {
+		t.Errorf("RetrieveOfflineDestinations failed. Error: %s\n", err.Error())
+	} else if len(dests) != 0 {
+		t.Errorf("RetrieveOfflineDestinations returned destinations that have just registered: %+v\n", dests)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := store.RetrieveObjects(orgID, dest1.DestType, dest1.DestID, common.ResendAll); err != nil {
+		t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+	}
+
+	if dests, err := store.RetrieveOfflineDestinations(orgID, 100*time.Millisecond); err != nil {
+		t.Errorf("RetrieveOfflineDestinations failed. Error: %s\n", err.Error())
+	} else if len(dests) != 1 || dests[0].DestID != dest2.DestID {
+		t.Errorf("RetrieveOfflineDestinations returned wrong destinations: %+v\n", dests)
+	} else if dests[0].LastConnected.IsZero() || time.Since(dests[0].LastConnected) < 100*time.Millisecond {
+		t.Errorf("RetrieveOfflineDestinations returned a wrong last connected time: %s\n", dests[0].LastConnected)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := store.RetrieveNotifications(orgID, dest2.DestType, dest2.DestID, false); err != nil {
+		t.Errorf("RetrieveNotifications failed. Error: %s\n", err.Error())
+	}
+
+	if dests, err := store.RetrieveOfflineDestinations(orgID, 100*time.Millisecond); err != nil {
+		t.Errorf("RetrieveOfflineDestinations failed. Error: %s\n", err.Error())
+	} else if len(dests) != 1 || dests[0].DestID != dest1.DestID {
+		t.Errorf("RetrieveOfflineDestinations returned wrong destinations: %+v\n", dests)
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageRegisterDestination(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "registerorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestType: "device", NoData: true}
+	if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+
+	// Objects aren't sent to destinations that didn't register
+	if objects, err := store.RetrieveObjects(orgID, "device", "1", common.ResendAll); err != nil {
+		t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+	} else if len(objects) != 0 {
+		t.Errorf("RetrieveObjects returned %d objects for a destination that didn't register\n", len(objects))
+	}
+
+	dest := common.Destination{DestOrgID: orgID, DestID: "1", DestType: "device", Communication: common.MQTTProtocol}
+	if err := store.RegisterDestination(dest); err != nil {
+		t.Errorf("RegisterDestination failed. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveDestination(orgID, "device", "1"); err != nil || stored == nil {
+		t.Errorf("Failed to retrieve the registered destination. Error: %v\n", err)
+	} else if *stored != dest {
+		t.Errorf("Retrieved destination %+v instead of %+v\n", *stored, dest)
+	}
+	if dests, err := store.RetrieveOfflineDestinations(orgID, time.Hour); err != nil {
+		t.Errorf("RetrieveOfflineDestinations failed. Error: %s\n", err.Error())
+	} else if len(dests) != 0 {
+		t.Errorf("RetrieveOfflineDestinations returned a destination that has just registered: %+v\n", dests)
+	}
+
+	if objects, err := store.RetrieveObjects(orgID, "device", "1", common.ResendAll); err != nil {
+		t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+	} else if len(objects) != 1 {
+		t.Errorf("RetrieveObjects returned %d objects instead of 1 for a registered destination\n", len(objects))
+	}
+
+	// A heartbeat updates the registered destination
+	dest.Communication = common.HTTPProtocol
+	time.Sleep(200 * time.Millisecond)
+	if err := store.RegisterDestination(dest); err != nil {
+		t.Errorf("RegisterDestination failed. Error: %s\n", err.Error())
+	}
+	if protocol, err := store.RetrieveDestinationProtocol(orgID, "device", "1"); err != nil || protocol != common.HTTPProtocol {
+		t.Errorf("The protocol of the registered destination is %s instead of %s. Error: %v\n", protocol, common.HTTPProtocol, err)
+	}
+	if dests, err := store.RetrieveOfflineDestinations(orgID, 100*time.Millisecond); err != nil {
+		t.Errorf("RetrieveOfflineDestinations failed. Error: %s\n", err.Error())
+	} else if len(dests) != 0 {
+		t.Errorf("RetrieveOfflineDestinations returned a destination that has just sent a heartbeat: %+v\n", dests)
+	}
+}
+
+func testStorageMaxObjectSize(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	maxObjectSize := common.Configuration.MaxObjectSize
+	maxObjectSizeByType := common.Configuration.MaxObjectSizeByType
+	defer func() {
+		common.Configuration.MaxObjectSize = maxObjectSize
+		common.Configuration.MaxObjectSizeByType = maxObjectSizeByType
+	}()
+	common.Configuration.MaxObjectSize = 10
+	common.Configuration.MaxObjectSizeByType = "unlimited:0"
+
+	orgID := "maxsizeorg"
+	store.DeleteOrganization(orgID)
+
+	for _, objectType := range []string{"limited", "unlimited"} {
+		metaData := common.MetaData{ObjectID: "1", ObjectType: objectType, DestOrgID: orgID}
+		if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+			t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+		}
+	}
+
+	data := []byte("0123456789abcdefghij")
+	if _, err := store.StoreObjectData(orgID, "limited", "1", bytes.NewReader(data[:10])); err != nil {
+		t.Errorf("StoreObjectData failed for data of the maximum size. Error: %s\n", err.Error())
+	}
+	if _, err := store.StoreObjectData(orgID, "limited", "1", bytes.NewReader(data)); err == nil {
+		t.Errorf("StoreObjectData stored data larger than the maximum object size\n")
+	} else if !common.IsObjectTooLargeError(err) {
+		t.Errorf("StoreObjectData returned an error of the wrong type: %s\n", err.Error())
+	}
+	if _, err := store.StoreObjectData(orgID, "unlimited", "1", bytes.NewReader(data)); err != nil {
+		t.Errorf("StoreObjectData failed for an object type without a limit. Error: %s\n", err.Error())
+	}
+
+	// The total size is checked with the first chunk
+	if err := store.AppendObjectData(orgID, "limited", "1", bytes.NewReader(data[:5]), 5, 0, int64(len(data)), true, false); err == nil ||
+		!common.IsObjectTooLargeError(err) {
+		t.Errorf("AppendObjectData didn't reject an object whose total size is larger than the maximum object size\n")
+	}
+
+	// The data is counted as it is read
+	if err := store.AppendObjectData(orgID, "limited", "1", bytes.NewReader(data[:8]), 8, 0, 8, true, false); err != nil {
+		t.Errorf("AppendObjectData failed. Error: %s\n", err.Error())
+	}
+	if err := store.AppendObjectData(orgID, "limited", "1", bytes.NewReader(data[8:]), uint32(len(data)-8), 8, 8, false, true); err == nil ||
+		!common.IsObjectTooLargeError(err) {
+		t.Errorf("AppendObjectData didn't reject data beyond the maximum object size\n")
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageTouchObject(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "touchorg"
+	store.DeleteOrganization(orgID)
+
+	now := time.Now()
+	tests := []struct {
+		objectID   string
+		status     string
+		expiration string
+		deleted    bool
+		valid      bool
+		minimum    time.Time
+	}{
+		{"1", common.ReadyToSend, now.Add(time.Hour).UTC().Format(time.RFC3339), false, true, now.Add(2*time.Hour - time.Second)},
+		{"2", common.ReadyToSend, now.Add(-time.Hour).UTC().Format(time.RFC3339), false, true, now.Add(time.Hour - time.Second)},
+		{"3", common.ReadyToSend, "", false, true, time.Time{}},
+		{"4", common.NotReadyToSend, now.Add(time.Hour).UTC().Format(time.RFC3339), false, false, time.Time{}},
+		{"5", common.ReadyToSend, now.Add(time.Hour).UTC().Format(time.RFC3339), true, false, time.Time{}},
+	}
+
+	for _, test := range tests {
+		metaData := common.MetaData{ObjectID: test.objectID, ObjectType: "type1", DestOrgID: orgID, NoData: true, Expiration: test.expiration}
+		if _, err := store.StoreObject(metaData, nil, test.status, ""); err != nil {
+			t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+			continue
+		}
+		if test.deleted {
+			if err := store.MarkObjectDeleted(orgID, "type1", test.objectID, ""); err != nil {
+				t.Errorf("MarkObjectDeleted failed. Error: %s\n", err.Error())
+			}
+		}
+
+		err := store.TouchObject(orgID, "type1", test.objectID, time.Hour)
+		if !test.valid {
+			if err == nil || !common.IsInvalidRequest(err) {
+				t.Errorf("TouchObject didn't reject object %s\n", test.objectID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("TouchObject failed for object %s. Error: %s\n", test.objectID, err.Error())
+			continue
+		}
+
+		storedMetaData, err := store.RetrieveObject(orgID, "type1", test.objectID)
+		if err != nil || storedMetaData == nil {
+			t.Errorf("RetrieveObject failed for object %s\n", test.objectID)
+			continue
+		}
+		if test.expiration == "" {
+			if storedMetaData.Expiration != "" {
+				t.Errorf("TouchObject set the expiration (%s) of an object that doesn't expire\n", storedMetaData.Expiration)
+			}
+			continue
+		}
+		if expiration, err := time.Parse(time.RFC3339, storedMetaData.Expiration); err != nil || expiration.Before(test.minimum) {
+			t.Errorf("TouchObject didn't extend the expiration of object %s: %s\n", test.objectID, storedMetaData.Expiration)
+		}
+	}
+
+	if err := store.TouchObject(orgID, "type1", "nonexistent", time.Hour); err == nil {
+		t.Errorf("TouchObject didn't fail for a nonexistent object\n")
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageDecommissionDestination(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "decommissionorg"
+	store.DeleteOrganization(orgID)
+
+	dest1 := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	dest2 := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol}
+	for _, dest := range []common.Destination{dest1, dest2} {
+		if err := store.StoreDestination(dest); err != nil {
+			t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+		}
+	}
+
+	testObjects := []common.MetaData{
+		common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestinationsList: []string{"device:dev1", "device:dev2"}, NoData: true},
+		common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: orgID, DestType: "device", DestID: "dev1", NoData: true},
+		common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: orgID, DestType: "device", DestID: "dev2", NoData: true},
+	}
+	for _, metaData := range testObjects {
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", metaData.ObjectID, err.Error())
+		}
+	}
+
+	testNotifications := []common.Notification{
+		common.Notification{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestType: "device", DestID: "dev1", Status: common.Update},
+		common.Notification{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestType: "device", DestID: "dev2", Status: common.Update},
+		common.Notification{ObjectID: "2", ObjectType: "type1", DestOrgID: orgID, DestType: "device", DestID: "dev1", Status: common.Update},
+	}
+	for _, n := range testNotifications {
+		if err := store.UpdateNotificationRecord(n); err != nil {
+			t.Errorf("UpdateNotificationRecord failed. Error: %s\n", err.Error())
+		}
+	}
+
+	result, err := store.DecommissionDestination(orgID, dest1.DestType, dest1.DestID)
+	if err != nil {
+		t.Errorf("DecommissionDestination failed. Error: %s\n", err.Error())
+	} else if result.ObjectsUpdated != 2 || result.NotificationsDeleted != 2 || !result.DestinationDeleted {
+		t.Errorf("DecommissionDestination returned wrong counts: %+v\n", *result)
+	}
+
+	expected := map[string][]common.Destination{"1": {dest2}, "2": {}, "3": {dest2}}
+	for _, metaData := range testObjects {
+		dests, err := store.GetObjectDestinationsList(orgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil {
+			t.Errorf("GetObjectDestinationsList failed (objectID = %s). Error: %s\n", metaData.ObjectID, err.Error())
+		} else if len(dests) != len(expected[metaData.ObjectID]) {
+			t.Errorf("GetObjectDestinationsList returned %d destinations instead of %d (objectID = %s)\n",
+				len(dests), len(expected[metaData.ObjectID]), metaData.ObjectID)
+		} else if len(dests) == 1 && dests[0].Destination != dest2 {
+			t.Errorf("GetObjectDestinationsList returned wrong destination (objectID = %s): %+v\n", metaData.ObjectID, dests[0].Destination)
+		}
+	}
+
+	if n, err := store.RetrieveNotificationRecord(orgID, "type1", "1", dest1.DestType, dest1.DestID); err == nil && n != nil {
+		t.Errorf("The notification of the decommissioned destination wasn't deleted\n")
+	}
+	if n, err := store.RetrieveNotificationRecord(orgID, "type1", "1", dest2.DestType, dest2.DestID); err != nil || n == nil {
+		t.Errorf("The notification of another destination was deleted\n")
+	}
+	if exists, err := store.DestinationExists(orgID, dest1.DestType, dest1.DestID); err != nil {
+		t.Errorf("DestinationExists failed. Error: %s\n", err.Error())
+	} else if exists {
+		t.Errorf("The decommissioned destination wasn't deleted\n")
+	}
+
+	// Decommissioning again doesn't find anything to remove
+	result, err = store.DecommissionDestination(orgID, dest1.DestType, dest1.DestID)
+	if err != nil {
+		t.Errorf("DecommissionDestination failed. Error: %s\n", err.Error())
+	} else if result.ObjectsUpdated != 0 || result.NotificationsDeleted != 0 || result.DestinationDeleted {
+		t.Errorf("DecommissionDestination returned wrong counts for a decommissioned destination: %+v\n", *result)
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageObjectVersions(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	savedVersionsKept := common.Configuration.ObjectVersionsKept
+	savedVersionsKeptByType := common.Configuration.ObjectVersionsKeptByType
+	defer func() {
+		common.Configuration.ObjectVersionsKept = savedVersionsKept
+		common.Configuration.ObjectVersionsKeptByType = savedVersionsKeptByType
+	}()
+	common.Configuration.ObjectVersionsKept = 2
+	common.Configuration.ObjectVersionsKeptByType = "unversioned:0"
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "versionsorg"
+	store.DeleteOrganization(orgID)
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestID: "dev1", DestType: "device"}
+	instanceIDs := make([]int64, 0)
+	for i := 1; i <= 4; i++ {
+		if _, err := store.StoreObject(metaData, []byte(fmt.Sprintf("version%d", i)), common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object (version %d). Error: %s\n", i, err.Error())
+			return
+		}
+		stored, err := store.RetrieveObject(orgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || stored == nil {
+			t.Errorf("Failed to retrieve object (version %d). Error: %v\n", i, err)
+			return
+		}
+		instanceIDs = append(instanceIDs, stored.InstanceID)
+	}
+
+	unversioned := common.MetaData{ObjectID: "1", ObjectType: "unversioned", DestOrgID: orgID, DestID: "dev1", DestType: "device"}
+	for i := 1; i <= 2; i++ {
+		if _, err := store.StoreObject(unversioned, []byte("data"), common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		}
+	}
+	if versions, err := store.RetrieveObjectVersions(orgID, unversioned.ObjectType, unversioned.ObjectID); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(versions) != 0 {
+		t.Errorf("RetrieveObjectVersions returned %d versions of an object type that isn't versioned\n", len(versions))
+	}
+
+	// The three previous versions are kept until the maintenance prunes them
+	if versions, err := store.RetrieveObjectVersions(orgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(versions) != 3 {
+		t.Errorf("RetrieveObjectVersions returned %d versions instead of 3\n", len(versions))
+	} else {
+		for i, version := range versions {
+			if version.InstanceID != instanceIDs[i] {
+				t.Errorf("RetrieveObjectVersions returned instance ID %d instead of %d\n", version.InstanceID, instanceIDs[i])
+			}
+		}
+	}
+
+	version, dataReader, err := store.RetrieveObjectVersion(orgID, metaData.ObjectType, metaData.ObjectID, instanceIDs[1])
+	if err != nil {
+		t.Errorf("RetrieveObjectVersion failed. Error: %s\n", err.Error())
+	} else if version == nil || version.InstanceID != instanceIDs[1] {
+		t.Errorf("RetrieveObjectVersion returned a wrong version: %+v\n", version)
+	} else if dataReader == nil {
+		t.Errorf("RetrieveObjectVersion didn't return the version's data\n")
+	} else {
+		data, err := ioutil.ReadAll(dataReader)
+		store.CloseDataReader(dataReader)
+		if err != nil {
+			t.Errorf("Failed to read the version's data. Error: %s\n", err.Error())
+		} else if string(data) != "version2" {
+			t.Errorf("RetrieveObjectVersion returned wrong data: %s instead of version2\n", string(data))
+		}
+	}
+
+	// The current version isn't a kept previous version
+	if version, _, err := store.RetrieveObjectVersion(orgID, metaData.ObjectType, metaData.ObjectID, instanceIDs[3]); err != nil {
+		t.Errorf("RetrieveObjectVersion failed. Error: %s\n", err.Error())
+	} else if version != nil {
+		t.Errorf("RetrieveObjectVersion returned the current version of the object\n")
+	}
+
+	store.PerformMaintenance()
+
+	if versions, err := store.RetrieveObjectVersions(orgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(versions) != 2 || versions[0].InstanceID != instanceIDs[1] || versions[1].InstanceID != instanceIDs[2] {
+		t.Errorf("The maintenance didn't prune the oldest version: %+v\n", versions)
+	}
+	if version, _, err := store.RetrieveObjectVersion(orgID, metaData.ObjectType, metaData.ObjectID, instanceIDs[0]); err != nil {
+		t.Errorf("RetrieveObjectVersion failed. Error: %s\n", err.Error())
+	} else if version != nil {
+		t.Errorf("RetrieveObjectVersion returned a pruned version\n")
+	}
+
+	store.DeleteOrganization(orgID)
+	if versions, err := store.RetrieveObjectVersions(orgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(versions) != 0 {
+		t.Errorf("The versions of the deleted organization weren't deleted\n")
+	}
+}
+
+func testStorageWebhookRetryPolicies(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "webhookorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	invalidPolicies := []common.WebhookRetryPolicy{
+		{OrgID: orgID, Attempts: 1},
+		{ObjectType: "type1", Attempts: 1},
+		{OrgID: orgID, ObjectType: "type1"},
+		{OrgID: orgID, ObjectType: "type1", Attempts: 1, Backoff: -1},
+	}
+	for _, policy := range invalidPolicies {
+		if err := store.StoreWebhookRetryPolicy(policy); err == nil || !common.IsInvalidRequest(err) {
+			t.Errorf("StoreWebhookRetryPolicy didn't fail for an invalid policy %+v\n", policy)
+		}
+	}
+
+	policy := common.WebhookRetryPolicy{OrgID: orgID, ObjectType: "type1", Attempts: 5, Backoff: 200}
+	if err := store.StoreWebhookRetryPolicy(policy); err != nil {
+		t.Errorf("Failed to store the webhook retry policy. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveWebhookRetryPolicy(orgID, "type1"); err != nil {
+		t.Errorf("RetrieveWebhookRetryPolicy failed. Error: %s\n", err.Error())
+	} else if stored == nil || *stored != policy {
+		t.Errorf("RetrieveWebhookRetryPolicy returned a wrong policy: %+v\n", stored)
+	}
+	if stored, err := store.RetrieveWebhookRetryPolicy(orgID, "other"); err != nil || stored != nil {
+		t.Errorf("RetrieveWebhookRetryPolicy returned a policy of an object type without a policy: %+v, %v\n", stored, err)
+	}
+	if err := store.DeleteWebhookRetryPolicy(orgID, "type1"); err != nil {
+		t.Errorf("DeleteWebhookRetryPolicy failed. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveWebhookRetryPolicy(orgID, "type1"); err != nil || stored != nil {
+		t.Errorf("RetrieveWebhookRetryPolicy returned a deleted policy: %+v, %v\n", stored, err)
+	}
+
+	failures := []common.WebhookFailure{
+		{OrgID: orgID, ObjectType: "type1", URL: "http://host1:8080/hook", ObjectID: "1", InstanceID: 1, Attempts: 3, Error: "error1"},
+		{OrgID: orgID, ObjectType: "type1", URL: "http://host1:8080/hook", ObjectID: "2", InstanceID: 2, Attempts: 3, Error: "error2"},
+		{OrgID: orgID, ObjectType: "type1", URL: "http://host2/hook", ObjectID: "1", InstanceID: 1, Attempts: 3, Error: "error3"},
+		{OrgID: orgID, ObjectType: "type2", URL: "http://host1:8080/hook", ObjectID: "1", InstanceID: 3, Attempts: 1, Error: "error4"},
+		{OrgID: "otherorg", ObjectType: "type1", URL: "http://host1:8080/hook", ObjectID: "1", InstanceID: 1, Attempts: 3, Error: "error5"},
+	}
+	defer store.DeleteOrganization("otherorg")
+	for _, failure := range failures {
+		if err := store.StoreWebhookFailure(failure); err != nil {
+			t.Errorf("StoreWebhookFailure failed. Error: %s\n", err.Error())
+		}
+	}
+
+	// The second failure of a webhook replaces the first
+	if stored, err := store.RetrieveWebhookFailures(orgID); err != nil {
+		t.Errorf("RetrieveWebhookFailures failed. Error: %s\n", err.Error())
+	} else if len(stored) != 3 {
+		t.Errorf("RetrieveWebhookFailures returned %d failures instead of 3\n", len(stored))
+	} else {
+		for _, failure := range stored {
+			if failure.URL == "http://host1:8080/hook" && failure.ObjectType == "type1" && failure.Error != "error2" {
+				t.Errorf("RetrieveWebhookFailures returned a replaced failure: %+v\n", failure)
+			}
+		}
+	}
+
+	if err := store.DeleteWebhookFailures(orgID, "type1"); err != nil {
+		t.Errorf("DeleteWebhookFailures failed. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveWebhookFailures(orgID); err != nil {
+		t.Errorf("RetrieveWebhookFailures failed. Error: %s\n", err.Error())
+	} else if len(stored) != 1 || stored[0].ObjectType != "type2" {
+		t.Errorf("DeleteWebhookFailures didn't delete the failures of the object type: %+v\n", stored)
+	}
+	if err := store.DeleteWebhookFailures(orgID, ""); err != nil {
+		t.Errorf("DeleteWebhookFailures failed. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveWebhookFailures(orgID); err != nil || len(stored) != 0 {
+		t.Errorf("DeleteWebhookFailures didn't delete the failures of the organization: %+v, %v\n", stored, err)
+	}
+	if stored, err := store.RetrieveWebhookFailures("otherorg"); err != nil || len(stored) != 1 {
+		t.Errorf("DeleteWebhookFailures deleted the failures of another organization: %+v, %v\n", stored, err)
+	}
+}
+
+func testStorageRetentionPolicies(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	savedVersionsKept := common.Configuration.ObjectVersionsKept
+	savedVersionsKeptByType := common.Configuration.ObjectVersionsKeptByType
+	defer func() {
+		common.Configuration.ObjectVersionsKept = savedVersionsKept
+		common.Configuration.ObjectVersionsKeptByType = savedVersionsKeptByType
+	}()
+	common.Configuration.ObjectVersionsKept = 0
+	common.Configuration.ObjectVersionsKeptByType = ""
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "retentionorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	invalidVersions := -1
+	invalidPolicies := []common.RetentionPolicy{
+		{OrgID: orgID},
+		{ObjectType: "type1"},
+		{OrgID: orgID, ObjectType: "type1", MaxAge: -1},
+		{OrgID: orgID, ObjectType: "type1", MaxVersions: &invalidVersions},
+	}
+	for _, policy := range invalidPolicies {
+		if err := store.StoreRetentionPolicy(policy); err == nil || !common.IsInvalidRequest(err) {
+			t.Errorf("StoreRetentionPolicy didn't fail for an invalid policy %+v\n", policy)
+		}
+	}
+
+	maxVersions := 1
+	policies := []common.RetentionPolicy{
+		{OrgID: orgID, ObjectType: "versioned", MaxVersions: &maxVersions},
+		{OrgID: orgID, ObjectType: "aged", MaxAge: 1},
+	}
+	for _, policy := range policies {
+		if err := store.StoreRetentionPolicy(policy); err != nil {
+			t.Errorf("Failed to store the retention policy of %s. Error: %s\n", policy.ObjectType, err.Error())
+		}
+	}
+	if policy, err := store.RetrieveRetentionPolicy(orgID, "versioned"); err != nil {
+		t.Errorf("RetrieveRetentionPolicy failed. Error: %s\n", err.Error())
+	} else if policy == nil || policy.MaxVersions == nil || *policy.MaxVersions != 1 || policy.MaxAge != 0 {
+		t.Errorf("RetrieveRetentionPolicy returned a wrong policy: %+v\n", policy)
+	}
+	if policy, err := store.RetrieveRetentionPolicy(orgID, "other"); err != nil || policy != nil {
+		t.Errorf("RetrieveRetentionPolicy returned a policy of an object type without a policy: %+v, %v\n", policy, err)
+	}
+	if stored, err := store.RetrieveRetentionPolicies(orgID); err != nil {
+		t.Errorf("RetrieveRetentionPolicies failed. Error: %s\n", err.Error())
+	} else if len(stored) != 2 {
+		t.Errorf("RetrieveRetentionPolicies returned %d policies instead of 2\n", len(stored))
+	}
+
+	// Versions of the versioned type are kept although the configuration doesn't keep versions
+	versioned := common.MetaData{ObjectID: "1", ObjectType: "versioned", DestOrgID: orgID, DestID: "dev1", DestType: "device"}
+	for i := 1; i <= 3; i++ {
+		if _, err := store.StoreObject(versioned, []byte(fmt.Sprintf("version%d", i)), common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object (version %d). Error: %s\n", i, err.Error())
+		}
+	}
+	if versions, err := store.RetrieveObjectVersions(orgID, versioned.ObjectType, versioned.ObjectID); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(versions) != 2 {
+		t.Errorf("RetrieveObjectVersions returned %d versions instead of 2\n", len(versions))
+	}
+
+	aged := common.MetaData{ObjectID: "1", ObjectType: "aged", DestOrgID: orgID, DestID: "dev1", DestType: "device"}
+	pinned := common.MetaData{ObjectID: "2", ObjectType: "aged", DestOrgID: orgID, DestID: "dev1", DestType: "device", Pinned: true}
+	for _, metaData := range []common.MetaData{aged, pinned} {
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		}
+	}
+
+	time.Sleep(3 * time.Second)
+	store.PerformMaintenance()
+
+	if versions, err := store.RetrieveObjectVersions(orgID, versioned.ObjectType, versioned.ObjectID); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(versions) != 1 {
+		t.Errorf("RetrieveObjectVersions returned %d versions after the maintenance instead of 1\n", len(versions))
+	}
+	if stored, err := store.RetrieveObject(orgID, versioned.ObjectType, versioned.ObjectID); err != nil || stored == nil {
+		t.Errorf("The maintenance removed an object without a maximal age\n")
+	}
+	if stored, err := store.RetrieveObject(orgID, aged.ObjectType, aged.ObjectID); err != nil || stored != nil {
+		t.Errorf("The maintenance didn't remove an object older than the maximal age of its type\n")
+	}
+	if stored, err := store.RetrieveObject(orgID, pinned.ObjectType, pinned.ObjectID); err != nil || stored == nil {
+		t.Errorf("The maintenance removed a pinned object\n")
+	}
+
+	if err := store.DeleteRetentionPolicy(orgID, "aged"); err != nil {
+		t.Errorf("DeleteRetentionPolicy failed. Error: %s\n", err.Error())
+	}
+	if policy, err := store.RetrieveRetentionPolicy(orgID, "aged"); err != nil || policy != nil {
+		t.Errorf("RetrieveRetentionPolicy returned a deleted policy: %+v, %v\n", policy, err)
+	}
+
+	if err := store.DeleteOrganization(orgID); err != nil {
+		t.Errorf("DeleteOrganization failed. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveRetentionPolicies(orgID); err != nil || len(stored) != 0 {
+		t.Errorf("RetrieveRetentionPolicies returned policies of a deleted organization: %v, %v\n", stored, err)
+	}
+}
+
+func testStorageMaxDeliveriesPerDestination(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	savedMaxDeliveries := common.Configuration.MaxDeliveriesPerDestination
+	defer func() { common.Configuration.MaxDeliveriesPerDestination = savedMaxDeliveries }()
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "deliveriesorg"
+	store.DeleteOrganization(orgID)
+
+	dest := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+	}
+	for _, objectID := range []string{"1", "2", "3"} {
+		metaData := common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: orgID, DestType: "device", NoData: true}
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", objectID, err.Error())
+		}
+	}
+
+	common.Configuration.MaxDeliveriesPerDestination = 2
+	if objects, err := store.RetrieveObjects(orgID, dest.DestType, dest.DestID, common.ResendAll); err != nil {
+		t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+	} else if len(objects) != 2 {
+		t.Errorf("RetrieveObjects returned %d objects instead of 2\n", len(objects))
+	}
+
+	statuses := make(map[string]int)
+	for _, objectID := range []string{"1", "2", "3"} {
+		if dests, err := store.GetObjectDestinationsList(orgID, "type1", objectID); err != nil {
+			t.Errorf("GetObjectDestinationsList failed. Error: %s\n", err.Error())
+		} else if len(dests) != 1 {
+			t.Errorf("GetObjectDestinationsList returned %d destinations instead of 1 (objectID = %s)\n", len(dests), objectID)
+		} else {
+			statuses[dests[0].Status]++
+		}
+	}
+	if statuses[common.Delivering] != 2 || statuses[common.Pending] != 1 {
+		t.Errorf("Wrong destination statuses after limited delivery: %v\n", statuses)
+	}
+
+	common.Configuration.MaxDeliveriesPerDestination = 0
+	if objects, err := store.RetrieveObjects(orgID, dest.DestType, dest.DestID, common.ResendUndelivered); err != nil {
+		t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+	} else if len(objects) != 3 {
+		t.Errorf("RetrieveObjects returned %d objects instead of 3\n", len(objects))
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageSourceDataURI(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "sourceuriorg"
+	store.DeleteOrganization(orgID)
+
+	file, err := ioutil.TempFile("", "sourceData")
+	if err != nil {
+		t.Errorf("Failed to create the source data file. Error: %s\n", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+	data := []byte("source data")
+	file.Write(data)
+	file.Close()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, SourceDataURI: "file://" + file.Name()}
+	if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+
+	dataReader, err := store.RetrieveObjectData(orgID, "type1", "1", "")
+	if err != nil || dataReader == nil {
+		t.Errorf("Failed to retrieve object's data. Error: %v\n", err)
+	} else {
+		if storedData, err := ioutil.ReadAll(dataReader); err != nil {
+			t.Errorf("Failed to read object's data. Error: %s\n", err.Error())
+		} else if string(storedData) != string(data) {
+			t.Errorf("Incorrect object's data: %s instead of %s\n", storedData, data)
+		}
+		store.CloseDataReader(dataReader)
+	}
+
+	chunk, eof, length, err := store.ReadObjectData(orgID, "type1", "1", 6, 7, "")
+	if err != nil {
+		t.Errorf("Failed to read object's data. Error: %s\n", err.Error())
+	} else if !eof || length != 4 || string(chunk[:length]) != "data" {
+		t.Errorf("Incorrect data chunk: %s (length = %d, eof = %t)\n", chunk, length, eof)
+	}
+
+	if err := store.UpdateObjectSourceDataURI(orgID, "type1", "1", ""); err != nil {
+		t.Errorf("Failed to update object's source data URI. Error: %s\n", err.Error())
+	}
+	if meta, err := store.RetrieveObject(orgID, "type1", "1"); err != nil || meta == nil {
+		t.Errorf("Failed to retrieve object. Error: %v\n", err)
+	} else if meta.SourceDataURI != "" {
+		t.Errorf("Source data URI wasn't cleared: %s\n", meta.SourceDataURI)
+	}
+	if dataReader, err := store.RetrieveObjectData(orgID, "type1", "1", ""); err != nil {
+		t.Errorf("Failed to retrieve object's data. Error: %s\n", err.Error())
+	} else if dataReader != nil {
+		t.Errorf("Retrieved data of an object without data\n")
+		store.CloseDataReader(dataReader)
+	}
+
+	if err := store.UpdateObjectSourceDataURI(orgID, "type1", "2", ""); err == nil || !IsNotFound(err) {
+		t.Errorf("UpdateObjectSourceDataURI of a non-existing object didn't return NotFound. Error: %v\n", err)
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageIdempotencyKeys(storageType string, t *testing.T) {
+	savedWindow := common.Configuration.IdempotencyKeyWindow
+	defer func() { common.Configuration.IdempotencyKeyWindow = savedWindow }()
+	common.Configuration.IdempotencyKeyWindow = 300
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "idempotencyorg"
+	if recorded, err := store.IsIdempotencyKeyRecorded(orgID, "type1", "1", "key1"); err != nil || recorded {
+		t.Errorf("Idempotency key was recorded before it was stored. Error: %v\n", err)
+	}
+	if err := store.RecordIdempotencyKey(orgID, "type1", "1", "key1"); err != nil {
+		t.Errorf("Failed to record idempotency key. Error: %s\n", err.Error())
+	}
+	if recorded, err := store.IsIdempotencyKeyRecorded(orgID, "type1", "1", "key1"); err != nil || !recorded {
+		t.Errorf("Idempotency key wasn't recorded. Error: %v\n", err)
+	}
+	if recorded, err := store.IsIdempotencyKeyRecorded(orgID, "type1", "2", "key1"); err != nil || recorded {
+		t.Errorf("Idempotency key was recorded for another object. Error: %v\n", err)
+	}
+	if recorded, err := store.IsIdempotencyKeyRecorded(orgID, "type1", "1", "key2"); err != nil || recorded {
+		t.Errorf("Another idempotency key was recorded. Error: %v\n", err)
+	}
+
+	common.Configuration.IdempotencyKeyWindow = 0
+	if recorded, err := store.IsIdempotencyKeyRecorded(orgID, "type1", "1", "key1"); err != nil || recorded {
+		t.Errorf("Idempotency key was recorded although idempotency keys are disabled. Error: %v\n", err)
+	}
+}
+
+func testStorageObjectStatusCounts(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "statuscountsorg"
+	store.DeleteOrganization(orgID)
+
+	objects := []struct {
+		objectType string
+		objectID   string
+		status     string
+	}{
+		{"type1", "1", common.ReadyToSend},
+		{"type1", "2", common.ReadyToSend},
+		{"type1", "3", common.NotReadyToSend},
+		{"type2", "1", common.ReadyToSend},
+	}
+	for _, o := range objects {
+		metaData := common.MetaData{ObjectID: o.objectID, ObjectType: o.objectType, DestOrgID: orgID, NoData: true}
+		if _, err := store.StoreObject(metaData, nil, o.status, ""); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", o.objectID, err.Error())
+		}
+	}
+
+	if counts, err := store.RetrieveObjectStatusCounts(orgID, "type1"); err != nil {
+		t.Errorf("RetrieveObjectStatusCounts failed. Error: %s\n", err.Error())
+	} else if len(counts) != 2 || counts[common.ReadyToSend] != 2 || counts[common.NotReadyToSend] != 1 {
+		t.Errorf("RetrieveObjectStatusCounts returned incorrect counts for type1: %v\n", counts)
+	}
+	if counts, err := store.RetrieveObjectStatusCounts(orgID, ""); err != nil {
+		t.Errorf("RetrieveObjectStatusCounts failed. Error: %s\n", err.Error())
+	} else if len(counts) != 2 || counts[common.ReadyToSend] != 3 || counts[common.NotReadyToSend] != 1 {
+		t.Errorf("RetrieveObjectStatusCounts returned incorrect counts for all types: %v\n", counts)
+	}
+	if counts, err := store.RetrieveObjectStatusCounts(orgID, "type3"); err != nil {
+		t.Errorf("RetrieveObjectStatusCounts failed. Error: %s\n", err.Error())
+	} else if len(counts) != 0 {
+		t.Errorf("RetrieveObjectStatusCounts returned counts for a type without objects: %v\n", counts)
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageStorageStatsByType(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "storagestatsorg"
+	store.DeleteOrganization(orgID)
+
+	objects := []struct {
+		objectType string
+		objectID   string
+		data       []byte
+	}{
+		{"type1", "1", []byte("abcde")},
+		{"type1", "2", []byte("abc")},
+		{"type2", "1", nil},
+	}
+	for _, o := range objects {
+		metaData := common.MetaData{ObjectID: o.objectID, ObjectType: o.objectType, DestOrgID: orgID,
+			ObjectSize: int64(len(o.data)), NoData: o.data == nil}
+		if _, err := store.StoreObject(metaData, o.data, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", o.objectID, err.Error())
+		}
+	}
+
+	expected := map[string]common.ObjectTypeStorageStats{
+		"type1": common.ObjectTypeStorageStats{ObjectType: "type1", ObjectCount: 2, ObjectSize: 8, StoredDataSize: 8},
+		"type2": common.ObjectTypeStorageStats{ObjectType: "type2", ObjectCount: 1},
+	}
+	if stats, err := store.RetrieveStorageStatsByType(orgID); err != nil {
+		t.Errorf("RetrieveStorageStatsByType failed. Error: %s\n", err.Error())
+	} else if len(stats) != len(expected) {
+		t.Errorf("RetrieveStorageStatsByType returned stats of %d types instead of %d: %v\n", len(stats), len(expected), stats)
+	} else {
+		for objectType, typeStats := range expected {
+			if stats[objectType] != typeStats {
+				t.Errorf("RetrieveStorageStatsByType returned incorrect stats for %s: %+v instead of %+v\n", objectType,
+					stats[objectType], typeStats)
+			}
+		}
+	}
+
+	store.DeleteOrganization(orgID)
+	if stats, err := store.RetrieveStorageStatsByType(orgID); err != nil {
+		t.Errorf("RetrieveStorageStatsByType failed. Error: %s\n", err.Error())
+	} else if len(stats) != 0 {
+		t.Errorf("RetrieveStorageStatsByType returned stats for an organization without objects: %v\n", stats)
+	}
+}
+
+func testStorageObjectIDSeparator(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "separatororg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	// Objects whose type and ID contain the separator don't collide
+	objects := []struct {
+		objectType string
+		objectID   string
+		data       []byte
+	}{
+		{"a:b", "c", []byte("first")},
+		{"a", "b:c", []byte("second")},
+		{"a", "b%3Ac", []byte("third")},
+		{"a-b", "c", []byte("fourth")},
+		{"a", "b-c", []byte("fifth")},
+		{"a_2Db", "c", []byte("sixth")},
+	}
+	for _, o := range objects {
+		metaData := common.MetaData{ObjectID: o.objectID, ObjectType: o.objectType, DestOrgID: orgID}
+		if _, err := store.StoreObject(metaData, o.data, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s:%s. Error: %s\n", o.objectType, o.objectID, err.Error())
+		}
+	}
+	for _, o := range objects {
+		storedMetaData, err := store.RetrieveObject(orgID, o.objectType, o.objectID)
+		if err != nil || storedMetaData == nil {
+			t.Errorf("Failed to retrieve object %s:%s. Error: %v\n", o.objectType, o.objectID, err)
+			continue
+		}
+		if storedMetaData.ObjectType != o.objectType || storedMetaData.ObjectID != o.objectID {
+			t.Errorf("Retrieved object %s:%s instead of %s:%s\n", storedMetaData.ObjectType, storedMetaData.ObjectID,
+				o.objectType, o.objectID)
+		}
+		dataReader, err := store.RetrieveObjectData(orgID, o.objectType, o.objectID, "")
+		if err != nil || dataReader == nil {
+			t.Errorf("Failed to retrieve the data of object %s:%s. Error: %v\n", o.objectType, o.objectID, err)
+			continue
+		}
+		data := make([]byte, 100)
+		n, _ := dataReader.Read(data)
+		store.CloseDataReader(dataReader)
+		if string(data[:n]) != string(o.data) {
+			t.Errorf("Retrieved data %s of object %s:%s instead of %s\n", data[:n], o.objectType, o.objectID, o.data)
+		}
+	}
+
+	// Webhooks and ACLs of object types that contain the separator don't collide
+	if err := store.AddWebhook(orgID, "a:b", "http://hook1"); err != nil {
+		t.Errorf("Failed to add webhook. Error: %s\n", err.Error())
+	}
+	if err := store.AddWebhook(orgID, "a", "http://hook2"); err != nil {
+		t.Errorf("Failed to add webhook. Error: %s\n", err.Error())
+	}
+	if hooks, err := store.RetrieveWebhooks(orgID, "a:b"); err != nil || len(hooks) != 1 || hooks[0] != "http://hook1" {
+		t.Errorf("Wrong webhooks of object type a:b: %v. Error: %v\n", hooks, err)
+	}
+	users := []common.ACLentry{{Username: "user1", ACLUserType: "user", ACLRole: "writer"}}
+	if err := store.AddUsersToACL(common.ObjectsACLType, orgID, "a:b", users); err != nil {
+		t.Errorf("Failed to add users to ACL. Error: %s\n", err.Error())
+	}
+	if keys, err := store.RetrieveACLsInOrg(common.ObjectsACLType, orgID); err != nil || len(keys) != 1 || keys[0] != "a:b" {
+		t.Errorf("Wrong ACLs in the organization: %v. Error: %v\n", keys, err)
+	}
+
+	// Destinations whose type or ID contain ':' are rejected
+	dest := common.Destination{DestOrgID: orgID, DestType: "dev:ice", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err == nil || !common.IsValidationError(err) {
+		store.DeleteDestination(orgID, "dev:ice", "dev1")
+		t.Errorf("StoreDestination didn't reject a destination type that contains ':'. Error: %v\n", err)
+	}
+
+	// Destinations are stored with their organization, type, and ID trimmed, and white space only IDs are rejected
+	dest = common.Destination{DestOrgID: orgID, DestType: "device", DestID: "  ", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err == nil || !common.IsValidationError(err) {
+		t.Errorf("StoreDestination didn't reject a white space destination ID. Error: %v\n", err)
+	}
+	dest = common.Destination{DestOrgID: orgID, DestType: " device", DestID: "dev9\t", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err != nil {
+		t.Errorf("Failed to store destination. Error: %s\n", err.Error())
+	} else if exists, err := store.DestinationExists(orgID, "device", "dev9"); err != nil || !exists {
+		t.Errorf("The stored destination wasn't normalized. Error: %v\n", err)
+	}
+
+	// Destinations are looked up with their organization, type, and ID trimmed
+	if exists, err := store.DestinationExists(orgID+" ", "device ", " dev9"); err != nil || !exists {
+		t.Errorf("DestinationExists didn't normalize the looked up destination. Error: %v\n", err)
+	}
+	lookup := common.DestinationID{DestType: " device", DestID: "dev9 "}
+	if exist, err := store.DestinationsExist(orgID, []common.DestinationID{lookup}); err != nil || !exist[lookup] {
+		t.Errorf("DestinationsExist didn't normalize the looked up destination. Error: %v\n", err)
+	}
+	if _, err := store.RetrieveDestination(orgID, " device", "dev9"); err != nil {
+		t.Errorf("RetrieveDestination didn't normalize the looked up destination. Error: %s\n", err.Error())
+	}
+	store.DeleteDestination(orgID, "device ", "dev9")
+	if exists, _ := store.DestinationExists(orgID, "device", "dev9"); exists {
+		t.Errorf("DeleteDestination didn't normalize the deleted destination\n")
+	}
+}
+
+func testStorageBroadcastObjects(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "broadcastorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	for _, destID := range []string{"dev1", "dev2"} {
+		dest := common.Destination{DestOrgID: orgID, DestType: "device", DestID: destID, Communication: common.MQTTProtocol}
+		if err := store.StoreDestination(dest); err != nil {
+			t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+		}
+	}
+
+	objects := []common.MetaData{
+		{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestType: "device", Broadcast: true},
+		{ObjectID: "2", ObjectType: "type1", DestOrgID: orgID, DestType: "device"},
+		{ObjectID: "3", ObjectType: "type1", DestOrgID: orgID, DestType: "device", DestID: "dev1"},
+		{ObjectID: "4", ObjectType: "type1", DestOrgID: orgID, DestType: "gateway", Broadcast: true},
+	}
+	for _, metaData := range objects {
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s. Error: %s\n", metaData.ObjectID, err.Error())
+		}
+	}
+
+	broadcasts, err := store.RetrieveObjectsForDestType(orgID, "device")
+	if err != nil {
+		t.Errorf("RetrieveObjectsForDestType failed. Error: %s\n", err.Error())
+	} else if len(broadcasts) != 1 || broadcasts[0].ObjectID != "1" || !broadcasts[0].Broadcast {
+		t.Errorf("RetrieveObjectsForDestType returned %d objects instead of object 1\n", len(broadcasts))
+	}
+
+	// Broadcast objects are sent to every destination of the type
+	for _, destID := range []string{"dev1", "dev2"} {
+		retrieved, err := store.RetrieveObjects(orgID, "device", destID, common.ResendAll)
+		if err != nil {
+			t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+			continue
+		}
+		found := false
+		for _, metaData := range retrieved {
+			if metaData.ObjectID == "1" {
+				found = true
+			} else if metaData.ObjectID == "4" {
+				t.Errorf("RetrieveObjects returned an object broadcast to another destination type\n")
+			}
+		}
+		if !found {
+			t.Errorf("RetrieveObjects didn't return the broadcast object for destination %s\n", destID)
+		}
+	}
+
+	// The notifications for all the destinations of the type are stored together
+	notifications := make([]common.Notification, 0)
+	for i := 0; i < 50; i++ {
+		notifications = append(notifications, common.Notification{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID,
+			DestType: "device", DestID: fmt.Sprintf("dev%d", i), Status: common.Update, InstanceID: 1})
+	}
+	if err := store.UpdateNotificationRecords(notifications); err != nil {
+		t.Errorf("UpdateNotificationRecords failed. Error: %s\n", err.Error())
+	}
+	for _, n := range notifications {
+		stored, err := store.RetrieveNotificationRecord(orgID, n.ObjectType, n.ObjectID, n.DestType, n.DestID)
+		if err != nil || stored == nil {
+			t.Errorf("Failed to retrieve the notification for destination %s. Error: %v\n", n.DestID, err)
+		} else if stored.Status != common.Update || stored.InstanceID != 1 {
+			t.Errorf("Retrieved notification with status %s and instance %d for destination %s\n",
+				stored.Status, stored.InstanceID, n.DestID)
+		}
+	}
+	if err := store.UpdateNotificationRecords(nil); err != nil {
+		t.Errorf("UpdateNotificationRecords failed for no records. Error: %s\n", err.Error())
+	}
+	store.DeleteNotificationRecords(orgID, "type1", "1", "", "")
+}
+
+func testStoragePinnedObjects(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "pinnedorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	dest := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err != nil {
+		t.Errorf("Failed to store destination. Error: %s\n", err.Error())
+	}
+
+	expired := common.MetaData{ObjectID: "expired", ObjectType: "type1", DestOrgID: orgID, DestType: "device",
+		Expiration: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)}
+	autoDeleted := common.MetaData{ObjectID: "autodelete", ObjectType: "type1", DestOrgID: orgID, DestType: "device",
+		DestID: "dev1", AutoDelete: true, Pinned: true}
+	for _, metaData := range []common.MetaData{expired, autoDeleted} {
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s. Error: %s\n", metaData.ObjectID, err.Error())
+		}
+	}
+	if err := store.PinObject(orgID, "type1", "expired"); err != nil {
+		t.Errorf("Failed to pin object. Error: %s\n", err.Error())
+	}
+	if err := store.PinObject(orgID, "type1", "missing"); err == nil {
+		t.Errorf("PinObject didn't fail for a missing object\n")
+	}
+
+	// A pinned object isn't set to expire when it is consumed by all its destinations
+	if _, err := store.UpdateObjectDeliveryStatus(common.Consumed, "", orgID, "type1", "autodelete", "device", "dev1"); err != nil {
+		t.Errorf("Failed to update the delivery status. Error: %s\n", err.Error())
+	}
+	if metaData, err := store.RetrieveObject(orgID, "type1", "autodelete"); err != nil || metaData == nil {
+		t.Errorf("Failed to retrieve object. Error: %v\n", err)
+	} else if metaData.Expiration != "" || !metaData.Pinned {
+		t.Errorf("The consumed pinned object was set to expire at %s\n", metaData.Expiration)
+	}
+
+	// A pinned object isn't removed by the maintenance when it expires
+	store.PerformMaintenance()
+	if metaData, err := store.RetrieveObject(orgID, "type1", "expired"); err != nil || metaData == nil {
+		t.Errorf("The expired pinned object was removed. Error: %v\n", err)
+	} else if !metaData.Pinned {
+		t.Errorf("The object isn't pinned\n")
+	}
+
+	if err := store.UnpinObject(orgID, "type1", "expired"); err != nil {
+		t.Errorf("Failed to unpin object. Error: %s\n", err.Error())
+	}
+	store.PerformMaintenance()
+	if metaData, err := store.RetrieveObject(orgID, "type1", "expired"); err != nil {
+		t.Errorf("Failed to retrieve object. Error: %s\n", err.Error())
+	} else if metaData != nil {
+		t.Errorf("The expired object wasn't removed after it was unpinned\n")
+	}
+}
+
+func testStorageStoreDestinations(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "bulkdestsorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	dests := make([]common.Destination, 0)
+	for i := 0; i < 100; i++ {
+		dests = append(dests, common.Destination{DestOrgID: orgID, DestType: "device", DestID: fmt.Sprintf("dev%d", i),
+			Communication: common.MQTTProtocol})
+	}
+	dests = append(dests, common.Destination{DestOrgID: orgID, DestType: "dev:ice", DestID: "dev1", Communication: common.MQTTProtocol})
+
+	errs, err := store.StoreDestinations(dests)
+	if err != nil {
+		t.Errorf("StoreDestinations failed. Error: %s\n", err.Error())
+		return
+	}
+	if len(errs) != len(dests) {
+		t.Errorf("StoreDestinations returned %d errors instead of %d\n", len(errs), len(dests))
+		return
+	}
+	for i, dest := range dests {
+		invalid := i == len(dests)-1
+		if invalid {
+			if errs[i] == nil || !common.IsValidationError(errs[i]) {
+				t.Errorf("StoreDestinations didn't reject the invalid destination. Error: %v\n", errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("Failed to store destination %s. Error: %s\n", dest.DestID, errs[i].Error())
+			continue
+		}
+		stored, err := store.RetrieveDestination(orgID, dest.DestType, dest.DestID)
+		if err != nil || stored == nil {
+			t.Errorf("Failed to retrieve destination %s. Error: %v\n", dest.DestID, err)
+		}
+	}
+
+	// Existing destinations are updated
+	update := []common.Destination{{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.HTTPProtocol}}
+	if errs, err := store.StoreDestinations(update); err != nil || errs[0] != nil {
+		t.Errorf("StoreDestinations failed to update a destination. Error: %v %v\n", err, errs)
+	} else if stored, err := store.RetrieveDestination(orgID, "device", "dev1"); err != nil || stored == nil {
+		t.Errorf("Failed to retrieve destination. Error: %v\n", err)
+	} else if stored.Communication != common.HTTPProtocol {
+		t.Errorf("The destination wasn't updated, its protocol is %s\n", stored.Communication)
+	}
+
+	if errs, err := store.StoreDestinations(nil); err != nil || len(errs) != 0 {
+		t.Errorf("StoreDestinations failed for no destinations. Error: %v\n", err)
+	}
+}
+
+func testStorageObjectsWithMissingData(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "missingdataorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	tests := []struct {
+		metaData common.MetaData
+		data     []byte
+		status   string
+		missing  bool
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID}, []byte("data"), common.ReadyToSend, false},
+		{common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: orgID}, []byte("data"), common.ReadyToSend, true},
+		{common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: orgID, NoData: true}, nil, common.ReadyToSend, false},
+		{common.MetaData{ObjectID: "4", ObjectType: "type1", DestOrgID: orgID}, nil, common.NotReadyToSend, false},
+		{common.MetaData{ObjectID: "5", ObjectType: "type1", DestOrgID: orgID}, nil, common.ReadyToSend, true},
+	}
+	for _, test := range tests {
+		if _, err := store.StoreObject(test.metaData, test.data, test.status, ""); err != nil {
+			t.Errorf("Failed to store object %s. Error: %s\n", test.metaData.ObjectID, err.Error())
+		}
+	}
+	// The data of the second object is deleted independently of the object
+	if err := store.DeleteStoredData(orgID, "type1", "2"); err != nil {
+		t.Errorf("Failed to delete the data of object 2. Error: %s\n", err.Error())
+	}
+
+	missing, err := store.RetrieveObjectsWithMissingData(orgID)
+	if err != nil {
+		t.Errorf("RetrieveObjectsWithMissingData failed. Error: %s\n", err.Error())
+		return
+	}
+	for _, test := range tests {
+		found := false
+		for _, metaData := range missing {
+			if metaData.ObjectID == test.metaData.ObjectID {
+				found = true
+			}
+		}
+		if found != test.missing {
+			t.Errorf("RetrieveObjectsWithMissingData returned %t for object %s instead of %t\n", found,
+				test.metaData.ObjectID, test.missing)
+		}
+	}
+}
+
+func testStorageDeliveryAttempts(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "attemptsorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	dest := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err != nil {
+		t.Errorf("Failed to store destination. Error: %s\n", err.Error())
+	}
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, DestType: "device", DestID: "dev1"}
+	if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+
+	checkAttempts := func(expected int) {
+		dests, err := store.GetObjectDestinationsList(orgID, "type1", "1")
+		if err != nil || len(dests) != 1 {
+			t.Errorf("Failed to retrieve the destinations of the object. Error: %v\n", err)
+			return
+		}
+		if dests[0].AttemptCount != expected {
+			t.Errorf("The destination has %d delivery attempts instead of %d\n", dests[0].AttemptCount, expected)
+		}
+		if expected > 0 && dests[0].LastAttempt == "" {
+			t.Errorf("The time of the last delivery attempt wasn't set\n")
+		}
+	}
+
+	checkAttempts(0)
+	if err := store.UpdateObjectDelivering(orgID, "type1", "1"); err != nil {
+		t.Errorf("UpdateObjectDelivering failed. Error: %s\n", err.Error())
+	}
+	checkAttempts(1)
+
+	// Only setting the status to delivering counts as an attempt
+	if _, err := store.UpdateObjectDeliveryStatus(common.Error, "failed", orgID, "type1", "1", "device", "dev1"); err != nil {
+		t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s\n", err.Error())
+	}
+	checkAttempts(1)
+	if _, err := store.UpdateObjectDeliveryStatus(common.Delivering, "", orgID, "type1", "1", "device", "dev1"); err != nil {
+		t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s\n", err.Error())
+	}
+	checkAttempts(2)
+}
+
+func testStorageObjectsBySizeAndAge(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "sizeageorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	for i, size := range []int64{10, 5000, 1000} {
+		metaData := common.MetaData{ObjectID: strconv.Itoa(i), ObjectType: "type1", DestOrgID: orgID, ObjectSize: size}
+		if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %d. Error: %s\n", i, err.Error())
+		}
+	}
+	time.Sleep(2 * time.Second)
+
+	objects, err := store.RetrieveObjectsBySizeAndAge(orgID, 1000, time.Second)
+	if err != nil {
+		t.Errorf("RetrieveObjectsBySizeAndAge failed. Error: %s\n", err.Error())
+	} else if len(objects) != 2 {
+		t.Errorf("RetrieveObjectsBySizeAndAge returned %d objects instead of 2\n", len(objects))
+	} else if objects[0].ObjectID != "1" || objects[1].ObjectID != "2" {
+		t.Errorf("RetrieveObjectsBySizeAndAge returned objects %s and %s instead of 1 and 2\n", objects[0].ObjectID, objects[1].ObjectID)
+	}
+
+	// The objects were updated recently
+	if objects, err := store.RetrieveObjectsBySizeAndAge(orgID, 0, time.Hour); err != nil {
+		t.Errorf("RetrieveObjectsBySizeAndAge failed. Error: %s\n", err.Error())
+	} else if len(objects) != 0 {
+		t.Errorf("RetrieveObjectsBySizeAndAge returned %d objects updated within the last hour\n", len(objects))
+	}
+
+	if _, err := store.RetrieveObjectsBySizeAndAge(orgID, -1, 0); err == nil {
+		t.Errorf("RetrieveObjectsBySizeAndAge didn't fail for a negative size\n")
+	}
+}
+
+func testStorageAPITokens(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "tokensorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	tokens := []common.APIToken{
+		{Hash: "tokenhash1", OrgID: orgID, Identity: "user1", Role: "admin"},
+		{Hash: "tokenhash2", OrgID: orgID, Identity: "user2", Role: "user", Expiration: "2030-01-01T00:00:00Z"},
+	}
+	for _, token := range tokens {
+		if err := store.StoreAPIToken(token); err != nil {
+			t.Errorf("Failed to store API token %s. Error: %s\n", token.Hash, err.Error())
+		}
+	}
+
+	if err := store.StoreAPIToken(common.APIToken{Hash: "tokenhash3", OrgID: orgID, Role: "user"}); err == nil {
+		t.Errorf("Stored an API token without an identity\n")
+	}
+	if err := store.StoreAPIToken(common.APIToken{Hash: "tokenhash3", OrgID: orgID, Identity: "user3", Role: "user", Expiration: "tomorrow"}); err == nil {
+		t.Errorf("Stored an API token with an invalid expiration\n")
+	}
+
+	if token, err := store.RetrieveAPIToken("tokenhash2"); err != nil {
+		t.Errorf("Failed to retrieve API token. Error: %s\n", err.Error())
+	} else if token == nil {
+		t.Errorf("API token tokenhash2 was not found\n")
+	} else if token.OrgID != orgID || token.Identity != "user2" || token.Role != "user" || token.Expiration != "2030-01-01T00:00:00Z" {
+		t.Errorf("Retrieved API token %+v doesn't match the stored token\n", *token)
+	}
+
+	if list, err := store.RetrieveAPITokens(orgID); err != nil {
+		t.Errorf("Failed to retrieve API tokens. Error: %s\n", err.Error())
+	} else if len(list) != 2 {
+		t.Errorf("Retrieved %d API tokens instead of 2\n", len(list))
+	}
+
+	if err := store.RevokeAPIToken("tokenhash1"); err != nil {
+		t.Errorf("Failed to revoke API token. Error: %s\n", err.Error())
+	}
+	if token, err := store.RetrieveAPIToken("tokenhash1"); err != nil {
+		t.Errorf("Failed to retrieve API token. Error: %s\n", err.Error())
+	} else if token != nil {
+		t.Errorf("Revoked API token tokenhash1 was retrieved\n")
+	}
+
+	if err := store.DeleteOrganization(orgID); err != nil {
+		t.Errorf("Failed to delete organization. Error: %s\n", err.Error())
+	}
+	if list, err := store.RetrieveAPITokens(orgID); err != nil {
+		t.Errorf("Failed to retrieve API tokens. Error: %s\n", err.Error())
+	} else if len(list) != 0 {
+		t.Errorf("Retrieved %d API tokens of a deleted organization\n", len(list))
+	}
+}
+
+func testStorageDestinationObjectTypesACL(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "desttypesaclorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	for _, destType := range []string{"camera", "gateway"} {
+		dest := common.Destination{DestOrgID: orgID, DestType: destType, DestID: "dev1", Communication: common.MQTTProtocol}
+		if err := store.StoreDestination(dest); err != nil {
+			t.Errorf("Failed to store destination of type %s. Error: %s\n", destType, err.Error())
+		}
+	}
+	for i, objectType := range []string{"firmware", "model", "config"} {
+		metaData := common.MetaData{ObjectID: strconv.Itoa(i), ObjectType: objectType, DestOrgID: orgID}
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object of type %s. Error: %s\n", objectType, err.Error())
+		}
+	}
+
+	entries := []common.ACLentry{{Username: "firmware", ACLUserType: "objectType", ACLRole: "na"},
+		{Username: "config", ACLUserType: "objectType", ACLRole: "na"}}
+	if err := store.AddUsersToACL(common.DestinationObjectTypesACLType, orgID, "camera", entries); err != nil {
+		t.Errorf("Failed to add object types to the ACL. Error: %s\n", err.Error())
+	}
+
+	// Cameras only receive the permitted object types, gateways don't have an ACL and receive all the object types
+	tests := []struct {
+		destType string
+		count    int
+	}{{"camera", 2}, {"gateway", 3}}
+	for _, test := range tests {
+		objects, err := store.RetrieveObjects(orgID, test.destType, "dev1", common.ResendAll)
+		if err != nil {
+			t.Errorf("RetrieveObjects failed. Error: %s\n", err.Error())
+			continue
+		}
+		if len(objects) != test.count {
+			t.Errorf("RetrieveObjects returned %d objects for destination type %s instead of %d\n", len(objects), test.destType, test.count)
+		}
+		for _, metaData := range objects {
+			if test.destType == "camera" && metaData.ObjectType == "model" {
+				t.Errorf("RetrieveObjects returned an object of a type that isn't permitted for destination type camera\n")
+			}
+		}
+	}
+
+	// The destinations notified of an update are filtered in the same way
+	dests := []common.Destination{{DestOrgID: orgID, DestType: "camera", DestID: "dev1"},
+		{DestOrgID: orgID, DestType: "gateway", DestID: "dev1"}}
+	if filtered, err := FilterDestinationsForObjectType(store, orgID, "model", dests); err != nil {
+		t.Errorf("FilterDestinationsForObjectType failed. Error: %s\n", err.Error())
+	} else if len(filtered) != 1 || filtered[0].DestType != "gateway" {
+		t.Errorf("FilterDestinationsForObjectType returned %v for object type model\n", filtered)
+	}
+	if filtered, err := FilterDestinationsForObjectType(store, orgID, "firmware", dests); err != nil {
+		t.Errorf("FilterDestinationsForObjectType failed. Error: %s\n", err.Error())
+	} else if len(filtered) != 2 {
+		t.Errorf("FilterDestinationsForObjectType returned %d destinations for object type firmware instead of 2\n", len(filtered))
+	}
+}
+
+func testStorageObjectsAcrossOrgs(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgIDs := []string{"acrossorgs1", "acrossorgs2"}
+	for _, orgID := range orgIDs {
+		store.DeleteOrganization(orgID)
+		defer store.DeleteOrganization(orgID)
+	}
+
+	// The destinations of the destinations list must be registered
+	for _, dest := range []common.Destination{
+		{DestOrgID: orgIDs[0], DestType: "gateway", DestID: "dev2", Communication: common.MQTTProtocol},
+		{DestOrgID: orgIDs[0], DestType: "camera", DestID: "dev3", Communication: common.MQTTProtocol},
+	} {
+		if err := store.StoreDestination(dest); err != nil {
+			t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+		}
+	}
+
+	objects := []common.MetaData{
+		{ObjectID: "1", ObjectType: "acrossorgs", DestOrgID: orgIDs[0], DestType: "camera", DestID: "dev1"},
+		{ObjectID: "2", ObjectType: "acrossorgs", DestOrgID: orgIDs[0], DestinationsList: []string{"gateway:dev2", "camera:dev3"}},
+		{ObjectID: "1", ObjectType: "acrossorgs", DestOrgID: orgIDs[1], DestType: "gateway", DestID: "dev1"},
+		{ObjectID: "3", ObjectType: "acrossorgsother", DestOrgID: orgIDs[1]},
+	}
+	for _, metaData := range objects {
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s of org %s. Error: %s\n", metaData.ObjectID, metaData.DestOrgID, err.Error())
+		}
+	}
+
+	tests := []struct {
+		filter common.ObjectFilter
+		keys   []string
+	}{
+		{common.ObjectFilter{ObjectType: "acrossorgs"}, []string{"acrossorgs1:1", "acrossorgs1:2", "acrossorgs2:1"}},
+		{common.ObjectFilter{ObjectType: "acrossorgs", ObjectID: "1"}, []string{"acrossorgs1:1", "acrossorgs2:1"}},
+		{common.ObjectFilter{OrgID: orgIDs[1]}, []string{"acrossorgs2:1", "acrossorgs2:3"}},
+		{common.ObjectFilter{ObjectType: "acrossorgs", DestinationType: "camera"}, []string{"acrossorgs1:1", "acrossorgs1:2"}},
+		{common.ObjectFilter{ObjectType: "acrossorgs", DestinationType: "gateway", DestinationID: "dev2"}, []string{"acrossorgs1:2"}},
+		{common.ObjectFilter{ObjectType: "acrossorgs", ObjectID: "4"}, []string{}},
+	}
+	for _, test := range tests {
+		result, total, err := store.RetrieveObjectsAcrossOrgs(test.filter, 0, 0)
+		if err != nil {
+			t.Errorf("RetrieveObjectsAcrossOrgs failed. Error: %s\n", err.Error())
+			continue
+		}
+		keys := make([]string, 0)
+		for _, metaData := range result {
+			keys = append(keys, metaData.DestOrgID+":"+metaData.ObjectID)
+		}
+		if strings.Join(keys, ",") != strings.Join(test.keys, ",") || total != len(test.keys) {
+			t.Errorf("RetrieveObjectsAcrossOrgs returned %v (total %d) for filter %+v instead of %v\n", keys, total, test.filter, test.keys)
+		}
+	}
+
+	filter := common.ObjectFilter{ObjectType: "acrossorgs"}
+	if page, total, err := store.RetrieveObjectsAcrossOrgs(filter, 1, 1); err != nil {
+		t.Errorf("RetrieveObjectsAcrossOrgs failed. Error: %s\n", err.Error())
+	} else if len(page) != 1 || total != 3 || page[0].DestOrgID != orgIDs[0] || page[0].ObjectID != "2" {
+		t.Errorf("RetrieveObjectsAcrossOrgs returned an incorrect page: %v (total %d)\n", page, total)
+	}
+	if page, _, err := store.RetrieveObjectsAcrossOrgs(filter, 3, 1); err != nil {
+		t.Errorf("RetrieveObjectsAcrossOrgs failed. Error: %s\n", err.Error())
+	} else if len(page) != 0 {
+		t.Errorf("RetrieveObjectsAcrossOrgs returned %d objects beyond the last object\n", len(page))
+	}
+	if _, _, err := store.RetrieveObjectsAcrossOrgs(filter, -1, 1); err == nil || !common.IsInvalidRequest(err) {
+		t.Errorf("RetrieveObjectsAcrossOrgs didn't fail with a negative offset\n")
+	}
+}
+
+func testStoragePurgeCompletedNotifications(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "purgeorg"
+	store.DeleteOrganization(orgID)
+
+	statuses := []string{common.Update, common.Consumed, common.AckConsumed, common.Deleted, common.Getdata}
+	for i, status := range statuses {
+		notification := common.Notification{ObjectID: strconv.Itoa(i), ObjectType: "type1", DestOrgID: orgID, DestID: "1", DestType: "device",
+			Status: status, InstanceID: 1}
+		if err := store.UpdateNotificationRecord(notification); err != nil {
+			t.Errorf("Failed to store notification. Error: %s\n", err.Error())
+		}
+	}
+
+	// The notifications were just updated
+	if purged, err := store.PurgeCompletedNotifications(orgID, time.Hour); err != nil {
+		t.Errorf("PurgeCompletedNotifications failed. Error: %s\n", err.Error())
+	} else if purged != 0 {
+		t.Errorf("PurgeCompletedNotifications purged %d recently updated notifications\n", purged)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if purged, err := store.PurgeCompletedNotifications(orgID, time.Millisecond); err != nil {
+		t.Errorf("PurgeCompletedNotifications failed. Error: %s\n", err.Error())
+	} else if purged != 3 {
+		t.Errorf("PurgeCompletedNotifications purged %d notifications instead of 3\n", purged)
+	}
+	for i, status := range statuses {
+		notification, err := store.RetrieveNotificationRecord(orgID, "type1", strconv.Itoa(i), "device", "1")
+		if err != nil {
+			t.Errorf("RetrieveNotificationRecord failed. Error: %s\n", err.Error())
+		}
+		completed := status == common.Consumed || status == common.AckConsumed || status == common.Deleted
+		if completed && notification != nil {
+			t.Errorf("Completed notification with status %s wasn't purged\n", status)
+		} else if !completed && notification == nil {
+			t.Errorf("Notification with status %s was purged\n", status)
+		}
+	}
+
+	store.DeleteOrganization(orgID)
+}
+
+func testStorageLeaderHandoff(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	savedRegion := common.Configuration.Region
+	savedPreferredRegion := common.Configuration.PreferredLeaderRegion
+	defer func() {
+		common.Configuration.Region = savedRegion
+		common.Configuration.PreferredLeaderRegion = savedPreferredRegion
+	}()
+	common.Configuration.Region = "west"
+	common.Configuration.PreferredLeaderRegion = "east"
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	if _, err := store.InsertInitialLeader("leader1"); err != nil {
+		t.Errorf("InsertInitialLeader failed. Error: %s\n", err.Error())
+	}
+	_, _, _, version, err := store.RetrieveLeader()
+	if err != nil {
+		t.Errorf("RetrieveLeader failed. Error: %s\n", err.Error())
+		return
+	}
+	if updated, err := store.UpdateLeader("leader1", version); err != nil || !updated {
+		t.Errorf("UpdateLeader failed. Error: %v\n", err)
+		return
+	}
+	version++
+
+	if requested, err := store.RequestLeaderHandoff("leader2", version); err != nil || requested {
+		t.Errorf("A node outside of the preferred region requested a handoff. Error: %v\n", err)
+	}
+
+	common.Configuration.Region = "east"
+	if requested, err := store.RequestLeaderHandoff("leader2", version-1); err != nil || requested {
+		t.Errorf("A handoff was requested with a stale version. Error: %v\n", err)
+	}
+	if requested, err := store.RequestLeaderHandoff("leader2", version); err != nil || !requested {
+		t.Errorf("RequestLeaderHandoff failed. Error: %v\n", err)
+	}
+	if ok, err := store.LeaderPeriodicUpdate("leader1"); err != nil || ok {
+		t.Errorf("LeaderPeriodicUpdate succeeded after a handoff was requested. Error: %v\n", err)
+	}
+	if err := store.ResignLeadership("leader1"); err != nil {
+		t.Errorf("ResignLeadership failed. Error: %s\n", err.Error())
+	}
+	if updated, err := store.UpdateLeader("leader2", version); err != nil || !updated {
+		t.Errorf("UpdateLeader failed after the handoff. Error: %v\n", err)
+	}
+	version++
+	if ok, err := store.LeaderPeriodicUpdate("leader2"); err != nil || !ok {
+		t.Errorf("LeaderPeriodicUpdate of the new leader failed. Error: %v\n", err)
+	}
+
+	if requested, err := store.RequestLeaderHandoff("leader3", version); err != nil || requested {
+		t.Errorf("A handoff was requested from a leader with the same priority. Error: %v\n", err)
+	}
+	store.ResignLeadership("leader2")
+}
+
+func testStorageLeaderAlive(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	if _, err := store.InsertInitialLeader("alive1"); err != nil {
+		t.Errorf("InsertInitialLeader failed. Error: %s\n", err.Error())
+	}
+	_, _, _, version, err := store.RetrieveLeader()
+	if err != nil {
+		t.Errorf("RetrieveLeader failed. Error: %s\n", err.Error())
+		return
+	}
+	if updated, err := store.UpdateLeader("alive1", version); err != nil || !updated {
+		t.Errorf("UpdateLeader failed. Error: %v\n", err)
+		return
+	}
+
+	if alive, leaderID, err := store.IsLeaderAlive(); err != nil {
+		t.Errorf("IsLeaderAlive failed. Error: %s\n", err.Error())
+	} else if !alive || leaderID != "alive1" {
+		t.Errorf("IsLeaderAlive returned %t for %s instead of true for alive1\n", alive, leaderID)
+	}
+
+	if err := store.ResignLeadership("alive1"); err != nil {
+		t.Errorf("ResignLeadership failed. Error: %s\n", err.Error())
+	}
+	if alive, _, err := store.IsLeaderAlive(); err != nil {
+		t.Errorf("IsLeaderAlive failed. Error: %s\n", err.Error())
+	} else if alive {
+		t.Errorf("IsLeaderAlive returned true after the leader resigned\n")
+	}
+}
+
+func testStorageObjectsApproachingDeadline(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "deadlineorg"
+	store.DeleteOrganization(orgID)
+
+	dest := common.Destination{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+	}
+
+	now := time.Now()
+	objects := []struct {
+		objectID string
+		deadline string
+		status   string
+	}{
+		{"soon", now.Add(5 * time.Minute).Format(time.RFC3339), common.ReadyToSend},
+		{"missed", now.Add(-5 * time.Minute).Format(time.RFC3339), common.NotReadyToSend},
+		{"later", now.Add(time.Hour).Format(time.RFC3339), common.ReadyToSend},
+		{"none", "", common.ReadyToSend},
+		{"received", now.Add(5 * time.Minute).Format(time.RFC3339), common.CompletelyReceived},
+		{"delivered", now.Add(5 * time.Minute).Format(time.RFC3339), common.ReadyToSend},
+	}
+	for _, o := range objects {
+		metaData := common.MetaData{ObjectID: o.objectID, ObjectType: "type1", DestOrgID: orgID, DestType: dest.DestType,
+			DestID: dest.DestID, NoData: true, DeliveryDeadline: o.deadline}
+		if _, err := store.StoreObject(metaData, nil, o.status, ""); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s\n", o.objectID, err.Error())
+		}
+	}
+	if _, err := store.UpdateObjectDeliveryStatus(common.Delivered, "", orgID, "type1", "delivered", dest.DestType, dest.DestID); err != nil {
+		t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s\n", err.Error())
+	}
+
+	if metaDatas, err := store.RetrieveObjectsApproachingDeadline(orgID, 10*time.Minute); err != nil {
+		t.Errorf("RetrieveObjectsApproachingDeadline failed. Error: %s\n", err.Error())
+	} else if len(metaDatas) != 2 || metaDatas[0].ObjectID != "missed" || metaDatas[1].ObjectID != "soon" {
+		t.Errorf("RetrieveObjectsApproachingDeadline returned incorrect objects: %v\n", metaDatas)
+	}
+	if metaDatas, err := store.RetrieveObjectsApproachingDeadline(orgID, 2*time.Hour); err != nil {
+		t.Errorf("RetrieveObjectsApproachingDeadline failed. Error: %s\n", err.Error())
+	} else if len(metaDatas) != 3 || metaDatas[2].ObjectID != "later" {
+		t.Errorf("RetrieveObjectsApproachingDeadline returned incorrect objects: %v\n", metaDatas)
+	}
+	if _, err := store.RetrieveObjectsApproachingDeadline(orgID, -time.Minute); err == nil {
+		t.Errorf("RetrieveObjectsApproachingDeadline didn't fail for a negative duration\n")
+	}
+
+	// An invalid deadline is rejected
+	metaData := common.MetaData{ObjectID: "invalid", ObjectType: "type1", DestOrgID: orgID, NoData: true, DeliveryDeadline: "soon"}
+	if _, err := store.StoreObject(metaData, nil, common.ReadyToSend, ""); err == nil {
+		t.Errorf("StoreObject didn't fail for an invalid delivery deadline\n")
+	}
+
+	store.DeleteOrganization(orgID)
+	store.DeleteDestination(orgID, dest.DestType, dest.DestID)
+}
+
+func testStoragePartialObjectData(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	savedChunkSize := common.Configuration.MaxDataChunkSize
+	defer func() { common.Configuration.MaxDataChunkSize = savedChunkSize }()
+	common.Configuration.MaxDataChunkSize = 10
+
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "partial", DestOrgID: "partialorg"}
+	store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "")
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+
+	data := []byte("0123456789abcdefghijABCDEFGHIJxyz")
+	total := int64(len(data))
+	appendChunk := func(offset int64, end int64, isFirstChunk bool, isLastChunk bool) {
+		if err := store.AppendObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, bytes.NewReader(data[offset:end]),
+			uint32(end-offset), offset, total, isFirstChunk, isLastChunk); err != nil {
+			t.Errorf("AppendObjectData failed at offset %d. Error: %s\n", offset, err.Error())
+		}
+	}
+	// The uploaded data may become visible asynchronously, wait for it for a while
+	readPartial := func(offset int64, expected []byte, expectedEOF bool) {
+		var read []byte
+		var eof bool
+		for i := 0; i < 20; i++ {
+			var length int
+			var err error
+			read, eof, length, err = store.ReadPartialObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, 100, offset)
+			if err != nil {
+				t.Errorf("ReadPartialObjectData failed at offset %d. Error: %s\n", offset, err.Error())
+				return
+			}
+			// The read buffer may be longer than the data read
+			read = read[:length]
+			if bytes.Equal(read, expected) {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if !bytes.Equal(read, expected) || eof != expectedEOF {
+			t.Errorf("ReadPartialObjectData at offset %d returned %s (eof %t) instead of %s (eof %t)\n", offset, string(read), eof,
+				string(expected), expectedEOF)
+		}
+	}
+
+	// A chunk written beyond a gap isn't read
+	appendChunk(0, 10, true, false)
+	appendChunk(20, 30, false, false)
+	readPartial(0, data[:10], false)
+	readPartial(10, []byte{}, false)
+
+	// Once the gap is filled, the data is read up to the committed offset
+	appendChunk(10, 20, false, false)
+	readPartial(5, data[5:30], false)
+
+	// After the upload completes, the complete data is read
+	appendChunk(30, total, false, true)
+	readPartial(25, data[25:], true)
+
+	store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "")
+}
+
+func testStorageReplaceObject(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "replace", DestOrgID: "replaceorg", Description: "old"}
+	store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "")
+	if _, err := store.StoreObject(metaData, []byte("old data"), common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+
+	checkObject := func(description string, data string) {
+		if storedMetaData, err := store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil || storedMetaData == nil {
+			t.Errorf("Failed to retrieve object. Error: %v\n", err)
+		} else if storedMetaData.Description != description {
+			t.Errorf("Incorrect meta data: description %s instead of %s\n", storedMetaData.Description, description)
+		}
+		dataReader, err := store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "")
+		if err != nil || dataReader == nil {
+			t.Errorf("Failed to retrieve object's data. Error: %v\n", err)
+			return
+		}
+		if storedData, err := ioutil.ReadAll(dataReader); err != nil {
+			t.Errorf("Failed to read object's data. Error: %s\n", err.Error())
+		} else if string(storedData) != data {
+			t.Errorf("Incorrect data: %s instead of %s\n", string(storedData), data)
+		}
+		store.CloseDataReader(dataReader)
+		if storedData, eof, length, err := store.ReadObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, 100, 0, ""); err != nil {
+			t.Errorf("Failed to read object's data. Error: %s\n", err.Error())
+		} else if string(storedData[:length]) != data || !eof {
+			t.Errorf("Incorrect data: %s (eof %t) instead of %s\n", string(storedData[:length]), eof, data)
+		}
+	}
+
+	// Replace the object twice, each time the new meta data and data are read
+	metaData.Description = "new"
+	if err := store.ReplaceObject(metaData, bytes.NewReader([]byte("new data")), ""); err != nil {
+		t.Errorf("ReplaceObject failed. Error: %s\n", err.Error())
+	}
+	checkObject("new", "new data")
+	if storedMetaData, err := store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err == nil && storedMetaData != nil &&
+		storedMetaData.ObjectSize != int64(len("new data")) {
+		t.Errorf("Incorrect object size after ReplaceObject: %d\n", storedMetaData.ObjectSize)
+	}
+	metaData.Description = "newer"
+	if err := store.ReplaceObject(metaData, bytes.NewReader([]byte("newer data")), ""); err != nil {
+		t.Errorf("ReplaceObject failed. Error: %s\n", err.Error())
+	}
+	checkObject("newer", "newer data")
+
+	// Updating only the meta data keeps the replaced data
+	metaOnly := metaData
+	metaOnly.Description = "meta only"
+	metaOnly.MetaOnly = true
+	if _, err := store.StoreObject(metaOnly, nil, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	checkObject("meta only", "newer data")
+
+	// Storing the data replaces the data written by ReplaceObject
+	if _, err := store.StoreObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, bytes.NewReader([]byte("stored data"))); err != nil {
+		t.Errorf("StoreObjectData failed. Error: %s\n", err.Error())
+	}
+	checkObject("meta only", "stored data")
+
+	// Objects without data can't be replaced, and missing objects aren't created
+	noData := metaData
+	noData.NoData = true
+	if err := store.ReplaceObject(noData, bytes.NewReader([]byte("data")), ""); err == nil {
+		t.Errorf("ReplaceObject didn't fail for an object without data\n")
+	}
+	missing := metaData
+	missing.ObjectID = "missing"
+	if err := store.ReplaceObject(missing, bytes.NewReader([]byte("data")), ""); err == nil || !IsNotFound(err) {
+		t.Errorf("ReplaceObject didn't return not found for a missing object. Error: %v\n", err)
+	}
+
+	store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "")
+}
+
+func testStorageSetACL(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "setaclorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	user1 := common.ACLentry{Username: "user1", ACLUserType: "user", ACLRole: "aclWriter"}
+	user2 := common.ACLentry{Username: "user2", ACLUserType: "user", ACLRole: "aclWriter"}
+	user3 := common.ACLentry{Username: "user3", ACLUserType: "user", ACLRole: "aclReader"}
+
+	if err := store.AddUsersToACL(common.DestinationsACLType, orgID, "type1", []common.ACLentry{user1, user2}); err != nil {
+		t.Errorf("AddUsersToACL failed. Error: %s\n", err.Error())
+	}
+
+	tests := []struct {
+		key   string
+		users []common.ACLentry
+	}{
+		{"type1", []common.ACLentry{user2, user3}},
+		{"type1", []common.ACLentry{user1}},
+		{"type2", []common.ACLentry{user1, user2, user3}},
+		{"", []common.ACLentry{user3}},
+	}
+	for _, test := range tests {
+		if err := store.SetACL(common.DestinationsACLType, orgID, test.key, test.users); err != nil {
+			t.Errorf("SetACL failed. Error: %s\n", err.Error())
+			continue
+		}
+		users, err := store.RetrieveACL(common.DestinationsACLType, orgID, test.key, "")
+		if err != nil {
+			t.Errorf("RetrieveACL failed. Error: %s\n", err.Error())
+			continue
+		}
+		if len(users) != len(test.users) {
+			t.Errorf("RetrieveACL returned %d users instead of %d for %s\n", len(users), len(test.users), test.key)
+			continue
+		}
+		for _, expected := range test.users {
+			found := false
+			for _, user := range users {
+				if user == expected {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("User %s is missing in the ACL of %s\n", expected.Username, test.key)
+			}
+		}
+	}
+
+	// Setting an empty list of users deletes the ACL
+	if err := store.SetACL(common.DestinationsACLType, orgID, "type2", nil); err != nil {
+		t.Errorf("SetACL failed. Error: %s\n", err.Error())
+	}
+	if users, err := store.RetrieveACL(common.DestinationsACLType, orgID, "type2", ""); err != nil {
+		t.Errorf("RetrieveACL failed. Error: %s\n", err.Error())
+	} else if len(users) != 0 {
+		t.Errorf("RetrieveACL returned %d users of a deleted ACL\n", len(users))
+	}
+	if keys, err := store.RetrieveACLsInOrg(common.DestinationsACLType, orgID); err != nil {
+		t.Errorf("RetrieveACLsInOrg failed. Error: %s\n", err.Error())
+	} else if len(keys) != 2 {
+		t.Errorf("RetrieveACLsInOrg returned %d ACLs instead of 2\n", len(keys))
+	}
+}
+
+func testStorageObjectsByIDs(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "byidsorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	for _, id := range []string{"1", "2", "3"} {
+		metaData := common.MetaData{ObjectID: id, ObjectType: "byids", DestOrgID: orgID, NoData: true}
+		if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s. Error: %s\n", id, err.Error())
+		}
+		defer store.DeleteStoredObject(orgID, "byids", id, "")
+	}
+
+	tests := []struct {
+		keys     []common.ObjectKey
+		expected []string
+	}{
+		{nil, []string{}},
+		{[]common.ObjectKey{{ObjectType: "byids", ObjectID: "3"}, {ObjectType: "byids", ObjectID: "1"}}, []string{"3", "1"}},
+		{[]common.ObjectKey{{ObjectType: "byids", ObjectID: "2"}, {ObjectType: "byids", ObjectID: "lalala"},
+			{ObjectType: "other", ObjectID: "1"}, {ObjectType: "byids", ObjectID: "1"}}, []string{"2", "1"}},
+	}
+	for _, test := range tests {
+		metaDatas, err := store.RetrieveObjectsByIDs(orgID, test.keys)
+		if err != nil {
+			t.Errorf("RetrieveObjectsByIDs failed. Error: %s\n", err.Error())
+			continue
+		}
+		if len(metaDatas) != len(test.expected) {
+			t.Errorf("RetrieveObjectsByIDs returned %d objects instead of %d\n", len(metaDatas), len(test.expected))
+			continue
+		}
+		for i, metaData := range metaDatas {
+			if metaData.ObjectID != test.expected[i] || metaData.ObjectType != "byids" || metaData.DestOrgID != orgID {
+				t.Errorf("RetrieveObjectsByIDs returned %s:%s instead of byids:%s at index %d\n",
+					metaData.ObjectType, metaData.ObjectID, test.expected[i], i)
+			}
+		}
+	}
+
+	// The instance ID of the stored object, or 0 for a non-existing object
+	stored, err := store.RetrieveObject(orgID, "byids", "2")
+	if err != nil || stored == nil {
+		t.Errorf("RetrieveObject failed. Error: %v\n", err)
+	} else if instanceID, err := store.RetrieveObjectInstanceID(orgID, "byids", "2"); err != nil {
+		t.Errorf("RetrieveObjectInstanceID failed. Error: %s\n", err.Error())
+	} else if instanceID != stored.InstanceID || instanceID == 0 {
+		t.Errorf("RetrieveObjectInstanceID returned %d instead of %d\n", instanceID, stored.InstanceID)
+	}
+	if instanceID, err := store.RetrieveObjectInstanceID(orgID, "byids", "lalala"); err != nil {
+		t.Errorf("RetrieveObjectInstanceID failed. Error: %s\n", err.Error())
+	} else if instanceID != 0 {
+		t.Errorf("RetrieveObjectInstanceID returned %d for a non-existing object\n", instanceID)
+	}
+}
+
+func testStorageObjectMetadataBatch(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	orgID := "batchorg"
+	store.DeleteOrganization(orgID)
+	defer store.DeleteOrganization(orgID)
+
+	for _, id := range []string{"1", "2"} {
+		metaData := common.MetaData{ObjectID: id, ObjectType: "batch", DestOrgID: orgID, NoData: true,
+			Description: "description", Version: "1.0", ObjectSize: 100}
+		if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s. Error: %s\n", id, err.Error())
+		}
+		defer store.DeleteStoredObject(orgID, "batch", id, "")
+	}
+
+	keys := []common.ObjectKey{{ObjectType: "batch", ObjectID: "2"}, {ObjectType: "batch", ObjectID: "lalala"},
+		{ObjectType: "batch", ObjectID: "1"}}
+	metaDatas, err := store.RetrieveObjectMetadataBatch(orgID, keys, []string{"object-size", "instance-id"})
+	if err != nil {
+		t.Errorf("RetrieveObjectMetadataBatch failed. Error: %s\n", err.Error())
+	} else if len(metaDatas) != 2 {
+		t.Errorf("RetrieveObjectMetadataBatch returned %d objects instead of 2\n", len(metaDatas))
+	} else {
+		for i, id := range []string{"2", "1"} {
+			metaData := metaDatas[i]
+			if metaData.ObjectID != id || metaData.ObjectType != "batch" || metaData.DestOrgID != orgID {
+				t.Errorf("RetrieveObjectMetadataBatch returned %s:%s instead of batch:%s at index %d\n",
+					metaData.ObjectType, metaData.ObjectID, id, i)
+			}
+			if metaData.ObjectSize != 100 || metaData.InstanceID == 0 {
+				t.Errorf("RetrieveObjectMetadataBatch didn't return the requested fields of %s: size %d, instance ID %d\n",
+					id, metaData.ObjectSize, metaData.InstanceID)
+			}
+			if metaData.Description != "" || metaData.Version != "" || metaData.NoData {
+				t.Errorf("RetrieveObjectMetadataBatch returned fields that were not requested of %s\n", id)
+			}
+		}
+	}
+
+	if _, err := store.RetrieveObjectMetadataBatch(orgID, keys, []string{"lalala"}); err == nil {
+		t.Errorf("RetrieveObjectMetadataBatch didn't fail for an invalid field\n")
+	}
+}
+
+func testStorageObjectAttachment(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	attachment := []byte{0x00, 0x01, 0xfe, 0xff, 's', 'i', 'g'}
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "attachment", DestOrgID: "myorg", Attachment: attachment}
+	if _, err := store.StoreObject(metaData, []byte("data"), common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	defer store.DeleteStoredObject("myorg", "attachment", "1", "")
+
+	if storedMetaData, err := store.RetrieveObject("myorg", "attachment", "1"); err != nil || storedMetaData == nil {
+		t.Errorf("Failed to retrieve object. Error: %v\n", err)
+	} else if !bytes.Equal(storedMetaData.Attachment, attachment) {
+		t.Errorf("Retrieved attachment %v instead of %v\n", storedMetaData.Attachment, attachment)
+	}
+
+	// An oversized attachment is rejected and the stored object is left unchanged
+	metaData.Attachment = make([]byte, common.MaxAttachmentSize+1)
+	if _, err := store.StoreObject(metaData, []byte("data"), common.NotReadyToSend, ""); err == nil {
+		t.Errorf("Stored an object with an oversized attachment\n")
+	} else if !common.IsValidationError(err) {
+		t.Errorf("Storing an object with an oversized attachment returned an error of the wrong type: %s\n", err.Error())
+	}
+	if storedMetaData, err := store.RetrieveObject("myorg", "attachment", "1"); err != nil || storedMetaData == nil {
+		t.Errorf("Failed to retrieve object. Error: %v\n", err)
+	} else if !bytes.Equal(storedMetaData.Attachment, attachment) {
+		t.Errorf("Retrieved attachment %v instead of %v\n", storedMetaData.Attachment, attachment)
+	}
+}
+
+func testStorageObjectDelta(storageType string, t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	base := []byte("config version 1: alpha=1 beta=2")
+	expected := []byte("config version 2: alpha=1 beta=3 gamma=4")
+	expectedHash := "b4fac22ef21f34eb8ee7abbc8dc08c5fcb09f981a64614c6ab67be0093f0ca00"
+	// A patch in the bsdiff format from the base data to the expected data
+	patch, _ := hex.DecodeString("42534449464634302b0000000000000029000000000000002800000000000000425a683931415926535987560734" +
+		"000005d0004848400020002186819a0c56c9b8bb9229c284843ab039a0425a6839314159265359a6b87c7200000040006008200020aa7a98" +
+		"6624ef4c2ee48a70a1214d70f8e4425a683931415926535937cdfe8e0000001900400004022082200030c0064c6a74a04be2ee48a70a12" +
+		"06f9bfd1c0")
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "delta", DestOrgID: "myorg"}
+	if _, err := store.StoreObject(metaData, base, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	defer store.DeleteStoredObject("myorg", "delta", "1", "")
+	storedMetaData, err := store.RetrieveObject("myorg", "delta", "1")
+	if err != nil || storedMetaData == nil {
+		t.Errorf("Failed to retrieve object. Error: %v\n", err)
+		return
+	}
+
+	// A patch whose control block is corrupt, and patches whose header declares a huge or a negative size of the new data
+	corruptPatch := append([]byte{}, patch...)
+	for i := bsdiffHeaderSize + 4; i < bsdiffHeaderSize+20; i++ {
+		corruptPatch[i] = 0
+	}
+	oversizedPatch := append([]byte{}, patch...)
+	copy(oversizedPatch[24:32], []byte{0, 0, 0, 0, 0, 1, 0, 0})
+	negativeSizePatch := append([]byte{}, patch...)
+	negativeSizePatch[31] |= 0x80
+
+	tests := []struct {
+		baseDataID int64
+		patch      []byte
+		size       int64
+		hash       string
+	}{
+		{storedMetaData.DataID + 1, patch, int64(len(expected)), expectedHash},
+		{storedMetaData.DataID, corruptPatch, int64(len(expected)), expectedHash},
+		{storedMetaData.DataID, oversizedPatch, int64(len(expected)), expectedHash},
+		{storedMetaData.DataID, oversizedPatch, 1 << 40, ""},
+		{storedMetaData.DataID, negativeSizePatch, int64(len(expected)), expectedHash},
+		{storedMetaData.DataID, []byte("lalala"), int64(len(expected)), expectedHash},
+		{storedMetaData.DataID, patch, int64(len(expected)) + 1, expectedHash},
+		{storedMetaData.DataID, patch, int64(len(expected)), strings.Repeat("0", len(expectedHash))},
+	}
+	for i, test := range tests {
+		if err := store.AppendObjectDelta("myorg", "delta", "1", test.baseDataID, bytes.NewReader(test.patch), test.size,
+			test.hash); err == nil {
+			t.Errorf("AppendObjectDelta succeeded for invalid delta %d\n", i)
+		}
+	}
+	checkData := func(expectedData []byte) {
+		dataReader, err := store.RetrieveObjectData("myorg", "delta", "1", "")
+		if err != nil || dataReader == nil {
+			t.Errorf("Failed to retrieve object's data. Error: %v\n", err)
+			return
+		}
+		data, _ := ioutil.ReadAll(dataReader)
+		store.CloseDataReader(dataReader)
+		if !bytes.Equal(data, expectedData) {
+			t.Errorf("Retrieved data %s instead of %s\n", data, expectedData)
+		}
+	}
+	checkData(base)
+
+	if err := store.AppendObjectDelta("myorg", "delta", "1", storedMetaData.DataID, bytes.NewReader(patch), int64(len(expected)),
+		expectedHash); err != nil {
+		t.Errorf("AppendObjectDelta failed. Error: %s\n", err.Error())
+	}
+	checkData(expected)
+
+	// The base data was replaced, the same delta can't be applied again
+	if err := store.AppendObjectDelta("myorg", "delta", "1", storedMetaData.DataID, bytes.NewReader(patch), int64(len(expected)),
+		expectedHash); err == nil {
+		t.Errorf("AppendObjectDelta succeeded for replaced base data\n")
+	}
+}
+
+func testStorageDataAccessLog(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+	defer func() { common.Configuration.LogDataAccess = false }()
+
+	// The audit log outlives the objects, use a unique object ID to ignore records of previous runs
+	objectID := fmt.Sprintf("access%d", time.Now().UnixNano())
+	data := []byte("0123456789abcdef")
+	metaData := common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: "auditorg", ObjectSize: int64(len(data))}
+	if _, err := store.StoreObject(metaData, data, common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	defer store.DeleteStoredObject("auditorg", "type1", objectID, "")
+
+	readData := func(identity string) {
+		if dataReader, err := store.RetrieveObjectData("auditorg", "type1", objectID, identity); err != nil || dataReader == nil {
+			t.Errorf("Failed to retrieve object's data. Error: %v\n", err)
+		} else {
+			store.CloseDataReader(dataReader)
+		}
+		if _, _, _, err := store.ReadObjectData("auditorg", "type1", objectID, 10, 10, identity); err != nil {
+			t.Errorf("Failed to read object's data. Error: %s\n", err.Error())
+		}
+	}
+
+	// Reads aren't recorded unless LogDataAccess is set, and internal reads are never recorded
+	common.Configuration.LogDataAccess = false
+	readData("auditorg/user1")
+	common.Configuration.LogDataAccess = true
+	readData("")
+	readData("device/dev1")
+
+	records, err := store.RetrieveAuditLog("auditorg", "type1", objectID)
+	if err != nil {
+		t.Errorf("Failed to retrieve the audit log. Error: %s\n", err.Error())
+		return
+	}
+	reads := make([]common.AuditRecord, 0)
+	for _, record := range records {
+		if record.Action == common.AuditRead {
+			reads = append(reads, record)
+		}
+	}
+	expectedSizes := []int64{int64(len(data)), 6}
+	if len(reads) != len(expectedSizes) {
+		t.Errorf("Retrieved %d read records instead of %d: %+v\n", len(reads), len(expectedSizes), reads)
+		return
+	}
+	for i, record := range reads {
+		if record.Identity != "device/dev1" || record.DataSize != expectedSizes[i] || record.Timestamp.IsZero() {
+			t.Errorf("Wrong read record %d: %+v\n", i, record)
+		}
+	}
+}
+
+func testStorageDeleteObjectsOfType(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	objects := []struct {
+		metaData common.MetaData
+		data     []byte
+		deleted  bool
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "retired", DestOrgID: "typeorg"}, []byte("data1"), true},
+		{common.MetaData{ObjectID: "2", ObjectType: "retired", DestOrgID: "typeorg"}, []byte("data2"), true},
+		{common.MetaData{ObjectID: "3", ObjectType: "retired", DestOrgID: "typeorg", NoData: true}, nil, true},
+		{common.MetaData{ObjectID: "1", ObjectType: "kept", DestOrgID: "typeorg"}, []byte("data4"), false},
+		{common.MetaData{ObjectID: "1", ObjectType: "retired", DestOrgID: "otherorg"}, []byte("data5"), false},
+	}
+	for _, object := range objects {
+		if _, err := store.StoreObject(object.metaData, object.data, common.NotReadyToSend, ""); err != nil {
+			t.Errorf("Failed to store object %s:%s. Error: %s\n", object.metaData.ObjectType, object.metaData.ObjectID, err.Error())
+		}
+		defer store.DeleteStoredObject(object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID, "")
+	}
+
+	if deleted, err := store.DeleteObjectsOfType("typeorg", "retired"); err != nil {
+		t.Errorf("DeleteObjectsOfType failed. Error: %s\n", err.Error())
+	} else if deleted != 3 {
+		t.Errorf("DeleteObjectsOfType deleted %d objects instead of 3\n", deleted)
+	}
+
+	for _, object := range objects {
+		metaData, err := store.RetrieveObject(object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID)
+		if err != nil {
+			t.Errorf("Failed to retrieve object. Error: %s\n", err.Error())
+		} else if object.deleted && metaData != nil {
+			t.Errorf("Object %s:%s:%s wasn't deleted\n", object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID)
+		} else if !object.deleted && metaData == nil {
+			t.Errorf("Object %s:%s:%s was deleted\n", object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID)
+		}
+		if object.deleted && object.data != nil {
+			if dataReader, err := store.RetrieveObjectData(object.metaData.DestOrgID, object.metaData.ObjectType,
+				object.metaData.ObjectID, ""); err != nil {
+				t.Errorf("Failed to retrieve object's data. Error: %s\n", err.Error())
+			} else if dataReader != nil {
+				store.CloseDataReader(dataReader)
+				t.Errorf("The data of object %s:%s wasn't deleted\n", object.metaData.ObjectType, object.metaData.ObjectID)
+			}
+		}
+	}
+
+	if deleted, err := store.DeleteObjectsOfType("typeorg", "retired"); err != nil {
+		t.Errorf("DeleteObjectsOfType failed. Error: %s\n", err.Error())
+	} else if deleted != 0 {
+		t.Errorf("DeleteObjectsOfType deleted %d objects of a type without objects\n", deleted)
+	}
+}
+
+func testStorageObjectStatusChange(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	dest := common.Destination{DestOrgID: "statusorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol}
+	if err := store.StoreDestination(dest); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+	}
+	defer store.DeleteDestination("statusorg", "device", "dev1")
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "statusorg", DestType: "device", DestID: "dev1", NoData: true}
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend, ""); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		return
+	}
+	defer store.DeleteStoredObject("statusorg", "type1", "1", "")
+
+	changes := make([]ObjectStatusChange, 0)
+	SetObjectStatusChangeHandler(func(change ObjectStatusChange) error {
+		// The handler may call the storage
+		if _, err := store.RetrieveObject(change.OrgID, change.ObjectType, change.ObjectID); err != nil {
+			t.Errorf("Failed to retrieve object in the status change handler. Error: %s\n", err.Error())
+		}
+		changes = append(changes, change)
+		return &Error{"Handler errors are only logged"}
+	})
+	defer SetObjectStatusChangeHandler(nil)
+
+	if err := store.UpdateObjectStatus("statusorg", "type1", "1", common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to update object's status. Error: %s\n", err.Error())
+	}
+	// The status doesn't change
+	if err := store.UpdateObjectStatus("statusorg", "type1", "1", common.ReadyToSend, ""); err != nil {
+		t.Errorf("Failed to update object's status. Error: %s\n", err.Error())
+	}
+	if _, err := store.UpdateObjectDeliveryStatus(common.Delivered, "", "statusorg", "type1", "1", "device", "dev1"); err != nil {
+		t.Errorf("Failed to update object's delivery status. Error: %s\n", err.Error())
+	}
+	if err := store.MarkObjectDeleted("statusorg", "type1", "1", ""); err != nil {
+		t.Errorf("Failed to mark object as deleted. Error: %s\n", err.Error())
+	}
+
+	expected := []ObjectStatusChange{
+		{OrgID: "statusorg", ObjectType: "type1", ObjectID: "1", OldStatus: common.NotReadyToSend, NewStatus: common.ReadyToSend},
+		{OrgID: "statusorg", ObjectType: "type1", ObjectID: "1", DestType: "device", DestID: "dev1",
+			OldStatus: common.Pending, NewStatus: common.Delivered},
+		{OrgID: "statusorg", ObjectType: "type1", ObjectID: "1", OldStatus: common.ReadyToSend, NewStatus: common.ObjDeleted},
+	}
+	if len(changes) != len(expected) {
+		t.Errorf("The handler was called %d times instead of %d: %+v\n", len(changes), len(expected), changes)
+		return
+	}
+	for i, change := range changes {
+		if change != expected[i] {
+			t.Errorf("Wrong status change %d: %+v instead of %+v\n", i, change, expected[i])
+		}
+	}
+}
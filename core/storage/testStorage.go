@@ -0,0 +1,2833 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/dataURI"
+)
+
+// TestStorage is an in-memory store that follows the semantics of the MongoStorage (CSS) store.
+// Nothing is persisted, therefore it should be used only in unit tests of packages that need a storage
+// and can't depend on a running database.
+type TestStorage struct {
+	lock            sync.Mutex
+	objects         map[string]testObject
+	tmpData         map[string][]byte
+	destinations    map[string]testDestination
+	notifications   map[string]common.Notification
+	webhooks        map[string][]string
+	messagingGroups map[string]testMessagingGroup
+	organizations   map[string]common.StoredOrganization
+	acls            map[string]testACL
+	aclGroups       map[string]common.ACLGroup
+	apiTokens       map[string]common.APIToken
+	audit           map[string][]common.AuditRecord
+	objectVersions  map[string]testObjectVersion
+	idempotencyKeys map[string]time.Time
+	retention       map[string]common.RetentionPolicy
+	webhookPolicies map[string]common.WebhookRetryPolicy
+	webhookFailures map[string]common.WebhookFailure
+	uploads         map[string]*uploadProgress
+	leader          *testLeader
+	timebase        int64
+}
+
+type testObject struct {
+	meta               common.MetaData
+	data               []byte
+	status             string
+	policyReceived     bool
+	remainingConsumers int
+	remainingReceivers int
+	destinations       []common.StoreDestinationStatus
+	previousStatus     string
+	lastUpdate         time.Time
+	dataComplete       bool
+}
+
+type testObjectVersion struct {
+	meta common.MetaData
+	data []byte
+}
+
+type testDestination struct {
+	destination   common.Destination
+	lastPingTime  time.Time
+	lastConnected time.Time
+}
+
+type testMessagingGroup struct {
+	groupName  string
+	lastUpdate time.Time
+}
+
+type testACL struct {
+	users   []common.ACLentry
+	orgID   string
+	aclType string
+	key     string
+}
+
+type testLeader struct {
+	uuid               string
+	lastHeartbeat      time.Time
+	heartbeatTimeout   int32
+	version            int64
+	priority           int32
+	handoffRequestedBy string
+}
+
+// Init initializes the TestStorage store
+func (store *TestStorage) Init() common.SyncServiceError {
+	store.objects = make(map[string]testObject)
+	store.tmpData = make(map[string][]byte)
+	store.destinations = make(map[string]testDestination)
+	store.notifications = make(map[string]common.Notification)
+	store.webhooks = make(map[string][]string)
+	store.messagingGroups = make(map[string]testMessagingGroup)
+	store.organizations = make(map[string]common.StoredOrganization)
+	store.acls = make(map[string]testACL)
+	store.aclGroups = make(map[string]common.ACLGroup)
+	store.apiTokens = make(map[string]common.APIToken)
+	store.audit = make(map[string][]common.AuditRecord)
+	store.objectVersions = make(map[string]testObjectVersion)
+	store.idempotencyKeys = make(map[string]time.Time)
+	store.retention = make(map[string]common.RetentionPolicy)
+	store.webhookPolicies = make(map[string]common.WebhookRetryPolicy)
+	store.webhookFailures = make(map[string]common.WebhookFailure)
+	store.uploads = make(map[string]*uploadProgress)
+	store.leader = nil
+	store.timebase = time.Now().UnixNano()
+	common.HealthStatus.ReconnectedToDatabase()
+	return nil
+}
+
+// Stop stops the TestStorage store
+func (store *TestStorage) Stop() {
+}
+
+// PerformMaintenance performs store's maintenance
+func (store *TestStorage) PerformMaintenance() {
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	policies := make([]common.RetentionPolicy, 0, len(store.retention))
+	for _, policy := range store.retention {
+		policies = append(policies, policy)
+	}
+	policiesByType := retentionPoliciesByType(policies)
+	now := time.Now()
+
+	for id, object := range store.objects {
+		if (object.meta.Expiration != "" && object.meta.Expiration <= currentTime && !object.meta.Pinned &&
+			(object.status == common.NotReadyToSend || object.status == common.ReadyToSend)) ||
+			retentionExpired(policiesByType, object.meta, object.status, object.lastUpdate, now) {
+			delete(store.objects, id)
+			store.deleteNotifications(func(n common.Notification) bool {
+				return n.DestOrgID == object.meta.DestOrgID && n.ObjectType == object.meta.ObjectType && n.ObjectID == object.meta.ObjectID
+			})
+		}
+	}
+
+	if maxAge := auditLogMaxAge(); maxAge > 0 {
+		cutoff := time.Now().Add(-maxAge)
+		store.deleteAuditRecords(func(record common.AuditRecord) bool {
+			return record.Timestamp.Before(cutoff)
+		})
+	}
+
+	versions := make([]common.MetaData, 0, len(store.objectVersions))
+	for _, version := range store.objectVersions {
+		versions = append(versions, version.meta)
+	}
+	for _, version := range objectVersionsToPrune(versions, policies) {
+		delete(store.objectVersions, createObjectVersionCollectionID(version.DestOrgID, version.ObjectType, version.ObjectID, version.InstanceID))
+	}
+
+	if maxAge := completedNotificationsMaxAge(); maxAge > 0 {
+		store.purgeCompletedNotifications("", maxAge)
+	}
+}
+
+// Cleanup erase the on disk Bolt database only for ESS and test
+func (store *TestStorage) Cleanup(isTest bool) common.SyncServiceError {
+	return nil
+}
+
+// StoreObject stores an object
+// If the object already exists, return the changes in its destinations list (for CSS) - return the list of deleted destinations
+func (store *TestStorage) StoreObject(metaData common.MetaData, data []byte, status string, identity string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	if err := metaData.Validate(); err != nil {
+		return nil, err
+	}
+	normalizeObjectTimes(&metaData)
+
+	if metaData.DestinationPolicy != nil {
+		metaData.DestinationPolicy.Timestamp = time.Now().UTC().UnixNano()
+	}
+
+	var dests []common.StoreDestinationStatus
+	var deletedDests []common.StoreDestinationStatus
+	if status == common.NotReadyToSend || status == common.ReadyToSend {
+		var err error
+		dests, deletedDests, err = createDestinationsFromMeta(store, metaData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if status == common.NotReadyToSend || status == common.ReadyToSend {
+		// The object was receieved from a service, i.e. this node is the origin of the object:
+		// set its instance id
+		newID := store.getInstanceID()
+		metaData.InstanceID = newID
+		if data != nil && !metaData.NoData && !metaData.MetaOnly {
+			metaData.DataID = newID
+		}
+	}
+
+	id := getObjectCollectionID(metaData)
+	existingObject, exists := store.objects[id]
+	if exists && objectVersionsKept(store.retentionPolicy(metaData.DestOrgID, metaData.ObjectType), metaData.ObjectType) > 0 &&
+		!existingObject.meta.Deleted && existingObject.status != common.ObjDeleted {
+		meta := existingObject.meta
+		versionID := createObjectVersionCollectionID(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.InstanceID)
+		store.objectVersions[versionID] = testObjectVersion{meta: meta, data: copyData(existingObject.data)}
+	}
+	if exists {
+		if (metaData.DestinationPolicy != nil && existingObject.meta.DestinationPolicy == nil) ||
+			(metaData.DestinationPolicy == nil && existingObject.meta.DestinationPolicy != nil) {
+			return nil, &common.InvalidRequest{Message: "Can't update the existence of Destination Policy"}
+		}
+
+		if metaData.MetaOnly {
+			metaData.DataID = existingObject.meta.DataID
+			metaData.ObjectSize = existingObject.meta.ObjectSize
+			metaData.ChunkSize = existingObject.meta.ChunkSize
+			metaData.PublicKey = existingObject.meta.PublicKey
+			metaData.Signature = existingObject.meta.Signature
+		}
+		if metaData.DestinationPolicy != nil {
+			dests = existingObject.destinations
+		}
+	}
+
+	newObject := testObject{meta: metaData, status: status, policyReceived: false,
+		remainingConsumers: metaData.ExpectedConsumers, remainingReceivers: metaData.ExpectedConsumers,
+		destinations: dests, dataComplete: storedDataComplete(metaData, data, exists && existingObject.dataComplete)}
+	// The data of objects with a source data URI is read from the URI
+	if metaData.SourceDataURI == "" && !metaData.NoData && data != nil {
+		newObject.data = make([]byte, len(data))
+		copy(newObject.data, data)
+	} else if metaData.MetaOnly && exists {
+		newObject.data = existingObject.data
+	}
+	newObject.lastUpdate = time.Now()
+	store.objects[id] = newObject
+	store.addAuditRecord(newAuditRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.AuditStore, status, identity))
+
+	return deletedDests, nil
+}
+
+// StoreObjectData stores an object's data
+// Return true if the object was found and updated
+// Return false and no error, if the object doesn't exist
+func (store *TestStorage) StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
+	limiter := newObjectSizeLimiter(objectType, dataReader, 0)
+	data, err := ioutil.ReadAll(limiter)
+	if limiter.exceeded != nil {
+		return false, limiter.exceeded
+	}
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Failed to read object data. Error: %s.", err)}
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := store.objects[id]
+	if !ok {
+		return false, nil
+	}
+	if object.status == common.NotReadyToSend {
+		object.status = common.ReadyToSend
+		store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditUpdateStatus, common.ReadyToSend,
+			common.SyncServiceIdentity))
+	}
+	if object.status == common.NotReadyToSend || object.status == common.ReadyToSend {
+		newID := store.getInstanceID()
+		object.meta.InstanceID = newID
+		object.meta.DataID = newID
+	}
+	object.data = data
+	object.meta.ObjectSize = int64(len(data))
+	object.dataComplete = true
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	return true, nil
+}
+
+// ReplaceObject replaces the meta data and the data of an existing object.
+// Readers see either the previous meta data and data or the new ones.
+// The status and the destinations of the object are kept.
+func (store *TestStorage) ReplaceObject(metaData common.MetaData, dataReader io.Reader, identity string) common.SyncServiceError {
+	if err := checkReplacementMetaData(metaData); err != nil {
+		return err
+	}
+	normalizeObjectTimes(&metaData)
+
+	limiter := newObjectSizeLimiter(metaData.ObjectType, dataReader, 0)
+	data, err := ioutil.ReadAll(limiter)
+	if limiter.exceeded != nil {
+		return limiter.exceeded
+	}
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to read object data. Error: %s.", err)}
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := getObjectCollectionID(metaData)
+	object, ok := store.objects[id]
+	if !ok {
+		return notFound
+	}
+	if (metaData.DestinationPolicy != nil) != (object.meta.DestinationPolicy != nil) {
+		return &common.InvalidRequest{Message: "Can't update the existence of Destination Policy"}
+	}
+	if objectVersionsKept(store.retentionPolicy(metaData.DestOrgID, metaData.ObjectType), metaData.ObjectType) > 0 &&
+		!object.meta.Deleted && object.status != common.ObjDeleted {
+		meta := object.meta
+		versionID := createObjectVersionCollectionID(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.InstanceID)
+		store.objectVersions[versionID] = testObjectVersion{meta: meta, data: copyData(object.data)}
+	}
+
+	if object.status == common.NotReadyToSend || object.status == common.ReadyToSend {
+		newID := store.getInstanceID()
+		metaData.InstanceID = newID
+		metaData.DataID = newID
+	} else {
+		metaData.InstanceID = object.meta.InstanceID
+		metaData.DataID = object.meta.DataID
+	}
+	if metaData.DestinationPolicy != nil {
+		metaData.DestinationPolicy.Timestamp = time.Now().UTC().UnixNano()
+	}
+	metaData.ObjectSize = int64(len(data))
+
+	object.meta = metaData
+	object.data = data
+	object.dataComplete = true
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	store.addAuditRecord(newAuditRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.AuditStore, object.status, identity))
+	return nil
+}
+
+// StoreObjectTempData stores an object's temporary data
+func (store *TestStorage) StoreObjectTempData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
+	data, err := ioutil.ReadAll(dataReader)
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Failed to read object data. Error: %s.", err)}
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.tmpData[createTempObjectCollectionID(orgID, objectType, objectID)] = data
+	return true, nil
+}
+
+// RemoveObjectTempData removes an object's temporary data
+func (store *TestStorage) RemoveObjectTempData(orgID string, objectType string, objectID string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.tmpData, createTempObjectCollectionID(orgID, objectType, objectID))
+	return nil
+}
+
+// RetrieveTempObjectData returns an object's temporary data
+func (store *TestStorage) RetrieveTempObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if data, ok := store.tmpData[createTempObjectCollectionID(orgID, objectType, objectID)]; ok {
+		return bytes.NewReader(data), nil
+	}
+	return nil, nil
+}
+
+// AppendObjectData appends a chunk of data to the object's data
+func (store *TestStorage) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32,
+	offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	if isFirstChunk {
+		if err := checkObjectSize(objectType, total); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	var err error
+	limiter := newObjectSizeLimiter(objectType, dataReader, offset)
+	if dataLength > 0 {
+		data = make([]byte, dataLength)
+		_, err = io.ReadFull(limiter, data)
+	} else {
+		data, err = ioutil.ReadAll(limiter)
+	}
+	if limiter.exceeded != nil {
+		store.discardObjectData(orgID, objectType, objectID)
+		return limiter.exceeded
+	}
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to read the data from the dataReader. Error: %s.", err)}
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := store.objects[id]
+	if !ok {
+		return notFound
+	}
+	if !isFirstChunk && object.data == nil {
+		return &Error{fmt.Sprintf("Failed to append the data at offset %d, the file %s doesn't exist.", offset, id)}
+	}
+
+	if total < offset+int64(len(data)) {
+		total = offset + int64(len(data))
+	}
+	if isFirstChunk {
+		object.data = make([]byte, 0, total)
+	} else {
+		object.data = ensureArrayCapacity(object.data, total)
+	}
+	if end := offset + int64(len(data)); end > int64(len(object.data)) {
+		object.data = object.data[:end]
+	}
+	copy(object.data[offset:], data)
+	object.dataComplete = isLastChunk
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+
+	if isLastChunk {
+		delete(store.uploads, id)
+	} else {
+		progress := store.uploads[id]
+		if isFirstChunk || progress == nil {
+			progress = newUploadProgress()
+			store.uploads[id] = progress
+		}
+		progress.chunkWritten(offset, int64(len(data)))
+	}
+	return nil
+}
+
+// AppendObjectDelta reconstructs the data of the object from its stored base data and a binary patch, and stores the result
+func (store *TestStorage) AppendObjectDelta(orgID string, objectType string, objectID string, baseDataID int64, patch io.Reader,
+	size int64, hash string) common.SyncServiceError {
+	return appendObjectDelta(store, orgID, objectType, objectID, baseDataID, patch, size, hash)
+}
+
+// discardObjectData removes the partially written data of an object
+func (store *TestStorage) discardObjectData(orgID string, objectType string, objectID string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		object.data = nil
+		object.lastUpdate = time.Now()
+		store.objects[id] = object
+	}
+	delete(store.uploads, id)
+}
+
+// UpdateObjectStatus updates an object's status
+func (store *TestStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string, identity string) common.SyncServiceError {
+	var oldStatus string
+	function := func(object *testObject) {
+		oldStatus = object.status
+		object.status = status
+		store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditUpdateStatus, status, identity))
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return &Error{fmt.Sprintf("Failed to update object's status. Error: %s.", err)}
+	}
+	notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+		OldStatus: oldStatus, NewStatus: status})
+	return nil
+}
+
+// PatchObjectMetadata updates the specified fields of the object's meta data
+func (store *TestStorage) PatchObjectMetadata(orgID string, objectType string, objectID string, patch map[string]interface{}) common.SyncServiceError {
+	fields, err := validateObjectMetadataPatch(patch)
+	if err != nil {
+		return err
+	}
+	function := func(object *testObject) {
+		applyObjectMetadataPatch(&object.meta, fields)
+	}
+	return store.updateObject(orgID, objectType, objectID, function)
+}
+
+// TouchObject extends the expiration time of an object that is being delivered
+func (store *TestStorage) TouchObject(orgID string, objectType string, objectID string, extendBy time.Duration) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := store.objects[id]
+	if !ok {
+		return notFound
+	}
+	expiration, err := touchObjectExpiration(object.status, object.meta, extendBy)
+	if err != nil || expiration == "" {
+		return err
+	}
+	object.meta.Expiration = expiration
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	return nil
+}
+
+// UpdateObjectSourceDataURI updates object's source data URI
+func (store *TestStorage) UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError {
+	function := func(object *testObject) {
+		object.meta.SourceDataURI = sourceDataURI
+	}
+	return store.updateObject(orgID, objectType, objectID, function)
+}
+
+// RetrieveObjectStatus finds the object and return its status
+func (store *TestStorage) RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		return object.status, nil
+	}
+	return "", nil
+}
+
+// RetrieveObjectRemainingConsumers finds the object and returns the number remaining consumers that
+// haven't consumed the object yet
+func (store *TestStorage) RetrieveObjectRemainingConsumers(orgID string, objectType string, objectID string) (int, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		return object.remainingConsumers, nil
+	}
+	return 0, &Error{fmt.Sprintf("Failed to retrieve object's remaining comsumers. Error: %s.", notFound)}
+}
+
+// DecrementAndReturnRemainingConsumers decrements the number of remaining consumers of the object
+func (store *TestStorage) DecrementAndReturnRemainingConsumers(orgID string, objectType string, objectID string) (int,
+	common.SyncServiceError) {
+	var remainingConsumers int
+	function := func(object *testObject) {
+		object.remainingConsumers--
+		remainingConsumers = object.remainingConsumers
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to decrement object's remaining consumers. Error: %s.", err)}
+	}
+	return remainingConsumers, nil
+}
+
+// DecrementAndReturnRemainingReceivers decrements the number of remaining receivers of the object
+func (store *TestStorage) DecrementAndReturnRemainingReceivers(orgID string, objectType string, objectID string) (int,
+	common.SyncServiceError) {
+	var remainingReceivers int
+	function := func(object *testObject) {
+		object.remainingReceivers--
+		remainingReceivers = object.remainingReceivers
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to decrement object's remaining receivers. Error: %s.", err)}
+	}
+	return remainingReceivers, nil
+}
+
+// ResetObjectRemainingConsumers sets the remaining consumers count to the original ExpectedConsumers value
+func (store *TestStorage) ResetObjectRemainingConsumers(orgID string, objectType string, objectID string) common.SyncServiceError {
+	function := func(object *testObject) {
+		object.remainingConsumers = object.meta.ExpectedConsumers
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return &Error{fmt.Sprintf("Failed to reset object's remaining comsumers. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveUpdatedObjects returns the list of all the edge updated objects that are not marked as consumed or received
+// If received is true, return objects marked as received
+func (store *TestStorage) RetrieveUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError) {
+	function := func(object testObject) bool {
+		return object.meta.DestOrgID == orgID && object.meta.ObjectType == objectType &&
+			(object.status == common.CompletelyReceived || object.status == common.ObjDeleted ||
+				(received && object.status == common.ObjReceived))
+	}
+	return store.retrieveMetaData(function), nil
+}
+
+// WatchObjects returns a channel of the creation, update, and deletion events of the objects of the organization.
+// It isn't supported by this storage.
+func (store *TestStorage) WatchObjects(orgID string) (<-chan common.ObjectEvent, func(), common.SyncServiceError) {
+	return nil, nil, &Error{"Watching objects is only supported by the MongoDB storage"}
+}
+
+// RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
+// If received is true, return objects marked as policy received
+func (store *TestStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	function := func(object testObject) bool {
+		return object.meta.DestOrgID == orgID && object.meta.DestinationPolicy != nil && object.status != common.ObjDeleted &&
+			(received || !object.policyReceived)
+	}
+	return store.retrievePolicies(function), nil
+}
+
+// RetrieveObjectsWithDestinationPolicyByService returns the list of all the object Policies for a particular service
+func (store *TestStorage) RetrieveObjectsWithDestinationPolicyByService(orgID, serviceOrgID, serviceName string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	function := func(object testObject) bool {
+		if object.meta.DestOrgID != orgID || object.meta.DestinationPolicy == nil {
+			return false
+		}
+		for _, service := range object.meta.DestinationPolicy.Services {
+			if service.OrgID == serviceOrgID && service.ServiceName == serviceName {
+				return true
+			}
+		}
+		return false
+	}
+	return store.retrievePolicies(function), nil
+}
+
+// RetrieveObjectsWithDestinationPolicyUpdatedSince returns the list of all the objects that have a Destination Policy updated since the specified time
+func (store *TestStorage) RetrieveObjectsWithDestinationPolicyUpdatedSince(orgID string, since int64) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	function := func(object testObject) bool {
+		return object.meta.DestOrgID == orgID && object.meta.DestinationPolicy != nil &&
+			object.meta.DestinationPolicy.Timestamp >= since
+	}
+	return store.retrievePolicies(function), nil
+}
+
+// RetrieveObjectsWithFilters returns the list of all the objects that meet the given conditions
+func (store *TestStorage) RetrieveObjectsWithFilters(orgID string, destinationPolicy *bool, dpServiceOrgID string, dpServiceName string, dpPropertyName string, since int64, objectType string, objectID string, destinationType string, destinationID string, noData *bool, expirationTimeBefore string) ([]common.MetaData, common.SyncServiceError) {
+	function := func(object testObject) bool {
+		meta := object.meta
+		if meta.DestOrgID != orgID {
+			return false
+		}
+
+		if destinationPolicy != nil {
+			if *destinationPolicy {
+				if meta.DestinationPolicy == nil || meta.DestinationPolicy.Timestamp < since {
+					return false
+				}
+				if dpServiceOrgID != "" && dpServiceName != "" {
+					found := false
+					for _, service := range meta.DestinationPolicy.Services {
+						if service.OrgID == dpServiceOrgID && service.ServiceName == dpServiceName {
+							found = true
+							break
+						}
+					}
+					if !found {
+						return false
+					}
+				}
+				if dpPropertyName != "" {
+					found := false
+					for _, property := range meta.DestinationPolicy.Properties {
+						if property.Name == dpPropertyName {
+							found = true
+							break
+						}
+					}
+					if !found {
+						return false
+					}
+				}
+			} else if meta.DestinationPolicy != nil {
+				return false
+			}
+		}
+
+		if objectType != "" {
+			if meta.ObjectType != objectType {
+				return false
+			}
+			if objectID != "" && meta.ObjectID != objectID {
+				return false
+			}
+		}
+
+		if destinationType != "" {
+			found := false
+			if destinationID == "" {
+				if meta.DestType == destinationType {
+					found = true
+				}
+				for _, dest := range meta.DestinationsList {
+					if strings.HasPrefix(dest, destinationType+":") {
+						found = true
+						break
+					}
+				}
+			} else {
+				if meta.DestType == destinationType && meta.DestID == destinationID {
+					found = true
+				}
+				for _, dest := range meta.DestinationsList {
+					if dest == destinationType+":"+destinationID {
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+
+		if noData != nil && meta.NoData != *noData {
+			return false
+		}
+
+		if expirationTimeBefore != "" && (meta.Expiration == "" || meta.Expiration > expirationTimeBefore) {
+			return false
+		}
+		return true
+	}
+	return store.retrieveMetaData(function), nil
+}
+
+// RetrieveAllObjects returns the list of all the objects of the specified type
+func (store *TestStorage) RetrieveAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	function := func(object testObject) bool {
+		return object.meta.DestOrgID == orgID && object.meta.ObjectType == objectType
+	}
+	return store.retrievePolicies(function), nil
+}
+
+// RetrieveObjectStatusCounts returns the number of objects of the organization in each status.
+// If objectType is empty, the objects of all types are counted.
+func (store *TestStorage) RetrieveObjectStatusCounts(orgID string, objectType string) (map[string]int, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	counts := make(map[string]int)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID && (objectType == "" || object.meta.ObjectType == objectType) {
+			counts[object.status]++
+		}
+	}
+	return counts, nil
+}
+
+// RetrieveStorageStatsByType returns the number of objects of the organization, the total declared size of their data,
+// and the total number of bytes used to store their data, per object type
+func (store *TestStorage) RetrieveStorageStatsByType(orgID string) (map[string]common.ObjectTypeStorageStats, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	stats := make(map[string]common.ObjectTypeStorageStats)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID != orgID {
+			continue
+		}
+		typeStats := stats[object.meta.ObjectType]
+		typeStats.ObjectType = object.meta.ObjectType
+		typeStats.ObjectCount++
+		typeStats.ObjectSize += object.meta.ObjectSize
+		typeStats.StoredDataSize += int64(len(object.data))
+		stats[object.meta.ObjectType] = typeStats
+	}
+	return stats, nil
+}
+
+// RetrieveObjectsWithMissingData returns the objects of the organization whose data should be in the storage but isn't
+func (store *TestStorage) RetrieveObjectsWithMissingData(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID && objectExpectsData(object.meta, object.status) && object.data == nil {
+			result = append(result, object.meta)
+		}
+	}
+	return result, nil
+}
+
+// RetrieveIncompleteObjects returns the objects of the organization that at least one of their destinations didn't consume
+func (store *TestStorage) RetrieveIncompleteObjects(orgID string, objectType string) ([]common.IncompleteObject, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.IncompleteObject, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID != orgID || (objectType != "" && object.meta.ObjectType != objectType) {
+			continue
+		}
+		if incomplete, ok := incompleteObject(object.meta, object.destinations); ok {
+			result = append(result, incomplete)
+		}
+	}
+	sortIncompleteObjects(result)
+	return result, nil
+}
+
+// RetrieveObjectsBySizeAndAge returns the objects of the organization whose data size is at least minSize bytes
+// and that weren't updated for at least the given duration. The objects are ordered by decreasing data size.
+func (store *TestStorage) RetrieveObjectsBySizeAndAge(orgID string, minSize int64, olderThan time.Duration) ([]common.MetaData,
+	common.SyncServiceError) {
+	before, err := objectsBySizeAndAgeLimit(minSize, olderThan)
+	if err != nil {
+		return nil, err
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID && object.meta.ObjectSize >= minSize && !object.lastUpdate.After(before) {
+			result = append(result, object.meta)
+		}
+	}
+	sortBySizeDescending(result)
+	return result, nil
+}
+
+// RetrieveObjectsApproachingDeadline returns the undelivered objects of the organization whose delivery deadline
+// is within the given duration from now, including objects that already missed their deadline.
+// The objects are ordered by their delivery deadline.
+func (store *TestStorage) RetrieveObjectsApproachingDeadline(orgID string, within time.Duration) ([]common.MetaData, common.SyncServiceError) {
+	limit, err := deliveryDeadlineLimit(within)
+	if err != nil {
+		return nil, err
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID && isObjectApproachingDeadline(object.meta, object.status, object.destinations, limit) {
+			result = append(result, object.meta)
+		}
+	}
+	sortByDeliveryDeadline(result)
+	return result, nil
+}
+
+// RetrieveObjectsAcrossOrgs retrieves up to limit objects of all the organizations that match the filter,
+// ordered by organization, object type, and object ID, skipping the first offset objects
+func (store *TestStorage) RetrieveObjectsAcrossOrgs(filter common.ObjectFilter, offset int, limit int) ([]common.MetaData, int, common.SyncServiceError) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, &common.InvalidRequest{Message: "Offset and limit must be non-negative numbers"}
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if objectMatchesFilter(object.meta, filter) {
+			result = append(result, object.meta)
+		}
+	}
+	return pageObjects(result, offset, limit), len(result), nil
+}
+
+// RetrieveObjects returns the list of all the objects that need to be sent to the destination.
+// Adds the new destination to the destinations lists of the relevant objects.
+func (store *TestStorage) RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError) {
+	objectTypePermitted, err := destinationObjectTypesFilter(store, orgID, destType)
+	if err != nil {
+		return nil, err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.updateDestinationLastConnected(orgID, destType, destID)
+
+	metaDatas := make([]common.MetaData, 0)
+	d, ok := store.destinations[createDestinationCollectionID(orgID, destType, destID)]
+	if !ok {
+		return metaDatas, nil
+	}
+	dest := d.destination
+
+	for id, object := range store.objects {
+		if object.meta.DestOrgID != orgID || object.meta.DestinationPolicy != nil ||
+			(object.status != common.ReadyToSend && object.status != common.NotReadyToSend) {
+			continue
+		}
+		if (object.meta.DestType != "" && object.meta.DestType != destType) ||
+			(object.meta.DestID != "" && object.meta.DestID != destID) || !objectTypePermitted(object.meta.ObjectType) {
+			continue
+		}
+
+		status := common.Pending
+		if object.status == common.ReadyToSend && !object.meta.Inactive {
+			status = common.Delivering
+			if deliveryLimitReached(len(metaDatas)) {
+				// Leave the object pending, it will be delivered when the destination's objects are retrieved again
+				status = common.Pending
+			}
+		}
+		needToUpdate := false
+		existingDestIndex := -1
+		for i, d := range object.destinations {
+			if d.Destination == dest {
+				existingDestIndex = i
+				break
+			}
+		}
+		if existingDestIndex != -1 {
+			d := object.destinations[existingDestIndex]
+			if status == common.Delivering &&
+				(resend == common.ResendAll || (resend == common.ResendDelivered && d.Status != common.Consumed) ||
+					(resend == common.ResendUndelivered && d.Status != common.Consumed && d.Status != common.Delivered)) {
+				metaDatas = append(metaDatas, object.meta)
+				setDeliveryStatus(&object.destinations[existingDestIndex], common.Delivering)
+				needToUpdate = true
+			}
+		} else {
+			if status == common.Delivering {
+				metaDatas = append(metaDatas, object.meta)
+			}
+			needToUpdate = true
+			d := common.StoreDestinationStatus{Destination: dest}
+			setDeliveryStatus(&d, status)
+			object.destinations = append(object.destinations, d)
+		}
+		if needToUpdate {
+			object.lastUpdate = time.Now()
+			store.objects[id] = object
+		}
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectsForDestType returns the objects of the organization that are broadcast to all the destinations of the type
+func (store *TestStorage) RetrieveObjectsForDestType(orgID string, destType string) ([]common.MetaData, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID && object.meta.Broadcast && object.meta.DestType == destType {
+			result = append(result, object.meta)
+		}
+	}
+	return result, nil
+}
+
+// RetrieveConsumedObjects returns all the consumed objects originated from this node
+// ESS only API
+func (store *TestStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveObject returns the object meta data with the specified parameters
+func (store *TestStorage) RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		return &object.meta, nil
+	}
+	return nil, nil
+}
+
+// RetrieveObjectsByIDs returns the meta data of the objects with the provided keys, in the order of the keys.
+// Objects that don't exist are omitted from the result.
+func (store *TestStorage) RetrieveObjectsByIDs(orgID string, keys []common.ObjectKey) ([]common.MetaData, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	metaDatas := make([]common.MetaData, 0, len(keys))
+	for _, key := range keys {
+		if object, ok := store.objects[createObjectCollectionID(orgID, key.ObjectType, key.ObjectID)]; ok {
+			metaDatas = append(metaDatas, object.meta)
+		}
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectMetadataBatch returns the meta data of the objects with the provided keys, in the order of the keys,
+// with only the requested fields set
+func (store *TestStorage) RetrieveObjectMetadataBatch(orgID string, keys []common.ObjectKey, fields []string) ([]common.MetaData,
+	common.SyncServiceError) {
+	return retrieveObjectMetadataBatch(store, orgID, keys, fields)
+}
+
+// RetrieveObjectInstanceID returns the instance ID of the stored object, or 0 if the object doesn't exist
+func (store *TestStorage) RetrieveObjectInstanceID(orgID string, objectType string, objectID string) (int64, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		return object.meta.InstanceID, nil
+	}
+	return 0, nil
+}
+
+// RetrieveObjectAndStatus returns the object meta data and status with the specified parameters
+func (store *TestStorage) RetrieveObjectAndStatus(orgID string, objectType string, objectID string) (*common.MetaData, string, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		object.meta.DataComplete = object.dataComplete
+		return &object.meta, object.status, nil
+	}
+	return nil, "", nil
+}
+
+// RetrieveObjectIfModifiedSince returns the object meta data and status if the object was modified after the given time
+func (store *TestStorage) RetrieveObjectIfModifiedSince(orgID string, objectType string, objectID string, since time.Time) (*common.MetaData, string, bool, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		if !object.lastUpdate.After(since) {
+			return nil, "", false, nil
+		}
+		return &object.meta, object.status, true, nil
+	}
+	return nil, "", true, nil
+}
+
+// RetrieveObjectData returns the object data with the specified parameters
+func (store *TestStorage) RetrieveObjectData(orgID string, objectType string, objectID string, identity string) (io.Reader, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]
+	if !ok || object.meta.NoData {
+		return nil, nil
+	}
+	if object.meta.SourceDataURI != "" {
+		dataReader, err := dataURI.GetData(object.meta.SourceDataURI)
+		if err != nil && common.IsNotFound(err) {
+			return nil, nil
+		}
+		if err == nil && dataAccessLogged(identity) {
+			store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, object.meta.ObjectSize))
+		}
+		return dataReader, err
+	}
+	if object.data != nil {
+		if dataAccessLogged(identity) {
+			store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, int64(len(object.data))))
+		}
+		return bytes.NewReader(object.data), nil
+	}
+	return nil, nil
+}
+
+// ReadObjectData returns the object data with the specified parameters
+func (store *TestStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64,
+	identity string) ([]byte, bool, int, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]
+	if ok && object.meta.NoData {
+		return make([]byte, 0), true, 0, nil
+	}
+	if ok && object.meta.SourceDataURI != "" {
+		data, eof, length, err := dataURI.GetDataChunk(object.meta.SourceDataURI, size, offset)
+		if err == nil && dataAccessLogged(identity) {
+			store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, int64(length)))
+		}
+		return data, eof, length, err
+	}
+	if !ok || object.data == nil {
+		return nil, true, 0, &common.NotFound{}
+	}
+
+	lod := int64(len(object.data))
+	if offset >= lod {
+		return make([]byte, 0), true, 0, nil
+	}
+	s := int64(size)
+	eof := false
+	if s >= lod-offset {
+		s = lod - offset
+		eof = true
+	}
+	b := make([]byte, s)
+	copy(b, object.data[offset:])
+	if dataAccessLogged(identity) {
+		store.addAuditRecord(newDataAccessRecord(orgID, objectType, objectID, identity, s))
+	}
+	return b, eof, int(s), nil
+}
+
+// ReadPartialObjectData returns the object data with the specified parameters while the data may still be uploaded.
+// During an upload of the data by AppendObjectData, only the data up to the committed offset of the upload is returned,
+// and eof is false until the upload completes. Otherwise it is the same as ReadObjectData.
+func (store *TestStorage) ReadPartialObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	store.lock.Lock()
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	progress, uploading := store.uploads[id]
+	if !uploading {
+		store.lock.Unlock()
+		return store.ReadObjectData(orgID, objectType, objectID, size, offset, "")
+	}
+	defer store.lock.Unlock()
+
+	s := committedReadSize(progress.committed, size, offset)
+	b := make([]byte, s)
+	copy(b, store.objects[id].data[offset:offset+s])
+	return b, false, int(s), nil
+}
+
+// CloseDataReader closes the data reader if necessary
+func (store *TestStorage) CloseDataReader(dataReader io.Reader) common.SyncServiceError {
+	if file, ok := dataReader.(*os.File); ok {
+		return file.Close()
+	}
+	if closer, ok := dataReader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// MarkObjectDeleted marks the object as deleted
+func (store *TestStorage) MarkObjectDeleted(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
+	var oldStatus string
+	function := func(object *testObject) {
+		oldStatus = object.status
+		if object.status != common.ObjDeleted {
+			object.previousStatus = object.status
+		}
+		object.status = common.ObjDeleted
+		object.meta.Deleted = true
+		store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditMarkDeleted, common.ObjDeleted, identity))
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return &Error{fmt.Sprintf("Failed to mark object as deleted. Error: %s.", err)}
+	}
+	notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+		OldStatus: oldStatus, NewStatus: common.ObjDeleted})
+	return nil
+}
+
+// RetrieveDeletedObjects returns the objects of the organization that were marked as deleted
+func (store *TestStorage) RetrieveDeletedObjects(orgID string) ([]common.MetaData, common.SyncServiceError) {
+	function := func(object testObject) bool {
+		return object.meta.DestOrgID == orgID && object.status == common.ObjDeleted
+	}
+	return store.retrieveMetaData(function), nil
+}
+
+// UndeleteObject restores an object marked as deleted to its status before the deletion
+// The object can be restored only if its data still exists
+func (store *TestStorage) UndeleteObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := store.objects[id]
+	if !ok {
+		return notFound
+	}
+	if err := checkObjectUndeletable(object.status, object.previousStatus); err != nil {
+		return err
+	}
+	if objectDataRequired(object.meta) && object.data == nil {
+		return objectDataMissing
+	}
+	object.status = object.previousStatus
+	object.previousStatus = ""
+	object.meta.Deleted = false
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	return nil
+}
+
+// MarkDestinationPolicyReceived marks an object's destination policy as having been received
+func (store *TestStorage) MarkDestinationPolicyReceived(orgID string, objectType string, objectID string) common.SyncServiceError {
+	function := func(object *testObject) {
+		object.policyReceived = true
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return &Error{fmt.Sprintf("Failed to mark an object's destination policy as received. Error: %s", err)}
+	}
+	return nil
+}
+
+// ActivateObject marks object as active
+func (store *TestStorage) ActivateObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	function := func(object *testObject) {
+		object.meta.Inactive = false
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return &Error{fmt.Sprintf("Failed to mark object as active. Error: %s.", err)}
+	}
+	return nil
+}
+
+// PinObject pins the object, so that it isn't deleted by AutoDelete or when it expires
+func (store *TestStorage) PinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.updateObject(orgID, objectType, objectID, func(object *testObject) {
+		object.meta.Pinned = true
+	})
+}
+
+// UnpinObject unpins the object, so that AutoDelete and its expiration apply to it again
+func (store *TestStorage) UnpinObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.updateObject(orgID, objectType, objectID, func(object *testObject) {
+		object.meta.Pinned = false
+	})
+}
+
+// GetObjectsToActivate returns inactive objects that are ready to be activated
+func (store *TestStorage) GetObjectsToActivate() ([]common.MetaData, common.SyncServiceError) {
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	function := func(object testObject) bool {
+		return (object.status == common.NotReadyToSend || object.status == common.ReadyToSend) &&
+			object.meta.Inactive && object.meta.ActivationTime != "" && object.meta.ActivationTime <= currentTime
+	}
+	return store.retrieveMetaData(function), nil
+}
+
+// DeleteStoredObject deletes the object
+func (store *TestStorage) DeleteStoredObject(orgID string, objectType string, objectID string, identity string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.objects, createObjectCollectionID(orgID, objectType, objectID))
+	store.addAuditRecord(newAuditRecord(orgID, objectType, objectID, common.AuditDelete, "", identity))
+	return nil
+}
+
+// DeleteObjectsOfType deletes all the objects of the type in the organization and their data
+func (store *TestStorage) DeleteObjectsOfType(orgID string, objectType string) (int, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	deleted := 0
+	for id, object := range store.objects {
+		if object.meta.DestOrgID == orgID && object.meta.ObjectType == objectType {
+			delete(store.objects, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// RetrieveAuditLog returns the audit log of the object's mutations, ordered by time
+func (store *TestStorage) RetrieveAuditLog(orgID string, objectType string, objectID string) ([]common.AuditRecord, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	records := store.audit[createObjectCollectionID(orgID, objectType, objectID)]
+	result := make([]common.AuditRecord, len(records))
+	copy(result, records)
+	return result, nil
+}
+
+// PurgeAuditLog deletes the audit records older than olderThan
+func (store *TestStorage) PurgeAuditLog(olderThan time.Duration) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	store.deleteAuditRecords(func(record common.AuditRecord) bool {
+		return record.Timestamp.Before(cutoff)
+	})
+	return nil
+}
+
+// RetrieveObjectVersions returns the meta data of the kept previous versions of the object, ordered by instance ID
+func (store *TestStorage) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.MetaData, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.MetaData, 0)
+	for _, version := range store.objectVersions {
+		if version.meta.DestOrgID == orgID && version.meta.ObjectType == objectType && version.meta.ObjectID == objectID {
+			result = append(result, version.meta)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].InstanceID < result[j].InstanceID })
+	return result, nil
+}
+
+// RetrieveObjectVersion returns the meta data and the data of a kept previous version of the object
+func (store *TestStorage) RetrieveObjectVersion(orgID string, objectType string, objectID string, instanceID int64) (*common.MetaData, io.Reader, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	version, ok := store.objectVersions[createObjectVersionCollectionID(orgID, objectType, objectID, instanceID)]
+	if !ok {
+		return nil, nil, nil
+	}
+	if version.data == nil {
+		return &version.meta, nil, nil
+	}
+	return &version.meta, bytes.NewReader(version.data), nil
+}
+
+// IsIdempotencyKeyRecorded returns true if the idempotency key was recorded for an update of the object
+// within the last IdempotencyKeyWindow seconds
+func (store *TestStorage) IsIdempotencyKeyRecorded(orgID string, objectType string, objectID string, key string) (bool, common.SyncServiceError) {
+	if common.Configuration.IdempotencyKeyWindow <= 0 {
+		return false, nil
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	recorded, ok := store.idempotencyKeys[createIdempotencyKeyID(orgID, objectType, objectID, key)]
+	return ok && !idempotencyKeyExpired(recorded), nil
+}
+
+// RecordIdempotencyKey records the idempotency key of a successful update of the object
+func (store *TestStorage) RecordIdempotencyKey(orgID string, objectType string, objectID string, key string) common.SyncServiceError {
+	if common.Configuration.IdempotencyKeyWindow <= 0 {
+		return nil
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for id, recorded := range store.idempotencyKeys {
+		if idempotencyKeyExpired(recorded) {
+			delete(store.idempotencyKeys, id)
+		}
+	}
+	store.idempotencyKeys[createIdempotencyKeyID(orgID, objectType, objectID, key)] = time.Now()
+	return nil
+}
+
+// DeleteStoredData deletes the object's data
+func (store *TestStorage) DeleteStoredData(orgID string, objectType string, objectID string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		object.data = nil
+		object.dataComplete = false
+		object.lastUpdate = time.Now()
+		store.objects[id] = object
+	}
+	return nil
+}
+
+// CleanObjects removes the objects received from the other side.
+// For persistant storage only partially recieved objects are removed.
+func (store *TestStorage) CleanObjects() common.SyncServiceError {
+	// ESS only function
+	return nil
+}
+
+// GetObjectDestinations gets destinations that the object has to be sent to
+func (store *TestStorage) GetObjectDestinations(metaData common.MetaData) ([]common.Destination, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	object, ok := store.objects[getObjectCollectionID(metaData)]
+	if !ok {
+		return nil, nil
+	}
+	dests := make([]common.Destination, 0)
+	for _, d := range object.destinations {
+		dests = append(dests, d.Destination)
+	}
+	return dests, nil
+}
+
+// UpdateObjectDeliveryStatus changes the object's delivery status and message for the destination
+// Returns true if the status is Deleted and all the destinations are in status Deleted
+func (store *TestStorage) UpdateObjectDeliveryStatus(status string, message string, orgID string, objectType string, objectID string,
+	destType string, destID string) (bool, common.SyncServiceError) {
+	if status == "" && message == "" {
+		return false, nil
+	}
+
+	allDeleted, oldStatus, err := store.updateObjectDeliveryStatus(status, message, orgID, objectType, objectID, destType, destID)
+	if err == nil && status != "" {
+		notifyObjectStatusChange(ObjectStatusChange{OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+			DestType: destType, DestID: destID, OldStatus: oldStatus, NewStatus: status})
+	}
+	return allDeleted, err
+}
+
+// updateObjectDeliveryStatus changes the object's delivery status and message for the destination under the store's lock
+// Returns true if the status is Deleted and all the destinations are in status Deleted, and the previous delivery status
+func (store *TestStorage) updateObjectDeliveryStatus(status string, message string, orgID string, objectType string, objectID string,
+	destType string, destID string) (bool, string, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := store.objects[id]
+	if !ok {
+		return false, "", &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", notFound)}
+	}
+
+	found := false
+	oldStatus := ""
+	allConsumed := true
+	allDeleted := true
+	dests := make([]common.StoreDestinationStatus, len(object.destinations))
+	copy(dests, object.destinations)
+	for i, d := range dests {
+		if !found && d.Destination.DestType == destType && d.Destination.DestID == destID {
+			oldStatus = d.Status
+			if message != "" || d.Status == common.Error {
+				dests[i].Message = message
+			}
+			if status != "" {
+				setDeliveryStatus(&dests[i], status)
+			}
+			found = true
+		} else {
+			if d.Status != common.Consumed {
+				allConsumed = false
+			}
+			if d.Status != common.Deleted {
+				allDeleted = false
+			}
+		}
+	}
+	if !found {
+		return false, "", &Error{"Failed to find destination."}
+	}
+
+	object.destinations = dests
+	if object.meta.AutoDelete && !object.meta.Pinned && status == common.Consumed && allConsumed && object.meta.Expiration == "" {
+		// Delete the object by setting its expiration time to one hour
+		object.meta.Expiration = time.Now().Add(time.Hour * time.Duration(1)).UTC().Format(time.RFC3339)
+	}
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	return (allDeleted && status == common.Deleted), oldStatus, nil
+}
+
+// UpdateObjectDelivering marks the object as being delivered to all its destinations
+func (store *TestStorage) UpdateObjectDelivering(orgID string, objectType string, objectID string) common.SyncServiceError {
+	function := func(object *testObject) {
+		dests := make([]common.StoreDestinationStatus, len(object.destinations))
+		for i, d := range object.destinations {
+			setDeliveryStatus(&d, common.Delivering)
+			dests[i] = d
+		}
+		object.destinations = dests
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
+	}
+	return nil
+}
+
+// GetObjectDestinationsList gets destinations that the object has to be sent to and their status
+func (store *TestStorage) GetObjectDestinationsList(orgID string, objectType string,
+	objectID string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	object, ok := store.objects[createObjectCollectionID(orgID, objectType, objectID)]
+	if !ok {
+		return nil, nil
+	}
+	return copyDestinationsStatus(object.destinations), nil
+}
+
+// UpdateObjectDestinations updates object's destinations
+// Returns the meta data, object's status, an array of deleted destinations, and an array of added destinations
+func (store *TestStorage) UpdateObjectDestinations(orgID string, objectType string, objectID string, destinationsList []string) (*common.MetaData, string,
+	[]common.StoreDestinationStatus, []common.StoreDestinationStatus, common.SyncServiceError) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+
+	store.lock.Lock()
+	object, ok := store.objects[id]
+	store.lock.Unlock()
+	if !ok {
+		return nil, "", nil, nil, &Error{fmt.Sprintf("Failed to retrieve object's destinations. Error: %s.", notFound)}
+	}
+
+	// createDestinations retrieves the destinations from the store, therefore it is called without holding the lock
+	dests, deletedDests, addedDests, err := createDestinations(orgID, store, copyDestinationsStatus(object.destinations), destinationsList)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+
+	function := func(object *testObject) {
+		object.destinations = dests
+	}
+	if err := store.updateObject(orgID, objectType, objectID, function); err != nil {
+		return nil, "", nil, nil, &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
+	}
+	return &object.meta, object.status, deletedDests, addedDests, nil
+}
+
+// GetNumberOfStoredObjects returns the number of objects received from the application that are
+// currently stored in this node's storage
+func (store *TestStorage) GetNumberOfStoredObjects() (uint32, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	var count uint32
+	for _, object := range store.objects {
+		if object.status == common.ReadyToSend || object.status == common.NotReadyToSend {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// AddWebhook stores a webhook for an object type
+func (store *TestStorage) AddWebhook(orgID string, objectType string, url string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createWebhookID(orgID, objectType)
+	hooks := store.webhooks[id]
+	// Don't add the webhook if it already is in the list
+	for _, hook := range hooks {
+		if url == hook {
+			return nil
+		}
+	}
+	store.webhooks[id] = append(hooks, url)
+	return nil
+}
+
+// DeleteWebhook deletes a webhook for an object type
+func (store *TestStorage) DeleteWebhook(orgID string, objectType string, url string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createWebhookID(orgID, objectType)
+	hooks, ok := store.webhooks[id]
+	if !ok {
+		return &Error{fmt.Sprintf("Failed to delete a webhook. Error: %s.", notFound)}
+	}
+	for i, hook := range hooks {
+		if strings.EqualFold(hook, url) {
+			hooks[i] = hooks[len(hooks)-1]
+			store.webhooks[id] = hooks[:len(hooks)-1]
+			return nil
+		}
+	}
+	return nil
+}
+
+// RetrieveWebhooks gets the webhooks for the object type
+func (store *TestStorage) RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	hooks := store.webhooks[createWebhookID(orgID, objectType)]
+	if len(hooks) == 0 {
+		return nil, &NotFound{"No webhooks"}
+	}
+	result := make([]string, len(hooks))
+	copy(result, hooks)
+	return result, nil
+}
+
+// StoreWebhookRetryPolicy stores the webhook retry policy of an object type, replacing the existing policy of the type
+func (store *TestStorage) StoreWebhookRetryPolicy(policy common.WebhookRetryPolicy) common.SyncServiceError {
+	if err := validateWebhookRetryPolicy(policy); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.webhookPolicies[common.CreateCompositeID(policy.OrgID, policy.ObjectType)] = policy
+	return nil
+}
+
+// RetrieveWebhookRetryPolicy retrieves the webhook retry policy of an object type, returns nil if the type doesn't have a policy
+func (store *TestStorage) RetrieveWebhookRetryPolicy(orgID string, objectType string) (*common.WebhookRetryPolicy, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	policy, ok := store.webhookPolicies[common.CreateCompositeID(orgID, objectType)]
+	if !ok {
+		return nil, nil
+	}
+	return &policy, nil
+}
+
+// DeleteWebhookRetryPolicy deletes the webhook retry policy of an object type
+func (store *TestStorage) DeleteWebhookRetryPolicy(orgID string, objectType string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.webhookPolicies, common.CreateCompositeID(orgID, objectType))
+	return nil
+}
+
+// StoreWebhookFailure records the failure of a webhook, replacing the previous failure of the webhook
+func (store *TestStorage) StoreWebhookFailure(failure common.WebhookFailure) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.webhookFailures[webhookFailureID(failure.OrgID, failure.ObjectType, failure.URL)] = failure
+	return nil
+}
+
+// RetrieveWebhookFailures retrieves the recorded webhook failures of an organization
+func (store *TestStorage) RetrieveWebhookFailures(orgID string) ([]common.WebhookFailure, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	failures := make([]common.WebhookFailure, 0)
+	for _, failure := range store.webhookFailures {
+		if failure.OrgID == orgID {
+			failures = append(failures, failure)
+		}
+	}
+	return failures, nil
+}
+
+// DeleteWebhookFailures deletes the recorded webhook failures of an object type,
+// or of all the object types of the organization if objectType is empty
+func (store *TestStorage) DeleteWebhookFailures(orgID string, objectType string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for id, failure := range store.webhookFailures {
+		if failure.OrgID == orgID && (objectType == "" || failure.ObjectType == objectType) {
+			delete(store.webhookFailures, id)
+		}
+	}
+	return nil
+}
+
+// RetrieveDestinations returns all the destinations with the provided orgID and destType
+func (store *TestStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	dests := make([]common.Destination, 0)
+	for _, d := range store.destinations {
+		if (orgID == "" || orgID == d.destination.DestOrgID) && (destType == "" || destType == d.destination.DestType) {
+			dests = append(dests, d.destination)
+		}
+	}
+	return dests, nil
+}
+
+// DestinationExists returns true if the destination exists, and false otherwise
+func (store *TestStorage) DestinationExists(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	_, ok := store.destinations[createDestinationCollectionID(orgID, destType, destID)]
+	return ok, nil
+}
+
+// DestinationsExist returns a map indicating for each of the provided destinations whether it exists
+func (store *TestStorage) DestinationsExist(orgID string, dests []common.DestinationID) (map[common.DestinationID]bool, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	exist := make(map[common.DestinationID]bool, len(dests))
+	orgID, normalized := normalizeDestinationIDs(orgID, dests)
+	for i, dest := range dests {
+		_, exist[dest] = store.destinations[createDestinationCollectionID(orgID, normalized[i].DestType, normalized[i].DestID)]
+	}
+	return exist, nil
+}
+
+// RetrieveDestination retrieves a destination
+func (store *TestStorage) RetrieveDestination(orgID string, destType string, destID string) (*common.Destination, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if d, ok := store.destinations[createDestinationCollectionID(orgID, destType, destID)]; ok {
+		return &d.destination, nil
+	}
+	return nil, &NotFound{fmt.Sprintf(" The destination %s:%s does not exist", destType, destID)}
+}
+
+// StoreDestination stores the destination
+func (store *TestStorage) StoreDestination(destination common.Destination) common.SyncServiceError {
+	destination.Normalize()
+	if err := destination.Validate(); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.destinations[getDestinationCollectionID(destination)] = testDestination{destination: destination, lastPingTime: time.Now(),
+		lastConnected: time.Now()}
+	return nil
+}
+
+// StoreDestinations stores the destinations, the returned errors correspond to the destinations
+func (store *TestStorage) StoreDestinations(dests []common.Destination) ([]common.SyncServiceError, common.SyncServiceError) {
+	errs := make([]common.SyncServiceError, len(dests))
+	for i, destination := range dests {
+		errs[i] = store.StoreDestination(destination)
+	}
+	return errs, nil
+}
+
+// RegisterDestination stores the destination when it registers or sends a heartbeat, and records the current time
+// as the destination's last ping and connection times
+func (store *TestStorage) RegisterDestination(destination common.Destination) common.SyncServiceError {
+	return store.StoreDestination(destination)
+}
+
+// DeleteDestination deletes the destination
+func (store *TestStorage) DeleteDestination(orgID string, destType string, destID string) common.SyncServiceError {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.destinations, createDestinationCollectionID(orgID, destType, destID))
+	return nil
+}
+
+// DecommissionDestination removes the destination from the destinations lists of all the objects,
+// and deletes its notifications and the destination itself
+func (store *TestStorage) DecommissionDestination(orgID string, destType string, destID string) (*common.DecommissionedDestination, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := &common.DecommissionedDestination{}
+	for id, object := range store.objects {
+		if object.meta.DestOrgID != orgID {
+			continue
+		}
+		dests := make([]common.StoreDestinationStatus, 0, len(object.destinations))
+		for _, d := range object.destinations {
+			if d.Destination.DestOrgID != orgID || d.Destination.DestType != destType || d.Destination.DestID != destID {
+				dests = append(dests, d)
+			}
+		}
+		if len(dests) != len(object.destinations) {
+			object.destinations = dests
+			object.lastUpdate = time.Now()
+			store.objects[id] = object
+			result.ObjectsUpdated++
+		}
+	}
+
+	store.deleteNotifications(func(n common.Notification) bool {
+		if n.DestOrgID == orgID && n.DestType == destType && n.DestID == destID {
+			result.NotificationsDeleted++
+			return true
+		}
+		return false
+	})
+
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if _, ok := store.destinations[id]; ok {
+		delete(store.destinations, id)
+		result.DestinationDeleted = true
+	}
+	return result, nil
+}
+
+// UpdateDestinationLastPingTime updates the last ping time for the destination
+func (store *TestStorage) UpdateDestinationLastPingTime(destination common.Destination) common.SyncServiceError {
+	destination.Normalize()
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := getDestinationCollectionID(destination)
+	d, ok := store.destinations[id]
+	if !ok {
+		return &NotFound{}
+	}
+	d.lastPingTime = time.Now()
+	store.destinations[id] = d
+	return nil
+}
+
+// RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
+func (store *TestStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for id, d := range store.destinations {
+		if d.lastPingTime.After(lastTimestamp) {
+			continue
+		}
+		dest := d.destination
+		store.deleteNotifications(func(n common.Notification) bool {
+			return n.DestOrgID == dest.DestOrgID && n.DestType == dest.DestType && n.DestID == dest.DestID
+		})
+		delete(store.destinations, id)
+	}
+}
+
+// updateDestinationLastConnected records that the destination has just connected, the lock must be held by the caller
+func (store *TestStorage) updateDestinationLastConnected(orgID string, destType string, destID string) {
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if d, ok := store.destinations[id]; ok {
+		d.lastConnected = time.Now()
+		store.destinations[id] = d
+	}
+}
+
+// RetrieveOfflineDestinations returns the destinations of the organization that haven't connected for the provided duration
+func (store *TestStorage) RetrieveOfflineDestinations(orgID string, idleFor time.Duration) ([]common.Destination, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.Destination, 0)
+	cutoff := time.Now().Add(-idleFor)
+	for _, d := range store.destinations {
+		if d.destination.DestOrgID == orgID && d.lastConnected.Before(cutoff) {
+			destination := d.destination
+			destination.LastConnected = d.lastConnected
+			result = append(result, destination)
+		}
+	}
+	return result, nil
+}
+
+// GetNumberOfDestinations returns the number of currently registered ESS nodes (for CSS)
+func (store *TestStorage) GetNumberOfDestinations() (uint32, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return uint32(len(store.destinations)), nil
+}
+
+// RetrieveDestinationProtocol retrieves the communication protocol for the destination
+func (store *TestStorage) RetrieveDestinationProtocol(orgID string, destType string, destID string) (string, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if d, ok := store.destinations[createDestinationCollectionID(orgID, destType, destID)]; ok {
+		return d.destination.Communication, nil
+	}
+	return "", &Error{fmt.Sprintf("Failed to fetch the destination. Error: %s.", notFound)}
+}
+
+// GetObjectsForDestination retrieves objects that are in use on a given node
+func (store *TestStorage) GetObjectsForDestination(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	objectStatuses := make([]common.ObjectStatus, 0)
+	for _, n := range store.notifications {
+		if n.DestOrgID != orgID || n.DestType != destType || n.DestID != destID {
+			continue
+		}
+		var status string
+		switch n.Status {
+		case common.Update, common.UpdatePending, common.Updated:
+			status = common.Delivering
+		case common.ReceivedByDestination:
+			status = common.Delivered
+		case common.ConsumedByDestination:
+			status = common.Consumed
+		case common.Error:
+			status = common.Error
+		default:
+			continue
+		}
+		objectStatuses = append(objectStatuses, common.ObjectStatus{OrgID: orgID, ObjectType: n.ObjectType, ObjectID: n.ObjectID, Status: status})
+	}
+	return objectStatuses, nil
+}
+
+// RetrieveObjectsForDestination retrieves the meta data and status of the objects that are in use on a given node.
+// If status is not empty, only objects with the given status are returned.
+func (store *TestStorage) RetrieveObjectsForDestination(orgID string, destType string, destID string, status string) ([]common.ObjectStatusWithMetaData, common.SyncServiceError) {
+	orgID, destType, destID = normalizeDestinationID(orgID, destType, destID)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.ObjectStatusWithMetaData, 0)
+	for _, n := range store.notifications {
+		if n.DestOrgID != orgID || n.DestType != destType || n.DestID != destID {
+			continue
+		}
+		objectStatus := destinationObjectStatus(n.Status)
+		if objectStatus == "" || (status != "" && objectStatus != status) {
+			continue
+		}
+		if object, ok := store.objects[createObjectCollectionID(orgID, n.ObjectType, n.ObjectID)]; ok {
+			result = append(result, common.ObjectStatusWithMetaData{MetaData: object.meta, Status: objectStatus})
+		}
+	}
+	return result, nil
+}
+
+// RetrieveAllObjectsAndUpdateDestinationListForDestination retrieves objects that are in use on a given node and the destination status
+func (store *TestStorage) RetrieveAllObjectsAndUpdateDestinationListForDestination(destOrgID string, destType string, destID string) ([]common.MetaData, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	metaDatas := make([]common.MetaData, 0)
+	for id, object := range store.objects {
+		found := false
+		updatedDestinationList := make([]common.StoreDestinationStatus, 0)
+		for _, dest := range object.destinations {
+			if dest.Destination.DestOrgID == destOrgID && dest.Destination.DestType == destType && dest.Destination.DestID == destID {
+				found = true
+			} else {
+				updatedDestinationList = append(updatedDestinationList, dest)
+			}
+		}
+		if found {
+			metaDatas = append(metaDatas, object.meta)
+			object.destinations = updatedDestinationList
+			object.lastUpdate = time.Now()
+			store.objects[id] = object
+		}
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectAndRemovedDestinationPolicyServices returns the object metadata and removedDestinationPolicyServices with the specified param, only for ESS
+func (store *TestStorage) RetrieveObjectAndRemovedDestinationPolicyServices(orgID string, objectType string, objectID string) (*common.MetaData, []common.ServiceID, common.SyncServiceError) {
+	removedDestinationPolicyServices := []common.ServiceID{}
+	return nil, removedDestinationPolicyServices, nil
+}
+
+// UpdateRemovedDestinationPolicyServices update the removedDestinationPolicyServices, only for ESS
+func (store *TestStorage) UpdateRemovedDestinationPolicyServices(orgID string, objectType string, objectID string, destinationPolicyServices []common.ServiceID) common.SyncServiceError {
+	return nil
+}
+
+// UpdateNotificationRecord updates/adds a notification record to the object
+func (store *TestStorage) UpdateNotificationRecord(notification common.Notification) common.SyncServiceError {
+	notification.LastUpdate = time.Now().Unix()
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.storeNotification(notification)
+	return nil
+}
+
+// UpdateNotificationRecords updates/adds the notification records, for example the notifications of an object
+// to all its destinations, in as few writes as the storage allows
+func (store *TestStorage) UpdateNotificationRecords(notifications []common.Notification) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, notification := range notifications {
+		notification.LastUpdate = time.Now().Unix()
+		store.storeNotification(notification)
+	}
+	return nil
+}
+
+// storeNotification stores the notification, keeping the resend schedule of an identical stored notification.
+// Must be called with the store's lock held.
+func (store *TestStorage) storeNotification(notification common.Notification) {
+	id := getNotificationCollectionID(&notification)
+	if existing, ok := store.notifications[id]; ok {
+		scheduleNotificationResend(&notification, &existing)
+	} else {
+		scheduleNotificationResend(&notification, nil)
+	}
+	store.notifications[id] = notification
+}
+
+// UpdateNotificationResendTime increments the resend attempts of the notification and sets its resend time
+// according to the number of attempts (see common.GetNotificationResendInterval)
+func (store *TestStorage) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := getNotificationCollectionID(&notification)
+	n, ok := store.notifications[id]
+	if !ok {
+		return &Error{fmt.Sprintf("Failed to update notification resend time. Error: %s.", notFound)}
+	}
+	n.ResendAttempts++
+	n.ResendTime = time.Now().Unix() + common.GetNotificationResendInterval(n.ResendAttempts)
+	store.notifications[id] = n
+	return nil
+}
+
+// RetrieveNotificationRecord retrieves notification
+func (store *TestStorage) RetrieveNotificationRecord(orgID string, objectType string, objectID string, destType string,
+	destID string) (*common.Notification, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if n, ok := store.notifications[createNotificationCollectionID(orgID, objectType, objectID, destType, destID)]; ok {
+		return &n, nil
+	}
+	return nil, nil
+}
+
+// DeleteNotificationRecords deletes notification records to an object
+func (store *TestStorage) DeleteNotificationRecords(orgID string, objectType string, objectID string, destType string, destID string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if objectType != "" && objectID != "" {
+		if destType != "" && destID != "" {
+			delete(store.notifications, createNotificationCollectionID(orgID, objectType, objectID, destType, destID))
+			return nil
+		}
+		store.deleteNotifications(func(n common.Notification) bool {
+			return n.DestOrgID == orgID && n.ObjectType == objectType && n.ObjectID == objectID
+		})
+		return nil
+	}
+	store.deleteNotifications(func(n common.Notification) bool {
+		return n.DestOrgID == orgID && n.DestType == destType && n.DestID == destID
+	})
+	return nil
+}
+
+// PurgeCompletedNotifications deletes the notifications in a completed state that weren't updated for longer than olderThan
+func (store *TestStorage) PurgeCompletedNotifications(orgID string, olderThan time.Duration) (int, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.purgeCompletedNotifications(orgID, olderThan), nil
+}
+
+// purgeCompletedNotifications deletes the completed notifications, the caller must hold the store's lock
+func (store *TestStorage) purgeCompletedNotifications(orgID string, olderThan time.Duration) int {
+	cutoff := time.Now().Add(-olderThan).Unix()
+	purged := 0
+	store.deleteNotifications(func(n common.Notification) bool {
+		if isPurgeableNotification(n, orgID, cutoff) {
+			purged++
+			return true
+		}
+		return false
+	})
+	return purged
+}
+
+// RetrieveNotifications returns the list of all the notifications that need to be resent to the destination
+func (store *TestStorage) RetrieveNotifications(orgID string, destType string, destID string, retrieveReceived bool) ([]common.Notification, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.Notification, 0)
+	if destType == "" && destID == "" {
+		currentTime := time.Now().Unix()
+		for _, n := range store.notifications {
+			if n.Status == common.Getdata || (n.ResendTime <= currentTime && resendNotification(n, false)) {
+				result = append(result, n)
+			}
+		}
+		return result, nil
+	}
+
+	store.updateDestinationLastConnected(orgID, destType, destID)
+
+	for _, n := range store.notifications {
+		if n.DestOrgID == orgID && n.DestType == destType && n.DestID == destID && resendNotification(n, retrieveReceived) {
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+// RetrievePendingNotifications returns the list of pending notifications that are waiting to be sent to the destination
+func (store *TestStorage) RetrievePendingNotifications(orgID string, destType string, destID string) ([]common.Notification, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]common.Notification, 0)
+	for _, n := range store.notifications {
+		if n.DestOrgID != orgID || ((destType != "" || destID != "") && (n.DestType != destType || n.DestID != destID)) {
+			continue
+		}
+		if n.Status == common.UpdatePending || n.Status == common.ConsumedPending ||
+			n.Status == common.DeletePending || n.Status == common.DeletedPending {
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+// InsertInitialLeader inserts the initial leader document if the collection is empty
+func (store *TestStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.leader != nil {
+		return false, nil
+	}
+	store.leader = &testLeader{uuid: leaderID, lastHeartbeat: time.Now(), heartbeatTimeout: common.Configuration.LeadershipTimeout, version: 1,
+		priority: common.LeaderPriority()}
+	return true, nil
+}
+
+// LeaderPeriodicUpdate does the periodic update of the leader document by the leader
+func (store *TestStorage) LeaderPeriodicUpdate(leaderID string) (bool, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.leader == nil || store.leader.uuid != leaderID || store.leader.handoffRequestedBy != "" {
+		return false, nil
+	}
+	store.leader.lastHeartbeat = time.Now()
+	return true, nil
+}
+
+// RetrieveLeader retrieves the Heartbeat timeout and Last heartbeat time stamp from the leader document
+func (store *TestStorage) RetrieveLeader() (string, int32, time.Time, int64, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.leader == nil {
+		return "", 0, time.Now(), 0, &NotFound{}
+	}
+	return store.leader.uuid, store.leader.heartbeatTimeout, store.leader.lastHeartbeat, store.leader.version, nil
+}
+
+// UpdateLeader updates the leader entry for a leadership takeover
+func (store *TestStorage) UpdateLeader(leaderID string, version int64) (bool, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.leader == nil || store.leader.version != version {
+		return false, nil
+	}
+	store.leader = &testLeader{uuid: leaderID, lastHeartbeat: time.Now(), heartbeatTimeout: common.Configuration.LeadershipTimeout,
+		version: version + 1, priority: common.LeaderPriority()}
+	return true, nil
+}
+
+// RequestLeaderHandoff asks the leader to hand off the leadership, if its priority is lower than this node's priority
+func (store *TestStorage) RequestLeaderHandoff(leaderID string, version int64) (bool, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	priority := common.LeaderPriority()
+	if store.leader == nil || store.leader.version != version || store.leader.uuid == leaderID ||
+		store.leader.priority >= priority || store.leader.handoffRequestedBy != "" {
+		return false, nil
+	}
+	store.leader.handoffRequestedBy = leaderID
+	return true, nil
+}
+
+// ResignLeadership causes this sync service to give up the Leadership
+func (store *TestStorage) ResignLeadership(leaderID string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.leader != nil && store.leader.uuid == leaderID {
+		store.leader.lastHeartbeat = time.Date(1970, 1, 1, 0, 0, 1, 0, time.UTC)
+	}
+	return nil
+}
+
+// RetrieveTimeOnServer retrieves the current time on the database server
+func (store *TestStorage) RetrieveTimeOnServer() (time.Time, error) {
+	return time.Now(), nil
+}
+
+// IsLeaderAlive returns true if the leader's last heartbeat is within its heartbeat timeout, together with the leader's ID
+func (store *TestStorage) IsLeaderAlive() (bool, string, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.leader == nil {
+		return false, "", &NotFound{}
+	}
+	return !leaderHeartbeatExpired(store.leader.lastHeartbeat, time.Now(), store.leader.heartbeatTimeout), store.leader.uuid, nil
+}
+
+// StoreOrgToMessagingGroup inserts organization to messaging groups table
+func (store *TestStorage) StoreOrgToMessagingGroup(orgID string, messagingGroup string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.messagingGroups[orgID] = testMessagingGroup{groupName: messagingGroup, lastUpdate: time.Now()}
+	return nil
+}
+
+// DeleteOrgToMessagingGroup deletes organization from messaging groups table
+func (store *TestStorage) DeleteOrgToMessagingGroup(orgID string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.messagingGroups, orgID)
+	return nil
+}
+
+// RetrieveMessagingGroup retrieves messaging group for organization
+func (store *TestStorage) RetrieveMessagingGroup(orgID string) (string, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.messagingGroups[orgID].groupName, nil
+}
+
+// RetrieveUpdatedMessagingGroups retrieves messaging groups that were updated after the specified time
+func (store *TestStorage) RetrieveUpdatedMessagingGroups(time time.Time) ([]common.MessagingGroup, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	groups := make([]common.MessagingGroup, 0)
+	for orgID, group := range store.messagingGroups {
+		if !group.lastUpdate.Before(time) {
+			groups = append(groups, common.MessagingGroup{OrgID: orgID, GroupName: group.groupName})
+		}
+	}
+	return groups, nil
+}
+
+// RetrieveDestinationsInMessagingGroup returns all the destinations of the organizations in the messaging group
+func (store *TestStorage) RetrieveDestinationsInMessagingGroup(groupName string) ([]common.Destination, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	dests := make([]common.Destination, 0)
+	for _, d := range store.destinations {
+		if group, ok := store.messagingGroups[d.destination.DestOrgID]; ok && group.groupName == groupName {
+			dests = append(dests, d.destination)
+		}
+	}
+	return dests, nil
+}
+
+// DeleteOrganization cleans up the storage from all the records associated with the organization
+func (store *TestStorage) DeleteOrganization(orgID string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.messagingGroups, orgID)
+	for id, d := range store.destinations {
+		if d.destination.DestOrgID == orgID {
+			delete(store.destinations, id)
+		}
+	}
+	store.deleteNotifications(func(n common.Notification) bool {
+		return n.DestOrgID == orgID
+	})
+	for id, acl := range store.acls {
+		if acl.orgID == orgID {
+			delete(store.acls, id)
+		}
+	}
+	for id, group := range store.aclGroups {
+		if group.OrgID == orgID {
+			delete(store.aclGroups, id)
+		}
+	}
+	for hash, token := range store.apiTokens {
+		if token.OrgID == orgID {
+			delete(store.apiTokens, hash)
+		}
+	}
+	for id, policy := range store.retention {
+		if policy.OrgID == orgID {
+			delete(store.retention, id)
+		}
+	}
+	for id, policy := range store.webhookPolicies {
+		if policy.OrgID == orgID {
+			delete(store.webhookPolicies, id)
+		}
+	}
+	for id, failure := range store.webhookFailures {
+		if failure.OrgID == orgID {
+			delete(store.webhookFailures, id)
+		}
+	}
+	for id, object := range store.objects {
+		if object.meta.DestOrgID == orgID {
+			delete(store.objects, id)
+		}
+	}
+	store.deleteAuditRecords(func(record common.AuditRecord) bool {
+		return record.OrgID == orgID
+	})
+
+	for id, version := range store.objectVersions {
+		if version.meta.DestOrgID == orgID {
+			delete(store.objectVersions, id)
+		}
+	}
+	return nil
+}
+
+// ExportOrganization writes all the records associated with the organization to the writer
+func (store *TestStorage) ExportOrganization(orgID string, w io.Writer) common.SyncServiceError {
+	store.lock.Lock()
+	exported := make([]exportedObject, 0)
+	for _, object := range store.objects {
+		if object.meta.DestOrgID == orgID {
+			exported = append(exported, exportedObject{MetaData: object.meta, Status: object.status})
+		}
+	}
+	exportedNotifications := make([]common.Notification, 0)
+	for _, notification := range store.notifications {
+		if notification.DestOrgID == orgID {
+			exportedNotifications = append(exportedNotifications, notification)
+		}
+	}
+	hooks := make(map[string][]string)
+	for id, objectHooks := range store.webhooks {
+		if parts, err := common.ParseCompositeID(id); err == nil && len(parts) == 2 && parts[0] == orgID {
+			hooks[parts[1]] = append([]string(nil), objectHooks...)
+		}
+	}
+	store.lock.Unlock()
+
+	return exportOrganization(store, orgID, w, exported, exportedNotifications, hooks)
+}
+
+// ImportOrganization stores the records of an organization read from an export created by ExportOrganization
+func (store *TestStorage) ImportOrganization(r io.Reader) common.SyncServiceError {
+	return importOrganization(store, r)
+}
+
+// IsConnected returns false if the storage cannont be reached, and true otherwise
+func (store *TestStorage) IsConnected() bool {
+	return true
+}
+
+// StoreOrganization stores organization information
+// Returns the stored record timestamp for multiple CSS updates
+func (store *TestStorage) StoreOrganization(org common.Organization) (time.Time, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	timestamp := time.Now()
+	store.organizations[org.OrgID] = common.StoredOrganization{Org: org, Timestamp: timestamp}
+	return timestamp, nil
+}
+
+// RetrieveOrganizationInfo retrieves organization information
+func (store *TestStorage) RetrieveOrganizationInfo(orgID string) (*common.StoredOrganization, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if org, ok := store.organizations[orgID]; ok {
+		return &org, nil
+	}
+	return nil, nil
+}
+
+// DeleteOrganizationInfo deletes organization information
+func (store *TestStorage) DeleteOrganizationInfo(orgID string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.organizations, orgID)
+	return nil
+}
+
+// RetrieveOrganizations retrieves stored organizations' info
+func (store *TestStorage) RetrieveOrganizations() ([]common.StoredOrganization, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	orgs := make([]common.StoredOrganization, 0)
+	for _, org := range store.organizations {
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
+
+// RetrieveOrganizationsPage retrieves up to limit stored organizations' info, ordered by organization ID,
+// skipping the first offset organizations
+func (store *TestStorage) RetrieveOrganizationsPage(offset int, limit int) ([]common.StoredOrganization, int, common.SyncServiceError) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, &common.InvalidRequest{Message: "Offset and limit must be non-negative numbers"}
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	orgs := make([]common.StoredOrganization, 0, len(store.organizations))
+	for _, org := range store.organizations {
+		orgs = append(orgs, org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Org.OrgID < orgs[j].Org.OrgID })
+	total := len(orgs)
+	if offset >= total {
+		return make([]common.StoredOrganization, 0), total, nil
+	}
+	orgs = orgs[offset:]
+	if limit > 0 && limit < len(orgs) {
+		orgs = orgs[:limit]
+	}
+	return orgs, total, nil
+}
+
+// RetrieveUpdatedOrganizations retrieves organizations that were updated after the specified time
+func (store *TestStorage) RetrieveUpdatedOrganizations(time time.Time) ([]common.StoredOrganization, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	orgs := make([]common.StoredOrganization, 0)
+	for _, org := range store.organizations {
+		if !org.Timestamp.Before(time) {
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs, nil
+}
+
+// AddUsersToACL adds users to an ACL
+func (store *TestStorage) AddUsersToACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	if key == "" {
+		key = "*"
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createACLID(orgID, aclType, key)
+	acl, ok := store.acls[id]
+	if !ok {
+		acl = testACL{orgID: orgID, aclType: aclType, key: key}
+	}
+	users, _ = normalizeACLEntries(users)
+	integratedUsers := make([]common.ACLentry, 0)
+	integratedUsers = append(integratedUsers, users...)
+	// Keep the existing entries that are not in the input list
+	for _, entry := range acl.users {
+		add := true
+		for _, user := range users {
+			if sameACLUser(entry, user) {
+				add = false
+				break
+			}
+		}
+		if add {
+			integratedUsers = append(integratedUsers, entry)
+		}
+	}
+	acl.users = integratedUsers
+	store.acls[id] = acl
+	return nil
+}
+
+// RemoveUsersFromACL removes users from an ACL
+func (store *TestStorage) RemoveUsersFromACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	if key == "" {
+		key = "*"
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createACLID(orgID, aclType, key)
+	acl, ok := store.acls[id]
+	if !ok {
+		return &Error{fmt.Sprintf("Failed to delete a %s ACL. Error: %s.", aclType, notFound)}
+	}
+	for _, user := range users {
+		for i, entry := range acl.users {
+			if sameACLUser(entry, user) {
+				if len(acl.users) == 1 {
+					// Deleting the last user, delete the ACL
+					delete(store.acls, id)
+					return nil
+				}
+				acl.users[i] = acl.users[len(acl.users)-1]
+				acl.users = acl.users[:len(acl.users)-1]
+				break
+			}
+		}
+	}
+	store.acls[id] = acl
+	return nil
+}
+
+// SetACL replaces the users of an ACL with the provided users, an empty list of users deletes the ACL
+func (store *TestStorage) SetACL(aclType string, orgID string, key string, users []common.ACLentry) common.SyncServiceError {
+	if key == "" {
+		key = "*"
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createACLID(orgID, aclType, key)
+	users, _ = normalizeACLEntries(users)
+	if len(users) == 0 {
+		delete(store.acls, id)
+		return nil
+	}
+	store.acls[id] = testACL{orgID: orgID, aclType: aclType, key: key, users: users}
+	return nil
+}
+
+// RetrieveACL retrieves the list of usernames on an ACL
+func (store *TestStorage) RetrieveACL(aclType string, orgID string, key string, aclUserType string) ([]common.ACLentry, common.SyncServiceError) {
+	if key == "" {
+		key = "*"
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	users := make([]common.ACLentry, 0)
+	acl, ok := store.acls[createACLID(orgID, aclType, key)]
+	if !ok {
+		return users, nil
+	}
+	for _, entry := range acl.users {
+		if aclUserType == "" || entry.ACLUserType == aclUserType {
+			users = append(users, entry)
+		}
+	}
+	return users, nil
+}
+
+// RetrieveACLsInOrg retrieves the list of ACLs in an organization
+func (store *TestStorage) RetrieveACLsInOrg(aclType string, orgID string) ([]string, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make([]string, 0)
+	for _, acl := range store.acls {
+		if acl.aclType == aclType && acl.orgID == orgID {
+			result = append(result, acl.key)
+		}
+	}
+	return result, nil
+}
+
+// RetrieveObjOrDestTypeForGivenACLUser retrieves object types that given acl user has access to
+func (store *TestStorage) RetrieveObjOrDestTypeForGivenACLUser(aclType string, orgID string, aclUserType string, aclUsername string, aclRole string) ([]string, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	aclUsername = common.NormalizeACLUsername(aclUsername)
+	result := make([]string, 0)
+	for _, acl := range store.acls {
+		if acl.aclType != aclType || acl.orgID != orgID {
+			continue
+		}
+		for _, user := range acl.users {
+			if user.ACLUserType == aclUserType && user.Username == aclUsername &&
+				(aclRole == "" || aclRole == "*" || user.ACLRole == aclRole) {
+				result = append(result, acl.key)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// NormalizeACLUsernames rewrites the stored ACLs with normalized usernames, merging the entries of the same user.
+// Returns the number of the modified ACLs.
+func (store *TestStorage) NormalizeACLUsernames() (int, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	modified := 0
+	for id, acl := range store.acls {
+		if users, changed := normalizeACLEntries(acl.users); changed {
+			acl.users = users
+			store.acls[id] = acl
+			modified++
+		}
+	}
+	return modified, nil
+}
+
+// CheckACL returns true if the user is granted access by the ACL of the key or by the ACL of all the keys,
+// either directly, by a wildcard entry, or by the membership in a group
+func (store *TestStorage) CheckACL(aclType string, orgID string, key string, username string) (bool, common.SyncServiceError) {
+	return checkACL(store, aclType, orgID, key, username)
+}
+
+// StoreACLGroup stores an ACL group, replacing its members if it already exists
+func (store *TestStorage) StoreACLGroup(group common.ACLGroup) common.SyncServiceError {
+	if err := validateACLGroup(group); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	group.Members = append([]string(nil), group.Members...)
+	store.aclGroups[createACLGroupID(group.OrgID, group.Name)] = group
+	return nil
+}
+
+// RetrieveACLGroup retrieves an ACL group, returns nil if the group doesn't exist
+func (store *TestStorage) RetrieveACLGroup(orgID string, name string) (*common.ACLGroup, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	group, ok := store.aclGroups[createACLGroupID(orgID, name)]
+	if !ok {
+		return nil, nil
+	}
+	group.Members = append([]string(nil), group.Members...)
+	return &group, nil
+}
+
+// RetrieveACLGroups retrieves the ACL groups of an organization
+func (store *TestStorage) RetrieveACLGroups(orgID string) ([]common.ACLGroup, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	groups := make([]common.ACLGroup, 0)
+	for _, group := range store.aclGroups {
+		if group.OrgID == orgID {
+			group.Members = append([]string(nil), group.Members...)
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// DeleteACLGroup deletes an ACL group
+func (store *TestStorage) DeleteACLGroup(orgID string, name string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.aclGroups, createACLGroupID(orgID, name))
+	return nil
+}
+
+// StoreRetentionPolicy stores the retention policy of an object type, replacing the existing policy of the type
+func (store *TestStorage) StoreRetentionPolicy(policy common.RetentionPolicy) common.SyncServiceError {
+	if err := validateRetentionPolicy(policy); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if policy.MaxVersions != nil {
+		maxVersions := *policy.MaxVersions
+		policy.MaxVersions = &maxVersions
+	}
+	store.retention[common.CreateCompositeID(policy.OrgID, policy.ObjectType)] = policy
+	return nil
+}
+
+// RetrieveRetentionPolicy retrieves the retention policy of an object type, returns nil if the type doesn't have a policy
+func (store *TestStorage) RetrieveRetentionPolicy(orgID string, objectType string) (*common.RetentionPolicy, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.retentionPolicy(orgID, objectType), nil
+}
+
+// retentionPolicy returns the retention policy of an object type, must be called with the store's lock held
+func (store *TestStorage) retentionPolicy(orgID string, objectType string) *common.RetentionPolicy {
+	policy, ok := store.retention[common.CreateCompositeID(orgID, objectType)]
+	if !ok {
+		return nil
+	}
+	return &policy
+}
+
+// RetrieveRetentionPolicies retrieves the retention policies of an organization,
+// or of all the organizations if orgID is empty
+func (store *TestStorage) RetrieveRetentionPolicies(orgID string) ([]common.RetentionPolicy, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	policies := make([]common.RetentionPolicy, 0)
+	for _, policy := range store.retention {
+		if orgID == "" || policy.OrgID == orgID {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+// DeleteRetentionPolicy deletes the retention policy of an object type
+func (store *TestStorage) DeleteRetentionPolicy(orgID string, objectType string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.retention, common.CreateCompositeID(orgID, objectType))
+	return nil
+}
+
+// StoreAPIToken stores an API token, replacing it if a token with the same hash already exists
+func (store *TestStorage) StoreAPIToken(token common.APIToken) common.SyncServiceError {
+	if err := validateAPIToken(token); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.apiTokens[token.Hash] = token
+	return nil
+}
+
+// RetrieveAPIToken retrieves the API token with the given hash, returns nil if the token doesn't exist
+func (store *TestStorage) RetrieveAPIToken(hash string) (*common.APIToken, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	token, ok := store.apiTokens[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+// RetrieveAPITokens retrieves the API tokens of an organization
+func (store *TestStorage) RetrieveAPITokens(orgID string) ([]common.APIToken, common.SyncServiceError) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	tokens := make([]common.APIToken, 0)
+	for _, token := range store.apiTokens {
+		if token.OrgID == orgID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes the API token with the given hash, the token can't be used after it is revoked
+func (store *TestStorage) RevokeAPIToken(hash string) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.apiTokens, hash)
+	return nil
+}
+
+// IsPersistent returns true if the storage is persistent, and false otherwise
+func (store *TestStorage) IsPersistent() bool {
+	return false
+}
+
+func (store *TestStorage) getInstanceID() int64 {
+	// Always called from inside the lock - no need to lock here
+	store.timebase++
+	return store.timebase
+}
+
+// updateObject applies the function to the object under the store's lock, returns notFound if the object doesn't exist
+func (store *TestStorage) updateObject(orgID string, objectType string, objectID string, function func(*testObject)) common.SyncServiceError {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	object, ok := store.objects[id]
+	if !ok {
+		return notFound
+	}
+	function(&object)
+	object.lastUpdate = time.Now()
+	store.objects[id] = object
+	return nil
+}
+
+func (store *TestStorage) retrieveMetaData(function func(testObject) bool) []common.MetaData {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	metaDatas := make([]common.MetaData, 0)
+	for _, object := range store.objects {
+		if function(object) {
+			metaDatas = append(metaDatas, object.meta)
+		}
+	}
+	return metaDatas
+}
+
+func (store *TestStorage) retrievePolicies(function func(testObject) bool) []common.ObjectDestinationPolicy {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	policies := make([]common.ObjectDestinationPolicy, 0)
+	for _, object := range store.objects {
+		if !function(object) {
+			continue
+		}
+		destinationList := make([]common.DestinationsStatus, len(object.destinations))
+		for i, d := range object.destinations {
+			destinationList[i] = common.DestinationsStatus{DestType: d.Destination.DestType, DestID: d.Destination.DestID,
+				Status: d.Status, Message: d.Message}
+		}
+		policies = append(policies, common.ObjectDestinationPolicy{OrgID: object.meta.DestOrgID, ObjectType: object.meta.ObjectType,
+			ObjectID: object.meta.ObjectID, DestinationPolicy: object.meta.DestinationPolicy, Destinations: destinationList})
+	}
+	return policies
+}
+
+// deleteNotifications removes the notifications matching the function, must be called while holding the lock
+func (store *TestStorage) deleteNotifications(function func(common.Notification) bool) {
+	for id, n := range store.notifications {
+		if function(n) {
+			delete(store.notifications, id)
+		}
+	}
+}
+
+func copyData(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	result := make([]byte, len(data))
+	copy(result, data)
+	return result
+}
+
+func copyDestinationsStatus(dests []common.StoreDestinationStatus) []common.StoreDestinationStatus {
+	if dests == nil {
+		return nil
+	}
+	result := make([]common.StoreDestinationStatus, len(dests))
+	copy(result, dests)
+	return result
+}
+
+// addAuditRecord appends the record to the audit log, the caller must hold the store's lock
+func (store *TestStorage) addAuditRecord(record common.AuditRecord) {
+	id := createObjectCollectionID(record.OrgID, record.ObjectType, record.ObjectID)
+	store.audit[id] = append(store.audit[id], record)
+}
+
+// deleteAuditRecords deletes the matching audit records, the caller must hold the store's lock
+func (store *TestStorage) deleteAuditRecords(match func(common.AuditRecord) bool) {
+	for id, records := range store.audit {
+		kept := make([]common.AuditRecord, 0, len(records))
+		for _, record := range records {
+			if !match(record) {
+				kept = append(kept, record)
+			}
+		}
+		if len(kept) == 0 {
+			delete(store.audit, id)
+		} else {
+			store.audit[id] = kept
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"testing"
+)
+
+// testStorageType is used by setUpStorage to create a TestStorage
+const testStorageType = "test"
+
+func TestTestStorageObjects(t *testing.T) {
+	testStorageObjects(testStorageType, t)
+}
+
+func TestTestStorageObjectsWithPolicy(t *testing.T) {
+	testStorageObjectsWithPolicy(testStorageType, t)
+}
+
+func TestTestStorageGetObjectWithFilters(t *testing.T) {
+	testGetObjectWithFilters(testStorageType, t)
+}
+
+func TestTestStorageObjectActivation(t *testing.T) {
+	testStorageObjectActivation(testStorageType, t)
+}
+
+func TestTestStorageUndeleteObject(t *testing.T) {
+	testStorageUndeleteObject(testStorageType, t)
+}
+
+func TestTestStoragePatchObjectMetadata(t *testing.T) {
+	testStoragePatchObjectMetadata(testStorageType, t)
+}
+
+func TestTestStorageTouchObject(t *testing.T) {
+	testStorageTouchObject(testStorageType, t)
+}
+
+func TestTestStorageAuditLog(t *testing.T) {
+	testStorageAuditLog(testStorageType, t)
+}
+
+func TestTestStorageAuditLogRetention(t *testing.T) {
+	testStorageAuditLogRetention(testStorageType, t)
+}
+
+func TestTestStorageObjectVersions(t *testing.T) {
+	testStorageObjectVersions(testStorageType, t)
+}
+
+func TestTestStorageRetentionPolicies(t *testing.T) {
+	testStorageRetentionPolicies(testStorageType, t)
+}
+
+func TestTestStorageWebhookRetryPolicies(t *testing.T) {
+	testStorageWebhookRetryPolicies(testStorageType, t)
+}
+
+func TestTestStorageMaxDeliveriesPerDestination(t *testing.T) {
+	testStorageMaxDeliveriesPerDestination(testStorageType, t)
+}
+
+func TestTestStorageSourceDataURI(t *testing.T) {
+	testStorageSourceDataURI(testStorageType, t)
+}
+
+func TestTestStorageIdempotencyKeys(t *testing.T) {
+	testStorageIdempotencyKeys(testStorageType, t)
+}
+
+func TestTestStorageObjectStatusCounts(t *testing.T) {
+	testStorageObjectStatusCounts(testStorageType, t)
+}
+
+func TestTestStorageStorageStatsByType(t *testing.T) {
+	testStorageStorageStatsByType(testStorageType, t)
+}
+
+func TestTestStorageObjectIDSeparator(t *testing.T) {
+	testStorageObjectIDSeparator(testStorageType, t)
+}
+
+func TestTestStorageBroadcastObjects(t *testing.T) {
+	testStorageBroadcastObjects(testStorageType, t)
+}
+
+func TestTestStoragePinnedObjects(t *testing.T) {
+	testStoragePinnedObjects(testStorageType, t)
+}
+
+func TestTestStorageStoreDestinations(t *testing.T) {
+	testStorageStoreDestinations(testStorageType, t)
+}
+
+func TestTestStorageObjectsWithMissingData(t *testing.T) {
+	testStorageObjectsWithMissingData(testStorageType, t)
+}
+
+func TestTestStorageDeliveryAttempts(t *testing.T) {
+	testStorageDeliveryAttempts(testStorageType, t)
+}
+
+func TestTestStorageObjectsBySizeAndAge(t *testing.T) {
+	testStorageObjectsBySizeAndAge(testStorageType, t)
+}
+
+func TestTestStorageAPITokens(t *testing.T) {
+	testStorageAPITokens(testStorageType, t)
+}
+
+func TestTestStorageDestinationObjectTypesACL(t *testing.T) {
+	testStorageDestinationObjectTypesACL(testStorageType, t)
+}
+
+func TestTestStorageObjectsApproachingDeadline(t *testing.T) {
+	testStorageObjectsApproachingDeadline(testStorageType, t)
+}
+
+func TestTestStoragePartialObjectData(t *testing.T) {
+	testStoragePartialObjectData(testStorageType, t)
+}
+
+func TestTestStorageReplaceObject(t *testing.T) {
+	testStorageReplaceObject(testStorageType, t)
+}
+
+func TestTestStorageSetACL(t *testing.T) {
+	testStorageSetACL(testStorageType, t)
+}
+
+func TestTestStorageObjectsByIDs(t *testing.T) {
+	testStorageObjectsByIDs(testStorageType, t)
+}
+
+func TestTestStorageObjectMetadataBatch(t *testing.T) {
+	testStorageObjectMetadataBatch(testStorageType, t)
+}
+
+func TestTestStorageObjectAttachment(t *testing.T) {
+	testStorageObjectAttachment(testStorageType, t)
+}
+
+func TestTestStorageObjectDelta(t *testing.T) {
+	testStorageObjectDelta(testStorageType, t)
+}
+
+func TestTestStorageDataAccessLog(t *testing.T) {
+	testStorageDataAccessLog(testStorageType, t)
+}
+
+func TestTestStorageDeleteObjectsOfType(t *testing.T) {
+	testStorageDeleteObjectsOfType(testStorageType, t)
+}
+
+func TestTestStorageObjectStatusChange(t *testing.T) {
+	testStorageObjectStatusChange(testStorageType, t)
+}
+
+func TestTestStoragePurgeCompletedNotifications(t *testing.T) {
+	testStoragePurgeCompletedNotifications(testStorageType, t)
+}
+
+func TestTestStorageLeaderHandoff(t *testing.T) {
+	testStorageLeaderHandoff(testStorageType, t)
+}
+
+func TestTestStorageLeaderAlive(t *testing.T) {
+	testStorageLeaderAlive(testStorageType, t)
+}
+
+func TestTestStorageRetrieveObjectIfModifiedSince(t *testing.T) {
+	testStorageRetrieveObjectIfModifiedSince(testStorageType, t)
+}
+
+func TestTestStorageExportImportOrganization(t *testing.T) {
+	testStorageExportImportOrganization(testStorageType, t)
+}
+
+func TestTestStorageObjectExpiration(t *testing.T) {
+	testStorageObjectExpiration(testStorageType, t)
+}
+
+func TestTestStorageObjectData(t *testing.T) {
+	testStorageObjectData(testStorageType, t)
+}
+
+func TestTestStorageMaxObjectSize(t *testing.T) {
+	testStorageMaxObjectSize(testStorageType, t)
+}
+
+func TestTestStorageOrgDeleteObjects(t *testing.T) {
+	testStorageOrgDeleteObjects(testStorageType, t)
+}
+
+func TestTestStorageNotifications(t *testing.T) {
+	testStorageNotifications(testStorageType, t)
+}
+
+func TestTestStorageNotificationResendBackoff(t *testing.T) {
+	testStorageNotificationResendBackoff(testStorageType, t)
+}
+
+func TestTestStorageDataComplete(t *testing.T) {
+	testStorageDataComplete(testStorageType, t)
+}
+
+func TestTestStorageOrgDeleteNotifications(t *testing.T) {
+	testStorageOrgDeleteNotifications(testStorageType, t)
+}
+
+func TestTestStorageOrgDeleteACLs(t *testing.T) {
+	testStorageOrgDeleteACLs(testStorageType, t)
+}
+
+func TestTestStorageCheckACL(t *testing.T) {
+	testStorageCheckACL(testStorageType, t)
+}
+
+func TestTestStorageACLUsernameNormalization(t *testing.T) {
+	testStorageACLUsernameNormalization(testStorageType, t)
+}
+
+func TestTestStorageRetrieveObjectsForDestination(t *testing.T) {
+	testStorageRetrieveObjectsForDestination(testStorageType, t)
+}
+
+func TestTestStorageMessagingGroups(t *testing.T) {
+	testStorageMessagingGroups(testStorageType, t)
+}
+
+func TestTestStorageObjectDestinations(t *testing.T) {
+	testStorageObjectDestinations(testStorageType, t)
+}
+
+func TestTestStorageIncompleteObjects(t *testing.T) {
+	testStorageIncompleteObjects(testStorageType, t)
+}
+
+func TestTestStorageNoDataObjects(t *testing.T) {
+	testStorageNoDataObjects(testStorageType, t)
+}
+
+func TestTestStorageWebhooks(t *testing.T) {
+	testStorageWebhooks(testStorageType, t)
+}
+
+func TestTestStorageOrganizations(t *testing.T) {
+	testStorageOrganizations(testStorageType, t)
+}
+
+func TestTestStorageInactiveDestinations(t *testing.T) {
+	testStorageInactiveDestinations(testStorageType, t)
+}
+
+func TestTestStorageOfflineDestinations(t *testing.T) {
+	testStorageOfflineDestinations(testStorageType, t)
+}
+
+func TestTestStorageRegisterDestination(t *testing.T) {
+	testStorageRegisterDestination(testStorageType, t)
+}
+
+func TestTestStorageDecommissionDestination(t *testing.T) {
+	testStorageDecommissionDestination(testStorageType, t)
+}